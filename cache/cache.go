@@ -0,0 +1,317 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Khighness/khighdb/util"
+)
+
+// @Author KHighness
+// @Update 2023-01-15
+
+const (
+	// DefaultShardNum is the default number of shards of Cache.
+	DefaultShardNum = 16
+
+	// minShardExpectedItems is the min number of expected entries of every shard when
+	// ExpectedItems is not specified, so that a small cache still has a sketch wide
+	// enough to tell the frequent keys from the others.
+	minShardExpectedItems = 1024
+
+	// avgEntrySize is the assumed average bytes of an entry to derive ExpectedItems.
+	avgEntrySize = 64
+)
+
+// Policy defines the eviction policy of cache.
+type Policy int8
+
+const (
+	// LRU evicts the least recently used entry.
+	LRU Policy = iota
+
+	// WTinyLFU puts new entries in a small LRU window, an entry evicted from the window
+	// is admitted into the main segmented LRU only if it is estimated to be accessed more
+	// frequently than the entry it would evict. It is resistant to scans and one-hit wonders.
+	WTinyLFU
+)
+
+// EvictReason defines the reason why an entry is removed from cache.
+type EvictReason int8
+
+const (
+	// EvictCapacity represents the entry is evicted or rejected due to capacity.
+	EvictCapacity EvictReason = iota
+	// EvictExpired represents the entry is expired.
+	EvictExpired
+	// EvictDeleted represents the entry is deleted by Delete or Purge.
+	EvictDeleted
+	// EvictReplaced represents the entry is replaced by Set with the same key.
+	EvictReplaced
+)
+
+// EvictionListener is called after an entry is removed from cache.
+// It is called without holding any lock, so it is safe to access cache in it.
+type EvictionListener func(key, value []byte, reason EvictReason)
+
+// Options defines the options for creating a Cache.
+type Options struct {
+	// MaxBytes is the max total bytes of keys and values, which is shared equally by shards.
+	MaxBytes int64
+
+	// Shards is the number of shards, every shard has its own lock.
+	// Default value is DefaultShardNum.
+	Shards int
+
+	// Policy is the eviction policy, support LRU and WTinyLFU now.
+	// Default value is LRU.
+	Policy Policy
+
+	// ExpectedItems is the expected number of entries, which is used to size the frequency
+	// sketch of WTinyLFU. Default value is MaxBytes / 64, and at least 1024 for every shard.
+	ExpectedItems int
+
+	// OnEvict is called after an entry is removed from cache, it can be nil.
+	OnEvict EvictionListener
+}
+
+// Stats describes the stats of cache.
+type Stats struct {
+	// Hits is the number of Get which finds the key.
+	Hits uint64
+	// Misses is the number of Get which does not find the key.
+	Misses uint64
+	// Evictions is the number of entries evicted due to capacity or expiration.
+	Evictions uint64
+}
+
+// HitRatio returns the ratio of hits to all the Get.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// Cache is a byte-bounded and sharded cache, with TTL per entry.
+// Expired entries are removed lazily when they are read or picked up by eviction.
+type Cache struct {
+	shards    []*shard
+	onEvict   EvictionListener
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// entry is the item stored in cache.
+type entry struct {
+	key      string
+	value    []byte
+	hash     uint64
+	expireAt int64
+	segment  segment
+	elem     *list.Element
+}
+
+// size returns the bytes taken by the entry.
+func (e *entry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+// expired checks if the entry is expired at the time.
+func (e *entry) expired(now int64) bool {
+	return e.expireAt != 0 && e.expireAt <= now
+}
+
+// evicted is an entry removed from cache to be notified.
+type evicted struct {
+	e      *entry
+	reason EvictReason
+}
+
+type shard struct {
+	mu     sync.Mutex
+	items  map[string]*entry
+	policy policy
+}
+
+// New creates a new Cache.
+func New(opts Options) *Cache {
+	if opts.Shards <= 0 {
+		opts.Shards = DefaultShardNum
+	}
+	if opts.ExpectedItems <= 0 {
+		opts.ExpectedItems = int(opts.MaxBytes / avgEntrySize)
+		if opts.ExpectedItems < minShardExpectedItems*opts.Shards {
+			opts.ExpectedItems = minShardExpectedItems * opts.Shards
+		}
+	}
+	c := &Cache{shards: make([]*shard, opts.Shards), onEvict: opts.OnEvict}
+	capacity := opts.MaxBytes / int64(opts.Shards)
+	for i := range c.shards {
+		s := &shard{items: make(map[string]*entry)}
+		if opts.Policy == WTinyLFU {
+			s.policy = newTinyLFUPolicy(capacity, opts.ExpectedItems/opts.Shards)
+		} else {
+			s.policy = newLRUPolicy(capacity)
+		}
+		c.shards[i] = s
+	}
+	return c
+}
+
+// Get gets the value by a key.
+func (c *Cache) Get(key []byte) ([]byte, bool) {
+	hash := util.MemHash(key)
+	s := c.shard(hash)
+	var expired *entry
+
+	s.mu.Lock()
+	e, ok := s.items[string(key)]
+	if ok && e.expired(time.Now().UnixNano()) {
+		s.remove(e)
+		expired, ok = e, false
+	}
+	if ok {
+		s.policy.access(e)
+	} else {
+		s.policy.record(hash)
+	}
+	s.mu.Unlock()
+
+	if expired != nil {
+		atomic.AddUint64(&c.evictions, 1)
+		c.notify([]evicted{{expired, EvictExpired}})
+	}
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	return e.value, true
+}
+
+// Set adds a key-value pair to cache, the value will be updated if the key already exists.
+func (c *Cache) Set(key, value []byte) {
+	c.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL adds a key-value pair to cache with time to live, the entry never expires if
+// ttl is not positive.
+func (c *Cache) SetWithTTL(key, value []byte, ttl time.Duration) {
+	e := &entry{key: string(key), value: value, hash: util.MemHash(key)}
+	if ttl > 0 {
+		e.expireAt = time.Now().Add(ttl).UnixNano()
+	}
+	s := c.shard(e.hash)
+	var removed []evicted
+
+	s.mu.Lock()
+	if old, ok := s.items[e.key]; ok {
+		s.remove(old)
+		removed = append(removed, evicted{old, EvictReplaced})
+	}
+	s.items[e.key] = e
+	now := time.Now().UnixNano()
+	for _, victim := range s.policy.add(e) {
+		delete(s.items, victim.key)
+		reason := EvictCapacity
+		if victim.expired(now) {
+			reason = EvictExpired
+		}
+		removed = append(removed, evicted{victim, reason})
+	}
+	s.mu.Unlock()
+
+	for _, r := range removed {
+		if r.reason != EvictReplaced {
+			atomic.AddUint64(&c.evictions, 1)
+		}
+	}
+	c.notify(removed)
+}
+
+// Delete removes the key from cache, returns false if the key does not exist.
+func (c *Cache) Delete(key []byte) bool {
+	s := c.shard(util.MemHash(key))
+	s.mu.Lock()
+	e, ok := s.items[string(key)]
+	if ok {
+		s.remove(e)
+	}
+	s.mu.Unlock()
+
+	if ok {
+		c.notify([]evicted{{e, EvictDeleted}})
+	}
+	return ok
+}
+
+// Purge removes all the entries from cache.
+func (c *Cache) Purge() {
+	for _, s := range c.shards {
+		var removed []evicted
+		s.mu.Lock()
+		if c.onEvict != nil {
+			for _, e := range s.items {
+				removed = append(removed, evicted{e, EvictDeleted})
+			}
+		}
+		s.items = make(map[string]*entry)
+		s.policy.clear()
+		s.mu.Unlock()
+		c.notify(removed)
+	}
+}
+
+// Len returns the number of entries in cache.
+func (c *Cache) Len() int {
+	var n int
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n += len(s.items)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Size returns the total bytes of keys and values in cache.
+func (c *Cache) Size() int64 {
+	var n int64
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n += s.policy.size()
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Stats returns the stats of cache.
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+	}
+}
+
+func (c *Cache) shard(hash uint64) *shard {
+	return c.shards[hash%uint64(len(c.shards))]
+}
+
+func (c *Cache) notify(removed []evicted) {
+	if c.onEvict == nil {
+		return
+	}
+	for _, r := range removed {
+		c.onEvict([]byte(r.e.key), r.e.value, r.reason)
+	}
+}
+
+func (s *shard) remove(e *entry) {
+	delete(s.items, e.key)
+	s.policy.remove(e)
+}
@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-15
+
+func TestCache_Get(t *testing.T) {
+	for name, policy := range map[string]Policy{"lru": LRU, "w-tinylfu": WTinyLFU} {
+		t.Run(name, func(t *testing.T) {
+			cache := New(Options{MaxBytes: 1 << 20, Shards: 4, Policy: policy})
+			cache.Set([]byte("k1"), []byte("v1"))
+			v1, ok := cache.Get([]byte("k1"))
+			assert.Equal(t, true, ok)
+			assert.Equal(t, []byte("v1"), v1)
+			_, ok = cache.Get([]byte("k2"))
+			assert.Equal(t, false, ok)
+
+			cache.Set([]byte("k1"), []byte("v1v1"))
+			v1, _ = cache.Get([]byte("k1"))
+			assert.Equal(t, []byte("v1v1"), v1)
+			assert.Equal(t, 1, cache.Len())
+			assert.Equal(t, int64(6), cache.Size())
+
+			stats := cache.Stats()
+			assert.Equal(t, uint64(2), stats.Hits)
+			assert.Equal(t, uint64(1), stats.Misses)
+			assert.InDelta(t, 2.0/3, stats.HitRatio(), 1e-9)
+		})
+	}
+}
+
+func TestCache_MaxBytes(t *testing.T) {
+	for name, policy := range map[string]Policy{"lru": LRU, "w-tinylfu": WTinyLFU} {
+		t.Run(name, func(t *testing.T) {
+			var evictions int
+			cache := New(Options{MaxBytes: 1 << 10, Shards: 4, Policy: policy,
+				OnEvict: func(key, value []byte, reason EvictReason) {
+					assert.Equal(t, EvictCapacity, reason)
+					evictions++
+				},
+			})
+			for i := 0; i < 1<<10; i++ {
+				cache.Set([]byte(fmt.Sprintf("key-%04d", i)), make([]byte, 8))
+			}
+			assert.True(t, cache.Size() <= 1<<10)
+			assert.True(t, cache.Len() > 0)
+			assert.Equal(t, 1<<10, cache.Len()+evictions)
+			assert.Equal(t, uint64(evictions), cache.Stats().Evictions)
+		})
+	}
+}
+
+func TestCache_LRU(t *testing.T) {
+	cache := New(Options{MaxBytes: 12, Shards: 1})
+	cache.Set([]byte("k1"), []byte("v1"))
+	cache.Set([]byte("k2"), []byte("v2"))
+	cache.Set([]byte("k3"), []byte("v3"))
+	cache.Get([]byte("k1"))
+	cache.Set([]byte("k4"), []byte("v4"))
+	_, ok := cache.Get([]byte("k2"))
+	assert.Equal(t, false, ok)
+	_, ok = cache.Get([]byte("k1"))
+	assert.Equal(t, true, ok)
+}
+
+func TestCache_TTL(t *testing.T) {
+	var reasons []EvictReason
+	cache := New(Options{MaxBytes: 1 << 10, OnEvict: func(key, value []byte, reason EvictReason) {
+		reasons = append(reasons, reason)
+	}})
+	cache.SetWithTTL([]byte("k1"), []byte("v1"), 10*time.Millisecond)
+	cache.Set([]byte("k2"), []byte("v2"))
+	_, ok := cache.Get([]byte("k1"))
+	assert.Equal(t, true, ok)
+
+	time.Sleep(20 * time.Millisecond)
+	_, ok = cache.Get([]byte("k1"))
+	assert.Equal(t, false, ok)
+	_, ok = cache.Get([]byte("k2"))
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []EvictReason{EvictExpired}, reasons)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestCache_Delete_Purge(t *testing.T) {
+	var reasons []EvictReason
+	cache := New(Options{MaxBytes: 1 << 10, OnEvict: func(key, value []byte, reason EvictReason) {
+		reasons = append(reasons, reason)
+	}})
+	cache.Set([]byte("k1"), []byte("v1"))
+	cache.Set([]byte("k2"), []byte("v2"))
+	cache.Set([]byte("k3"), []byte("v3"))
+	cache.Set([]byte("k3"), []byte("v3"))
+	assert.Equal(t, true, cache.Delete([]byte("k1")))
+	assert.Equal(t, false, cache.Delete([]byte("k1")))
+	assert.Equal(t, 2, cache.Len())
+
+	cache.Purge()
+	assert.Equal(t, 0, cache.Len())
+	assert.Equal(t, int64(0), cache.Size())
+	assert.Equal(t, []EvictReason{EvictReplaced, EvictDeleted, EvictDeleted, EvictDeleted}, reasons)
+	assert.Equal(t, uint64(0), cache.Stats().Evictions)
+}
+
+func TestCache_WTinyLFU_ScanResistant(t *testing.T) {
+	hot := func(i int) []byte {
+		return []byte(fmt.Sprintf("hot-%04d", i))
+	}
+	run := func(policy Policy) float64 {
+		cache := New(Options{MaxBytes: 100 * 16, Shards: 1, Policy: policy})
+		for round := 0; round < 10; round++ {
+			for i := 0; i < 50; i++ {
+				if _, ok := cache.Get(hot(i)); !ok {
+					cache.Set(hot(i), make([]byte, 8))
+				}
+			}
+			// A scan of keys which are accessed only once.
+			for i := 0; i < 200; i++ {
+				key := []byte(fmt.Sprintf("scan-%03d", round*200+i))
+				cache.Get(key)
+				cache.Set(key, make([]byte, 8))
+			}
+		}
+		var hits int
+		for i := 0; i < 50; i++ {
+			if _, ok := cache.Get(hot(i)); ok {
+				hits++
+			}
+		}
+		return float64(hits) / 50
+	}
+	assert.Equal(t, 0.0, run(LRU))
+	assert.True(t, run(WTinyLFU) > 0.8)
+}
+
+func TestCountMinSketch(t *testing.T) {
+	sketch := newCountMinSketch(64)
+	for i := 0; i < 20; i++ {
+		sketch.increment(1)
+	}
+	sketch.increment(2)
+	assert.Equal(t, uint8(sketchMaxCount), sketch.estimate(1))
+	assert.Equal(t, uint8(1), sketch.estimate(2))
+
+	sketch.reset()
+	assert.Equal(t, uint8(sketchMaxCount/2), sketch.estimate(1))
+	assert.Equal(t, uint8(0), sketch.estimate(2))
+}
+
+func BenchmarkCache_Get(b *testing.B) {
+	for name, policy := range map[string]Policy{"lru": LRU, "w-tinylfu": WTinyLFU} {
+		b.Run(name, func(b *testing.B) {
+			cache := New(Options{MaxBytes: 64 << 20, Policy: policy})
+			keys := make([][]byte, 1<<16)
+			for i := range keys {
+				keys[i] = []byte(fmt.Sprintf("key-%09d", i))
+				cache.Set(keys[i], make([]byte, 64))
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var i int
+				for pb.Next() {
+					cache.Get(keys[i&(len(keys)-1)])
+					i++
+				}
+			})
+		})
+	}
+}
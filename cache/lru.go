@@ -6,11 +6,14 @@ import (
 )
 
 // @Author KHighness
-// @Update 2022-11-26
+// @Update 2023-01-14
 
 // LruCache defines the structure of least recently used cache.
+// The cache can be bounded by the number of items or the total bytes of items.
 type LruCache struct {
 	capacity  int
+	maxBytes  int64
+	usedBytes int64
 	cacheMap  map[string]*list.Element
 	cacheList *list.List
 	mu        sync.Mutex
@@ -32,9 +35,20 @@ func NewLRUCache(capacity int) *LruCache {
 	return lru
 }
 
+// NewSizedLRUCache creates a new LRU cache bounded by the total bytes of keys and values.
+func NewSizedLRUCache(maxBytes int64) *LruCache {
+	lru := &LruCache{}
+	if maxBytes > 0 {
+		lru.maxBytes = maxBytes
+		lru.cacheMap = make(map[string]*list.Element)
+		lru.cacheList = list.New()
+	}
+	return lru
+}
+
 // Get gets the value by a key.
 func (lru *LruCache) Get(key []byte) ([]byte, bool) {
-	if lru.capacity <= 0 || len(lru.cacheMap) <= 0 {
+	if lru.cacheList == nil {
 		return nil, false
 	}
 	lru.mu.Lock()
@@ -53,7 +67,7 @@ func (lru *LruCache) get(key string) ([]byte, bool) {
 
 // Set add a key-value pair to cache, the value will updated it the key already exists.
 func (lru *LruCache) Set(key, value []byte) {
-	if lru.capacity <= 0 || key == nil {
+	if lru.cacheList == nil || key == nil {
 		return
 	}
 	lru.mu.Lock()
@@ -65,21 +79,65 @@ func (lru *LruCache) set(key string, value []byte) {
 	elem, ok := lru.cacheMap[key]
 	if ok {
 		item := lru.cacheMap[key].Value.(*lruItem)
+		lru.usedBytes += int64(len(value) - len(item.value))
 		item.value = value
 		lru.cacheList.MoveToFront(elem)
 	} else {
 		elem = lru.cacheList.PushFront(&lruItem{key: key, value: value})
 		lru.cacheMap[key] = elem
+		lru.usedBytes += int64(len(key) + len(value))
+	}
 
-		if lru.cacheList.Len() > lru.capacity {
-			lru.removeOldest()
-		}
+	for lru.cacheList.Len() > 0 && lru.exceeded() {
+		lru.removeOldest()
+	}
+}
+
+// Delete removes the key from cache, returns false if the key does not exist.
+func (lru *LruCache) Delete(key []byte) bool {
+	if lru.cacheList == nil {
+		return false
+	}
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	elem, ok := lru.cacheMap[string(key)]
+	if ok {
+		lru.removeElement(elem)
 	}
+	return ok
+}
+
+// Len returns the number of items in cache.
+func (lru *LruCache) Len() int {
+	if lru.cacheList == nil {
+		return 0
+	}
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	return lru.cacheList.Len()
+}
+
+// Size returns the total bytes of keys and values in cache.
+func (lru *LruCache) Size() int64 {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	return lru.usedBytes
+}
+
+func (lru *LruCache) exceeded() bool {
+	if lru.capacity > 0 && lru.cacheList.Len() > lru.capacity {
+		return true
+	}
+	return lru.maxBytes > 0 && lru.usedBytes > lru.maxBytes
 }
 
 func (lru *LruCache) removeOldest() {
-	elem := lru.cacheList.Back()
+	lru.removeElement(lru.cacheList.Back())
+}
+
+func (lru *LruCache) removeElement(elem *list.Element) {
 	lru.cacheList.Remove(elem)
 	item := elem.Value.(*lruItem)
 	delete(lru.cacheMap, item.key)
+	lru.usedBytes -= int64(len(item.key) + len(item.value))
 }
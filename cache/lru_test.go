@@ -32,3 +32,31 @@ func TestLruCache_Get(t *testing.T) {
 	v1, ok = cache.Get([]byte("k1"))
 	assert.Equal(t, false, ok)
 }
+
+func TestLruCache_MaxBytes(t *testing.T) {
+	cache := NewSizedLRUCache(12)
+	cache.Set([]byte("k1"), []byte("v1"))
+	cache.Set([]byte("k2"), []byte("v2"))
+	cache.Set([]byte("k3"), []byte("v3"))
+	assert.Equal(t, int64(12), cache.Size())
+
+	cache.Set([]byte("k4"), []byte("v4"))
+	_, ok := cache.Get([]byte("k1"))
+	assert.Equal(t, false, ok)
+	assert.Equal(t, 3, cache.Len())
+
+	cache.Set([]byte("k2"), []byte("v2v2"))
+	_, ok = cache.Get([]byte("k3"))
+	assert.Equal(t, false, ok)
+	assert.Equal(t, int64(10), cache.Size())
+}
+
+func TestLruCache_Delete(t *testing.T) {
+	cache := NewLRUCache(3)
+	cache.Set([]byte("k1"), []byte("v1"))
+	assert.Equal(t, true, cache.Delete([]byte("k1")))
+	assert.Equal(t, false, cache.Delete([]byte("k1")))
+	_, ok := cache.Get([]byte("k1"))
+	assert.Equal(t, false, ok)
+	assert.Equal(t, int64(0), cache.Size())
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"container/list"
+)
+
+// @Author KHighness
+// @Update 2023-01-15
+
+// segment defines which list the entry is in.
+type segment int8
+
+const (
+	segmentWindow segment = iota
+	segmentProbation
+	segmentProtected
+)
+
+// policy decides which entries should be evicted, it is not concurrent safe.
+type policy interface {
+	// access marks the entry is accessed.
+	access(e *entry)
+	// record records the access of a key which is not in cache.
+	record(hash uint64)
+	// add adds the entry and returns the entries evicted due to capacity,
+	// which may contain the added entry itself if it is rejected.
+	add(e *entry) []*entry
+	// remove removes the entry.
+	remove(e *entry)
+	// clear removes all the entries.
+	clear()
+	// size returns the total bytes of entries.
+	size() int64
+}
+
+// lruPolicy evicts the least recently used entry.
+type lruPolicy struct {
+	capacity int64
+	used     int64
+	ll       *list.List
+}
+
+func newLRUPolicy(capacity int64) *lruPolicy {
+	return &lruPolicy{capacity: capacity, ll: list.New()}
+}
+
+func (p *lruPolicy) access(e *entry) {
+	p.ll.MoveToFront(e.elem)
+}
+
+func (p *lruPolicy) record(uint64) {}
+
+func (p *lruPolicy) add(e *entry) []*entry {
+	e.elem = p.ll.PushFront(e)
+	p.used += e.size()
+
+	var victims []*entry
+	for p.used > p.capacity && p.ll.Len() > 0 {
+		victim := p.ll.Back().Value.(*entry)
+		p.remove(victim)
+		victims = append(victims, victim)
+	}
+	return victims
+}
+
+func (p *lruPolicy) remove(e *entry) {
+	p.ll.Remove(e.elem)
+	p.used -= e.size()
+}
+
+func (p *lruPolicy) clear() {
+	p.ll.Init()
+	p.used = 0
+}
+
+func (p *lruPolicy) size() int64 {
+	return p.used
+}
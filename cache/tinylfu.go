@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"container/list"
+)
+
+// @Author KHighness
+// @Update 2023-01-15
+
+const (
+	// windowRatio is the ratio of capacity used by the window LRU.
+	windowRatio = 0.01
+	// protectedRatio is the ratio of main capacity used by the protected segment.
+	protectedRatio = 0.8
+	// sketchDepth is the number of rows in count-min sketch.
+	sketchDepth = 4
+	// sketchMaxCount is the max value of a counter.
+	sketchMaxCount = 15
+)
+
+// sketchSeeds are used to derive the index of every row from a hash.
+var sketchSeeds = [sketchDepth]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+// tinyLFUPolicy is the W-TinyLFU policy.
+//
+//	+-----------+     +-------------------------------+
+//	|   window  | --> |      probation / protected    |
+//	|    LRU    |     |          segmented LRU        |
+//	+-----------+     +-------------------------------+
+//	                     ^ admitted by frequency sketch
+type tinyLFUPolicy struct {
+	windowCap    int64
+	mainCap      int64
+	protectedCap int64
+
+	window    *list.List
+	probation *list.List
+	protected *list.List
+
+	windowUsed    int64
+	probationUsed int64
+	protectedUsed int64
+
+	sketch *countMinSketch
+}
+
+func newTinyLFUPolicy(capacity int64, expectedItems int) *tinyLFUPolicy {
+	windowCap := int64(float64(capacity) * windowRatio)
+	if windowCap < 1 {
+		windowCap = 1
+	}
+	mainCap := capacity - windowCap
+	return &tinyLFUPolicy{
+		windowCap:    windowCap,
+		mainCap:      mainCap,
+		protectedCap: int64(float64(mainCap) * protectedRatio),
+		window:       list.New(),
+		probation:    list.New(),
+		protected:    list.New(),
+		sketch:       newCountMinSketch(expectedItems),
+	}
+}
+
+func (p *tinyLFUPolicy) access(e *entry) {
+	p.sketch.increment(e.hash)
+	switch e.segment {
+	case segmentWindow:
+		p.window.MoveToFront(e.elem)
+	case segmentProbation:
+		// Promote the entry to protected segment.
+		p.probation.Remove(e.elem)
+		p.probationUsed -= e.size()
+		e.segment, e.elem = segmentProtected, p.protected.PushFront(e)
+		p.protectedUsed += e.size()
+		// Demote the entries in protected segment to probation segment.
+		for p.protectedUsed > p.protectedCap && p.protected.Len() > 1 {
+			demoted := p.protected.Back().Value.(*entry)
+			p.protected.Remove(demoted.elem)
+			p.protectedUsed -= demoted.size()
+			demoted.segment, demoted.elem = segmentProbation, p.probation.PushFront(demoted)
+			p.probationUsed += demoted.size()
+		}
+	case segmentProtected:
+		p.protected.MoveToFront(e.elem)
+	}
+}
+
+func (p *tinyLFUPolicy) record(hash uint64) {
+	p.sketch.increment(hash)
+}
+
+func (p *tinyLFUPolicy) add(e *entry) []*entry {
+	p.sketch.increment(e.hash)
+	e.segment, e.elem = segmentWindow, p.window.PushFront(e)
+	p.windowUsed += e.size()
+
+	var victims []*entry
+	for p.windowUsed > p.windowCap && p.window.Len() > 0 {
+		// Move the candidate from window to probation segment.
+		candidate := p.window.Back().Value.(*entry)
+		p.window.Remove(candidate.elem)
+		p.windowUsed -= candidate.size()
+		candidate.segment, candidate.elem = segmentProbation, p.probation.PushFront(candidate)
+		p.probationUsed += candidate.size()
+
+		// The candidate competes with the victims in main segments.
+		for p.probationUsed+p.protectedUsed > p.mainCap {
+			victim := p.mainVictim()
+			if victim != candidate && p.sketch.estimate(candidate.hash) > p.sketch.estimate(victim.hash) {
+				p.remove(victim)
+				victims = append(victims, victim)
+				continue
+			}
+			p.remove(candidate)
+			victims = append(victims, candidate)
+			break
+		}
+	}
+	return victims
+}
+
+// mainVictim returns the entry to be evicted from main segments.
+func (p *tinyLFUPolicy) mainVictim() *entry {
+	if p.probation.Len() > 1 {
+		return p.probation.Back().Value.(*entry)
+	}
+	if p.protected.Len() > 0 {
+		return p.protected.Back().Value.(*entry)
+	}
+	return p.probation.Back().Value.(*entry)
+}
+
+func (p *tinyLFUPolicy) remove(e *entry) {
+	switch e.segment {
+	case segmentWindow:
+		p.window.Remove(e.elem)
+		p.windowUsed -= e.size()
+	case segmentProbation:
+		p.probation.Remove(e.elem)
+		p.probationUsed -= e.size()
+	case segmentProtected:
+		p.protected.Remove(e.elem)
+		p.protectedUsed -= e.size()
+	}
+}
+
+func (p *tinyLFUPolicy) clear() {
+	p.window.Init()
+	p.probation.Init()
+	p.protected.Init()
+	p.windowUsed, p.probationUsed, p.protectedUsed = 0, 0, 0
+}
+
+func (p *tinyLFUPolicy) size() int64 {
+	return p.windowUsed + p.probationUsed + p.protectedUsed
+}
+
+// countMinSketch estimates the access frequency of keys with saturating counters.
+// All counters are halved after sampling a number of accesses, so that the frequency
+// of keys which are popular in the past decays.
+type countMinSketch struct {
+	rows       [sketchDepth][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+func newCountMinSketch(expectedItems int) *countMinSketch {
+	width := 64
+	for width < expectedItems {
+		width <<= 1
+	}
+	s := &countMinSketch{mask: uint64(width - 1), sampleSize: 10 * width}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) index(hash uint64, row int) uint64 {
+	h := (hash ^ sketchSeeds[row]) * 0x9e3779b97f4a7c15
+	return (h ^ h>>32) & s.mask
+}
+
+func (s *countMinSketch) increment(hash uint64) {
+	for i := range s.rows {
+		idx := s.index(hash, i)
+		if s.rows[i][idx] < sketchMaxCount {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(hash uint64) uint8 {
+	var min uint8 = sketchMaxCount
+	for i := range s.rows {
+		if count := s.rows[i][s.index(hash, i)]; count < min {
+			min = count
+		}
+	}
+	return min
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/Khighness/khighdb/database"
+)
+
+// @Author KHighness
+// @Update 2023-01-12
+
+var (
+	srcPath    string
+	dstPath    string
+	threshold  int64
+	keepBackup bool
+)
+
+func init() {
+	flag.StringVar(&srcPath, "src", "", "the path of db directory to be upgraded")
+	flag.StringVar(&dstPath, "dst", "", "the path to write the upgraded db, upgrade in place if empty")
+	flag.Int64Var(&threshold, "threshold", 512<<20, "the threshold size of each log file")
+	flag.BoolVar(&keepBackup, "keep-backup", false, "keep the original directory as <src>.bak after upgrading in place")
+	flag.Parse()
+}
+
+func main() {
+	if srcPath == "" {
+		fmt.Fprintln(os.Stderr, "usage: khighdb-upgrade -src <path> [-dst <path>] [-threshold <size>] [-keep-backup]")
+		os.Exit(2)
+	}
+
+	opts := khighdb.UpgradeOptions{
+		SrcPath:              srcPath,
+		DstPath:              dstPath,
+		LogFileSizeThreshold: threshold,
+		KeepBackup:           keepBackup,
+	}
+	if err := khighdb.Upgrade(opts); err != nil {
+		zap.S().Fatalf("Failed to upgrade [%s], error: %v", srcPath, err)
+	}
+	zap.S().Infof("Succeed to upgrade [%s]", srcPath)
+}
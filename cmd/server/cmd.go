@@ -0,0 +1,3050 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/redcon"
+
+	"github.com/Khighness/khighdb/data/zset"
+	"github.com/Khighness/khighdb/database"
+	"github.com/Khighness/khighdb/util"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+var (
+	// ErrSyntax represents the command syntax is invalid.
+	ErrSyntax = errors.New("ERR syntax error")
+	// ErrNotInteger represents the argument is not an integer.
+	ErrNotInteger = errors.New("ERR value is not an integer or out of range")
+	// ErrDBIndexOutOfRange represents the index of database is out of range.
+	ErrDBIndexOutOfRange = errors.New("ERR DB index is out of range")
+	// ErrInvalidCursor represents the scan cursor is invalid.
+	ErrInvalidCursor = errors.New("ERR invalid cursor")
+	// ErrNoSuchKey represents the key does not exist.
+	ErrNoSuchKey = errors.New("ERR no such key")
+	// ErrInvalidTimeout represents the timeout of blocking commands is invalid.
+	ErrInvalidTimeout = errors.New("ERR timeout is not a float or out of range")
+	// ErrNegativeTimeout represents the timeout of blocking commands is negative.
+	ErrNegativeTimeout = errors.New("ERR timeout is negative")
+	// ErrRankZero represents the RANK option of LPOS is zero.
+	ErrRankZero = errors.New("ERR RANK can't be zero")
+	// ErrNegativeCount represents the COUNT option is negative.
+	ErrNegativeCount = errors.New("ERR COUNT can't be negative")
+	// ErrNegativeMaxLen represents the MAXLEN option is negative.
+	ErrNegativeMaxLen = errors.New("ERR MAXLEN can't be negative")
+	// ErrNonPositiveCount represents the COUNT option is not positive.
+	ErrNonPositiveCount = errors.New("ERR count should be greater than 0")
+	// ErrNegativeLimit represents the LIMIT option is negative.
+	ErrNegativeLimit = errors.New("ERR LIMIT can't be negative")
+	// ErrInvalidWeight represents the WEIGHTS option is not a float.
+	ErrInvalidWeight = errors.New("ERR weight value is not a float")
+	// ErrOffsetOutOfRange represents the offset of SETRANGE is negative.
+	ErrOffsetOutOfRange = errors.New("ERR offset is out of range")
+	// ErrLCSLenAndIdx represents both LEN and IDX are given to LCS.
+	ErrLCSLenAndIdx = errors.New("ERR If you want both the length and indexes, please just use IDX.")
+	// ErrFieldsMissing represents the FIELDS argument of hash field expiration commands is missing.
+	ErrFieldsMissing = errors.New("ERR Mandatory argument FIELDS is missing or not at the right position")
+	// ErrNumFieldsNotPositive represents the numfields argument is not positive.
+	ErrNumFieldsNotPositive = errors.New("ERR Parameter `numFields` should be greater than 0")
+	// ErrNumFieldsMismatch represents the numfields argument does not match the number of fields.
+	ErrNumFieldsMismatch = errors.New("ERR The `numfields` parameter must match the number of arguments")
+	// ErrInvalidBitOffset represents the bit offset is not an integer or out of range.
+	ErrInvalidBitOffset = errors.New("ERR bit offset is not an integer or out of range")
+	// ErrInvalidBit represents the bit argument is neither 1 nor 0.
+	ErrInvalidBit = errors.New("ERR The bit argument must be 1 or 0.")
+	// ErrBitOpNotArgs represents BITOP NOT is called with more than one source key.
+	ErrBitOpNotArgs = errors.New("ERR BITOP NOT must be called with a single source key.")
+	// ErrInvalidBitFieldType represents the integer type of BITFIELD is invalid.
+	ErrInvalidBitFieldType = errors.New("ERR Invalid bitfield type. Use something like i16 u8. " +
+		"Note that u64 is not supported but i64 is.")
+	// ErrBitFieldReadOnly represents BITFIELD_RO is called with write operations.
+	ErrBitFieldReadOnly = errors.New("ERR BITFIELD_RO only supports the GET subcommand")
+	// ErrInvalidHyperLogLog represents the string value is not a valid HyperLogLog.
+	ErrInvalidHyperLogLog = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	// ErrNotFloat represents the value is not a valid float.
+	ErrNotFloat = errors.New("ERR value is not a valid float")
+	// ErrUnsupportedUnit represents the unit of distance is not supported.
+	ErrUnsupportedUnit = errors.New("ERR unsupported unit provided. please use M, KM, FT, MI")
+	// ErrGeoSearchFrom represents neither or both of FROMMEMBER and FROMLONLAT are given.
+	ErrGeoSearchFrom = errors.New("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+	// ErrGeoSearchBy represents neither or both of BYRADIUS and BYBOX are given.
+	ErrGeoSearchBy = errors.New("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+	// ErrAnyWithoutCount represents ANY is given without COUNT.
+	ErrAnyWithoutCount = errors.New("ERR the ANY argument requires COUNT argument")
+	// ErrNegativeRadius represents the radius or the size of box is negative.
+	ErrNegativeRadius = errors.New("ERR radius cannot be negative")
+	// ErrInvalidStreamID represents the stream ID is invalid.
+	ErrInvalidStreamID = errors.New("ERR Invalid stream ID specified as stream command argument")
+	// ErrStreamIDTooSmall represents the ID given to XADD is not greater than the last ID.
+	ErrStreamIDTooSmall = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	// ErrStreamIDZero represents the ID given to XADD is 0-0.
+	ErrStreamIDZero = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+	// ErrNoGroup represents the stream or the consumer group does not exist.
+	ErrNoGroup = errors.New("NOGROUP No such key or consumer group")
+	// ErrBusyGroup represents the consumer group already exists.
+	ErrBusyGroup = errors.New("BUSYGROUP Consumer Group name already exists")
+	// ErrXGroupKeyRequired represents the key of XGROUP does not exist.
+	ErrXGroupKeyRequired = errors.New("ERR The XGROUP subcommand requires the key to exist. " +
+		"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	// ErrUnbalancedStreams represents the numbers of keys and IDs of XREAD or XREADGROUP are different.
+	ErrUnbalancedStreams = errors.New("ERR Unbalanced list of streams: for each stream key an ID must be specified.")
+	// ErrLimitWithoutApprox represents the LIMIT option of trimming is given without '~'.
+	ErrLimitWithoutApprox = errors.New("ERR syntax error, LIMIT cannot be used without the special ~ option")
+	// ErrJSONKeyNotFound represents the JSON command requires the key to exist.
+	ErrJSONKeyNotFound = errors.New("ERR could not perform this operation on a key that doesn't exist")
+	// ErrJSONNotArray represents the value at the legacy path is not an array.
+	ErrJSONNotArray = errors.New("ERR wrong type of path value - expected an array")
+	// ErrJSONNotNumber represents the value at the legacy path is not a number.
+	ErrJSONNotNumber = errors.New("ERR wrong type of path value - expected a number")
+)
+
+// cmdHandler handles a command with its arguments, the command name is excluded.
+type cmdHandler func(cli *Client, args [][]byte) (interface{}, error)
+
+// cmdArity is the min number of arguments of commands, the command name is excluded.
+var cmdArity = map[string]int{
+	"ping":             0,
+	"select":           1,
+	"type":             1,
+	"del":              1,
+	"exists":           1,
+	"rename":           2,
+	"renamenx":         2,
+	"keys":             1,
+	"randomkey":        0,
+	"dbsize":           0,
+	"scan":             1,
+	"lpush":            2,
+	"rpush":            2,
+	"blpop":            2,
+	"brpop":            2,
+	"blmove":           5,
+	"linsert":          4,
+	"ltrim":            3,
+	"lpos":             2,
+	"lmpop":            3,
+	"rpoplpush":        2,
+	"hscan":            2,
+	"hexpire":          5,
+	"hpexpire":         5,
+	"httl":             4,
+	"hpersist":         4,
+	"srem":             2,
+	"smove":            3,
+	"srandmember":      1,
+	"smismember":       2,
+	"sintercard":       2,
+	"sscan":            2,
+	"zscan":            2,
+	"zrangebyscore":    3,
+	"zrevrangebyscore": 3,
+	"zrangebylex":      3,
+	"zrevrangebylex":   3,
+	"zcount":           3,
+	"zlexcount":        3,
+	"zremrangebyscore": 3,
+	"zremrangebyrank":  3,
+	"zremrangebylex":   3,
+	"zunion":           2,
+	"zunionstore":      3,
+	"zinter":           2,
+	"zinterstore":      3,
+	"zdiff":            2,
+	"zdiffstore":       3,
+	"zpopmin":          1,
+	"zpopmax":          1,
+	"bzpopmin":         2,
+	"bzpopmax":         2,
+
+	"set":         2,
+	"get":         1,
+	"getset":      2,
+	"getex":       1,
+	"incrbyfloat": 2,
+	"setrange":    3,
+	"strlen":      1,
+	"lcs":         2,
+
+	"geoadd":    4,
+	"geopos":    1,
+	"geodist":   3,
+	"geohash":   1,
+	"geosearch": 6,
+
+	"xadd":       4,
+	"xtrim":      3,
+	"xlen":       1,
+	"xrange":     3,
+	"xrevrange":  3,
+	"xdel":       2,
+	"xread":      3,
+	"xgroup":     1,
+	"xreadgroup": 6,
+	"xack":       3,
+	"xpending":   2,
+	"xclaim":     5,
+
+	"json.set":       3,
+	"json.get":       1,
+	"json.del":       1,
+	"json.forget":    1,
+	"json.arrappend": 3,
+	"json.numincrby": 3,
+}
+
+var supportedCommands = map[string]cmdHandler{
+	// connection management commands.
+	"ping":   ping,
+	"select": selectDB,
+
+	// generic commands.
+	"type":      keyType,
+	"del":       del,
+	"exists":    exists,
+	"rename":    rename,
+	"renamenx":  renameNX,
+	"keys":      keys,
+	"randomkey": randomKey,
+	"dbsize":    dbSize,
+	"scan":      scan,
+
+	// string commands.
+	"set":         set,
+	"get":         get,
+	"getset":      getSet,
+	"getex":       getEX,
+	"incrbyfloat": incrByFloat,
+	"setrange":    setRange,
+	"strlen":      strLen,
+	"lcs":         lcs,
+	"setbit":      setBit,
+	"getbit":      getBit,
+	"bitcount":    bitCount,
+	"bitpos":      bitPos,
+	"bitop":       bitOp,
+	"bitfield":    bitField,
+	"bitfield_ro": bitFieldRO,
+	"pfadd":       pfAdd,
+	"pfcount":     pfCount,
+	"pfmerge":     pfMerge,
+
+	// list commands.
+	"lpush":     lPush,
+	"rpush":     rPush,
+	"blpop":     blPop,
+	"brpop":     brPop,
+	"blmove":    blMove,
+	"linsert":   lInsert,
+	"ltrim":     lTrim,
+	"lpos":      lPos,
+	"lmpop":     lmPop,
+	"rpoplpush": rPopLPush,
+
+	// hash commands.
+	"hscan":    hScan,
+	"hexpire":  hExpire,
+	"hpexpire": hpExpire,
+	"httl":     hTTL,
+	"hpersist": hPersist,
+
+	// set commands.
+	"srem":        sRem,
+	"smove":       sMove,
+	"srandmember": sRandMember,
+	"smismember":  sMIsMember,
+	"sintercard":  sInterCard,
+	"sscan":       sScan,
+
+	// zset commands.
+	"zscan":            zScan,
+	"zrangebyscore":    zRangeByScore,
+	"zrevrangebyscore": zRevRangeByScore,
+	"zrangebylex":      zRangeByLex,
+	"zrevrangebylex":   zRevRangeByLex,
+	"zcount":           zCount,
+	"zlexcount":        zLexCount,
+	"zremrangebyscore": zRemRangeByScore,
+	"zremrangebyrank":  zRemRangeByRank,
+	"zremrangebylex":   zRemRangeByLex,
+	"zunion":           zUnion,
+	"zunionstore":      zUnionStore,
+	"zinter":           zInter,
+	"zinterstore":      zInterStore,
+	"zdiff":            zDiff,
+	"zdiffstore":       zDiffStore,
+	"zpopmin":          zPopMin,
+	"zpopmax":          zPopMax,
+	"bzpopmin":         bzPopMin,
+	"bzpopmax":         bzPopMax,
+
+	// geo commands.
+	"geoadd":    geoAdd,
+	"geopos":    geoPos,
+	"geodist":   geoDist,
+	"geohash":   geoHash,
+	"geosearch": geoSearch,
+
+	// stream commands.
+	"xadd":       xAdd,
+	"xtrim":      xTrim,
+	"xlen":       xLen,
+	"xrange":     xRange,
+	"xrevrange":  xRevRange,
+	"xdel":       xDel,
+	"xread":      xRead,
+	"xgroup":     xGroup,
+	"xreadgroup": xReadGroup,
+	"xack":       xAck,
+	"xpending":   xPending,
+	"xclaim":     xClaim,
+
+	// json commands.
+	"json.set":       jsonSet,
+	"json.get":       jsonGet,
+	"json.del":       jsonDel,
+	"json.forget":    jsonDel,
+	"json.arrappend": jsonArrAppend,
+	"json.numincrby": jsonNumIncrBy,
+}
+
+// dataTypes maps the type names of TYPE option to data types.
+var dataTypes = map[string]khighdb.DataType{
+	"string": khighdb.String,
+	"list":   khighdb.List,
+	"hash":   khighdb.Hash,
+	"set":    khighdb.Set,
+	"zset":   khighdb.ZSet,
+	"stream": khighdb.Stream,
+	"json":   khighdb.JSON,
+}
+
+// Client holds the state of a client connection.
+type Client struct {
+	svr     *KhighDBServer
+	db      *khighdb.KhighDB
+	dbIndex int
+	conn    redcon.Conn
+	// ctx is done once the connection is closed, so that the blocking commands of the client
+	// stop waiting.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newClient(svr *KhighDBServer, conn redcon.Conn) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Client{
+		svr:    svr,
+		db:     svr.dbs[0],
+		conn:   conn,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// block returns the context of a blocking command, it is done once the client disconnects.
+// The connection is not read by the server while the command is blocked, so it is watched
+// until the returned function is called after the command.
+func (cli *Client) block() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(cli.ctx)
+	stop := watchHangup(cli.conn.NetConn(), cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// execute executes the command and writes the reply.
+func (cli *Client) execute(conn redcon.Conn, cmd redcon.Command) {
+	name := strings.ToLower(string(cmd.Args[0]))
+	handler, ok := supportedCommands[name]
+	if !ok {
+		conn.WriteError(fmt.Sprintf("ERR unknown command '%s'", cmd.Args[0]))
+		return
+	}
+	args := cmd.Args[1:]
+	if len(args) < cmdArity[name] {
+		conn.WriteError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return
+	}
+
+	reply, err := handler(cli, args)
+	if err != nil {
+		writeError(conn, err)
+		return
+	}
+	writeReply(conn, reply)
+}
+
+// errorCodes are the error codes of Redis used by the replies.
+var errorCodes = []string{"ERR ", "WRONGTYPE ", "NOGROUP ", "BUSYGROUP "}
+
+// writeError writes the error, a prefix 'ERR' is added if the error is from database
+// and has no error code.
+func writeError(conn redcon.Conn, err error) {
+	msg := err.Error()
+	hasCode := false
+	for _, code := range errorCodes {
+		hasCode = hasCode || strings.HasPrefix(msg, code)
+	}
+	if !hasCode {
+		msg = "ERR " + msg
+	}
+	conn.WriteError(msg)
+}
+
+// writeReply writes the reply in RESP.
+func writeReply(conn redcon.Conn, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		conn.WriteNull()
+	case redcon.SimpleString:
+		conn.WriteString(string(v))
+	case []byte:
+		conn.WriteBulk(v)
+	case string:
+		conn.WriteBulkString(v)
+	case int:
+		conn.WriteInt(v)
+	case int64:
+		conn.WriteInt64(v)
+	case [][]byte:
+		conn.WriteArray(len(v))
+		for _, b := range v {
+			conn.WriteBulk(b)
+		}
+	case []interface{}:
+		conn.WriteArray(len(v))
+		for _, item := range v {
+			writeReply(conn, item)
+		}
+	default:
+		conn.WriteAny(v)
+	}
+}
+
+const (
+	// maxScanCursors is the max number of scan cursors held by the server.
+	maxScanCursors = 4096
+	// cursorTokenFlag is set in the integer cursor which is a token of the scan cursor held by
+	// the server.
+	cursorTokenFlag uint64 = 1 << 63
+)
+
+// scanCursors holds the opaque cursors of database which are too long to be encoded as
+// integers, Redis clients use unsigned 64-bit integer cursors. The oldest cursor is evicted
+// once there are maxScanCursors cursors, and the scan with it fails with ErrInvalidCursor.
+type scanCursors struct {
+	mu      *sync.Mutex
+	next    uint64
+	cursors map[uint64][]byte
+	// tokens holds the tokens of cursors in the order they are created.
+	tokens []uint64
+}
+
+func newScanCursors() *scanCursors {
+	return &scanCursors{
+		mu:      new(sync.Mutex),
+		cursors: make(map[uint64][]byte),
+	}
+}
+
+// encode encodes the opaque cursor of database as a decimal integer, and "0" is returned if
+// the scan is completed. The cursor of at most 7 bytes is prefixed with byte 1 to keep its
+// leading zero bytes and encoded as it is, otherwise it is held by a token.
+func (c *scanCursors) encode(cursor []byte) string {
+	if cursor == nil {
+		return "0"
+	}
+	if len(cursor) < 8 {
+		n := uint64(1)
+		for _, b := range cursor {
+			n = n<<8 | uint64(b)
+		}
+		return strconv.FormatUint(n, 10)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.tokens) >= maxScanCursors {
+		delete(c.cursors, c.tokens[0])
+		c.tokens = c.tokens[1:]
+	}
+	c.next++
+	token := c.next &^ cursorTokenFlag
+	c.cursors[token] = cursor
+	c.tokens = append(c.tokens, token)
+	return strconv.FormatUint(token|cursorTokenFlag, 10)
+}
+
+// decode decodes the cursor encoded by encode, nil is returned if it is 0.
+func (c *scanCursors) decode(arg []byte) ([]byte, error) {
+	n, err := strconv.ParseUint(string(arg), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	if n&cursorTokenFlag != 0 {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		cursor, ok := c.cursors[n&^cursorTokenFlag]
+		if !ok {
+			return nil, ErrInvalidCursor
+		}
+		return cursor, nil
+	}
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, n)
+	for len(buf) > 0 && buf[0] == 0 {
+		buf = buf[1:]
+	}
+	if buf[0] != 1 {
+		return nil, ErrInvalidCursor
+	}
+	return buf[1:], nil
+}
+
+// parseScanOptions parses [MATCH pattern] [COUNT count] [TYPE type].
+func parseScanOptions(args [][]byte, allowType bool) (khighdb.ScanOptions, error) {
+	var opts khighdb.ScanOptions
+	if len(args)%2 != 0 {
+		return opts, ErrSyntax
+	}
+	for i := 0; i < len(args); i += 2 {
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			opts.Match = string(args[i+1])
+		case "count":
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return opts, ErrNotInteger
+			}
+			if count < 1 {
+				return opts, ErrSyntax
+			}
+			opts.Count = count
+		case "type":
+			dataType, ok := dataTypes[strings.ToLower(string(args[i+1]))]
+			if !allowType || !ok {
+				return opts, ErrSyntax
+			}
+			opts.Types = []khighdb.DataType{dataType}
+		default:
+			return opts, ErrSyntax
+		}
+	}
+	return opts, nil
+}
+
+// +-------+--------------------------------------------+
+// | PING  | PING [message]                             |
+// +-------+--------------------------------------------+
+func ping(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) > 1 {
+		return nil, ErrSyntax
+	}
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	return redcon.SimpleString("PONG"), nil
+}
+
+// +--------+-------------------------------------------+
+// | SELECT | SELECT index                              |
+// +--------+-------------------------------------------+
+func selectDB(cli *Client, args [][]byte) (interface{}, error) {
+	index, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	if index < 0 || uint(index) >= cli.svr.cfg.databases {
+		return nil, ErrDBIndexOutOfRange
+	}
+
+	db, err := cli.svr.openDB(index)
+	if err != nil {
+		return nil, err
+	}
+	cli.db, cli.dbIndex = db, index
+	return redcon.SimpleString("OK"), nil
+}
+
+// openDB returns the database of the index, it is opened if not opened before.
+func (server *KhighDBServer) openDB(index int) (*khighdb.KhighDB, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if db, ok := server.dbs[index]; ok {
+		return db, nil
+	}
+	path := filepath.Join(server.cfg.dbPath, fmt.Sprintf(dbName, index))
+	db, err := khighdb.Open(khighdb.DefaultOptions(path))
+	if err != nil {
+		return nil, err
+	}
+	server.dbs[index] = db
+	return db, nil
+}
+
+// +-------+--------------------------------------------------------------+
+// | TYPE  | TYPE key                                                     |
+// +-------+--------------------------------------------------------------+
+func keyType(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, ErrSyntax
+	}
+	dataType, err := cli.db.Type(args[0])
+	if err == khighdb.ErrKeyNotFound {
+		return redcon.SimpleString("none"), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for name, t := range dataTypes {
+		if t == dataType {
+			return redcon.SimpleString(name), nil
+		}
+	}
+	return redcon.SimpleString("none"), nil
+}
+
+// +-------+--------------------------------------------------------------+
+// | DEL   | DEL key [key ...]                                            |
+// +-------+--------------------------------------------------------------+
+func del(cli *Client, args [][]byte) (interface{}, error) {
+	return cli.db.Del(args...)
+}
+
+// +--------+-------------------------------------------------------------+
+// | EXISTS | EXISTS key [key ...]                                        |
+// +--------+-------------------------------------------------------------+
+func exists(cli *Client, args [][]byte) (interface{}, error) {
+	return cli.db.Exists(args...), nil
+}
+
+// +--------+-------------------------------------------------------------+
+// | RENAME | RENAME key newkey                                           |
+// +--------+-------------------------------------------------------------+
+func rename(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, ErrSyntax
+	}
+	if err := cli.db.Rename(args[0], args[1]); err != nil {
+		if err == khighdb.ErrKeyNotFound {
+			return nil, ErrNoSuchKey
+		}
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+// +----------+-----------------------------------------------------------+
+// | RENAMENX | RENAMENX key newkey                                       |
+// +----------+-----------------------------------------------------------+
+func renameNX(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, ErrSyntax
+	}
+	ok, err := cli.db.RenameNX(args[0], args[1])
+	if err != nil {
+		if err == khighdb.ErrKeyNotFound {
+			return nil, ErrNoSuchKey
+		}
+		return nil, err
+	}
+	if ok {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// +-------+--------------------------------------------------------------+
+// | KEYS  | KEYS pattern                                                 |
+// +-------+--------------------------------------------------------------+
+func keys(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, ErrSyntax
+	}
+	found, err := cli.db.Keys(string(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		found = make([][]byte, 0)
+	}
+	return found, nil
+}
+
+// +-----------+----------------------------------------------------------+
+// | RANDOMKEY | RANDOMKEY                                                |
+// +-----------+----------------------------------------------------------+
+func randomKey(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, ErrSyntax
+	}
+	key, err := cli.db.RandomKey()
+	if err == khighdb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// +--------+-------------------------------------------------------------+
+// | DBSIZE | DBSIZE                                                      |
+// +--------+-------------------------------------------------------------+
+func dbSize(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, ErrSyntax
+	}
+	return cli.db.DBSize(), nil
+}
+
+// +-------+--------------------------------------------------------------+
+// | SCAN  | SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]        |
+// +-------+--------------------------------------------------------------+
+func scan(cli *Client, args [][]byte) (interface{}, error) {
+	cursor, err := cli.svr.cursors.decode(args[0])
+	if err != nil {
+		return nil, err
+	}
+	opts, err := parseScanOptions(args[1:], true)
+	if err != nil {
+		return nil, err
+	}
+	next, keys, err := cli.db.ScanCursor(cursor, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{cli.svr.cursors.encode(next), keys}, nil
+}
+
+// +-------+--------------------------------------------------------------+
+// | HSCAN | HSCAN key cursor [MATCH pattern] [COUNT count]               |
+// +-------+--------------------------------------------------------------+
+func hScan(cli *Client, args [][]byte) (interface{}, error) {
+	return scanKey(cli, args, cli.db.HScanCursor)
+}
+
+// +-------+--------------------------------------------------------------+
+// | SSCAN | SSCAN key cursor [MATCH pattern] [COUNT count]               |
+// +-------+--------------------------------------------------------------+
+func sScan(cli *Client, args [][]byte) (interface{}, error) {
+	return scanKey(cli, args, cli.db.SScanCursor)
+}
+
+// +-------+--------------------------------------------------------------+
+// | ZSCAN | ZSCAN key cursor [MATCH pattern] [COUNT count]               |
+// +-------+--------------------------------------------------------------+
+func zScan(cli *Client, args [][]byte) (interface{}, error) {
+	return scanKey(cli, args, cli.db.ZScanCursor)
+}
+
+// scanKey scans the elements of the key by the scan function.
+func scanKey(cli *Client, args [][]byte,
+	scanFn func(key, cursor []byte, opts khighdb.ScanOptions) ([]byte, [][]byte, error)) (interface{}, error) {
+	cursor, err := cli.svr.cursors.decode(args[1])
+	if err != nil {
+		return nil, err
+	}
+	opts, err := parseScanOptions(args[2:], false)
+	if err != nil {
+		return nil, err
+	}
+	next, values, err := scanFn(args[0], cursor, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{cli.svr.cursors.encode(next), values}, nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | SET         | SET key value [NX|XX] [GET] [EX seconds|PX milliseconds|                        |
+// |             | EXAT unix-time-seconds|PXAT unix-time-milliseconds|KEEPTTL]                     |
+// +-------------+---------------------------------------------------------------------------------+
+func set(cli *Client, args [][]byte) (interface{}, error) {
+	var opts khighdb.SetOptions
+	var expire bool
+	for i := 2; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		switch opt {
+		case "nx":
+			if opts.XX {
+				return nil, ErrSyntax
+			}
+			opts.NX = true
+		case "xx":
+			if opts.NX {
+				return nil, ErrSyntax
+			}
+			opts.XX = true
+		case "get":
+			opts.Get = true
+		case "keepttl":
+			if expire {
+				return nil, ErrSyntax
+			}
+			opts.KeepTTL, expire = true, true
+		case "ex", "px", "exat", "pxat":
+			if expire || i+1 == len(args) {
+				return nil, ErrSyntax
+			}
+			var err error
+			if opts.TTL, opts.ExpireAt, err = parseExpiration("set", opt, args[i+1]); err != nil {
+				return nil, err
+			}
+			expire = true
+			i++
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	old, ok, err := cli.db.SetWithOptions(args[0], args[1], opts)
+	switch {
+	case err != nil:
+		return nil, err
+	case opts.Get && old != nil:
+		return old, nil
+	case opts.Get || !ok:
+		return nil, nil
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | GET         | GET key                                                                         |
+// +-------------+---------------------------------------------------------------------------------+
+func get(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, ErrSyntax
+	}
+	value, err := cli.db.Get(args[0])
+	if err == khighdb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | GETSET      | GETSET key value                                                                |
+// +-------------+---------------------------------------------------------------------------------+
+func getSet(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, ErrSyntax
+	}
+	old, err := cli.db.GetSet(args[0], args[1])
+	if err != nil || old == nil {
+		return nil, err
+	}
+	return old, nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | GETEX       | GETEX key [EX seconds|PX milliseconds|EXAT unix-time-seconds|                   |
+// |             | PXAT unix-time-milliseconds|PERSIST]                                            |
+// +-------------+---------------------------------------------------------------------------------+
+func getEX(cli *Client, args [][]byte) (interface{}, error) {
+	var opts khighdb.GetEXOptions
+	switch len(args) {
+	case 1:
+	case 2:
+		if strings.ToLower(string(args[1])) != "persist" {
+			return nil, ErrSyntax
+		}
+		opts.Persist = true
+	case 3:
+		opt := strings.ToLower(string(args[1]))
+		switch opt {
+		case "ex", "px", "exat", "pxat":
+		default:
+			return nil, ErrSyntax
+		}
+		var err error
+		if opts.TTL, opts.ExpireAt, err = parseExpiration("getex", opt, args[2]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrSyntax
+	}
+
+	val, err := cli.db.GetEX(args[0], opts)
+	if err == khighdb.ErrKeyNotFound {
+		return nil, nil
+	}
+	return val, err
+}
+
+// parseExpiration parses the expiration option like 'EX seconds', and returns the time to live
+// or the time when the key expires.
+func parseExpiration(cmd, opt string, arg []byte) (time.Duration, time.Time, error) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, time.Time{}, ErrNotInteger
+	}
+	unit := time.Millisecond
+	if opt == "ex" || opt == "exat" {
+		unit = time.Second
+	}
+	if n <= 0 || n > math.MaxInt64/int64(unit) {
+		return 0, time.Time{}, fmt.Errorf("ERR invalid expire time in '%s' command", cmd)
+	}
+	if opt == "ex" || opt == "px" {
+		return time.Duration(n) * unit, time.Time{}, nil
+	}
+	return 0, time.Unix(0, n*int64(unit)), nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | INCRBYFLOAT | INCRBYFLOAT key increment                                                       |
+// +-------------+---------------------------------------------------------------------------------+
+func incrByFloat(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, ErrSyntax
+	}
+	delta, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return nil, ErrNotFloat
+	}
+	val, err := cli.db.IncrByFloat(args[0], delta)
+	if err != nil {
+		return nil, err
+	}
+	return strconv.FormatFloat(val, 'f', -1, 64), nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | SETRANGE    | SETRANGE key offset value                                                       |
+// +-------------+---------------------------------------------------------------------------------+
+func setRange(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, ErrSyntax
+	}
+	offset, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	if offset < 0 {
+		return nil, ErrOffsetOutOfRange
+	}
+	return cli.db.SetRange(args[0], offset, args[2])
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | STRLEN      | STRLEN key                                                                      |
+// +-------------+---------------------------------------------------------------------------------+
+func strLen(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, ErrSyntax
+	}
+	return cli.db.StrLen(args[0]), nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | LCS         | LCS key1 key2 [LEN] [IDX] [MINMATCHLEN len] [WITHMATCHLEN]                      |
+// +-------------+---------------------------------------------------------------------------------+
+func lcs(cli *Client, args [][]byte) (interface{}, error) {
+	var getLen, getIdx, withMatchLen bool
+	var minMatchLen int
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "len":
+			getLen = true
+		case "idx":
+			getIdx = true
+		case "withmatchlen":
+			withMatchLen = true
+		case "minmatchlen":
+			if i+1 == len(args) {
+				return nil, ErrSyntax
+			}
+			n, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, ErrNotInteger
+			}
+			if n > 0 {
+				minMatchLen = n
+			}
+			i++
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	if getLen && getIdx {
+		return nil, ErrLCSLenAndIdx
+	}
+
+	if !getIdx {
+		lcs, err := cli.db.LCS(args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		if getLen {
+			return len(lcs), nil
+		}
+		return lcs, nil
+	}
+	matches, n, err := cli.db.LCSIdx(args[0], args[1], minMatchLen)
+	if err != nil {
+		return nil, err
+	}
+	reply := make([]interface{}, len(matches))
+	for i, m := range matches {
+		match := []interface{}{[]interface{}{m.Start1, m.End1}, []interface{}{m.Start2, m.End2}}
+		if withMatchLen {
+			match = append(match, m.Len())
+		}
+		reply[i] = match
+	}
+	return []interface{}{"matches", reply, "len", n}, nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | SETBIT      | SETBIT key offset value                                                         |
+// +-------------+---------------------------------------------------------------------------------+
+func setBit(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, ErrSyntax
+	}
+	offset, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidBitOffset
+	}
+	on, err := parseBit(args[2])
+	if err != nil {
+		return nil, err
+	}
+	old, err := cli.db.SetBit(args[0], offset, on)
+	if err != nil {
+		return nil, bitError(err)
+	}
+	return boolToInt(old), nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | GETBIT      | GETBIT key offset                                                               |
+// +-------------+---------------------------------------------------------------------------------+
+func getBit(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, ErrSyntax
+	}
+	offset, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidBitOffset
+	}
+	bit, err := cli.db.GetBit(args[0], offset)
+	if err != nil {
+		return nil, bitError(err)
+	}
+	return boolToInt(bit), nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | BITCOUNT    | BITCOUNT key [start end [BYTE|BIT]]                                             |
+// +-------------+---------------------------------------------------------------------------------+
+func bitCount(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 1 && len(args) != 3 && len(args) != 4 {
+		return nil, ErrSyntax
+	}
+	var r *khighdb.BitRange
+	if len(args) > 1 {
+		var err error
+		if r, err = parseBitRange(args[1:]); err != nil {
+			return nil, err
+		}
+	}
+	return cli.db.BitCount(args[0], r)
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | BITPOS      | BITPOS key bit [start [end [BYTE|BIT]]]                                         |
+// +-------------+---------------------------------------------------------------------------------+
+func bitPos(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) > 5 {
+		return nil, ErrSyntax
+	}
+	bit, err := parseBit(args[1])
+	if err != nil {
+		return nil, err
+	}
+	var r *khighdb.BitRange
+	switch len(args) {
+	case 3:
+		start, err := strconv.Atoi(string(args[2]))
+		if err != nil {
+			return nil, ErrNotInteger
+		}
+		r = &khighdb.BitRange{Start: start, OpenEnd: true}
+	case 4, 5:
+		if r, err = parseBitRange(args[2:]); err != nil {
+			return nil, err
+		}
+	}
+	return cli.db.BitPos(args[0], bit, r)
+}
+
+// parseBitRange parses the arguments like 'start end [BYTE|BIT]'.
+func parseBitRange(args [][]byte) (*khighdb.BitRange, error) {
+	start, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	end, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	r := &khighdb.BitRange{Start: start, End: end}
+	if len(args) == 3 {
+		switch strings.ToLower(string(args[2])) {
+		case "byte":
+		case "bit":
+			r.InBits = true
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	return r, nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | BITOP       | BITOP AND|OR|XOR|NOT destkey key [key ...]                                      |
+// +-------------+---------------------------------------------------------------------------------+
+func bitOp(cli *Client, args [][]byte) (interface{}, error) {
+	var op khighdb.BitOperation
+	switch strings.ToLower(string(args[0])) {
+	case "and":
+		op = khighdb.BitAnd
+	case "or":
+		op = khighdb.BitOr
+	case "xor":
+		op = khighdb.BitXor
+	case "not":
+		op = khighdb.BitNot
+		if len(args) != 3 {
+			return nil, ErrBitOpNotArgs
+		}
+	default:
+		return nil, ErrSyntax
+	}
+	return cli.db.BitOp(op, args[1], args[2:]...)
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | BITFIELD    | BITFIELD key [GET encoding offset | [OVERFLOW WRAP|SAT|FAIL]                    |
+// |             | SET encoding offset value | INCRBY encoding offset increment ...]               |
+// +-------------+---------------------------------------------------------------------------------+
+func bitField(cli *Client, args [][]byte) (interface{}, error) {
+	ops, err := parseBitFieldOps(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return runBitField(cli, args[0], ops)
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | BITFIELD_RO | BITFIELD_RO key [GET encoding offset ...]                                       |
+// +-------------+---------------------------------------------------------------------------------+
+func bitFieldRO(cli *Client, args [][]byte) (interface{}, error) {
+	ops, err := parseBitFieldOps(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		if op.Type != khighdb.BitFieldGet {
+			return nil, ErrBitFieldReadOnly
+		}
+	}
+	return runBitField(cli, args[0], ops)
+}
+
+// runBitField runs the BITFIELD operations, the reply is nil for the failed operations.
+func runBitField(cli *Client, key []byte, ops []khighdb.BitFieldOp) (interface{}, error) {
+	results, err := cli.db.BitField(key, ops...)
+	if err != nil {
+		return nil, bitError(err)
+	}
+	reply := make([]interface{}, len(results))
+	for i, result := range results {
+		if result != nil {
+			reply[i] = *result
+		}
+	}
+	return reply, nil
+}
+
+// parseBitFieldOps parses the subcommands of BITFIELD.
+func parseBitFieldOps(args [][]byte) ([]khighdb.BitFieldOp, error) {
+	var ops []khighdb.BitFieldOp
+	overflow := khighdb.BitFieldWrap
+	for i := 0; i < len(args); {
+		subCmd := strings.ToLower(string(args[i]))
+		if subCmd == "overflow" {
+			if i+1 >= len(args) {
+				return nil, ErrSyntax
+			}
+			switch strings.ToLower(string(args[i+1])) {
+			case "wrap":
+				overflow = khighdb.BitFieldWrap
+			case "sat":
+				overflow = khighdb.BitFieldSat
+			case "fail":
+				overflow = khighdb.BitFieldFail
+			default:
+				return nil, ErrSyntax
+			}
+			i += 2
+			continue
+		}
+
+		op := khighdb.BitFieldOp{Overflow: overflow}
+		argNum := 4
+		switch subCmd {
+		case "get":
+			op.Type, argNum = khighdb.BitFieldGet, 3
+		case "set":
+			op.Type = khighdb.BitFieldSet
+		case "incrby":
+			op.Type = khighdb.BitFieldIncrBy
+		default:
+			return nil, ErrSyntax
+		}
+		if i+argNum > len(args) {
+			return nil, ErrSyntax
+		}
+		if err := parseBitFieldType(&op, args[i+1]); err != nil {
+			return nil, err
+		}
+		if err := parseBitFieldOffset(&op, args[i+2]); err != nil {
+			return nil, err
+		}
+		if argNum == 4 {
+			value, err := strconv.ParseInt(string(args[i+3]), 10, 64)
+			if err != nil {
+				return nil, ErrNotInteger
+			}
+			op.Value = value
+		}
+		ops = append(ops, op)
+		i += argNum
+	}
+	return ops, nil
+}
+
+// parseBitFieldType parses the integer type like i16 or u8.
+func parseBitFieldType(op *khighdb.BitFieldOp, arg []byte) error {
+	if len(arg) < 2 || (arg[0] != 'i' && arg[0] != 'u') {
+		return ErrInvalidBitFieldType
+	}
+	bits, err := strconv.Atoi(string(arg[1:]))
+	if err != nil {
+		return ErrInvalidBitFieldType
+	}
+	op.Signed, op.Bits = arg[0] == 'i', bits
+	if bits < 1 || bits > 64 || (!op.Signed && bits > 63) {
+		return ErrInvalidBitFieldType
+	}
+	return nil
+}
+
+// parseBitFieldOffset parses the bit offset, which is multiplied by the integer width if it is
+// prefixed by '#'.
+func parseBitFieldOffset(op *khighdb.BitFieldOp, arg []byte) error {
+	multiply := len(arg) > 0 && arg[0] == '#'
+	if multiply {
+		arg = arg[1:]
+	}
+	offset, err := strconv.ParseUint(string(arg), 10, 64)
+	if err != nil {
+		return ErrInvalidBitOffset
+	}
+	if multiply {
+		offset *= uint64(op.Bits)
+	}
+	op.Offset = offset
+	return nil
+}
+
+// parseBit parses the bit argument, which must be 1 or 0.
+func parseBit(arg []byte) (bool, error) {
+	switch string(arg) {
+	case "1":
+		return true, nil
+	case "0":
+		return false, nil
+	}
+	return false, ErrInvalidBit
+}
+
+// bitError converts the errors of bitmap to the errors of Redis.
+func bitError(err error) error {
+	switch err {
+	case khighdb.ErrBitOffsetOutOfRange:
+		return ErrInvalidBitOffset
+	case khighdb.ErrInvalidBitFieldType:
+		return ErrInvalidBitFieldType
+	}
+	return err
+}
+
+// boolToInt converts true to 1 and false to 0.
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | PFADD       | PFADD key [element [element ...]]                                               |
+// +-------------+---------------------------------------------------------------------------------+
+func pfAdd(cli *Client, args [][]byte) (interface{}, error) {
+	updated, err := cli.db.PFAdd(args[0], args[1:]...)
+	if err != nil {
+		return nil, hllError(err)
+	}
+	return boolToInt(updated), nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | PFCOUNT     | PFCOUNT key [key ...]                                                           |
+// +-------------+---------------------------------------------------------------------------------+
+func pfCount(cli *Client, args [][]byte) (interface{}, error) {
+	count, err := cli.db.PFCount(args...)
+	if err != nil {
+		return nil, hllError(err)
+	}
+	return int64(count), nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | PFMERGE     | PFMERGE destkey [sourcekey [sourcekey ...]]                                     |
+// +-------------+---------------------------------------------------------------------------------+
+func pfMerge(cli *Client, args [][]byte) (interface{}, error) {
+	if err := cli.db.PFMerge(args[0], args[1:]...); err != nil {
+		return nil, hllError(err)
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+// hllError converts the errors of HyperLogLog to the errors of Redis.
+func hllError(err error) error {
+	if err == khighdb.ErrInvalidHyperLogLog {
+		return ErrInvalidHyperLogLog
+	}
+	return err
+}
+
+// parseTimeout parses the timeout of blocking commands in seconds, 0 means blocking indefinitely.
+func parseTimeout(arg []byte) (time.Duration, error) {
+	timeout, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil {
+		return 0, ErrInvalidTimeout
+	}
+	if timeout < 0 {
+		return 0, ErrNegativeTimeout
+	}
+	return time.Duration(timeout * float64(time.Second)), nil
+}
+
+// parseDirection parses the LEFT|RIGHT argument, it returns true if the argument is LEFT.
+func parseDirection(arg []byte) (bool, error) {
+	switch strings.ToLower(string(arg)) {
+	case "left":
+		return true, nil
+	case "right":
+		return false, nil
+	}
+	return false, ErrSyntax
+}
+
+// +-------+--------------------------------------------------------------+
+// | LPUSH | LPUSH key element [element ...]                              |
+// +-------+--------------------------------------------------------------+
+func lPush(cli *Client, args [][]byte) (interface{}, error) {
+	return cli.db.LPushLen(args[0], args[1:]...)
+}
+
+// +-------+--------------------------------------------------------------+
+// | RPUSH | RPUSH key element [element ...]                              |
+// +-------+--------------------------------------------------------------+
+func rPush(cli *Client, args [][]byte) (interface{}, error) {
+	return cli.db.RPushLen(args[0], args[1:]...)
+}
+
+// +-------+--------------------------------------------------------------+
+// | BLPOP | BLPOP key [key ...] timeout                                  |
+// +-------+--------------------------------------------------------------+
+func blPop(cli *Client, args [][]byte) (interface{}, error) {
+	return blockingPop(cli, args, cli.db.BLPop)
+}
+
+// +-------+--------------------------------------------------------------+
+// | BRPOP | BRPOP key [key ...] timeout                                  |
+// +-------+--------------------------------------------------------------+
+func brPop(cli *Client, args [][]byte) (interface{}, error) {
+	return blockingPop(cli, args, cli.db.BRPop)
+}
+
+// blockingPop pops an element by the blocking pop function, only the connection of the client
+// is blocked, since each connection is served by its own goroutine.
+func blockingPop(cli *Client, args [][]byte,
+	popFn func(ctx context.Context, timeout time.Duration, keys ...[]byte) ([]byte, []byte, error)) (interface{}, error) {
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	ctx, done := cli.block()
+	defer done()
+	key, value, err := popFn(ctx, timeout, args[:len(args)-1]...)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, nil
+	}
+	return [][]byte{key, value}, nil
+}
+
+// +--------+-------------------------------------------------------------+
+// | BLMOVE | BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout     |
+// +--------+-------------------------------------------------------------+
+func blMove(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 5 {
+		return nil, ErrSyntax
+	}
+	srcIsLeft, err := parseDirection(args[2])
+	if err != nil {
+		return nil, err
+	}
+	dstIsLeft, err := parseDirection(args[3])
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := parseTimeout(args[4])
+	if err != nil {
+		return nil, err
+	}
+	ctx, done := cli.block()
+	defer done()
+	value, err := cli.db.BLMove(ctx, timeout, args[0], args[1], srcIsLeft, dstIsLeft)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, nil
+	}
+	return value, nil
+}
+
+// +---------+------------------------------------------------------------+
+// | LINSERT | LINSERT key BEFORE|AFTER pivot element                     |
+// +---------+------------------------------------------------------------+
+func lInsert(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 4 {
+		return nil, ErrSyntax
+	}
+	var before bool
+	switch strings.ToLower(string(args[1])) {
+	case "before":
+		before = true
+	case "after":
+	default:
+		return nil, ErrSyntax
+	}
+	return cli.db.LInsert(args[0], before, args[2], args[3])
+}
+
+// +-------+--------------------------------------------------------------+
+// | LTRIM | LTRIM key start stop                                         |
+// +-------+--------------------------------------------------------------+
+func lTrim(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, ErrSyntax
+	}
+	start, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	stop, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	if err = cli.db.LTrim(args[0], start, stop); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+// +-------+--------------------------------------------------------------+
+// | LPOS  | LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]|
+// +-------+--------------------------------------------------------------+
+func lPos(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args)%2 != 0 {
+		return nil, ErrSyntax
+	}
+	opts := khighdb.LPosOptions{Count: 1}
+	var withCount bool
+	for i := 2; i < len(args); i += 2 {
+		n, err := strconv.Atoi(string(args[i+1]))
+		if err != nil {
+			return nil, ErrNotInteger
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "rank":
+			if n == 0 {
+				return nil, ErrRankZero
+			}
+			opts.Rank = n
+		case "count":
+			if n < 0 {
+				return nil, ErrNegativeCount
+			}
+			opts.Count, withCount = n, true
+		case "maxlen":
+			if n < 0 {
+				return nil, ErrNegativeMaxLen
+			}
+			opts.MaxLen = n
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	indexes, err := cli.db.LPos(args[0], args[1], opts)
+	if err != nil {
+		return nil, err
+	}
+	if !withCount {
+		if len(indexes) == 0 {
+			return nil, nil
+		}
+		return indexes[0], nil
+	}
+	res := make([]interface{}, 0, len(indexes))
+	for _, index := range indexes {
+		res = append(res, index)
+	}
+	return res, nil
+}
+
+// +-------+--------------------------------------------------------------+
+// | LMPOP | LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]         |
+// +-------+--------------------------------------------------------------+
+func lmPop(cli *Client, args [][]byte) (interface{}, error) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	if numKeys <= 0 || len(args) < numKeys+2 {
+		return nil, ErrSyntax
+	}
+	keys := args[1 : numKeys+1]
+	isLeft, err := parseDirection(args[numKeys+1])
+	if err != nil {
+		return nil, err
+	}
+	count := 1
+	if opts := args[numKeys+2:]; len(opts) > 0 {
+		if len(opts) != 2 || strings.ToLower(string(opts[0])) != "count" {
+			return nil, ErrSyntax
+		}
+		if count, err = strconv.Atoi(string(opts[1])); err != nil || count <= 0 {
+			return nil, ErrNonPositiveCount
+		}
+	}
+
+	key, values, err := cli.db.LMPop(count, isLeft, keys...)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, nil
+	}
+	return []interface{}{key, values}, nil
+}
+
+// +-----------+----------------------------------------------------------+
+// | RPOPLPUSH | RPOPLPUSH source destination                             |
+// +-----------+----------------------------------------------------------+
+func rPopLPush(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, ErrSyntax
+	}
+	value, err := cli.db.RPopLPush(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, nil
+	}
+	return value, nil
+}
+
+// +-------------+----------------------------------------------------------+
+// | HEXPIRE     | HEXPIRE key seconds [NX|XX|GT|LT] FIELDS numfields       |
+// |             | field [field ...]                                        |
+// +-------------+----------------------------------------------------------+
+func hExpire(cli *Client, args [][]byte) (interface{}, error) {
+	return hExpireWith(cli, args, "hexpire", time.Second)
+}
+
+// +-------------+----------------------------------------------------------+
+// | HPEXPIRE    | HPEXPIRE key milliseconds [NX|XX|GT|LT] FIELDS numfields |
+// |             | field [field ...]                                        |
+// +-------------+----------------------------------------------------------+
+func hpExpire(cli *Client, args [][]byte) (interface{}, error) {
+	return hExpireWith(cli, args, "hpexpire", time.Millisecond)
+}
+
+func hExpireWith(cli *Client, args [][]byte, cmd string, unit time.Duration) (interface{}, error) {
+	n, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	if n < 0 || n > math.MaxInt64/int64(unit) {
+		return nil, fmt.Errorf("ERR invalid expire time in '%s' command", cmd)
+	}
+
+	cond := khighdb.ExpireAlways
+	rest := args[2:]
+	switch strings.ToLower(string(rest[0])) {
+	case "nx":
+		cond = khighdb.ExpireNX
+	case "xx":
+		cond = khighdb.ExpireXX
+	case "gt":
+		cond = khighdb.ExpireGT
+	case "lt":
+		cond = khighdb.ExpireLT
+	}
+	if cond != khighdb.ExpireAlways {
+		rest = rest[1:]
+	}
+	fields, err := parseHashFields(rest)
+	if err != nil {
+		return nil, err
+	}
+	results, err := cli.db.HExpire(args[0], time.Duration(n)*unit, cond, fields...)
+	if err != nil {
+		return nil, err
+	}
+	return intsReply(results), nil
+}
+
+// +-------------+----------------------------------------------------------+
+// | HTTL        | HTTL key FIELDS numfields field [field ...]              |
+// +-------------+----------------------------------------------------------+
+func hTTL(cli *Client, args [][]byte) (interface{}, error) {
+	fields, err := parseHashFields(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	ttls, err := cli.db.HTTL(args[0], fields...)
+	if err != nil {
+		return nil, err
+	}
+	reply := make([]interface{}, len(ttls))
+	for i, ttl := range ttls {
+		// Round the milliseconds to seconds like TTL.
+		if ttl >= 0 {
+			ttl = (ttl + 500) / 1000
+		}
+		reply[i] = ttl
+	}
+	return reply, nil
+}
+
+// +-------------+----------------------------------------------------------+
+// | HPERSIST    | HPERSIST key FIELDS numfields field [field ...]          |
+// +-------------+----------------------------------------------------------+
+func hPersist(cli *Client, args [][]byte) (interface{}, error) {
+	fields, err := parseHashFields(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	results, err := cli.db.HPersist(args[0], fields...)
+	if err != nil {
+		return nil, err
+	}
+	return intsReply(results), nil
+}
+
+// intsReply converts the integers to the reply of an array of integers.
+func intsReply(results []int) []interface{} {
+	reply := make([]interface{}, len(results))
+	for i, result := range results {
+		reply[i] = result
+	}
+	return reply
+}
+
+// parseHashFields parses the arguments like 'FIELDS numfields field [field ...]'.
+func parseHashFields(args [][]byte) ([][]byte, error) {
+	if len(args) < 2 || strings.ToLower(string(args[0])) != "fields" {
+		return nil, ErrFieldsMissing
+	}
+	n, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	if n <= 0 {
+		return nil, ErrNumFieldsNotPositive
+	}
+	if n != len(args)-2 {
+		return nil, ErrNumFieldsMismatch
+	}
+	return args[2:], nil
+}
+
+// +-------------+----------------------------------------------------------+
+// | SREM        | SREM key member [member ...]                             |
+// +-------------+----------------------------------------------------------+
+func sRem(cli *Client, args [][]byte) (interface{}, error) {
+	return cli.db.SRem(args[0], args[1:]...)
+}
+
+// +-------------+----------------------------------------------------------+
+// | SMOVE       | SMOVE source destination member                          |
+// +-------------+----------------------------------------------------------+
+func sMove(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, ErrSyntax
+	}
+	ok, err := cli.db.SMove(args[0], args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// +-------------+----------------------------------------------------------+
+// | SRANDMEMBER | SRANDMEMBER key [count]                                  |
+// +-------------+----------------------------------------------------------+
+func sRandMember(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) > 2 {
+		return nil, ErrSyntax
+	}
+	if len(args) == 1 {
+		members, err := cli.db.SRandMember(args[0], 1)
+		if err != nil || len(members) == 0 {
+			return nil, err
+		}
+		return members[0], nil
+	}
+	count, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	members, err := cli.db.SRandMember(args[0], count)
+	if err != nil {
+		return nil, err
+	}
+	if members == nil {
+		members = [][]byte{}
+	}
+	return members, nil
+}
+
+// +-------------+----------------------------------------------------------+
+// | SMISMEMBER  | SMISMEMBER key member [member ...]                       |
+// +-------------+----------------------------------------------------------+
+func sMIsMember(cli *Client, args [][]byte) (interface{}, error) {
+	flags := cli.db.SMIsMember(args[0], args[1:]...)
+	reply := make([]interface{}, len(flags))
+	for i, flag := range flags {
+		reply[i] = 0
+		if flag {
+			reply[i] = 1
+		}
+	}
+	return reply, nil
+}
+
+// +-------------+----------------------------------------------------------+
+// | SINTERCARD  | SINTERCARD numkeys key [key ...] [LIMIT limit]           |
+// +-------------+----------------------------------------------------------+
+func sInterCard(cli *Client, args [][]byte) (interface{}, error) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	if numKeys <= 0 || len(args) < numKeys+1 {
+		return nil, ErrSyntax
+	}
+	var limit int
+	if opts := args[numKeys+1:]; len(opts) > 0 {
+		if len(opts) != 2 || strings.ToLower(string(opts[0])) != "limit" {
+			return nil, ErrSyntax
+		}
+		if limit, err = strconv.Atoi(string(opts[1])); err != nil || limit < 0 {
+			return nil, ErrNegativeLimit
+		}
+	}
+	return cli.db.SInterCard(limit, args[1:numKeys+1]...)
+}
+
+// +------------------+-----------------------------------------------------------------------+
+// | ZRANGEBYSCORE    | ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]           |
+// +------------------+-----------------------------------------------------------------------+
+func zRangeByScore(cli *Client, args [][]byte) (interface{}, error) {
+	return zRangeByScoreWith(cli, args[0], args[1], args[2], args[3:], false)
+}
+
+// +------------------+-----------------------------------------------------------------------+
+// | ZREVRANGEBYSCORE | ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]        |
+// +------------------+-----------------------------------------------------------------------+
+func zRevRangeByScore(cli *Client, args [][]byte) (interface{}, error) {
+	return zRangeByScoreWith(cli, args[0], args[2], args[1], args[3:], true)
+}
+
+// zRangeByScoreWith returns the elements of the sorted set with a score between min and max.
+func zRangeByScoreWith(cli *Client, key, min, max []byte, args [][]byte, reverse bool) (interface{}, error) {
+	opts, withScores, empty, err := parseZRangeOptions(args, true)
+	if err != nil {
+		return nil, err
+	}
+	opts.Reverse = reverse
+	members, err := cli.db.ZRangeByScore(key, min, max, opts)
+	if err != nil {
+		return nil, err
+	}
+	if empty {
+		return [][]byte{}, nil
+	}
+	return zMembersReply(members, withScores), nil
+}
+
+// +------------------+-----------------------------------------------------------------------+
+// | ZRANGEBYLEX      | ZRANGEBYLEX key min max [LIMIT offset count]                          |
+// +------------------+-----------------------------------------------------------------------+
+func zRangeByLex(cli *Client, args [][]byte) (interface{}, error) {
+	return zRangeByLexWith(cli, args[0], args[1], args[2], args[3:], false)
+}
+
+// +------------------+-----------------------------------------------------------------------+
+// | ZREVRANGEBYLEX   | ZREVRANGEBYLEX key max min [LIMIT offset count]                       |
+// +------------------+-----------------------------------------------------------------------+
+func zRevRangeByLex(cli *Client, args [][]byte) (interface{}, error) {
+	return zRangeByLexWith(cli, args[0], args[2], args[1], args[3:], true)
+}
+
+// zRangeByLexWith returns the members of the sorted set between min and max.
+func zRangeByLexWith(cli *Client, key, min, max []byte, args [][]byte, reverse bool) (interface{}, error) {
+	opts, _, empty, err := parseZRangeOptions(args, false)
+	if err != nil {
+		return nil, err
+	}
+	opts.Reverse = reverse
+	members, err := cli.db.ZRangeByLex(key, min, max, opts)
+	if err != nil {
+		return nil, err
+	}
+	if empty || members == nil {
+		members = [][]byte{}
+	}
+	return members, nil
+}
+
+// parseZRangeOptions parses the [WITHSCORES] [LIMIT offset count] options of range commands.
+// empty is true if the LIMIT option makes the reply empty.
+func parseZRangeOptions(args [][]byte, allowScores bool) (opts khighdb.ZRangeOptions, withScores, empty bool, err error) {
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "withscores":
+			if !allowScores {
+				return opts, false, false, ErrSyntax
+			}
+			withScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				return opts, false, false, ErrSyntax
+			}
+			offset, err1 := strconv.Atoi(string(args[i+1]))
+			count, err2 := strconv.Atoi(string(args[i+2]))
+			if err1 != nil || err2 != nil {
+				return opts, false, false, ErrNotInteger
+			}
+			// A negative offset or zero count returns nothing, and a negative count returns all.
+			empty = offset < 0 || count == 0
+			opts.Offset, opts.Count = offset, count
+			i += 2
+		default:
+			return opts, false, false, ErrSyntax
+		}
+	}
+	return opts, withScores, empty, nil
+}
+
+// +------------------+-----------------------------------------------------------------------+
+// | ZCOUNT           | ZCOUNT key min max                                                    |
+// +------------------+-----------------------------------------------------------------------+
+func zCount(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, ErrSyntax
+	}
+	return cli.db.ZCount(args[0], args[1], args[2])
+}
+
+// +------------------+-----------------------------------------------------------------------+
+// | ZLEXCOUNT        | ZLEXCOUNT key min max                                                 |
+// +------------------+-----------------------------------------------------------------------+
+func zLexCount(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, ErrSyntax
+	}
+	return cli.db.ZLexCount(args[0], args[1], args[2])
+}
+
+// +------------------+-----------------------------------------------------------------------+
+// | ZREMRANGEBYSCORE | ZREMRANGEBYSCORE key min max                                          |
+// +------------------+-----------------------------------------------------------------------+
+func zRemRangeByScore(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, ErrSyntax
+	}
+	return cli.db.ZRemRangeByScore(args[0], args[1], args[2])
+}
+
+// +------------------+-----------------------------------------------------------------------+
+// | ZREMRANGEBYRANK  | ZREMRANGEBYRANK key start stop                                        |
+// +------------------+-----------------------------------------------------------------------+
+func zRemRangeByRank(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, ErrSyntax
+	}
+	start, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	stop, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	return cli.db.ZRemRangeByRank(args[0], start, stop)
+}
+
+// +------------------+-----------------------------------------------------------------------+
+// | ZREMRANGEBYLEX   | ZREMRANGEBYLEX key min max                                            |
+// +------------------+-----------------------------------------------------------------------+
+func zRemRangeByLex(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, ErrSyntax
+	}
+	return cli.db.ZRemRangeByLex(args[0], args[1], args[2])
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | ZUNION      | ZUNION numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]       |
+// |             | [WITHSCORES]                                                                    |
+// +-------------+---------------------------------------------------------------------------------+
+func zUnion(cli *Client, args [][]byte) (interface{}, error) {
+	keys, opts, withScores, err := parseZSetOpArgs(args, true, true)
+	if err != nil {
+		return nil, err
+	}
+	members, err := cli.db.ZUnion(opts, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return zMembersReply(members, withScores), nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | ZUNIONSTORE | ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight ...]              |
+// |             | [AGGREGATE SUM|MIN|MAX]                                                         |
+// +-------------+---------------------------------------------------------------------------------+
+func zUnionStore(cli *Client, args [][]byte) (interface{}, error) {
+	keys, opts, _, err := parseZSetOpArgs(args[1:], true, false)
+	if err != nil {
+		return nil, err
+	}
+	return cli.db.ZUnionStore(args[0], opts, keys...)
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | ZINTER      | ZINTER numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]       |
+// |             | [WITHSCORES]                                                                    |
+// +-------------+---------------------------------------------------------------------------------+
+func zInter(cli *Client, args [][]byte) (interface{}, error) {
+	keys, opts, withScores, err := parseZSetOpArgs(args, true, true)
+	if err != nil {
+		return nil, err
+	}
+	members, err := cli.db.ZInter(opts, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return zMembersReply(members, withScores), nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | ZINTERSTORE | ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight ...]              |
+// |             | [AGGREGATE SUM|MIN|MAX]                                                         |
+// +-------------+---------------------------------------------------------------------------------+
+func zInterStore(cli *Client, args [][]byte) (interface{}, error) {
+	keys, opts, _, err := parseZSetOpArgs(args[1:], true, false)
+	if err != nil {
+		return nil, err
+	}
+	return cli.db.ZInterStore(args[0], opts, keys...)
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | ZDIFF       | ZDIFF numkeys key [key ...] [WITHSCORES]                                        |
+// +-------------+---------------------------------------------------------------------------------+
+func zDiff(cli *Client, args [][]byte) (interface{}, error) {
+	keys, _, withScores, err := parseZSetOpArgs(args, false, true)
+	if err != nil {
+		return nil, err
+	}
+	members, err := cli.db.ZDiff(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return zMembersReply(members, withScores), nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | ZDIFFSTORE  | ZDIFFSTORE destination numkeys key [key ...]                                    |
+// +-------------+---------------------------------------------------------------------------------+
+func zDiffStore(cli *Client, args [][]byte) (interface{}, error) {
+	keys, _, _, err := parseZSetOpArgs(args[1:], false, false)
+	if err != nil {
+		return nil, err
+	}
+	return cli.db.ZDiffStore(args[0], keys...)
+}
+
+// parseZSetOpArgs parses the arguments like 'numkeys key [key ...]' followed by the options
+// [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX] if allowed, and [WITHSCORES] if allowed.
+func parseZSetOpArgs(args [][]byte, allowWeights, allowScores bool) (keys [][]byte,
+	opts khighdb.ZSetOpOptions, withScores bool, err error) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, opts, false, ErrNotInteger
+	}
+	if numKeys <= 0 || len(args) < numKeys+1 {
+		return nil, opts, false, ErrSyntax
+	}
+	keys = args[1 : numKeys+1]
+
+	rest := args[numKeys+1:]
+	for i := 0; i < len(rest); i++ {
+		switch strings.ToLower(string(rest[i])) {
+		case "weights":
+			if !allowWeights || i+numKeys >= len(rest) {
+				return nil, opts, false, ErrSyntax
+			}
+			opts.Weights = make([]float64, numKeys)
+			for j := range opts.Weights {
+				i++
+				if opts.Weights[j], err = strconv.ParseFloat(string(rest[i]), 64); err != nil {
+					return nil, opts, false, ErrInvalidWeight
+				}
+			}
+		case "aggregate":
+			if !allowWeights || i+1 >= len(rest) {
+				return nil, opts, false, ErrSyntax
+			}
+			i++
+			switch strings.ToLower(string(rest[i])) {
+			case "sum":
+				opts.Aggregate = zset.AggregateSum
+			case "min":
+				opts.Aggregate = zset.AggregateMin
+			case "max":
+				opts.Aggregate = zset.AggregateMax
+			default:
+				return nil, opts, false, ErrSyntax
+			}
+		case "withscores":
+			if !allowScores {
+				return nil, opts, false, ErrSyntax
+			}
+			withScores = true
+		default:
+			return nil, opts, false, ErrSyntax
+		}
+	}
+	return keys, opts, withScores, nil
+}
+
+// zMembersReply returns the reply of the members of sorted set, with their scores if withScores is true.
+func zMembersReply(members []khighdb.ZMember, withScores bool) [][]byte {
+	reply := make([][]byte, 0, len(members)*2)
+	for _, member := range members {
+		reply = append(reply, member.Member)
+		if withScores {
+			reply = append(reply, []byte(util.Float64ToStr(member.Score)))
+		}
+	}
+	return reply
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | ZPOPMIN     | ZPOPMIN key [count]                                                             |
+// +-------------+---------------------------------------------------------------------------------+
+func zPopMin(cli *Client, args [][]byte) (interface{}, error) {
+	return zPop(args, cli.db.ZPopMin)
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | ZPOPMAX     | ZPOPMAX key [count]                                                             |
+// +-------------+---------------------------------------------------------------------------------+
+func zPopMax(cli *Client, args [][]byte) (interface{}, error) {
+	return zPop(args, cli.db.ZPopMax)
+}
+
+// zPop pops the members of the sorted set by the pop function.
+func zPop(args [][]byte, popFn func(key []byte, count int) ([]khighdb.ZMember, error)) (interface{}, error) {
+	if len(args) > 2 {
+		return nil, ErrSyntax
+	}
+	count := 1
+	if len(args) == 2 {
+		var err error
+		if count, err = strconv.Atoi(string(args[1])); err != nil {
+			return nil, ErrNotInteger
+		}
+		if count < 0 {
+			return nil, ErrNonPositiveCount
+		}
+	}
+	members, err := popFn(args[0], count)
+	if err != nil {
+		return nil, err
+	}
+	return zMembersReply(members, true), nil
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | BZPOPMIN    | BZPOPMIN key [key ...] timeout                                                  |
+// +-------------+---------------------------------------------------------------------------------+
+func bzPopMin(cli *Client, args [][]byte) (interface{}, error) {
+	return blockingZPop(cli, args, cli.db.BZPopMin)
+}
+
+// +-------------+---------------------------------------------------------------------------------+
+// | BZPOPMAX    | BZPOPMAX key [key ...] timeout                                                  |
+// +-------------+---------------------------------------------------------------------------------+
+func bzPopMax(cli *Client, args [][]byte) (interface{}, error) {
+	return blockingZPop(cli, args, cli.db.BZPopMax)
+}
+
+// blockingZPop pops a member by the blocking pop function, see blockingPop.
+func blockingZPop(cli *Client, args [][]byte,
+	popFn func(ctx context.Context, timeout time.Duration, keys ...[]byte) ([]byte, *khighdb.ZMember, error)) (interface{}, error) {
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	ctx, done := cli.block()
+	defer done()
+	key, member, err := popFn(ctx, timeout, args[:len(args)-1]...)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, nil
+	}
+	return [][]byte{key, member.Member, []byte(util.Float64ToStr(member.Score))}, nil
+}
+
+// +-----------+-------------------------------------------------------------------------------+
+// | GEOADD    | GEOADD key longitude latitude member [longitude latitude member ...]          |
+// +-----------+-------------------------------------------------------------------------------+
+func geoAdd(cli *Client, args [][]byte) (interface{}, error) {
+	if (len(args)-1)%3 != 0 {
+		return nil, ErrSyntax
+	}
+	members := make([]khighdb.GeoMember, 0, (len(args)-1)/3)
+	for i := 1; i < len(args); i += 3 {
+		lon, err := util.StrToFloat64(string(args[i]))
+		if err != nil {
+			return nil, ErrNotFloat
+		}
+		lat, err := util.StrToFloat64(string(args[i+1]))
+		if err != nil {
+			return nil, ErrNotFloat
+		}
+		members = append(members, khighdb.GeoMember{
+			Member:   args[i+2],
+			GeoPoint: khighdb.GeoPoint{Longitude: lon, Latitude: lat},
+		})
+	}
+	return cli.db.GeoAdd(args[0], members...)
+}
+
+// +-----------+-------------------------------------------------------------------------------+
+// | GEOPOS    | GEOPOS key [member [member ...]]                                              |
+// +-----------+-------------------------------------------------------------------------------+
+func geoPos(cli *Client, args [][]byte) (interface{}, error) {
+	points := cli.db.GeoPos(args[0], args[1:]...)
+	reply := make([]interface{}, len(points))
+	for i, point := range points {
+		if point != nil {
+			reply[i] = geoPointReply(point)
+		}
+	}
+	return reply, nil
+}
+
+// +-----------+-------------------------------------------------------------------------------+
+// | GEODIST   | GEODIST key member1 member2 [M|KM|FT|MI]                                      |
+// +-----------+-------------------------------------------------------------------------------+
+func geoDist(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) > 4 {
+		return nil, ErrSyntax
+	}
+	unit := 1.0
+	if len(args) == 4 {
+		var err error
+		if unit, err = parseGeoUnit(args[3]); err != nil {
+			return nil, err
+		}
+	}
+	distance, ok := cli.db.GeoDist(args[0], args[1], args[2])
+	if !ok {
+		return nil, nil
+	}
+	return strconv.FormatFloat(distance/unit, 'f', 4, 64), nil
+}
+
+// +-----------+-------------------------------------------------------------------------------+
+// | GEOHASH   | GEOHASH key [member [member ...]]                                             |
+// +-----------+-------------------------------------------------------------------------------+
+func geoHash(cli *Client, args [][]byte) (interface{}, error) {
+	hashes := cli.db.GeoHash(args[0], args[1:]...)
+	reply := make([]interface{}, len(hashes))
+	for i, hash := range hashes {
+		if hash != nil {
+			reply[i] = hash
+		}
+	}
+	return reply, nil
+}
+
+// +-----------+-------------------------------------------------------------------------------+
+// | GEOSEARCH | GEOSEARCH key FROMMEMBER member | FROMLONLAT longitude latitude               |
+// |           | BYRADIUS radius M|KM|FT|MI | BYBOX width height M|KM|FT|MI [ASC|DESC]         |
+// |           | [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]                         |
+// +-----------+-------------------------------------------------------------------------------+
+func geoSearch(cli *Client, args [][]byte) (interface{}, error) {
+	var opts khighdb.GeoSearchOptions
+	var fromLonLat, byRadius, byBox, withCoord, withDist, withHash bool
+	unit := 1.0
+	for i := 1; i < len(args); i++ {
+		remain := len(args) - i - 1
+		switch strings.ToLower(string(args[i])) {
+		case "frommember":
+			if remain < 1 || opts.FromMember != nil || fromLonLat {
+				return nil, ErrGeoSearchFrom
+			}
+			opts.FromMember = args[i+1]
+			i++
+		case "fromlonlat":
+			if remain < 2 || opts.FromMember != nil || fromLonLat {
+				return nil, ErrGeoSearchFrom
+			}
+			lon, err := util.StrToFloat64(string(args[i+1]))
+			if err != nil {
+				return nil, ErrNotFloat
+			}
+			lat, err := util.StrToFloat64(string(args[i+2]))
+			if err != nil {
+				return nil, ErrNotFloat
+			}
+			opts.Center, fromLonLat = khighdb.GeoPoint{Longitude: lon, Latitude: lat}, true
+			i += 2
+		case "byradius":
+			if remain < 2 || byRadius || byBox {
+				return nil, ErrGeoSearchBy
+			}
+			radius, err := util.StrToFloat64(string(args[i+1]))
+			if err != nil {
+				return nil, ErrNotFloat
+			}
+			if unit, err = parseGeoUnit(args[i+2]); err != nil {
+				return nil, err
+			}
+			if radius < 0 {
+				return nil, ErrNegativeRadius
+			}
+			opts.Radius, byRadius = radius*unit, true
+			i += 2
+		case "bybox":
+			if remain < 3 || byRadius || byBox {
+				return nil, ErrGeoSearchBy
+			}
+			width, err := util.StrToFloat64(string(args[i+1]))
+			if err != nil {
+				return nil, ErrNotFloat
+			}
+			height, err := util.StrToFloat64(string(args[i+2]))
+			if err != nil {
+				return nil, ErrNotFloat
+			}
+			if unit, err = parseGeoUnit(args[i+3]); err != nil {
+				return nil, err
+			}
+			if width < 0 || height < 0 {
+				return nil, ErrNegativeRadius
+			}
+			opts.Width, opts.Height, byBox = width*unit, height*unit, true
+			i += 3
+		case "asc":
+			opts.Sort = khighdb.GeoSortAsc
+		case "desc":
+			opts.Sort = khighdb.GeoSortDesc
+		case "count":
+			if remain < 1 {
+				return nil, ErrSyntax
+			}
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, ErrNotInteger
+			}
+			if count <= 0 {
+				return nil, ErrNonPositiveCount
+			}
+			opts.Count = count
+			i++
+		case "any":
+			opts.Any = true
+		case "withcoord":
+			withCoord = true
+		case "withdist":
+			withDist = true
+		case "withhash":
+			withHash = true
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	if opts.FromMember == nil && !fromLonLat {
+		return nil, ErrGeoSearchFrom
+	}
+	if !byRadius && !byBox {
+		return nil, ErrGeoSearchBy
+	}
+	if opts.Any && opts.Count == 0 {
+		return nil, ErrAnyWithoutCount
+	}
+
+	locations, err := cli.db.GeoSearch(args[0], opts)
+	if err != nil {
+		return nil, err
+	}
+	reply := make([]interface{}, len(locations))
+	for i, loc := range locations {
+		if !withCoord && !withDist && !withHash {
+			reply[i] = loc.Member
+			continue
+		}
+		item := []interface{}{loc.Member}
+		if withDist {
+			item = append(item, strconv.FormatFloat(loc.Distance/unit, 'f', 4, 64))
+		}
+		if withHash {
+			item = append(item, int64(loc.Hash))
+		}
+		if withCoord {
+			item = append(item, geoPointReply(&loc.GeoPoint))
+		}
+		reply[i] = item
+	}
+	return reply, nil
+}
+
+// parseGeoUnit parses the unit of distance, and returns the number of meters in the unit.
+func parseGeoUnit(arg []byte) (float64, error) {
+	switch strings.ToLower(string(arg)) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, ErrUnsupportedUnit
+}
+
+// geoPointReply returns the reply of location like [longitude, latitude].
+func geoPointReply(point *khighdb.GeoPoint) []interface{} {
+	return []interface{}{util.Float64ToStr(point.Longitude), util.Float64ToStr(point.Latitude)}
+}
+
+// +------------+--------------------------------------------------------------------------------+
+// | XADD       | XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id        |
+// |            | field value [field value ...]                                                  |
+// +------------+--------------------------------------------------------------------------------+
+func xAdd(cli *Client, args [][]byte) (interface{}, error) {
+	var opts khighdb.XAddOptions
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nomkstream":
+			opts.NoMkStream = true
+			continue
+		case "maxlen", "minid":
+			trim, n, err := parseXTrimArgs(args[i:])
+			if err != nil {
+				return nil, err
+			}
+			opts.Trim = &trim
+			i += n - 1
+			continue
+		}
+		break
+	}
+	if i >= len(args) || (len(args)-i-1) == 0 || (len(args)-i-1)%2 != 0 {
+		return nil, ErrSyntax
+	}
+	opts.ID = args[i]
+	id, err := cli.db.XAdd(args[0], opts, args[i+1:]...)
+	if err == khighdb.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, streamError(err)
+	}
+	return id.String(), nil
+}
+
+// +------------+--------------------------------------------------------------------------------+
+// | XTRIM      | XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]                            |
+// +------------+--------------------------------------------------------------------------------+
+func xTrim(cli *Client, args [][]byte) (interface{}, error) {
+	opts, n, err := parseXTrimArgs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	if n != len(args)-1 {
+		return nil, ErrSyntax
+	}
+	count, err := cli.db.XTrim(args[0], opts)
+	if err != nil {
+		return nil, streamError(err)
+	}
+	return count, nil
+}
+
+// +------------+--------------------------------------------------------------------------------+
+// | XLEN       | XLEN key                                                                       |
+// +------------+--------------------------------------------------------------------------------+
+func xLen(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, ErrSyntax
+	}
+	return cli.db.XLen(args[0]), nil
+}
+
+// +------------+--------------------------------------------------------------------------------+
+// | XRANGE     | XRANGE key start end [COUNT count]                                             |
+// +------------+--------------------------------------------------------------------------------+
+func xRange(cli *Client, args [][]byte) (interface{}, error) {
+	return streamRange(args, cli.db.XRange)
+}
+
+// +------------+--------------------------------------------------------------------------------+
+// | XREVRANGE  | XREVRANGE key end start [COUNT count]                                          |
+// +------------+--------------------------------------------------------------------------------+
+func xRevRange(cli *Client, args [][]byte) (interface{}, error) {
+	return streamRange(args, cli.db.XRevRange)
+}
+
+// streamRange returns the entries in the range by rangeFn.
+func streamRange(args [][]byte,
+	rangeFn func(key, start, end []byte, count int) ([]khighdb.StreamEntry, error)) (interface{}, error) {
+	count := 0
+	if len(args) > 3 {
+		if len(args) != 5 || strings.ToLower(string(args[3])) != "count" {
+			return nil, ErrSyntax
+		}
+		var err error
+		if count, err = strconv.Atoi(string(args[4])); err != nil {
+			return nil, ErrNotInteger
+		}
+		// A non-positive count returns nothing, while 0 means no limit for database.
+		if count <= 0 {
+			return []interface{}{}, nil
+		}
+	}
+	entries, err := rangeFn(args[0], args[1], args[2], count)
+	if err != nil {
+		return nil, streamError(err)
+	}
+	return streamEntriesReply(entries), nil
+}
+
+// +------------+--------------------------------------------------------------------------------+
+// | XDEL       | XDEL key id [id ...]                                                           |
+// +------------+--------------------------------------------------------------------------------+
+func xDel(cli *Client, args [][]byte) (interface{}, error) {
+	count, err := cli.db.XDel(args[0], args[1:]...)
+	if err != nil {
+		return nil, streamError(err)
+	}
+	return count, nil
+}
+
+// +------------+--------------------------------------------------------------------------------+
+// | XREAD      | XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]     |
+// +------------+--------------------------------------------------------------------------------+
+func xRead(cli *Client, args [][]byte) (interface{}, error) {
+	opts, keys, ids, err := parseXReadArgs(args, false)
+	if err != nil {
+		return nil, err
+	}
+	ctx := cli.ctx
+	if opts.Block {
+		var done func()
+		ctx, done = cli.block()
+		defer done()
+	}
+	result, err := cli.db.XRead(ctx, opts, keys, ids)
+	if err != nil {
+		return nil, streamError(err)
+	}
+	return streamsReply(result), nil
+}
+
+// +------------+--------------------------------------------------------------------------------+
+// | XGROUP     | XGROUP CREATE key group id|$ [MKSTREAM] [ENTRIESREAD entries-read]            |
+// |            | XGROUP SETID key group id|$ [ENTRIESREAD entries-read]                          |
+// |            | XGROUP DESTROY key group                                                       |
+// |            | XGROUP CREATECONSUMER key group consumer                                       |
+// |            | XGROUP DELCONSUMER key group consumer                                          |
+// +------------+--------------------------------------------------------------------------------+
+func xGroup(cli *Client, args [][]byte) (interface{}, error) {
+	sub := strings.ToLower(string(args[0]))
+	args = args[1:]
+	arity := map[string]int{"create": 3, "setid": 3, "destroy": 2, "createconsumer": 3, "delconsumer": 3}
+	n, ok := arity[sub]
+	if !ok {
+		return nil, fmt.Errorf("ERR unknown subcommand '%s'", sub)
+	}
+	if len(args) < n {
+		return nil, fmt.Errorf("ERR wrong number of arguments for 'xgroup|%s' command", sub)
+	}
+
+	var err error
+	switch sub {
+	case "create", "setid":
+		mkStream := false
+		// ENTRIESREAD is only used for the lag of consumer group, which is not tracked.
+		for i := 3; i < len(args); i++ {
+			switch strings.ToLower(string(args[i])) {
+			case "mkstream":
+				if sub != "create" {
+					return nil, ErrSyntax
+				}
+				mkStream = true
+			case "entriesread":
+				if i+1 >= len(args) {
+					return nil, ErrSyntax
+				}
+				if _, err = strconv.ParseInt(string(args[i+1]), 10, 64); err != nil {
+					return nil, ErrNotInteger
+				}
+				i++
+			default:
+				return nil, ErrSyntax
+			}
+		}
+		if sub == "create" {
+			err = cli.db.XGroupCreate(args[0], args[1], args[2], mkStream)
+		} else {
+			err = cli.db.XGroupSetID(args[0], args[1], args[2])
+		}
+		if err == khighdb.ErrKeyNotFound {
+			return nil, ErrXGroupKeyRequired
+		}
+		if err != nil {
+			return nil, streamError(err)
+		}
+		return redcon.SimpleString("OK"), nil
+	case "destroy":
+		if len(args) != n {
+			return nil, ErrSyntax
+		}
+		destroyed, err := cli.db.XGroupDestroy(args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		return boolToInt(destroyed), nil
+	case "createconsumer":
+		if len(args) != n {
+			return nil, ErrSyntax
+		}
+		created, err := cli.db.XGroupCreateConsumer(args[0], args[1], args[2])
+		if err != nil {
+			return nil, streamError(err)
+		}
+		return boolToInt(created), nil
+	default:
+		if len(args) != n {
+			return nil, ErrSyntax
+		}
+		count, err := cli.db.XGroupDelConsumer(args[0], args[1], args[2])
+		if err != nil {
+			return nil, streamError(err)
+		}
+		return count, nil
+	}
+}
+
+// +------------+--------------------------------------------------------------------------------+
+// | XREADGROUP | XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK]     |
+// |            | STREAMS key [key ...] id [id ...]                                              |
+// +------------+--------------------------------------------------------------------------------+
+func xReadGroup(cli *Client, args [][]byte) (interface{}, error) {
+	if strings.ToLower(string(args[0])) != "group" {
+		return nil, ErrSyntax
+	}
+	opts, keys, ids, err := parseXReadArgs(args[3:], true)
+	if err != nil {
+		return nil, err
+	}
+	ctx := cli.ctx
+	if opts.Block {
+		var done func()
+		ctx, done = cli.block()
+		defer done()
+	}
+	result, err := cli.db.XReadGroup(ctx, args[1], args[2], opts, keys, ids)
+	if err != nil {
+		return nil, streamError(err)
+	}
+	return streamsReply(result), nil
+}
+
+// +------------+--------------------------------------------------------------------------------+
+// | XACK       | XACK key group id [id ...]                                                     |
+// +------------+--------------------------------------------------------------------------------+
+func xAck(cli *Client, args [][]byte) (interface{}, error) {
+	count, err := cli.db.XAck(args[0], args[1], args[2:]...)
+	if err != nil {
+		return nil, streamError(err)
+	}
+	return count, nil
+}
+
+// +------------+--------------------------------------------------------------------------------+
+// | XPENDING   | XPENDING key group [[IDLE min-idle-time] start end count [consumer]]           |
+// +------------+--------------------------------------------------------------------------------+
+func xPending(cli *Client, args [][]byte) (interface{}, error) {
+	key, group := args[0], args[1]
+	if len(args) == 2 {
+		summary, err := cli.db.XPending(key, group)
+		if err != nil {
+			return nil, streamError(err)
+		}
+		if summary.Count == 0 {
+			return []interface{}{int64(0), nil, nil, nil}, nil
+		}
+		consumers := make([]string, 0, len(summary.Consumers))
+		for consumer := range summary.Consumers {
+			consumers = append(consumers, consumer)
+		}
+		sort.Strings(consumers)
+		consumerReply := make([]interface{}, len(consumers))
+		for i, consumer := range consumers {
+			consumerReply[i] = []interface{}{consumer, strconv.Itoa(summary.Consumers[consumer])}
+		}
+		return []interface{}{summary.Count, summary.Lowest.String(), summary.Highest.String(), consumerReply}, nil
+	}
+
+	var opts khighdb.XPendingOptions
+	args = args[2:]
+	if strings.ToLower(string(args[0])) == "idle" {
+		if len(args) < 2 {
+			return nil, ErrSyntax
+		}
+		idle, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return nil, ErrNotInteger
+		}
+		opts.MinIdle = time.Duration(idle) * time.Millisecond
+		args = args[2:]
+	}
+	if len(args) != 3 && len(args) != 4 {
+		return nil, ErrSyntax
+	}
+	opts.Start, opts.End = args[0], args[1]
+	count, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	if len(args) == 4 {
+		opts.Consumer = args[3]
+	}
+	// A non-positive count returns nothing, while 0 means no limit for database.
+	if count <= 0 {
+		if _, err = cli.db.XPending(key, group); err != nil {
+			return nil, streamError(err)
+		}
+		return []interface{}{}, nil
+	}
+	opts.Count = count
+	entries, err := cli.db.XPendingExt(key, group, opts)
+	if err != nil {
+		return nil, streamError(err)
+	}
+	reply := make([]interface{}, len(entries))
+	for i, pe := range entries {
+		reply[i] = []interface{}{pe.ID.String(), pe.Consumer, pe.Idle.Milliseconds(), pe.DeliveryCount}
+	}
+	return reply, nil
+}
+
+// +------------+--------------------------------------------------------------------------------+
+// | XCLAIM     | XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms]                  |
+// |            | [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE] [JUSTID]              |
+// |            | [LASTID lastid]                                                                |
+// +------------+--------------------------------------------------------------------------------+
+func xClaim(cli *Client, args [][]byte) (interface{}, error) {
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return nil, ErrNotInteger
+	}
+	// The IDs end at the first option.
+	end := 4
+	for end < len(args) {
+		switch strings.ToLower(string(args[end])) {
+		case "idle", "time", "retrycount", "force", "justid", "lastid":
+		default:
+			end++
+			continue
+		}
+		break
+	}
+	var opts khighdb.XClaimOptions
+	for i := end; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		switch option {
+		case "force":
+			opts.Force = true
+		case "justid":
+			opts.JustID = true
+		case "idle", "time", "retrycount", "lastid":
+			if i+1 >= len(args) {
+				return nil, ErrSyntax
+			}
+			i++
+			// LASTID is only used by the replication of Redis.
+			if option == "lastid" {
+				continue
+			}
+			value, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return nil, ErrNotInteger
+			}
+			switch option {
+			case "idle":
+				opts.Idle = time.Duration(value) * time.Millisecond
+			case "time":
+				opts.Time = value
+			default:
+				opts.RetryCount = &value
+			}
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	entries, err := cli.db.XClaim(args[0], args[1], args[2], time.Duration(minIdle)*time.Millisecond,
+		args[4:end], opts)
+	if err != nil {
+		return nil, streamError(err)
+	}
+	if opts.JustID {
+		reply := make([]interface{}, len(entries))
+		for i, entry := range entries {
+			reply[i] = entry.ID.String()
+		}
+		return reply, nil
+	}
+	return streamEntriesReply(entries), nil
+}
+
+// +----------------+-------------------------------------------------------------+
+// | JSON.SET       | JSON.SET key path value [NX | XX]                            |
+// +----------------+-------------------------------------------------------------+
+func jsonSet(cli *Client, args [][]byte) (interface{}, error) {
+	var opts khighdb.JSONSetOptions
+	switch {
+	case len(args) == 3:
+	case len(args) == 4 && strings.EqualFold(string(args[3]), "nx"):
+		opts.NX = true
+	case len(args) == 4 && strings.EqualFold(string(args[3]), "xx"):
+		opts.XX = true
+	default:
+		return nil, ErrSyntax
+	}
+	set, err := cli.db.JSONSet(args[0], args[1], args[2], opts)
+	if err != nil || !set {
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+// +----------------+-------------------------------------------------------------+
+// | JSON.GET       | JSON.GET key [path [path ...]]                              |
+// +----------------+-------------------------------------------------------------+
+func jsonGet(cli *Client, args [][]byte) (interface{}, error) {
+	value, err := cli.db.JSONGet(args[0], args[1:]...)
+	if err == khighdb.ErrKeyNotFound {
+		return nil, nil
+	}
+	return value, err
+}
+
+// +----------------+-------------------------------------------------------------+
+// | JSON.DEL       | JSON.DEL key [path]                                         |
+// | JSON.FORGET    | JSON.FORGET key [path]                                      |
+// +----------------+-------------------------------------------------------------+
+func jsonDel(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) > 2 {
+		return nil, ErrSyntax
+	}
+	var path []byte
+	if len(args) == 2 {
+		path = args[1]
+	}
+	return cli.db.JSONDel(args[0], path)
+}
+
+// +----------------+-------------------------------------------------------------+
+// | JSON.ARRAPPEND | JSON.ARRAPPEND key path value [value ...]                   |
+// +----------------+-------------------------------------------------------------+
+func jsonArrAppend(cli *Client, args [][]byte) (interface{}, error) {
+	lengths, err := cli.db.JSONArrAppend(args[0], args[1], args[2:]...)
+	if err != nil {
+		return nil, jsonError(err)
+	}
+	// The legacy path replies the length of the first matched array.
+	if !isJSONPath(args[1]) {
+		if len(lengths) == 0 {
+			return nil, khighdb.ErrJSONPathNotFound
+		}
+		if lengths[0] == nil {
+			return nil, ErrJSONNotArray
+		}
+		return *lengths[0], nil
+	}
+	reply := make([]interface{}, len(lengths))
+	for i, length := range lengths {
+		if length != nil {
+			reply[i] = *length
+		}
+	}
+	return reply, nil
+}
+
+// +----------------+-------------------------------------------------------------+
+// | JSON.NUMINCRBY | JSON.NUMINCRBY key path value                               |
+// +----------------+-------------------------------------------------------------+
+func jsonNumIncrBy(cli *Client, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, ErrSyntax
+	}
+	sums, err := cli.db.JSONNumIncrBy(args[0], args[1], args[2])
+	if err != nil {
+		return nil, jsonError(err)
+	}
+	// The legacy path replies the first number, otherwise the reply is a JSON array.
+	if !isJSONPath(args[1]) {
+		if len(sums) == 0 {
+			return nil, khighdb.ErrJSONPathNotFound
+		}
+		if sums[0] == nil {
+			return nil, ErrJSONNotNumber
+		}
+		return sums[0], nil
+	}
+	reply := []byte{'['}
+	for i, sum := range sums {
+		if i > 0 {
+			reply = append(reply, ',')
+		}
+		if sum == nil {
+			sum = []byte("null")
+		}
+		reply = append(reply, sum...)
+	}
+	return append(reply, ']'), nil
+}
+
+// parseXTrimArgs parses the trimming arguments like 'MAXLEN|MINID [=|~] threshold [LIMIT count]'
+// at the beginning of args, and returns the number of arguments parsed.
+func parseXTrimArgs(args [][]byte) (khighdb.XTrimOptions, int, error) {
+	var opts khighdb.XTrimOptions
+	if len(args) < 2 {
+		return opts, 0, ErrSyntax
+	}
+	switch strings.ToLower(string(args[0])) {
+	case "maxlen":
+		opts.Strategy = khighdb.XTrimMaxLen
+	case "minid":
+		opts.Strategy = khighdb.XTrimMinID
+	default:
+		return opts, 0, ErrSyntax
+	}
+	// The stream is always trimmed exactly, which is allowed for '~'.
+	i, approx := 1, false
+	if op := string(args[i]); op == "=" || op == "~" {
+		approx = op == "~"
+		if i++; i >= len(args) {
+			return opts, 0, ErrSyntax
+		}
+	}
+	if opts.Strategy == khighdb.XTrimMaxLen {
+		maxLen, err := strconv.Atoi(string(args[i]))
+		if err != nil {
+			return opts, 0, ErrNotInteger
+		}
+		if maxLen < 0 {
+			return opts, 0, ErrNegativeMaxLen
+		}
+		opts.MaxLen = maxLen
+	} else {
+		opts.MinID = args[i]
+	}
+	i++
+	if i < len(args) && strings.ToLower(string(args[i])) == "limit" {
+		if !approx {
+			return opts, 0, ErrLimitWithoutApprox
+		}
+		if i+1 >= len(args) {
+			return opts, 0, ErrSyntax
+		}
+		if limit, err := strconv.Atoi(string(args[i+1])); err != nil || limit < 0 {
+			return opts, 0, ErrNotInteger
+		}
+		i += 2
+	}
+	return opts, i, nil
+}
+
+// parseXReadArgs parses the arguments of XREAD, or those of XREADGROUP after the consumer.
+func parseXReadArgs(args [][]byte, group bool) (opts khighdb.XReadOptions, keys, ids [][]byte, err error) {
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "count", "block":
+			if i+1 >= len(args) {
+				return opts, nil, nil, ErrSyntax
+			}
+			value, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return opts, nil, nil, ErrNotInteger
+			}
+			if strings.ToLower(string(args[i])) == "count" {
+				if value > 0 {
+					opts.Count = int(value)
+				}
+			} else {
+				if value < 0 {
+					return opts, nil, nil, ErrNegativeTimeout
+				}
+				opts.Block, opts.Timeout = true, time.Duration(value)*time.Millisecond
+			}
+			i++
+		case "noack":
+			if !group {
+				return opts, nil, nil, ErrSyntax
+			}
+			opts.NoAck = true
+		case "streams":
+			streams := args[i+1:]
+			if len(streams) == 0 || len(streams)%2 != 0 {
+				return opts, nil, nil, ErrUnbalancedStreams
+			}
+			keys, ids = streams[:len(streams)/2], streams[len(streams)/2:]
+			return opts, keys, ids, nil
+		default:
+			return opts, nil, nil, ErrSyntax
+		}
+	}
+	return opts, nil, nil, ErrSyntax
+}
+
+// streamError converts the errors of stream to the errors of Redis.
+func streamError(err error) error {
+	switch err {
+	case khighdb.ErrInvalidStreamID:
+		return ErrInvalidStreamID
+	case khighdb.ErrStreamIDTooSmall:
+		return ErrStreamIDTooSmall
+	case khighdb.ErrStreamIDZero:
+		return ErrStreamIDZero
+	case khighdb.ErrStreamNoGroup:
+		return ErrNoGroup
+	case khighdb.ErrStreamGroupExists:
+		return ErrBusyGroup
+	}
+	return err
+}
+
+// streamEntriesReply returns the reply of stream entries like [[id, [field, value, ...]], ...],
+// the fields of deleted entries are nil.
+func streamEntriesReply(entries []khighdb.StreamEntry) []interface{} {
+	reply := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		var fields interface{}
+		if entry.Fields != nil {
+			fields = entry.Fields
+		}
+		reply[i] = []interface{}{entry.ID.String(), fields}
+	}
+	return reply
+}
+
+// streamsReply returns the reply of XREAD and XREADGROUP like [[key, entries], ...], nil is
+// returned if no stream is read.
+func streamsReply(result []khighdb.StreamEntries) interface{} {
+	if len(result) == 0 {
+		return nil
+	}
+	reply := make([]interface{}, len(result))
+	for i, r := range result {
+		reply[i] = []interface{}{r.Key, streamEntriesReply(r.Entries)}
+	}
+	return reply
+}
+
+// jsonError converts the errors of JSON commands which require the key to exist.
+func jsonError(err error) error {
+	if err == khighdb.ErrKeyNotFound {
+		return ErrJSONKeyNotFound
+	}
+	return err
+}
+
+// isJSONPath checks if the path is a JSONPath starting with '$' rather than a legacy path.
+func isJSONPath(path []byte) bool {
+	return len(path) > 0 && path[0] == '$'
+}
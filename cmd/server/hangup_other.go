@@ -0,0 +1,14 @@
+// +build windows plan9
+
+package main
+
+import "net"
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// watchHangup is not supported, the blocked client is only released when it is served or
+// the timeout elapses.
+func watchHangup(conn net.Conn, onHangup func()) func() {
+	return func() {}
+}
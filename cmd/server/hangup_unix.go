@@ -0,0 +1,51 @@
+// +build !windows,!plan9
+
+package main
+
+import (
+	"net"
+	"syscall"
+	"time"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// watchHangup calls onHangup once the peer of the connection hangs up. The received data is
+// peeked and left for the server to read, and the watch ends if any data is received.
+// It returns the function to stop watching.
+func watchHangup(conn net.Conn, onHangup func()) func() {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return func() {}
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var hangup bool
+		buf := make([]byte, 1)
+		err := rc.Read(func(fd uintptr) bool {
+			n, _, err := syscall.Recvfrom(int(fd), buf, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				return false
+			}
+			hangup = err != nil || n == 0
+			return true
+		})
+		if err == nil && hangup {
+			onHangup()
+		}
+	}()
+
+	return func() {
+		// The deadline wakes up the watching goroutine.
+		_ = conn.SetReadDeadline(time.Now())
+		<-done
+		_ = conn.SetReadDeadline(time.Time{})
+	}
+}
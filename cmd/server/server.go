@@ -18,7 +18,7 @@ import (
 )
 
 // @Author KHighness
-// @Update 2023-01-09
+// @Update 2023-01-26
 
 var (
 	config                  = new(ServerConfig)
@@ -37,10 +37,10 @@ func init() {
 	flag.StringVar(&config.host, "host", defaultHost, "server host")
 	flag.UintVar(&config.port, "port", defaultPort, "server port")
 	flag.UintVar(&config.databases, "databases", defaultDatabaseNum, "the number of databases")
-	flag.Parse()
 }
 
 func main() {
+	flag.Parse()
 	fmt.Println(banner())
 	server := Start(config)
 	go server.listen()
@@ -58,11 +58,12 @@ type ServerConfig struct {
 
 // KhighDBServer defines the structure of the KhighDB server.
 type KhighDBServer struct {
-	dbs map[int]*khighdb.KhighDB
-	svr *redcon.Server
-	cfg *ServerConfig
-	sig chan os.Signal
-	mu  *sync.Mutex
+	dbs     map[int]*khighdb.KhighDB
+	svr     *redcon.Server
+	cfg     *ServerConfig
+	sig     chan os.Signal
+	mu      *sync.Mutex
+	cursors *scanCursors
 }
 
 // banner returns the string banner in file.
@@ -97,10 +98,11 @@ func Start(config *ServerConfig) *KhighDBServer {
 
 	// Initialize the tcp server.
 	server := &KhighDBServer{
-		dbs: dbs,
-		cfg: config,
-		sig: sig,
-		mu:  new(sync.Mutex),
+		dbs:     dbs,
+		cfg:     config,
+		sig:     sig,
+		mu:      new(sync.Mutex),
+		cursors: newScanCursors(),
 	}
 	addr := fmt.Sprintf("%s:%v", config.host, config.port)
 	svr := redcon.NewServerNetwork("tcp", addr, server.handle, server.accept, server.closed)
@@ -118,6 +120,8 @@ func (server *KhighDBServer) listen() {
 
 // stop stops the database server.
 func (server *KhighDBServer) stop() {
+	server.mu.Lock()
+	defer server.mu.Unlock()
 	for i, db := range server.dbs {
 		if err := db.Close(); err != nil {
 			zap.S().Errorf("Close database[%d] error: %v", i, err)
@@ -131,18 +135,25 @@ func (server *KhighDBServer) stop() {
 
 // handle handles client command request.
 func (server *KhighDBServer) handle(conn redcon.Conn, cmd redcon.Command) {
-	// TODO
+	cli, ok := conn.Context().(*Client)
+	if !ok {
+		conn.WriteError("ERR client is not initialized")
+		return
+	}
+	cli.execute(conn, cmd)
 }
 
 // accept handles client connection request.
 func (server *KhighDBServer) accept(conn redcon.Conn) bool {
-	// TODO
+	conn.SetContext(newClient(server, conn))
 	zap.S().Infof("Accept connection from %s", conn.RemoteAddr())
 	return true
 }
 
 // closed handles client connection close request.
 func (server *KhighDBServer) closed(conn redcon.Conn, err error) {
-	// TODO
+	if cli, ok := conn.Context().(*Client); ok {
+		cli.cancel()
+	}
 	zap.S().Infof("Close connection with %s", conn.RemoteAddr())
 }
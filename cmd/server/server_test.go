@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+func startTestServer(t *testing.T) (*KhighDBServer, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	assert.Nil(t, ln.Close())
+
+	cfg := &ServerConfig{
+		dbPath:    filepath.Join("/tmp", "KhighDB-server"),
+		host:      "127.0.0.1",
+		port:      uint(port),
+		databases: defaultDatabaseNum,
+	}
+	server := Start(cfg)
+	go func() {
+		_ = server.svr.ListenAndServe()
+	}()
+	return server, fmt.Sprintf("%s:%d", cfg.host, cfg.port)
+}
+
+func dialTestServer(t *testing.T, addr string) net.Conn {
+	var conn net.Conn
+	var err error
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			return conn
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Failed to dial server: %v", err)
+	return nil
+}
+
+func writeCommand(t *testing.T, conn net.Conn, args ...string) {
+	cmd := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		cmd += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := conn.Write([]byte(cmd))
+	assert.Nil(t, err)
+}
+
+func TestServer_BlockedClientDisconnect(t *testing.T) {
+	server, addr := startTestServer(t)
+	defer func() {
+		server.stop()
+		_ = os.RemoveAll(server.cfg.dbPath)
+	}()
+
+	// The first client disconnects while it is blocked.
+	dead := dialTestServer(t, addr)
+	writeCommand(t, dead, "BLPOP", "list", "0")
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, dead.Close())
+	time.Sleep(100 * time.Millisecond)
+
+	live := dialTestServer(t, addr)
+	defer live.Close()
+	writeCommand(t, live, "BLPOP", "list", "0")
+	time.Sleep(100 * time.Millisecond)
+	pusher := dialTestServer(t, addr)
+	defer pusher.Close()
+	writeCommand(t, pusher, "RPUSH", "list", "value")
+	assert.Equal(t, ":1\r\n", readReply(t, pusher, 1))
+
+	// The element is delivered to the live client rather than the disconnected one.
+	assert.Equal(t, "*2\r\n$4\r\nlist\r\n$5\r\nvalue\r\n", readReply(t, live, 5))
+	writeCommand(t, pusher, "LPUSH", "list", "a", "b")
+	assert.Equal(t, ":2\r\n", readReply(t, pusher, 1))
+	writeCommand(t, live, "BLPOP", "list", "0")
+	assert.Equal(t, "*2\r\n$4\r\nlist\r\n$1\r\nb\r\n", readReply(t, live, 5))
+}
+
+func TestServer_Get(t *testing.T) {
+	server, addr := startTestServer(t)
+	defer func() {
+		server.stop()
+		_ = os.RemoveAll(server.cfg.dbPath)
+	}()
+
+	conn := dialTestServer(t, addr)
+	defer conn.Close()
+	writeCommand(t, conn, "GET", "key")
+	assert.Equal(t, "$-1\r\n", readReply(t, conn, 1))
+	writeCommand(t, conn, "SET", "key", "value")
+	assert.Equal(t, "+OK\r\n", readReply(t, conn, 1))
+	writeCommand(t, conn, "GET", "key")
+	assert.Equal(t, "$5\r\nvalue\r\n", readReply(t, conn, 2))
+}
+
+func TestServer_ScanLongKeys(t *testing.T) {
+	server, addr := startTestServer(t)
+	defer func() {
+		server.stop()
+		_ = os.RemoveAll(server.cfg.dbPath)
+	}()
+
+	conn := dialTestServer(t, addr)
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	// readLine reads a line of reply without the CRLF.
+	readLine := func() string {
+		assert.Nil(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		line, err := rd.ReadString('\n')
+		assert.Nil(t, err)
+		return strings.TrimSuffix(line, "\r\n")
+	}
+
+	want := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("%s-%d", strings.Repeat("long-key", 8), i)
+		want[key] = true
+		writeCommand(t, conn, "SET", key, "value")
+		assert.Equal(t, "+OK", readLine())
+	}
+
+	got := make(map[string]bool)
+	cursor := "0"
+	for i := 0; i == 0 || cursor != "0"; i++ {
+		writeCommand(t, conn, "SCAN", cursor, "COUNT", "3")
+		assert.Equal(t, "*2", readLine())
+		readLine()
+		cursor = readLine()
+		// The cursor is an unsigned 64-bit integer as Redis clients expect.
+		_, err := strconv.ParseUint(cursor, 10, 64)
+		assert.Nil(t, err)
+		n, err := strconv.Atoi(strings.TrimPrefix(readLine(), "*"))
+		assert.Nil(t, err)
+		for j := 0; j < n; j++ {
+			readLine()
+			got[readLine()] = true
+		}
+	}
+	assert.Equal(t, want, got)
+
+	writeCommand(t, conn, "SCAN", "18446744073709551615")
+	assert.Equal(t, "-"+ErrInvalidCursor.Error(), readLine())
+}
+
+// readReply reads the reply of n lines from the connection.
+func readReply(t *testing.T, conn net.Conn, n int) string {
+	assert.Nil(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	rd := bufio.NewReader(conn)
+	var reply string
+	for i := 0; i < n; i++ {
+		line, err := rd.ReadString('\n')
+		assert.Nil(t, err)
+		reply += line
+	}
+	return reply
+}
@@ -1,11 +1,11 @@
 package art
 
 import (
-	goart "github.com/plar/go-adaptive-radix-tree"
+	goart "github.com/Khighness/khighdb/data/art/internal/goart"
 )
 
 // @Author KHighness
-// @Update 2022-12-25
+// @Update 2023-01-26
 
 // AdaptiveRadixTree wrapper goart.Tree.
 type AdaptiveRadixTree struct {
@@ -65,6 +65,35 @@ func (art *AdaptiveRadixTree) PrefixScan(prefix []byte, count int) (keys [][]byt
 	return
 }
 
+// ForEachPrefix calls fn for every key-value pair whose key has the specified prefix
+// in ascending order of keys, the iteration stops once fn returns false.
+func (art *AdaptiveRadixTree) ForEachPrefix(prefix []byte, fn func(key []byte, value interface{}) bool) {
+	cb := func(node goart.Node) bool {
+		if node.Kind() != goart.Leaf {
+			return true
+		}
+		return fn(node.Key(), node.Value())
+	}
+
+	if len(prefix) == 0 {
+		art.tree.ForEach(cb)
+	} else {
+		art.tree.ForEachPrefix(prefix, cb)
+	}
+}
+
+// ForEachFrom calls fn for every key-value pair whose key is greater than or equal to the
+// specified key in ascending order of keys, or less than or equal to the specified key in
+// descending order if reverse is true. The iteration starts from the first or the last key
+// if the specified key is nil, and stops once fn returns false.
+func (art *AdaptiveRadixTree) ForEachFrom(key []byte, reverse bool, fn func(key []byte, value interface{}) bool) {
+	cb := func(node goart.Node) bool {
+		return fn(node.Key(), node.Value())
+	}
+
+	art.tree.ForEachFrom(key, reverse, cb)
+}
+
 // Size returns the count of the elements in tree.
 func (art *AdaptiveRadixTree) Size() int {
 	return art.tree.Size()
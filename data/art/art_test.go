@@ -10,7 +10,7 @@ import (
 )
 
 // @Author KHighness
-// @Update 2022-12-25
+// @Update 2023-01-26
 
 func TestAdaptiveRadixTree_Put(t *testing.T) {
 	tree := NewART()
@@ -175,3 +175,56 @@ func TestAdaptiveRadixTree_PrefixScan(t *testing.T) {
 	keys4 := art.PrefixScan(nil, 6)
 	assert.Equal(t, 6, len(keys4))
 }
+
+func TestAdaptiveRadixTree_ForEachPrefix(t *testing.T) {
+	art := NewART()
+	var keys = [][]byte{[]byte("b"), []byte("ab"), []byte("a"), []byte("abc"), []byte("aa"), []byte("ba")}
+	for i, key := range keys {
+		art.Put(key, i)
+	}
+
+	var targets []string
+	art.ForEachPrefix(nil, func(key []byte, value interface{}) bool {
+		targets = append(targets, string(key))
+		return true
+	})
+	assert.Equal(t, []string{"a", "aa", "ab", "abc", "b", "ba"}, targets)
+
+	targets = targets[:0]
+	art.ForEachPrefix([]byte("ab"), func(key []byte, value interface{}) bool {
+		targets = append(targets, string(key))
+		return true
+	})
+	assert.Equal(t, []string{"ab", "abc"}, targets)
+
+	targets = targets[:0]
+	art.ForEachPrefix(nil, func(key []byte, value interface{}) bool {
+		targets = append(targets, string(key))
+		return len(targets) < 2
+	})
+	assert.Equal(t, []string{"a", "aa"}, targets)
+}
+
+func TestAdaptiveRadixTree_ForEachFrom(t *testing.T) {
+	art := NewART()
+	var keys = [][]byte{[]byte("b"), []byte("ab"), []byte("a"), []byte("abc"), []byte("aa"), []byte("ba")}
+	for i, key := range keys {
+		art.Put(key, i)
+	}
+
+	collect := func(key []byte, reverse bool) (targets []string) {
+		art.ForEachFrom(key, reverse, func(key []byte, value interface{}) bool {
+			targets = append(targets, string(key))
+			return len(targets) < 3
+		})
+		return
+	}
+	assert.Equal(t, []string{"a", "aa", "ab"}, collect(nil, false))
+	assert.Equal(t, []string{"ba", "b", "abc"}, collect(nil, true))
+	assert.Equal(t, []string{"ab", "abc", "b"}, collect([]byte("ab"), false))
+	assert.Equal(t, []string{"abc", "b", "ba"}, collect([]byte("abb"), false))
+	assert.Equal(t, []string{"ab", "aa", "a"}, collect([]byte("abb"), true))
+	assert.Equal(t, []string{"b", "abc", "ab"}, collect([]byte("b"), true))
+	assert.Nil(t, collect([]byte("c"), false))
+	assert.Nil(t, collect([]byte("0"), true))
+}
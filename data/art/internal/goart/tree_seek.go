@@ -0,0 +1,176 @@
+package art
+
+import (
+	"bytes"
+)
+
+func (t *tree) ForEachFrom(key Key, reverse bool, callback Callback) {
+	callback = traverseFilter(TraverseLeaf, callback)
+	if key == nil && reverse {
+		t.recursiveForEachReverse(t.root, callback)
+		return
+	}
+	t.forEachFrom(t.root, key, 0, reverse, callback)
+}
+
+// forEachFrom traverses the leaves under current from the key, depth is the number of
+// key bytes consumed by the ancestors of current.
+func (t *tree) forEachFrom(current *artNode, key Key, depth uint32, reverse bool, callback Callback) traverseAction {
+	if current == nil {
+		return traverseContinue
+	}
+
+	if current.isLeaf() {
+		cmp := bytes.Compare(current.leaf().key, key)
+		if (!reverse && cmp >= 0) || (reverse && cmp <= 0) {
+			if !callback(current) {
+				return traverseStop
+			}
+		}
+		return traverseContinue
+	}
+
+	// All the leaves under the node share its prefix, so the whole subtree
+	// is either traversed or skipped if the prefix differs from the key.
+	if cmp := current.comparePrefix(key, depth); cmp != 0 {
+		if (cmp > 0) != reverse {
+			return t.forEachAll(current, reverse, callback)
+		}
+		return traverseContinue
+	}
+
+	node := current.node()
+	depth += node.prefixLen
+	if depth >= uint32(len(key)) {
+		// The key ends at the node, the leaf with null suffix equals to the key,
+		// and the leaves under the other children are greater than the key.
+		if reverse {
+			return t.forEachAll(node.zeroChild, true, callback)
+		}
+		return t.forEachAll(current, false, callback)
+	}
+
+	c := key[depth]
+	action := traverseContinue
+	current.forEachChild(reverse, func(b byte, child *artNode) bool {
+		if (!reverse && b < c) || (reverse && b > c) {
+			return true
+		}
+		if b == c {
+			action = t.forEachFrom(child, key, depth+1, reverse, callback)
+		} else {
+			action = t.forEachAll(child, reverse, callback)
+		}
+		return action == traverseContinue
+	})
+	if action == traverseStop || !reverse {
+		return action
+	}
+	// The leaf with null suffix is less than the key.
+	return t.forEachAll(node.zeroChild, true, callback)
+}
+
+// forEachAll traverses all the nodes under current in ascending or descending order.
+func (t *tree) forEachAll(current *artNode, reverse bool, callback Callback) traverseAction {
+	if !reverse {
+		return t.recursiveForEach(current, callback)
+	}
+	return t.recursiveForEachReverse(current, callback)
+}
+
+func (t *tree) recursiveForEachReverse(current *artNode, callback Callback) traverseAction {
+	if current == nil {
+		return traverseContinue
+	}
+
+	if !callback(current) {
+		return traverseStop
+	}
+	if current.isLeaf() {
+		return traverseContinue
+	}
+
+	action := traverseContinue
+	current.forEachChild(true, func(_ byte, child *artNode) bool {
+		action = t.recursiveForEachReverse(child, callback)
+		return action == traverseContinue
+	})
+	if action == traverseStop {
+		return action
+	}
+	return t.recursiveForEachReverse(current.node().zeroChild, callback)
+}
+
+// forEachChild calls fn with the children except the one with null suffix of an inner node
+// in ascending order of their key bytes, or descending order if reverse is true.
+// The iteration stops once fn returns false.
+func (an *artNode) forEachChild(reverse bool, fn func(c byte, child *artNode) bool) {
+	visit := func(n int, child func(i int) (byte, *artNode)) {
+		for i := 0; i < n; i++ {
+			idx := i
+			if reverse {
+				idx = n - 1 - i
+			}
+			c, node := child(idx)
+			if node != nil && !fn(c, node) {
+				return
+			}
+		}
+	}
+
+	switch an.kind {
+	case Node4:
+		node := an.node4()
+		visit(int(node.numChildren), func(i int) (byte, *artNode) {
+			return node.keys[i], node.children[i]
+		})
+
+	case Node16:
+		node := an.node16()
+		visit(int(node.numChildren), func(i int) (byte, *artNode) {
+			return node.keys[i], node.children[i]
+		})
+
+	case Node48:
+		node := an.node48()
+		visit(node256Max, func(i int) (byte, *artNode) {
+			if node.present[uint16(i)>>n48s]&(1<<(uint16(i)%n48m)) == 0 {
+				return 0, nil
+			}
+			return byte(i), node.children[node.keys[i]]
+		})
+
+	case Node256:
+		node := an.node256()
+		visit(node256Max, func(i int) (byte, *artNode) {
+			return byte(i), node.children[i]
+		})
+	}
+}
+
+// comparePrefix compares the prefix of an inner node with the key bytes from depth.
+// It returns 0 if the key bytes start with the prefix, otherwise the key bytes are
+// compared with the prefix as the leaves under the node would be.
+func (an *artNode) comparePrefix(key Key, depth uint32) int {
+	node := an.node()
+	if node.prefixLen == 0 {
+		return 0
+	}
+
+	var prefix []byte
+	if node.prefixLen <= MaxPrefixLen {
+		prefix = node.prefix[:node.prefixLen]
+	} else {
+		// Only the first MaxPrefixLen bytes are stored, the full prefix is taken from a leaf.
+		prefix = an.minimum().key[depth : depth+node.prefixLen]
+	}
+
+	var rest []byte
+	if depth < uint32(len(key)) {
+		rest = key[depth:]
+	}
+	if uint32(len(rest)) > node.prefixLen {
+		rest = rest[:node.prefixLen]
+	}
+	return bytes.Compare(prefix, rest)
+}
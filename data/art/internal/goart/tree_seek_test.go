@@ -0,0 +1,85 @@
+package art
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTree_ForEachFrom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randKey := func() Key {
+		// Keys share long prefixes, and some of them are prefixes of the others.
+		prefixes := []string{"", "a", "ab", "user:0000000000000", "user:0000000000001", "z"}
+		key := prefixes[rnd.Intn(len(prefixes))]
+		for n := rnd.Intn(4); n > 0; n-- {
+			if rnd.Intn(2) == 0 {
+				key += string([]byte{byte(rnd.Intn(256))})
+			} else {
+				key += string(rune('a' + rnd.Intn(26)))
+			}
+		}
+		if rnd.Intn(8) == 0 {
+			key += "\x00"
+		}
+		return Key(key)
+	}
+
+	tree := New()
+	keys := make(map[string]bool)
+	for i := 0; i < 5000; i++ {
+		key := randKey()
+		tree.Insert(key, string(key))
+		keys[string(key)] = true
+		// Delete some keys to shrink the nodes.
+		if del := randKey(); i%3 == 0 && len(del) > 0 {
+			tree.Delete(del)
+			delete(keys, string(del))
+		}
+	}
+	var sorted []string
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	collect := func(key Key, reverse bool, limit int) (got []string) {
+		tree.ForEachFrom(key, reverse, func(node Node) bool {
+			got = append(got, string(node.Key()))
+			return len(got) < limit
+		})
+		return
+	}
+	var reversed []string
+	for i := len(sorted) - 1; i >= 0; i-- {
+		reversed = append(reversed, sorted[i])
+	}
+	assert.Equal(t, sorted, collect(nil, false, len(sorted)+1))
+	assert.Equal(t, reversed, collect(nil, true, len(sorted)+1))
+
+	for i := 0; i < 500; i++ {
+		seek := randKey()
+		var want []string
+		for _, key := range sorted {
+			if bytes.Compare([]byte(key), seek) >= 0 {
+				want = append(want, key)
+			}
+		}
+		assert.Equal(t, want, collect(seek, false, len(sorted)+1), fmt.Sprintf("seek %q", seek))
+		if len(want) > 3 {
+			assert.Equal(t, want[:3], collect(seek, false, 3))
+		}
+
+		want = nil
+		for j := len(sorted) - 1; j >= 0; j-- {
+			if bytes.Compare([]byte(sorted[j]), seek) <= 0 {
+				want = append(want, sorted[j])
+			}
+		}
+		assert.Equal(t, want, collect(seek, true, len(sorted)+1), fmt.Sprintf("reverse seek %q", seek))
+	}
+}
@@ -0,0 +1,8 @@
+package art
+
+func min(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
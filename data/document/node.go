@@ -0,0 +1,264 @@
+package document
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+var (
+	// ErrInvalidJSON represents the data is not a valid JSON value.
+	ErrInvalidJSON = errors.New("invalid JSON value")
+	// ErrInvalidNode represents the encoded node or subkey is corrupted.
+	ErrInvalidNode = errors.New("invalid JSON node encoding")
+	// ErrNumberOverflow represents the result of arithmetic is not a finite number.
+	ErrNumberOverflow = errors.New("the result is not a finite number")
+)
+
+// Kind defines the kind of node.
+type Kind byte
+
+const (
+	Object Kind = 'o'
+	Array  Kind = 'a'
+	Scalar Kind = 's'
+)
+
+// Node is a value in document. A document is flattened into the nodes of all its values, so
+// an object or array node holds no members or elements, which are the nodes with the subkeys
+// prefixed by the subkey of the object or array.
+type Node struct {
+	Kind Kind
+	// Len is the length of array.
+	Len int
+	// Raw is the JSON text of scalar, which is a string, number, true, false or null.
+	Raw []byte
+}
+
+// Record is a node with its subkey.
+type Record struct {
+	Subkey []byte
+	Node   *Node
+}
+
+// Encode encodes the node, which looks like:
+//
+//	+------+-----------------------------------------+
+//	| kind |                 payload                 |
+//	+------+-----------------------------------------+
+//	| 'o'  |                  empty                  |
+//	| 'a'  |      the length of array in uvarint     |
+//	| 's'  |          the JSON text of scalar        |
+//	+------+-----------------------------------------+
+func (n *Node) Encode() []byte {
+	switch n.Kind {
+	case Array:
+		buf := make([]byte, 1+binary.MaxVarintLen64)
+		buf[0] = byte(Array)
+		size := binary.PutUvarint(buf[1:], uint64(n.Len))
+		return buf[:1+size]
+	case Scalar:
+		return append([]byte{byte(Scalar)}, n.Raw...)
+	}
+	return []byte{byte(n.Kind)}
+}
+
+// DecodeNode decodes the node encoded by Encode.
+func DecodeNode(buf []byte) (*Node, error) {
+	if len(buf) == 0 {
+		return nil, ErrInvalidNode
+	}
+	switch Kind(buf[0]) {
+	case Object:
+		return &Node{Kind: Object}, nil
+	case Array:
+		size, n := binary.Uvarint(buf[1:])
+		if n <= 0 {
+			return nil, ErrInvalidNode
+		}
+		return &Node{Kind: Array, Len: int(size)}, nil
+	case Scalar:
+		return &Node{Kind: Scalar, Raw: buf[1:]}, nil
+	}
+	return nil, ErrInvalidNode
+}
+
+// IsNumber checks if the node is a number.
+func (n *Node) IsNumber() bool {
+	return n.Kind == Scalar && len(n.Raw) > 0 && (n.Raw[0] == '-' || (n.Raw[0] >= '0' && n.Raw[0] <= '9'))
+}
+
+// Parse parses the JSON text to the value which can be flattened by Flatten.
+func Parse(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, ErrInvalidJSON
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, ErrInvalidJSON
+	}
+	return value, nil
+}
+
+// IsNumberText checks if the data is the JSON text of a number.
+func IsNumberText(data []byte) bool {
+	value, err := Parse(data)
+	_, ok := value.(json.Number)
+	return err == nil && ok
+}
+
+// Flatten flattens the value parsed by Parse into the nodes of it and all its descendants,
+// the subkey of the value is base. The members of object are flattened in order of names,
+// and fn is called with a node before its members or elements.
+func Flatten(base []byte, value interface{}, fn func(subkey []byte, node *Node) error) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if err := fn(base, &Node{Kind: Object}); err != nil {
+			return err
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := Flatten(ChildKey(base, name), v[name], fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		if err := fn(base, &Node{Kind: Array, Len: len(v)}); err != nil {
+			return err
+		}
+		for i, elem := range v {
+			if err := Flatten(IndexKey(base, i), elem, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	raw, err := Marshal(value)
+	if err != nil {
+		return err
+	}
+	return fn(base, &Node{Kind: Scalar, Raw: raw})
+}
+
+// Build builds the value from the records of it and all its descendants, the subkey of the
+// value is base. The records are in ascending order of subkeys, so the first one is the record
+// of the value itself. The built value can be encoded by Marshal.
+func Build(base []byte, records []Record) (interface{}, error) {
+	if len(records) == 0 || !bytes.Equal(records[0].Subkey, base) {
+		return nil, ErrInvalidNode
+	}
+	root := records[0].Node.value()
+	for _, record := range records[1:] {
+		parent, buf := root, record.Subkey[len(base):]
+		for {
+			seg, n, err := decodeSegment(buf)
+			if err != nil {
+				return nil, err
+			}
+			if buf = buf[n:]; len(buf) == 0 {
+				if err = setChild(parent, seg, record.Node.value()); err != nil {
+					return nil, err
+				}
+				break
+			}
+			if parent, err = getChild(parent, seg); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return root, nil
+}
+
+// Marshal encodes the value to JSON text, the HTML characters are not escaped.
+func Marshal(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+// AddNumber adds delta to the number, both of them are JSON numbers. The sum is an integer
+// if both of them are integers and the sum does not overflow, otherwise it is a float.
+func AddNumber(number, delta []byte) ([]byte, error) {
+	x, err1 := strconv.ParseInt(string(number), 10, 64)
+	y, err2 := strconv.ParseInt(string(delta), 10, 64)
+	if err1 == nil && err2 == nil {
+		sum := x + y
+		if (sum > x) == (y > 0) {
+			return strconv.AppendInt(nil, sum, 10), nil
+		}
+	}
+
+	fx, err := strconv.ParseFloat(string(number), 64)
+	if err != nil {
+		return nil, ErrInvalidJSON
+	}
+	fy, err := strconv.ParseFloat(string(delta), 64)
+	if err != nil {
+		return nil, ErrInvalidJSON
+	}
+	sum := fx + fy
+	if math.IsInf(sum, 0) || math.IsNaN(sum) {
+		return nil, ErrNumberOverflow
+	}
+	return strconv.AppendFloat(nil, sum, 'f', -1, 64), nil
+}
+
+// value returns the value of node without members or elements.
+func (n *Node) value() interface{} {
+	switch n.Kind {
+	case Object:
+		return make(map[string]interface{})
+	case Array:
+		return make([]interface{}, n.Len)
+	}
+	return json.RawMessage(n.Raw)
+}
+
+func getChild(parent interface{}, seg Segment) (interface{}, error) {
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		if child, ok := p[seg.Key]; ok && seg.Kind == KeySegment {
+			return child, nil
+		}
+	case []interface{}:
+		if seg.Kind == IndexSegment && seg.Index >= 0 && seg.Index < len(p) {
+			return p[seg.Index], nil
+		}
+	}
+	return nil, ErrInvalidNode
+}
+
+func setChild(parent interface{}, seg Segment, child interface{}) error {
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		if seg.Kind == KeySegment {
+			p[seg.Key] = child
+			return nil
+		}
+	case []interface{}:
+		if seg.Kind == IndexSegment && seg.Index >= 0 && seg.Index < len(p) {
+			p[seg.Index] = child
+			return nil
+		}
+	}
+	return ErrInvalidNode
+}
@@ -0,0 +1,103 @@
+package document
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+func TestNode_Encode(t *testing.T) {
+	nodes := []*Node{
+		{Kind: Object},
+		{Kind: Array, Len: 300},
+		{Kind: Scalar, Raw: []byte(`"<KHighness>"`)},
+	}
+	for _, node := range nodes {
+		decoded, err := DecodeNode(node.Encode())
+		assert.Nil(t, err)
+		assert.Equal(t, node, decoded)
+	}
+	_, err := DecodeNode([]byte("x"))
+	assert.Equal(t, ErrInvalidNode, err)
+
+	assert.True(t, (&Node{Kind: Scalar, Raw: []byte("-1.5")}).IsNumber())
+	assert.False(t, (&Node{Kind: Scalar, Raw: []byte(`"1"`)}).IsNumber())
+	assert.False(t, (&Node{Kind: Array}).IsNumber())
+}
+
+func TestParse(t *testing.T) {
+	for _, data := range []string{`{"a":1}`, `[]`, ` "s" `, `1e3`, `null`} {
+		_, err := Parse([]byte(data))
+		assert.Nil(t, err, data)
+	}
+	for _, data := range []string{``, `{`, `{"a":1}}`, `1 2`, `nil`} {
+		_, err := Parse([]byte(data))
+		assert.Equal(t, ErrInvalidJSON, err, data)
+	}
+}
+
+func TestFlattenAndBuild(t *testing.T) {
+	data := `{"name":"KHighness","tags":["<go>",1.50,{"x":null}],"empty":{},"age":18}`
+	value, err := Parse([]byte(data))
+	assert.Nil(t, err)
+
+	var records []Record
+	err = Flatten(RootKey, value, func(subkey []byte, node *Node) error {
+		records = append(records, Record{Subkey: subkey, Node: node})
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 9, len(records))
+	// The records are read from index in order of subkeys.
+	sort.Slice(records, func(i, j int) bool {
+		return string(records[i].Subkey) < string(records[j].Subkey)
+	})
+
+	built, err := Build(RootKey, records)
+	assert.Nil(t, err)
+	encoded, err := Marshal(built)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"age":18,"empty":{},"name":"KHighness","tags":["<go>",1.50,{"x":null}]}`, string(encoded))
+
+	// Build a nested value.
+	tags := ChildKey(RootKey, "tags")
+	var nested []Record
+	for _, record := range records {
+		if len(record.Subkey) >= len(tags) && string(record.Subkey[:len(tags)]) == string(tags) {
+			nested = append(nested, record)
+		}
+	}
+	built, err = Build(tags, nested)
+	assert.Nil(t, err)
+	encoded, err = Marshal(built)
+	assert.Nil(t, err)
+	assert.Equal(t, `["<go>",1.50,{"x":null}]`, string(encoded))
+
+	_, err = Build(tags, records)
+	assert.Equal(t, ErrInvalidNode, err)
+}
+
+func TestAddNumber(t *testing.T) {
+	tests := []struct {
+		number, delta, sum string
+	}{
+		{"1", "2", "3"},
+		{"-1", "0.5", "-0.5"},
+		{"1.5", "1.5", "3"},
+		{"9223372036854775807", "1", "9223372036854776000"},
+		{"1e2", "1", "101"},
+	}
+	for _, tt := range tests {
+		sum, err := AddNumber([]byte(tt.number), []byte(tt.delta))
+		assert.Nil(t, err)
+		assert.Equal(t, tt.sum, string(sum))
+	}
+	_, err := AddNumber([]byte("1.7e308"), []byte("1.7e308"))
+	assert.Equal(t, ErrNumberOverflow, err)
+	_, err = AddNumber([]byte("1"), []byte("x"))
+	assert.Equal(t, ErrInvalidJSON, err)
+}
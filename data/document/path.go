@@ -0,0 +1,219 @@
+package document
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// ErrInvalidPath represents the string is not a valid path.
+var ErrInvalidPath = errors.New("invalid JSON path")
+
+const (
+	rootMark  byte = '$'
+	keyMark   byte = 'k'
+	indexMark byte = 'i'
+	indexSize      = 8
+)
+
+// RootKey is the subkey of the root value of document.
+var RootKey = []byte{rootMark}
+
+// SegmentKind defines the kind of path segment.
+type SegmentKind int8
+
+const (
+	// KeySegment selects the member of object by name.
+	KeySegment SegmentKind = iota
+	// IndexSegment selects the element of array by index, a negative index counts from the end.
+	IndexSegment
+	// WildcardSegment selects all the members of object or all the elements of array.
+	WildcardSegment
+)
+
+// Segment is a step of path.
+type Segment struct {
+	Kind  SegmentKind
+	Key   string
+	Index int
+}
+
+// Path is a parsed path, which is a subset of JSONPath:
+//
+//	$             the root value
+//	.name         the member of object
+//	['name']      the member of object, the name is quoted by single or double quotes
+//	[index]       the element of array, a negative index counts from the end
+//	.* or [*]     all the members of object or all the elements of array
+//
+// The legacy path without the leading "$", like ".a.b" or "a[0]", is also supported, and "."
+// is the root value.
+type Path struct {
+	Segments []Segment
+	// Legacy represents the path is a legacy path, which is expected to match a single value.
+	Legacy bool
+}
+
+// ParsePath parses the string to Path.
+func ParsePath(s string) (*Path, error) {
+	path := &Path{}
+	switch {
+	case strings.HasPrefix(s, "$"):
+		s = s[1:]
+	case s == ".":
+		return &Path{Legacy: true}, nil
+	case s == "":
+		return nil, ErrInvalidPath
+	default:
+		path.Legacy = true
+		if s[0] != '.' && s[0] != '[' {
+			s = "." + s
+		}
+	}
+
+	for len(s) > 0 {
+		var seg Segment
+		var n int
+		var err error
+		switch s[0] {
+		case '.':
+			seg, n, err = parseDotSegment(s)
+		case '[':
+			seg, n, err = parseBracketSegment(s)
+		default:
+			err = ErrInvalidPath
+		}
+		if err != nil {
+			return nil, err
+		}
+		path.Segments = append(path.Segments, seg)
+		s = s[n:]
+	}
+	return path, nil
+}
+
+// IsRoot checks if the path selects the root value only.
+func (p *Path) IsRoot() bool {
+	return len(p.Segments) == 0
+}
+
+// parseDotSegment parses the segment like ".name" or ".*", and returns its length.
+func parseDotSegment(s string) (Segment, int, error) {
+	end := strings.IndexAny(s[1:], ".[")
+	if end < 0 {
+		end = len(s) - 1
+	}
+	name := s[1 : end+1]
+	switch name {
+	case "":
+		return Segment{}, 0, ErrInvalidPath
+	case "*":
+		return Segment{Kind: WildcardSegment}, end + 1, nil
+	}
+	return Segment{Kind: KeySegment, Key: name}, end + 1, nil
+}
+
+// parseBracketSegment parses the segment like "['name']", "[index]" or "[*]", and returns
+// its length.
+func parseBracketSegment(s string) (Segment, int, error) {
+	if len(s) > 1 && (s[1] == '\'' || s[1] == '"') {
+		quote := s[1]
+		var name strings.Builder
+		for i := 2; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				if i+1 == len(s) {
+					return Segment{}, 0, ErrInvalidPath
+				}
+				i++
+				name.WriteByte(s[i])
+			case quote:
+				if i+1 == len(s) || s[i+1] != ']' {
+					return Segment{}, 0, ErrInvalidPath
+				}
+				return Segment{Kind: KeySegment, Key: name.String()}, i + 2, nil
+			default:
+				name.WriteByte(s[i])
+			}
+		}
+		return Segment{}, 0, ErrInvalidPath
+	}
+
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return Segment{}, 0, ErrInvalidPath
+	}
+	if s[1:end] == "*" {
+		return Segment{Kind: WildcardSegment}, end + 1, nil
+	}
+	index, err := strconv.Atoi(s[1:end])
+	if err != nil {
+		return Segment{}, 0, ErrInvalidPath
+	}
+	return Segment{Kind: IndexSegment, Index: index}, end + 1, nil
+}
+
+// ChildKey returns the subkey of the member of the object whose subkey is parent.
+// The subkey of a value is the prefix of the subkeys of all its descendants.
+func ChildKey(parent []byte, name string) []byte {
+	buf := make([]byte, len(parent)+1+binary.MaxVarintLen64+len(name))
+	n := copy(buf, parent)
+	buf[n] = keyMark
+	n++
+	n += binary.PutUvarint(buf[n:], uint64(len(name)))
+	n += copy(buf[n:], name)
+	return buf[:n]
+}
+
+// IndexKey returns the subkey of the element of the array whose subkey is parent.
+// The index is encoded in big endian, so the elements are ordered by their indexes.
+func IndexKey(parent []byte, index int) []byte {
+	buf := make([]byte, len(parent)+1+indexSize)
+	n := copy(buf, parent)
+	buf[n] = indexMark
+	binary.BigEndian.PutUint64(buf[n+1:], uint64(index))
+	return buf
+}
+
+// MemberPrefix returns the common prefix of the subkeys of the members of the object whose
+// subkey is parent.
+func MemberPrefix(parent []byte) []byte {
+	return append(append([]byte{}, parent...), keyMark)
+}
+
+// ChildSegment returns the segment selecting the value at subkey from the value whose subkey
+// is parent, false is returned if it is not a member or an element of the value.
+func ChildSegment(parent, subkey []byte) (Segment, bool) {
+	if len(subkey) <= len(parent) || string(subkey[:len(parent)]) != string(parent) {
+		return Segment{}, false
+	}
+	seg, n, err := decodeSegment(subkey[len(parent):])
+	return seg, err == nil && n == len(subkey)-len(parent)
+}
+
+// decodeSegment decodes the first segment of the encoded segments, and returns its length.
+func decodeSegment(buf []byte) (Segment, int, error) {
+	if len(buf) == 0 {
+		return Segment{}, 0, ErrInvalidNode
+	}
+	switch buf[0] {
+	case keyMark:
+		size, n := binary.Uvarint(buf[1:])
+		if n <= 0 || uint64(len(buf)-1-n) < size {
+			return Segment{}, 0, ErrInvalidNode
+		}
+		end := 1 + n + int(size)
+		return Segment{Kind: KeySegment, Key: string(buf[1+n : end])}, end, nil
+	case indexMark:
+		if len(buf) < 1+indexSize {
+			return Segment{}, 0, ErrInvalidNode
+		}
+		index := binary.BigEndian.Uint64(buf[1:])
+		return Segment{Kind: IndexSegment, Index: int(index)}, 1 + indexSize, nil
+	}
+	return Segment{}, 0, ErrInvalidNode
+}
@@ -0,0 +1,66 @@
+package document
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		s      string
+		legacy bool
+		segs   []Segment
+	}{
+		{"$", false, nil},
+		{".", true, nil},
+		{"$.a.b", false, []Segment{{Kind: KeySegment, Key: "a"}, {Kind: KeySegment, Key: "b"}}},
+		{"a.b", true, []Segment{{Kind: KeySegment, Key: "a"}, {Kind: KeySegment, Key: "b"}}},
+		{".a[0]", true, []Segment{{Kind: KeySegment, Key: "a"}, {Kind: IndexSegment}}},
+		{"[-1]", true, []Segment{{Kind: IndexSegment, Index: -1}}},
+		{"$['a.b'][\"c\\\"d\"]", false, []Segment{{Kind: KeySegment, Key: "a.b"}, {Kind: KeySegment, Key: "c\"d"}}},
+		{"$.*[*]", false, []Segment{{Kind: WildcardSegment}, {Kind: WildcardSegment}}},
+	}
+	for _, tt := range tests {
+		path, err := ParsePath(tt.s)
+		assert.Nil(t, err, tt.s)
+		assert.Equal(t, tt.legacy, path.Legacy, tt.s)
+		assert.Equal(t, tt.segs, path.Segments, tt.s)
+	}
+
+	for _, s := range []string{"", "$.", "$..a", "$[", "$[a]", "$['a'", "$['a'x]", "$a"} {
+		_, err := ParsePath(s)
+		assert.Equal(t, ErrInvalidPath, err, s)
+	}
+}
+
+func TestChildKey(t *testing.T) {
+	a := ChildKey(RootKey, "a")
+	ab := ChildKey(a, "b")
+	a0 := IndexKey(a, 0)
+	seg, ok := ChildSegment(RootKey, a)
+	assert.True(t, ok)
+	assert.Equal(t, Segment{Kind: KeySegment, Key: "a"}, seg)
+	seg, ok = ChildSegment(a, a0)
+	assert.True(t, ok)
+	assert.Equal(t, Segment{Kind: IndexSegment}, seg)
+	_, ok = ChildSegment(a, ab)
+	assert.True(t, ok)
+	for _, subkey := range [][]byte{ab, a} {
+		_, ok = ChildSegment(RootKey, subkey[:len(subkey)-1])
+		assert.False(t, ok)
+	}
+	_, ok = ChildSegment(RootKey, ab)
+	assert.False(t, ok)
+	_, ok = ChildSegment(a, a)
+	assert.False(t, ok)
+	_, ok = ChildSegment(ChildKey(RootKey, "ab"), ab)
+	assert.False(t, ok)
+	assert.Equal(t, string(MemberPrefix(a)), string(ab[:len(a)+1]))
+
+	// The elements are ordered by their indexes.
+	assert.True(t, string(IndexKey(a, 2)) < string(IndexKey(a, 256)))
+}
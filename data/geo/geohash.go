@@ -0,0 +1,297 @@
+package geo
+
+import (
+	"errors"
+	"math"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// The locations are indexed by 52-bit geohash like Redis, which interleaves 26 bits of longitude
+// and 26 bits of latitude, the longitude bit comes first. The latitude is limited to the range of
+// EPSG:3857 (Web Mercator), so the geohash can be stored as the score of sorted set without loss.
+
+const (
+	// MinLongitude is the min longitude.
+	MinLongitude = -180.0
+	// MaxLongitude is the max longitude.
+	MaxLongitude = 180.0
+	// MinLatitude is the min latitude, limited by EPSG:3857.
+	MinLatitude = -85.05112878
+	// MaxLatitude is the max latitude, limited by EPSG:3857.
+	MaxLatitude = 85.05112878
+
+	// Step is the number of bits of longitude or latitude in geohash.
+	Step = 26
+
+	// earthRadius is the radius of earth in meters, which is the same as Redis.
+	earthRadius = 6372797.560856
+	// mercatorMax is the half length of the equator in meters in EPSG:3857.
+	mercatorMax = 20037726.37
+
+	// standardMinLatitude and standardMaxLatitude are the latitude range of standard geohash.
+	standardMinLatitude = -90.0
+	standardMaxLatitude = 90.0
+
+	base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+)
+
+// ErrInvalidCoordinates represents the longitude or latitude is out of range.
+var ErrInvalidCoordinates = errors.New("invalid longitude,latitude pair")
+
+// Area is the rectangle area covered by a geohash.
+type Area struct {
+	MinLongitude, MaxLongitude float64
+	MinLatitude, MaxLatitude   float64
+}
+
+// Encode returns the 52-bit geohash of the location.
+func Encode(longitude, latitude float64) (uint64, error) {
+	if longitude < MinLongitude || longitude > MaxLongitude ||
+		latitude < MinLatitude || latitude > MaxLatitude {
+		return 0, ErrInvalidCoordinates
+	}
+	return encode(longitude, latitude, MinLatitude, MaxLatitude, Step), nil
+}
+
+// Decode returns the location at the center of the area of the 52-bit geohash.
+func Decode(hash uint64) (longitude, latitude float64) {
+	area := decode(hash, MinLatitude, MaxLatitude, Step)
+	longitude = math.Max(MinLongitude, math.Min(MaxLongitude, (area.MinLongitude+area.MaxLongitude)/2))
+	latitude = math.Max(MinLatitude, math.Min(MaxLatitude, (area.MinLatitude+area.MaxLatitude)/2))
+	return
+}
+
+// String returns the standard 11 characters geohash string of the 52-bit geohash, which can be
+// used by other geohash libraries.
+func String(hash uint64) string {
+	longitude, latitude := Decode(hash)
+	standard := encode(longitude, latitude, standardMinLatitude, standardMaxLatitude, Step)
+	buf := make([]byte, 11)
+	for i := range buf {
+		// The last character is padded since there are only 52 bits.
+		var idx uint64
+		if i < 10 {
+			idx = (standard >> (52 - uint(i+1)*5)) & 0x1f
+		}
+		buf[i] = base32[idx]
+	}
+	return string(buf)
+}
+
+// Distance returns the distance in meters between two locations on earth by haversine formula.
+func Distance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lat2r := degToRad(lat1), degToRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((degToRad(lon2) - degToRad(lon1)) / 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+// InRadius checks if the location is in the circle, and returns its distance to the center.
+func InRadius(centerLon, centerLat, radius, lon, lat float64) (float64, bool) {
+	distance := Distance(centerLon, centerLat, lon, lat)
+	return distance, distance <= radius
+}
+
+// InBox checks if the location is in the box whose center is given, and returns its distance
+// to the center. The box is measured on the surface of earth.
+func InBox(centerLon, centerLat, width, height, lon, lat float64) (float64, bool) {
+	// The latitude distance is cheaper, so it is checked first.
+	if earthRadius*math.Abs(degToRad(lat)-degToRad(centerLat)) > height/2 {
+		return 0, false
+	}
+	if Distance(centerLon, lat, lon, lat) > width/2 {
+		return 0, false
+	}
+	return Distance(centerLon, centerLat, lon, lat), true
+}
+
+// SearchRanges returns the ranges of 52-bit geohash to be searched for the locations in the
+// circle or the box whose center is given. The box is used if radius is 0. Each range is
+// [min, max), the locations in the ranges should be checked by InRadius or InBox.
+func SearchRanges(centerLon, centerLat, radius, width, height float64) [][2]uint64 {
+	halfWidth, halfHeight := radius, radius
+	if radius == 0 {
+		halfWidth, halfHeight = width/2, height/2
+		radius = math.Sqrt(halfWidth*halfWidth + halfHeight*halfHeight)
+	}
+	bounds := boundingBox(centerLon, centerLat, halfWidth, halfHeight)
+
+	// The center area and its 8 neighbors must cover the bounding box, otherwise the step
+	// is decreased, which happens when the center is near an edge of its area.
+	step := estimateStep(radius, centerLat)
+	var x, y uint64
+	for ; ; step-- {
+		hash := encode(centerLon, centerLat, MinLatitude, MaxLatitude, step)
+		x, y = deinterleave(hash)
+		if step == 1 || covers(x, y, step, bounds) {
+			break
+		}
+	}
+
+	shift := uint(2 * (Step - step))
+	var ranges [][2]uint64
+	seen := make(map[uint64]bool)
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			hash := interleave(move(x, dx, step), move(y, dy, step))
+			if seen[hash] {
+				continue
+			}
+			seen[hash] = true
+			ranges = append(ranges, [2]uint64{hash << shift, (hash + 1) << shift})
+		}
+	}
+	return ranges
+}
+
+// encode returns the geohash of the location with step bits of longitude and latitude.
+func encode(longitude, latitude, minLatitude, maxLatitude float64, step uint) uint64 {
+	scale := float64(uint64(1) << step)
+	x := uint64((longitude - MinLongitude) / (MaxLongitude - MinLongitude) * scale)
+	y := uint64((latitude - minLatitude) / (maxLatitude - minLatitude) * scale)
+	// The max longitude or latitude falls into the last area.
+	if x >= 1<<step {
+		x = 1<<step - 1
+	}
+	if y >= 1<<step {
+		y = 1<<step - 1
+	}
+	return interleave(x, y)
+}
+
+// decode returns the area of the geohash with step bits of longitude and latitude.
+func decode(hash uint64, minLatitude, maxLatitude float64, step uint) Area {
+	x, y := deinterleave(hash)
+	scale := float64(uint64(1) << step)
+	lonUnit, latUnit := (MaxLongitude-MinLongitude)/scale, (maxLatitude-minLatitude)/scale
+	return Area{
+		MinLongitude: MinLongitude + float64(x)*lonUnit,
+		MaxLongitude: MinLongitude + float64(x+1)*lonUnit,
+		MinLatitude:  minLatitude + float64(y)*latUnit,
+		MaxLatitude:  minLatitude + float64(y+1)*latUnit,
+	}
+}
+
+// interleave interleaves the bits of x and y, the bit of x comes first.
+func interleave(x, y uint64) uint64 {
+	return spread(x)<<1 | spread(y)
+}
+
+// deinterleave is the reverse of interleave.
+func deinterleave(hash uint64) (x, y uint64) {
+	return squash(hash >> 1), squash(hash)
+}
+
+// spread spreads the lower 32 bits of v to the even bits.
+func spread(v uint64) uint64 {
+	v &= 0xffffffff
+	v = (v | v<<16) & 0x0000ffff0000ffff
+	v = (v | v<<8) & 0x00ff00ff00ff00ff
+	v = (v | v<<4) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v<<2) & 0x3333333333333333
+	v = (v | v<<1) & 0x5555555555555555
+	return v
+}
+
+// squash is the reverse of spread.
+func squash(v uint64) uint64 {
+	v &= 0x5555555555555555
+	v = (v | v>>1) & 0x3333333333333333
+	v = (v | v>>2) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v>>4) & 0x00ff00ff00ff00ff
+	v = (v | v>>8) & 0x0000ffff0000ffff
+	v = (v | v>>16) & 0x00000000ffffffff
+	return v
+}
+
+// move moves the coordinate of area by delta, which wraps around.
+func move(v uint64, delta int, step uint) uint64 {
+	return uint64(int64(v)+int64(delta)) & (1<<step - 1)
+}
+
+// estimateStep estimates the step of geohash, whose area is about the size of the radius.
+func estimateStep(radius, latitude float64) uint {
+	if radius == 0 {
+		return Step
+	}
+	step := 1
+	for r := radius; r < mercatorMax; r *= 2 {
+		step++
+	}
+	// The areas get narrower near the poles.
+	step -= 2
+	if latitude > 66 || latitude < -66 {
+		step--
+		if latitude > 80 || latitude < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > Step {
+		step = Step
+	}
+	return uint(step)
+}
+
+// boundingBox returns the area which contains the box whose center is given.
+func boundingBox(longitude, latitude, halfWidth, halfHeight float64) Area {
+	latDelta := radToDeg(halfHeight / earthRadius)
+	minLat, maxLat := latitude-latDelta, latitude+latDelta
+	// The longitude delta is larger at the latitude nearer the pole.
+	lonDelta := math.Max(
+		radToDeg(halfWidth/earthRadius/math.Cos(degToRad(minLat))),
+		radToDeg(halfWidth/earthRadius/math.Cos(degToRad(maxLat))),
+	)
+	// All the longitudes are covered if the box reaches a pole.
+	if maxLat >= standardMaxLatitude || minLat <= standardMinLatitude || lonDelta >= MaxLongitude {
+		return Area{MinLongitude: MinLongitude, MaxLongitude: MaxLongitude, MinLatitude: minLat, MaxLatitude: maxLat}
+	}
+	return Area{
+		MinLongitude: longitude - lonDelta,
+		MaxLongitude: longitude + lonDelta,
+		MinLatitude:  minLat,
+		MaxLatitude:  maxLat,
+	}
+}
+
+// covers checks if the area at (x, y) and its neighbors cover the bounds. The neighbors across
+// the antimeridian are wrapped around, and nothing is beyond the latitude range.
+func covers(x, y uint64, step uint, bounds Area) bool {
+	last := uint64(1)<<step - 1
+	west := decode(interleave(move(x, -1, step), y), MinLatitude, MaxLatitude, step)
+	east := decode(interleave(move(x, 1, step), y), MinLatitude, MaxLatitude, step)
+	if x == 0 {
+		west.MinLongitude -= MaxLongitude - MinLongitude
+	}
+	if x == last {
+		east.MaxLongitude += MaxLongitude - MinLongitude
+	}
+	if west.MinLongitude > bounds.MinLongitude || east.MaxLongitude < bounds.MaxLongitude {
+		return false
+	}
+	if y > 0 {
+		south := decode(interleave(x, move(y, -1, step)), MinLatitude, MaxLatitude, step)
+		if south.MinLatitude > bounds.MinLatitude {
+			return false
+		}
+	}
+	if y < last {
+		north := decode(interleave(x, move(y, 1, step)), MinLatitude, MaxLatitude, step)
+		if north.MaxLatitude < bounds.MaxLatitude {
+			return false
+		}
+	}
+	return true
+}
+
+func degToRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radToDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
@@ -0,0 +1,100 @@
+package geo
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+func TestEncode(t *testing.T) {
+	// The geohash of Palermo in Redis.
+	hash, err := Encode(13.361389, 38.115556)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3479099956230698), hash)
+
+	lon, lat := Decode(hash)
+	assert.InDelta(t, 13.361389, lon, 1e-5)
+	assert.InDelta(t, 38.115556, lat, 1e-5)
+
+	for _, loc := range [][2]float64{{-180, 0}, {180, 0}, {0, MinLatitude}, {0, MaxLatitude}} {
+		hash, err = Encode(loc[0], loc[1])
+		assert.Nil(t, err)
+		lon, lat = Decode(hash)
+		assert.InDelta(t, loc[0], lon, 1e-5)
+		assert.InDelta(t, loc[1], lat, 1e-5)
+	}
+	for _, loc := range [][2]float64{{-180.1, 0}, {180.1, 0}, {0, 85.06}, {0, -85.06}} {
+		_, err = Encode(loc[0], loc[1])
+		assert.Equal(t, ErrInvalidCoordinates, err)
+	}
+}
+
+func TestString(t *testing.T) {
+	palermo, _ := Encode(13.361389, 38.115556)
+	catania, _ := Encode(15.087269, 37.502669)
+	assert.Equal(t, "sqc8b49rny0", String(palermo))
+	assert.Equal(t, "sqdtr74hyu0", String(catania))
+}
+
+func TestDistance(t *testing.T) {
+	palermo, _ := Encode(13.361389, 38.115556)
+	catania, _ := Encode(15.087269, 37.502669)
+	lon1, lat1 := Decode(palermo)
+	lon2, lat2 := Decode(catania)
+	assert.InDelta(t, 166274.1516, Distance(lon1, lat1, lon2, lat2), 1e-4)
+	assert.Equal(t, 0.0, Distance(lon1, lat1, lon1, lat1))
+
+	distance, ok := InRadius(15, 37, 200000, lon1, lat1)
+	assert.True(t, ok)
+	assert.InDelta(t, 190442.4, distance, 0.1)
+	_, ok = InRadius(15, 37, 100000, lon1, lat1)
+	assert.False(t, ok)
+
+	_, ok = InBox(15, 37, 400000, 400000, lon1, lat1)
+	assert.True(t, ok)
+	_, ok = InBox(15, 37, 250000, 400000, lon1, lat1)
+	assert.False(t, ok)
+}
+
+func TestSearchRanges(t *testing.T) {
+	// Every location in the shape must be in one of the ranges.
+	r := rand.New(rand.NewSource(1))
+	randLocation := func() (float64, float64) {
+		return r.Float64()*360 - 180, r.Float64()*(MaxLatitude-MinLatitude) + MinLatitude
+	}
+	hashes := make([]uint64, 20000)
+	for i := range hashes {
+		hashes[i], _ = Encode(randLocation())
+	}
+
+	for i := 0; i < 200; i++ {
+		lon, lat := randLocation()
+		radius := math.Pow(10, r.Float64()*7)
+		width, height := radius*2*r.Float64(), radius*2*r.Float64()
+		circle := SearchRanges(lon, lat, radius, 0, 0)
+		box := SearchRanges(lon, lat, 0, width, height)
+		for _, hash := range hashes {
+			lon2, lat2 := Decode(hash)
+			if _, ok := InRadius(lon, lat, radius, lon2, lat2); ok {
+				assert.True(t, inRanges(circle, hash), "circle (%v, %v, %v) misses (%v, %v)", lon, lat, radius, lon2, lat2)
+			}
+			if _, ok := InBox(lon, lat, width, height, lon2, lat2); ok {
+				assert.True(t, inRanges(box, hash), "box (%v, %v, %v, %v) misses (%v, %v)", lon, lat, width, height, lon2, lat2)
+			}
+		}
+	}
+}
+
+func inRanges(ranges [][2]uint64, hash uint64) bool {
+	for _, r := range ranges {
+		if hash >= r[0] && hash < r[1] {
+			return true
+		}
+	}
+	return false
+}
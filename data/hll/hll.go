@@ -0,0 +1,252 @@
+package hll
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+
+	"github.com/Khighness/khighdb/util"
+	"github.com/spaolacci/murmur3"
+)
+
+// @Author KHighness
+// @Update 2023-01-25
+
+// HyperLogLog estimates the cardinality of a set with 2^14 registers, the standard error is 0.81%.
+// It is encoded in a string value, which looks like:
+//	+-----------+-----------+-----------+-----------+
+//	|   magic   | encoding  |  unused   | registers |
+//	+-----------+-----------+-----------+-----------+
+//	|  4 bytes  |  1 byte   |  3 bytes  |   bytes   |
+//	+-----------+-----------+-----------+-----------+
+// The registers are encoded in sparse or dense representation. The sparse representation holds
+// only the non-zero registers, each takes 3 bytes: the 2 bytes big endian index and the value,
+// which are ordered by index. The dense representation holds all the registers, each takes 6 bits
+// and they are numbered like a bitmap. A HyperLogLog starts in the sparse representation and is
+// converted to the dense one once the sparse representation gets larger than maxSparseSize.
+
+const (
+	precision     = 14
+	registerNum   = 1 << precision
+	registerBits  = 6
+	headerSize    = 8
+	denseSize     = headerSize + registerNum*registerBits/8
+	sparseEntry   = 3
+	maxSparseSize = 3000
+
+	// hashBits is the number of hash bits used to count the trailing zeros.
+	hashBits = 64 - precision
+)
+
+// Encodings of HyperLogLog.
+const (
+	sparse byte = iota
+	dense
+)
+
+var magic = []byte("HYLL")
+
+// ErrInvalidHyperLogLog represents the string value is not a valid HyperLogLog.
+var ErrInvalidHyperLogLog = errors.New("value is not a valid hyperloglog")
+
+// HyperLogLog defines the structure of HyperLogLog.
+type HyperLogLog struct {
+	buf []byte
+}
+
+// New creates an empty HyperLogLog in the sparse representation.
+func New() *HyperLogLog {
+	buf := make([]byte, headerSize)
+	copy(buf, magic)
+	buf[4] = sparse
+	return &HyperLogLog{buf: buf}
+}
+
+// Load creates a HyperLogLog from the string value, which is copied.
+func Load(val []byte) (*HyperLogLog, error) {
+	if len(val) < headerSize || !bytes.Equal(val[:4], magic) {
+		return nil, ErrInvalidHyperLogLog
+	}
+	switch val[4] {
+	case sparse:
+		if (len(val)-headerSize)%sparseEntry != 0 {
+			return nil, ErrInvalidHyperLogLog
+		}
+	case dense:
+		if len(val) != denseSize {
+			return nil, ErrInvalidHyperLogLog
+		}
+	default:
+		return nil, ErrInvalidHyperLogLog
+	}
+	return &HyperLogLog{buf: append([]byte(nil), val...)}, nil
+}
+
+// Bytes returns the encoded string value of the HyperLogLog.
+func (h *HyperLogLog) Bytes() []byte {
+	return h.buf
+}
+
+// IsDense checks if the HyperLogLog is in the dense representation.
+func (h *HyperLogLog) IsDense() bool {
+	return h.buf[4] == dense
+}
+
+// Add adds the element to the HyperLogLog, and returns true if any register is updated.
+func (h *HyperLogLog) Add(element []byte) bool {
+	hash := murmur3.Sum64(element)
+	index := int(hash & (registerNum - 1))
+	// The bit beyond hashBits makes sure the count is not greater than hashBits+1.
+	count := uint8(bits.TrailingZeros64(hash>>precision|1<<hashBits)) + 1
+	return h.set(index, count)
+}
+
+// Merge merges the other HyperLogLog into the HyperLogLog, the max value of each register is
+// taken. The HyperLogLog is converted to the dense representation.
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	h.toDense()
+	other.forEach(func(index int, value uint8) {
+		h.set(index, value)
+	})
+}
+
+// Count returns the estimated cardinality of the HyperLogLog, by the improved estimator of
+// "New cardinality estimation algorithms for HyperLogLog sketches" by Otmar Ertl.
+func (h *HyperLogLog) Count() uint64 {
+	var histogram [hashBits + 2]int
+	nonZero := 0
+	h.forEach(func(_ int, value uint8) {
+		histogram[value]++
+		nonZero++
+	})
+	histogram[0] = registerNum - nonZero
+
+	m := float64(registerNum)
+	z := m * tau((m-float64(histogram[hashBits+1]))/m)
+	for j := hashBits; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+	return uint64(math.Round(0.5 / math.Ln2 * m * m / z))
+}
+
+// set sets the register at index to value if value is greater, and returns true if it is set.
+func (h *HyperLogLog) set(index int, value uint8) bool {
+	if h.IsDense() {
+		offset := uint64(index) * registerBits
+		if uint8(util.GetBits(h.buf[headerSize:], offset, registerBits)) >= value {
+			return false
+		}
+		util.SetBits(h.buf[headerSize:], offset, registerBits, uint64(value))
+		return true
+	}
+
+	entries := h.buf[headerSize:]
+	i, found := h.searchSparse(index)
+	at := i * sparseEntry
+	if found {
+		if entries[at+2] >= value {
+			return false
+		}
+		entries[at+2] = value
+		return true
+	}
+	if len(h.buf)+sparseEntry > maxSparseSize {
+		h.toDense()
+		return h.set(index, value)
+	}
+	entry := []byte{byte(index >> 8), byte(index), value}
+	buf := make([]byte, 0, len(h.buf)+sparseEntry)
+	buf = append(buf, h.buf[:headerSize+at]...)
+	buf = append(buf, entry...)
+	h.buf = append(buf, h.buf[headerSize+at:]...)
+	return true
+}
+
+// searchSparse returns the position of the sparse entry at index, or the position where it
+// should be inserted if it is not found.
+func (h *HyperLogLog) searchSparse(index int) (int, bool) {
+	entries := h.buf[headerSize:]
+	lo, hi := 0, len(entries)/sparseEntry
+	for lo < hi {
+		mid := (lo + hi) / 2
+		i := int(binary.BigEndian.Uint16(entries[mid*sparseEntry:]))
+		if i == index {
+			return mid, true
+		}
+		if i < index {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, false
+}
+
+// forEach calls fn for each non-zero register.
+func (h *HyperLogLog) forEach(fn func(index int, value uint8)) {
+	if h.IsDense() {
+		for i := 0; i < registerNum; i++ {
+			value := uint8(util.GetBits(h.buf[headerSize:], uint64(i)*registerBits, registerBits))
+			if value != 0 {
+				fn(i, value)
+			}
+		}
+		return
+	}
+	entries := h.buf[headerSize:]
+	for at := 0; at < len(entries); at += sparseEntry {
+		fn(int(binary.BigEndian.Uint16(entries[at:])), entries[at+2])
+	}
+}
+
+// toDense converts the HyperLogLog to the dense representation.
+func (h *HyperLogLog) toDense() {
+	if h.IsDense() {
+		return
+	}
+	buf := make([]byte, denseSize)
+	copy(buf, h.buf[:headerSize])
+	buf[4] = dense
+	h.forEach(func(index int, value uint8) {
+		util.SetBits(buf[headerSize:], uint64(index)*registerBits, registerBits, uint64(value))
+	})
+	h.buf = buf
+}
+
+// sigma is the function of the estimator for the registers of value 0.
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if prev == z {
+			return z
+		}
+	}
+}
+
+// tau is the function of the estimator for the registers of value hashBits+1.
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if prev == z {
+			return z / 3
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package hll
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-25
+
+func TestHyperLogLog_Add(t *testing.T) {
+	h := New()
+	assert.Equal(t, uint64(0), h.Count())
+	assert.True(t, h.Add([]byte("a")))
+	assert.False(t, h.Add([]byte("a")))
+	assert.True(t, h.Add([]byte("b")))
+	assert.Equal(t, uint64(2), h.Count())
+	assert.False(t, h.IsDense())
+
+	// The sparse representation is converted to the dense one when it gets large.
+	for i := 0; i < 2000; i++ {
+		h.Add([]byte(strconv.Itoa(i)))
+	}
+	assert.True(t, h.IsDense())
+	assert.Equal(t, denseSize, len(h.Bytes()))
+	assertCount(t, 2002, h.Count())
+}
+
+func TestHyperLogLog_Count(t *testing.T) {
+	for _, n := range []int{10, 100, 1000, 10000, 100000, 1000000} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			h := New()
+			for i := 0; i < n; i++ {
+				h.Add([]byte("element-" + strconv.Itoa(i)))
+			}
+			assertCount(t, n, h.Count())
+		})
+	}
+}
+
+func TestHyperLogLog_Merge(t *testing.T) {
+	h1, h2 := New(), New()
+	for i := 0; i < 3000; i++ {
+		h1.Add([]byte(strconv.Itoa(i)))
+	}
+	for i := 2000; i < 5000; i++ {
+		h2.Add([]byte(strconv.Itoa(i)))
+	}
+	h1.Merge(h2)
+	assert.True(t, h1.IsDense())
+	assertCount(t, 5000, h1.Count())
+
+	// The sparse HyperLogLog is merged into the dense one.
+	h3 := New()
+	h3.Add([]byte("a"))
+	h4 := New()
+	h4.Merge(h3)
+	assert.True(t, h4.IsDense())
+	assert.Equal(t, uint64(1), h4.Count())
+}
+
+func TestLoad(t *testing.T) {
+	h := New()
+	h.Add([]byte("a"))
+	loaded, err := Load(h.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, h.Bytes(), loaded.Bytes())
+	assert.Equal(t, uint64(1), loaded.Count())
+
+	for _, val := range [][]byte{nil, []byte("value"), []byte("HYLL\x00\x00\x00\x00\x01"),
+		[]byte("HYLL\x01\x00\x00\x00\x01"), []byte("HYLL\x02\x00\x00\x00")} {
+		_, err = Load(val)
+		assert.Equal(t, ErrInvalidHyperLogLog, err)
+	}
+}
+
+func assertCount(t *testing.T, expected int, count uint64) {
+	// The standard error is 0.81%, so the error should be less than 3%.
+	assert.True(t, math.Abs(float64(count)-float64(expected)) <= float64(expected)*0.03,
+		"expected %d, got %d", expected, count)
+}
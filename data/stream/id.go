@@ -0,0 +1,180 @@
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// IDSize is the size of the encoded ID.
+const IDSize = 16
+
+var (
+	// ErrInvalidID represents the string is not a valid stream ID.
+	ErrInvalidID = errors.New("invalid stream ID")
+	// ErrIDTooSmall represents the ID of the new entry is not greater than the last ID.
+	ErrIDTooSmall = errors.New("the ID is equal or smaller than the last ID")
+	// ErrIDExhausted represents no ID can be generated after the last ID.
+	ErrIDExhausted = errors.New("stream ID exhausted")
+)
+
+var (
+	// MinID is the smallest ID.
+	MinID = ID{}
+	// MaxID is the largest ID.
+	MaxID = ID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+)
+
+// ID is the ID of stream entry, which consists of a milliseconds timestamp and a sequence
+// number of the entries added in the same millisecond.
+type ID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// ParseID parses the string like "<ms>-<seq>" to ID, the sequence number is set to missingSeq
+// if it is omitted.
+func ParseID(s string, missingSeq uint64) (ID, error) {
+	msStr, seqStr := s, ""
+	hasSeq := false
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		msStr, seqStr, hasSeq = s[:i], s[i+1:], true
+	}
+	ms, err := strconv.ParseUint(msStr, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	seq := missingSeq
+	if hasSeq {
+		if seq, err = strconv.ParseUint(seqStr, 10, 64); err != nil {
+			return ID{}, ErrInvalidID
+		}
+	}
+	return ID{Ms: ms, Seq: seq}, nil
+}
+
+// ParseRangeID parses the start or end of a range, "-" and "+" are the smallest and largest ID.
+// The ID prefixed by "(" is exclusive. The omitted sequence number is 0 for start and the max
+// sequence number for end.
+func ParseRangeID(s string, isEnd bool) (ID, error) {
+	switch s {
+	case "-":
+		return MinID, nil
+	case "+":
+		return MaxID, nil
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+	var missingSeq uint64
+	if isEnd {
+		missingSeq = math.MaxUint64
+	}
+	id, err := ParseID(s, missingSeq)
+	if err != nil || !exclusive {
+		return id, err
+	}
+	var ok bool
+	if isEnd {
+		id, ok = id.Prev()
+	} else {
+		id, ok = id.Next()
+	}
+	if !ok {
+		return ID{}, ErrInvalidID
+	}
+	return id, nil
+}
+
+// DecodeID decodes the ID encoded by Bytes.
+func DecodeID(buf []byte) (ID, error) {
+	if len(buf) != IDSize {
+		return ID{}, ErrInvalidID
+	}
+	return ID{Ms: binary.BigEndian.Uint64(buf), Seq: binary.BigEndian.Uint64(buf[8:])}, nil
+}
+
+// Bytes encodes the ID in big endian, so the encoded IDs are ordered as the IDs.
+func (id ID) Bytes() []byte {
+	buf := make([]byte, IDSize)
+	binary.BigEndian.PutUint64(buf, id.Ms)
+	binary.BigEndian.PutUint64(buf[8:], id.Seq)
+	return buf
+}
+
+// String returns the string like "<ms>-<seq>".
+func (id ID) String() string {
+	return fmt.Sprintf("%d-%d", id.Ms, id.Seq)
+}
+
+// Compare returns -1, 0 or 1 if the ID is less than, equal to or greater than other.
+func (id ID) Compare(other ID) int {
+	switch {
+	case id.Ms < other.Ms:
+		return -1
+	case id.Ms > other.Ms:
+		return 1
+	case id.Seq < other.Seq:
+		return -1
+	case id.Seq > other.Seq:
+		return 1
+	}
+	return 0
+}
+
+// Less checks if the ID is less than other.
+func (id ID) Less(other ID) bool {
+	return id.Compare(other) < 0
+}
+
+// Next returns the smallest ID greater than the ID, false is returned if it is MaxID.
+func (id ID) Next() (ID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return ID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return ID{Ms: id.Ms + 1}, true
+	}
+	return ID{}, false
+}
+
+// Prev returns the largest ID less than the ID, false is returned if it is MinID.
+func (id ID) Prev() (ID, bool) {
+	switch {
+	case id.Seq > 0:
+		return ID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	case id.Ms > 0:
+		return ID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return ID{}, false
+}
+
+// NextID generates the ID of the new entry added after lastID at the time now in milliseconds.
+// If ms is not nil, it is the milliseconds part of the ID given by user and only the sequence
+// number is generated.
+func NextID(lastID ID, now uint64, ms *uint64) (ID, error) {
+	if ms != nil {
+		switch {
+		case *ms > lastID.Ms:
+			return ID{Ms: *ms}, nil
+		case *ms < lastID.Ms || lastID.Seq == math.MaxUint64:
+			return ID{}, ErrIDTooSmall
+		}
+		return ID{Ms: *ms, Seq: lastID.Seq + 1}, nil
+	}
+	if now > lastID.Ms {
+		return ID{Ms: now}, nil
+	}
+	id, ok := lastID.Next()
+	if !ok {
+		return ID{}, ErrIDExhausted
+	}
+	return id, nil
+}
@@ -0,0 +1,280 @@
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// ErrInvalidEncoding represents the encoded fields or pending entry is corrupted.
+var ErrInvalidEncoding = errors.New("invalid stream encoding")
+
+type (
+	// Stream defines the structure of stream, which holds the IDs of its entries in order,
+	// while the fields of the entries are stored in the index tree of the stream.
+	Stream struct {
+		ids []ID
+		// LastID is the largest ID ever added, which makes the IDs increase after the entries
+		// of the largest IDs are deleted.
+		LastID ID
+		Groups map[string]*Group
+	}
+
+	// Group defines the structure of consumer group.
+	Group struct {
+		// LastID is the ID of the last entry delivered to the consumers of the group.
+		LastID    ID
+		Consumers map[string]*Consumer
+		// Pending is the pending entries list (PEL) of the group, which holds the entries
+		// delivered but not acknowledged yet.
+		Pending map[ID]*PendingEntry
+	}
+
+	// Consumer defines the structure of consumer in a consumer group.
+	Consumer struct {
+		// SeenTime is the last time in milliseconds the consumer interacted with the group.
+		SeenTime int64
+	}
+
+	// PendingEntry defines the structure of the entry in the pending entries list.
+	PendingEntry struct {
+		Consumer      string
+		DeliveryTime  int64
+		DeliveryCount int64
+	}
+)
+
+// New creates a new empty stream.
+func New() *Stream {
+	return &Stream{Groups: make(map[string]*Group)}
+}
+
+// NewGroup creates a new consumer group which delivers the entries after lastID.
+func NewGroup(lastID ID) *Group {
+	return &Group{
+		LastID:    lastID,
+		Consumers: make(map[string]*Consumer),
+		Pending:   make(map[ID]*PendingEntry),
+	}
+}
+
+// Len returns the number of entries in the stream.
+func (s *Stream) Len() int {
+	return len(s.ids)
+}
+
+// First returns the smallest ID in the stream, false is returned if the stream is empty.
+func (s *Stream) First() (ID, bool) {
+	if len(s.ids) == 0 {
+		return ID{}, false
+	}
+	return s.ids[0], true
+}
+
+// Last returns the largest ID in the stream, false is returned if the stream is empty.
+func (s *Stream) Last() (ID, bool) {
+	if len(s.ids) == 0 {
+		return ID{}, false
+	}
+	return s.ids[len(s.ids)-1], true
+}
+
+// Insert inserts the ID into the stream and updates LastID. The ID is usually the largest one,
+// but it may be not when the stream is loaded from log files.
+func (s *Stream) Insert(id ID) {
+	if s.LastID.Less(id) {
+		s.LastID = id
+	}
+	if n := len(s.ids); n == 0 || s.ids[n-1].Less(id) {
+		s.ids = append(s.ids, id)
+		return
+	}
+	i := s.search(id)
+	if i < len(s.ids) && s.ids[i] == id {
+		return
+	}
+	s.ids = append(s.ids, ID{})
+	copy(s.ids[i+1:], s.ids[i:])
+	s.ids[i] = id
+}
+
+// Remove removes the ID from the stream, and returns false if it does not exist.
+func (s *Stream) Remove(id ID) bool {
+	i := s.search(id)
+	if i == len(s.ids) || s.ids[i] != id {
+		return false
+	}
+	s.ids = append(s.ids[:i], s.ids[i+1:]...)
+	return true
+}
+
+// Contains checks if the ID exists in the stream.
+func (s *Stream) Contains(id ID) bool {
+	i := s.search(id)
+	return i < len(s.ids) && s.ids[i] == id
+}
+
+// Range returns the IDs between start and end inclusively, in descending order if reverse is
+// true. At most count IDs are returned if count is positive.
+func (s *Stream) Range(start, end ID, count int, reverse bool) []ID {
+	if end.Less(start) {
+		return nil
+	}
+	lo, hi := s.search(start), s.search(end)
+	if hi < len(s.ids) && s.ids[hi] == end {
+		hi++
+	}
+	n := hi - lo
+	if count > 0 && count < n {
+		n = count
+	}
+	if n <= 0 {
+		return nil
+	}
+	ids := make([]ID, n)
+	if reverse {
+		for i := range ids {
+			ids[i] = s.ids[hi-1-i]
+		}
+	} else {
+		copy(ids, s.ids[lo:lo+n])
+	}
+	return ids
+}
+
+// After returns the IDs greater than the ID in ascending order, at most count IDs are returned
+// if count is positive.
+func (s *Stream) After(id ID, count int) []ID {
+	start, ok := id.Next()
+	if !ok {
+		return nil
+	}
+	return s.Range(start, MaxID, count, false)
+}
+
+// TrimMaxLen removes the oldest entries until the stream has at most maxLen entries, and
+// returns the removed IDs.
+func (s *Stream) TrimMaxLen(maxLen int) []ID {
+	if maxLen < 0 || len(s.ids) <= maxLen {
+		return nil
+	}
+	n := len(s.ids) - maxLen
+	return s.trimFirst(n)
+}
+
+// TrimMinID removes the entries whose IDs are less than minID, and returns the removed IDs.
+func (s *Stream) TrimMinID(minID ID) []ID {
+	return s.trimFirst(s.search(minID))
+}
+
+// trimFirst removes the first n entries and returns their IDs.
+func (s *Stream) trimFirst(n int) []ID {
+	if n == 0 {
+		return nil
+	}
+	removed := make([]ID, n)
+	copy(removed, s.ids[:n])
+	s.ids = append(s.ids[:0:0], s.ids[n:]...)
+	return removed
+}
+
+// search returns the position of the first ID not less than id.
+func (s *Stream) search(id ID) int {
+	return sort.Search(len(s.ids), func(i int) bool {
+		return !s.ids[i].Less(id)
+	})
+}
+
+// PendingIDs returns the IDs of the pending entries between start and end inclusively in
+// ascending order. If consumer is not empty, only the entries of the consumer are returned.
+// At most count IDs are returned if count is positive.
+func (g *Group) PendingIDs(start, end ID, count int, consumer string) []ID {
+	var ids []ID
+	for id, pe := range g.Pending {
+		if id.Less(start) || end.Less(id) || (consumer != "" && pe.Consumer != consumer) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Less(ids[j])
+	})
+	if count > 0 && len(ids) > count {
+		ids = ids[:count]
+	}
+	return ids
+}
+
+// PendingCount returns the number of pending entries of each consumer.
+func (g *Group) PendingCount() map[string]int {
+	counts := make(map[string]int)
+	for _, pe := range g.Pending {
+		counts[pe.Consumer]++
+	}
+	return counts
+}
+
+// Encode encodes the pending entry, which looks like:
+//
+//	+----------------+----------------+----------------+
+//	| delivery time  | delivery count |    consumer    |
+//	+----------------+----------------+----------------+
+//	|  varint bytes  |  varint bytes  |     bytes      |
+//	+----------------+----------------+----------------+
+func (pe *PendingEntry) Encode() []byte {
+	buf := make([]byte, 2*binary.MaxVarintLen64+len(pe.Consumer))
+	n := binary.PutVarint(buf, pe.DeliveryTime)
+	n += binary.PutVarint(buf[n:], pe.DeliveryCount)
+	n += copy(buf[n:], pe.Consumer)
+	return buf[:n]
+}
+
+// DecodePendingEntry decodes the pending entry encoded by Encode.
+func DecodePendingEntry(buf []byte) (*PendingEntry, error) {
+	deliveryTime, n := binary.Varint(buf)
+	if n <= 0 {
+		return nil, ErrInvalidEncoding
+	}
+	deliveryCount, m := binary.Varint(buf[n:])
+	if m <= 0 {
+		return nil, ErrInvalidEncoding
+	}
+	return &PendingEntry{
+		Consumer:      string(buf[n+m:]),
+		DeliveryTime:  deliveryTime,
+		DeliveryCount: deliveryCount,
+	}, nil
+}
+
+// EncodeFields encodes the field-value pairs of an entry, each of them is prefixed by its
+// length in uvarint.
+func EncodeFields(fields [][]byte) []byte {
+	size := 0
+	for _, field := range fields {
+		size += binary.MaxVarintLen64 + len(field)
+	}
+	buf := make([]byte, size)
+	n := 0
+	for _, field := range fields {
+		n += binary.PutUvarint(buf[n:], uint64(len(field)))
+		n += copy(buf[n:], field)
+	}
+	return buf[:n]
+}
+
+// DecodeFields decodes the field-value pairs encoded by EncodeFields.
+func DecodeFields(buf []byte) ([][]byte, error) {
+	var fields [][]byte
+	for len(buf) > 0 {
+		size, n := binary.Uvarint(buf)
+		if n <= 0 || uint64(len(buf)-n) < size {
+			return nil, ErrInvalidEncoding
+		}
+		fields = append(fields, buf[n:n+int(size)])
+		buf = buf[n+int(size):]
+	}
+	return fields, nil
+}
@@ -0,0 +1,145 @@
+package stream
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+func TestParseID(t *testing.T) {
+	id, err := ParseID("1526919030474-55", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, ID{Ms: 1526919030474, Seq: 55}, id)
+	assert.Equal(t, "1526919030474-55", id.String())
+
+	id, err = ParseID("1526919030474", 7)
+	assert.Nil(t, err)
+	assert.Equal(t, ID{Ms: 1526919030474, Seq: 7}, id)
+
+	for _, s := range []string{"", "-", "abc", "1-", "-1", "1-2-3", "1-a"} {
+		_, err = ParseID(s, 0)
+		assert.Equal(t, ErrInvalidID, err, s)
+	}
+}
+
+func TestParseRangeID(t *testing.T) {
+	tests := []struct {
+		s     string
+		isEnd bool
+		id    ID
+	}{
+		{"-", false, MinID},
+		{"+", true, MaxID},
+		{"5", false, ID{Ms: 5}},
+		{"5", true, ID{Ms: 5, Seq: math.MaxUint64}},
+		{"(5-1", false, ID{Ms: 5, Seq: 2}},
+		{"(5-0", true, ID{Ms: 4, Seq: math.MaxUint64}},
+	}
+	for _, tt := range tests {
+		id, err := ParseRangeID(tt.s, tt.isEnd)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.id, id, tt.s)
+	}
+	_, err := ParseRangeID("(0-0", true)
+	assert.Equal(t, ErrInvalidID, err)
+}
+
+func TestID_Bytes(t *testing.T) {
+	ids := []ID{{Ms: 1, Seq: 2}, {Ms: 1, Seq: 256}, {Ms: 256, Seq: 0}, MaxID}
+	for i, id := range ids {
+		decoded, err := DecodeID(id.Bytes())
+		assert.Nil(t, err)
+		assert.Equal(t, id, decoded)
+		if i > 0 {
+			assert.True(t, string(ids[i-1].Bytes()) < string(id.Bytes()))
+		}
+	}
+	_, err := DecodeID([]byte("short"))
+	assert.Equal(t, ErrInvalidID, err)
+}
+
+func TestNextID(t *testing.T) {
+	id, err := NextID(ID{Ms: 10, Seq: 3}, 20, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, ID{Ms: 20}, id)
+	// The clock goes backwards.
+	id, err = NextID(ID{Ms: 10, Seq: 3}, 5, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, ID{Ms: 10, Seq: 4}, id)
+	_, err = NextID(MaxID, 5, nil)
+	assert.Equal(t, ErrIDExhausted, err)
+
+	ms := uint64(10)
+	id, err = NextID(ID{Ms: 10, Seq: 3}, 0, &ms)
+	assert.Nil(t, err)
+	assert.Equal(t, ID{Ms: 10, Seq: 4}, id)
+	id, err = NextID(ID{Ms: 9, Seq: 3}, 0, &ms)
+	assert.Nil(t, err)
+	assert.Equal(t, ID{Ms: 10}, id)
+	_, err = NextID(ID{Ms: 11}, 0, &ms)
+	assert.Equal(t, ErrIDTooSmall, err)
+	zero := uint64(0)
+	id, err = NextID(MinID, 0, &zero)
+	assert.Nil(t, err)
+	assert.Equal(t, ID{Seq: 1}, id)
+}
+
+func TestStream(t *testing.T) {
+	s := New()
+	// The IDs may be inserted out of order when loading.
+	for _, ms := range []uint64{3, 1, 5, 2, 4, 3} {
+		s.Insert(ID{Ms: ms})
+	}
+	assert.Equal(t, 5, s.Len())
+	assert.Equal(t, ID{Ms: 5}, s.LastID)
+	first, _ := s.First()
+	last, _ := s.Last()
+	assert.Equal(t, ID{Ms: 1}, first)
+	assert.Equal(t, ID{Ms: 5}, last)
+
+	assert.Equal(t, []ID{{Ms: 2}, {Ms: 3}, {Ms: 4}}, s.Range(ID{Ms: 2}, ID{Ms: 4}, 0, false))
+	assert.Equal(t, []ID{{Ms: 4}, {Ms: 3}}, s.Range(ID{Ms: 2}, ID{Ms: 4}, 2, true))
+	assert.Nil(t, s.Range(ID{Ms: 4}, ID{Ms: 2}, 0, false))
+	assert.Equal(t, []ID{{Ms: 4}, {Ms: 5}}, s.After(ID{Ms: 3}, 0))
+	assert.Nil(t, s.After(MaxID, 0))
+
+	assert.True(t, s.Remove(ID{Ms: 5}))
+	assert.False(t, s.Remove(ID{Ms: 5}))
+	assert.False(t, s.Contains(ID{Ms: 5}))
+	// The last ID is kept after the last entry is removed.
+	assert.Equal(t, ID{Ms: 5}, s.LastID)
+
+	assert.Equal(t, []ID{{Ms: 1}}, s.TrimMaxLen(3))
+	assert.Nil(t, s.TrimMaxLen(3))
+	assert.Equal(t, []ID{{Ms: 2}}, s.TrimMinID(ID{Ms: 3}))
+	assert.Equal(t, []ID{{Ms: 3}, {Ms: 4}}, s.Range(MinID, MaxID, 0, false))
+}
+
+func TestGroup_PendingIDs(t *testing.T) {
+	g := NewGroup(MinID)
+	g.Pending[ID{Ms: 3}] = &PendingEntry{Consumer: "a"}
+	g.Pending[ID{Ms: 1}] = &PendingEntry{Consumer: "b"}
+	g.Pending[ID{Ms: 2}] = &PendingEntry{Consumer: "a"}
+	assert.Equal(t, []ID{{Ms: 1}, {Ms: 2}, {Ms: 3}}, g.PendingIDs(MinID, MaxID, 0, ""))
+	assert.Equal(t, []ID{{Ms: 2}, {Ms: 3}}, g.PendingIDs(MinID, MaxID, 0, "a"))
+	assert.Equal(t, []ID{{Ms: 2}}, g.PendingIDs(ID{Ms: 2}, MaxID, 1, ""))
+	assert.Equal(t, map[string]int{"a": 2, "b": 1}, g.PendingCount())
+}
+
+func TestEncoding(t *testing.T) {
+	pe := &PendingEntry{Consumer: "consumer", DeliveryTime: 1674700000000, DeliveryCount: 3}
+	decoded, err := DecodePendingEntry(pe.Encode())
+	assert.Nil(t, err)
+	assert.Equal(t, pe, decoded)
+
+	fields := [][]byte{[]byte("name"), []byte("KHighness"), []byte("empty"), {}}
+	decodedFields, err := DecodeFields(EncodeFields(fields))
+	assert.Nil(t, err)
+	assert.Equal(t, fields, decodedFields)
+	_, err = DecodeFields([]byte{10, 'a'})
+	assert.Equal(t, ErrInvalidEncoding, err)
+}
@@ -0,0 +1,126 @@
+package zset
+
+import (
+	"math"
+)
+
+// @Author KHighness
+// @Update 2023-01-24
+
+// Aggregate defines how the scores of a member in multiple sorted sets are aggregated.
+type Aggregate int8
+
+const (
+	// AggregateSum sums the scores of a member.
+	AggregateSum Aggregate = iota
+	// AggregateMin takes the min score of a member.
+	AggregateMin
+	// AggregateMax takes the max score of a member.
+	AggregateMax
+)
+
+// ZUnion returns the union of the sorted sets stored at keys. The score of each member is
+// multiplied by the weight of its sorted set, and the scores of the same member are aggregated.
+// All the weights are 1 if weights is nil.
+// The returned data likes ['member', 'score', 'member', 'score'...], which is ordered by scores.
+func (z *SortedSet) ZUnion(keys []string, weights []float64, aggregate Aggregate) []interface{} {
+	scores := make(map[string]float64)
+	for i, key := range keys {
+		if !z.exist(key) {
+			continue
+		}
+		for member, node := range z.record[key].dict {
+			score := weightedScore(node.score, weights, i)
+			if old, ok := scores[member]; ok {
+				score = aggregate.apply(old, score)
+			}
+			scores[member] = score
+		}
+	}
+	return sortScores(scores)
+}
+
+// ZInter returns the inter of the sorted sets stored at keys, the scores are weighted and
+// aggregated like ZUnion.
+func (z *SortedSet) ZInter(keys []string, weights []float64, aggregate Aggregate) []interface{} {
+	scores := make(map[string]float64)
+	for i, key := range keys {
+		if !z.exist(key) {
+			return nil
+		}
+		dict := z.record[key].dict
+		if i == 0 {
+			for member, node := range dict {
+				scores[member] = weightedScore(node.score, weights, i)
+			}
+			continue
+		}
+		for member, old := range scores {
+			node, ok := dict[member]
+			if !ok {
+				delete(scores, member)
+				continue
+			}
+			scores[member] = aggregate.apply(old, weightedScore(node.score, weights, i))
+		}
+	}
+	return sortScores(scores)
+}
+
+// ZDiff returns the members of the first sorted set which are not in the other sorted sets,
+// with their scores in the first sorted set.
+func (z *SortedSet) ZDiff(keys []string) []interface{} {
+	if len(keys) == 0 || !z.exist(keys[0]) {
+		return nil
+	}
+	scores := make(map[string]float64)
+	for member, node := range z.record[keys[0]].dict {
+		scores[member] = node.score
+	}
+	for _, key := range keys[1:] {
+		if !z.exist(key) {
+			continue
+		}
+		for member := range z.record[key].dict {
+			delete(scores, member)
+		}
+	}
+	return sortScores(scores)
+}
+
+// apply aggregates two scores, NaN produced by adding infinities is regarded as 0.
+func (a Aggregate) apply(x, y float64) float64 {
+	switch a {
+	case AggregateMin:
+		return math.Min(x, y)
+	case AggregateMax:
+		return math.Max(x, y)
+	}
+	if sum := x + y; !math.IsNaN(sum) {
+		return sum
+	}
+	return 0
+}
+
+// weightedScore returns the score multiplied by the i-th weight, NaN is regarded as 0.
+func weightedScore(score float64, weights []float64, i int) float64 {
+	if weights == nil {
+		return score
+	}
+	if score *= weights[i]; math.IsNaN(score) {
+		return 0
+	}
+	return score
+}
+
+// sortScores sorts the members by their scores with a temporary sorted set.
+func sortScores(scores map[string]float64) []interface{} {
+	if len(scores) == 0 {
+		return nil
+	}
+	tmp := New()
+	for member, score := range scores {
+		tmp.ZAdd("", score, member)
+	}
+	return tmp.ZRangeWithScores("", 0, -1)
+}
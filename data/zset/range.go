@@ -0,0 +1,169 @@
+package zset
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+// @Author KHighness
+// @Update 2023-01-23
+
+var (
+	// ErrInvalidScoreRange represents the min or max of score range can not be parsed.
+	ErrInvalidScoreRange = errors.New("min or max is not a float")
+	// ErrInvalidLexRange represents the min or max of lexicographical range can not be parsed.
+	ErrInvalidLexRange = errors.New("min or max not valid string range item")
+)
+
+type (
+	// ScoreRange defines a range of scores, the bounds are inclusive unless MinEx or MaxEx is set.
+	ScoreRange struct {
+		Min, Max     float64
+		MinEx, MaxEx bool
+	}
+
+	// LexRange defines a range of members in lexicographical order, which only makes sense
+	// when all the members have the same score.
+	LexRange struct {
+		Min, Max LexBound
+	}
+
+	// LexBound defines a bound of lexicographical range.
+	LexBound struct {
+		Member    string
+		Exclusive bool
+		// Inf is -1 for negative infinity '-', 1 for positive infinity '+', and 0 for Member.
+		Inf int8
+	}
+)
+
+// ParseScoreRange parses the score range with the syntax of Redis, the bound prefixed
+// by '(' is exclusive, and '-inf' and '+inf' are negative and positive infinity.
+func ParseScoreRange(min, max string) (*ScoreRange, error) {
+	r := &ScoreRange{}
+	var err error
+	if r.Min, r.MinEx, err = parseScoreBound(min); err != nil {
+		return nil, err
+	}
+	if r.Max, r.MaxEx, err = parseScoreBound(max); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ParseLexRange parses the lexicographical range with the syntax of Redis, the bound
+// prefixed by '(' is exclusive and the one prefixed by '[' is inclusive, and '-' and '+'
+// are negative and positive infinity.
+func ParseLexRange(min, max string) (*LexRange, error) {
+	r := &LexRange{}
+	var err error
+	if r.Min, err = parseLexBound(min); err != nil {
+		return nil, err
+	}
+	if r.Max, err = parseLexBound(max); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func parseScoreBound(bound string) (float64, bool, error) {
+	var exclusive bool
+	if len(bound) > 0 && bound[0] == '(' {
+		bound, exclusive = bound[1:], true
+	}
+	score, err := strconv.ParseFloat(bound, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false, ErrInvalidScoreRange
+	}
+	return score, exclusive, nil
+}
+
+func parseLexBound(bound string) (LexBound, error) {
+	if bound == "-" {
+		return LexBound{Inf: -1}, nil
+	}
+	if bound == "+" {
+		return LexBound{Inf: 1}, nil
+	}
+	if len(bound) == 0 {
+		return LexBound{}, ErrInvalidLexRange
+	}
+	switch bound[0] {
+	case '(':
+		return LexBound{Member: bound[1:], Exclusive: true}, nil
+	case '[':
+		return LexBound{Member: bound[1:]}, nil
+	default:
+		return LexBound{}, ErrInvalidLexRange
+	}
+}
+
+// empty checks if no score can be in the range.
+func (r *ScoreRange) empty() bool {
+	return r.Min > r.Max || (r.Min == r.Max && (r.MinEx || r.MaxEx))
+}
+
+// gteMin checks if the score is not less than the min bound.
+func (r *ScoreRange) gteMin(score float64) bool {
+	if r.MinEx {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+// lteMax checks if the score is not greater than the max bound.
+func (r *ScoreRange) lteMax(score float64) bool {
+	if r.MaxEx {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+// empty checks if no member can be in the range.
+func (r *LexRange) empty() bool {
+	cmp := r.Min.compare(r.Max)
+	return cmp > 0 || (cmp == 0 && (r.Min.Exclusive || r.Max.Exclusive || r.Min.Inf != 0))
+}
+
+// gteMin checks if the member is not less than the min bound.
+func (r *LexRange) gteMin(member string) bool {
+	switch r.Min.Inf {
+	case -1:
+		return true
+	case 1:
+		return false
+	}
+	if r.Min.Exclusive {
+		return member > r.Min.Member
+	}
+	return member >= r.Min.Member
+}
+
+// lteMax checks if the member is not greater than the max bound.
+func (r *LexRange) lteMax(member string) bool {
+	switch r.Max.Inf {
+	case -1:
+		return false
+	case 1:
+		return true
+	}
+	if r.Max.Exclusive {
+		return member < r.Max.Member
+	}
+	return member <= r.Max.Member
+}
+
+// compare compares two bounds regardless of whether they are exclusive.
+func (b LexBound) compare(other LexBound) int {
+	if b.Inf != 0 || other.Inf != 0 {
+		return int(b.Inf) - int(other.Inf)
+	}
+	switch {
+	case b.Member < other.Member:
+		return -1
+	case b.Member > other.Member:
+		return 1
+	}
+	return 0
+}
@@ -290,3 +290,197 @@ func (skl *SkipList) RevScoreRange(min, max float64) (val []interface{}) {
 
 	return
 }
+
+// FirstInScoreRange returns the first node whose score is in the range.
+// If no node is in the range, then nil will be returned.
+func (skl *SkipList) FirstInScoreRange(r *ScoreRange) *SklNode {
+	if !skl.isInScoreRange(r) {
+		return nil
+	}
+	p := skl.head
+	for i := skl.level - 1; i >= 0; i-- {
+		for p.level[i].backward != nil && !r.gteMin(p.level[i].backward.score) {
+			p = p.level[i].backward
+		}
+	}
+	p = p.level[0].backward
+	if !r.lteMax(p.score) {
+		return nil
+	}
+	return p
+}
+
+// LastInScoreRange returns the last node whose score is in the range.
+// If no node is in the range, then nil will be returned.
+func (skl *SkipList) LastInScoreRange(r *ScoreRange) *SklNode {
+	if !skl.isInScoreRange(r) {
+		return nil
+	}
+	p := skl.head
+	for i := skl.level - 1; i >= 0; i-- {
+		for p.level[i].backward != nil && r.lteMax(p.level[i].backward.score) {
+			p = p.level[i].backward
+		}
+	}
+	if !r.gteMin(p.score) {
+		return nil
+	}
+	return p
+}
+
+// FirstInLexRange returns the first node whose member is in the lexicographical range.
+// If no node is in the range, then nil will be returned.
+func (skl *SkipList) FirstInLexRange(r *LexRange) *SklNode {
+	if !skl.isInLexRange(r) {
+		return nil
+	}
+	p := skl.head
+	for i := skl.level - 1; i >= 0; i-- {
+		for p.level[i].backward != nil && !r.gteMin(p.level[i].backward.member) {
+			p = p.level[i].backward
+		}
+	}
+	p = p.level[0].backward
+	if !r.lteMax(p.member) {
+		return nil
+	}
+	return p
+}
+
+// LastInLexRange returns the last node whose member is in the lexicographical range.
+// If no node is in the range, then nil will be returned.
+func (skl *SkipList) LastInLexRange(r *LexRange) *SklNode {
+	if !skl.isInLexRange(r) {
+		return nil
+	}
+	p := skl.head
+	for i := skl.level - 1; i >= 0; i-- {
+		for p.level[i].backward != nil && r.lteMax(p.level[i].backward.member) {
+			p = p.level[i].backward
+		}
+	}
+	if !r.gteMin(p.member) {
+		return nil
+	}
+	return p
+}
+
+// DeleteRangeByScore removes all the nodes whose score is in the range,
+// and returns the removed nodes.
+func (skl *SkipList) DeleteRangeByScore(r *ScoreRange) []*SklNode {
+	if r.empty() {
+		return nil
+	}
+	return skl.deleteRange(func(p *SklNode) bool {
+		return !r.gteMin(p.score)
+	}, func(p *SklNode) bool {
+		return r.lteMax(p.score)
+	})
+}
+
+// DeleteRangeByLex removes all the nodes whose member is in the lexicographical range,
+// and returns the removed nodes.
+func (skl *SkipList) DeleteRangeByLex(r *LexRange) []*SklNode {
+	if r.empty() {
+		return nil
+	}
+	return skl.deleteRange(func(p *SklNode) bool {
+		return !r.gteMin(p.member)
+	}, func(p *SklNode) bool {
+		return r.lteMax(p.member)
+	})
+}
+
+// DeleteRangeByRank removes all the nodes whose rank is between start and end, and returns
+// the removed nodes. The rank is 1-based and both start and end are inclusive.
+func (skl *SkipList) DeleteRangeByRank(start, end uint64) (removed []*SklNode) {
+	front := make([]*SklNode, maxLevel)
+	var traversed uint64 = 0
+	p := skl.head
+
+	for i := skl.level - 1; i >= 0; i-- {
+		for p.level[i].backward != nil && (traversed+p.level[i].span) < start {
+			traversed += p.level[i].span
+			p = p.level[i].backward
+		}
+		front[i] = p
+	}
+
+	traversed++
+	p = p.level[0].backward
+	for p != nil && traversed <= end {
+		next := p.level[0].backward
+		skl.deleteNode(p, front)
+		removed = append(removed, p)
+		traversed++
+		p = next
+	}
+	return
+}
+
+// deleteRange removes the nodes from the first node which is not before the range,
+// until the node is out of the range.
+func (skl *SkipList) deleteRange(before, in func(p *SklNode) bool) (removed []*SklNode) {
+	front := make([]*SklNode, maxLevel)
+	p := skl.head
+
+	for i := skl.level - 1; i >= 0; i-- {
+		for p.level[i].backward != nil && before(p.level[i].backward) {
+			p = p.level[i].backward
+		}
+		front[i] = p
+	}
+
+	p = p.level[0].backward
+	for p != nil && in(p) {
+		next := p.level[0].backward
+		skl.deleteNode(p, front)
+		removed = append(removed, p)
+		p = next
+	}
+	return
+}
+
+// isInScoreRange checks if any part of the skip list is in the range.
+func (skl *SkipList) isInScoreRange(r *ScoreRange) bool {
+	if r.empty() || skl.tail == nil || !r.gteMin(skl.tail.score) {
+		return false
+	}
+	first := skl.head.level[0].backward
+	return first != nil && r.lteMax(first.score)
+}
+
+// isInLexRange checks if any part of the skip list is in the lexicographical range.
+func (skl *SkipList) isInLexRange(r *LexRange) bool {
+	if r.empty() || skl.tail == nil || !r.gteMin(skl.tail.member) {
+		return false
+	}
+	first := skl.head.level[0].backward
+	return first != nil && r.lteMax(first.member)
+}
+
+// next returns the next node of p, or the previous node if reverse is true.
+func (skl *SkipList) next(p *SklNode, reverse bool) *SklNode {
+	if reverse {
+		return p.forward
+	}
+	return p.level[0].backward
+}
+
+// skip returns the node which is offset nodes after p, or before p if reverse is true.
+// If there are not enough nodes, then nil will be returned.
+func (skl *SkipList) skip(p *SklNode, offset int, reverse bool) *SklNode {
+	if p == nil || offset <= 0 {
+		return p
+	}
+	rank := skl.GetRank(p.score, p.member)
+	if reverse {
+		rank -= int64(offset)
+	} else {
+		rank += int64(offset)
+	}
+	if rank <= 0 || rank > skl.length {
+		return nil
+	}
+	return skl.GetByRank(uint64(rank))
+}
@@ -1,6 +1,7 @@
 package zset
 
 import (
+	"math"
 	"testing"
 
 	"github.com/Khighness/khighdb/util"
@@ -76,3 +77,46 @@ func TestSkipList_RevScoreRange(t *testing.T) {
 	t.Log(res)
 	assert.Equal(t, 62, len(res))
 }
+
+func TestSkipList_DeleteRangeByRank(t *testing.T) {
+	skl := NewSkipList()
+	for i := 1; i <= 10; i++ {
+		skl.Insert(float64(i), util.Float64ToStr(float64(i)))
+	}
+	nodes := skl.DeleteRangeByRank(3, 5)
+	assert.Equal(t, 3, len(nodes))
+	assert.Equal(t, "3", nodes[0].member)
+	assert.Equal(t, int64(7), skl.length)
+	assert.Equal(t, "6", skl.GetByRank(3).member)
+	assert.Equal(t, int64(3), skl.GetRank(6, "6"))
+}
+
+func TestSkipList_DeleteRangeByScore(t *testing.T) {
+	skl := NewSkipList()
+	for i := 1; i <= 10; i++ {
+		skl.Insert(float64(i), util.Float64ToStr(float64(i)))
+	}
+	nodes := skl.DeleteRangeByScore(&ScoreRange{Min: 2, Max: 5, MaxEx: true})
+	assert.Equal(t, 3, len(nodes))
+	assert.Equal(t, int64(7), skl.length)
+	assert.Nil(t, skl.FirstInScoreRange(&ScoreRange{Min: 2, Max: 4}))
+	assert.Equal(t, "10", skl.tail.member)
+
+	nodes = skl.DeleteRangeByScore(&ScoreRange{Min: 9, Max: math.Inf(1)})
+	assert.Equal(t, 2, len(nodes))
+	assert.Equal(t, "8", skl.tail.member)
+	assert.Equal(t, 0, len(skl.DeleteRangeByScore(&ScoreRange{Min: 3, Max: 3})))
+}
+
+func TestSkipList_DeleteRangeByLex(t *testing.T) {
+	skl := NewSkipList()
+	for _, member := range []string{"a", "b", "c", "d", "e"} {
+		skl.Insert(0, member)
+	}
+	r, err := ParseLexRange("(a", "[c")
+	assert.Nil(t, err)
+	nodes := skl.DeleteRangeByLex(r)
+	assert.Equal(t, 2, len(nodes))
+	assert.Equal(t, "b", nodes[0].member)
+	assert.Equal(t, "d", skl.GetByRank(2).member)
+}
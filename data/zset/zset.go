@@ -239,6 +239,132 @@ func (z *SortedSet) ZRevScoreRange(key string, min, max float64) (val []interfac
 	return skl.RevScoreRange(min, max)
 }
 
+// ZRangeByScore returns the elements in the sorted set at key with a score in the range,
+// skipping offset elements and returning at most count elements, a negative count means no limit.
+// The returned data likes ['member', 'score', 'member', 'score'...], which is ordered from low to
+// high scores, or from high to low scores if reverse is true.
+func (z *SortedSet) ZRangeByScore(key string, r *ScoreRange, offset, count int, reverse bool) (val []interface{}) {
+	if !z.exist(key) {
+		return nil
+	}
+
+	skl := z.record[key].skl
+	var node *SklNode
+	if reverse {
+		node = skl.LastInScoreRange(r)
+	} else {
+		node = skl.FirstInScoreRange(r)
+	}
+	for node = skl.skip(node, offset, reverse); node != nil && count != 0; count-- {
+		if (reverse && !r.gteMin(node.score)) || (!reverse && !r.lteMax(node.score)) {
+			break
+		}
+		val = append(val, node.member, node.score)
+		node = skl.next(node, reverse)
+	}
+	return
+}
+
+// ZRangeByLex returns the members in the sorted set at key in the lexicographical range,
+// skipping offset members and returning at most count members, a negative count means no limit.
+// The members are ordered lexicographically, or reversely if reverse is true.
+func (z *SortedSet) ZRangeByLex(key string, r *LexRange, offset, count int, reverse bool) (val []interface{}) {
+	if !z.exist(key) {
+		return nil
+	}
+
+	skl := z.record[key].skl
+	var node *SklNode
+	if reverse {
+		node = skl.LastInLexRange(r)
+	} else {
+		node = skl.FirstInLexRange(r)
+	}
+	for node = skl.skip(node, offset, reverse); node != nil && count != 0; count-- {
+		if (reverse && !r.gteMin(node.member)) || (!reverse && !r.lteMax(node.member)) {
+			break
+		}
+		val = append(val, node.member)
+		node = skl.next(node, reverse)
+	}
+	return
+}
+
+// ZCount returns the number of elements in the sorted set at key with a score in the range.
+func (z *SortedSet) ZCount(key string, r *ScoreRange) int {
+	if !z.exist(key) {
+		return 0
+	}
+
+	skl := z.record[key].skl
+	first := skl.FirstInScoreRange(r)
+	if first == nil {
+		return 0
+	}
+	last := skl.LastInScoreRange(r)
+	return int(skl.GetRank(last.score, last.member) - skl.GetRank(first.score, first.member) + 1)
+}
+
+// ZLexCount returns the number of members in the sorted set at key in the lexicographical range.
+func (z *SortedSet) ZLexCount(key string, r *LexRange) int {
+	if !z.exist(key) {
+		return 0
+	}
+
+	skl := z.record[key].skl
+	first := skl.FirstInLexRange(r)
+	if first == nil {
+		return 0
+	}
+	last := skl.LastInLexRange(r)
+	return int(skl.GetRank(last.score, last.member) - skl.GetRank(first.score, first.member) + 1)
+}
+
+// ZRemRangeByScore removes all the elements in the sorted set at key with a score in the range,
+// and returns the removed members.
+func (z *SortedSet) ZRemRangeByScore(key string, r *ScoreRange) []string {
+	if !z.exist(key) {
+		return nil
+	}
+	return z.removeNodes(key, z.record[key].skl.DeleteRangeByScore(r))
+}
+
+// ZRemRangeByLex removes all the members in the sorted set at key in the lexicographical range,
+// and returns the removed members.
+func (z *SortedSet) ZRemRangeByLex(key string, r *LexRange) []string {
+	if !z.exist(key) {
+		return nil
+	}
+	return z.removeNodes(key, z.record[key].skl.DeleteRangeByLex(r))
+}
+
+// ZRemRangeByRank removes all the elements in the sorted set at key with a rank between start and
+// stop, and returns the removed members. The rank is 0-based and can be negative like ZRange.
+func (z *SortedSet) ZRemRangeByRank(key string, start, stop int) []string {
+	if !z.exist(key) {
+		return nil
+	}
+
+	skl := z.record[key].skl
+	length := int(skl.length)
+	if start < 0 {
+		start += length
+		if start < 0 {
+			start = 0
+		}
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start > stop || start >= length {
+		return nil
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	return z.removeNodes(key, skl.DeleteRangeByRank(uint64(start+1), uint64(stop+1)))
+}
+
 // ZKeyExists checks if the key exists in the sorted set,
 func (z *SortedSet) ZKeyExists(key string) bool {
 	return z.exist(key)
@@ -307,6 +433,16 @@ func (z *SortedSet) findRange(key string, start, stop int64, reverse bool, withS
 	return
 }
 
+// removeNodes removes the nodes removed from skip list from the dict, and returns their members.
+func (z *SortedSet) removeNodes(key string, nodes []*SklNode) []string {
+	members := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		delete(z.record[key].dict, node.member)
+		members = append(members, node.member)
+	}
+	return members
+}
+
 func (z *SortedSet) getByRank(key string, rank int64, reverse bool) (string, float64) {
 	skl := z.record[key].skl
 	if rank < 0 || rank > skl.length {
@@ -1,6 +1,7 @@
 package zset
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -153,3 +154,119 @@ func TestSortedSet_ZGetByRank(t *testing.T) {
 	getRank(4)
 	getRank(6)
 }
+
+func TestSortedSet_ZRangeByScore(t *testing.T) {
+	key := "myzset"
+	zset := InitZSet()
+	r, err := ParseScoreRange("(12", "19")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"bcd", float64(17), "ecd", float64(17), "mcd", float64(17), "ced", float64(19)},
+		zset.ZRangeByScore(key, r, 0, -1, false))
+	assert.Equal(t, []interface{}{"ecd", float64(17), "mcd", float64(17)},
+		zset.ZRangeByScore(key, r, 1, 2, false))
+	assert.Equal(t, []interface{}{"mcd", float64(17), "ecd", float64(17)},
+		zset.ZRangeByScore(key, r, 1, 2, true))
+	assert.Nil(t, zset.ZRangeByScore(key, r, 4, -1, false))
+
+	r, err = ParseScoreRange("-inf", "+inf")
+	assert.Nil(t, err)
+	assert.Equal(t, 7, zset.ZCount(key, r))
+	r, err = ParseScoreRange("17", "(17")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, zset.ZCount(key, r))
+
+	_, err = ParseScoreRange("a", "1")
+	assert.Equal(t, ErrInvalidScoreRange, err)
+	_, err = ParseScoreRange("1", "nan")
+	assert.Equal(t, ErrInvalidScoreRange, err)
+}
+
+func TestSortedSet_ZRangeByLex(t *testing.T) {
+	key := "myzset"
+	zset := New()
+	for _, member := range []string{"a", "b", "c", "d", "e", "f"} {
+		zset.ZAdd(key, 0, member)
+	}
+	r, err := ParseLexRange("[b", "(e")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"b", "c", "d"}, zset.ZRangeByLex(key, r, 0, -1, false))
+	assert.Equal(t, []interface{}{"c", "b"}, zset.ZRangeByLex(key, r, 1, -1, true))
+	assert.Equal(t, 3, zset.ZLexCount(key, r))
+
+	r, err = ParseLexRange("-", "+")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"a", "b"}, zset.ZRangeByLex(key, r, 0, 2, false))
+	assert.Equal(t, 6, zset.ZLexCount(key, r))
+	r, err = ParseLexRange("+", "-")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, zset.ZLexCount(key, r))
+
+	_, err = ParseLexRange("b", "[e")
+	assert.Equal(t, ErrInvalidLexRange, err)
+}
+
+func TestSortedSet_ZRemRange(t *testing.T) {
+	key := "myzset"
+	zset := InitZSet()
+	r, err := ParseScoreRange("17", "17")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bcd", "ecd", "mcd"}, zset.ZRemRangeByScore(key, r))
+	assert.Equal(t, 4, zset.ZCard(key))
+	ok, _ := zset.ZScore(key, "ecd")
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"ccd", "acc"}, zset.ZRemRangeByRank(key, -2, 10))
+	assert.Nil(t, zset.ZRemRangeByRank(key, 3, 1))
+	assert.Equal(t, []interface{}{"acd", "ced"}, zset.ZRange(key, 0, -1))
+
+	lex, err := ParseLexRange("-", "(b")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"acd"}, zset.ZRemRangeByLex(key, lex))
+	assert.Equal(t, 1, zset.ZCard(key))
+}
+
+func TestSortedSet_ZUnion(t *testing.T) {
+	zset := New()
+	zset.ZAdd("z1", 1, "a")
+	zset.ZAdd("z1", 2, "b")
+	zset.ZAdd("z2", 3, "b")
+	zset.ZAdd("z2", 4, "c")
+
+	assert.Equal(t, []interface{}{"a", float64(1), "c", float64(4), "b", float64(5)},
+		zset.ZUnion([]string{"z1", "z2", "missing"}, nil, AggregateSum))
+	assert.Equal(t, []interface{}{"a", float64(2), "b", float64(4), "c", float64(4)},
+		zset.ZUnion([]string{"z1", "z2"}, []float64{2, 1}, AggregateMax))
+	assert.Nil(t, zset.ZUnion([]string{"missing"}, nil, AggregateSum))
+}
+
+func TestSortedSet_ZInter(t *testing.T) {
+	zset := New()
+	zset.ZAdd("z1", 1, "a")
+	zset.ZAdd("z1", 2, "b")
+	zset.ZAdd("z1", 3, "c")
+	zset.ZAdd("z2", 5, "b")
+	zset.ZAdd("z2", 1, "c")
+
+	assert.Equal(t, []interface{}{"c", float64(1), "b", float64(2)},
+		zset.ZInter([]string{"z1", "z2"}, nil, AggregateMin))
+	assert.Equal(t, []interface{}{"c", float64(7), "b", float64(9)},
+		zset.ZInter([]string{"z1", "z2"}, []float64{2, 1}, AggregateSum))
+	assert.Nil(t, zset.ZInter([]string{"z1", "missing"}, nil, AggregateSum))
+
+	// The sum of opposite infinities is 0.
+	zset.ZAdd("z3", math.Inf(1), "a")
+	zset.ZAdd("z4", math.Inf(-1), "a")
+	assert.Equal(t, []interface{}{"a", float64(0)}, zset.ZInter([]string{"z3", "z4"}, nil, AggregateSum))
+}
+
+func TestSortedSet_ZDiff(t *testing.T) {
+	zset := New()
+	zset.ZAdd("z1", 3, "a")
+	zset.ZAdd("z1", 2, "b")
+	zset.ZAdd("z1", 1, "c")
+	zset.ZAdd("z2", 5, "b")
+
+	assert.Equal(t, []interface{}{"c", float64(1), "a", float64(3)},
+		zset.ZDiff([]string{"z1", "z2", "missing"}))
+	assert.Nil(t, zset.ZDiff([]string{"missing", "z1"}))
+}
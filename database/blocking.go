@@ -0,0 +1,261 @@
+package khighdb
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Khighness/khighdb/data/art"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+type (
+	// blockingKeys holds the clients blocked on the keys of a data type, all its methods must
+	// be called with the write lock of the data type held.
+	blockingKeys struct {
+		// clients is the FIFO queue of blocked clients of each key.
+		clients map[string]*list.List
+		// ready is the keys which may serve the blocked clients.
+		ready [][]byte
+	}
+
+	// blockedClient is a client blocked on one or more keys.
+	blockedClient struct {
+		keys  [][]byte
+		elems []*list.Element
+		// pop tries to pop an element of key for the client, nil is returned if the key is empty.
+		pop    func(key []byte) ([]byte, error)
+		served bool
+		result chan blockedResult
+	}
+
+	// blockedResult is the result delivered to a blocked client.
+	blockedResult struct {
+		key   []byte
+		value []byte
+		err   error
+	}
+)
+
+func newBlockingKeys() *blockingKeys {
+	return &blockingKeys{clients: make(map[string]*list.List)}
+}
+
+// block adds the client to the tail of the queues of its keys.
+func (b *blockingKeys) block(c *blockedClient) {
+	for _, key := range c.keys {
+		queue := b.clients[string(key)]
+		if queue == nil {
+			queue = list.New()
+			b.clients[string(key)] = queue
+		}
+		c.elems = append(c.elems, queue.PushBack(c))
+	}
+}
+
+// unblock removes the client from the queues of its keys.
+func (b *blockingKeys) unblock(c *blockedClient) {
+	for i, key := range c.keys {
+		queue := b.clients[string(key)]
+		if queue == nil {
+			continue
+		}
+		queue.Remove(c.elems[i])
+		if queue.Len() == 0 {
+			delete(b.clients, string(key))
+		}
+	}
+	c.elems = nil
+}
+
+// signal marks the key as ready if there are clients blocked on it.
+func (b *blockingKeys) signal(key []byte) {
+	if _, ok := b.clients[string(key)]; ok {
+		b.ready = append(b.ready, key)
+	}
+}
+
+// serve serves the clients blocked on the ready keys in FIFO order, until the keys are empty
+// or no client is blocked on them.
+func (b *blockingKeys) serve() {
+	for len(b.ready) > 0 {
+		key := b.ready[0]
+		b.ready = b.ready[1:]
+		for {
+			queue := b.clients[string(key)]
+			if queue == nil {
+				break
+			}
+			c := queue.Front().Value.(*blockedClient)
+			value, err := c.pop(key)
+			if err == nil && value == nil {
+				break
+			}
+			b.unblock(c)
+			c.served = true
+			c.result <- blockedResult{key: key, value: value, err: err}
+		}
+	}
+	b.ready = nil
+}
+
+// unblockAll unblocks all the clients with the error.
+func (b *blockingKeys) unblockAll(err error) {
+	for _, queue := range b.clients {
+		for queue.Len() > 0 {
+			c := queue.Front().Value.(*blockedClient)
+			b.unblock(c)
+			c.served = true
+			c.result <- blockedResult{err: err}
+		}
+	}
+	b.ready = nil
+}
+
+// wait waits until the client is served, the timeout elapses or ctx is done.
+// A zero timeout means waiting indefinitely.
+func (b *blockingKeys) wait(ctx context.Context, mu *sync.RWMutex, c *blockedClient,
+	timeout time.Duration) blockedResult {
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	var res blockedResult
+	select {
+	case res = <-c.result:
+		return res
+	case <-timer:
+	case <-ctx.Done():
+		res.err = ctx.Err()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// The client may be served before acquiring the lock.
+	if c.served {
+		return <-c.result
+	}
+	b.unblock(c)
+	return res
+}
+
+// BLPop is the blocking version of LPop, it removes and returns the first element of the first
+// non-empty list among keys, together with the key. If all the lists are empty, it blocks until
+// an element is pushed, the timeout elapses or ctx is done. A zero timeout blocks indefinitely.
+// The clients blocked on the same key are served in FIFO order.
+// It returns nil key and value if the timeout elapses, and the error of ctx if ctx is done.
+func (db *KhighDB) BLPop(ctx context.Context, timeout time.Duration, keys ...[]byte) ([]byte, []byte, error) {
+	return db.blockingPop(ctx, timeout, List, keys, func(key []byte) ([]byte, error) {
+		defer db.releaseKeyIfEmpty(key, List)
+		return db.popInternal(key, true)
+	})
+}
+
+// BRPop is the blocking version of RPop, it removes and returns the last element of the first
+// non-empty list among keys, together with the key. See BLPop for the blocking behaviour.
+func (db *KhighDB) BRPop(ctx context.Context, timeout time.Duration, keys ...[]byte) ([]byte, []byte, error) {
+	return db.blockingPop(ctx, timeout, List, keys, func(key []byte) ([]byte, error) {
+		defer db.releaseKeyIfEmpty(key, List)
+		return db.popInternal(key, false)
+	})
+}
+
+// BLMove is the blocking version of LMove. If the list stored at srcKey is empty, it blocks until
+// an element is pushed, the timeout elapses or ctx is done. See BLPop for the blocking behaviour.
+// It returns nil if the timeout elapses.
+func (db *KhighDB) BLMove(ctx context.Context, timeout time.Duration, srcKey, dstKey []byte,
+	srcIsLeft, dstIsLeft bool) ([]byte, error) {
+	_, value, err := db.blockingPop(ctx, timeout, List, [][]byte{srcKey}, func(key []byte) ([]byte, error) {
+		defer db.releaseKeyIfEmpty(key, List)
+		return db.moveInternal(key, dstKey, srcIsLeft, dstIsLeft)
+	})
+	return value, err
+}
+
+// BZPopMin is the blocking version of ZPopMin, it removes and returns the member with the lowest
+// score in the first non-empty sorted set among keys, together with the key. If all the sorted
+// sets are empty, it blocks until a member is added, the timeout elapses or ctx is done.
+// See BLPop for the blocking behaviour. It returns nil key and member if the timeout elapses.
+func (db *KhighDB) BZPopMin(ctx context.Context, timeout time.Duration, keys ...[]byte) ([]byte, *ZMember, error) {
+	return db.blockingZSetPop(ctx, timeout, keys, false)
+}
+
+// BZPopMax is the blocking version of ZPopMax, it removes and returns the member with the highest
+// score in the first non-empty sorted set among keys, together with the key.
+// See BZPopMin for the blocking behaviour.
+func (db *KhighDB) BZPopMax(ctx context.Context, timeout time.Duration, keys ...[]byte) ([]byte, *ZMember, error) {
+	return db.blockingZSetPop(ctx, timeout, keys, true)
+}
+
+// blockingZSetPop pops the member with the lowest or highest score from the first non-empty
+// sorted set among keys, or blocks until a member can be popped.
+func (db *KhighDB) blockingZSetPop(ctx context.Context, timeout time.Duration, keys [][]byte,
+	max bool) ([]byte, *ZMember, error) {
+	// The score is set by the client itself, or by the one serving it before the result is sent.
+	var score float64
+	key, member, err := db.blockingPop(ctx, timeout, ZSet, keys, func(key []byte) ([]byte, error) {
+		defer db.releaseKeyIfEmpty(key, ZSet)
+		members, err := db.zPopInternal(key, 1, max)
+		if err != nil || len(members) == 0 {
+			return nil, err
+		}
+		score = members[0].Score
+		return members[0].Member, nil
+	})
+	if err != nil || member == nil {
+		return nil, nil, err
+	}
+	return key, &ZMember{Member: member, Score: score}, nil
+}
+
+// blockingPop pops an element from the first non-empty list or sorted set among keys by pop,
+// or blocks until an element can be popped.
+func (db *KhighDB) blockingPop(ctx context.Context, timeout time.Duration, dataType DataType, keys [][]byte,
+	pop func(key []byte) ([]byte, error)) ([]byte, []byte, error) {
+	if len(keys) == 0 {
+		return nil, nil, ErrInvalidNumberOfArgs
+	}
+	// The indexes are reset when db is closed, so hold them in case of being woken after closing.
+	var mu *sync.RWMutex
+	var blocking *blockingKeys
+	var trees map[string]*art.AdaptiveRadixTree
+	switch dataType {
+	case List:
+		idx := db.listIndex
+		mu, blocking, trees = idx.mu, idx.blocking, idx.trees
+	case ZSet:
+		idx := db.zsetIndex
+		mu, blocking, trees = idx.mu, idx.blocking, idx.trees
+	case Stream:
+		idx := db.streamIndex
+		mu, blocking, trees = idx.mu, idx.blocking, idx.trees
+	default:
+		return nil, nil, ErrWrongType
+	}
+
+	mu.Lock()
+	for _, key := range keys {
+		if trees[string(key)] == nil {
+			continue
+		}
+		value, err := pop(key)
+		if err != nil || value != nil {
+			blocking.serve()
+			mu.Unlock()
+			return key, value, err
+		}
+	}
+
+	c := &blockedClient{keys: keys, pop: pop, result: make(chan blockedResult, 1)}
+	blocking.block(c)
+	mu.Unlock()
+
+	res := blocking.wait(ctx, mu, c, timeout)
+	return res.key, res.value, res.err
+}
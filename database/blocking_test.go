@@ -0,0 +1,213 @@
+package khighdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-24
+
+func TestKhighDB_BLPop(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	// The element is popped without blocking.
+	assert.Nil(t, db.RPush([]byte("l2"), []byte("a"), []byte("b")))
+	key, val, err := db.BLPop(context.Background(), time.Second, []byte("l1"), []byte("l2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("l2"), key)
+	assert.Equal(t, []byte("a"), val)
+	key, val, err = db.BRPop(context.Background(), time.Second, []byte("l1"), []byte("l2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("l2"), key)
+	assert.Equal(t, []byte("b"), val)
+	assert.Equal(t, 0, db.Exists([]byte("l2")))
+
+	// Timeout.
+	start := time.Now()
+	key, val, err = db.BLPop(context.Background(), 50*time.Millisecond, []byte("l1"))
+	assert.Nil(t, err)
+	assert.Nil(t, key)
+	assert.Nil(t, val)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	// Cancellation.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	_, _, err = db.BLPop(ctx, 0, []byte("l1"))
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, db.listIndex.blocking.clients)
+
+	_, _, err = db.BLPop(context.Background(), 0)
+	assert.Equal(t, ErrInvalidNumberOfArgs, err)
+}
+
+func TestKhighDB_BLPop_Wake(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	type result struct {
+		key, val []byte
+	}
+	blockPop := func(keys ...[]byte) chan result {
+		results := make(chan result, 1)
+		go func() {
+			key, val, err := db.BLPop(context.Background(), 0, keys...)
+			assert.Nil(t, err)
+			results <- result{key, val}
+		}()
+		return results
+	}
+	waitBlocked := func(key string, n int) {
+		for {
+			db.listIndex.mu.RLock()
+			queue := db.listIndex.blocking.clients[key]
+			blocked := queue != nil && queue.Len() == n
+			db.listIndex.mu.RUnlock()
+			if blocked {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// The clients are served in FIFO order.
+	r1 := blockPop([]byte("l1"))
+	waitBlocked("l1", 1)
+	r2 := blockPop([]byte("l2"), []byte("l1"))
+	waitBlocked("l1", 2)
+	r3 := blockPop([]byte("l1"))
+	waitBlocked("l1", 3)
+
+	assert.Nil(t, db.RPush([]byte("l1"), []byte("a"), []byte("b")))
+	assert.Equal(t, result{[]byte("l1"), []byte("a")}, <-r1)
+	assert.Equal(t, result{[]byte("l1"), []byte("b")}, <-r2)
+	assert.Equal(t, 0, db.LLen([]byte("l1")))
+	assert.Nil(t, db.LPush([]byte("l1"), []byte("c")))
+	assert.Equal(t, result{[]byte("l1"), []byte("c")}, <-r3)
+	assert.Empty(t, db.listIndex.blocking.clients)
+	assert.Equal(t, 0, db.DBSize())
+}
+
+func TestKhighDB_BLMove(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	results := make(chan []byte, 2)
+	go func() {
+		val, err := db.BLMove(context.Background(), 0, []byte("src"), []byte("dst"), true, false)
+		assert.Nil(t, err)
+		results <- val
+	}()
+	// The client blocked on dst is woken by BLMove.
+	go func() {
+		_, val, err := db.BRPop(context.Background(), time.Second, []byte("dst"))
+		assert.Nil(t, err)
+		results <- val
+	}()
+	for {
+		db.listIndex.mu.RLock()
+		blocked := len(db.listIndex.blocking.clients) == 2
+		db.listIndex.mu.RUnlock()
+		if blocked {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.Nil(t, db.RPush([]byte("src"), []byte("a")))
+	assert.Equal(t, []byte("a"), <-results)
+	assert.Equal(t, []byte("a"), <-results)
+	assert.Equal(t, 0, db.DBSize())
+
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	assert.Nil(t, db.RPush([]byte("src"), []byte("a")))
+	_, err := db.BLMove(context.Background(), time.Second, []byte("src"), []byte("str"), true, true)
+	assert.Equal(t, ErrWrongType, err)
+	assert.Equal(t, 1, db.LLen([]byte("src")))
+}
+
+func TestKhighDB_BLPop_Close(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer func() { destroyDB(db) }()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := db.BLPop(context.Background(), 0, []byte("l1"))
+		errs <- err
+	}()
+	for {
+		db.listIndex.mu.RLock()
+		blocked := len(db.listIndex.blocking.clients) == 1
+		db.listIndex.mu.RUnlock()
+		if blocked {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.Nil(t, db.Close())
+	assert.Equal(t, ErrDBClosed, <-errs)
+	db = newKhighDB(FileIO, KeyOnlyMemMode)
+}
+
+func TestKhighDB_BZPopMin(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	// The member is popped without blocking.
+	assert.Nil(t, db.ZAdd([]byte("z2"), 2, []byte("b")))
+	assert.Nil(t, db.ZAdd([]byte("z2"), 1, []byte("a")))
+	key, member, err := db.BZPopMin(context.Background(), time.Second, []byte("z1"), []byte("z2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("z2"), key)
+	assert.Equal(t, &ZMember{Member: []byte("a"), Score: 1}, member)
+	key, member, err = db.BZPopMax(context.Background(), time.Second, []byte("z2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("z2"), key)
+	assert.Equal(t, &ZMember{Member: []byte("b"), Score: 2}, member)
+	assert.Equal(t, 0, db.Exists([]byte("z2")))
+
+	// Timeout.
+	key, member, err = db.BZPopMin(context.Background(), 20*time.Millisecond, []byte("z1"))
+	assert.Nil(t, err)
+	assert.Nil(t, key)
+	assert.Nil(t, member)
+
+	// The blocked clients are woken in FIFO order.
+	results := make(chan *ZMember, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, member, err := db.BZPopMin(context.Background(), 0, []byte("z1"))
+			assert.Nil(t, err)
+			results <- member
+		}()
+		for {
+			db.zsetIndex.mu.RLock()
+			queue := db.zsetIndex.blocking.clients["z1"]
+			blocked := queue != nil && queue.Len() == i+1
+			db.zsetIndex.mu.RUnlock()
+			if blocked {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	assert.Nil(t, db.ZAdd([]byte("z1"), 3, []byte("c")))
+	assert.Equal(t, &ZMember{Member: []byte("c"), Score: 3}, <-results)
+	n, err := db.ZUnionStore([]byte("z1"), ZSetOpOptions{}, []byte("z3"), []byte("z4"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Nil(t, db.ZAdd([]byte("z3"), 4, []byte("d")))
+	_, err = db.ZUnionStore([]byte("z1"), ZSetOpOptions{}, []byte("z3"))
+	assert.Nil(t, err)
+	assert.Equal(t, &ZMember{Member: []byte("d"), Score: 4}, <-results)
+	assert.Equal(t, 0, db.Exists([]byte("z1")))
+	assert.Empty(t, db.zsetIndex.blocking.clients)
+}
@@ -11,7 +11,9 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"github.com/Khighness/khighdb/cache"
 	"github.com/Khighness/khighdb/data/art"
+	"github.com/Khighness/khighdb/data/stream"
 	"github.com/Khighness/khighdb/data/zset"
 	"github.com/Khighness/khighdb/flock"
 	"github.com/Khighness/khighdb/logger"
@@ -20,7 +22,7 @@ import (
 )
 
 // @Author KHighness
-// @Update 2022-12-26
+// @Update 2023-01-26
 
 func init() {
 	logger.InitLogger(zapcore.DebugLevel)
@@ -35,16 +37,69 @@ var (
 	ErrInvalidNumberOfArgs = errors.New("invalid number of arguments")
 	// ErrInvalidValueType represents the type of value is invalid.
 	ErrInvalidValueType = errors.New("value is not an integer")
+	// ErrInvalidFloatValue represents the value is not a valid float.
+	ErrInvalidFloatValue = errors.New("value is not a valid float")
+	// ErrFloatOverflow represents the result after increment is NaN or Infinity.
+	ErrFloatOverflow = errors.New("increment would produce NaN or Infinity")
+	// ErrConflictingOptions represents the options of SetWithOptions or GetEX conflict with each other.
+	ErrConflictingOptions = errors.New("conflicting options")
+	// ErrInvalidExpireTime represents the expiration time is not positive.
+	ErrInvalidExpireTime = errors.New("invalid expire time")
+	// ErrStrTooLarge represents the string value exceeds the max size.
+	ErrStrTooLarge = errors.New("string exceeds maximum allowed size")
+	// ErrLCSTooLarge represents the strings are too long to compute the longest common subsequence.
+	ErrLCSTooLarge = errors.New("strings are too long to compute LCS")
 	// ErrIntegerOverflow represents the result after increment or decrement overflows int64 limitations.
 	ErrIntegerOverflow = errors.New("increment or decrement overflow")
+	// ErrInvalidCount represents the count is not positive.
+	ErrInvalidCount = errors.New("count must be positive")
 	// ErrIndexOutOfRange represents the index is out of range,
 	ErrIndexOutOfRange = errors.New("index is out of range")
+	// ErrDBClosed represents the db is closed.
+	ErrDBClosed = errors.New("db is closed")
 	// ErrLogFileGCRunning represents log file gc is running.
 	ErrLogFileGCRunning = errors.New("log file gc is running, retry later")
+	// ErrFormatUpgradeRequired represents the db directory is written in an older format version,
+	// which should be migrated by khighdb-upgrade before opening.
+	ErrFormatUpgradeRequired = errors.New("db format is outdated, run khighdb-upgrade first")
+	// ErrBitOffsetOutOfRange represents the bit offset of bitmap is out of range.
+	ErrBitOffsetOutOfRange = errors.New("bit offset is out of range")
+	// ErrInvalidBitFieldType represents the integer type of bitfield is invalid.
+	ErrInvalidBitFieldType = errors.New("invalid bitfield type")
+	// ErrInvalidHyperLogLog represents the string value is not a valid HyperLogLog.
+	ErrInvalidHyperLogLog = errors.New("value is not a valid hyperloglog")
+	// ErrInvalidCoordinates represents the longitude or latitude of location is out of range.
+	ErrInvalidCoordinates = errors.New("invalid longitude,latitude pair")
+	// ErrGeoMemberNotFound represents the member as the center of geo search is not found.
+	ErrGeoMemberNotFound = errors.New("could not decode requested zset member")
+	// ErrInvalidStreamID represents the stream ID is invalid.
+	ErrInvalidStreamID = errors.New("invalid stream ID specified as stream command argument")
+	// ErrStreamIDTooSmall represents the ID of the new stream entry is not greater than the last one.
+	ErrStreamIDTooSmall = errors.New("the ID specified in XADD is equal or smaller than the target stream top item")
+	// ErrStreamIDZero represents the ID of the new stream entry is 0-0.
+	ErrStreamIDZero = errors.New("the ID specified in XADD must be greater than 0-0")
+	// ErrStreamIDExhausted represents no more stream entry can be added.
+	ErrStreamIDExhausted = errors.New("the stream has exhausted the last possible ID, unable to add more items")
+	// ErrStreamNoGroup represents the stream or the consumer group does not exist.
+	ErrStreamNoGroup = errors.New("no such key or consumer group")
+	// ErrStreamGroupExists represents the consumer group already exists.
+	ErrStreamGroupExists = errors.New("consumer group name already exists")
+	// ErrInvalidJSON represents the value is not a valid JSON value.
+	ErrInvalidJSON = errors.New("invalid JSON value")
+	// ErrInvalidJSONPath represents the JSON path is invalid.
+	ErrInvalidJSONPath = errors.New("invalid JSON path")
+	// ErrJSONNewRootPath represents a new document is set at a path other than the root.
+	ErrJSONNewRootPath = errors.New("new objects must be created at the root")
+	// ErrJSONPathNotFound represents the legacy JSON path matches no value.
+	ErrJSONPathNotFound = errors.New("JSON path does not exist")
+	// ErrJSONInvalidNumber represents the number of JSON arithmetic is invalid.
+	ErrJSONInvalidNumber = errors.New("the value is not a valid JSON number")
+	// ErrJSONNumberOverflow represents the result of JSON arithmetic is not a finite number.
+	ErrJSONNumberOverflow = errors.New("the result of JSON arithmetic is not a finite number")
 )
 
 const (
-	logFileTypeNum   = 5
+	logFileTypeNum   = 7
 	encodeHeaderSize = 10
 	discardFilePath  = "DISCARD"
 	lockFileName     = "FLOCK"
@@ -57,11 +112,15 @@ type KhighDB struct {
 	fidMap           map[DataType][]uint32
 	discards         map[DataType]*discard
 	options          Options
+	readCache        *cache.Cache
 	strIndex         *strIndex
 	listIndex        *listIndex
 	hashIndex        *hashIndex
 	setIndex         *setIndex
 	zsetIndex        *zsetIndex
+	streamIndex      *streamIndex
+	jsonIndex        *jsonIndex
+	keyTypes         *keyTypeIndex
 	mu               sync.RWMutex
 	fileLock         *flock.FileLockGuard
 	closed           uint32
@@ -75,6 +134,7 @@ type (
 		fid       uint32
 		offset    int64
 		entrySize int
+		vptr      *valuePtr // this is nil if the value is not separated
 	}
 
 	indexNode struct {
@@ -82,7 +142,9 @@ type (
 		offset    int64
 		entrySize int
 		expiredAt int64
-		value     []byte // this is nil in KeyOnlyMemMode
+		value     []byte      // this is nil in KeyOnlyMemMode
+		vptr      *valuePtr   // this is nil if the value is not separated
+		patches   []*strPatch // the patches applied on the string value in order
 	}
 
 	strIndex struct {
@@ -93,24 +155,53 @@ type (
 	listIndex struct {
 		mu    *sync.RWMutex
 		trees map[string]*art.AdaptiveRadixTree
+		// inserts holds the positions of the elements inserted by LInsert of each list.
+		inserts  map[string]*listInserts
+		blocking *blockingKeys
 	}
 
 	hashIndex struct {
 		mu    *sync.RWMutex
 		trees map[string]*art.AdaptiveRadixTree
+		// expires indexes the fields with time to live of each hash by their expiration time
+		// in milliseconds, see hExpireScore.
+		expires *zset.SortedSet
 	}
 
 	setIndex struct {
-		mu      *sync.RWMutex
-		murhash *util.Murmur128
-		trees   map[string]*art.AdaptiveRadixTree
+		mu    *sync.RWMutex
+		trees map[string]*art.AdaptiveRadixTree
 	}
 
 	zsetIndex struct {
-		mu      *sync.RWMutex
-		indexes *zset.SortedSet
-		murhash *util.Murmur128
-		trees   map[string]*art.AdaptiveRadixTree
+		mu       *sync.RWMutex
+		indexes  *zset.SortedSet
+		trees    map[string]*art.AdaptiveRadixTree
+		blocking *blockingKeys
+	}
+
+	streamIndex struct {
+		mu       *sync.RWMutex
+		streams  map[string]*stream.Stream
+		trees    map[string]*art.AdaptiveRadixTree
+		blocking *blockingKeys
+	}
+
+	jsonIndex struct {
+		mu    *sync.RWMutex
+		trees map[string]*art.AdaptiveRadixTree
+	}
+
+	// keyTypeIndex records the data types of the keys of List, Hash, Set, ZSet, Stream and JSON.
+	// The keys are held by a tree, so that they can be scanned in order.
+	// Its lock is always acquired after the locks of other indexes.
+	keyTypeIndex struct {
+		mu    *sync.Mutex
+		types *art.AdaptiveRadixTree
+		// deadlines records the time in nanoseconds after which the hash has no live fields,
+		// only for the hashes whose fields all have time to live. The hash is regarded as not
+		// existing after its deadline.
+		deadlines map[string]int64
 	}
 )
 
@@ -123,32 +214,58 @@ func newStrsIndex() *strIndex {
 
 func newListIndex() *listIndex {
 	return &listIndex{
-		trees: make(map[string]*art.AdaptiveRadixTree),
-		mu:    new(sync.RWMutex),
+		trees:    make(map[string]*art.AdaptiveRadixTree),
+		inserts:  make(map[string]*listInserts),
+		mu:       new(sync.RWMutex),
+		blocking: newBlockingKeys(),
 	}
 }
 
 func newHashIndex() *hashIndex {
 	return &hashIndex{
-		trees: make(map[string]*art.AdaptiveRadixTree),
-		mu:    new(sync.RWMutex),
+		trees:   make(map[string]*art.AdaptiveRadixTree),
+		mu:      new(sync.RWMutex),
+		expires: zset.New(),
 	}
 }
 
 func newSetIndex() *setIndex {
 	return &setIndex{
-		mu:      new(sync.RWMutex),
-		murhash: util.NewMurmur128(),
-		trees:   make(map[string]*art.AdaptiveRadixTree),
+		mu:    new(sync.RWMutex),
+		trees: make(map[string]*art.AdaptiveRadixTree),
 	}
 }
 
 func newZSetIndex() *zsetIndex {
 	return &zsetIndex{
-		mu:      new(sync.RWMutex),
-		indexes: zset.New(),
-		murhash: util.NewMurmur128(),
-		trees:   make(map[string]*art.AdaptiveRadixTree),
+		mu:       new(sync.RWMutex),
+		indexes:  zset.New(),
+		trees:    make(map[string]*art.AdaptiveRadixTree),
+		blocking: newBlockingKeys(),
+	}
+}
+
+func newStreamIndex() *streamIndex {
+	return &streamIndex{
+		mu:       new(sync.RWMutex),
+		streams:  make(map[string]*stream.Stream),
+		trees:    make(map[string]*art.AdaptiveRadixTree),
+		blocking: newBlockingKeys(),
+	}
+}
+
+func newJSONIndex() *jsonIndex {
+	return &jsonIndex{
+		mu:    new(sync.RWMutex),
+		trees: make(map[string]*art.AdaptiveRadixTree),
+	}
+}
+
+func newKeyTypeIndex() *keyTypeIndex {
+	return &keyTypeIndex{
+		mu:        new(sync.Mutex),
+		types:     art.NewART(),
+		deadlines: make(map[string]int64),
 	}
 }
 
@@ -172,15 +289,25 @@ func Open(options Options) (*KhighDB, error) {
 	}
 	zap.S().Infof("Succeed to acquire flock of [%s]", lockPath)
 
+	// Check the format version of the directory.
+	if err = checkManifest(options.DBPath); err != nil {
+		_ = lockGuard.Release()
+		return nil, err
+	}
+
 	db := &KhighDB{
 		activeLogFiles:   make(map[DataType]*storage.LogFile),
 		archivedLogFiles: make(map[DataType]archivedFiles),
 		options:          options,
+		readCache:        newReadCache(options),
 		strIndex:         newStrsIndex(),
 		listIndex:        newListIndex(),
 		hashIndex:        newHashIndex(),
 		setIndex:         newSetIndex(),
 		zsetIndex:        newZSetIndex(),
+		streamIndex:      newStreamIndex(),
+		jsonIndex:        newJSONIndex(),
+		keyTypes:         newKeyTypeIndex(),
 		fileLock:         lockGuard,
 	}
 
@@ -199,6 +326,7 @@ func Open(options Options) (*KhighDB, error) {
 	if err := db.loadIndexFromLogFiles(); err != nil {
 		return nil, err
 	}
+	db.loadKeyTypes()
 
 	go db.handleLogFileGC()
 	zap.L().Info("KhighDB is opened successfully")
@@ -207,6 +335,17 @@ func Open(options Options) (*KhighDB, error) {
 
 // Close closes the KhighDB instance and saves relative configs.
 func (db *KhighDB) Close() error {
+	// Unblock the blocked clients, since the indexes are reset below.
+	db.listIndex.mu.Lock()
+	db.listIndex.blocking.unblockAll(ErrDBClosed)
+	db.listIndex.mu.Unlock()
+	db.zsetIndex.mu.Lock()
+	db.zsetIndex.blocking.unblockAll(ErrDBClosed)
+	db.zsetIndex.mu.Unlock()
+	db.streamIndex.mu.Lock()
+	db.streamIndex.blocking.unblockAll(ErrDBClosed)
+	db.streamIndex.mu.Unlock()
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
@@ -237,6 +376,9 @@ func (db *KhighDB) Close() error {
 	db.listIndex = nil
 	db.setIndex = nil
 	db.zsetIndex = nil
+	db.streamIndex = nil
+	db.jsonIndex = nil
+	db.keyTypes = nil
 
 	// Release the file lock.
 	if db.fileLock != nil {
@@ -288,6 +430,11 @@ func (db *KhighDB) BackUp(path string) error {
 	return util.CopyDir(db.options.DBPath, path)
 }
 
+// RunValueLogGC executes value log garbage collection manually.
+func (db *KhighDB) RunValueLogGC(fid int, gcRatio float64) error {
+	return db.RunLogFileGC(valueLogType, fid, gcRatio)
+}
+
 // RunLogFileGC executes log file garbage collection manually.
 func (db *KhighDB) RunLogFileGC(dataType DataType, fid int, gcRatio float64) error {
 	if atomic.LoadInt32(&db.gcState) > 0 {
@@ -296,11 +443,11 @@ func (db *KhighDB) RunLogFileGC(dataType DataType, fid int, gcRatio float64) err
 	return db.doRunGC(dataType, fid, gcRatio)
 }
 
-// openKeyValueMemMode judges if db's index mode is equal to KeyValueMemMode.
-// Returning true represents both read and write operations of value are performed
-// in memory without disk intervention.
-func (db *KhighDB) openKeyValueMemMode() bool {
-	return db.options.IndexMode == KeyValueMemMode
+// openKeyValueMemMode judges if the index mode of the specified data type is equal to
+// KeyValueMemMode. Returning true represents both read and write operations of value
+// are performed in memory without disk intervention.
+func (db *KhighDB) openKeyValueMemMode(dataType DataType) bool {
+	return db.options.indexMode(dataType) == KeyValueMemMode
 }
 
 // isClosed checks if the db has been closed.
@@ -327,6 +474,35 @@ func (db *KhighDB) getArchivedLogFile(dataType DataType, fid uint32) *storage.Lo
 	return logFile
 }
 
+// hasArchivedLogFileBefore checks if there is any archived log file of the data type whose fid
+// is less than the specified fid.
+func (db *KhighDB) hasArchivedLogFileBefore(dataType DataType, fid uint32) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for id := range db.archivedLogFiles[dataType] {
+		if id < fid {
+			return true
+		}
+	}
+	return false
+}
+
+// oldestLogFileId returns the fid of the oldest log file of the data type.
+func (db *KhighDB) oldestLogFileId(dataType DataType) uint32 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var oldest uint32
+	if activeLogFile := db.activeLogFiles[dataType]; activeLogFile != nil {
+		oldest = activeLogFile.Fid
+	}
+	for id := range db.archivedLogFiles[dataType] {
+		if id < oldest {
+			oldest = id
+		}
+	}
+	return oldest
+}
+
 // encodeKey encodes the key and sub key into a byte slice.
 func (db *KhighDB) encodeKey(key, subkey []byte) []byte {
 	header := make([]byte, encodeHeaderSize)
@@ -365,6 +541,16 @@ func (db *KhighDB) writeLogEntry(ent *storage.LogEntry, dataType DataType) (*val
 		return nil, ErrLogFileNotFound
 	}
 
+	// Separate the large value into value log, only the pointer is kept in log file.
+	var vptr *valuePtr
+	if db.separateValue(ent, dataType) {
+		ptrEnt, ptr, err := db.writeValueLog(ent, dataType)
+		if err != nil {
+			return nil, err
+		}
+		ent, vptr = ptrEnt, ptr
+	}
+
 	options := db.options
 	entBuf, entSize := storage.EncodeEntry(ent)
 
@@ -406,8 +592,33 @@ func (db *KhighDB) writeLogEntry(ent *storage.LogEntry, dataType DataType) (*val
 			return nil, err
 		}
 	}
-	return &valuePos{
-		fid:    activeLogFile.Fid,
-		offset: writeAt,
-	}, nil
+	pos := &valuePos{
+		fid:       activeLogFile.Fid,
+		offset:    writeAt,
+		entrySize: entSize,
+		vptr:      vptr,
+	}
+	// The delete entry is garbage itself once no older log file depends on it.
+	if ent.Type == storage.TypeDelete || ent.Type == storage.TypeKeyDelete {
+		if !db.keepTombstone(ent, pos, dataType) {
+			db.discardEntry(pos.fid, pos.entrySize, dataType)
+		}
+	}
+	return pos, nil
+}
+
+// batchPositions returns the positions of the entries in the batch entry at pos, whose value
+// is valueSize bytes long and encoded by the entries at offsets.
+func batchPositions(pos *valuePos, valueSize int, offsets []int64) []*valuePos {
+	// The value is at the end of the batch entry.
+	valueOffset := pos.offset + int64(pos.entrySize-valueSize)
+	positions := make([]*valuePos, len(offsets)-1)
+	for i := range positions {
+		positions[i] = &valuePos{
+			fid:       pos.fid,
+			offset:    valueOffset + offsets[i],
+			entrySize: int(offsets[i+1] - offsets[i]),
+		}
+	}
+	return positions
 }
@@ -55,6 +55,49 @@ func TestKhighDB_encodeKey_decodeKey(t *testing.T) {
 	assert.Equal(t, field, string(fieldBuf))
 }
 
+func TestKhighDB_IndexMemStats(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB")
+	opts := DefaultOptions(path)
+	opts.IndexMode = KeyOnlyMemMode
+	opts.IndexModes = map[DataType]DataIndexMode{Hash: KeyValueMemMode}
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	value := getValue16B()
+	assert.Nil(t, db.Set(getKey(1), value))
+	assert.Nil(t, db.RPush(getKey(2), value, value))
+	assert.Nil(t, db.HSet(getKey(3), []byte("a"), value, []byte("b"), value))
+
+	check := func(db *KhighDB) {
+		stats := db.IndexMemStats()
+		assert.Equal(t, KeyOnlyMemMode, stats[String].Mode)
+		assert.Equal(t, 1, stats[String].Keys)
+		assert.Equal(t, int64(0), stats[String].ValueSize)
+		assert.Equal(t, KeyOnlyMemMode, stats[List].Mode)
+		assert.Equal(t, int64(0), stats[List].ValueSize)
+		assert.Equal(t, KeyValueMemMode, stats[Hash].Mode)
+		assert.Equal(t, 2, stats[Hash].Keys)
+		assert.Equal(t, int64(2*len(value)), stats[Hash].ValueSize)
+
+		val, err := db.HGet(getKey(3), []byte("a"))
+		assert.Nil(t, err)
+		assert.Equal(t, value, val)
+		val, err = db.LIndex(getKey(2), 0)
+		assert.Nil(t, err)
+		assert.Equal(t, value, val)
+	}
+	check(db)
+
+	// The index modes are honored while loading indexes from log files.
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check(db)
+}
+
 func newKhighDB(ioType IOType, mode DataIndexMode) *KhighDB {
 	path := filepath.Join("/tmp", "KhighDB")
 	options := DefaultOptions(path)
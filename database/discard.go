@@ -15,14 +15,15 @@ import (
 )
 
 // @Author KHighness
-// @Update 2022-12-27
+// @Update 2023-01-26
 
 const (
 	// discardRecordSize is the size of a discard record.
 	//	size(fid) + size(total size) + size(discarded size) = 12
 	discardRecordSize = 12
 	// discardFileSize is the size of the discard file.
-	//	8KB, contains (8192 / 12 = 682) records.
+	//	8KB, contains (8192 / 12 = 682) slots, the first slot is reserved
+	//	for file header, so there are 681 records at most.
 	discardFileSize int64 = 8 << 10
 	// discardFileName is the name of the discard file.
 	discardFileName = "discard"
@@ -34,10 +35,10 @@ var ErrDiscardNoSpace = errors.New("not enough space can be allocated for the di
 // discard is used to record total size and discarded size in a log file.
 // Mainly for log files compaction.
 //	The structure of discard file:
-//	+-------+--------------+--------------+ +-------+--------------+--------------+
-//	|  fid  |  total size  | discard size | |  fid  |  total size  | discard size |
-//	+-------+--------------+--------------+ +-------+--------------+--------------+
-//	0-------4--------------8-------------12 12------16-------------20------------24
+//	+-------+-----------+----------+ +-------+--------------+--------------+
+//	| magic |  version  | reserved | |  fid  |  total size  | discard size | ...
+//	+-------+-----------+----------+ +-------+--------------+--------------+
+//	0-------4-----------8---------12 12------16-------------20------------24
 type discard struct {
 	sync.Mutex
 	once     *sync.Once
@@ -45,6 +46,9 @@ type discard struct {
 	file     ioselector.IOSelector
 	freeList []int64          // contains file offset that can be allocated
 	location map[uint32]int64 // offset of each fid
+	// tombstones contains the sizes of the delete entries which are still needed, indexed by
+	// the fid before which the deleted entries might be, and the fid of the delete entries.
+	tombstones map[uint32]map[uint32]int
 }
 
 // newDiscard creates a discard internally.
@@ -55,10 +59,16 @@ func newDiscard(path, name string, bufferSize int) (*discard, error) {
 		return nil, err
 	}
 
+	if err = initDiscardHeader(file); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
 	var freeList []int64
-	var offset int64
+	var offset int64 = discardRecordSize
 	location := make(map[uint32]int64)
-	for {
+	// The space at the end of file which is smaller than a record is not used.
+	for offset+discardRecordSize <= discardFileSize {
 		// Read fid and total size.
 		buf := make([]byte, 8)
 		if _, err = file.Read(buf, offset); err != nil {
@@ -78,16 +88,35 @@ func newDiscard(path, name string, bufferSize int) (*discard, error) {
 	}
 
 	d := &discard{
-		once:     new(sync.Once),
-		nodeChan: make(chan *indexNode, bufferSize),
-		file:     file,
-		freeList: freeList,
-		location: location,
+		once:       new(sync.Once),
+		nodeChan:   make(chan *indexNode, bufferSize),
+		file:       file,
+		freeList:   freeList,
+		location:   location,
+		tombstones: make(map[uint32]map[uint32]int),
 	}
 	go d.listenUpdates()
 	return d, nil
 }
 
+// initDiscardHeader writes the file header for a new discard file, or checks
+// the format version in the file header of an existing discard file.
+func initDiscardHeader(file ioselector.IOSelector) error {
+	buf := make([]byte, discardRecordSize)
+	if _, err := file.Read(buf, 0); err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint64(buf[:8]) == 0 && binary.LittleEndian.Uint32(buf[8:]) == 0 {
+		_, err := file.Write(storage.EncodeFileHeader(storage.CurrentFormatVersion), 0)
+		return err
+	}
+	version, ok := storage.DecodeFileHeader(buf)
+	if !ok || version < storage.FormatV2 || !version.Supported() {
+		return storage.ErrUnsupportedFormatVersion
+	}
+	return nil
+}
+
 func (d *discard) sync() error {
 	return d.file.Sync()
 }
@@ -99,9 +128,9 @@ func (d *discard) close() error {
 // getCCL returns the compaction candidate fid list that does not
 // contain the fix of active log file.
 // Iterate and find the archived log file with most discarded data.
-// There are 682 records at most, regardless of performance.
+// There are 681 records at most, regardless of performance.
 func (d *discard) getCCL(activeFid uint32, ratio float64) ([]uint32, error) {
-	var offset int64
+	var offset int64 = discardRecordSize
 	var ccl []uint32
 	d.Lock()
 	defer d.Unlock()
@@ -193,6 +222,38 @@ func (d *discard) clear(fid uint32) {
 	}
 }
 
+// addTombstone records the size of the delete entry in log file fid, which is needed until
+// there is no log file before depFid.
+func (d *discard) addTombstone(depFid, fid uint32, entrySize int) {
+	d.Lock()
+	defer d.Unlock()
+	if d.tombstones[depFid] == nil {
+		d.tombstones[depFid] = make(map[uint32]int)
+	}
+	d.tombstones[depFid][fid] += entrySize
+}
+
+// releaseTombstones forgets the delete entries in the deleted log file, and returns the sizes
+// of the delete entries which are no longer needed indexed by their fids, since there is no log
+// file before oldestFid now.
+func (d *discard) releaseTombstones(deletedFid, oldestFid uint32) map[uint32]int {
+	d.Lock()
+	defer d.Unlock()
+	released := make(map[uint32]int)
+	for depFid, sizes := range d.tombstones {
+		delete(sizes, deletedFid)
+		if depFid <= oldestFid {
+			for fid, size := range sizes {
+				released[fid] += size
+			}
+			delete(d.tombstones, depFid)
+		} else if len(sizes) == 0 {
+			delete(d.tombstones, depFid)
+		}
+	}
+	return released
+}
+
 func (d *discard) incrDiscard(fid uint32, entrySize int) {
 	if entrySize > 0 {
 		d.incr(fid, entrySize)
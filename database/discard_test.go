@@ -9,7 +9,7 @@ import (
 )
 
 // @Author KHighness
-// @Update 2022-12-28
+// @Update 2023-01-26
 
 //func init() {
 //	logger.InitLogger(zapcore.DebugLevel)
@@ -26,7 +26,7 @@ func TestDiscard_newDiscard(t *testing.T) {
 		assert.Nil(t, os.RemoveAll(path))
 	}()
 
-	assert.Equal(t, len(d.freeList), 682)
+	assert.Equal(t, len(d.freeList), 681)
 	assert.Equal(t, len(d.location), 0)
 }
 
@@ -46,7 +46,7 @@ func TestDiscard_setTotal(t *testing.T) {
 		d.incrDiscard(uint32(i), i*10)
 	}
 
-	assert.Equal(t, len(d.freeList), 678)
+	assert.Equal(t, len(d.freeList), 677)
 	assert.Equal(t, len(d.location), 4)
 
 	d2, err := newDiscard(path, discardFileName, 8192)
@@ -54,7 +54,7 @@ func TestDiscard_setTotal(t *testing.T) {
 		assert.Nil(t, d2.file.Close())
 	}()
 	assert.Nil(t, nil)
-	assert.Equal(t, len(d2.freeList), 678)
+	assert.Equal(t, len(d2.freeList), 677)
 	assert.Equal(t, len(d2.location), 4)
 }
 
@@ -73,7 +73,7 @@ func TestDiscard_clear(t *testing.T) {
 		d.setTotal(uint32(i), 333)
 	}
 
-	assert.Equal(t, len(d.freeList), 678)
+	assert.Equal(t, len(d.freeList), 677)
 	assert.Equal(t, len(d.location), 4)
 
 	type args struct {
@@ -85,10 +85,10 @@ func TestDiscard_clear(t *testing.T) {
 		args args
 		want int
 	}{
-		{"clear-1", d, args{1}, 679},
-		{"clear-5", d, args{5}, 680},
-		{"clear-25", d, args{25}, 681},
-		{"clear-125", d, args{125}, 682},
+		{"clear-1", d, args{1}, 678},
+		{"clear-5", d, args{5}, 679},
+		{"clear-25", d, args{25}, 680},
+		{"clear-125", d, args{125}, 681},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -169,3 +169,32 @@ func TestDiscard_getCCL(t *testing.T) {
 		assert.Equal(t, 3, len(ccl))
 	})
 }
+
+func TestDiscard_releaseTombstones(t *testing.T) {
+	path := filepath.Join("/tmp", "khighdb-discard")
+	err := os.MkdirAll(path, os.ModePerm)
+	assert.Nil(t, err)
+	d, err := newDiscard(path, discardFileName, 8192)
+	assert.Nil(t, err)
+	defer func() {
+		assert.Nil(t, d.file.Close())
+		assert.Nil(t, os.RemoveAll(path))
+	}()
+
+	// The delete entries in log file 3 depend on log files 1 and 2, and the delete entry
+	// in log file 4 depends on the log files before 3 only.
+	d.addTombstone(3, 3, 10)
+	d.addTombstone(3, 3, 20)
+	d.addTombstone(3, 4, 5)
+	d.addTombstone(4, 4, 40)
+	d.addTombstone(4, 5, 50)
+
+	// Log file 1 is deleted, log file 2 is still needed.
+	assert.Empty(t, d.releaseTombstones(1, 2))
+	// Log file 2 is deleted, the delete entries depending on log file 3 are released.
+	assert.Equal(t, map[uint32]int{3: 30, 4: 5}, d.releaseTombstones(2, 3))
+	// Log file 4 is deleted before log file 3, its delete entry is forgotten.
+	assert.Empty(t, d.releaseTombstones(4, 3))
+	assert.Equal(t, map[uint32]int{5: 50}, d.releaseTombstones(3, 5))
+	assert.Empty(t, d.tombstones)
+}
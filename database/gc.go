@@ -10,11 +10,12 @@ import (
 
 	"go.uber.org/zap"
 
+	"github.com/Khighness/khighdb/data/art"
 	"github.com/Khighness/khighdb/storage"
 )
 
 // @Author KHighness
-// @Update 2022-12-31
+// @Update 2023-01-26
 
 // sendDiscard sends a node to the discard node channel to increase discard size when
 // the key-value pair is updated or deleted. If updated is false, nothing will be done.
@@ -23,7 +24,11 @@ func (db *KhighDB) sendDiscard(oldNode interface{}, updated bool, dataType DataT
 		return
 	}
 	node, _ := oldNode.(*indexNode)
-	if node == nil || node.entrySize <= 0 {
+	if node == nil {
+		return
+	}
+	db.evictCachedVal(dataType, node)
+	if node.entrySize <= 0 {
 		return
 	}
 	select {
@@ -31,6 +36,92 @@ func (db *KhighDB) sendDiscard(oldNode interface{}, updated bool, dataType DataT
 	default:
 		zap.L().Warn("Failed to send node to discard channel")
 	}
+	// The patches of the value are also useless.
+	for _, p := range node.patches {
+		select {
+		case db.discards[dataType].nodeChan <- &indexNode{fid: p.fid, entrySize: p.entrySize}:
+		default:
+			zap.L().Warn("Failed to send node to discard channel")
+		}
+	}
+	// The separated value is also useless.
+	if node.vptr != nil {
+		vnode := &indexNode{fid: node.vptr.fid, entrySize: node.vptr.entrySize}
+		select {
+		case db.discards[valueLogType].nodeChan <- vnode:
+		default:
+			zap.L().Warn("Failed to send node to discard channel")
+		}
+	}
+}
+
+// discardTree sends all the nodes of the index tree to discard channel, since the tree is
+// deleted as a whole.
+func (db *KhighDB) discardTree(idxTree *art.AdaptiveRadixTree, dataType DataType) {
+	idxTree.ForEachPrefix(nil, func(_ []byte, value interface{}) bool {
+		db.sendDiscard(value, true, dataType)
+		return true
+	})
+}
+
+// keepTombstone records the delete entry at pos if there is any older log file, since the
+// entries it deletes might be in them, and it is not garbage until they are deleted.
+// It returns false if the delete entry is not recorded, which means it is garbage already.
+func (db *KhighDB) keepTombstone(ent *storage.LogEntry, pos *valuePos, dataType DataType) bool {
+	depFid := pos.fid
+	if ent.Type == storage.TypeKeyDelete && len(ent.Value) > 0 {
+		depFid, _ = decodeLogPos(ent.Value)
+	}
+	if !db.hasArchivedLogFileBefore(dataType, depFid) {
+		return false
+	}
+	db.discards[dataType].addTombstone(depFid, pos.fid, pos.entrySize)
+	return true
+}
+
+// releaseTombstones sends the recorded delete entries to discard channel after the log file fid
+// is deleted, if they are no longer needed by the older log files.
+func (db *KhighDB) releaseTombstones(fid uint32, dataType DataType) {
+	released := db.discards[dataType].releaseTombstones(fid, db.oldestLogFileId(dataType))
+	for tombstoneFid, size := range released {
+		db.discardEntry(tombstoneFid, size, dataType)
+	}
+}
+
+// discardEntry sends the entries of the size in log file fid to discard channel, since they are
+// useless themselves, like the delete entries.
+func (db *KhighDB) discardEntry(fid uint32, entrySize int, dataType DataType) {
+	node := &indexNode{fid: fid, entrySize: entrySize}
+	select {
+	case db.discards[dataType].nodeChan <- node:
+	default:
+		zap.L().Warn("Failed to send node to discard channel")
+	}
+}
+
+// deletedElementExists checks if the element deleted by the delete entry exists, which means it
+// has been written again after the delete entry.
+// It must be called with the lock of dataType held.
+func (db *KhighDB) deletedElementExists(ent *storage.LogEntry, dataType DataType) (bool, error) {
+	switch dataType {
+	case String:
+		return db.strIndex.idxTree.Get(ent.Key) != nil, nil
+	case List:
+		listKey, _, _ := db.decodeListKey(ent.Key)
+		idxTree := db.listIndex.trees[string(listKey)]
+		return idxTree != nil && idxTree.Get(ent.Key) != nil, nil
+	case Set, ZSet:
+		idxTree := db.collectionTrees(dataType)[string(ent.Key)]
+		if idxTree == nil {
+			return false, nil
+		}
+		memberKey, err := db.findMember(idxTree, ent.Value, dataType)
+		return memberKey != nil, err
+	default:
+		key, subkey := db.decodeKey(ent.Key)
+		idxTree := db.collectionTrees(dataType)[string(key)]
+		return idxTree != nil && idxTree.Get(subkey) != nil, nil
+	}
 }
 
 // handleLogFileGC starts a ticker to execute gc periodically.
@@ -54,7 +145,11 @@ func (db *KhighDB) handleLogFileGC() {
 				zap.S().Warn("Log file gc is running, skip it")
 				break
 			}
-			for dataType := String; dataType < logFileTypeNum; dataType++ {
+			dataTypes := []DataType{String, List, Hash, Set, ZSet, Stream, JSON}
+			if db.options.ValueLogThreshold > 0 {
+				dataTypes = append(dataTypes, valueLogType)
+			}
+			for _, dataType := range dataTypes {
 				go func(dataType DataType) {
 					err := db.doRunGC(dataType, -1, db.options.LogFileGCRatio)
 					if err != nil {
@@ -75,28 +170,52 @@ func (db *KhighDB) doRunGC(dataType DataType, archivedLogFileId int, gcRatio flo
 	atomic.AddInt32(&db.gcState, 1)
 	defer atomic.AddInt32(&db.gcState, -1)
 
-	maybeRewriteStrs := func(fid uint32, offset int64, ent *storage.LogEntry) error {
-		db.setIndex.mu.Lock()
-		defer db.setIndex.mu.Unlock()
-
-		indexVal := db.strIndex.idxTree.Get(ent.Key)
-		if indexVal == nil {
+	// rewriteIndexNode rewrites the entry to the active log file if the index node still points
+	// to the entry in archived log file, and moves the index node to the new position.
+	rewriteIndexNode := func(idxTree *art.AdaptiveRadixTree, key []byte, fid uint32, offset int64,
+		ent *storage.LogEntry) error {
+		node, _ := idxTree.Get(key).(*indexNode)
+		if node == nil || node.fid != fid || node.offset != offset {
 			return nil
 		}
+		valuePos, err := db.writeLogEntry(ent, dataType)
+		if err != nil {
+			return err
+		}
+		newNode := &indexNode{
+			fid:       valuePos.fid,
+			offset:    valuePos.offset,
+			entrySize: valuePos.entrySize,
+			expiredAt: node.expiredAt,
+			value:     node.value,
+			vptr:      node.vptr,
+		}
+		if valuePos.vptr != nil {
+			newNode.vptr = valuePos.vptr
+		}
+		idxTree.Put(key, newNode)
+		// The value cached by the old position is unreachable now.
+		if node.vptr == nil {
+			db.evictCachedVal(dataType, node)
+		}
+		return nil
+	}
 
-		node, _ := indexVal.(*indexNode)
-		if node != nil && node.fid == fid && node.offset == offset {
-			// rewrite entry
-			valuePos, err := db.writeLogEntry(ent, String)
-			if err != nil {
-				return err
-			}
-			// update index
-			if err = db.updateIndexTree(db.strIndex.idxTree, ent, valuePos, false, String); err != nil {
-				return err
+	maybeRewriteStrs := func(fid uint32, offset int64, ent *storage.LogEntry) error {
+		db.strIndex.mu.Lock()
+		defer db.strIndex.mu.Unlock()
+		// The patches must follow the value, so the patched value is rewritten as a whole.
+		node, _ := db.strIndex.idxTree.Get(ent.Key).(*indexNode)
+		if node != nil && len(node.patches) > 0 {
+			if (node.fid == fid && node.offset == offset) || node.hasStrPatchAt(fid, offset) {
+				return db.compactStrInternal(ent.Key, node)
 			}
+			return nil
 		}
-		return nil
+		if ent.Type == storage.TypeStrPatch {
+			return nil
+		}
+		return rewriteIndexNode(db.strIndex.idxTree, ent.Key, fid, offset, ent)
 	}
 
 	maybeRewriteList := func(fid uint32, offset int64, ent *storage.LogEntry) error {
@@ -104,31 +223,29 @@ func (db *KhighDB) doRunGC(dataType DataType, archivedLogFileId int, gcRatio flo
 		defer db.listIndex.mu.Unlock()
 		var listKey = ent.Key
 		if ent.Type != storage.TypeListMeta {
-			listKey, _ = db.decodeListKey(ent.Key)
+			listKey, _, _ = db.decodeListKey(ent.Key)
 		}
 		if db.listIndex.trees[string(listKey)] == nil {
 			return nil
 		}
 		idxTree := db.listIndex.trees[string(listKey)]
-		indexVal := idxTree.Get(ent.Key)
-		if indexVal == nil {
-			return nil
-		}
+		return rewriteIndexNode(idxTree, ent.Key, fid, offset, ent)
+	}
 
-		node, _ := indexVal.(*indexNode)
-		if node != nil && node.fid == fid && node.offset == offset {
-			valuePos, err := db.writeLogEntry(ent, List)
-			if err != nil {
-				return err
-			}
-			if err = db.updateIndexTree(idxTree, ent, valuePos, false, List); err != nil {
-				return err
-			}
+	maybeRewriteHash := func(fid uint32, offset int64, ent *storage.LogEntry) error {
+		db.hashIndex.mu.Lock()
+		defer db.hashIndex.mu.Unlock()
+		key, field := db.decodeKey(ent.Key)
+		if db.hashIndex.trees[string(key)] == nil {
+			return nil
 		}
-		return nil
+		idxTree := db.hashIndex.trees[string(key)]
+		return rewriteIndexNode(idxTree, field, fid, offset, ent)
 	}
 
-	maybeRewriteHash := func(fid uint32, offset int64, ent *storage.LogEntry) error {
+	// maybeDeleteHash deletes the expired hash field if the index node still points to the entry,
+	// since the value written before it might be found again if the entry is dropped only.
+	maybeDeleteHash := func(fid uint32, offset int64, ent *storage.LogEntry) error {
 		db.hashIndex.mu.Lock()
 		defer db.hashIndex.mu.Unlock()
 		key, field := db.decodeKey(ent.Key)
@@ -136,24 +253,149 @@ func (db *KhighDB) doRunGC(dataType DataType, archivedLogFileId int, gcRatio flo
 			return nil
 		}
 		idxTree := db.hashIndex.trees[string(key)]
-		indexVal := idxTree.Get(field)
-		if indexVal == nil {
+		node, _ := idxTree.Get(field).(*indexNode)
+		if node == nil || node.fid != fid || node.offset != offset {
 			return nil
 		}
+		defer db.releaseKeyIfEmpty(key, Hash)
+		_, err := db.hDelInternal(idxTree, key, field)
+		return err
+	}
 
-		node, _ := indexVal.(*indexNode)
-		if node != nil && node.fid == fid && node.offset == offset {
+	// maybeDeleteStrs deletes the expired key like maybeDeleteHash.
+	maybeDeleteStrs := func(fid uint32, offset int64, ent *storage.LogEntry) error {
+		db.strIndex.mu.Lock()
+		defer db.strIndex.mu.Unlock()
+		node, _ := db.strIndex.idxTree.Get(ent.Key).(*indexNode)
+		if node == nil || node.fid != fid || node.offset != offset {
+			return nil
+		}
+		return db.delInternal(ent.Key)
+	}
 
+	// maybeRewriteDelete rewrites the delete entry to the active log file, since the entries it
+	// deletes might be in the older log files, and they would be found again after reopening if
+	// it was dropped. So it is dropped only if there is no older log file, or the element it
+	// deletes has been written again.
+	maybeRewriteDelete := func(fid uint32, offset int64, ent *storage.LogEntry) error {
+		if ent.Type == storage.TypeKeyDelete {
+			// The key may have been created again, so the key delete entry keeps its original
+			// position to delete only the entries written before it.
+			if len(ent.Value) == 0 {
+				ent.Value = encodeLogPos(fid, offset)
+			}
+			fid, _ = decodeLogPos(ent.Value)
+		}
+		if !db.hasArchivedLogFileBefore(dataType, fid) {
+			return nil
 		}
 
-		return nil
+		mu := db.indexLock(dataType)
+		mu.Lock()
+		defer mu.Unlock()
+		if ent.Type == storage.TypeDelete {
+			exists, err := db.deletedElementExists(ent, dataType)
+			if err != nil || exists {
+				return err
+			}
+		}
+		_, err := db.writeLogEntry(ent, dataType)
+		return err
 	}
 
-	maybaRewriteSets := func(fid uint32, offset int64, ent *storage.LogEntry) error {
-		return nil
+	maybeRewriteSets := func(fid uint32, offset int64, ent *storage.LogEntry) error {
+		// The removal of the moved member from the source set is rewritten as a delete entry,
+		// and the moved member is rewritten as it is added to the destination set.
+		if ent.Type == storage.TypeSetMove {
+			srcKey, dstKey := db.decodeKey(ent.Key)
+			srcEnt := &storage.LogEntry{Key: srcKey, Value: ent.Value, Type: storage.TypeDelete}
+			if err := maybeRewriteDelete(fid, offset, srcEnt); err != nil {
+				return err
+			}
+			ent = &storage.LogEntry{Key: dstKey, Value: ent.Value}
+		}
+		db.setIndex.mu.Lock()
+		defer db.setIndex.mu.Unlock()
+		if db.setIndex.trees[string(ent.Key)] == nil {
+			return nil
+		}
+		idxTree := db.setIndex.trees[string(ent.Key)]
+		memberKey := memberKeyAt(idxTree, ent.Value, fid, offset)
+		if memberKey == nil {
+			return nil
+		}
+		return rewriteIndexNode(idxTree, memberKey, fid, offset, ent)
 	}
 
-	maybaRewriteZSet := func(fid uint32, offset int64, ent *storage.LogEntry) error {
+	maybeRewriteZSet := func(fid uint32, offset int64, ent *storage.LogEntry) error {
+		db.zsetIndex.mu.Lock()
+		defer db.zsetIndex.mu.Unlock()
+		key, _ := db.decodeKey(ent.Key)
+		if db.zsetIndex.trees[string(key)] == nil {
+			return nil
+		}
+		idxTree := db.zsetIndex.trees[string(key)]
+		memberKey := memberKeyAt(idxTree, ent.Value, fid, offset)
+		if memberKey == nil {
+			return nil
+		}
+		return rewriteIndexNode(idxTree, memberKey, fid, offset, ent)
+	}
+
+	maybeRewriteStream := func(fid uint32, offset int64, ent *storage.LogEntry) error {
+		db.streamIndex.mu.Lock()
+		defer db.streamIndex.mu.Unlock()
+		key, subkey := db.decodeKey(ent.Key)
+		if db.streamIndex.trees[string(key)] == nil {
+			return nil
+		}
+		idxTree := db.streamIndex.trees[string(key)]
+		return rewriteIndexNode(idxTree, subkey, fid, offset, ent)
+	}
+
+	maybeRewriteJSON := func(fid uint32, offset int64, ent *storage.LogEntry) error {
+		db.jsonIndex.mu.Lock()
+		defer db.jsonIndex.mu.Unlock()
+		key, subkey := db.decodeKey(ent.Key)
+		if db.jsonIndex.trees[string(key)] == nil {
+			return nil
+		}
+		idxTree := db.jsonIndex.trees[string(key)]
+		return rewriteIndexNode(idxTree, subkey, fid, offset, ent)
+	}
+
+	maybeRewriteEntry := func(fid uint32, offset int64, ent *storage.LogEntry) error {
+		if ent.Type == storage.TypeDelete || ent.Type == storage.TypeKeyDelete {
+			return maybeRewriteDelete(fid, offset, ent)
+		}
+		ts := time.Now().UnixNano()
+		if ent.ExpiredAt != 0 && ent.ExpiredAt <= ts {
+			switch dataType {
+			case String:
+				return maybeDeleteStrs(fid, offset, ent)
+			case Hash:
+				return maybeDeleteHash(fid, offset, ent)
+			}
+			return nil
+		}
+		switch dataType {
+		case String:
+			return maybeRewriteStrs(fid, offset, ent)
+		case List:
+			return maybeRewriteList(fid, offset, ent)
+		case Hash:
+			return maybeRewriteHash(fid, offset, ent)
+		case Set:
+			return maybeRewriteSets(fid, offset, ent)
+		case ZSet:
+			return maybeRewriteZSet(fid, offset, ent)
+		case Stream:
+			return maybeRewriteStream(fid, offset, ent)
+		case JSON:
+			return maybeRewriteJSON(fid, offset, ent)
+		case valueLogType:
+			return db.maybeRewriteValue(fid, offset, ent)
+		}
 		return nil
 	}
 
@@ -161,6 +403,12 @@ func (db *KhighDB) doRunGC(dataType DataType, archivedLogFileId int, gcRatio flo
 	if activeLogFile == nil {
 		return nil
 	}
+	// The expired hash fields are deleted first, so that their space is counted as garbage.
+	if dataType == Hash {
+		if err := db.hPurgeExpired(); err != nil {
+			return err
+		}
+	}
 	if err := db.discards[dataType].sync(); err != nil {
 		return err
 	}
@@ -180,11 +428,11 @@ func (db *KhighDB) doRunGC(dataType DataType, archivedLogFileId int, gcRatio flo
 			continue
 		}
 
-		zap.L().Info("archived log file gc starts", zap.Uint32("fid", fid))
+		zap.L().Info("archived log file gc starts", zap.Int8("dataType", dataType), zap.Uint32("fid", fid))
 		// Transfer the log entries in archived log file to active log file.
-		var offset int64
+		var offset = archivedLogFile.HeaderSize()
 		for {
-			ent, size, err := activeLogFile.ReadLogEntry(offset)
+			ent, size, err := archivedLogFile.ReadLogEntry(offset)
 			if err != nil {
 				if err == io.EOF || err == storage.ErrEndOfEntry {
 					break
@@ -194,28 +442,28 @@ func (db *KhighDB) doRunGC(dataType DataType, archivedLogFileId int, gcRatio flo
 
 			var rewriteOffset = offset
 			offset += size
-			if ent.Type == storage.TypeDelete {
-				continue
+			// The value log files are copied as they are by upgrade, so the keys of list elements
+			// written before storage.FormatV5 are converted here.
+			if dataType == valueLogType && archivedLogFile.Version < storage.FormatV5 {
+				ent.Key = upgradeValueLogKey(ent.Key)
 			}
-			ts := time.Now().Unix()
-			if ent.ExpiredAt != 0 && ent.ExpiredAt <= ts {
+			if ent.Type == storage.TypeBatch {
+				// The entries in the batch are rewritten one by one, since each of them is
+				// written again as the latest value of its own key.
+				ents, offsets, err := storage.DecodeBatch(ent.Value, archivedLogFile.Version)
+				if err != nil {
+					return err
+				}
+				pos := &valuePos{fid: archivedLogFile.Fid, offset: rewriteOffset, entrySize: int(size)}
+				for i, p := range batchPositions(pos, len(ent.Value), offsets) {
+					if err = maybeRewriteEntry(p.fid, p.offset, ents[i]); err != nil {
+						return err
+					}
+				}
 				continue
 			}
-			var rewriteErr error
-			switch dataType {
-			case String:
-				rewriteErr = maybeRewriteStrs(archivedLogFile.Fid, rewriteOffset, ent)
-			case List:
-				rewriteErr = maybeRewriteList(archivedLogFile.Fid, rewriteOffset, ent)
-			case Hash:
-				rewriteErr = maybeRewriteHash(archivedLogFile.Fid, rewriteOffset, ent)
-			case Set:
-				rewriteErr = maybaRewriteSets(archivedLogFile.Fid, rewriteOffset, ent)
-			case ZSet:
-				rewriteErr = maybaRewriteZSet(archivedLogFile.Fid, rewriteOffset, ent)
-			}
-			if rewriteErr != nil {
-				return rewriteErr
+			if err = maybeRewriteEntry(archivedLogFile.Fid, rewriteOffset, ent); err != nil {
+				return err
 			}
 		}
 
@@ -227,7 +475,8 @@ func (db *KhighDB) doRunGC(dataType DataType, archivedLogFileId int, gcRatio flo
 		}
 		db.mu.Unlock()
 		db.discards[dataType].clear(fid)
-		zap.L().Info("Archived log file gc ends", zap.Uint32("fid", fid))
+		db.releaseTombstones(fid, dataType)
+		zap.L().Info("Archived log file gc ends", zap.Int8("dataType", dataType), zap.Uint32("fid", fid))
 	}
 
 	return nil
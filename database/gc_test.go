@@ -0,0 +1,230 @@
+package khighdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Khighness/khighdb/storage"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+func TestKhighDB_RunLogFileGC(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBRunLogFileGC(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBRunLogFileGC(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBRunLogFileGC(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func testKhighDBRunLogFileGC(t *testing.T, ioType IOType, mode DataIndexMode) {
+	path := filepath.Join("/tmp", "KhighDB-gc")
+	opts := DefaultOptions(path)
+	opts.IoType = ioType
+	opts.IndexMode = mode
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	// The first archived log file of every type holds a few live entries,
+	// and the rest of it is garbage.
+	var values [][]byte
+	for i := 0; i < 4; i++ {
+		values = append(values, getValue4K())
+		assert.Nil(t, db.Set(getKey(i), values[i]))
+		assert.Nil(t, db.HSet([]byte("hash"), getKey(i), values[i]))
+		assert.Nil(t, db.SAdd([]byte("set"), values[i]))
+	}
+	garbage := getValue4K()
+	for i := 0; i < 32; i++ {
+		assert.Nil(t, db.Set([]byte("garbage-str"), garbage))
+		assert.Nil(t, db.HSet([]byte("hash"), []byte("garbage"), garbage))
+		assert.Nil(t, db.SAdd([]byte("set"), garbage))
+	}
+	// Wait for the discard channel to be consumed.
+	time.Sleep(100 * time.Millisecond)
+
+	types := map[DataType]storage.FileType{String: storage.Strs, Hash: storage.Hash, Set: storage.Sets}
+	for dataType, fileType := range types {
+		assert.Nil(t, db.RunLogFileGC(dataType, 0, 0.5))
+		_, err = os.Stat(filepath.Join(path, storage.FileNamesMap[fileType]+fmt.Sprintf("%09d", 0)))
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	check := func(db *KhighDB) {
+		for i := 0; i < 4; i++ {
+			val, err := db.Get(getKey(i))
+			assert.Nil(t, err)
+			assert.Equal(t, values[i], val)
+			val, err = db.HGet([]byte("hash"), getKey(i))
+			assert.Nil(t, err)
+			assert.Equal(t, values[i], val)
+			assert.True(t, db.SIsMember([]byte("set"), values[i]))
+		}
+		assert.Equal(t, 5, db.SCard([]byte("set")))
+	}
+	check(db)
+
+	// The rewritten entries are loaded from the active log files after reopen.
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check(db)
+}
+
+func TestKhighDB_RunLogFileGC_DeleteEntry(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBRunLogFileGCDeleteEntry(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBRunLogFileGCDeleteEntry(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBRunLogFileGCDeleteEntry(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func testKhighDBRunLogFileGCDeleteEntry(t *testing.T, ioType IOType, mode DataIndexMode) {
+	path := filepath.Join("/tmp", "KhighDB-gc-delete")
+	opts := DefaultOptions(path)
+	opts.IoType = ioType
+	opts.IndexMode = mode
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	// fill writes garbage until the active log file of the data type is fid.
+	garbage := getValue4K()
+	fill := func(dataType DataType, fid uint32) {
+		for db.getActiveLogFile(dataType).Fid < fid {
+			if dataType == String {
+				assert.Nil(t, db.Set([]byte("garbage-str"), garbage))
+			} else {
+				assert.Nil(t, db.HSet([]byte("garbage-hash"), []byte("garbage"), garbage))
+			}
+		}
+	}
+
+	// The log files 0 hold the entries deleted by the delete entries in log files 1.
+	value := getValue4K()
+	assert.Nil(t, db.Set([]byte("str"), value))
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, db.HSet([]byte("hash"), getKey(i), value))
+	}
+	assert.Nil(t, db.HSet([]byte("hash-del"), []byte("field"), value))
+	assert.Nil(t, db.HSet([]byte("hash-clear"), []byte("field"), value))
+	fill(String, 1)
+	fill(Hash, 1)
+
+	assert.Nil(t, db.Delete([]byte("str")))
+	assert.Nil(t, db.HClear([]byte("hash")))
+	assert.Nil(t, db.HSet([]byte("hash"), []byte("new"), value))
+	_, err = db.HDel([]byte("hash-del"), []byte("field"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.HClear([]byte("hash-clear")))
+	fill(String, 2)
+	fill(Hash, 2)
+	// Wait for the discard channel to be consumed.
+	time.Sleep(100 * time.Millisecond)
+
+	types := map[DataType]storage.FileType{String: storage.Strs, Hash: storage.Hash}
+	for dataType, fileType := range types {
+		assert.Nil(t, db.RunLogFileGC(dataType, 1, 0.5))
+		_, err = os.Stat(filepath.Join(path, storage.FileNamesMap[fileType]+fmt.Sprintf("%09d", 1)))
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	check := func(db *KhighDB) {
+		_, err := db.Type([]byte("str"))
+		assert.Equal(t, ErrKeyNotFound, err)
+		_, err = db.Type([]byte("hash-del"))
+		assert.Equal(t, ErrKeyNotFound, err)
+		_, err = db.Type([]byte("hash-clear"))
+		assert.Equal(t, ErrKeyNotFound, err)
+		// The fields written after the hash is cleared are kept.
+		assert.Equal(t, 1, db.HLen([]byte("hash")))
+		val, err := db.HGet([]byte("hash"), []byte("new"))
+		assert.Nil(t, err)
+		assert.Equal(t, value, val)
+	}
+	check(db)
+
+	// The delete entries are still in the active log files after reopen.
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check(db)
+}
+
+func TestKhighDB_RunLogFileGC_DiscardTombstone(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-gc-tombstone")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	// The keys are written in log file 0, and deleted by the delete entries in log file 1.
+	assert.Nil(t, db.Set(getKey(0), getValue16B()))
+	n := 1
+	for ; db.getActiveLogFile(String).Fid < 1; n++ {
+		assert.Nil(t, db.Set(getKey(n), getValue16B()))
+	}
+	for i := 0; i < n; i++ {
+		assert.Nil(t, db.Delete(getKey(i)))
+	}
+	for db.getActiveLogFile(String).Fid < 2 {
+		assert.Nil(t, db.Set([]byte("garbage"), getValue4K()))
+	}
+	inCCL := func(fid uint32) bool {
+		// Wait for the discard channel to be consumed.
+		time.Sleep(100 * time.Millisecond)
+		ccl, err := db.discards[String].getCCL(db.getActiveLogFile(String).Fid, 0.5)
+		assert.Nil(t, err)
+		for _, id := range ccl {
+			if id == fid {
+				return true
+			}
+		}
+		return false
+	}
+
+	// The delete entries are not garbage until log file 0 is deleted.
+	assert.False(t, inCCL(1))
+	assert.Nil(t, db.RunLogFileGC(String, 0, 0.5))
+	assert.Nil(t, db.getArchivedLogFile(String, 0))
+	assert.True(t, inCCL(1))
+	assert.Nil(t, db.RunLogFileGC(String, 1, 0.5))
+	assert.Nil(t, db.getArchivedLogFile(String, 1))
+
+	check := func(db *KhighDB) {
+		for i := 0; i < n; i++ {
+			_, err := db.Get(getKey(i))
+			assert.Equal(t, ErrKeyNotFound, err)
+		}
+	}
+	check(db)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check(db)
+}
@@ -0,0 +1,213 @@
+package khighdb
+
+import (
+	"sort"
+
+	"github.com/Khighness/khighdb/data/geo"
+	"github.com/Khighness/khighdb/data/zset"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// The locations are stored in sorted sets, the score of each member is the 52-bit geohash of its
+// location, so the sorted set commands work on them as well.
+
+// GeoSort defines the order of GeoSearch results by distance.
+type GeoSort int8
+
+const (
+	// GeoSortNone leaves the results unsorted.
+	GeoSortNone GeoSort = iota
+	// GeoSortAsc sorts the results from the nearest to the farthest.
+	GeoSortAsc
+	// GeoSortDesc sorts the results from the farthest to the nearest.
+	GeoSortDesc
+)
+
+// GeoPoint is a location on earth.
+type GeoPoint struct {
+	Longitude float64
+	Latitude  float64
+}
+
+// GeoMember is a member of geospatial index with its location.
+type GeoMember struct {
+	Member []byte
+	GeoPoint
+}
+
+// GeoLocation is a result of GeoSearch.
+type GeoLocation struct {
+	GeoMember
+	// Distance is the distance in meters to the center of search.
+	Distance float64
+	// Hash is the 52-bit geohash of the location.
+	Hash uint64
+}
+
+// GeoSearchOptions defines the options of GeoSearch.
+type GeoSearchOptions struct {
+	// FromMember is the member whose location is the center of search.
+	// Center is used if it is nil.
+	FromMember []byte
+	// Center is the center of search.
+	Center GeoPoint
+
+	// Radius is the radius in meters of the circle to search.
+	// The box is searched instead if it is not positive.
+	Radius float64
+	// Width and Height are the size in meters of the box to search.
+	Width, Height float64
+
+	// Sort specifies the order of results by distance. Default value is GeoSortNone.
+	Sort GeoSort
+	// Count is the max number of results, no limit if it is not positive. The results are sorted
+	// in ascending order if Count is given without Sort, to return the nearest ones.
+	Count int
+	// Any makes the search return as soon as Count results are found, which may not be the nearest.
+	Any bool
+}
+
+// GeoAdd adds the members with their locations to the geospatial index stored at key, the
+// locations of existing members are updated. It returns the number of members added.
+func (db *KhighDB) GeoAdd(key []byte, members ...GeoMember) (int, error) {
+	hashes := make([]uint64, len(members))
+	for i, m := range members {
+		hash, err := geo.Encode(m.Longitude, m.Latitude)
+		if err != nil {
+			return 0, ErrInvalidCoordinates
+		}
+		hashes[i] = hash
+	}
+
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+	defer db.zsetIndex.blocking.serve()
+
+	var count int
+	for i, m := range members {
+		if ok, _ := db.zsetIndex.indexes.ZScore(string(key), string(m.Member)); !ok {
+			count++
+		}
+		if err := db.zAddInternal(key, float64(hashes[i]), m.Member); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// GeoPos returns the locations of members in the geospatial index stored at key,
+// the location is nil if the member does not exist.
+func (db *KhighDB) GeoPos(key []byte, members ...[]byte) []*GeoPoint {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	points := make([]*GeoPoint, len(members))
+	for i, member := range members {
+		if ok, score := db.zsetIndex.indexes.ZScore(string(key), string(member)); ok {
+			lon, lat := geo.Decode(uint64(score))
+			points[i] = &GeoPoint{Longitude: lon, Latitude: lat}
+		}
+	}
+	return points
+}
+
+// GeoDist returns the distance in meters between two members in the geospatial index stored at
+// key, ok is false if any of the members does not exist.
+func (db *KhighDB) GeoDist(key, member1, member2 []byte) (distance float64, ok bool) {
+	points := db.GeoPos(key, member1, member2)
+	if points[0] == nil || points[1] == nil {
+		return 0, false
+	}
+	return geo.Distance(points[0].Longitude, points[0].Latitude, points[1].Longitude, points[1].Latitude), true
+}
+
+// GeoHash returns the standard 11 characters geohash strings of members in the geospatial index
+// stored at key, the geohash is nil if the member does not exist.
+func (db *KhighDB) GeoHash(key []byte, members ...[]byte) [][]byte {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	hashes := make([][]byte, len(members))
+	for i, member := range members {
+		if ok, score := db.zsetIndex.indexes.ZScore(string(key), string(member)); ok {
+			hashes[i] = []byte(geo.String(uint64(score)))
+		}
+	}
+	return hashes
+}
+
+// GeoSearch returns the members in the geospatial index stored at key, which are in the circle
+// or the box centered at a location or a member. The geohash ranges of the area covering the
+// shape are queried, then the members in the ranges are checked by their distances.
+func (db *KhighDB) GeoSearch(key []byte, opts GeoSearchOptions) ([]GeoLocation, error) {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	if !db.zsetIndex.indexes.ZKeyExists(string(key)) {
+		return nil, nil
+	}
+	center := opts.Center
+	if opts.FromMember != nil {
+		ok, score := db.zsetIndex.indexes.ZScore(string(key), string(opts.FromMember))
+		if !ok {
+			return nil, ErrGeoMemberNotFound
+		}
+		center.Longitude, center.Latitude = geo.Decode(uint64(score))
+	} else if _, err := geo.Encode(center.Longitude, center.Latitude); err != nil {
+		return nil, ErrInvalidCoordinates
+	}
+
+	radius := opts.Radius
+	if radius < 0 {
+		radius = 0
+	}
+	sortBy := opts.Sort
+	if opts.Count > 0 && sortBy == GeoSortNone && !opts.Any {
+		sortBy = GeoSortAsc
+	}
+
+	var locations []GeoLocation
+	ranges := geo.SearchRanges(center.Longitude, center.Latitude, radius, opts.Width, opts.Height)
+	for _, rng := range ranges {
+		r := &zset.ScoreRange{Min: float64(rng[0]), Max: float64(rng[1]), MaxEx: true}
+		values := db.zsetIndex.indexes.ZRangeByScore(string(key), r, 0, -1, false)
+		for _, m := range toZMembers(values) {
+			hash := uint64(m.Score)
+			lon, lat := geo.Decode(hash)
+			var distance float64
+			var ok bool
+			if radius > 0 {
+				distance, ok = geo.InRadius(center.Longitude, center.Latitude, radius, lon, lat)
+			} else {
+				distance, ok = geo.InBox(center.Longitude, center.Latitude, opts.Width, opts.Height, lon, lat)
+			}
+			if !ok {
+				continue
+			}
+			locations = append(locations, GeoLocation{
+				GeoMember: GeoMember{Member: m.Member, GeoPoint: GeoPoint{Longitude: lon, Latitude: lat}},
+				Distance:  distance,
+				Hash:      hash,
+			})
+			if opts.Any && opts.Count > 0 && len(locations) == opts.Count {
+				break
+			}
+		}
+		if opts.Any && opts.Count > 0 && len(locations) == opts.Count {
+			break
+		}
+	}
+
+	switch sortBy {
+	case GeoSortAsc:
+		sort.SliceStable(locations, func(i, j int) bool { return locations[i].Distance < locations[j].Distance })
+	case GeoSortDesc:
+		sort.SliceStable(locations, func(i, j int) bool { return locations[i].Distance > locations[j].Distance })
+	}
+	if opts.Count > 0 && len(locations) > opts.Count {
+		locations = locations[:opts.Count]
+	}
+	return locations, nil
+}
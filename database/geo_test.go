@@ -0,0 +1,141 @@
+package khighdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+func TestKhighDB_GeoAdd(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBGeoAdd(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBGeoAdd(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBGeoAdd(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_GeoSearch(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("Sicily")
+	_, err := db.GeoAdd(key,
+		GeoMember{Member: []byte("Palermo"), GeoPoint: GeoPoint{Longitude: 13.361389, Latitude: 38.115556}},
+		GeoMember{Member: []byte("Catania"), GeoPoint: GeoPoint{Longitude: 15.087269, Latitude: 37.502669}},
+		GeoMember{Member: []byte("edge1"), GeoPoint: GeoPoint{Longitude: 12.758489, Latitude: 38.788135}},
+		GeoMember{Member: []byte("edge2"), GeoPoint: GeoPoint{Longitude: 17.241510, Latitude: 38.788135}},
+	)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name    string
+		opts    GeoSearchOptions
+		members []string
+	}{
+		{
+			"radius", GeoSearchOptions{Center: GeoPoint{Longitude: 15, Latitude: 37}, Radius: 200000, Sort: GeoSortAsc},
+			[]string{"Catania", "Palermo"},
+		},
+		{
+			"radius-desc", GeoSearchOptions{Center: GeoPoint{Longitude: 15, Latitude: 37}, Radius: 200000, Sort: GeoSortDesc},
+			[]string{"Palermo", "Catania"},
+		},
+		{
+			"box", GeoSearchOptions{Center: GeoPoint{Longitude: 15, Latitude: 37}, Width: 400000, Height: 400000, Sort: GeoSortAsc},
+			[]string{"Catania", "Palermo", "edge2", "edge1"},
+		},
+		{
+			"count", GeoSearchOptions{Center: GeoPoint{Longitude: 15, Latitude: 37}, Width: 400000, Height: 400000, Count: 3},
+			[]string{"Catania", "Palermo", "edge2"},
+		},
+		{
+			"from-member", GeoSearchOptions{FromMember: []byte("Palermo"), Radius: 100000, Sort: GeoSortAsc},
+			[]string{"Palermo", "edge1"},
+		},
+		{
+			"nothing", GeoSearchOptions{Center: GeoPoint{Longitude: -70, Latitude: 40}, Radius: 100000},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locations, err := db.GeoSearch(key, tt.opts)
+			assert.Nil(t, err)
+			var members []string
+			for _, loc := range locations {
+				members = append(members, string(loc.Member))
+			}
+			assert.Equal(t, tt.members, members)
+		})
+	}
+
+	locations, err := db.GeoSearch(key, GeoSearchOptions{Center: GeoPoint{Longitude: 15, Latitude: 37}, Radius: 200000, Count: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(locations))
+	assert.Equal(t, []byte("Catania"), locations[0].Member)
+	assert.InDelta(t, 56441.3, locations[0].Distance, 0.1)
+	assert.InDelta(t, 15.087269, locations[0].Longitude, 1e-5)
+	assert.Equal(t, uint64(3479447370796909), locations[0].Hash)
+
+	locations, err = db.GeoSearch(key, GeoSearchOptions{Center: GeoPoint{Longitude: 15, Latitude: 37}, Radius: 200000, Count: 1, Any: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(locations))
+
+	_, err = db.GeoSearch(key, GeoSearchOptions{FromMember: []byte("missing"), Radius: 1000})
+	assert.Equal(t, ErrGeoMemberNotFound, err)
+	_, err = db.GeoSearch(key, GeoSearchOptions{Center: GeoPoint{Longitude: 200}, Radius: 1000})
+	assert.Equal(t, ErrInvalidCoordinates, err)
+	locations, err = db.GeoSearch([]byte("missing"), GeoSearchOptions{FromMember: []byte("missing"), Radius: 1000})
+	assert.Nil(t, err)
+	assert.Empty(t, locations)
+}
+
+func testKhighDBGeoAdd(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("Sicily")
+	palermo := GeoMember{Member: []byte("Palermo"), GeoPoint: GeoPoint{Longitude: 13.361389, Latitude: 38.115556}}
+	catania := GeoMember{Member: []byte("Catania"), GeoPoint: GeoPoint{Longitude: 15.087269, Latitude: 37.502669}}
+	n, err := db.GeoAdd(key, palermo, catania)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = db.GeoAdd(key, palermo)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = db.GeoAdd(key, GeoMember{Member: []byte("pole"), GeoPoint: GeoPoint{Longitude: 0, Latitude: 90}})
+	assert.Equal(t, ErrInvalidCoordinates, err)
+	assert.Equal(t, 2, db.ZCard(key))
+
+	// The locations are kept after reopening.
+	assert.Nil(t, db.Close())
+	db = newKhighDB(ioType, mode)
+
+	points := db.GeoPos(key, []byte("Palermo"), []byte("missing"), []byte("Catania"))
+	assert.Equal(t, 3, len(points))
+	assert.InDelta(t, 13.361389, points[0].Longitude, 1e-5)
+	assert.InDelta(t, 38.115556, points[0].Latitude, 1e-5)
+	assert.Nil(t, points[1])
+	assert.InDelta(t, 15.087269, points[2].Longitude, 1e-5)
+
+	distance, ok := db.GeoDist(key, []byte("Palermo"), []byte("Catania"))
+	assert.True(t, ok)
+	assert.InDelta(t, 166274.1516, distance, 1e-4)
+	_, ok = db.GeoDist(key, []byte("Palermo"), []byte("missing"))
+	assert.False(t, ok)
+
+	hashes := db.GeoHash(key, []byte("Palermo"), []byte("Catania"), []byte("missing"))
+	assert.Equal(t, [][]byte{[]byte("sqc8b49rny0"), []byte("sqdtr74hyu0"), nil}, hashes)
+
+	ok, score := db.ZScore(key, []byte("Palermo"))
+	assert.True(t, ok)
+	assert.Equal(t, float64(3479099956230698), score)
+}
@@ -5,23 +5,52 @@ import (
 	"errors"
 	"math"
 	"math/rand"
-	"regexp"
 	"strconv"
 	"time"
 
-	"go.uber.org/zap"
-
 	"github.com/Khighness/khighdb/data/art"
+	"github.com/Khighness/khighdb/data/zset"
 	"github.com/Khighness/khighdb/storage"
 	"github.com/Khighness/khighdb/util"
 )
 
 // @Author KHighness
-// @Update 2023-01-07
+// @Update 2023-01-26
+
+// ExpireCondition defines the condition of setting the expiration time of HExpire.
+type ExpireCondition int8
+
+const (
+	// ExpireAlways always sets the expiration time.
+	ExpireAlways ExpireCondition = iota
+	// ExpireNX sets the expiration time only if the field has no expiration time.
+	ExpireNX
+	// ExpireXX sets the expiration time only if the field has an expiration time.
+	ExpireXX
+	// ExpireGT sets the expiration time only if it is greater than the current one,
+	// the field without expiration time is regarded as never expiring.
+	ExpireGT
+	// ExpireLT sets the expiration time only if it is less than the current one.
+	ExpireLT
+)
+
+// The results of HExpire, HTTL and HPersist for each field, like Redis.
+const (
+	// HFieldNotFound represents the field or the key does not exist.
+	HFieldNotFound = -2
+	// HFieldNoTTL represents the field has no expiration time.
+	HFieldNoTTL = -1
+	// HFieldNotUpdated represents the condition of HExpire is not met.
+	HFieldNotUpdated = 0
+	// HFieldUpdated represents the expiration time of the field is set or removed.
+	HFieldUpdated = 1
+	// HFieldDeleted represents the field is deleted since it expires immediately.
+	HFieldDeleted = 2
+)
 
 // HSet sets filed in the hash stored at key to value.
 // If the key does not exist, a new key holding a hash is created.
-// If the filed already exists in the hash, it is overwritten.
+// If the filed already exists in the hash, it is overwritten, and its time to live is discarded.
 // If you want to set multiple filed-value pair, parameter args be
 // like ['filed', 'value', 'field', 'value'...].
 func (db *KhighDB) HSet(key []byte, args ...[]byte) error {
@@ -31,26 +60,19 @@ func (db *KhighDB) HSet(key []byte, args ...[]byte) error {
 	if len(args) == 0 || len(args)&1 == 1 {
 		return ErrInvalidNumberOfArgs
 	}
+	if err := db.hPurgeKey(key); err != nil {
+		return err
+	}
 	if db.hashIndex.trees[string(key)] == nil {
+		if err := db.claimKey(key, Hash); err != nil {
+			return err
+		}
 		db.hashIndex.trees[string(key)] = art.NewART()
 	}
 	idxTree := db.hashIndex.trees[string(key)]
 
 	for i := 0; i < len(args); i += 2 {
-		filed, value := args[i], args[i+1]
-		hashKey := db.encodeKey(key, filed)
-		ent := &storage.LogEntry{Key: hashKey, Value: value}
-		pos, err := db.writeLogEntry(ent, Hash)
-		if err != nil {
-			return err
-		}
-
-		entry := &storage.LogEntry{Key: filed, Value: value}
-		_, size := storage.EncodeEntry(entry)
-		pos.entrySize = size
-
-		err = db.updateIndexTree(idxTree, entry, pos, true, Hash)
-		if err != nil {
+		if err := db.hSetInternal(idxTree, key, args[i], args[i+1], 0); err != nil {
 			return err
 		}
 	}
@@ -64,7 +86,13 @@ func (db *KhighDB) HSetNX(key, field, value []byte) (bool, error) {
 	db.hashIndex.mu.Lock()
 	defer db.hashIndex.mu.Unlock()
 
+	if err := db.hPurgeKey(key); err != nil {
+		return false, err
+	}
 	if db.hashIndex.trees[string(key)] == nil {
+		if err := db.claimKey(key, Hash); err != nil {
+			return false, err
+		}
 		db.hashIndex.trees[string(key)] = art.NewART()
 	}
 	idxTree := db.hashIndex.trees[string(key)]
@@ -76,24 +104,14 @@ func (db *KhighDB) HSetNX(key, field, value []byte) (bool, error) {
 		return false, nil
 	}
 
-	hashKey := db.encodeKey(key, field)
-	ent := &storage.LogEntry{Key: hashKey, Value: value}
-	pos, err := db.writeLogEntry(ent, Hash)
-	if err != nil {
-		return false, err
-	}
-
-	entry := &storage.LogEntry{Key: field, Value: value}
-	_, size := storage.EncodeEntry(entry)
-	pos.entrySize = size
-	err = db.updateIndexTree(idxTree, entry, pos, true, Hash)
-	if err != nil {
+	if err = db.hSetInternal(idxTree, key, field, value, 0); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
 // HGet returns the value associated with field in the hash stored at key.
+// Nil is returned if the field does not exist or is expired.
 func (db *KhighDB) HGet(key, field []byte) ([]byte, error) {
 	db.hashIndex.mu.RLock()
 	defer db.hashIndex.mu.RUnlock()
@@ -145,7 +163,11 @@ func (db *KhighDB) HMGet(key []byte, fields ...[]byte) (vals [][]byte, err error
 func (db *KhighDB) HDel(key []byte, fields ...[]byte) (int, error) {
 	db.hashIndex.mu.Lock()
 	defer db.hashIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, Hash)
 
+	if err := db.hPurgeKey(key); err != nil {
+		return 0, err
+	}
 	if db.hashIndex.trees[string(key)] == nil {
 		return 0, nil
 	}
@@ -153,27 +175,13 @@ func (db *KhighDB) HDel(key []byte, fields ...[]byte) (int, error) {
 
 	var count int
 	for _, field := range fields {
-		hashKey := db.encodeKey(key, field)
-		entry := &storage.LogEntry{Key: hashKey, Type: storage.TypeDelete}
-		pos, err := db.writeLogEntry(entry, Hash)
+		ok, err := db.hDelInternal(idxTree, key, field)
 		if err != nil {
 			return 0, err
 		}
-
-		val, updated := idxTree.Delete(field)
-		if updated {
+		if ok {
 			count++
 		}
-		db.sendDiscard(val, updated, Hash)
-
-		_, size := storage.EncodeEntry(entry)
-		node := &indexNode{fid: pos.fid, entrySize: size}
-		// The deleted entry itself is also useless.
-		select {
-		case db.discards[Hash].nodeChan <- node:
-		default:
-			zap.L().Warn("Failed to send node to discard channel")
-		}
 	}
 	return count, nil
 }
@@ -194,7 +202,18 @@ func (db *KhighDB) HExists(key, field []byte) (bool, error) {
 	return val != nil, nil
 }
 
-// HLen returns the number of fields contained in the hash stored at key.
+// HClear removes the hash stored at key with all its fields.
+// Only one entry is written no matter how many fields the hash holds.
+func (db *KhighDB) HClear(key []byte) error {
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, Hash)
+
+	return db.clearKeyInternal(key, Hash)
+}
+
+// HLen returns the number of fields contained in the hash stored at key,
+// the expired fields are not counted.
 func (db *KhighDB) HLen(key []byte) int {
 	db.hashIndex.mu.RLock()
 	defer db.hashIndex.mu.RUnlock()
@@ -203,7 +222,7 @@ func (db *KhighDB) HLen(key []byte) int {
 		return 0
 	}
 	idxTree := db.hashIndex.trees[string(key)]
-	return idxTree.Size()
+	return idxTree.Size() - db.hExpiredCount(key, idxTree, time.Now().UnixNano())
 }
 
 // HKeys return all field names in the hash stored at key,
@@ -216,12 +235,16 @@ func (db *KhighDB) HKeys(key []byte) ([][]byte, error) {
 	if !ok {
 		return keys, nil
 	}
+	nano := time.Now().UnixNano()
 	iterator := idxTree.Iterator()
 	for iterator.HasNext() {
 		node, err := iterator.Next()
 		if err != nil {
 			return nil, err
 		}
+		if hFieldExpired(node.Value(), nano) {
+			continue
+		}
 		keys = append(keys, node.Key())
 	}
 	return keys, nil
@@ -244,7 +267,10 @@ func (db *KhighDB) HVals(key []byte) ([][]byte, error) {
 			return nil, err
 		}
 		val, err := db.getVal(idxTree, node.Key(), Hash)
-		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		if err != nil {
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			}
 			return nil, err
 		}
 		vals = append(vals, val)
@@ -273,7 +299,10 @@ func (db *KhighDB) HGetAll(key []byte) ([][]byte, error) {
 		}
 		field := node.Key()
 		value, err := db.getVal(idxTree, field, Hash)
-		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		if err != nil {
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			}
 			return nil, err
 		}
 		pairs[index], pairs[index+1] = field, value
@@ -300,8 +329,8 @@ func (db *KhighDB) HStrLen(key, field []byte) int {
 }
 
 // HScan iterates over a specified key of type Hash and finds its fields and values.
-// Parameter prefix will match field's prefix, and pattern is a regular expression that
-// also matches the field. Parameter count limits the  number of keys, a nil slice will
+// Parameter prefix will match field's prefix, and pattern is a glob-style pattern that
+// also matches the field, see util.GlobMatch. Parameter count limits the  number of keys, a nil slice will
 // be returned if count is not a positive number,
 // The returned data likes ['field', 'value', 'field', 'value'...].
 func (db *KhighDB) HScan(key []byte, prefix []byte, pattern string, count int) ([][]byte, error) {
@@ -309,6 +338,11 @@ func (db *KhighDB) HScan(key []byte, prefix []byte, pattern string, count int) (
 		return nil, nil
 	}
 
+	prefix, ok := globScanPrefix(prefix, pattern)
+	if !ok {
+		return nil, nil
+	}
+
 	db.hashIndex.mu.RLock()
 	defer db.hashIndex.mu.RUnlock()
 	if db.hashIndex.trees[string(key)] == nil {
@@ -320,38 +354,40 @@ func (db *KhighDB) HScan(key []byte, prefix []byte, pattern string, count int) (
 		return nil, nil
 	}
 
-	var reg *regexp.Regexp
-	if pattern != "" {
-		var err error
-		if reg, err = regexp.Compile(pattern); err != nil {
-			return nil, err
-		}
-	}
-
 	values := make([][]byte, 2*len(fields))
 	var index int
 	for _, field := range fields {
-		if reg != nil && !reg.Match(field) {
+		if pattern != "" && !util.GlobMatch([]byte(pattern), field, false) {
 			continue
 		}
 		val, err := db.getVal(idxTree, field, Hash)
-		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		if err != nil {
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			}
 			return nil, err
 		}
 		values[index], values[index+1] = field, val
 		index += 2
 	}
-	return values, nil
+	return values[:index], nil
 }
 
 // HIncrBy increases the number stored at field in the hash stored at key by delta.
 // If the key does not exist, a new key holding a hash is created,
 // If the filed does not exist, the value is set to 0 before performing this operation.
+// The time to live of the field is retained.
 func (db *KhighDB) HIncrBy(key, field []byte, delta int64) (int64, error) {
-	db.hashIndex.mu.RLock()
-	defer db.hashIndex.mu.RUnlock()
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
 
+	if err := db.hPurgeKey(key); err != nil {
+		return 0, err
+	}
 	if db.hashIndex.trees[string(key)] == nil {
+		if err := db.claimKey(key, Hash); err != nil {
+			return 0, err
+		}
 		db.hashIndex.trees[string(key)] = art.NewART()
 	}
 
@@ -360,8 +396,11 @@ func (db *KhighDB) HIncrBy(key, field []byte, delta int64) (int64, error) {
 	if err != nil && !errors.Is(err, ErrKeyNotFound) {
 		return 0, err
 	}
+	var expiredAt int64
 	if bytes.Equal(val, nil) {
 		val = []byte("0")
+	} else if node, err := db.getIndexNode(idxTree, field); err == nil {
+		expiredAt = node.expiredAt
 	}
 	valInt64, err := util.StrToInt64(string(val))
 	if err != nil {
@@ -375,19 +414,7 @@ func (db *KhighDB) HIncrBy(key, field []byte, delta int64) (int64, error) {
 
 	valInt64 += delta
 	val = []byte(strconv.FormatInt(valInt64, 10))
-
-	hashKey := db.encodeKey(key, field)
-	ent := &storage.LogEntry{Key: hashKey, Value: val}
-	pos, err := db.writeLogEntry(ent, Hash)
-	if err != nil {
-		return 0, err
-	}
-
-	entry := &storage.LogEntry{Key: field, Value: val}
-	_, size := storage.EncodeEntry(ent)
-	pos.entrySize = size
-	err = db.updateIndexTree(idxTree, entry, pos, true, Hash)
-	if err != nil {
+	if err = db.hSetInternal(idxTree, key, field, val, expiredAt); err != nil {
 		return 0, err
 	}
 	return valInt64, nil
@@ -443,3 +470,302 @@ func (db *KhighDB) HRandField(key []byte, count int, withValues bool) ([][]byte,
 	}
 	return dupValues, nil
 }
+
+// HExpire sets the time to live of the fields in the hash stored at key, and returns the result
+// of each field, which is HFieldNotFound, HFieldNotUpdated, HFieldUpdated or HFieldDeleted.
+// The fields are deleted if ttl is 0. Like Expire, the value of the field is rewritten with
+// the expiration time.
+func (db *KhighDB) HExpire(key []byte, ttl time.Duration, cond ExpireCondition, fields ...[]byte) ([]int, error) {
+	if ttl < 0 {
+		return nil, ErrInvalidExpireTime
+	}
+	if len(fields) == 0 {
+		return nil, ErrInvalidNumberOfArgs
+	}
+	expiredAt := time.Now().Add(ttl).UnixNano()
+
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, Hash)
+
+	if err := db.hPurgeKey(key); err != nil {
+		return nil, err
+	}
+	results := make([]int, len(fields))
+	idxTree := db.hashIndex.trees[string(key)]
+	for i, field := range fields {
+		if idxTree == nil {
+			results[i] = HFieldNotFound
+			continue
+		}
+		node, err := db.getLiveIndexNode(idxTree, field)
+		if err != nil {
+			results[i] = HFieldNotFound
+			continue
+		}
+		if !cond.met(node.expiredAt, expiredAt) {
+			results[i] = HFieldNotUpdated
+			continue
+		}
+		if ttl == 0 {
+			if _, err = db.hDelInternal(idxTree, key, field); err != nil {
+				return nil, err
+			}
+			results[i] = HFieldDeleted
+			continue
+		}
+		val, err := db.getVal(idxTree, field, Hash)
+		if err != nil {
+			return nil, err
+		}
+		if err = db.hSetInternal(idxTree, key, field, val, expiredAt); err != nil {
+			return nil, err
+		}
+		results[i] = HFieldUpdated
+	}
+	return results, nil
+}
+
+// HTTL returns the time to live in milliseconds of the fields in the hash stored at key, which
+// is HFieldNotFound if the field does not exist, or HFieldNoTTL if the field never expires.
+func (db *KhighDB) HTTL(key []byte, fields ...[]byte) ([]int64, error) {
+	if len(fields) == 0 {
+		return nil, ErrInvalidNumberOfArgs
+	}
+	db.hashIndex.mu.RLock()
+	defer db.hashIndex.mu.RUnlock()
+
+	ttls := make([]int64, len(fields))
+	idxTree := db.hashIndex.trees[string(key)]
+	for i, field := range fields {
+		if idxTree == nil {
+			ttls[i] = HFieldNotFound
+			continue
+		}
+		node, err := db.getLiveIndexNode(idxTree, field)
+		switch {
+		case err != nil:
+			ttls[i] = HFieldNotFound
+		case node.expiredAt == 0:
+			ttls[i] = HFieldNoTTL
+		default:
+			ttls[i] = (node.expiredAt - time.Now().UnixNano()) / 1e6
+		}
+	}
+	return ttls, nil
+}
+
+// HPersist removes the expiration time of the fields in the hash stored at key, and returns the
+// result of each field, which is HFieldNotFound, HFieldNoTTL or HFieldUpdated.
+func (db *KhighDB) HPersist(key []byte, fields ...[]byte) ([]int, error) {
+	if len(fields) == 0 {
+		return nil, ErrInvalidNumberOfArgs
+	}
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+
+	if err := db.hPurgeKey(key); err != nil {
+		return nil, err
+	}
+	results := make([]int, len(fields))
+	idxTree := db.hashIndex.trees[string(key)]
+	for i, field := range fields {
+		if idxTree == nil {
+			results[i] = HFieldNotFound
+			continue
+		}
+		node, err := db.getLiveIndexNode(idxTree, field)
+		if err != nil {
+			results[i] = HFieldNotFound
+			continue
+		}
+		if node.expiredAt == 0 {
+			results[i] = HFieldNoTTL
+			continue
+		}
+		val, err := db.getVal(idxTree, field, Hash)
+		if err != nil {
+			return nil, err
+		}
+		if err = db.hSetInternal(idxTree, key, field, val, 0); err != nil {
+			return nil, err
+		}
+		results[i] = HFieldUpdated
+	}
+	return results, nil
+}
+
+// met checks if the new expiration time meets the condition against the current one,
+// 0 means never expiring.
+func (cond ExpireCondition) met(cur, next int64) bool {
+	switch cond {
+	case ExpireNX:
+		return cur == 0
+	case ExpireXX:
+		return cur != 0
+	case ExpireGT:
+		return cur != 0 && next > cur
+	case ExpireLT:
+		return cur == 0 || next < cur
+	}
+	return true
+}
+
+// hFieldExpired checks if the index node of field is expired at the time in nanoseconds.
+func hFieldExpired(value interface{}, nano int64) bool {
+	node, _ := value.(*indexNode)
+	return node == nil || (node.expiredAt != 0 && node.expiredAt < nano)
+}
+
+// hSetInternal sets field in the hash stored at key to value with expiration time, the field
+// never expires if expiredAt is 0.
+func (db *KhighDB) hSetInternal(idxTree *art.AdaptiveRadixTree, key, field, value []byte, expiredAt int64) error {
+	hashKey := db.encodeKey(key, field)
+	ent := &storage.LogEntry{Key: hashKey, Value: value, ExpiredAt: expiredAt}
+	pos, err := db.writeLogEntry(ent, Hash)
+	if err != nil {
+		return err
+	}
+
+	entry := &storage.LogEntry{Key: field, Value: value, ExpiredAt: expiredAt}
+	if err = db.updateIndexTree(idxTree, entry, pos, true, Hash); err != nil {
+		return err
+	}
+	db.hTrackExpiration(key, field, expiredAt)
+	db.hUpdateDeadline(key, idxTree)
+	return nil
+}
+
+// hDelInternal removes field from the hash stored at key, it returns false if the field does
+// not exist or is expired.
+func (db *KhighDB) hDelInternal(idxTree *art.AdaptiveRadixTree, key, field []byte) (bool, error) {
+	hashKey := db.encodeKey(key, field)
+	entry := &storage.LogEntry{Key: hashKey, Type: storage.TypeDelete}
+	if _, err := db.writeLogEntry(entry, Hash); err != nil {
+		return false, err
+	}
+
+	val, updated := idxTree.Delete(field)
+	db.sendDiscard(val, updated, Hash)
+	db.hashIndex.expires.ZRem(string(key), string(field))
+	db.hUpdateDeadline(key, idxTree)
+	return updated && !hFieldExpired(val, time.Now().UnixNano()), nil
+}
+
+// hPurgeExpired deletes the expired fields of all hashes, so that the space of them is counted
+// as garbage and can be reclaimed by log file gc.
+func (db *KhighDB) hPurgeExpired() error {
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+
+	for key := range db.hashIndex.trees {
+		if err := db.hPurgeKey([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hPurgeKey deletes the expired fields of the hash stored at key, and releases the key if no
+// field is left. Like HDel, a delete entry is written for each expired field, or else the value
+// written before it might be found again after reopening.
+// It must be called with the write lock of Hash held.
+func (db *KhighDB) hPurgeKey(key []byte) error {
+	idxTree := db.hashIndex.trees[string(key)]
+	if idxTree == nil {
+		return nil
+	}
+	fields := db.hExpiredFields(key, idxTree, time.Now().UnixNano())
+	if len(fields) == 0 {
+		return nil
+	}
+	defer db.releaseKeyIfEmpty(key, Hash)
+	for _, field := range fields {
+		if _, err := db.hDelInternal(idxTree, key, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hExpireScore returns the score of the expiration time in the expiration index, which is the
+// expiration time in milliseconds rounded up, so that it is exact as a float.
+// So the fields whose score is less than the score of a time are expired at the time, and the
+// fields whose score is greater are not.
+func hExpireScore(nano int64) float64 {
+	return float64((nano + 1e6 - 1) / 1e6)
+}
+
+// hTrackExpiration records the expiration time of the field in the expiration index, the field
+// is removed from the index if expiredAt is 0.
+func (db *KhighDB) hTrackExpiration(key, field []byte, expiredAt int64) {
+	if expiredAt == 0 {
+		db.hashIndex.expires.ZRem(string(key), string(field))
+		return
+	}
+	db.hashIndex.expires.ZAdd(string(key), hExpireScore(expiredAt), string(field))
+}
+
+// hExpiredFields returns the expired fields of the hash stored at key at the time in nanoseconds.
+func (db *KhighDB) hExpiredFields(key []byte, idxTree *art.AdaptiveRadixTree, nano int64) [][]byte {
+	score := hExpireScore(nano)
+	values := db.hashIndex.expires.ZRangeByScore(string(key), &zset.ScoreRange{Min: math.Inf(-1), Max: score}, 0, -1, false)
+	var fields [][]byte
+	for i := 0; i < len(values); i += 2 {
+		field := []byte(values[i].(string))
+		if values[i+1].(float64) < score || hFieldExpired(idxTree.Get(field), nano) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// hExpiredCount returns the number of the expired fields of the hash stored at key at the time
+// in nanoseconds, only the fields expiring in the same millisecond as the time are examined.
+func (db *KhighDB) hExpiredCount(key []byte, idxTree *art.AdaptiveRadixTree, nano int64) int {
+	score := hExpireScore(nano)
+	count := db.hashIndex.expires.ZCount(string(key), &zset.ScoreRange{Min: math.Inf(-1), Max: score, MaxEx: true})
+	values := db.hashIndex.expires.ZRangeByScore(string(key), &zset.ScoreRange{Min: score, Max: score}, 0, -1, false)
+	for i := 0; i < len(values); i += 2 {
+		if hFieldExpired(idxTree.Get([]byte(values[i].(string))), nano) {
+			count++
+		}
+	}
+	return count
+}
+
+// hDeadline returns the time in nanoseconds after which the hash stored at key has no live
+// fields, or 0 if it has any field without time to live.
+func (db *KhighDB) hDeadline(key []byte, idxTree *art.AdaptiveRadixTree) int64 {
+	if idxTree.Size() == 0 || db.hashIndex.expires.ZCard(string(key)) < idxTree.Size() {
+		return 0
+	}
+	all := &zset.ScoreRange{Min: math.Inf(-1), Max: math.Inf(1)}
+	last := db.hashIndex.expires.ZRangeByScore(string(key), all, 0, 1, true)
+	score := last[1].(float64)
+	var deadline int64
+	values := db.hashIndex.expires.ZRangeByScore(string(key), &zset.ScoreRange{Min: score, Max: score}, 0, -1, false)
+	for i := 0; i < len(values); i += 2 {
+		node, _ := idxTree.Get([]byte(values[i].(string))).(*indexNode)
+		if node != nil && node.expiredAt > deadline {
+			deadline = node.expiredAt
+		}
+	}
+	return deadline
+}
+
+// hUpdateDeadline updates the deadline of the hash stored at key in the key type index, after
+// the fields of the hash are changed.
+func (db *KhighDB) hUpdateDeadline(key []byte, idxTree *art.AdaptiveRadixTree) {
+	deadline := db.hDeadline(key, idxTree)
+	db.keyTypes.mu.Lock()
+	defer db.keyTypes.mu.Unlock()
+	if t, ok := db.keyTypes.types.Get(key).(DataType); !ok || t != Hash {
+		return
+	}
+	if deadline == 0 {
+		delete(db.keyTypes.deadlines, string(key))
+	} else {
+		db.keyTypes.deadlines[string(key)] = deadline
+	}
+}
@@ -4,14 +4,16 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 // @Author KHighness
-// @Update 2023-01-08
+// @Update 2023-01-26
 
 func TestKhighDB_HSet(t *testing.T) {
 	t.Run("default", func(t *testing.T) {
@@ -522,17 +524,17 @@ func testKhighDBHScan(t *testing.T, ioType IOType, mode DataIndexMode) {
 		_ = db.HSet(hashKey, []byte(fmt.Sprintf("k-%d", i)), []byte(fmt.Sprintf("v-%d", i)))
 	}
 
-	result, err := db.HScan(hashKey, []byte("k-"), "[k]{1}[-]{1}[\\d]+", 5)
+	result, err := db.HScan(hashKey, []byte("k-"), "k-[0-9]*", 5)
 	assert.Nil(t, err)
 	assert.Equal(t, 10, len(result))
 
-	result, err = db.HScan(hashKey, []byte("k+"), "[k]{1}[-]{1}[\\d]+", 5)
+	result, err = db.HScan(hashKey, []byte("k+"), "k-[0-9]*", 5)
 	assert.Nil(t, err)
 	for _, field := range result {
 		assert.Nil(t, field)
 	}
 
-	result, err = db.HScan(hashKey, []byte("k"), "[k]{1}", 10)
+	result, err = db.HScan(hashKey, []byte("k"), "k*", 10)
 	assert.Nil(t, err)
 	assert.Equal(t, 20, len(result))
 
@@ -614,3 +616,235 @@ func testKhighDBHRandField(t *testing.T, ioType IOType, mode DataIndexMode) {
 		t.Logf("HRandField() field = %v, value = %v", string(field), string(value))
 	}
 }
+
+func TestKhighDB_HExpire(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBHExpire(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBHExpire(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBHExpire(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_HExpireCondition(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key, f1, f2 := []byte("session"), []byte("f1"), []byte("f2")
+	assert.Nil(t, db.HSet(key, f1, []byte("v1"), f2, []byte("v2")))
+
+	tests := []struct {
+		name   string
+		ttl    time.Duration
+		cond   ExpireCondition
+		fields [][]byte
+		want   []int
+	}{
+		{"xx-without-ttl", time.Hour, ExpireXX, [][]byte{f1}, []int{HFieldNotUpdated}},
+		{"gt-without-ttl", time.Hour, ExpireGT, [][]byte{f1}, []int{HFieldNotUpdated}},
+		{"nx-without-ttl", time.Hour, ExpireNX, [][]byte{f1}, []int{HFieldUpdated}},
+		{"nx-with-ttl", time.Hour, ExpireNX, [][]byte{f1}, []int{HFieldNotUpdated}},
+		{"lt-without-ttl", 2 * time.Hour, ExpireLT, [][]byte{f1, f2}, []int{HFieldNotUpdated, HFieldUpdated}},
+		{"gt-with-ttl", 90 * time.Minute, ExpireGT, [][]byte{f1, f2}, []int{HFieldUpdated, HFieldNotUpdated}},
+		{"xx-with-ttl", 3 * time.Hour, ExpireXX, [][]byte{f1, []byte("missing")}, []int{HFieldUpdated, HFieldNotFound}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := db.HExpire(key, tt.ttl, tt.cond, tt.fields...)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, results)
+		})
+	}
+
+	results, err := db.HExpire([]byte("missing"), time.Hour, ExpireAlways, f1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{HFieldNotFound}, results)
+	_, err = db.HExpire(key, -time.Second, ExpireAlways, f1)
+	assert.Equal(t, ErrInvalidExpireTime, err)
+}
+
+func TestKhighDB_HPersist(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer func() { destroyDB(db) }()
+
+	key, f1, f2 := []byte("session"), []byte("f1"), []byte("f2")
+	assert.Nil(t, db.HSet(key, f1, []byte("v1"), f2, []byte("v2")))
+	_, err := db.HExpire(key, time.Hour, ExpireAlways, f1)
+	assert.Nil(t, err)
+
+	results, err := db.HPersist(key, f1, f2, []byte("missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{HFieldUpdated, HFieldNoTTL, HFieldNotFound}, results)
+
+	// The field is persistent after reopening.
+	assert.Nil(t, db.Close())
+	db = newKhighDB(FileIO, KeyOnlyMemMode)
+	ttls, err := db.HTTL(key, f1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{HFieldNoTTL}, ttls)
+	val, err := db.HGet(key, f1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), val)
+}
+
+func TestKhighDB_HExpireAllFields(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer func() { destroyDB(db) }()
+
+	key, f1, f2 := []byte("session"), []byte("f1"), []byte("f2")
+	assert.Nil(t, db.HSet(key, f1, []byte("v1"), f2, []byte("v2")))
+	_, err := db.HExpire(key, 50*time.Millisecond, ExpireAlways, f1, f2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, db.HLen(key))
+	assert.Equal(t, 1, db.Exists(key))
+	time.Sleep(100 * time.Millisecond)
+
+	// The hash whose fields are all expired does not exist.
+	assert.Equal(t, 0, db.HLen(key))
+	assert.Equal(t, 0, db.Exists(key))
+	assert.Equal(t, 0, db.DBSize())
+	keys, err := db.Keys("")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+	n, err := db.HDel(key, f1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	// The key can be taken over by other data types.
+	assert.Nil(t, db.Set(key, []byte("value")))
+	dataType, err := db.Type(key)
+	assert.Nil(t, err)
+	assert.Equal(t, String, dataType)
+	assert.Equal(t, ErrWrongType, db.HSet(key, f1, []byte("v1")))
+	assert.Equal(t, 1, db.DBSize())
+
+	// The taken over key is still a string after reopening.
+	assert.Nil(t, db.Close())
+	db = newKhighDB(FileIO, KeyOnlyMemMode)
+	dataType, err = db.Type(key)
+	assert.Nil(t, err)
+	assert.Equal(t, String, dataType)
+	assert.Equal(t, 1, db.DBSize())
+	assert.Equal(t, ErrWrongType, db.HSet(key, f1, []byte("v1")))
+}
+
+func TestKhighDB_HExpireGC(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-hexpire")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() { destroyDB(db) }()
+
+	// The tokens expire independently, the expired ones are reclaimed by log file gc.
+	key := []byte("session")
+	for i := 0; i < 64; i++ {
+		assert.Nil(t, db.HSet(key, getKey(i), getValue4K()))
+	}
+	fields := make([][]byte, 60)
+	for i := range fields {
+		fields[i] = getKey(i)
+	}
+	_, err = db.HExpire(key, 50*time.Millisecond, ExpireAlways, fields...)
+	assert.Nil(t, err)
+	assert.Nil(t, db.HSet([]byte("expired"), []byte("f"), []byte("v")))
+	_, err = db.HExpire([]byte("expired"), 50*time.Millisecond, ExpireAlways, []byte("f"))
+	assert.Nil(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	archived := len(db.archivedLogFiles[Hash])
+	assert.Nil(t, db.RunLogFileGC(Hash, -1, 0.5))
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, db.RunLogFileGC(Hash, -1, 0.5))
+	assert.True(t, len(db.archivedLogFiles[Hash]) < archived)
+	assert.Equal(t, 4, db.hashIndex.trees[string(key)].Size())
+	_, err = db.Type([]byte("expired"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, db.HLen(key))
+	for i := 60; i < 64; i++ {
+		assert.Equal(t, 4096, db.HStrLen(key, getKey(i)))
+	}
+	val, err := db.HGet(key, getKey(0))
+	assert.Nil(t, err)
+	assert.Nil(t, val)
+}
+
+func testKhighDBHExpire(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("session")
+	phone, laptop, tablet := []byte("phone"), []byte("laptop"), []byte("tablet")
+	assert.Nil(t, db.HSet(key, phone, []byte("t1"), laptop, []byte("t2"), tablet, []byte("t3")))
+
+	results, err := db.HExpire(key, time.Hour, ExpireAlways, phone, []byte("missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{HFieldUpdated, HFieldNotFound}, results)
+	results, err = db.HExpire(key, 50*time.Millisecond, ExpireAlways, laptop)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{HFieldUpdated}, results)
+	ttls, err := db.HTTL(key, phone, laptop, tablet, []byte("missing"))
+	assert.Nil(t, err)
+	assert.True(t, ttls[0] > 50 && ttls[0] <= time.Hour.Milliseconds())
+	assert.True(t, ttls[1] > 0 && ttls[1] <= 50)
+	assert.Equal(t, []int64{HFieldNoTTL, HFieldNotFound}, ttls[2:])
+
+	// The increment retains the time to live.
+	assert.Nil(t, db.HSet(key, []byte("count"), []byte("1")))
+	_, err = db.HExpire(key, time.Hour, ExpireAlways, []byte("count"))
+	assert.Nil(t, err)
+	n, err := db.HIncrBy(key, []byte("count"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	ttls, err = db.HTTL(key, []byte("count"))
+	assert.Nil(t, err)
+	assert.True(t, ttls[0] > 0)
+
+	// The expired field is invisible.
+	time.Sleep(100 * time.Millisecond)
+	val, err := db.HGet(key, laptop)
+	assert.Nil(t, err)
+	assert.Nil(t, val)
+	assert.Equal(t, 3, db.HLen(key))
+	pairs, err := db.HGetAll(key)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("count"), []byte("2"), phone, []byte("t1"), tablet, []byte("t3")}, pairs)
+	keys, err := db.HKeys(key)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("count"), phone, tablet}, keys)
+	vals, err := db.HVals(key)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(vals))
+	exists, err := db.HExists(key, laptop)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	ttls, err = db.HTTL(key, laptop)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{HFieldNotFound}, ttls)
+
+	// The expiration time is kept after reopening and renaming.
+	assert.Nil(t, db.Close())
+	db = newKhighDB(ioType, mode)
+	assert.Equal(t, 3, db.HLen(key))
+	assert.Nil(t, db.Rename(key, []byte("renamed")))
+	key = []byte("renamed")
+	ttls, err = db.HTTL(key, phone, tablet)
+	assert.Nil(t, err)
+	assert.True(t, ttls[0] > 0)
+	assert.Equal(t, int64(HFieldNoTTL), ttls[1])
+	assert.Equal(t, 3, db.hashIndex.trees[string(key)].Size())
+
+	// The fields are deleted if they expire immediately, and so is the key with no fields.
+	results, err = db.HExpire(key, 0, ExpireAlways, phone, tablet, []byte("count"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{HFieldDeleted, HFieldDeleted, HFieldDeleted}, results)
+	_, err = db.Type(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
@@ -0,0 +1,136 @@
+package khighdb
+
+import (
+	"errors"
+
+	"github.com/Khighness/khighdb/data/hll"
+)
+
+// @Author KHighness
+// @Update 2023-01-25
+
+// PFAdd adds the elements to the HyperLogLog stored at key, which is a string value. The key is
+// created if it does not exist. It returns true if the estimated cardinality may be changed,
+// which means any register is updated or the key is created.
+func (db *KhighDB) PFAdd(key []byte, elements ...[]byte) (bool, error) {
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	h, old, err := db.loadHLL(key)
+	if err != nil {
+		return false, err
+	}
+	var updated bool
+	for _, element := range elements {
+		if h.Add(element) {
+			updated = true
+		}
+	}
+	if old != nil && !updated {
+		return false, nil
+	}
+	return true, db.storeHLLInternal(key, old, h)
+}
+
+// PFCount returns the estimated cardinality of the HyperLogLog stored at key. If multiple keys
+// are given, it returns the estimated cardinality of their union. The non existing keys are
+// regarded as empty HyperLogLogs.
+func (db *KhighDB) PFCount(keys ...[]byte) (uint64, error) {
+	if len(keys) == 0 {
+		return 0, ErrInvalidNumberOfArgs
+	}
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+
+	var res *hll.HyperLogLog
+	for _, key := range keys {
+		h, _, err := db.loadHLL(key)
+		if err != nil {
+			return 0, err
+		}
+		if len(keys) == 1 {
+			return h.Count(), nil
+		}
+		if res == nil {
+			res = hll.New()
+		}
+		res.Merge(h)
+	}
+	return res.Count(), nil
+}
+
+// PFMerge merges the HyperLogLogs stored at keys into the HyperLogLog stored at destKey,
+// the existing HyperLogLog at destKey is merged too. The merged HyperLogLog is dense.
+func (db *KhighDB) PFMerge(destKey []byte, keys ...[]byte) error {
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	dest, old, err := db.loadHLL(destKey)
+	if err != nil {
+		return err
+	}
+	// Merging an empty HyperLogLog makes sure the result is dense.
+	dest.Merge(hll.New())
+	for _, key := range keys {
+		h, _, err := db.loadHLL(key)
+		if err != nil {
+			return err
+		}
+		dest.Merge(h)
+	}
+	return db.storeHLLInternal(destKey, old, dest)
+}
+
+// loadHLL loads the HyperLogLog stored at key, and the original string value, which is nil if
+// the key does not exist. An empty HyperLogLog is returned for the non existing key.
+// It must be called with the lock of String held.
+func (db *KhighDB) loadHLL(key []byte) (*hll.HyperLogLog, []byte, error) {
+	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return hll.New(), nil, nil
+		}
+		return nil, nil, err
+	}
+	h, err := hll.Load(val)
+	if err != nil {
+		return nil, nil, ErrInvalidHyperLogLog
+	}
+	return h, val, nil
+}
+
+// storeHLLInternal stores the HyperLogLog at key, old is the original string value. If both of
+// them are dense, only the changed bytes of registers are written by a patch, otherwise the
+// whole HyperLogLog is written with the original expiration time.
+// It must be called with the write lock of String held.
+func (db *KhighDB) storeHLLInternal(key, old []byte, h *hll.HyperLogLog) error {
+	val := h.Bytes()
+	if old == nil {
+		if err := db.claimKey(key, String); err != nil {
+			return err
+		}
+		return db.setInternal(key, val, 0)
+	}
+
+	if len(old) == len(val) && h.IsDense() {
+		from, to := 0, len(val)
+		for from < to && old[from] == val[from] {
+			from++
+		}
+		for to > from && old[to-1] == val[to-1] {
+			to--
+		}
+		if from == to {
+			return nil
+		}
+		// The patch is not worth if most of the registers are changed.
+		if (to-from)*2 <= len(val) {
+			return db.patchStrInternal(key, from, val[from:to])
+		}
+	}
+	node, err := db.getLiveIndexNode(db.strIndex.idxTree, key)
+	if err != nil {
+		return err
+	}
+	return db.setInternal(key, val, node.expiredAt)
+}
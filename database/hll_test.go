@@ -0,0 +1,119 @@
+package khighdb
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-25
+
+func TestKhighDB_PFAdd(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBPFAdd(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBPFAdd(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBPFAdd(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_PFMerge(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	k1, k2, dest := []byte("k1"), []byte("k2"), []byte("dest")
+	for i := 0; i < 3000; i++ {
+		_, err := db.PFAdd(k1, []byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+	}
+	for i := 2000; i < 4000; i++ {
+		_, err := db.PFAdd(k2, []byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+	}
+	count, err := db.PFCount(k1, k2, []byte("missing"))
+	assert.Nil(t, err)
+	assertHLLCount(t, 4000, count)
+
+	_, err = db.PFAdd(dest, []byte("dest"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.PFMerge(dest, k1, k2))
+	count, err = db.PFCount(dest)
+	assert.Nil(t, err)
+	assertHLLCount(t, 4001, count)
+
+	// The sources are untouched.
+	count, err = db.PFCount(k2)
+	assert.Nil(t, err)
+	assertHLLCount(t, 2000, count)
+
+	assert.Nil(t, db.PFMerge([]byte("empty")))
+	count, err = db.PFCount([]byte("empty"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), count)
+
+	assert.Nil(t, db.Set([]byte("str"), []byte("value")))
+	assert.Equal(t, ErrInvalidHyperLogLog, db.PFMerge(dest, []byte("str")))
+	_, err = db.PFCount([]byte("str"))
+	assert.Equal(t, ErrInvalidHyperLogLog, err)
+	assert.Nil(t, db.SAdd([]byte("set"), []byte("m")))
+	assert.Equal(t, ErrWrongType, db.PFMerge([]byte("set"), k1))
+}
+
+func testKhighDBPFAdd(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("visitors")
+	count, err := db.PFCount(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), count)
+
+	// The key is created even if no element is given.
+	updated, err := db.PFAdd(key)
+	assert.Nil(t, err)
+	assert.True(t, updated)
+	updated, err = db.PFAdd(key)
+	assert.Nil(t, err)
+	assert.False(t, updated)
+
+	updated, err = db.PFAdd(key, []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	assert.True(t, updated)
+	updated, err = db.PFAdd(key, []byte("a"))
+	assert.Nil(t, err)
+	assert.False(t, updated)
+	count, err = db.PFCount(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), count)
+
+	// The dense HyperLogLog is updated by patches, and kept with expiration time after reopening.
+	assert.Nil(t, db.Expire(key, time.Hour))
+	for i := 0; i < 10000; i++ {
+		_, err = db.PFAdd(key, []byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.Close())
+	db = newKhighDB(ioType, mode)
+	count, err = db.PFCount(key)
+	assert.Nil(t, err)
+	assertHLLCount(t, 10003, count)
+	ttl, err := db.TTL(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+
+	assert.Nil(t, db.Set([]byte("str"), []byte("value")))
+	_, err = db.PFAdd([]byte("str"), []byte("a"))
+	assert.Equal(t, ErrInvalidHyperLogLog, err)
+}
+
+func assertHLLCount(t *testing.T, expected int, count uint64) {
+	assert.True(t, math.Abs(float64(count)-float64(expected)) <= float64(expected)*0.03,
+		"expected %d, got %d", expected, count)
+}
@@ -1,6 +1,8 @@
 package khighdb
 
 import (
+	"bytes"
+	"encoding/binary"
 	"io"
 	"sort"
 	"sync"
@@ -10,12 +12,13 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/Khighness/khighdb/data/art"
+	"github.com/Khighness/khighdb/data/stream"
 	"github.com/Khighness/khighdb/storage"
 	"github.com/Khighness/khighdb/util"
 )
 
 // @Author KHighness
-// @Update 2022-12-27
+// @Update 2023-01-26
 
 // DataType defines the data structure type.
 type DataType = int8
@@ -26,12 +29,29 @@ const (
 	Hash
 	Set
 	ZSet
+	Stream
+	JSON
 )
 
 func (db *KhighDB) buildIndex(dataType DataType, ent *storage.LogEntry, pos *valuePos) {
+	// The value of entry is separated into value log, resolve the value pointer.
+	if ent.Type == storage.TypeValuePtr {
+		ptr, err := decodeValuePtr(ent.Value)
+		if err != nil {
+			zap.L().Fatal("Failed to decode value pointer, failed to open db", zap.Error(err))
+		}
+		pos.vptr = ptr
+		ent.Type, ent.Value = 0, nil
+		if db.openKeyValueMemMode(dataType) {
+			if ent.Value, err = db.readValueLog(ptr); err != nil {
+				zap.L().Fatal("Failed to read value log, failed to open db", zap.Error(err))
+			}
+		}
+	}
+
 	switch dataType {
 	case String:
-		db.buildSetsIndex(ent, pos)
+		db.buildStrsIndex(ent, pos)
 	case List:
 		db.buildListIndex(ent, pos)
 	case Hash:
@@ -40,6 +60,22 @@ func (db *KhighDB) buildIndex(dataType DataType, ent *storage.LogEntry, pos *val
 		db.buildSetsIndex(ent, pos)
 	case ZSet:
 		db.buildZSetIndex(ent, pos)
+	case Stream:
+		db.buildStreamIndex(ent, pos)
+	case JSON:
+		db.buildJSONIndex(ent, pos)
+	}
+}
+
+// buildBatchIndex builds the index of the entries in the batch entry at pos in order.
+func (db *KhighDB) buildBatchIndex(dataType DataType, ent *storage.LogEntry, pos *valuePos,
+	version storage.FormatVersion) {
+	ents, offsets, err := storage.DecodeBatch(ent.Value, version)
+	if err != nil {
+		zap.L().Fatal("Failed to decode batch entry, failed to open db", zap.Error(err))
+	}
+	for i, p := range batchPositions(pos, len(ent.Value), offsets) {
+		db.buildIndex(dataType, ents[i], p)
 	}
 }
 
@@ -49,14 +85,33 @@ func (db *KhighDB) buildStrsIndex(ent *storage.LogEntry, pos *valuePos) {
 		db.strIndex.idxTree.Delete(ent.Key)
 		return
 	}
+	// The patch is applied on the value written before it.
+	if ent.Type == storage.TypeStrPatch {
+		idxNode, _ := db.strIndex.idxTree.Get(ent.Key).(*indexNode)
+		if idxNode == nil {
+			return
+		}
+		at, data, err := decodeStrPatch(ent.Value)
+		if err != nil {
+			zap.L().Fatal("Failed to decode string patch, failed to open db", zap.Error(err))
+		}
+		idxNode.patches = append(idxNode.patches, &strPatch{
+			fid:       pos.fid,
+			offset:    pos.offset,
+			entrySize: pos.entrySize,
+			at:        at,
+			data:      data,
+		})
+		return
+	}
 
-	_, size := storage.EncodeEntry(ent)
 	idxNode := &indexNode{
 		fid:       pos.fid,
 		offset:    pos.offset,
-		entrySize: size,
+		entrySize: pos.entrySize,
+		vptr:      pos.vptr,
 	}
-	if db.openKeyValueMemMode() {
+	if db.openKeyValueMemMode(String) {
 		idxNode.value = ent.Value
 	}
 	if ent.ExpiredAt != 0 {
@@ -66,9 +121,26 @@ func (db *KhighDB) buildStrsIndex(ent *storage.LogEntry, pos *valuePos) {
 }
 
 func (db *KhighDB) buildListIndex(ent *storage.LogEntry, pos *valuePos) {
+	if ent.Type == storage.TypeKeyDelete {
+		if len(ent.Value) > 0 {
+			db.deleteIndexBefore(db.listIndex.trees[string(ent.Key)], ent.Value, func(key []byte) {
+				if bytes.Equal(key, ent.Key) {
+					return
+				}
+				if _, seq, frac := db.decodeListKey(key); frac != nil {
+					db.removeListInsert(ent.Key, listElem{seq: seq, frac: frac})
+				}
+			})
+			return
+		}
+		delete(db.listIndex.trees, string(ent.Key))
+		delete(db.listIndex.inserts, string(ent.Key))
+		return
+	}
 	var listKey = ent.Key
+	var elem listElem
 	if ent.Type != storage.TypeListMeta {
-		listKey, _ = db.decodeListKey(ent.Key)
+		listKey, elem.seq, elem.frac = db.decodeListKey(ent.Key)
 	}
 	if db.listIndex.trees[string(listKey)] == nil {
 		db.listIndex.trees[string(listKey)] = art.NewART()
@@ -77,24 +149,41 @@ func (db *KhighDB) buildListIndex(ent *storage.LogEntry, pos *valuePos) {
 
 	if ent.Type == storage.TypeDelete {
 		idxTree.Delete(ent.Key)
+		if elem.frac != nil {
+			db.removeListInsert(listKey, elem)
+		}
 		return
 	}
-	_, size := storage.EncodeEntry(ent)
+	if elem.frac != nil {
+		db.addListInsert(listKey, elem)
+	}
 	idxNode := &indexNode{
 		fid:       pos.fid,
 		offset:    pos.offset,
-		entrySize: size,
+		entrySize: pos.entrySize,
+		vptr:      pos.vptr,
 	}
-	if db.openKeyValueMemMode() {
+	if db.openKeyValueMemMode(List) {
 		idxNode.value = ent.Value
 	}
 	if ent.ExpiredAt != 0 {
 		idxNode.expiredAt = ent.ExpiredAt
 	}
-	idxTree.Put(ent.Key, idxTree)
+	idxTree.Put(ent.Key, idxNode)
 }
 
 func (db *KhighDB) buildHashIndex(ent *storage.LogEntry, pos *valuePos) {
+	if ent.Type == storage.TypeKeyDelete {
+		if len(ent.Value) > 0 {
+			db.deleteIndexBefore(db.hashIndex.trees[string(ent.Key)], ent.Value, func(field []byte) {
+				db.hashIndex.expires.ZRem(string(ent.Key), string(field))
+			})
+			return
+		}
+		delete(db.hashIndex.trees, string(ent.Key))
+		db.hashIndex.expires.ZClear(string(ent.Key))
+		return
+	}
 	key, field := db.decodeKey(ent.Key)
 	if db.hashIndex.trees[string(key)] == nil {
 		db.hashIndex.trees[string(key)] = art.NewART()
@@ -103,16 +192,18 @@ func (db *KhighDB) buildHashIndex(ent *storage.LogEntry, pos *valuePos) {
 
 	if ent.Type == storage.TypeDelete {
 		idxTree.Delete(field)
+		db.hashIndex.expires.ZRem(string(key), string(field))
 		return
 	}
+	db.hTrackExpiration(key, field, ent.ExpiredAt)
 
-	_, size := storage.EncodeEntry(ent)
 	idxNode := &indexNode{
 		fid:       pos.fid,
 		offset:    pos.offset,
-		entrySize: size,
+		entrySize: pos.entrySize,
+		vptr:      pos.vptr,
 	}
-	if db.openKeyValueMemMode() {
+	if db.openKeyValueMemMode(Hash) {
 		idxNode.value = ent.Value
 	}
 	if ent.ExpiredAt != 0 {
@@ -122,74 +213,232 @@ func (db *KhighDB) buildHashIndex(ent *storage.LogEntry, pos *valuePos) {
 }
 
 func (db *KhighDB) buildSetsIndex(ent *storage.LogEntry, pos *valuePos) {
-	if db.setIndex.trees[string(ent.Key)] == nil {
-		db.setIndex.trees[string(ent.Key)] = art.NewART()
+	if ent.Type == storage.TypeKeyDelete {
+		if len(ent.Value) > 0 {
+			db.deleteIndexBefore(db.setIndex.trees[string(ent.Key)], ent.Value, nil)
+			return
+		}
+		delete(db.setIndex.trees, string(ent.Key))
+		return
 	}
-	idxTree := db.setIndex.trees[string(ent.Key)]
+	var key = ent.Key
+	if ent.Type == storage.TypeSetMove {
+		var srcKey []byte
+		srcKey, key = db.decodeKey(ent.Key)
+		if srcTree := db.setIndex.trees[string(srcKey)]; srcTree != nil {
+			db.deleteMemberIndex(srcTree, ent.Value, Set)
+		}
+	}
+	if db.setIndex.trees[string(key)] == nil {
+		db.setIndex.trees[string(key)] = art.NewART()
+	}
+	idxTree := db.setIndex.trees[string(key)]
 
 	if ent.Type == storage.TypeDelete {
-		idxTree.Delete(ent.Value)
+		db.deleteMemberIndex(idxTree, ent.Value, Set)
 		return
 	}
 
-	if err := db.setIndex.murhash.Write(ent.Value); err != nil {
-		zap.L().Error("Failed to write murmur hash", zap.Error(err))
+	memberKey, err := db.memberKey(idxTree, ent.Value, Set)
+	if err != nil {
+		zap.L().Fatal("Failed to find member in set index", zap.Error(err))
 	}
-	sum := db.setIndex.murhash.EncodeSum128()
-	db.setIndex.murhash.Reset()
 
-	_, size := storage.EncodeEntry(ent)
 	idxNode := &indexNode{
 		fid:       pos.fid,
 		offset:    pos.offset,
-		entrySize: size,
+		entrySize: pos.entrySize,
+		vptr:      pos.vptr,
 	}
-	if db.openKeyValueMemMode() {
+	if db.openKeyValueMemMode(Set) {
 		idxNode.value = ent.Value
 	}
 	if ent.ExpiredAt != 0 {
 		idxNode.expiredAt = ent.ExpiredAt
 	}
-	idxTree.Put(sum, idxTree)
+	idxTree.Put(memberKey, idxNode)
 }
 
 func (db *KhighDB) buildZSetIndex(ent *storage.LogEntry, pos *valuePos) {
+	if ent.Type == storage.TypeKeyDelete {
+		if len(ent.Value) > 0 {
+			idxTree := db.zsetIndex.trees[string(ent.Key)]
+			db.deleteIndexBefore(idxTree, ent.Value, func(memberKey []byte) {
+				member, err := db.memberOf(idxTree, memberKey, ZSet)
+				if err != nil {
+					zap.L().Fatal("Failed to find member in zset index", zap.Error(err))
+				}
+				db.zsetIndex.indexes.ZRem(string(ent.Key), string(member))
+			})
+			return
+		}
+		delete(db.zsetIndex.trees, string(ent.Key))
+		db.zsetIndex.indexes.ZClear(string(ent.Key))
+		return
+	}
 	if ent.Type == storage.TypeDelete {
 		db.zsetIndex.indexes.ZRem(string(ent.Key), string(ent.Value))
-		if db.zsetIndex.trees[string(ent.Key)] != nil {
-			db.zsetIndex.trees[string(ent.Key)].Delete(ent.Value)
+		if idxTree := db.zsetIndex.trees[string(ent.Key)]; idxTree != nil {
+			db.deleteMemberIndex(idxTree, ent.Value, ZSet)
+			if idxTree.Size() == 0 {
+				delete(db.zsetIndex.trees, string(ent.Key))
+			}
 		}
 		return
 	}
 
 	key, scoreBuf := db.decodeKey(ent.Key)
 	score, _ := util.StrToFloat64(string(scoreBuf))
-	if err := db.zsetIndex.murhash.Write(ent.Value); err != nil {
-		zap.L().Fatal("Failed to write murmur hash", zap.Error(err))
-	}
-	sum := db.zsetIndex.murhash.EncodeSum128()
-	db.zsetIndex.murhash.Reset()
 
 	idxTree := db.zsetIndex.trees[string(key)]
 	if idxTree == nil {
 		idxTree = art.NewART()
 		db.zsetIndex.trees[string(key)] = idxTree
 	}
+	memberKey, err := db.memberKey(idxTree, ent.Value, ZSet)
+	if err != nil {
+		zap.L().Fatal("Failed to find member in zset index", zap.Error(err))
+	}
 
-	_, size := storage.EncodeEntry(ent)
 	idxNode := &indexNode{
 		fid:       pos.fid,
 		offset:    pos.offset,
-		entrySize: size,
+		entrySize: pos.entrySize,
+		vptr:      pos.vptr,
 	}
-	if db.openKeyValueMemMode() {
+	if db.openKeyValueMemMode(ZSet) {
 		idxNode.value = ent.Value
 	}
 	if ent.ExpiredAt != 0 {
 		idxNode.expiredAt = ent.ExpiredAt
 	}
-	db.zsetIndex.indexes.ZAdd(string(key), score, string(sum))
-	idxTree.Put(sum, idxTree)
+	db.zsetIndex.indexes.ZAdd(string(key), score, string(ent.Value))
+	idxTree.Put(memberKey, idxNode)
+}
+
+func (db *KhighDB) buildStreamIndex(ent *storage.LogEntry, pos *valuePos) {
+	if ent.Type == storage.TypeKeyDelete {
+		if len(ent.Value) > 0 {
+			s := db.streamIndex.streams[string(ent.Key)]
+			db.deleteIndexBefore(db.streamIndex.trees[string(ent.Key)], ent.Value, func(subkey []byte) {
+				db.unloadStreamRecord(s, subkey)
+			})
+			return
+		}
+		delete(db.streamIndex.trees, string(ent.Key))
+		delete(db.streamIndex.streams, string(ent.Key))
+		return
+	}
+	key, subkey := db.decodeKey(ent.Key)
+	idxTree, s := db.streamIndex.trees[string(key)], db.streamIndex.streams[string(key)]
+	if idxTree == nil {
+		idxTree, s = art.NewART(), stream.New()
+		db.streamIndex.trees[string(key)] = idxTree
+		db.streamIndex.streams[string(key)] = s
+	}
+
+	if ent.Type == storage.TypeDelete {
+		idxTree.Delete(subkey)
+		db.unloadStreamRecord(s, subkey)
+		return
+	}
+	if err := db.loadStreamRecord(s, subkey, ent.Value); err != nil {
+		zap.L().Fatal("Failed to load stream record, failed to open db", zap.Error(err))
+	}
+
+	idxNode := &indexNode{
+		fid:       pos.fid,
+		offset:    pos.offset,
+		entrySize: pos.entrySize,
+		vptr:      pos.vptr,
+	}
+	if db.openKeyValueMemMode(Stream) {
+		idxNode.value = ent.Value
+	}
+	idxTree.Put(subkey, idxNode)
+}
+
+func (db *KhighDB) buildJSONIndex(ent *storage.LogEntry, pos *valuePos) {
+	if ent.Type == storage.TypeKeyDelete {
+		if len(ent.Value) > 0 {
+			db.deleteIndexBefore(db.jsonIndex.trees[string(ent.Key)], ent.Value, nil)
+			return
+		}
+		delete(db.jsonIndex.trees, string(ent.Key))
+		return
+	}
+	key, subkey := db.decodeKey(ent.Key)
+	if db.jsonIndex.trees[string(key)] == nil {
+		db.jsonIndex.trees[string(key)] = art.NewART()
+	}
+	idxTree := db.jsonIndex.trees[string(key)]
+
+	if ent.Type == storage.TypeDelete {
+		idxTree.Delete(subkey)
+		return
+	}
+
+	idxNode := &indexNode{
+		fid:       pos.fid,
+		offset:    pos.offset,
+		entrySize: pos.entrySize,
+		vptr:      pos.vptr,
+	}
+	if db.openKeyValueMemMode(JSON) {
+		idxNode.value = ent.Value
+	}
+	idxTree.Put(subkey, idxNode)
+}
+
+// deleteMemberIndex deletes the member from the index tree of set or sorted set when loading index.
+func (db *KhighDB) deleteMemberIndex(idxTree *art.AdaptiveRadixTree, member []byte, dataType DataType) {
+	memberKey, err := db.findMember(idxTree, member, dataType)
+	if err != nil {
+		zap.L().Fatal("Failed to find member in index", zap.Error(err))
+	}
+	if memberKey != nil {
+		idxTree.Delete(memberKey)
+	}
+}
+
+// deleteIndexBefore deletes the elements written before the position from the index tree of a
+// collection key when loading index, the position is the value of a key delete entry moved by
+// log file gc. And fn is called with the index key of every element before it is deleted.
+// The collection left empty is removed by loadKeyTypes.
+func (db *KhighDB) deleteIndexBefore(idxTree *art.AdaptiveRadixTree, pos []byte, fn func(key []byte)) {
+	if idxTree == nil {
+		return
+	}
+	fid, offset := decodeLogPos(pos)
+	var keys [][]byte
+	idxTree.ForEachPrefix(nil, func(key []byte, value interface{}) bool {
+		node, _ := value.(*indexNode)
+		if node != nil && (node.fid < fid || (node.fid == fid && node.offset < offset)) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	for _, key := range keys {
+		if fn != nil {
+			fn(key)
+		}
+		idxTree.Delete(key)
+	}
+}
+
+// encodeLogPos encodes the position of an entry in log files.
+func encodeLogPos(fid uint32, offset int64) []byte {
+	buf := make([]byte, binary.MaxVarintLen32+binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(fid))
+	n += binary.PutVarint(buf[n:], offset)
+	return buf[:n]
+}
+
+// decodeLogPos decodes the position encoded by encodeLogPos.
+func decodeLogPos(buf []byte) (uint32, int64) {
+	fid, n := binary.Uvarint(buf)
+	offset, _ := binary.Varint(buf[n:])
+	return uint32(fid), offset
 }
 
 func (db *KhighDB) loadIndexFromLogFiles() error {
@@ -215,7 +464,7 @@ func (db *KhighDB) loadIndexFromLogFiles() error {
 				zap.L().Fatal("Log file is nil, failed to open db")
 			}
 
-			var offset int64
+			var offset = logFile.HeaderSize()
 			for {
 				entry, entrySize, err := logFile.ReadLogEntry(offset)
 				if err != nil {
@@ -224,8 +473,17 @@ func (db *KhighDB) loadIndexFromLogFiles() error {
 					}
 					zap.L().Fatal("Read log entry from file err, failed to open db")
 				}
-				pos := &valuePos{fid: fid, offset: offset}
-				db.buildIndex(dataType, entry, pos)
+				pos := &valuePos{fid: fid, offset: offset, entrySize: int(entrySize)}
+				// The delete entries which are needed by older log files have not been
+				// counted as garbage yet.
+				if entry.Type == storage.TypeDelete || entry.Type == storage.TypeKeyDelete {
+					db.keepTombstone(entry, pos, dataType)
+				}
+				if entry.Type == storage.TypeBatch {
+					db.buildBatchIndex(dataType, entry, pos, logFile.Version)
+				} else {
+					db.buildIndex(dataType, entry, pos)
+				}
 				offset += entrySize
 			}
 			// Set latest log file's Write
@@ -235,6 +493,11 @@ func (db *KhighDB) loadIndexFromLogFiles() error {
 		}
 	}
 
+	// The value log must be ready before replaying, values may be read from it in KeyValueMemMode.
+	if err := db.loadValueLog(); err != nil {
+		return err
+	}
+
 	wg := new(sync.WaitGroup)
 	wg.Add(logFileTypeNum)
 	for i := 0; i < logFileTypeNum; i++ {
@@ -248,16 +511,13 @@ func (db *KhighDB) loadIndexFromLogFiles() error {
 func (db *KhighDB) updateIndexTree(idxTree *art.AdaptiveRadixTree, ent *storage.LogEntry,
 	pos *valuePos, sendDiscard bool, dataType DataType) error {
 
-	var size = pos.entrySize
-	if dataType == String || dataType == List {
-		_, size = storage.EncodeEntry(ent)
-	}
 	idxNode := &indexNode{
 		fid:       pos.fid,
 		offset:    pos.offset,
-		entrySize: size,
+		entrySize: pos.entrySize,
+		vptr:      pos.vptr,
 	}
-	if db.openKeyValueMemMode() {
+	if db.openKeyValueMemMode(dataType) {
 		idxNode.value = ent.Value
 	}
 	if ent.ExpiredAt != 0 {
@@ -284,44 +544,64 @@ func (db *KhighDB) getIndexNode(idxTree *art.AdaptiveRadixTree, key []byte) (*in
 	return idxNode, nil
 }
 
-// getVal gets the value according to the given key.
-func (db *KhighDB) getVal(idxTree *art.AdaptiveRadixTree, key []byte, dataType DataType) ([]byte, error) {
-	rawValue := idxTree.Get(key)
-	if rawValue == nil {
-		return nil, ErrKeyNotFound
+// getLiveIndexNode gets the index node according to the given key, ErrKeyNotFound is returned
+// if the key is expired.
+func (db *KhighDB) getLiveIndexNode(idxTree *art.AdaptiveRadixTree, key []byte) (*indexNode, error) {
+	idxNode, err := db.getIndexNode(idxTree, key)
+	if err != nil {
+		return nil, err
 	}
-	idxNode := rawValue.(*indexNode)
-	if idxNode == nil {
+	if idxNode.expiredAt != 0 && idxNode.expiredAt < time.Now().UnixNano() {
 		return nil, ErrKeyNotFound
 	}
+	return idxNode, nil
+}
 
-	nano := time.Now().UnixNano()
-	if idxNode.expiredAt != 0 && idxNode.expiredAt < nano {
-		return nil, ErrKeyNotFound
+// getVal gets the value according to the given key.
+func (db *KhighDB) getVal(idxTree *art.AdaptiveRadixTree, key []byte, dataType DataType) ([]byte, error) {
+	idxNode, err := db.getLiveIndexNode(idxTree, key)
+	if err != nil {
+		return nil, err
 	}
+	val, err := db.getNodeVal(idxNode, dataType)
+	if err != nil || len(idxNode.patches) == 0 {
+		return val, err
+	}
+	return applyStrPatches(val, idxNode.patches), nil
+}
 
+// getNodeVal gets the value the index node points to, the patches of the node are not applied.
+func (db *KhighDB) getNodeVal(idxNode *indexNode, dataType DataType) ([]byte, error) {
 	// In KeyValueMemMode, the value is stored in memory.
 	// So get the value from the index info.
-	if db.openKeyValueMemMode() && len(idxNode.value) != 0 {
+	if db.openKeyValueMemMode(dataType) && len(idxNode.value) != 0 {
 		return idxNode.value, nil
 	}
 
-	// In KeyOnlyMemMode, the value is stored in disk.
-	// So get the value from log file at the offset.
-	logFile := db.getActiveLogFile(dataType)
-	if logFile.Fid != idxNode.fid {
-		logFile = db.getArchivedLogFile(dataType, idxNode.fid)
+	// In KeyOnlyMemMode, the value may be in read cache.
+	if val, ok := db.getCachedVal(dataType, idxNode); ok {
+		return val, nil
 	}
-	if logFile == nil {
-		return nil, ErrLogFileNotFound
+
+	// The value is separated, get the value from value log directly.
+	if idxNode.vptr != nil {
+		val, err := db.readValueLog(idxNode.vptr)
+		if err != nil {
+			return nil, err
+		}
+		db.setCachedVal(dataType, idxNode, val)
+		return val, nil
 	}
 
-	entry, _, err := logFile.ReadLogEntry(idxNode.offset)
+	// In KeyOnlyMemMode, the value is stored in disk.
+	// So get the value from log file at the offset.
+	entry, err := db.readLogEntry(dataType, idxNode.fid, idxNode.offset)
 	if err != nil {
 		return nil, err
 	}
-	if entry.Type == storage.TypeDelete || (entry.ExpiredAt != 0 && entry.ExpiredAt < nano) {
+	if entry.Type == storage.TypeDelete || (entry.ExpiredAt != 0 && entry.ExpiredAt < time.Now().UnixNano()) {
 		return nil, ErrKeyNotFound
 	}
+	db.setCachedVal(dataType, idxNode, entry.Value)
 	return entry.Value, nil
 }
@@ -5,7 +5,6 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 
 	"github.com/Khighness/khighdb/storage"
@@ -15,6 +14,47 @@ import (
 // @Author KHighness
 // @Update 2023-01-01
 
+// checkManifest checks the format version recorded in the manifest file of the db directory.
+// A manifest file will be created for a new directory, and a directory with log files but
+// without manifest file is considered as storage.FormatV1.
+func checkManifest(path string) error {
+	version, err := storage.ReadManifest(path)
+	if err == storage.ErrManifestNotFound {
+		hasLogFiles, err := containsLogFiles(path)
+		if err != nil {
+			return err
+		}
+		if !hasLogFiles {
+			return storage.WriteManifest(path, storage.CurrentFormatVersion)
+		}
+		version = storage.FormatV1
+	} else if err != nil {
+		return err
+	}
+
+	if version > storage.CurrentFormatVersion {
+		return storage.ErrUnsupportedFormatVersion
+	}
+	if version < storage.CurrentFormatVersion {
+		return ErrFormatUpgradeRequired
+	}
+	return nil
+}
+
+// containsLogFiles checks if there is any log file in the directory.
+func containsLogFiles(path string) (bool, error) {
+	fileInfos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return false, err
+	}
+	for _, file := range fileInfos {
+		if strings.HasPrefix(file.Name(), storage.FilePrefix) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (db *KhighDB) initDiscard() error {
 	discardPath := filepath.Join(db.options.DBPath, discardFilePath)
 	if !util.PathExist(discardPath) {
@@ -24,7 +64,7 @@ func (db *KhighDB) initDiscard() error {
 	}
 
 	discards := make(map[DataType]*discard)
-	for i := String; i < logFileTypeNum; i++ {
+	for i := valueLogType; i < logFileTypeNum; i++ {
 		name := storage.FileNamesMap[storage.FileType(i)] + discardFileName
 		discard, err := newDiscard(discardPath, name, db.options.DiscardBufferSize)
 		if err != nil {
@@ -47,13 +87,12 @@ func (db *KhighDB) loadLogFiles() error {
 	fidMap := make(map[DataType][]uint32)
 	for _, file := range fileInfos {
 		if strings.HasPrefix(file.Name(), storage.FilePrefix) {
-			splitNames := strings.Split(file.Name(), ".")
-			fid, err := strconv.Atoi(splitNames[2])
+			fileType, fid, err := storage.ParseLogFileName(file.Name())
 			if err != nil {
 				return err
 			}
-			dataType := DataType(storage.FileTypesMap[splitNames[1]])
-			fidMap[dataType] = append(fidMap[dataType], uint32(fid))
+			dataType := DataType(fileType)
+			fidMap[dataType] = append(fidMap[dataType], fid)
 		}
 	}
 	db.fidMap = fidMap
@@ -0,0 +1,184 @@
+package khighdb
+
+import (
+	"bytes"
+	"time"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// IteratorOptions defines the options for creating an Iterator.
+type IteratorOptions struct {
+	// Prefix makes the iterator only return the keys with the prefix.
+	Prefix []byte
+
+	// LowerBound is the smallest key the iterator returns, inclusive.
+	// If it is nil, there is no lower bound.
+	LowerBound []byte
+
+	// UpperBound is the key the iterator stops before, exclusive.
+	// If it is nil, there is no upper bound.
+	UpperBound []byte
+
+	// Reverse makes the iterator return the keys in descending order.
+	Reverse bool
+}
+
+// iteratorBatchSize is the number of keys fetched by the iterator at a time.
+const iteratorBatchSize = 64
+
+// Iterator iterates over the keys of type String in order.
+// The iterator does not hold the lock of index, it seeks the index tree for a batch of keys
+// at a time, and seeks again from the last key for the next batch. So the keys added or
+// removed during the iteration may be seen or not, and the keys which are expired or deleted
+// when they are fetched are skipped. The values are read lazily, so the latest value is returned.
+type Iterator struct {
+	db      *KhighDB
+	reverse bool
+	// lower is the smallest key in range, inclusive.
+	lower []byte
+	// upper is the key the range stops before, exclusive.
+	upper []byte
+	// keys is the fetched keys from the current key in iteration order.
+	keys [][]byte
+	// more is whether there may be keys after the fetched keys.
+	more bool
+}
+
+// NewIterator creates an iterator over the keys of type String.
+func (db *KhighDB) NewIterator(opts IteratorOptions) *Iterator {
+	// The keys with prefix are in the range [prefix, prefixUpperBound(prefix)).
+	it := &Iterator{db: db, reverse: opts.Reverse, lower: opts.LowerBound, upper: opts.UpperBound}
+	if len(opts.Prefix) > 0 {
+		if it.lower == nil || bytes.Compare(opts.Prefix, it.lower) > 0 {
+			it.lower = opts.Prefix
+		}
+		upper := prefixUpperBound(opts.Prefix)
+		if upper != nil && (it.upper == nil || bytes.Compare(upper, it.upper) < 0) {
+			it.upper = upper
+		}
+	}
+	it.Rewind()
+	return it
+}
+
+// Rewind moves the iterator to the first key.
+func (it *Iterator) Rewind() {
+	it.keys, it.more = it.fetch(nil, false, !it.reverse, iteratorBatchSize)
+}
+
+// Seek moves the iterator to the first key which is greater than or equal to the key,
+// or the first key which is less than or equal to the key in reverse order.
+func (it *Iterator) Seek(key []byte) {
+	it.keys, it.more = it.fetch(key, false, !it.reverse, iteratorBatchSize)
+}
+
+// Next moves the iterator to the next key.
+func (it *Iterator) Next() {
+	if !it.Valid() {
+		return
+	}
+	if len(it.keys) > 1 {
+		it.keys = it.keys[1:]
+		return
+	}
+	if !it.more {
+		it.keys = nil
+		return
+	}
+	it.keys, it.more = it.fetch(it.keys[0], true, !it.reverse, iteratorBatchSize)
+}
+
+// Prev moves the iterator to the previous key.
+func (it *Iterator) Prev() {
+	if !it.Valid() {
+		return
+	}
+	prev, _ := it.fetch(it.keys[0], true, it.reverse, 1)
+	// The keys after the previous key are fetched again by Next.
+	it.keys, it.more = prev, true
+}
+
+// Valid returns whether the iterator points to a key.
+func (it *Iterator) Valid() bool {
+	return len(it.keys) > 0
+}
+
+// Key returns the key the iterator points to.
+func (it *Iterator) Key() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.keys[0]
+}
+
+// Value returns the value the iterator points to.
+// ErrKeyNotFound is returned if the key is expired or deleted after the iterator is created.
+func (it *Iterator) Value() ([]byte, error) {
+	if !it.Valid() {
+		return nil, ErrKeyNotFound
+	}
+	it.db.strIndex.mu.RLock()
+	defer it.db.strIndex.mu.RUnlock()
+	return it.db.getVal(it.db.strIndex.idxTree, it.keys[0], String)
+}
+
+// Close releases the keys fetched by the iterator.
+func (it *Iterator) Close() {
+	it.keys = nil
+	it.more = false
+}
+
+// fetch seeks the index tree from the key in ascending or descending order, and returns
+// at most limit keys in range, the key itself is skipped if exclusive is true. The seek
+// starts from the bound of range if the key is nil or out of range. more is true if the
+// limit is reached.
+func (it *Iterator) fetch(key []byte, exclusive, ascending bool, limit int) (keys [][]byte, more bool) {
+	if ascending && it.lower != nil && (key == nil || bytes.Compare(key, it.lower) < 0) {
+		key, exclusive = it.lower, false
+	}
+	if !ascending && it.upper != nil && (key == nil || bytes.Compare(key, it.upper) >= 0) {
+		key, exclusive = it.upper, true
+	}
+
+	it.db.strIndex.mu.RLock()
+	defer it.db.strIndex.mu.RUnlock()
+	nano := time.Now().UnixNano()
+	it.db.strIndex.idxTree.ForEachFrom(key, !ascending, func(k []byte, value interface{}) bool {
+		if exclusive && bytes.Equal(k, key) {
+			return true
+		}
+		if ascending && it.upper != nil && bytes.Compare(k, it.upper) >= 0 {
+			return false
+		}
+		if !ascending && it.lower != nil && bytes.Compare(k, it.lower) < 0 {
+			return false
+		}
+		node, _ := value.(*indexNode)
+		if node == nil || (node.expiredAt != 0 && node.expiredAt < nano) {
+			return true
+		}
+		if len(keys) == limit {
+			more = true
+			return false
+		}
+		keys = append(keys, k)
+		return true
+	})
+	return
+}
+
+// prefixUpperBound returns the smallest key which is greater than all the keys with prefix,
+// nil is returned if there is no such key.
+func prefixUpperBound(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			upper := make([]byte, i+1)
+			copy(upper, prefix)
+			upper[i]++
+			return upper
+		}
+	}
+	return nil
+}
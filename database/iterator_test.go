@@ -0,0 +1,131 @@
+package khighdb
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+func TestKhighDB_NewIterator(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-iter")
+	db, err := Open(DefaultOptions(path))
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	tsKey := func(ts int) []byte {
+		return []byte(fmt.Sprintf("ts:%04d", ts))
+	}
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Set(tsKey(i), []byte(fmt.Sprint(i))))
+	}
+	assert.Nil(t, db.Set([]byte("other"), []byte("other")))
+	assert.Nil(t, db.SetEX(tsKey(100), []byte("100"), time.Millisecond))
+	assert.Nil(t, db.Delete(tsKey(50)))
+	time.Sleep(5 * time.Millisecond)
+
+	collect := func(it *Iterator) (keys []string) {
+		for ; it.Valid(); it.Next() {
+			keys = append(keys, string(it.Key()))
+		}
+		return
+	}
+
+	t.Run("all", func(t *testing.T) {
+		it := db.NewIterator(IteratorOptions{})
+		defer it.Close()
+		keys := collect(it)
+		assert.Equal(t, 100, len(keys))
+		assert.Equal(t, "other", keys[0])
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		it := db.NewIterator(IteratorOptions{Prefix: []byte("ts:")})
+		keys := collect(it)
+		assert.Equal(t, 99, len(keys))
+		assert.Equal(t, "ts:0000", keys[0])
+		assert.Equal(t, "ts:0099", keys[98])
+	})
+
+	t.Run("bounds", func(t *testing.T) {
+		it := db.NewIterator(IteratorOptions{LowerBound: tsKey(45), UpperBound: tsKey(55)})
+		assert.Equal(t, []string{"ts:0045", "ts:0046", "ts:0047", "ts:0048", "ts:0049",
+			"ts:0051", "ts:0052", "ts:0053", "ts:0054"}, collect(it))
+
+		it.Seek(tsKey(50))
+		assert.Equal(t, "ts:0051", string(it.Key()))
+		val, err := it.Value()
+		assert.Nil(t, err)
+		assert.Equal(t, "51", string(val))
+		it.Prev()
+		assert.Equal(t, "ts:0049", string(it.Key()))
+		it.Seek(tsKey(60))
+		assert.False(t, it.Valid())
+		it.Rewind()
+		assert.Equal(t, "ts:0045", string(it.Key()))
+		it.Prev()
+		assert.False(t, it.Valid())
+	})
+
+	t.Run("reverse", func(t *testing.T) {
+		it := db.NewIterator(IteratorOptions{Prefix: []byte("ts:"), LowerBound: tsKey(95), Reverse: true})
+		assert.Equal(t, []string{"ts:0099", "ts:0098", "ts:0097", "ts:0096", "ts:0095"}, collect(it))
+
+		it.Seek(tsKey(97))
+		assert.Equal(t, "ts:0097", string(it.Key()))
+		it.Next()
+		assert.Equal(t, "ts:0096", string(it.Key()))
+		it.Prev()
+		assert.Equal(t, "ts:0097", string(it.Key()))
+	})
+
+	t.Run("reverse-all", func(t *testing.T) {
+		it := db.NewIterator(IteratorOptions{Reverse: true})
+		keys := collect(it)
+		assert.Equal(t, 100, len(keys))
+		assert.Equal(t, "ts:0099", keys[0])
+		assert.Equal(t, "other", keys[99])
+	})
+
+	t.Run("write-during-iteration", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, db.Set([]byte(fmt.Sprintf("w:%04d", i)), []byte(fmt.Sprint(i))))
+		}
+		it := db.NewIterator(IteratorOptions{Prefix: []byte("w:")})
+		var keys []string
+		for ; it.Valid(); it.Next() {
+			key := string(it.Key())
+			keys = append(keys, key)
+			if !strings.HasSuffix(key, "-new") {
+				assert.Nil(t, db.Set([]byte(key+"-new"), []byte(key)))
+			}
+		}
+		// The keys added behind the fetched keys are seen.
+		assert.True(t, len(keys) > 100 && len(keys) < 200)
+	})
+
+	t.Run("deleted-after-created", func(t *testing.T) {
+		it := db.NewIterator(IteratorOptions{LowerBound: tsKey(10), UpperBound: tsKey(12)})
+		assert.Nil(t, db.Delete(tsKey(10)))
+		assert.Equal(t, "ts:0010", string(it.Key()))
+		_, err := it.Value()
+		assert.Equal(t, ErrKeyNotFound, err)
+		it.Next()
+		val, err := it.Value()
+		assert.Nil(t, err)
+		assert.Equal(t, "11", string(val))
+	})
+}
+
+func Test_prefixUpperBound(t *testing.T) {
+	assert.Equal(t, []byte("ts;"), prefixUpperBound([]byte("ts:")))
+	assert.Equal(t, []byte{'a', 1}, prefixUpperBound([]byte{'a', 0, 0xff}))
+	assert.Nil(t, prefixUpperBound([]byte{0xff, 0xff}))
+	assert.Nil(t, prefixUpperBound(nil))
+}
@@ -0,0 +1,563 @@
+package khighdb
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/Khighness/khighdb/data/art"
+	"github.com/Khighness/khighdb/data/document"
+	"github.com/Khighness/khighdb/storage"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// A JSON document is flattened into the nodes of all its values, each node is written with the
+// key encoded by encodeKey(key, subkey), and the subkey of a value is prefixed by the subkey of
+// its parent:
+//	+--------------------+--------------------------------------+-----------------------+
+//	|       value        |                subkey                |         node          |
+//	+--------------------+--------------------------------------+-----------------------+
+//	|        root        |                 '$'                  |                       |
+//	|  member of object  | subkey of object + 'k' + len + name  |  'o' / 'a' + length   |
+//	|  element of array  |  subkey of array + 'i' + index       |     / 's' + scalar    |
+//	+--------------------+--------------------------------------+-----------------------+
+// So updating a nested value only writes the nodes of the value, and appending to an array
+// only writes the new elements and the array node holding the length.
+
+// JSONSetOptions defines the options of JSONSet.
+type JSONSetOptions struct {
+	// NX makes JSONSet only set the value if the path does not exist.
+	NX bool
+	// XX makes JSONSet only set the value if the path already exists.
+	XX bool
+}
+
+// JSONSet sets the JSON value at path in the document stored at key, and returns false if no
+// value is set because of NX or XX.
+// If the key does not exist, a new document is created, in which case the path must be the
+// root. A non root path sets the existing values it matches, and if its last segment is the
+// member name of an object, the member is added to the matched parent objects.
+// See document.Path for the supported path syntax.
+func (db *KhighDB) JSONSet(key, path, value []byte, opts JSONSetOptions) (bool, error) {
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return false, err
+	}
+	v, err := document.Parse(value)
+	if err != nil {
+		return false, ErrInvalidJSON
+	}
+	db.jsonIndex.mu.Lock()
+	defer db.jsonIndex.mu.Unlock()
+
+	idxTree := db.jsonIndex.trees[string(key)]
+	if idxTree == nil {
+		if !p.IsRoot() {
+			return false, ErrJSONNewRootPath
+		}
+		if opts.XX {
+			return false, nil
+		}
+		if err = db.claimKey(key, JSON); err != nil {
+			return false, err
+		}
+		return true, db.jsonSetInternal(key, document.RootKey, nil, v)
+	}
+	if p.IsRoot() {
+		if opts.NX {
+			return false, nil
+		}
+		root, err := db.jsonNode(idxTree, document.RootKey)
+		if err != nil {
+			return false, err
+		}
+		return true, db.jsonSetInternal(key, document.RootKey, root, v)
+	}
+
+	last := p.Segments[len(p.Segments)-1]
+	parents, err := db.jsonMatch(idxTree, p.Segments[:len(p.Segments)-1])
+	if err != nil {
+		return false, err
+	}
+	var set bool
+	for _, parent := range parents {
+		var targets []document.Record
+		if last.Kind == document.KeySegment && parent.Node.Kind == document.Object {
+			subkey := document.ChildKey(parent.Subkey, last.Key)
+			node, err := db.jsonNode(idxTree, subkey)
+			if err != nil {
+				return set, err
+			}
+			targets = []document.Record{{Subkey: subkey, Node: node}}
+		} else if targets, err = db.jsonChildren(idxTree, parent, last); err != nil {
+			return set, err
+		}
+
+		for _, target := range targets {
+			if (target.Node == nil && opts.XX) || (target.Node != nil && opts.NX) {
+				continue
+			}
+			if err = db.jsonSetInternal(key, target.Subkey, target.Node, v); err != nil {
+				return set, err
+			}
+			set = true
+		}
+	}
+	return set, nil
+}
+
+// JSONGet returns the JSON text of the values at paths in the document stored at key.
+// For a JSONPath starting with "$", the result is an array of all the values it matches.
+// For a legacy path, the result is the first value it matches, and ErrJSONPathNotFound is
+// returned if it matches nothing. The root value is returned if no path is given.
+// If multiple paths are given, the result is an object mapping the paths to their results.
+// If the key does not exist, ErrKeyNotFound is returned.
+func (db *KhighDB) JSONGet(key []byte, paths ...[]byte) ([]byte, error) {
+	if len(paths) == 0 {
+		paths = [][]byte{[]byte(".")}
+	}
+	parsed := make([]*document.Path, len(paths))
+	for i, path := range paths {
+		p, err := parseJSONPath(path)
+		if err != nil {
+			return nil, err
+		}
+		parsed[i] = p
+	}
+	db.jsonIndex.mu.RLock()
+	defer db.jsonIndex.mu.RUnlock()
+
+	idxTree := db.jsonIndex.trees[string(key)]
+	if idxTree == nil {
+		return nil, ErrKeyNotFound
+	}
+	results := make(map[string]interface{}, len(paths))
+	var result interface{}
+	for i, p := range parsed {
+		matches, err := db.jsonMatch(idxTree, p.Segments)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, 0, len(matches))
+		for _, match := range matches {
+			value, err := db.jsonValue(idxTree, match.Subkey)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+
+		result = values
+		if p.Legacy {
+			if len(values) == 0 {
+				return nil, ErrJSONPathNotFound
+			}
+			result = values[0]
+		}
+		results[string(paths[i])] = result
+	}
+	if len(paths) == 1 {
+		return document.Marshal(result)
+	}
+	return document.Marshal(results)
+}
+
+// JSONDel deletes the values at path in the document stored at key, and returns the number of
+// deleted values. The whole document is deleted if the path is the root or nil.
+// The elements after a deleted element are moved forward, so deleting from the head of a large
+// array is expensive.
+func (db *KhighDB) JSONDel(key, path []byte) (int, error) {
+	if path == nil {
+		path = []byte(".")
+	}
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return 0, err
+	}
+	db.jsonIndex.mu.Lock()
+	defer db.jsonIndex.mu.Unlock()
+
+	idxTree := db.jsonIndex.trees[string(key)]
+	if idxTree == nil {
+		return 0, nil
+	}
+	if p.IsRoot() {
+		if err = db.clearKeyInternal(key, JSON); err != nil {
+			return 0, err
+		}
+		db.releaseKeyIfEmpty(key, JSON)
+		return 1, nil
+	}
+
+	last := p.Segments[len(p.Segments)-1]
+	parents, err := db.jsonMatch(idxTree, p.Segments[:len(p.Segments)-1])
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for _, parent := range parents {
+		targets, err := db.jsonChildren(idxTree, parent, last)
+		if err != nil {
+			return count, err
+		}
+		if len(targets) == 0 {
+			continue
+		}
+		if parent.Node.Kind == document.Array {
+			err = db.jsonDelElementsInternal(idxTree, key, parent, targets)
+		} else {
+			for _, target := range targets {
+				if err = db.jsonDelValueInternal(idxTree, key, target.Subkey); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return count, err
+		}
+		count += len(targets)
+	}
+	return count, nil
+}
+
+// JSONArrAppend appends the JSON values to the arrays at path in the document stored at key,
+// and returns the new lengths of the arrays. The length is nil if the matched value is not an
+// array. If the key does not exist, ErrKeyNotFound is returned.
+func (db *KhighDB) JSONArrAppend(key, path []byte, values ...[]byte) ([]*int64, error) {
+	if len(values) == 0 {
+		return nil, ErrInvalidNumberOfArgs
+	}
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	parsed := make([]interface{}, len(values))
+	for i, value := range values {
+		if parsed[i], err = document.Parse(value); err != nil {
+			return nil, ErrInvalidJSON
+		}
+	}
+	db.jsonIndex.mu.Lock()
+	defer db.jsonIndex.mu.Unlock()
+
+	idxTree := db.jsonIndex.trees[string(key)]
+	if idxTree == nil {
+		return nil, ErrKeyNotFound
+	}
+	matches, err := db.jsonMatch(idxTree, p.Segments)
+	if err != nil {
+		return nil, err
+	}
+	lengths := make([]*int64, len(matches))
+	for i, match := range matches {
+		if match.Node.Kind != document.Array {
+			continue
+		}
+		for j, value := range parsed {
+			subkey := document.IndexKey(match.Subkey, match.Node.Len+j)
+			if err = db.jsonFlattenInternal(idxTree, key, subkey, value); err != nil {
+				return nil, err
+			}
+		}
+		node := &document.Node{Kind: document.Array, Len: match.Node.Len + len(parsed)}
+		if err = db.jsonPutInternal(idxTree, key, match.Subkey, node.Encode()); err != nil {
+			return nil, err
+		}
+		length := int64(node.Len)
+		lengths[i] = &length
+	}
+	return lengths, nil
+}
+
+// JSONNumIncrBy increments the numbers at path in the document stored at key by delta, which
+// is a JSON number, and returns the JSON text of the new numbers. The result is nil if the
+// matched value is not a number. The sum is an integer if both the number and delta are
+// integers and the sum does not overflow, otherwise it is a float.
+// If the key does not exist, ErrKeyNotFound is returned.
+func (db *KhighDB) JSONNumIncrBy(key, path, delta []byte) ([][]byte, error) {
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if !document.IsNumberText(delta) {
+		return nil, ErrJSONInvalidNumber
+	}
+	db.jsonIndex.mu.Lock()
+	defer db.jsonIndex.mu.Unlock()
+
+	idxTree := db.jsonIndex.trees[string(key)]
+	if idxTree == nil {
+		return nil, ErrKeyNotFound
+	}
+	matches, err := db.jsonMatch(idxTree, p.Segments)
+	if err != nil {
+		return nil, err
+	}
+	// Calculate all the sums before writing, so nothing is written if any sum overflows.
+	sums := make([][]byte, len(matches))
+	for i, match := range matches {
+		if !match.Node.IsNumber() {
+			continue
+		}
+		if sums[i], err = document.AddNumber(match.Node.Raw, delta); err != nil {
+			if errors.Is(err, document.ErrNumberOverflow) {
+				return nil, ErrJSONNumberOverflow
+			}
+			return nil, err
+		}
+	}
+	for i, match := range matches {
+		if sums[i] == nil {
+			continue
+		}
+		node := &document.Node{Kind: document.Scalar, Raw: sums[i]}
+		if err = db.jsonPutInternal(idxTree, key, match.Subkey, node.Encode()); err != nil {
+			return nil, err
+		}
+	}
+	return sums, nil
+}
+
+// jsonMatch returns the values matched by the path segments, starting from the root.
+func (db *KhighDB) jsonMatch(idxTree *art.AdaptiveRadixTree, segments []document.Segment) ([]document.Record, error) {
+	root, err := db.jsonNode(idxTree, document.RootKey)
+	if err != nil || root == nil {
+		return nil, err
+	}
+	matches := []document.Record{{Subkey: document.RootKey, Node: root}}
+	for _, seg := range segments {
+		var next []document.Record
+		for _, match := range matches {
+			children, err := db.jsonChildren(idxTree, match, seg)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, children...)
+		}
+		matches = next
+	}
+	return matches, nil
+}
+
+// jsonChildren returns the existing members or elements of the value selected by the segment.
+func (db *KhighDB) jsonChildren(idxTree *art.AdaptiveRadixTree, parent document.Record,
+	seg document.Segment) ([]document.Record, error) {
+	var subkeys [][]byte
+	switch {
+	case parent.Node.Kind == document.Object && seg.Kind == document.KeySegment:
+		subkeys = append(subkeys, document.ChildKey(parent.Subkey, seg.Key))
+	case parent.Node.Kind == document.Object && seg.Kind == document.WildcardSegment:
+		var names []string
+		idxTree.ForEachPrefix(document.MemberPrefix(parent.Subkey), func(subkey []byte, _ interface{}) bool {
+			if member, ok := document.ChildSegment(parent.Subkey, subkey); ok {
+				names = append(names, member.Key)
+			}
+			return true
+		})
+		// The members are matched in order of names, as the objects are encoded.
+		sort.Strings(names)
+		for _, name := range names {
+			subkeys = append(subkeys, document.ChildKey(parent.Subkey, name))
+		}
+	case parent.Node.Kind == document.Array && seg.Kind == document.IndexSegment:
+		index := seg.Index
+		if index < 0 {
+			index += parent.Node.Len
+		}
+		if index >= 0 && index < parent.Node.Len {
+			subkeys = append(subkeys, document.IndexKey(parent.Subkey, index))
+		}
+	case parent.Node.Kind == document.Array && seg.Kind == document.WildcardSegment:
+		for i := 0; i < parent.Node.Len; i++ {
+			subkeys = append(subkeys, document.IndexKey(parent.Subkey, i))
+		}
+	}
+
+	var children []document.Record
+	for _, subkey := range subkeys {
+		node, err := db.jsonNode(idxTree, subkey)
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			children = append(children, document.Record{Subkey: subkey, Node: node})
+		}
+	}
+	return children, nil
+}
+
+// jsonNode returns the node of the subkey, nil is returned if it does not exist.
+func (db *KhighDB) jsonNode(idxTree *art.AdaptiveRadixTree, subkey []byte) (*document.Node, error) {
+	val, err := db.getVal(idxTree, subkey, JSON)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return document.DecodeNode(val)
+}
+
+// jsonRecords returns the records of the value at subkey and all its descendants in order.
+func (db *KhighDB) jsonRecords(idxTree *art.AdaptiveRadixTree, subkey []byte) ([]document.Record, error) {
+	var records []document.Record
+	var valErr error
+	idxTree.ForEachPrefix(subkey, func(key []byte, _ interface{}) bool {
+		var node *document.Node
+		if node, valErr = db.jsonNode(idxTree, key); valErr != nil {
+			return false
+		}
+		if node != nil {
+			records = append(records, document.Record{Subkey: key, Node: node})
+		}
+		return true
+	})
+	return records, valErr
+}
+
+// jsonValue builds the value at subkey.
+func (db *KhighDB) jsonValue(idxTree *art.AdaptiveRadixTree, subkey []byte) (interface{}, error) {
+	records, err := db.jsonRecords(idxTree, subkey)
+	if err != nil {
+		return nil, err
+	}
+	return document.Build(subkey, records)
+}
+
+// jsonSetInternal sets the value at subkey, old is the node at subkey before setting.
+func (db *KhighDB) jsonSetInternal(key, subkey []byte, old *document.Node, value interface{}) error {
+	if old != nil && old.Kind != document.Scalar {
+		// Replacing the whole document is cheaper by clearing the key.
+		if string(subkey) == string(document.RootKey) {
+			if err := db.clearKeyInternal(key, JSON); err != nil {
+				return err
+			}
+		} else if err := db.jsonDelDescendantsInternal(db.jsonIndex.trees[string(key)], key, subkey); err != nil {
+			return err
+		}
+	}
+	if db.jsonIndex.trees[string(key)] == nil {
+		db.jsonIndex.trees[string(key)] = art.NewART()
+	}
+	return db.jsonFlattenInternal(db.jsonIndex.trees[string(key)], key, subkey, value)
+}
+
+// jsonFlattenInternal writes the nodes of the value at subkey.
+func (db *KhighDB) jsonFlattenInternal(idxTree *art.AdaptiveRadixTree, key, subkey []byte, value interface{}) error {
+	return document.Flatten(subkey, value, func(subkey []byte, node *document.Node) error {
+		return db.jsonPutInternal(idxTree, key, subkey, node.Encode())
+	})
+}
+
+// jsonDelValueInternal deletes the value at subkey with all its descendants.
+func (db *KhighDB) jsonDelValueInternal(idxTree *art.AdaptiveRadixTree, key, subkey []byte) error {
+	if err := db.jsonDelDescendantsInternal(idxTree, key, subkey); err != nil {
+		return err
+	}
+	return db.jsonDelInternal(idxTree, key, subkey)
+}
+
+// jsonDelDescendantsInternal deletes all the descendants of the value at subkey.
+func (db *KhighDB) jsonDelDescendantsInternal(idxTree *art.AdaptiveRadixTree, key, subkey []byte) error {
+	var descendants [][]byte
+	idxTree.ForEachPrefix(subkey, func(key []byte, _ interface{}) bool {
+		if len(key) > len(subkey) {
+			descendants = append(descendants, key)
+		}
+		return true
+	})
+	for _, descendant := range descendants {
+		if err := db.jsonDelInternal(idxTree, key, descendant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonDelElementsInternal deletes the elements of the array, and moves the elements after them
+// forward.
+func (db *KhighDB) jsonDelElementsInternal(idxTree *art.AdaptiveRadixTree, key []byte, array document.Record,
+	elements []document.Record) error {
+	deleted := make(map[string]bool, len(elements))
+	for _, elem := range elements {
+		deleted[string(elem.Subkey)] = true
+		if err := db.jsonDelValueInternal(idxTree, key, elem.Subkey); err != nil {
+			return err
+		}
+	}
+
+	length := 0
+	for i := 0; i < array.Node.Len; i++ {
+		subkey := document.IndexKey(array.Subkey, i)
+		if deleted[string(subkey)] {
+			continue
+		}
+		if i != length {
+			if err := db.jsonMoveInternal(idxTree, key, subkey, document.IndexKey(array.Subkey, length)); err != nil {
+				return err
+			}
+		}
+		length++
+	}
+	node := &document.Node{Kind: document.Array, Len: length}
+	return db.jsonPutInternal(idxTree, key, array.Subkey, node.Encode())
+}
+
+// jsonMoveInternal moves the value at subkey with all its descendants to newSubkey.
+func (db *KhighDB) jsonMoveInternal(idxTree *art.AdaptiveRadixTree, key, subkey, newSubkey []byte) error {
+	var subkeys, values [][]byte
+	var valErr error
+	idxTree.ForEachPrefix(subkey, func(key []byte, _ interface{}) bool {
+		val, err := db.getVal(idxTree, key, JSON)
+		if err != nil {
+			valErr = err
+			return false
+		}
+		subkeys, values = append(subkeys, key), append(values, val)
+		return true
+	})
+	if valErr != nil {
+		return valErr
+	}
+	for i := range subkeys {
+		moved := append(append([]byte{}, newSubkey...), subkeys[i][len(subkey):]...)
+		if err := db.jsonPutInternal(idxTree, key, moved, values[i]); err != nil {
+			return err
+		}
+		if err := db.jsonDelInternal(idxTree, key, subkeys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *KhighDB) jsonPutInternal(idxTree *art.AdaptiveRadixTree, key, subkey, value []byte) error {
+	ent := &storage.LogEntry{Key: db.encodeKey(key, subkey), Value: value}
+	pos, err := db.writeLogEntry(ent, JSON)
+	if err != nil {
+		return err
+	}
+
+	entry := &storage.LogEntry{Key: subkey, Value: value}
+	return db.updateIndexTree(idxTree, entry, pos, true, JSON)
+}
+
+func (db *KhighDB) jsonDelInternal(idxTree *art.AdaptiveRadixTree, key, subkey []byte) error {
+	ent := &storage.LogEntry{Key: db.encodeKey(key, subkey), Type: storage.TypeDelete}
+	if _, err := db.writeLogEntry(ent, JSON); err != nil {
+		return err
+	}
+
+	val, updated := idxTree.Delete(subkey)
+	db.sendDiscard(val, updated, JSON)
+	return nil
+}
+
+func parseJSONPath(path []byte) (*document.Path, error) {
+	p, err := document.ParsePath(string(path))
+	if err != nil {
+		return nil, ErrInvalidJSONPath
+	}
+	return p, nil
+}
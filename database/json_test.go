@@ -0,0 +1,370 @@
+package khighdb
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+func TestKhighDB_JSONSet(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBJSONSet(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBJSONSet(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBJSONSet(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_JSONSetNested(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("profile")
+	doc := fmt.Sprintf(`{"name":"KHighness","bio":"%s","address":{"city":"Hangzhou"}}`, strings.Repeat("x", 4096))
+	_, err := db.JSONSet(key, []byte("$"), []byte(doc), JSONSetOptions{})
+	assert.Nil(t, err)
+
+	// Updating a nested field only writes a small log entry instead of the whole document.
+	logFile := db.getActiveLogFile(JSON)
+	writeAt := logFile.WriteAt
+	_, err = db.JSONSet(key, []byte("$.address.city"), []byte(`"Shanghai"`), JSONSetOptions{})
+	assert.Nil(t, err)
+	assert.True(t, logFile.WriteAt-writeAt < 64)
+
+	value, err := db.JSONGet(key, []byte("$.address"))
+	assert.Nil(t, err)
+	assert.Equal(t, `[{"city":"Shanghai"}]`, string(value))
+
+	// The old members are removed when an object is replaced.
+	_, err = db.JSONSet(key, []byte("address"), []byte(`{"zip":"310000"}`), JSONSetOptions{})
+	assert.Nil(t, err)
+	value, err = db.JSONGet(key, []byte("address"))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"zip":"310000"}`, string(value))
+	_, err = db.JSONGet(key, []byte("address.city"))
+	assert.Equal(t, ErrJSONPathNotFound, err)
+}
+
+func TestKhighDB_JSONGet(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("doc")
+	_, err := db.JSONGet(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.JSONSet(key, []byte("$"), []byte(`{"ab":{"x":1},"b":{"x":"<2>"},"c":[1,[2,3]],"d":null}`), JSONSetOptions{})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		path  string
+		value string
+	}{
+		{"$", `[{"ab":{"x":1},"b":{"x":"<2>"},"c":[1,[2,3]],"d":null}]`},
+		{".", `{"ab":{"x":1},"b":{"x":"<2>"},"c":[1,[2,3]],"d":null}`},
+		{"$.*.x", `[1,"<2>"]`},
+		{"$['c'][-1][0]", `[2]`},
+		{"c[1][*]", `2`},
+		{"$.d", `[null]`},
+		{"$.e", `[]`},
+		{"$.c.x", `[]`},
+	}
+	for _, tt := range tests {
+		value, err := db.JSONGet(key, []byte(tt.path))
+		assert.Nil(t, err, tt.path)
+		assert.Equal(t, tt.value, string(value), tt.path)
+	}
+
+	value, err := db.JSONGet(key, []byte("$.ab"), []byte("c[0]"))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"$.ab":[{"x":1}],"c[0]":1}`, string(value))
+	_, err = db.JSONGet(key, []byte(".e"))
+	assert.Equal(t, ErrJSONPathNotFound, err)
+	_, err = db.JSONGet(key, []byte("$["))
+	assert.Equal(t, ErrInvalidJSONPath, err)
+}
+
+func TestKhighDB_JSONDel(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("doc")
+	n, err := db.JSONDel(key, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	_, err = db.JSONSet(key, []byte("$"), []byte(`{"a":[0,{"x":1},[2],3,4],"b":{"x":1,"y":2},"c":true}`), JSONSetOptions{})
+	assert.Nil(t, err)
+
+	n, err = db.JSONDel(key, []byte("$.b.*"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	// The elements after the deleted ones are moved forward.
+	n, err = db.JSONDel(key, []byte("$.a[0]"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = db.JSONDel(key, []byte("$.a[-2]"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = db.JSONDel(key, []byte("$.missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(db.options)
+	assert.Nil(t, err)
+
+	value, err := db.JSONGet(key)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":[{"x":1},[2],4],"b":{},"c":true}`, string(value))
+	lengths, err := db.JSONArrAppend(key, []byte("a"), []byte("5"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), *lengths[0])
+	value, err = db.JSONGet(key, []byte("$.a[1:]"))
+	assert.Equal(t, ErrInvalidJSONPath, err)
+	value, err = db.JSONGet(key, []byte("$.a[*]"))
+	assert.Nil(t, err)
+	assert.Equal(t, `[{"x":1},[2],4,5]`, string(value))
+
+	n, err = db.JSONDel(key, []byte("$.a[*]"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	value, err = db.JSONGet(key, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, `[]`, string(value))
+
+	// The key is removed with the root.
+	n, err = db.JSONDel(key, []byte("$"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 0, db.Exists(key))
+	assert.Nil(t, db.HSet(key, []byte("f"), []byte("v")))
+
+	assert.Nil(t, db.Close())
+	db, err = Open(db.options)
+	assert.Nil(t, err)
+	_, err = db.JSONGet(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	dataType, err := db.Type(key)
+	assert.Nil(t, err)
+	assert.Equal(t, Hash, dataType)
+}
+
+func TestKhighDB_JSONArrAppend(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("doc")
+	_, err := db.JSONArrAppend(key, []byte("$"), []byte("1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.JSONSet(key, []byte("$"), []byte(`{"a":[1],"b":{"a":[]},"c":{"a":"s"}}`), JSONSetOptions{})
+	assert.Nil(t, err)
+
+	lengths, err := db.JSONArrAppend(key, []byte("$..a"), []byte("1"))
+	assert.Equal(t, ErrInvalidJSONPath, err)
+	_, err = db.JSONArrAppend(key, []byte("$.a"), []byte("{"))
+	assert.Equal(t, ErrInvalidJSON, err)
+	_, err = db.JSONArrAppend(key, []byte("$.a"))
+	assert.Equal(t, ErrInvalidNumberOfArgs, err)
+
+	lengths, err = db.JSONArrAppend(key, []byte("$.*.a"), []byte(`{"x":[true]}`), []byte(`"s"`))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(lengths))
+	assert.Equal(t, int64(2), *lengths[0])
+	assert.Nil(t, lengths[1])
+	lengths, err = db.JSONArrAppend(key, []byte("$.a"), []byte("null"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), *lengths[0])
+
+	value, err := db.JSONGet(key)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":[1,null],"b":{"a":[{"x":[true]},"s"]},"c":{"a":"s"}}`, string(value))
+}
+
+func TestKhighDB_JSONNumIncrBy(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("doc")
+	_, err := db.JSONNumIncrBy(key, []byte("$"), []byte("1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.JSONSet(key, []byte("$"), []byte(`{"a":1,"b":1.5,"c":"1","d":1.7e308}`), JSONSetOptions{})
+	assert.Nil(t, err)
+
+	// Nothing is incremented if any sum overflows.
+	sums, err := db.JSONNumIncrBy(key, []byte("$.*"), []byte("1e308"))
+	assert.Equal(t, ErrJSONNumberOverflow, err)
+	assert.Nil(t, sums)
+	_, err = db.JSONNumIncrBy(key, []byte("a"), []byte("abc"))
+	assert.Equal(t, ErrJSONInvalidNumber, err)
+	_, err = db.JSONNumIncrBy(key, []byte("a"), []byte("inf"))
+	assert.Equal(t, ErrJSONInvalidNumber, err)
+
+	sums, err = db.JSONNumIncrBy(key, []byte("$.a"), []byte("2"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("3")}, sums)
+	_, err = db.JSONDel(key, []byte("d"))
+	assert.Nil(t, err)
+	sums, err = db.JSONNumIncrBy(key, []byte("$.*"), []byte("-0.5"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("2.5"), []byte("1"), nil}, sums)
+
+	value, err := db.JSONGet(key)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":2.5,"b":1,"c":"1"}`, string(value))
+}
+
+func TestKhighDB_JSONKeyspace(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer func() { destroyDB(db) }()
+
+	key, newKey := []byte("doc"), []byte("new-doc")
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	_, err := db.JSONSet([]byte("str"), []byte("$"), []byte("1"), JSONSetOptions{})
+	assert.Equal(t, ErrWrongType, err)
+	_, err = db.JSONSet(key, []byte("$"), []byte(`{"a":[1,{"b":2}]}`), JSONSetOptions{})
+	assert.Nil(t, err)
+	dataType, err := db.Type(key)
+	assert.Nil(t, err)
+	assert.Equal(t, JSON, dataType)
+	assert.Equal(t, ErrWrongType, db.HSet(key, []byte("f"), []byte("v")))
+
+	assert.Nil(t, db.Rename(key, newKey))
+	assert.Equal(t, 0, db.Exists(key))
+	assert.Nil(t, db.Close())
+	db, err = Open(db.options)
+	assert.Nil(t, err)
+
+	value, err := db.JSONGet(newKey)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":[1,{"b":2}]}`, string(value))
+	_, err = db.JSONGet(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	keys, err := db.Keys("*doc")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{newKey}, keys)
+
+	n, err := db.Del(newKey)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 0, db.Exists(newKey))
+}
+
+func TestKhighDB_JSONGC(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-json")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("doc")
+	_, err = db.JSONSet(key, []byte("$"), []byte(`{"counter":0,"items":[]}`), JSONSetOptions{})
+	assert.Nil(t, err)
+	item := fmt.Sprintf(`"%s"`, strings.Repeat("x", 4096))
+	for i := 0; i < 64; i++ {
+		_, err = db.JSONArrAppend(key, []byte("items"), []byte(item))
+		assert.Nil(t, err)
+		_, err = db.JSONNumIncrBy(key, []byte("counter"), []byte("1"))
+		assert.Nil(t, err)
+	}
+	n, err := db.JSONDel(key, []byte("$.items[1:]"))
+	assert.Equal(t, ErrInvalidJSONPath, err)
+	for i := 0; i < 63; i++ {
+		n, err = db.JSONDel(key, []byte("$.items[-1]"))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	archived := len(db.archivedLogFiles[JSON])
+	assert.Nil(t, db.RunLogFileGC(JSON, -1, 0.5))
+	assert.True(t, len(db.archivedLogFiles[JSON]) < archived)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+
+	value, err := db.JSONGet(key, []byte("$.counter"), []byte("$.items.length"))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"$.counter":[64],"$.items.length":[]}`, string(value))
+	value, err = db.JSONGet(key, []byte("items[0]"))
+	assert.Nil(t, err)
+	assert.Equal(t, item, string(value))
+}
+
+func testKhighDBJSONSet(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("doc")
+	_, err := db.JSONSet(key, []byte("$.a"), []byte("1"), JSONSetOptions{})
+	assert.Equal(t, ErrJSONNewRootPath, err)
+	_, err = db.JSONSet(key, []byte("$"), []byte(`{"a":`), JSONSetOptions{})
+	assert.Equal(t, ErrInvalidJSON, err)
+	_, err = db.JSONSet(key, []byte("$."), []byte("1"), JSONSetOptions{})
+	assert.Equal(t, ErrInvalidJSONPath, err)
+	set, err := db.JSONSet(key, []byte("$"), []byte("{}"), JSONSetOptions{XX: true})
+	assert.Nil(t, err)
+	assert.False(t, set)
+	assert.Equal(t, 0, db.Exists(key))
+
+	set, err = db.JSONSet(key, []byte("."), []byte(`{"name":"KHighness","tags":["go"],"links":{}}`), JSONSetOptions{NX: true})
+	assert.Nil(t, err)
+	assert.True(t, set)
+	set, err = db.JSONSet(key, []byte("$"), []byte("{}"), JSONSetOptions{NX: true})
+	assert.Nil(t, err)
+	assert.False(t, set)
+
+	// The member is added to the existing object.
+	set, err = db.JSONSet(key, []byte("$.age"), []byte("18"), JSONSetOptions{})
+	assert.Nil(t, err)
+	assert.True(t, set)
+	set, err = db.JSONSet(key, []byte("$.links.blog"), []byte(`"khighness.github.io"`), JSONSetOptions{XX: true})
+	assert.Nil(t, err)
+	assert.False(t, set)
+	set, err = db.JSONSet(key, []byte("$.name"), []byte(`"Khighness"`), JSONSetOptions{NX: true})
+	assert.Nil(t, err)
+	assert.False(t, set)
+	set, err = db.JSONSet(key, []byte("tags[0]"), []byte(`"golang"`), JSONSetOptions{XX: true})
+	assert.Nil(t, err)
+	assert.True(t, set)
+	// The elements of array are not created by JSONSet.
+	set, err = db.JSONSet(key, []byte("$.tags[1]"), []byte(`"redis"`), JSONSetOptions{})
+	assert.Nil(t, err)
+	assert.False(t, set)
+	set, err = db.JSONSet(key, []byte("$.missing.a"), []byte("1"), JSONSetOptions{})
+	assert.Nil(t, err)
+	assert.False(t, set)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(db.options)
+	assert.Nil(t, err)
+
+	value, err := db.JSONGet(key)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"age":18,"links":{},"name":"KHighness","tags":["golang"]}`, string(value))
+
+	set, err = db.JSONSet(key, []byte("$.*"), []byte(`{"x":[1]}`), JSONSetOptions{})
+	assert.Nil(t, err)
+	assert.True(t, set)
+	set, err = db.JSONSet(key, []byte("$"), []byte(`[1,2]`), JSONSetOptions{})
+	assert.Nil(t, err)
+	assert.True(t, set)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(db.options)
+	assert.Nil(t, err)
+
+	value, err = db.JSONGet(key)
+	assert.Nil(t, err)
+	assert.Equal(t, `[1,2]`, string(value))
+}
@@ -0,0 +1,634 @@
+package khighdb
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Khighness/khighdb/data/art"
+	"github.com/Khighness/khighdb/storage"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// randomKeyRetries is the max times RandomKey retries if it picks an expired key.
+const randomKeyRetries = 16
+
+// ErrWrongType represents the key already holds a value of another data type.
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// Type returns the data type of the value stored at key.
+// If the key does not exist, ErrKeyNotFound is returned.
+func (db *KhighDB) Type(key []byte) (DataType, error) {
+	db.keyTypes.mu.Lock()
+	dataType, ok := db.keyTypes.dataType(key, time.Now().UnixNano())
+	db.keyTypes.mu.Unlock()
+	if ok {
+		return dataType, nil
+	}
+
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+	if db.strKeyExists(key) {
+		return String, nil
+	}
+	return String, ErrKeyNotFound
+}
+
+// Exists returns the number of keys existing among the specified keys.
+// The key mentioned multiple times is counted multiple times.
+func (db *KhighDB) Exists(keys ...[]byte) int {
+	var count int
+	for _, key := range keys {
+		if _, err := db.Type(key); err == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// Del removes the specified keys of any data type, a key of collection is removed with all
+// its elements. It returns the number of keys removed, non existing keys are ignored.
+func (db *KhighDB) Del(keys ...[]byte) (int, error) {
+	var count int
+	for _, key := range keys {
+		dataType, err := db.Type(key)
+		if err != nil {
+			continue
+		}
+		ok, err := db.delKey(key, dataType)
+		if err != nil {
+			return count, err
+		}
+		if ok {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Rename renames key to newKey, the value of newKey is overwritten if it already exists.
+// If key does not exist, ErrKeyNotFound is returned.
+// Note that if newKey holds another data type, it is removed before renaming, so the
+// operation is not atomic as a whole.
+func (db *KhighDB) Rename(key, newKey []byte) error {
+	_, err := db.rename(key, newKey, false)
+	return err
+}
+
+// RenameNX renames key to newKey only if newKey does not exist.
+// It returns false if newKey already exists.
+// If key does not exist, ErrKeyNotFound is returned.
+func (db *KhighDB) RenameNX(key, newKey []byte) (bool, error) {
+	return db.rename(key, newKey, true)
+}
+
+// Keys returns all the keys matching the glob-style pattern, see util.GlobMatch.
+// All the keys are returned if pattern is empty.
+// Note that it may be very slow when there are many keys, try ScanCursor instead.
+func (db *KhighDB) Keys(pattern string) ([][]byte, error) {
+	_, keys, err := db.ScanCursor(nil, ScanOptions{Match: pattern, Count: math.MaxInt32})
+	return keys, err
+}
+
+// RandomKey returns a random key of any data type.
+// If there is no key, ErrKeyNotFound is returned.
+func (db *KhighDB) RandomKey() ([]byte, error) {
+	for i := 0; i < randomKeyRetries; i++ {
+		db.strIndex.mu.RLock()
+		strNum := db.strIndex.idxTree.Size()
+		db.strIndex.mu.RUnlock()
+		db.keyTypes.mu.Lock()
+		total := strNum + db.keyTypes.types.Size()
+		db.keyTypes.mu.Unlock()
+		if total == 0 {
+			return nil, ErrKeyNotFound
+		}
+
+		n := rand.Intn(total)
+		if n >= strNum {
+			if key := db.randomCollectionKey(n - strNum); key != nil {
+				return key, nil
+			}
+			continue
+		}
+		if key := db.randomStrKey(n); key != nil {
+			return key, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+// DBSize returns the number of keys of all the data types.
+// Note that the expired keys of String which are not removed yet are counted.
+func (db *KhighDB) DBSize() int {
+	db.strIndex.mu.RLock()
+	size := db.strIndex.idxTree.Size()
+	db.strIndex.mu.RUnlock()
+
+	db.keyTypes.mu.Lock()
+	defer db.keyTypes.mu.Unlock()
+	size += db.keyTypes.types.Size()
+	nano := time.Now().UnixNano()
+	for _, deadline := range db.keyTypes.deadlines {
+		if deadline < nano {
+			size--
+		}
+	}
+	return size
+}
+
+// randomStrKey returns the n-th key of String, nil is returned if it is expired or deleted.
+func (db *KhighDB) randomStrKey(n int) []byte {
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+
+	var key []byte
+	db.strIndex.idxTree.ForEachPrefix(nil, func(k []byte, _ interface{}) bool {
+		if n > 0 {
+			n--
+			return true
+		}
+		key = k
+		return false
+	})
+	if key == nil || !db.strKeyExists(key) {
+		return nil
+	}
+	return key
+}
+
+// randomCollectionKey returns the n-th key of collections, nil is returned if it is expired
+// or deleted.
+func (db *KhighDB) randomCollectionKey(n int) []byte {
+	db.keyTypes.mu.Lock()
+	defer db.keyTypes.mu.Unlock()
+	var key []byte
+	db.keyTypes.types.ForEachPrefix(nil, func(k []byte, _ interface{}) bool {
+		if n > 0 {
+			n--
+			return true
+		}
+		key = k
+		return false
+	})
+	if key != nil && db.keyTypes.expired(key, time.Now().UnixNano()) {
+		return nil
+	}
+	return key
+}
+
+// rename renames key to newKey, it returns false only if nx is true and newKey exists.
+// The elements are written to newKey before key is deleted, so that the elements are not lost
+// if the db crashes in the middle of renaming.
+func (db *KhighDB) rename(key, newKey []byte, nx bool) (bool, error) {
+	dataType, err := db.Type(key)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(key, newKey) {
+		return !nx, nil
+	}
+	if newType, err := db.Type(newKey); err == nil {
+		if nx {
+			return false, nil
+		}
+		if newType != dataType {
+			if _, err = db.delKey(newKey, newType); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	mu := db.indexLock(dataType)
+	mu.Lock()
+	defer mu.Unlock()
+	if !db.keyExists(key, dataType) {
+		return false, ErrKeyNotFound
+	}
+	if db.keyExists(newKey, dataType) {
+		if nx {
+			return false, nil
+		}
+		if err = db.delKeyInternal(newKey, dataType); err != nil {
+			return false, err
+		}
+	}
+	if err = db.claimKey(newKey, dataType); err != nil {
+		return false, err
+	}
+	defer db.releaseKeyIfEmpty(key, dataType)
+
+	switch dataType {
+	case String:
+		err = db.renameStr(key, newKey)
+	case List:
+		err = db.renameList(key, newKey)
+	case Hash:
+		err = db.renameHash(key, newKey)
+	case Set:
+		err = db.renameSet(key, newKey)
+	case ZSet:
+		err = db.renameZSet(key, newKey)
+	case Stream:
+		err = db.renameStream(key, newKey)
+	case JSON:
+		err = db.renameJSON(key, newKey)
+	}
+	return err == nil, err
+}
+
+func (db *KhighDB) renameStr(key, newKey []byte) error {
+	node, err := db.getIndexNode(db.strIndex.idxTree, key)
+	if err != nil {
+		return err
+	}
+	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	if err != nil {
+		return err
+	}
+	if err = db.setInternal(newKey, val, node.expiredAt); err != nil {
+		return err
+	}
+	return db.delInternal(key)
+}
+
+func (db *KhighDB) renameList(key, newKey []byte) error {
+	idxTree := db.listIndex.trees[string(key)]
+	headSeq, tailSeq, err := db.listMeta(idxTree, key)
+	if err != nil {
+		return err
+	}
+	var values [][]byte
+	size := db.listLen(key, headSeq, tailSeq)
+	for _, elem := range db.listElems(key, headSeq, tailSeq, 0, size-1) {
+		val, err := db.getVal(idxTree, db.encodeListKey(key, elem.seq, elem.frac), List)
+		if err != nil {
+			return err
+		}
+		values = append(values, val)
+	}
+
+	db.listIndex.trees[string(newKey)] = art.NewART()
+	for _, val := range values {
+		if err = db.pushInternal(newKey, val, false); err != nil {
+			return err
+		}
+	}
+	if err = db.clearKeyInternal(key, List); err != nil {
+		return err
+	}
+	db.listIndex.blocking.serve()
+	return nil
+}
+
+func (db *KhighDB) renameHash(key, newKey []byte) error {
+	idxTree := db.hashIndex.trees[string(key)]
+	var fields, values [][]byte
+	var expiredAts []int64
+	var valErr error
+	idxTree.ForEachPrefix(nil, func(field []byte, value interface{}) bool {
+		val, err := db.getVal(idxTree, field, Hash)
+		if errors.Is(err, ErrKeyNotFound) {
+			// The expired field is not renamed.
+			return true
+		}
+		if err != nil {
+			valErr = err
+			return false
+		}
+		fields, values = append(fields, field), append(values, val)
+		expiredAts = append(expiredAts, value.(*indexNode).expiredAt)
+		return true
+	})
+	if valErr != nil {
+		return valErr
+	}
+
+	newTree := art.NewART()
+	db.hashIndex.trees[string(newKey)] = newTree
+	defer db.releaseKeyIfEmpty(newKey, Hash)
+	for i := range fields {
+		if err := db.hSetInternal(newTree, newKey, fields[i], values[i], expiredAts[i]); err != nil {
+			return err
+		}
+	}
+	return db.clearKeyInternal(key, Hash)
+}
+
+func (db *KhighDB) renameSet(key, newKey []byte) error {
+	members, err := db.sMembers(key)
+	if err != nil {
+		return err
+	}
+
+	newTree := art.NewART()
+	db.setIndex.trees[string(newKey)] = newTree
+	for _, member := range members {
+		if err = db.sAddInternal(newTree, newKey, member); err != nil {
+			return err
+		}
+	}
+	return db.clearKeyInternal(key, Set)
+}
+
+func (db *KhighDB) renameZSet(key, newKey []byte) error {
+	values := db.zsetIndex.indexes.ZRangeWithScores(string(key), 0, -1)
+	for i := 0; i+1 < len(values); i += 2 {
+		member, score := values[i].(string), values[i+1].(float64)
+		if err := db.zAddInternal(newKey, score, []byte(member)); err != nil {
+			return err
+		}
+	}
+	if err := db.clearKeyInternal(key, ZSet); err != nil {
+		return err
+	}
+	db.zsetIndex.blocking.serve()
+	return nil
+}
+
+func (db *KhighDB) renameStream(key, newKey []byte) error {
+	idxTree, s := db.streamIndex.trees[string(key)], db.streamIndex.streams[string(key)]
+	var subkeys, values [][]byte
+	var valErr error
+	idxTree.ForEachPrefix(nil, func(subkey []byte, _ interface{}) bool {
+		val, err := db.getVal(idxTree, subkey, Stream)
+		if err != nil {
+			valErr = err
+			return false
+		}
+		subkeys, values = append(subkeys, subkey), append(values, val)
+		return true
+	})
+	if valErr != nil {
+		return valErr
+	}
+
+	// The records don't hold the key, so they are rewritten as they are.
+	newTree := art.NewART()
+	db.streamIndex.trees[string(newKey)] = newTree
+	db.streamIndex.streams[string(newKey)] = s
+	for i := range subkeys {
+		if err := db.xPutInternal(newTree, newKey, subkeys[i], values[i]); err != nil {
+			return err
+		}
+	}
+	if err := db.clearKeyInternal(key, Stream); err != nil {
+		return err
+	}
+	db.streamIndex.blocking.signal(newKey)
+	db.streamIndex.blocking.serve()
+	return nil
+}
+
+func (db *KhighDB) renameJSON(key, newKey []byte) error {
+	idxTree := db.jsonIndex.trees[string(key)]
+	var subkeys, values [][]byte
+	var valErr error
+	idxTree.ForEachPrefix(nil, func(subkey []byte, _ interface{}) bool {
+		val, err := db.getVal(idxTree, subkey, JSON)
+		if err != nil {
+			valErr = err
+			return false
+		}
+		subkeys, values = append(subkeys, subkey), append(values, val)
+		return true
+	})
+	if valErr != nil {
+		return valErr
+	}
+
+	newTree := art.NewART()
+	db.jsonIndex.trees[string(newKey)] = newTree
+	for i := range subkeys {
+		if err := db.jsonPutInternal(newTree, newKey, subkeys[i], values[i]); err != nil {
+			return err
+		}
+	}
+	return db.clearKeyInternal(key, JSON)
+}
+
+// delKey removes the key of the data type, it returns false if the key does not exist.
+func (db *KhighDB) delKey(key []byte, dataType DataType) (bool, error) {
+	mu := db.indexLock(dataType)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !db.keyExists(key, dataType) {
+		return false, nil
+	}
+	if err := db.delKeyInternal(key, dataType); err != nil {
+		return false, err
+	}
+	db.releaseKeyIfEmpty(key, dataType)
+	return true, nil
+}
+
+// delKeyInternal removes the key of the data type with all its elements.
+func (db *KhighDB) delKeyInternal(key []byte, dataType DataType) error {
+	if dataType == String {
+		return db.delInternal(key)
+	}
+	return db.clearKeyInternal(key, dataType)
+}
+
+// clearKeyInternal removes the collection key of the data type with all its elements by
+// writing a single key delete entry, whatever how many elements the key holds.
+func (db *KhighDB) clearKeyInternal(key []byte, dataType DataType) error {
+	trees := db.collectionTrees(dataType)
+	idxTree := trees[string(key)]
+	if idxTree == nil {
+		return nil
+	}
+	ent := &storage.LogEntry{Key: key, Type: storage.TypeKeyDelete}
+	if _, err := db.writeLogEntry(ent, dataType); err != nil {
+		return err
+	}
+	delete(trees, string(key))
+	if dataType == List {
+		delete(db.listIndex.inserts, string(key))
+	}
+	if dataType == Hash {
+		db.hashIndex.expires.ZClear(string(key))
+	}
+	if dataType == ZSet {
+		db.zsetIndex.indexes.ZClear(string(key))
+	}
+	if dataType == Stream {
+		delete(db.streamIndex.streams, string(key))
+	}
+	db.discardTree(idxTree, dataType)
+	return nil
+}
+
+// claimKey makes sure that the key is not held by other data types before it is created as
+// dataType, and records the data type of a collection key.
+// It must be called with the write lock of dataType held.
+func (db *KhighDB) claimKey(key []byte, dataType DataType) error {
+	if dataType != String {
+		db.strIndex.mu.RLock()
+		defer db.strIndex.mu.RUnlock()
+		if db.strKeyExists(key) {
+			return ErrWrongType
+		}
+	}
+
+	db.keyTypes.mu.Lock()
+	defer db.keyTypes.mu.Unlock()
+	t, ok := db.keyTypes.dataType(key, time.Now().UnixNano())
+	if ok && t != dataType {
+		return ErrWrongType
+	}
+	if !ok {
+		// The hash whose fields are all expired is taken over, its fields are deleted
+		// lazily by the hash commands or log file gc.
+		db.keyTypes.remove(key)
+		if dataType != String {
+			// The key is copied, since the tree holds it after the call.
+			db.keyTypes.types.Put(append([]byte(nil), key...), dataType)
+		}
+	}
+	return nil
+}
+
+// releaseKeyIfEmpty removes the collection key if it has no elements, so that it can be
+// created as other data types.
+// It must be called with the write lock of dataType held.
+func (db *KhighDB) releaseKeyIfEmpty(key []byte, dataType DataType) {
+	trees := db.collectionTrees(dataType)
+	if trees == nil {
+		return
+	}
+	if idxTree := trees[string(key)]; idxTree != nil {
+		if idxTree.Size() > 0 {
+			return
+		}
+		delete(trees, string(key))
+	}
+
+	db.keyTypes.mu.Lock()
+	defer db.keyTypes.mu.Unlock()
+	if t, ok := db.keyTypes.types.Get(key).(DataType); ok && t == dataType {
+		db.keyTypes.remove(key)
+	}
+}
+
+// dataType returns the data type of key, the hash after its deadline is regarded as not
+// existing. It must be called with the lock held.
+func (k *keyTypeIndex) dataType(key []byte, nano int64) (DataType, bool) {
+	t, ok := k.types.Get(key).(DataType)
+	if ok && k.expired(key, nano) {
+		return t, false
+	}
+	return t, ok
+}
+
+// expired checks if key is a hash after its deadline, with the lock held.
+func (k *keyTypeIndex) expired(key []byte, nano int64) bool {
+	deadline, ok := k.deadlines[string(key)]
+	return ok && deadline < nano
+}
+
+// remove removes the data type of key, with the lock held.
+func (k *keyTypeIndex) remove(key []byte) {
+	k.types.Delete(key)
+	delete(k.deadlines, string(key))
+}
+
+// keyExists checks if the key of the data type exists, with the lock of dataType held.
+func (db *KhighDB) keyExists(key []byte, dataType DataType) bool {
+	if dataType == String {
+		return db.strKeyExists(key)
+	}
+	idxTree := db.collectionTrees(dataType)[string(key)]
+	return idxTree != nil && idxTree.Size() > 0
+}
+
+// strKeyExists checks if the key of String exists and is not expired.
+func (db *KhighDB) strKeyExists(key []byte) bool {
+	node, _ := db.strIndex.idxTree.Get(key).(*indexNode)
+	if node == nil {
+		return false
+	}
+	return node.expiredAt == 0 || node.expiredAt > time.Now().UnixNano()
+}
+
+// collectionTrees returns the index trees of the collection data type.
+func (db *KhighDB) collectionTrees(dataType DataType) map[string]*art.AdaptiveRadixTree {
+	switch dataType {
+	case List:
+		return db.listIndex.trees
+	case Hash:
+		return db.hashIndex.trees
+	case Set:
+		return db.setIndex.trees
+	case ZSet:
+		return db.zsetIndex.trees
+	case Stream:
+		return db.streamIndex.trees
+	case JSON:
+		return db.jsonIndex.trees
+	}
+	return nil
+}
+
+// indexLock returns the lock of the index of the data type.
+func (db *KhighDB) indexLock(dataType DataType) *sync.RWMutex {
+	switch dataType {
+	case List:
+		return db.listIndex.mu
+	case Hash:
+		return db.hashIndex.mu
+	case Set:
+		return db.setIndex.mu
+	case ZSet:
+		return db.zsetIndex.mu
+	case Stream:
+		return db.streamIndex.mu
+	case JSON:
+		return db.jsonIndex.mu
+	}
+	return db.strIndex.mu
+}
+
+// loadKeyTypes removes the empty collections left by index loading, and records the data
+// types of the collection keys.
+func (db *KhighDB) loadKeyTypes() {
+	nano := time.Now().UnixNano()
+	for _, dataType := range []DataType{List, Hash, Set, ZSet, Stream, JSON} {
+		trees := db.collectionTrees(dataType)
+		for key, idxTree := range trees {
+			empty := idxTree.Size() == 0
+			if dataType == List && !empty {
+				headSeq, tailSeq, err := db.listMeta(idxTree, []byte(key))
+				empty = err == nil && db.listLen([]byte(key), headSeq, tailSeq) == 0
+			}
+			if empty {
+				delete(trees, key)
+				if dataType == Stream {
+					delete(db.streamIndex.streams, key)
+				}
+				continue
+			}
+			var deadline int64
+			if dataType == Hash {
+				// The hash whose fields are all expired is not recorded, it might have been
+				// taken over by other data types.
+				deadline = db.hDeadline([]byte(key), idxTree)
+				if deadline != 0 && deadline < nano {
+					continue
+				}
+			}
+			if _, ok := db.keyTypes.types.Get([]byte(key)).(DataType); !ok {
+				db.keyTypes.types.Put([]byte(key), dataType)
+				if deadline != 0 {
+					db.keyTypes.deadlines[key] = deadline
+				}
+			}
+		}
+	}
+}
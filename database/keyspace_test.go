@@ -0,0 +1,405 @@
+package khighdb
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Khighness/khighdb/storage"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+func TestKhighDB_Type(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBType(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBType(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBType(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_Del(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBDel(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBDel(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBDel(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_Rename(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBRename(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBRename(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBRename(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_RenameOrder(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, db.HSet([]byte("hash"), getKey(i), getValue16B()))
+	}
+	logFile := db.getActiveLogFile(Hash)
+	offset := logFile.WriteAt
+	assert.Nil(t, db.Rename([]byte("hash"), []byte("hash2")))
+
+	// The fields of the new key are written before the key delete entry of the old key.
+	var ents []*storage.LogEntry
+	for offset < logFile.WriteAt {
+		ent, size, err := logFile.ReadLogEntry(offset)
+		assert.Nil(t, err)
+		ents = append(ents, ent)
+		offset += size
+	}
+	assert.Equal(t, 5, len(ents))
+	for _, ent := range ents[:4] {
+		key, _ := db.decodeKey(ent.Key)
+		assert.Equal(t, []byte("hash2"), key)
+	}
+	assert.Equal(t, storage.TypeKeyDelete, ents[4].Type)
+	assert.Equal(t, []byte("hash"), ents[4].Key)
+}
+
+func TestKhighDB_Clear(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBClear(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBClear(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBClear(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_ClearReopen(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-clear")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("hash")
+	for i := 0; i < 64; i++ {
+		assert.Nil(t, db.HSet(key, getKey(i), getValue4K()))
+	}
+	assert.Nil(t, db.RPush([]byte("list"), []byte("a"), []byte("b")))
+	assert.Nil(t, db.SAdd([]byte("set"), []byte("a")))
+	assert.Nil(t, db.ZAdd([]byte("zset"), 1, []byte("a")))
+
+	assert.Nil(t, db.HClear(key))
+	assert.Nil(t, db.LClear([]byte("list")))
+	assert.Nil(t, db.SClear([]byte("set")))
+	assert.Nil(t, db.ZClear([]byte("zset")))
+	value := getValue16B()
+	assert.Nil(t, db.HSet(key, getKey(0), value))
+	assert.Nil(t, db.RPush([]byte("list"), []byte("c")))
+
+	// The cleared fields are garbage, so the archived hash log files are rewritten.
+	time.Sleep(100 * time.Millisecond)
+	archived := len(db.archivedLogFiles[Hash])
+	assert.Nil(t, db.RunLogFileGC(Hash, -1, 0.5))
+	assert.True(t, len(db.archivedLogFiles[Hash]) < archived)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, db.HLen(key))
+	val, err := db.HGet(key, getKey(0))
+	assert.Nil(t, err)
+	assert.Equal(t, value, val)
+	values, err := db.LRange([]byte("list"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("c")}, values)
+	assert.Equal(t, 0, db.SCard([]byte("set")))
+	assert.Equal(t, 0, db.ZCard([]byte("zset")))
+	assert.Equal(t, 2, db.DBSize())
+}
+
+func TestKhighDB_WrongType(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	assert.Nil(t, db.HSet([]byte("hash"), []byte("f"), []byte("v")))
+
+	assert.Equal(t, ErrWrongType, db.HSet([]byte("str"), []byte("f"), []byte("v")))
+	assert.Equal(t, ErrWrongType, db.LPush([]byte("str"), []byte("v")))
+	assert.Equal(t, ErrWrongType, db.SAdd([]byte("hash"), []byte("v")))
+	assert.Equal(t, ErrWrongType, db.ZAdd([]byte("hash"), 1, []byte("v")))
+	_, err := db.Incr([]byte("hash"))
+	assert.Equal(t, ErrWrongType, err)
+	assert.Equal(t, ErrWrongType, db.MSet([]byte("k"), []byte("v"), []byte("hash"), []byte("v")))
+	assert.Equal(t, 0, db.Exists([]byte("k")))
+
+	// The key can be reused by another data type once it is empty.
+	_, err = db.HDel([]byte("hash"), []byte("f"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Set([]byte("hash"), []byte("v")))
+	dataType, err := db.Type([]byte("hash"))
+	assert.Nil(t, err)
+	assert.Equal(t, String, dataType)
+
+	assert.Nil(t, db.Delete([]byte("str")))
+	assert.Nil(t, db.RPush([]byte("str"), []byte("v")))
+	_, err = db.LPop([]byte("str"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.SAdd([]byte("str"), []byte("v")))
+}
+
+func TestKhighDB_Keys(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	_, err := db.RandomKey()
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 0, db.DBSize())
+
+	assert.Nil(t, db.Set([]byte("user:1"), []byte("v")))
+	assert.Nil(t, db.RPush([]byte("user:2"), []byte("v")))
+	assert.Nil(t, db.HSet([]byte("user:3"), []byte("f"), []byte("v")))
+	assert.Nil(t, db.SAdd([]byte("item:1"), []byte("v")))
+	assert.Nil(t, db.ZAdd([]byte("item:2"), 1, []byte("v")))
+
+	keys, err := db.Keys("user:*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:1", "user:2", "user:3"}, sortedKeys(keys))
+	keys, err = db.Keys("")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"item:1", "item:2", "user:1", "user:2", "user:3"}, sortedKeys(keys))
+	keys, err = db.Keys("none")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+
+	assert.Equal(t, 5, db.DBSize())
+	for i := 0; i < 10; i++ {
+		key, err := db.RandomKey()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, db.Exists(key))
+	}
+}
+
+func TestKhighDB_KeyTypesReopen(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-keyspace")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() { destroyDB(db) }()
+
+	assert.Nil(t, db.HSet([]byte("hash"), []byte("f"), []byte("v")))
+	assert.Nil(t, db.RPush([]byte("list"), []byte("v")))
+	assert.Nil(t, db.RPush([]byte("empty"), []byte("v")))
+	_, err = db.RPop([]byte("empty"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Rename([]byte("hash"), []byte("renamed")))
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+
+	dataType, err := db.Type([]byte("renamed"))
+	assert.Nil(t, err)
+	assert.Equal(t, Hash, dataType)
+	_, err = db.Type([]byte("hash"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.Set([]byte("list"), []byte("v")))
+	dataType, err = db.Type([]byte("list"))
+	assert.Nil(t, err)
+	assert.Equal(t, String, dataType)
+	assert.Equal(t, 0, db.LLen([]byte("list")))
+	assert.Equal(t, 0, db.Exists([]byte("empty")))
+	assert.Nil(t, db.Set([]byte("empty"), []byte("v")))
+	assert.Equal(t, 3, db.DBSize())
+}
+
+func testKhighDBType(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer destroyDB(db)
+
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	assert.Nil(t, db.RPush([]byte("list"), []byte("v")))
+	assert.Nil(t, db.HSet([]byte("hash"), []byte("f"), []byte("v")))
+	assert.Nil(t, db.SAdd([]byte("set"), []byte("v")))
+	assert.Nil(t, db.ZAdd([]byte("zset"), 1, []byte("v")))
+
+	tests := []struct {
+		key      string
+		dataType DataType
+	}{
+		{"str", String},
+		{"list", List},
+		{"hash", Hash},
+		{"set", Set},
+		{"zset", ZSet},
+	}
+	for _, tt := range tests {
+		dataType, err := db.Type([]byte(tt.key))
+		assert.Nil(t, err)
+		assert.Equal(t, tt.dataType, dataType)
+	}
+	_, err := db.Type([]byte("none"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.Equal(t, 5, db.Exists([]byte("str"), []byte("list"), []byte("hash"), []byte("set"), []byte("zset")))
+	assert.Equal(t, 2, db.Exists([]byte("str"), []byte("none"), []byte("str")))
+}
+
+func testKhighDBDel(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer destroyDB(db)
+
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	assert.Nil(t, db.RPush([]byte("list"), []byte("a"), []byte("b")))
+	assert.Nil(t, db.HSet([]byte("hash"), []byte("f1"), []byte("v"), []byte("f2"), []byte("v")))
+	assert.Nil(t, db.SAdd([]byte("set"), []byte("a"), []byte("b")))
+	assert.Nil(t, db.ZAdd([]byte("zset"), 1, []byte("a")))
+
+	count, err := db.Del([]byte("str"), []byte("list"), []byte("hash"), []byte("none"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	count, err = db.Del([]byte("set"), []byte("zset"), []byte("set"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 0, db.DBSize())
+
+	assert.Equal(t, 0, db.LLen([]byte("list")))
+	assert.Equal(t, 0, db.HLen([]byte("hash")))
+	assert.Equal(t, 0, db.SCard([]byte("set")))
+	assert.Equal(t, 0, db.ZCard([]byte("zset")))
+
+	// The deleted keys can be reused by any data type.
+	assert.Nil(t, db.Set([]byte("list"), []byte("v")))
+	assert.Nil(t, db.SAdd([]byte("hash"), []byte("v")))
+	assert.Nil(t, db.RPush([]byte("list2"), []byte("v")))
+	val, err := db.LIndex([]byte("list2"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), val)
+}
+
+func testKhighDBRename(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer destroyDB(db)
+
+	assert.Equal(t, ErrKeyNotFound, db.Rename([]byte("none"), []byte("k")))
+
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	assert.Nil(t, db.Rename([]byte("str"), []byte("str2")))
+	val, err := db.Get([]byte("str2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), val)
+	assert.Equal(t, 0, db.Exists([]byte("str")))
+
+	assert.Nil(t, db.RPush([]byte("list"), []byte("a"), []byte("b")))
+	assert.Nil(t, db.Rename([]byte("list"), []byte("list2")))
+	values, err := db.LRange([]byte("list2"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, values)
+	assert.Equal(t, 0, db.LLen([]byte("list")))
+
+	assert.Nil(t, db.HSet([]byte("hash"), []byte("f"), []byte("v")))
+	assert.Nil(t, db.Rename([]byte("hash"), []byte("hash2")))
+	val, err = db.HGet([]byte("hash2"), []byte("f"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), val)
+	assert.Equal(t, 0, db.HLen([]byte("hash")))
+
+	assert.Nil(t, db.SAdd([]byte("set"), []byte("a")))
+	assert.Nil(t, db.Rename([]byte("set"), []byte("set2")))
+	assert.True(t, db.SIsMember([]byte("set2"), []byte("a")))
+	assert.Equal(t, 0, db.SCard([]byte("set")))
+
+	assert.Nil(t, db.ZAdd([]byte("zset"), 2, []byte("a")))
+	assert.Nil(t, db.Rename([]byte("zset"), []byte("zset2")))
+	ok, score := db.ZScore([]byte("zset2"), []byte("a"))
+	assert.True(t, ok)
+	assert.Equal(t, float64(2), score)
+	assert.Equal(t, 0, db.ZCard([]byte("zset")))
+
+	// The new key of another data type is overwritten.
+	assert.Nil(t, db.Rename([]byte("set2"), []byte("hash2")))
+	dataType, err := db.Type([]byte("hash2"))
+	assert.Nil(t, err)
+	assert.Equal(t, Set, dataType)
+	assert.Equal(t, 0, db.HLen([]byte("hash2")))
+
+	ok, err = db.RenameNX([]byte("zset2"), []byte("str2"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.RenameNX([]byte("zset2"), []byte("zset3"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 4, db.DBSize())
+}
+
+func testKhighDBClear(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer destroyDB(db)
+
+	assert.Nil(t, db.HClear([]byte("none")))
+
+	assert.Nil(t, db.RPush([]byte("list"), []byte("a"), []byte("b")))
+	assert.Nil(t, db.HSet([]byte("hash"), []byte("f1"), []byte("v"), []byte("f2"), []byte("v")))
+	assert.Nil(t, db.SAdd([]byte("set"), []byte("a"), []byte("b")))
+	assert.Nil(t, db.ZAdd([]byte("zset"), 1, []byte("a")))
+	assert.Nil(t, db.ZAdd([]byte("zset"), 2, []byte("b")))
+
+	assert.Nil(t, db.LClear([]byte("list")))
+	assert.Equal(t, 0, db.LLen([]byte("list")))
+	assert.Nil(t, db.HClear([]byte("hash")))
+	assert.Equal(t, 0, db.HLen([]byte("hash")))
+	assert.Nil(t, db.SClear([]byte("set")))
+	assert.Equal(t, 0, db.SCard([]byte("set")))
+	assert.Nil(t, db.ZClear([]byte("zset")))
+	assert.Equal(t, 0, db.ZCard([]byte("zset")))
+	_, rank := db.ZRank([]byte("zset"), []byte("a"))
+	assert.Equal(t, -1, rank)
+	assert.Equal(t, 0, db.DBSize())
+
+	// The cleared keys can be recreated as any data type.
+	assert.Nil(t, db.Set([]byte("list"), []byte("v")))
+	assert.Nil(t, db.RPush([]byte("hash"), []byte("c")))
+	values, err := db.LRange([]byte("hash"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("c")}, values)
+	assert.Nil(t, db.ZAdd([]byte("zset"), 3, []byte("a")))
+	ok, score := db.ZScore([]byte("zset"), []byte("a"))
+	assert.True(t, ok)
+	assert.Equal(t, float64(3), score)
+}
+
+func sortedKeys(keys [][]byte) []string {
+	res := make([]string, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, string(key))
+	}
+	sort.Strings(res)
+	return res
+}
@@ -5,38 +5,51 @@ import (
 	"encoding/binary"
 	"errors"
 	"math"
-
-	"go.uber.org/zap"
+	"sort"
 
 	"github.com/Khighness/khighdb/data/art"
 	"github.com/Khighness/khighdb/storage"
 )
 
 // @Author KHighness
-// @Update 2022-12-28
+// @Update 2023-01-26
 
 // List‘s structure is as follows:
 //	+---------+---------+---------+---------+---------+---------+-----------+
 //	|    0    |    1    |   ...   | headSeq | tailSeq |   ...   | MaxUint32 |
 //	+---------+---------+---------+---------+---------+---------+-----------+
 //	| <----------------------------- LPush  |  RPush ---------------------> |
+// The elements inserted by LInsert are between the element at seq and the element at seq+1,
+// and they are ordered by their fractions, see listFraction.
 const initialListSeq = math.MaxInt32
 
+// listElem represents the position of an element in list, frac is nil if the element is pushed
+// at seq, otherwise the element is inserted after the element at seq.
+type listElem struct {
+	seq  uint32
+	frac []byte
+}
+
+// listInserts holds the positions of the elements inserted into the middle of a list.
+type listInserts struct {
+	// seqs holds the sequences which have elements inserted after them in ascending order.
+	seqs []uint32
+	// fracs maps the sequence to the fractions of the elements inserted after it in ascending order.
+	fracs map[uint32][][]byte
+	size  int
+}
+
 // LPush inserts all the specified values at the head of the list stored at key.
 // If key does not exist, it is created as empty list before performing the push operation.
 func (db *KhighDB) LPush(key []byte, values ...[]byte) error {
-	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	_, err := db.pushValues(key, values, true)
+	return err
+}
 
-	if db.listIndex.trees[string(key)] == nil {
-		db.listIndex.trees[string(key)] = art.NewART()
-	}
-	for _, val := range values {
-		if err := db.pushInternal(key, val, true); err != nil {
-			return err
-		}
-	}
-	return nil
+// LPushLen is like LPush, but it also returns the length of the list after the push operation,
+// which is counted before the values are popped by the blocked clients.
+func (db *KhighDB) LPushLen(key []byte, values ...[]byte) (int, error) {
+	return db.pushValues(key, values, true)
 }
 
 // LPushX inserts a specified values at the head of the list
@@ -50,6 +63,7 @@ func (db *KhighDB) LPushX(key []byte, values ...[]byte) error {
 	if db.listIndex.trees[string(key)] == nil {
 		return ErrKeyNotFound
 	}
+	defer db.listIndex.blocking.serve()
 	for _, val := range values {
 		if err := db.pushInternal(key, val, true); err != nil {
 			return err
@@ -61,18 +75,14 @@ func (db *KhighDB) LPushX(key []byte, values ...[]byte) error {
 // RPush inserts all the specified values at the head of the list stored at key.
 // If key does not exist, it is created as empty list before performing the push operation.
 func (db *KhighDB) RPush(key []byte, values ...[]byte) error {
-	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	_, err := db.pushValues(key, values, false)
+	return err
+}
 
-	if db.listIndex.trees[string(key)] == nil {
-		db.listIndex.trees[string(key)] = art.NewART()
-	}
-	for _, val := range values {
-		if err := db.pushInternal(key, val, false); err != nil {
-			return err
-		}
-	}
-	return nil
+// RPushLen is like RPush, but it also returns the length of the list after the push operation,
+// which is counted before the values are popped by the blocked clients.
+func (db *KhighDB) RPushLen(key []byte, values ...[]byte) (int, error) {
+	return db.pushValues(key, values, false)
 }
 
 // RPushX inserts a specified values at the head of the list
@@ -86,6 +96,7 @@ func (db *KhighDB) RPushX(key []byte, values ...[]byte) error {
 	if db.listIndex.trees[string(key)] == nil {
 		return ErrKeyNotFound
 	}
+	defer db.listIndex.blocking.serve()
 	for _, val := range values {
 		if err := db.pushInternal(key, val, false); err != nil {
 			return err
@@ -98,6 +109,7 @@ func (db *KhighDB) RPushX(key []byte, values ...[]byte) error {
 func (db *KhighDB) LPop(key []byte) ([]byte, error) {
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, List)
 	return db.popInternal(key, true)
 }
 
@@ -105,6 +117,7 @@ func (db *KhighDB) LPop(key []byte) ([]byte, error) {
 func (db *KhighDB) RPop(key []byte) ([]byte, error) {
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, List)
 	return db.popInternal(key, false)
 }
 
@@ -113,22 +126,20 @@ func (db *KhighDB) RPop(key []byte) ([]byte, error) {
 func (db *KhighDB) LMove(srcKey, dstKey []byte, srcIfLeft, dstIsLeft bool) ([]byte, error) {
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(srcKey, List)
+	defer db.listIndex.blocking.serve()
 
-	popVal, err := db.popInternal(srcKey, srcIfLeft)
-	if err != nil {
-		return nil, err
-	}
-	if popVal == nil {
-		return nil, nil
-	}
-	if db.listIndex.trees[string(dstKey)] == nil {
-		db.listIndex.trees[string(dstKey)] = art.NewART()
-	}
-	if err = db.pushInternal(dstKey, popVal, dstIsLeft); err != nil {
-		return nil, err
-	}
+	return db.moveInternal(srcKey, dstKey, srcIfLeft, dstIsLeft)
+}
 
-	return popVal, nil
+// LClear removes the list stored at key with all its elements.
+// Only one entry is written no matter how many elements the list holds.
+func (db *KhighDB) LClear(key []byte) error {
+	db.listIndex.mu.Lock()
+	defer db.listIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, List)
+
+	return db.clearKeyInternal(key, List)
 }
 
 // LLen returns the length of the list stored at key,
@@ -145,7 +156,7 @@ func (db *KhighDB) LLen(key []byte) int {
 	if err != nil {
 		return 0
 	}
-	return int(tailSeq - headSeq - 1)
+	return db.listLen(key, headSeq, tailSeq)
 }
 
 // LIndex returns the element at index in the list stored at key.
@@ -166,15 +177,12 @@ func (db *KhighDB) LIndex(key []byte, index int) ([]byte, error) {
 		return nil, err
 	}
 
-	seq, err := db.listSequence(headSeq, tailSeq, index)
-	if err != nil {
-		return nil, err
-	}
-	if seq >= tailSeq || seq <= headSeq {
+	elem, ok := db.listElemAt(key, headSeq, tailSeq, index)
+	if !ok {
 		return nil, ErrIndexOutOfRange
 	}
 
-	encKey := db.encodeListKey(key, seq)
+	encKey := db.encodeListKey(key, elem.seq, elem.frac)
 	val, err := db.getVal(idxTree, encKey, List)
 	if err != nil {
 		return nil, err
@@ -197,21 +205,12 @@ func (db *KhighDB) LSet(key []byte, index int, value []byte) error {
 		return err
 	}
 
-	seq, err := db.listSequence(headSeq, tailSeq, index)
-	if err != nil {
-		return err
-	}
-	if seq >= tailSeq || seq <= headSeq {
+	elem, ok := db.listElemAt(key, headSeq, tailSeq, index)
+	if !ok {
 		return ErrIndexOutOfRange
 	}
 
-	encKey := db.encodeListKey(key, seq)
-	ent := &storage.LogEntry{Key: encKey, Value: value}
-	pos, err := db.writeLogEntry(ent, List)
-	if err != nil {
-		return err
-	}
-	return db.updateIndexTree(idxTree, ent, pos, true, List)
+	return db.lSetInternal(idxTree, key, elem, value)
 }
 
 // LRange returns the specified elements of the list stored at key.
@@ -233,28 +232,25 @@ func (db *KhighDB) LRange(key []byte, start, end int) (values [][]byte, err erro
 		return nil, err
 	}
 
-	var startSeq, endSeq uint32
-	startSeq, err = db.listSequence(headSeq, tailSeq, start)
-	if err != nil {
-		return nil, err
+	size := db.listLen(key, headSeq, tailSeq)
+	if start < 0 {
+		start += size
 	}
-	endSeq, err = db.listSequence(headSeq, tailSeq, end)
-	if err != nil {
-		return nil, err
+	if end < 0 {
+		end += size
 	}
-
-	if startSeq <= headSeq {
-		startSeq = headSeq + 1
+	if start < 0 {
+		start = 0
 	}
-	if endSeq >= tailSeq {
-		endSeq = tailSeq - 1
+	if end >= size {
+		end = size - 1
 	}
-	if startSeq >= tailSeq || endSeq <= headSeq || startSeq > endSeq {
+	if start >= size || end < 0 || start > end {
 		return nil, ErrIndexOutOfRange
 	}
 
-	for seq := startSeq; seq <= endSeq; seq++ {
-		encKey := db.encodeListKey(key, seq)
+	for _, elem := range db.listElems(key, headSeq, tailSeq, start, end) {
+		encKey := db.encodeListKey(key, elem.seq, elem.frac)
 		val, err := db.getVal(idxTree, encKey, List)
 		if err != nil {
 			return nil, err
@@ -273,10 +269,8 @@ func (db *KhighDB) LRange(key []byte, start, end int) (values [][]byte, err erro
 func (db *KhighDB) LRem(key []byte, count int, value []byte) (int, error) {
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, List)
 
-	if count == 0 {
-		count = math.MaxUint32
-	}
 	var discardCount int
 	idxTree := db.listIndex.trees[string(key)]
 	if idxTree == nil {
@@ -286,106 +280,309 @@ func (db *KhighDB) LRem(key []byte, count int, value []byte) (int, error) {
 	if err != nil {
 		return discardCount, err
 	}
+	size := db.listLen(key, headSeq, tailSeq)
+	if size == 0 {
+		return discardCount, nil
+	}
 
-	reserveSeq, discardSeq, reserveValueSeq := make([]uint32, 0), make([]uint32, 0), make([][]byte, 0)
-	classifyData := func(key []byte, seq uint32) error {
-		encKey := db.encodeListKey(key, seq)
-		val, err := db.getVal(idxTree, encKey, List)
+	isLeft := count >= 0
+	if count < 0 {
+		count = -count
+	}
+	if count == 0 {
+		count = size
+	}
+	// The elements are popped until the last one to remove, and the elements reserved before it
+	// are pushed back in reverse order.
+	elems := db.listElems(key, headSeq, tailSeq, 0, size-1)
+	var popCount int
+	var reserveValues [][]byte
+	var reserveCount int
+	for i := 0; i < size && discardCount < count; i++ {
+		elem := elems[i]
+		if !isLeft {
+			elem = elems[size-1-i]
+		}
+		val, err := db.getVal(idxTree, db.encodeListKey(key, elem.seq, elem.frac), List)
 		if err != nil {
-			return err
+			return discardCount, err
 		}
 		if bytes.Equal(value, val) {
-			discardSeq = append(discardSeq, seq)
 			discardCount++
+			popCount, reserveCount = i+1, len(reserveValues)
 		} else {
-			reserveSeq = append(reserveSeq, seq)
-			temp := make([]byte, len(val))
-			copy(temp, val)
-			reserveValueSeq = append(reserveValueSeq, temp)
+			reserveValues = append(reserveValues, append([]byte(nil), val...))
 		}
-		return nil
 	}
 
-	addReserveData := func(key []byte, value []byte, isLeft bool) error {
-		if db.listIndex.trees[string(key)] == nil {
-			db.listIndex.trees[string(key)] = art.NewART()
+	for i := 0; i < popCount; i++ {
+		if _, err := db.popInternal(key, isLeft); err != nil {
+			return discardCount, err
 		}
-		if err := db.pushInternal(key, value, isLeft); err != nil {
-			return err
+	}
+	if reserveCount > 0 && db.listIndex.trees[string(key)] == nil {
+		db.listIndex.trees[string(key)] = art.NewART()
+	}
+	for i := reserveCount - 1; i >= 0; i-- {
+		if err := db.pushInternal(key, reserveValues[i], isLeft); err != nil {
+			return discardCount, err
 		}
-		return nil
 	}
+	return discardCount, nil
+}
 
-	if count > 0 {
-		for seq := headSeq + 1; seq < tailSeq; seq++ {
-			if err := classifyData(key, seq); err != nil {
-				return discardCount, err
-			}
-			if discardCount == count {
-				break
-			}
+// LInsert inserts value in the list stored at key either before or after the first element
+// equal to pivot. It returns the length of the list after the insert operation, or -1 if the
+// pivot is not found, or 0 if the key does not exist.
+// The value inserted into the middle of the list is positioned by a fraction between its
+// neighbours, so only one entry is written and no element is moved.
+func (db *KhighDB) LInsert(key []byte, before bool, pivot, value []byte) (int, error) {
+	db.listIndex.mu.Lock()
+	defer db.listIndex.mu.Unlock()
+
+	idxTree := db.listIndex.trees[string(key)]
+	if idxTree == nil {
+		return 0, nil
+	}
+	headSeq, tailSeq, err := db.listMeta(idxTree, key)
+	if err != nil {
+		return 0, err
+	}
+
+	size := db.listLen(key, headSeq, tailSeq)
+	elems := db.listElems(key, headSeq, tailSeq, 0, size-1)
+	pivotIndex := -1
+	for i, elem := range elems {
+		val, err := db.getVal(idxTree, db.encodeListKey(key, elem.seq, elem.frac), List)
+		if err != nil {
+			return 0, err
 		}
+		if bytes.Equal(val, pivot) {
+			pivotIndex = i
+			break
+		}
+	}
+	if pivotIndex < 0 {
+		return -1, nil
+	}
 
-		discardSeqLen := len(discardSeq)
-		if discardSeqLen > 0 {
-			for seq := headSeq + 1; seq <= discardSeq[discardSeqLen-1]; seq++ {
-				if _, err := db.popInternal(key, true); err != nil {
-					return discardCount, err
-				}
-			}
-			for i := len(reserveSeq) - 1; i >= 0; i-- {
-				if reserveSeq[i] < discardSeq[discardSeqLen-1] {
-					if err := addReserveData(key, reserveValueSeq[i], true); err != nil {
-						return discardCount, err
-					}
-				}
-			}
+	// The index of the element which will be after value.
+	index := pivotIndex
+	if !before {
+		index++
+	}
+	if index == 0 || index == size {
+		defer db.listIndex.blocking.serve()
+		if err = db.pushInternal(key, value, index == 0); err != nil {
+			return 0, err
 		}
+		return size + 1, nil
+	}
+
+	prev, next := elems[index-1], elems[index]
+	elem := listElem{seq: prev.seq}
+	if prev.seq == next.seq {
+		elem.frac = listFraction(prev.frac, next.frac)
 	} else {
-		count = -count
-		for seq := tailSeq - 1; seq > headSeq; seq-- {
-			if err := classifyData(key, seq); err != nil {
-				return discardCount, err
-			}
-			if discardCount == count {
-				break
-			}
+		elem.frac = listFraction(prev.frac, nil)
+	}
+	if err = db.lSetInternal(idxTree, key, elem, value); err != nil {
+		return 0, err
+	}
+	return size + 1, nil
+}
+
+// LTrim trims the list stored at key, so that it will contain only the specified range of
+// elements. The offsets start and stop are zero-based offsets like LRange.
+// If start is larger than the end of the list, or start > end, the list is removed.
+func (db *KhighDB) LTrim(key []byte, start, end int) error {
+	db.listIndex.mu.Lock()
+	defer db.listIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, List)
+
+	idxTree := db.listIndex.trees[string(key)]
+	if idxTree == nil {
+		return nil
+	}
+	headSeq, tailSeq, err := db.listMeta(idxTree, key)
+	if err != nil {
+		return err
+	}
+
+	size := db.listLen(key, headSeq, tailSeq)
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if start > end || start >= size {
+		return db.clearKeyInternal(key, List)
+	}
+
+	first := db.listElems(key, headSeq, tailSeq, start, start)[0]
+	last := db.listElems(key, headSeq, tailSeq, end, end)[0]
+	var elems []listElem
+	if start > 0 {
+		elems = db.listElems(key, headSeq, tailSeq, 0, start-1)
+	}
+	if end < size-1 {
+		elems = append(elems, db.listElems(key, headSeq, tailSeq, end+1, size-1)...)
+	}
+	for _, elem := range elems {
+		if err = db.lDelInternal(idxTree, key, elem); err != nil {
+			return err
 		}
+	}
+	// The elements inserted after the new head sequence are kept if the first element is one of them.
+	newHeadSeq := first.seq
+	if first.frac == nil {
+		newHeadSeq--
+	}
+	return db.saveListMeta(idxTree, key, newHeadSeq, last.seq+1)
+}
 
-		discardSeqLen := len(discardSeq)
-		if discardSeqLen > 0 {
-			for seq := tailSeq - 1; seq >= discardSeq[discardSeqLen-1]; seq-- {
-				if _, err := db.popInternal(key, false); err != nil {
-					return discardCount, err
-				}
+// LPosOptions represents the options of LPos.
+type LPosOptions struct {
+	// Rank is the rank of the first match to return, 1 means the first match, 2 means the
+	// second match and so on. A negative rank means searching from the tail to the head,
+	// -1 means the last match. 0 is treated as 1.
+	Rank int
+	// Count is the max number of matches to return, 0 means all the matches.
+	Count int
+	// MaxLen is the max number of elements to compare, 0 means all the elements.
+	MaxLen int
+}
+
+// LPos returns the indexes of the elements equal to element in the list stored at key,
+// see LPosOptions for the options. It returns nil if no element matches.
+func (db *KhighDB) LPos(key, element []byte, opts LPosOptions) ([]int, error) {
+	db.listIndex.mu.RLock()
+	defer db.listIndex.mu.RUnlock()
+
+	idxTree := db.listIndex.trees[string(key)]
+	if idxTree == nil {
+		return nil, nil
+	}
+	headSeq, tailSeq, err := db.listMeta(idxTree, key)
+	if err != nil {
+		return nil, err
+	}
+
+	size := db.listLen(key, headSeq, tailSeq)
+	elems := db.listElems(key, headSeq, tailSeq, 0, size-1)
+	skip, reverse := opts.Rank-1, false
+	if opts.Rank < 0 {
+		skip, reverse = -opts.Rank-1, true
+	}
+	if skip < 0 {
+		skip = 0
+	}
+	var indexes []int
+	for i := 0; i < size; i++ {
+		if opts.MaxLen > 0 && i >= opts.MaxLen {
+			break
+		}
+		index := i
+		if reverse {
+			index = size - 1 - i
+		}
+		elem := elems[index]
+		val, err := db.getVal(idxTree, db.encodeListKey(key, elem.seq, elem.frac), List)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(val, element) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		indexes = append(indexes, index)
+		if opts.Count > 0 && len(indexes) >= opts.Count {
+			break
+		}
+	}
+	return indexes, nil
+}
+
+// LMPop removes and returns at most count elements from the head or tail of the first
+// non-empty list among keys, together with the key. It returns nil if all the lists are empty.
+func (db *KhighDB) LMPop(count int, isLeft bool, keys ...[]byte) ([]byte, [][]byte, error) {
+	if len(keys) == 0 {
+		return nil, nil, ErrInvalidNumberOfArgs
+	}
+	if count <= 0 {
+		return nil, nil, ErrInvalidCount
+	}
+	db.listIndex.mu.Lock()
+	defer db.listIndex.mu.Unlock()
+
+	for _, key := range keys {
+		if db.listIndex.trees[string(key)] == nil {
+			continue
+		}
+		var values [][]byte
+		for len(values) < count {
+			val, err := db.popInternal(key, isLeft)
+			if err != nil {
+				db.releaseKeyIfEmpty(key, List)
+				return nil, nil, err
 			}
-			for i := len(reserveSeq) - 1; i >= 0; i-- {
-				if reserveSeq[i] > discardSeq[discardSeqLen-1] {
-					if err := addReserveData(key, reserveValueSeq[i], false); err != nil {
-						return discardCount, err
-					}
-				}
+			if val == nil {
+				break
 			}
+			values = append(values, val)
+		}
+		db.releaseKeyIfEmpty(key, List)
+		if len(values) > 0 {
+			return key, values, nil
 		}
 	}
+	return nil, nil, nil
+}
 
-	return discardCount, nil
+// RPopLPush atomically removes the last element of the list stored at srcKey, pushes the
+// element at the head of the list stored at dstKey and returns the element.
+// It is equal to LMove(srcKey, dstKey, false, true).
+func (db *KhighDB) RPopLPush(srcKey, dstKey []byte) ([]byte, error) {
+	return db.LMove(srcKey, dstKey, false, true)
 }
 
-// encodeListKey encodes the key and the sequence into a byte slice.
-func (db *KhighDB) encodeListKey(key []byte, seq uint32) []byte {
-	buf := make([]byte, len(key)+4)
+// encodeListKey encodes the key, the sequence and the fraction into a byte slice, the fraction
+// is nil for the element pushed at the sequence.
+//	+----------+---------------+----------+-----+
+//	| seq (LE) | len(fraction) | fraction | key |
+//	+----------+---------------+----------+-----+
+func (db *KhighDB) encodeListKey(key []byte, seq uint32, frac []byte) []byte {
+	buf := make([]byte, 4+binary.MaxVarintLen32+len(frac)+len(key))
 	binary.LittleEndian.PutUint32(buf[:4], seq)
-	copy(buf[4:], key[:])
-	return buf
+	n := 4 + binary.PutUvarint(buf[4:], uint64(len(frac)))
+	n += copy(buf[n:], frac)
+	n += copy(buf[n:], key)
+	return buf[:n]
 }
 
-// decodeListKey decodes the byte slice into a key and a sequence.
-func (db *KhighDB) decodeListKey(buf []byte) ([]byte, uint32) {
+// decodeListKey decodes the byte slice into a key, a sequence and a fraction.
+func (db *KhighDB) decodeListKey(buf []byte) ([]byte, uint32, []byte) {
 	seq := binary.LittleEndian.Uint32(buf[:4])
-	key := make([]byte, len(buf[4:]))
-	copy(key[:], buf[4:])
-	return key, seq
+	fracLen, n := binary.Uvarint(buf[4:])
+	index := 4 + n
+	var frac []byte
+	if fracLen > 0 {
+		frac = make([]byte, fracLen)
+		index += copy(frac, buf[index:])
+	}
+	key := make([]byte, len(buf[index:]))
+	copy(key[:], buf[index:])
+	return key, seq, frac
 }
 
 // listMeta returns the head sequence and the tail sequence corresponding to the key.
@@ -406,10 +603,7 @@ func (db *KhighDB) listMeta(idxTree *art.AdaptiveRadixTree, key []byte) (uint32,
 
 // saveListMeta saves the the meta information of the key to the list'index tree.
 func (db *KhighDB) saveListMeta(idxTree *art.AdaptiveRadixTree, key []byte, headSeq, tailSeq uint32) error {
-	buf := make([]byte, 8)
-	binary.LittleEndian.PutUint32(buf[:4], headSeq)
-	binary.LittleEndian.PutUint32(buf[4:8], tailSeq)
-	ent := &storage.LogEntry{Key: key, Value: buf, Type: storage.TypeListMeta}
+	ent := db.listMetaEntry(key, headSeq, tailSeq)
 	por, err := db.writeLogEntry(ent, List)
 	if err != nil {
 		return err
@@ -418,6 +612,39 @@ func (db *KhighDB) saveListMeta(idxTree *art.AdaptiveRadixTree, key []byte, head
 	return err
 }
 
+// listMetaEntry returns the log entry holding the meta information of the key.
+func (db *KhighDB) listMetaEntry(key []byte, headSeq, tailSeq uint32) *storage.LogEntry {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint32(buf[:4], headSeq)
+	binary.LittleEndian.PutUint32(buf[4:8], tailSeq)
+	return &storage.LogEntry{Key: key, Value: buf, Type: storage.TypeListMeta}
+}
+
+// pushValues inserts the values at the head or tail of the list stored at key, the key is created
+// if it does not exist. It returns the length of the list after the push operation.
+func (db *KhighDB) pushValues(key []byte, values [][]byte, isLeft bool) (int, error) {
+	db.listIndex.mu.Lock()
+	defer db.listIndex.mu.Unlock()
+
+	if db.listIndex.trees[string(key)] == nil {
+		if err := db.claimKey(key, List); err != nil {
+			return 0, err
+		}
+		db.listIndex.trees[string(key)] = art.NewART()
+	}
+	defer db.listIndex.blocking.serve()
+	for _, val := range values {
+		if err := db.pushInternal(key, val, isLeft); err != nil {
+			return 0, err
+		}
+	}
+	headSeq, tailSeq, err := db.listMeta(db.listIndex.trees[string(key)], key)
+	if err != nil {
+		return 0, err
+	}
+	return db.listLen(key, headSeq, tailSeq), nil
+}
+
 // pushInternal inserts a value at the head or tail of the list stored at key.
 // Parameter isLeft controls the insert position, if true the value will be
 // inserted at the list's head, otherwise it will be inserted at the list's tail.
@@ -431,7 +658,7 @@ func (db *KhighDB) pushInternal(key []byte, val []byte, isLeft bool) error {
 	if !isLeft {
 		seq = tailSeq
 	}
-	encKey := db.encodeListKey(key, seq)
+	encKey := db.encodeListKey(key, seq, nil)
 	ent := &storage.LogEntry{Key: encKey, Value: val}
 	pos, err := db.writeLogEntry(ent, List)
 	if err != nil {
@@ -447,8 +674,38 @@ func (db *KhighDB) pushInternal(key []byte, val []byte, isLeft bool) error {
 	} else {
 		tailSeq++
 	}
-	err = db.saveListMeta(idxTree, key, headSeq, tailSeq)
-	return err
+	if err = db.saveListMeta(idxTree, key, headSeq, tailSeq); err != nil {
+		return err
+	}
+	db.listIndex.blocking.signal(key)
+	return nil
+}
+
+// moveInternal removes the head or tail of the list stored at srcKey and inserts it at the head
+// or tail of the list stored at dstKey. If the list stored at srcKey is empty, it returns nil.
+func (db *KhighDB) moveInternal(srcKey, dstKey []byte, srcIsLeft, dstIsLeft bool) ([]byte, error) {
+	if db.listIndex.trees[string(srcKey)] == nil {
+		return nil, nil
+	}
+	if db.listIndex.trees[string(dstKey)] == nil {
+		if err := db.claimKey(dstKey, List); err != nil {
+			return nil, err
+		}
+	}
+	popVal, err := db.popInternal(srcKey, srcIsLeft)
+	if err != nil {
+		return nil, err
+	}
+	if popVal == nil {
+		return nil, nil
+	}
+	if db.listIndex.trees[string(dstKey)] == nil {
+		db.listIndex.trees[string(dstKey)] = art.NewART()
+	}
+	if err = db.pushInternal(dstKey, popVal, dstIsLeft); err != nil {
+		return nil, err
+	}
+	return popVal, nil
 }
 
 // popInternal removes and returns the head or tail of the list stored at key.
@@ -464,44 +721,38 @@ func (db *KhighDB) popInternal(key []byte, isLeft bool) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	if tailSeq-headSeq-1 <= 0 {
+	size := db.listLen(key, headSeq, tailSeq)
+	if size <= 0 {
 		return nil, nil
 	}
 
-	var seq = headSeq + 1
+	var index = 0
 	if !isLeft {
-		seq = tailSeq - 1
+		index = size - 1
 	}
-	encKey := db.encodeListKey(key, seq)
+	elem := db.listElems(key, headSeq, tailSeq, index, index)[0]
+	encKey := db.encodeListKey(key, elem.seq, elem.frac)
 	val, err := db.getVal(idxTree, encKey, List)
 	if err != nil {
 		return nil, err
 	}
 
-	ent := &storage.LogEntry{Key: encKey, Type: storage.TypeDelete}
-	pos, err := db.writeLogEntry(ent, List)
-	if err != nil {
+	if err = db.lDelInternal(idxTree, key, elem); err != nil {
 		return nil, err
 	}
-	oldVal, updated := idxTree.Delete(encKey)
-	if isLeft {
-		headSeq++
-	} else {
-		tailSeq--
-	}
-	if err = db.saveListMeta(idxTree, key, headSeq, tailSeq); err != nil {
-		return nil, err
+	// The meta is unchanged if the element is inserted after the head or tail sequence.
+	if elem.frac == nil {
+		if isLeft {
+			headSeq++
+		} else {
+			tailSeq--
+		}
+		if err = db.saveListMeta(idxTree, key, headSeq, tailSeq); err != nil {
+			return nil, err
+		}
 	}
 
-	db.sendDiscard(oldVal, updated, List)
-	_, entrySize := storage.EncodeEntry(ent)
-	idxNode := &indexNode{fid: pos.fid, entrySize: entrySize}
-	select {
-	case db.discards[List].nodeChan <- idxNode:
-	default:
-		zap.L().Warn("Failed to send node to discard channel")
-	}
-	if tailSeq-headSeq-1 == 0 {
+	if size == 1 {
 		if headSeq != initialListSeq || tailSeq != initialListSeq+1 {
 			headSeq = initialListSeq
 			tailSeq = initialListSeq + 1
@@ -512,14 +763,174 @@ func (db *KhighDB) popInternal(key []byte, isLeft bool) ([]byte, error) {
 	return val, nil
 }
 
-// listSequence converts logic index to phsical sequence.
-func (db *KhighDB) listSequence(headSeq, tailSeq uint32, index int) (uint32, error) {
-	var seq uint32
+// lSetInternal sets the element at elem of the list stored at key to value.
+func (db *KhighDB) lSetInternal(idxTree *art.AdaptiveRadixTree, key []byte, elem listElem, value []byte) error {
+	ent := &storage.LogEntry{Key: db.encodeListKey(key, elem.seq, elem.frac), Value: value}
+	pos, err := db.writeLogEntry(ent, List)
+	if err != nil {
+		return err
+	}
+	if err = db.updateIndexTree(idxTree, ent, pos, true, List); err != nil {
+		return err
+	}
+	if elem.frac != nil {
+		db.addListInsert(key, elem)
+	}
+	return nil
+}
 
-	if index >= 0 {
-		seq = headSeq + uint32(index) + 1
-	} else {
-		seq = tailSeq - uint32(-index)
+// lDelInternal removes the element at elem of the list stored at key, the list meta is not updated.
+func (db *KhighDB) lDelInternal(idxTree *art.AdaptiveRadixTree, key []byte, elem listElem) error {
+	encKey := db.encodeListKey(key, elem.seq, elem.frac)
+	ent := &storage.LogEntry{Key: encKey, Type: storage.TypeDelete}
+	if _, err := db.writeLogEntry(ent, List); err != nil {
+		return err
+	}
+	oldVal, updated := idxTree.Delete(encKey)
+	db.sendDiscard(oldVal, updated, List)
+	if elem.frac != nil {
+		db.removeListInsert(key, elem)
+	}
+	return nil
+}
+
+// listLen returns the length of the list stored at key with the head and tail sequence.
+func (db *KhighDB) listLen(key []byte, headSeq, tailSeq uint32) int {
+	size := int(tailSeq - headSeq - 1)
+	if ins := db.listIndex.inserts[string(key)]; ins != nil {
+		size += ins.size
+	}
+	return size
+}
+
+// listElemAt returns the position of the element at index of the list stored at key, a negative
+// index counts from the tail like LIndex. It returns false if the index is out of range.
+func (db *KhighDB) listElemAt(key []byte, headSeq, tailSeq uint32, index int) (listElem, bool) {
+	size := db.listLen(key, headSeq, tailSeq)
+	if index < 0 {
+		index += size
+	}
+	if index < 0 || index >= size {
+		return listElem{}, false
+	}
+	return db.listElems(key, headSeq, tailSeq, index, index)[0], true
+}
+
+// listElems returns the positions of the elements from index start to end of the list stored at
+// key, both of them are inclusive and within the list.
+// The elements pushed between two sequences with inserted elements are skipped as a whole, so it
+// takes O(1) time to locate an element of the list without inserted elements.
+func (db *KhighDB) listElems(key []byte, headSeq, tailSeq uint32, start, end int) []listElem {
+	var elems []listElem
+	var index int
+	// pushed appends the elements pushed at the sequences from seq to the one before last.
+	pushed := func(seq, last uint32) {
+		n := int(last - seq)
+		if index+n <= start || index > end {
+			index += n
+			return
+		}
+		i := 0
+		if index < start {
+			i = start - index
+		}
+		for ; i < n && index+i <= end; i++ {
+			elems = append(elems, listElem{seq: seq + uint32(i)})
+		}
+		index += n
+	}
+
+	var seq = headSeq + 1
+	if ins := db.listIndex.inserts[string(key)]; ins != nil {
+		for _, s := range ins.seqs {
+			if index > end {
+				return elems
+			}
+			pushed(seq, s+1)
+			for _, frac := range ins.fracs[s] {
+				if index >= start && index <= end {
+					elems = append(elems, listElem{seq: s, frac: frac})
+				}
+				index++
+			}
+			seq = s + 1
+		}
+	}
+	pushed(seq, tailSeq)
+	return elems
+}
+
+// addListInsert records the position of the element inserted into the list stored at key.
+func (db *KhighDB) addListInsert(key []byte, elem listElem) {
+	ins := db.listIndex.inserts[string(key)]
+	if ins == nil {
+		ins = &listInserts{fracs: make(map[uint32][][]byte)}
+		db.listIndex.inserts[string(key)] = ins
+	}
+	fracs, ok := ins.fracs[elem.seq]
+	if !ok {
+		i := sort.Search(len(ins.seqs), func(i int) bool { return ins.seqs[i] >= elem.seq })
+		ins.seqs = append(ins.seqs, 0)
+		copy(ins.seqs[i+1:], ins.seqs[i:])
+		ins.seqs[i] = elem.seq
+	}
+	i := sort.Search(len(fracs), func(i int) bool { return bytes.Compare(fracs[i], elem.frac) >= 0 })
+	if i < len(fracs) && bytes.Equal(fracs[i], elem.frac) {
+		return
+	}
+	fracs = append(fracs, nil)
+	copy(fracs[i+1:], fracs[i:])
+	fracs[i] = elem.frac
+	ins.fracs[elem.seq] = fracs
+	ins.size++
+}
+
+// removeListInsert removes the position of the element inserted into the list stored at key.
+func (db *KhighDB) removeListInsert(key []byte, elem listElem) {
+	ins := db.listIndex.inserts[string(key)]
+	if ins == nil {
+		return
+	}
+	fracs := ins.fracs[elem.seq]
+	i := sort.Search(len(fracs), func(i int) bool { return bytes.Compare(fracs[i], elem.frac) >= 0 })
+	if i == len(fracs) || !bytes.Equal(fracs[i], elem.frac) {
+		return
+	}
+	fracs = append(fracs[:i], fracs[i+1:]...)
+	ins.size--
+	if len(fracs) > 0 {
+		ins.fracs[elem.seq] = fracs
+		return
+	}
+	delete(ins.fracs, elem.seq)
+	i = sort.Search(len(ins.seqs), func(i int) bool { return ins.seqs[i] >= elem.seq })
+	ins.seqs = append(ins.seqs[:i], ins.seqs[i+1:]...)
+	if ins.size == 0 {
+		delete(db.listIndex.inserts, string(key))
+	}
+}
+
+// listFraction returns a fraction between lo and hi in lexicographical order, a nil hi means
+// there is no upper bound. The fractions never end with zero, so that there is always another
+// fraction between two of them, and the fraction grows by one byte after about eight inserts
+// at the same position.
+func listFraction(lo, hi []byte) []byte {
+	var frac []byte
+	for i := 0; ; i++ {
+		l, h := 0, math.MaxUint8+1
+		if i < len(lo) {
+			l = int(lo[i])
+		}
+		if hi != nil && i < len(hi) {
+			h = int(hi[i])
+		}
+		if h-l > 1 {
+			return append(frac, byte((l+h)/2))
+		}
+		frac = append(frac, byte(l))
+		if h != l {
+			// The fraction is less than hi now, whatever follows.
+			hi = nil
+		}
 	}
-	return seq, nil
 }
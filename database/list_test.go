@@ -1,16 +1,19 @@
 package khighdb
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 // @Author KHighness
-// @Update 2022-12-29
+// @Update 2023-01-26
 
 func TestKhighDB_LPush(t *testing.T) {
 	t.Run("default", func(t *testing.T) {
@@ -122,17 +125,326 @@ func TestKhighDB_LRem(t *testing.T) {
 	})
 }
 
+func TestKhighDB_LInsert(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBLInsert(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBLInsert(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBLInsert(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_LTrim(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBLTrim(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBLTrim(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBLTrim(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_LPos(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBLPos(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBLPos(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBLPos(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_LMPop(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBLMPop(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBLMPop(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBLMPop(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_RPopLPush(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	assert.Nil(t, db.RPush([]byte("src"), []byte("a"), []byte("b")))
+	val, err := db.RPopLPush([]byte("src"), []byte("dst"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), val)
+	val, err = db.RPopLPush([]byte("src"), []byte("src"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), val)
+	val, err = db.RPopLPush([]byte("none"), []byte("dst"))
+	assert.Nil(t, err)
+	assert.Nil(t, val)
+	values, err := db.LRange([]byte("dst"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("b")}, values)
+}
+
+func TestKhighDB_PushLen(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("list")
+	n, err := db.RPushLen(key, []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = db.LPushLen(key, []byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	assert.Nil(t, db.Set([]byte("str"), []byte("value")))
+	_, err = db.LPushLen([]byte("str"), []byte("a"))
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestKhighDB_LInsertReopen(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-list")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("list")
+	assert.Nil(t, db.RPush(key, []byte("a"), []byte("b"), []byte("c"), []byte("d")))
+	_, err = db.LInsert(key, true, []byte("b"), []byte("x"))
+	assert.Nil(t, err)
+	_, err = db.LInsert(key, false, []byte("c"), []byte("y"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.LTrim(key, 1, -2))
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	values, err := db.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("x"), []byte("b"), []byte("c"), []byte("y")}, values)
+}
+
+func TestKhighDB_LInsertMiddle(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-linsert-middle")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("list")
+	want := []string{"a", "b", "c"}
+	assert.Nil(t, db.RPush(key, []byte("a"), []byte("b"), []byte("c")))
+	// insert inserts value into both the list and want.
+	insert := func(before bool, pivot, value string) {
+		index := 0
+		for want[index] != pivot {
+			index++
+		}
+		if !before {
+			index++
+		}
+		want = append(want[:index], append([]string{value}, want[index:]...)...)
+		n, err := db.LInsert(key, before, []byte(pivot), []byte(value))
+		assert.Nil(t, err)
+		assert.Equal(t, len(want), n)
+	}
+	check := func(db *KhighDB) {
+		assert.Equal(t, len(want), db.LLen(key))
+		values, err := db.LRange(key, 0, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, want, listStrings(values))
+		for i := range want {
+			val, err := db.LIndex(key, i)
+			assert.Nil(t, err)
+			assert.Equal(t, want[i], string(val))
+			val, err = db.LIndex(key, i-len(want))
+			assert.Nil(t, err)
+			assert.Equal(t, want[i], string(val))
+		}
+		values, err = db.LRange(key, 2, -3)
+		assert.Nil(t, err)
+		assert.Equal(t, want[2:len(want)-2], listStrings(values))
+	}
+
+	// The values are inserted at the same positions again and again.
+	for i := 0; i < 20; i++ {
+		insert(false, "a", fmt.Sprintf("x%d", i))
+		insert(true, "c", fmt.Sprintf("y%d", i))
+	}
+	insert(true, "x0", "dup")
+	insert(false, "y3", "dup")
+	insert(true, "b", "dup")
+	check(db)
+
+	val, err := db.LPop(key)
+	assert.Nil(t, err)
+	assert.Equal(t, want[0], string(val))
+	val, err = db.RPop(key)
+	assert.Nil(t, err)
+	assert.Equal(t, want[len(want)-1], string(val))
+	want = want[1 : len(want)-1]
+	// The head and tail elements are inserted ones now.
+	assert.Nil(t, db.LPush(key, []byte("head")))
+	assert.Nil(t, db.RPush(key, []byte("tail")))
+	want = append(append([]string{"head"}, want...), "tail")
+	check(db)
+
+	assert.Nil(t, db.LSet(key, 3, []byte("set")))
+	want[3] = "set"
+	indexes, err := db.LPos(key, []byte("dup"), LPosOptions{})
+	assert.Nil(t, err)
+	var wantIndexes []int
+	for i, v := range want {
+		if v == "dup" {
+			wantIndexes = append(wantIndexes, i)
+		}
+	}
+	assert.Equal(t, wantIndexes, indexes)
+	n, err := db.LRem(key, -2, []byte("dup"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	want = append(want[:wantIndexes[1]], want[wantIndexes[1]+1:]...)
+	want = append(want[:wantIndexes[2]-1], want[wantIndexes[2]:]...)
+	check(db)
+
+	assert.Nil(t, db.LTrim(key, 5, -6))
+	want = want[5 : len(want)-5]
+	check(db)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check(db)
+
+	for range want {
+		_, err = db.RPop(key)
+		assert.Nil(t, err)
+	}
+	want = nil
+	_, err = db.Type(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	_, err = db.Type(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestKhighDB_LInsertGC(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-linsert-gc")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 64 << 10
+	opts.ValueLogThreshold = 64
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() { destroyDB(db) }()
+
+	// fill writes garbage until the active list log file is fid.
+	fill := func(fid uint32) {
+		for db.getActiveLogFile(List).Fid < fid {
+			assert.Nil(t, db.RPush([]byte("garbage"), getValue4K()))
+			_, err := db.RPop([]byte("garbage"))
+			assert.Nil(t, err)
+		}
+	}
+
+	// The elements are pushed in log file 0, and inserted into the middle in log file 1.
+	key, large := []byte("list"), getValue(128)
+	assert.Nil(t, db.RPush(key, []byte("a"), large, []byte("c"), []byte("d")))
+	fill(1)
+	offset := db.getActiveLogFile(List).WriteAt
+	n, err := db.LInsert(key, false, large, []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+	// Only the inserted value is written, the other elements and the list meta are unchanged.
+	ent, size, err := db.getActiveLogFile(List).ReadLogEntry(offset)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("x"), ent.Value)
+	assert.Equal(t, db.getActiveLogFile(List).WriteAt, offset+size)
+	n, err = db.LInsert(key, true, []byte("x"), large)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+	fill(2)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, db.RunLogFileGC(List, 0, 0.3))
+	assert.Nil(t, db.RunLogFileGC(List, 1, 0.3))
+	assert.Nil(t, db.getArchivedLogFile(List, 1))
+
+	want := [][]byte{[]byte("a"), large, large, []byte("x"), []byte("c"), []byte("d")}
+	check := func(db *KhighDB) {
+		values, err := db.LRange(key, 0, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, want, values)
+	}
+	check(db)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check(db)
+}
+
 func TestKhighDB_encodeListKey_decodeListKey(t *testing.T) {
 	db := &KhighDB{}
 	key1, key2 := "K1", "K2"
-	listKey1 := db.encodeListKey([]byte(key1), 1)
-	listKey2 := db.encodeListKey([]byte(key2), 2)
-	decodeKey1, seq1 := db.decodeListKey(listKey1)
-	decodeKey2, seq2 := db.decodeListKey(listKey2)
+	listKey1 := db.encodeListKey([]byte(key1), 1, nil)
+	listKey2 := db.encodeListKey([]byte(key2), 2, []byte{0x80})
+	decodeKey1, seq1, frac1 := db.decodeListKey(listKey1)
+	decodeKey2, seq2, frac2 := db.decodeListKey(listKey2)
 	assert.Equal(t, key1, string(decodeKey1))
 	assert.Equal(t, 1, int(seq1))
+	assert.Nil(t, frac1)
 	assert.Equal(t, key2, string(decodeKey2))
 	assert.Equal(t, 2, int(seq2))
+	assert.Equal(t, []byte{0x80}, frac2)
+}
+
+func TestListFraction(t *testing.T) {
+	tests := []struct {
+		lo, hi []byte
+	}{
+		{nil, nil},
+		{nil, []byte{0x01}},
+		{[]byte{0xff}, nil},
+		{[]byte{0x05}, []byte{0x05, 0x03}},
+		{[]byte{0x05, 0xff}, []byte{0x06}},
+		{[]byte{0x7f}, []byte{0x80}},
+	}
+	for _, tt := range tests {
+		frac := listFraction(tt.lo, tt.hi)
+		assert.True(t, bytes.Compare(tt.lo, frac) < 0)
+		if tt.hi != nil {
+			assert.True(t, bytes.Compare(frac, tt.hi) < 0)
+		}
+		assert.NotEqual(t, byte(0), frac[len(frac)-1])
+	}
+
+	// The fractions inserted at the same position keep getting closer to lo.
+	var hi []byte
+	for i := 0; i < 64; i++ {
+		frac := listFraction(nil, hi)
+		if hi != nil {
+			assert.True(t, bytes.Compare(frac, hi) < 0)
+		}
+		hi = frac
+	}
+	assert.Equal(t, 8, len(hi))
 }
 
 func testKhighDBPush(t *testing.T, ioType IOType, mode DataIndexMode, isLeft bool) {
@@ -531,3 +843,143 @@ func testKhighDBLRem(t *testing.T, ioType IOType, mode DataIndexMode) {
 	assert.Equal(t, expected, values)
 	assert.Nil(t, err)
 }
+
+func testKhighDBLInsert(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer destroyDB(db)
+
+	key := []byte("list")
+	n, err := db.LInsert(key, true, []byte("a"), []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	assert.Nil(t, db.RPush(key, []byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")))
+	n, err = db.LInsert(key, true, []byte("none"), []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, -1, n)
+
+	tests := []struct {
+		before bool
+		pivot  string
+		value  string
+		want   []string
+	}{
+		{true, "b", "1", []string{"a", "1", "b", "c", "d", "e"}},
+		{false, "d", "2", []string{"a", "1", "b", "c", "d", "2", "e"}},
+		{true, "a", "3", []string{"3", "a", "1", "b", "c", "d", "2", "e"}},
+		{false, "e", "4", []string{"3", "a", "1", "b", "c", "d", "2", "e", "4"}},
+		{false, "c", "5", []string{"3", "a", "1", "b", "c", "5", "d", "2", "e", "4"}},
+	}
+	for _, tt := range tests {
+		n, err = db.LInsert(key, tt.before, []byte(tt.pivot), []byte(tt.value))
+		assert.Nil(t, err)
+		assert.Equal(t, len(tt.want), n)
+		values, err := db.LRange(key, 0, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.want, listStrings(values))
+	}
+	val, err := db.LIndex(key, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("5"), val)
+}
+
+func testKhighDBLTrim(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer destroyDB(db)
+
+	key := []byte("list")
+	assert.Nil(t, db.LTrim(key, 0, 1))
+	assert.Nil(t, db.RPush(key, []byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")))
+
+	assert.Nil(t, db.LTrim(key, 1, -1))
+	values, err := db.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "c", "d", "e"}, listStrings(values))
+
+	assert.Nil(t, db.LTrim(key, -3, 100))
+	values, err = db.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c", "d", "e"}, listStrings(values))
+
+	assert.Nil(t, db.LTrim(key, 0, 1))
+	values, err = db.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c", "d"}, listStrings(values))
+	assert.Nil(t, db.LPush(key, []byte("b")))
+	assert.Nil(t, db.RPush(key, []byte("e")))
+	values, err = db.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "c", "d", "e"}, listStrings(values))
+
+	assert.Nil(t, db.LTrim(key, 2, 1))
+	assert.Equal(t, 0, db.LLen(key))
+	assert.Equal(t, 0, db.Exists(key))
+}
+
+func testKhighDBLPos(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer destroyDB(db)
+
+	key := []byte("list")
+	indexes, err := db.LPos(key, []byte("a"), LPosOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, indexes)
+
+	// list : a b c 1 2 3 c c
+	assert.Nil(t, db.RPush(key, []byte("a"), []byte("b"), []byte("c"), []byte("1"),
+		[]byte("2"), []byte("3"), []byte("c"), []byte("c")))
+	tests := []struct {
+		element string
+		opts    LPosOptions
+		want    []int
+	}{
+		{"c", LPosOptions{Count: 1}, []int{2}},
+		{"c", LPosOptions{}, []int{2, 6, 7}},
+		{"c", LPosOptions{Rank: 2}, []int{6, 7}},
+		{"c", LPosOptions{Rank: -1, Count: 2}, []int{7, 6}},
+		{"c", LPosOptions{Rank: -3}, []int{2}},
+		{"c", LPosOptions{Rank: 4}, nil},
+		{"c", LPosOptions{MaxLen: 7}, []int{2, 6}},
+		{"c", LPosOptions{Rank: -1, MaxLen: 2}, []int{7, 6}},
+		{"x", LPosOptions{}, nil},
+	}
+	for _, tt := range tests {
+		indexes, err = db.LPos(key, []byte(tt.element), tt.opts)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.want, indexes)
+	}
+}
+
+func testKhighDBLMPop(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer destroyDB(db)
+
+	_, _, err := db.LMPop(1, true)
+	assert.Equal(t, ErrInvalidNumberOfArgs, err)
+	_, _, err = db.LMPop(0, true, []byte("l1"))
+	assert.Equal(t, ErrInvalidCount, err)
+
+	key, values, err := db.LMPop(1, true, []byte("l1"), []byte("l2"))
+	assert.Nil(t, err)
+	assert.Nil(t, key)
+	assert.Nil(t, values)
+
+	assert.Nil(t, db.RPush([]byte("l2"), []byte("a"), []byte("b"), []byte("c")))
+	key, values, err = db.LMPop(2, false, []byte("l1"), []byte("l2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("l2"), key)
+	assert.Equal(t, []string{"c", "b"}, listStrings(values))
+	key, values, err = db.LMPop(10, true, []byte("l1"), []byte("l2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("l2"), key)
+	assert.Equal(t, []string{"a"}, listStrings(values))
+	assert.Equal(t, 0, db.Exists([]byte("l2")))
+}
+
+func listStrings(values [][]byte) []string {
+	res := make([]string, 0, len(values))
+	for _, val := range values {
+		res = append(res, string(val))
+	}
+	return res
+}
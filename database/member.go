@@ -0,0 +1,134 @@
+package khighdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/Khighness/khighdb/data/art"
+	"github.com/Khighness/khighdb/util"
+)
+
+// @Author KHighness
+// @Update 2023-01-22
+
+// A member of set or sorted set is indexed by its raw bytes if it is not longer than maxRawMemberSize:
+//	+-----+--------------+
+//	|  0  |    member    |
+//	+-----+--------------+
+// Otherwise, it is indexed by its murmur sum:
+//	+-----+--------------+----------------------+
+//	|  1  |  murmur sum  |  sequence (uvarint)  |
+//	+-----+--------------+----------------------+
+// The members colliding on the same murmur sum are chained by the sequence, which is omitted
+// for the first member of the chain. Since the encoded murmur sum is prefix-free, the chain of
+// a sum can be iterated by the prefix of tag and sum, and every member in the chain is verified
+// by its bytes.
+const (
+	// rawMemberTag is the tag of index key of member indexed by its raw bytes.
+	rawMemberTag byte = iota
+	// hashedMemberTag is the tag of index key of member indexed by its murmur sum.
+	hashedMemberTag
+)
+
+// maxRawMemberSize is the max size of member indexed by its raw bytes, whose index key is not
+// longer than a murmur sum, and the member can be got without reading disk.
+const maxRawMemberSize = 16
+
+// memberSum returns the encoded murmur sum of member, the encoding must be prefix-free.
+var memberSum = util.Sum128
+
+// memberKeyPrefix returns the index key of a short member, or the common prefix of index keys
+// in the chain of a long member.
+func memberKeyPrefix(member []byte) []byte {
+	if len(member) <= maxRawMemberSize {
+		return append([]byte{rawMemberTag}, member...)
+	}
+	return append([]byte{hashedMemberTag}, memberSum(member)...)
+}
+
+// memberOf returns the member indexed by key in the index tree of set or sorted set.
+func (db *KhighDB) memberOf(idxTree *art.AdaptiveRadixTree, key []byte, dataType DataType) ([]byte, error) {
+	if len(key) > 0 && key[0] == rawMemberTag {
+		return key[1:], nil
+	}
+	return db.getVal(idxTree, key, dataType)
+}
+
+// findMember returns the index key of member in the index tree of set or sorted set,
+// nil is returned if the member does not exist.
+func (db *KhighDB) findMember(idxTree *art.AdaptiveRadixTree, member []byte, dataType DataType) ([]byte, error) {
+	prefix := memberKeyPrefix(member)
+	if prefix[0] == rawMemberTag {
+		if idxTree.Get(prefix) == nil {
+			return nil, nil
+		}
+		return prefix, nil
+	}
+
+	var chain [][]byte
+	idxTree.ForEachPrefix(prefix, func(key []byte, _ interface{}) bool {
+		chain = append(chain, key)
+		return true
+	})
+	for _, key := range chain {
+		val, err := db.getVal(idxTree, key, dataType)
+		if err != nil {
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if bytes.Equal(val, member) {
+			return key, nil
+		}
+	}
+	return nil, nil
+}
+
+// memberKey returns the index key to put member into the index tree of set or sorted set,
+// which is the key of member if it exists, or the first free key in the chain otherwise.
+func (db *KhighDB) memberKey(idxTree *art.AdaptiveRadixTree, member []byte, dataType DataType) ([]byte, error) {
+	key, err := db.findMember(idxTree, member, dataType)
+	if err != nil || key != nil {
+		return key, err
+	}
+	prefix := memberKeyPrefix(member)
+	if prefix[0] == rawMemberTag || idxTree.Get(prefix) == nil {
+		return prefix, nil
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	for seq := uint64(1); ; seq++ {
+		n := binary.PutUvarint(buf, seq)
+		key = append(prefix[:len(prefix):len(prefix)], buf[:n]...)
+		if idxTree.Get(key) == nil {
+			return key, nil
+		}
+	}
+}
+
+// memberKeyAt returns the index key of member whose index node points to the position,
+// nil is returned if the member is not at the position. No member is read from disk.
+func memberKeyAt(idxTree *art.AdaptiveRadixTree, member []byte, fid uint32, offset int64) []byte {
+	atPos := func(value interface{}) bool {
+		node, _ := value.(*indexNode)
+		return node != nil && node.fid == fid && node.offset == offset
+	}
+	prefix := memberKeyPrefix(member)
+	if prefix[0] == rawMemberTag {
+		if !atPos(idxTree.Get(prefix)) {
+			return nil
+		}
+		return prefix
+	}
+
+	var found []byte
+	idxTree.ForEachPrefix(prefix, func(key []byte, value interface{}) bool {
+		if atPos(value) {
+			found = key
+			return false
+		}
+		return true
+	})
+	return found
+}
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"strconv"
 	"time"
+
+	"github.com/Khighness/khighdb/cache"
 )
 
 // @Author KHighness
-// @Update 2022-12-26
+// @Update 2023-01-26
 
 // DataIndexMode defines the data index mode.
 type DataIndexMode int8
@@ -23,6 +25,25 @@ const (
 	KeyOnlyMemMode
 )
 
+// String returns the name of the data index mode.
+func (m DataIndexMode) String() string {
+	if m == KeyValueMemMode {
+		return "KeyValueMemMode"
+	}
+	return "KeyOnlyMemMode"
+}
+
+// dataTypeNames is used to print the options of data types.
+var dataTypeNames = map[DataType]string{
+	String: "String",
+	List:   "List",
+	Hash:   "Hash",
+	Set:    "Set",
+	ZSet:   "ZSet",
+	Stream: "Stream",
+	JSON:   "JSON",
+}
+
 // IOType defines the I/O type.
 type IOType int8
 
@@ -40,10 +61,15 @@ type Options struct {
 	DBPath string
 
 	// IndexMode is the mode of index, support KeyValueMemMode and KeyOnlyMemMode now.
-	// Note that this mode is noly for KV pairs, not for List, Hash, Set and ZSet.
+	// This mode applies to all data types unless it is overridden in IndexModes.
 	// Default value is KeyOnlyMemMode.
 	IndexMode DataIndexMode
 
+	// IndexModes overrides IndexMode for the specified data types, for example, Hash in
+	// KeyValueMemMode while List in KeyOnlyMemMode.
+	// Default value is nil, which means all data types use IndexMode.
+	IndexModes map[DataType]DataIndexMode
+
 	// IoType is the type of I/O, support FileIO abd MMap now.
 	// Default value is FileIO.
 	IoType IOType
@@ -80,16 +106,39 @@ type Options struct {
 	// and be used for log file gc.
 	// Default value is 8MB.
 	DiscardBufferSize int
+
+	// ValueLogThreshold is the threshold size of value to be separated into value log.
+	// A value whose size is not less than this threshold will be written into value log
+	// files, and the log file of data type only keeps a pointer to it, so that log file
+	// gc will not rewrite the large values every time it moves a small key.
+	// Only the values of String, List and Hash can be separated.
+	// Default value is 0, which means key-value separation is disabled.
+	ValueLogThreshold int
+
+	// ReadCacheSize is the max bytes of read cache, which caches the values read from log
+	// files for data types in KeyOnlyMemMode. The read cache is split into ReadCacheShards
+	// shards, and the values are evicted according to ReadCachePolicy.
+	// Default value is 0, which means read cache is disabled.
+	ReadCacheSize int64
+
+	// ReadCacheShards is the number of read cache shards.
+	// Default value is 16.
+	ReadCacheShards int
+
+	// ReadCachePolicy is the eviction policy of read cache, support cache.LRU and cache.WTinyLFU now.
+	// Default value is cache.LRU.
+	ReadCachePolicy cache.Policy
 }
 
 func (o Options) String() string {
 	var optStr string
 	optStr += "\n ============================================================================"
 	optStr += "\n DBPath: " + o.DBPath
-	if o.IndexMode == KeyValueMemMode {
-		optStr += "\n IndexMode: KeyValueMemMode"
-	} else {
-		optStr += "\n IndexMode: KeyOnlyMemMode"
+	optStr += "\n IndexMode: " + o.IndexMode.String()
+	for dataType := String; dataType <= JSON; dataType++ {
+		if mode, ok := o.IndexModes[dataType]; ok {
+			optStr += fmt.Sprintf("\n IndexModes[%s]: %v", dataTypeNames[dataType], mode)
+		}
 	}
 	if o.IoType == FileIO {
 		optStr += "\n IOType: FileIO"
@@ -100,6 +149,14 @@ func (o Options) String() string {
 	optStr += fmt.Sprintf("\n LogFileGCInternal: %v", o.LogFileGCInternal)
 	optStr += "\n LogFileSizeThreshold: " + strconv.FormatInt(o.LogFileSizeThreshold, 10)
 	optStr += "\n DiscardBufferSize: " + strconv.FormatInt(int64(o.DiscardBufferSize), 10)
+	optStr += "\n ValueLogThreshold: " + strconv.Itoa(o.ValueLogThreshold)
+	optStr += "\n ReadCacheSize: " + strconv.FormatInt(o.ReadCacheSize, 10)
+	optStr += "\n ReadCacheShards: " + strconv.Itoa(o.ReadCacheShards)
+	if o.ReadCachePolicy == cache.WTinyLFU {
+		optStr += "\n ReadCachePolicy: WTinyLFU"
+	} else {
+		optStr += "\n ReadCachePolicy: LRU"
+	}
 	optStr += "\n ============================================================================"
 	return optStr
 }
@@ -115,5 +172,15 @@ func DefaultOptions(path string) Options {
 		LogFileGCRatio:       0.5,
 		LogFileSizeThreshold: 512 << 20,
 		DiscardBufferSize:    8 << 20,
+		ReadCacheShards:      cache.DefaultShardNum,
+		ReadCachePolicy:      cache.LRU,
+	}
+}
+
+// indexMode returns the index mode of the specified data type.
+func (o Options) indexMode(dataType DataType) DataIndexMode {
+	if mode, ok := o.IndexModes[dataType]; ok {
+		return mode
 	}
+	return o.IndexMode
 }
@@ -0,0 +1,206 @@
+package khighdb
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/Khighness/khighdb/storage"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// A few bytes of string value, like a bit of bitmap, can be written by a patch entry instead of
+// rewriting the whole value. The patches of a value are held by its index node, and applied on
+// the value in order when it is read. The patch entry value looks like:
+//	+-----------+-----------+
+//	|    at     |   data    |
+//	+-----------+-----------+
+//	|  uvarint  |   bytes   |
+//	+-----------+-----------+
+// Since the patches must be replayed after the value, the value is rewritten as a whole with the
+// patches applied, once the patches are too many or too large, or any of them is moved by gc.
+
+// maxStrPatches is the max number of patches held by an index node.
+const maxStrPatches = 1024
+
+// ErrInvalidStrPatch represents the string patch can not be decoded.
+var ErrInvalidStrPatch = errors.New("invalid string patch")
+
+// strPatch is a patch of string value written by the patch entry at the position.
+type strPatch struct {
+	fid       uint32
+	offset    int64
+	entrySize int
+	at        int    // the byte offset in the string value
+	data      []byte // the bytes written at the offset
+}
+
+// encodeStrPatch encodes the byte offset and the bytes into the patch entry value.
+func encodeStrPatch(at int, data []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64+len(data))
+	n := binary.PutUvarint(buf, uint64(at))
+	return append(buf[:n], data...)
+}
+
+// decodeStrPatch decodes the patch entry value into the byte offset and the bytes.
+func decodeStrPatch(buf []byte) (int, []byte, error) {
+	at, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return 0, nil, ErrInvalidStrPatch
+	}
+	return int(at), buf[n:], nil
+}
+
+// applyStrPatches returns the value with the patches applied. The value is copied since it
+// may be shared with the index node or the read cache, and it is padded with zero bytes if a
+// patch is beyond its end.
+func applyStrPatches(val []byte, patches []*strPatch) []byte {
+	size := len(val)
+	for _, p := range patches {
+		if end := p.at + len(p.data); end > size {
+			size = end
+		}
+	}
+	res := make([]byte, size)
+	copy(res, val)
+	for _, p := range patches {
+		copy(res[p.at:], p.data)
+	}
+	return res
+}
+
+// getStrRange returns the bytes between from and to of the string value stored at key, without
+// copying the whole value. It returns ErrKeyNotFound if the key does not exist.
+// It must be called with the lock of String held.
+func (db *KhighDB) getStrRange(key []byte, from, to int) ([]byte, error) {
+	node, err := db.getLiveIndexNode(db.strIndex.idxTree, key)
+	if err != nil {
+		return nil, err
+	}
+	val, err := db.getNodeVal(node, String)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]byte, to-from)
+	if from < len(val) {
+		copy(res, val[from:])
+	}
+	for _, p := range node.patches {
+		if p.at < to && p.at+len(p.data) > from {
+			if p.at >= from {
+				copy(res[p.at-from:], p.data)
+			} else {
+				copy(res, p.data[from-p.at:])
+			}
+		}
+	}
+	return res, nil
+}
+
+// strLenInternal returns the length of the string value stored at key with its patches applied,
+// without copying the value. It returns ErrKeyNotFound if the key does not exist.
+// It must be called with the lock of String held.
+func (db *KhighDB) strLenInternal(key []byte) (int, error) {
+	node, err := db.getLiveIndexNode(db.strIndex.idxTree, key)
+	if err != nil {
+		return 0, err
+	}
+	val, err := db.getNodeVal(node, String)
+	if err != nil {
+		return 0, err
+	}
+	size := len(val)
+	for _, p := range node.patches {
+		if end := p.at + len(p.data); end > size {
+			size = end
+		}
+	}
+	return size, nil
+}
+
+// patchStrInternal writes data at the byte offset of the string value stored at key. The value
+// is created if the key does not exist, and is padded with zero bytes if the offset is beyond
+// its end. It must be called with the write lock of String held.
+func (db *KhighDB) patchStrInternal(key []byte, at int, data []byte) error {
+	node, err := db.getLiveIndexNode(db.strIndex.idxTree, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		if err = db.claimKey(key, String); err != nil {
+			return err
+		}
+		val := make([]byte, at+len(data))
+		copy(val[at:], data)
+		return db.setInternal(key, val, 0)
+	}
+	if err != nil {
+		return err
+	}
+
+	if node.strPatchesFull() {
+		val, err := db.getVal(db.strIndex.idxTree, key, String)
+		if err != nil {
+			return err
+		}
+		val = applyStrPatches(val, []*strPatch{{at: at, data: data}})
+		return db.setInternal(key, val, node.expiredAt)
+	}
+
+	ent := &storage.LogEntry{
+		Key:       key,
+		Value:     encodeStrPatch(at, data),
+		ExpiredAt: node.expiredAt,
+		Type:      storage.TypeStrPatch,
+	}
+	pos, err := db.writeLogEntry(ent, String)
+	if err != nil {
+		return err
+	}
+	node.patches = append(node.patches, &strPatch{
+		fid:       pos.fid,
+		offset:    pos.offset,
+		entrySize: pos.entrySize,
+		at:        at,
+		data:      append([]byte(nil), data...),
+	})
+	return nil
+}
+
+// compactStrInternal rewrites the string value stored at key as a whole with its patches applied.
+// It must be called with the write lock of String held.
+func (db *KhighDB) compactStrInternal(key []byte, node *indexNode) error {
+	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	}
+	return db.setInternal(key, val, node.expiredAt)
+}
+
+// strPatchesFull checks if no more patch should be added to the index node, which is true if the
+// patches are too many, or they are larger than the value.
+func (node *indexNode) strPatchesFull() bool {
+	if len(node.patches) >= maxStrPatches {
+		return true
+	}
+	valSize := node.entrySize
+	if node.vptr != nil {
+		valSize = node.vptr.entrySize
+	}
+	var patchSize int
+	for _, p := range node.patches {
+		patchSize += p.entrySize
+	}
+	return patchSize >= valSize
+}
+
+// hasStrPatchAt checks if the index node has a patch written by the entry at the position.
+func (node *indexNode) hasStrPatchAt(fid uint32, offset int64) bool {
+	for _, p := range node.patches {
+		if p.fid == fid && p.offset == offset {
+			return true
+		}
+	}
+	return false
+}
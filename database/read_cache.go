@@ -0,0 +1,108 @@
+package khighdb
+
+import (
+	"encoding/binary"
+
+	"github.com/Khighness/khighdb/cache"
+)
+
+// @Author KHighness
+// @Update 2023-01-15
+
+// readCacheKeySize is the size of read cache key.
+//	The structure of read cache key:
+//	+-----------+-----------+-----------+
+//	| data type |    fid    |   offset  |
+//	+-----------+-----------+-----------+
+//	|   1 byte  |  4 bytes  |  8 bytes  |
+//	+-----------+-----------+-----------+
+const readCacheKeySize = 13
+
+// ReadCacheStats describes the stats of read cache.
+type ReadCacheStats struct {
+	// Hits is the number of reads served by read cache.
+	Hits uint64
+	// Misses is the number of reads which fall through to log files.
+	Misses uint64
+	// Items is the number of values in read cache.
+	Items int
+	// Size is the total bytes of keys and values in read cache.
+	Size int64
+	// HitRatio is the ratio of hits to all the reads.
+	HitRatio float64
+}
+
+// newReadCache creates the read cache according to options, nil is returned if it is disabled.
+func newReadCache(options Options) *cache.Cache {
+	if options.ReadCacheSize <= 0 {
+		return nil
+	}
+	return cache.New(cache.Options{
+		MaxBytes: options.ReadCacheSize,
+		Shards:   options.ReadCacheShards,
+		Policy:   options.ReadCachePolicy,
+	})
+}
+
+// ReadCacheStats returns the stats of read cache.
+func (db *KhighDB) ReadCacheStats() ReadCacheStats {
+	if db.readCache == nil {
+		return ReadCacheStats{}
+	}
+	stats := db.readCache.Stats()
+	return ReadCacheStats{
+		Hits:     stats.Hits,
+		Misses:   stats.Misses,
+		Items:    db.readCache.Len(),
+		Size:     db.readCache.Size(),
+		HitRatio: stats.HitRatio(),
+	}
+}
+
+// readCacheKey returns the key of the value in read cache. The value is cached by its position
+// in log files, so a stale value will never be read after the index node is updated.
+func readCacheKey(dataType DataType, node *indexNode) []byte {
+	fid, offset := node.fid, node.offset
+	if node.vptr != nil {
+		dataType, fid, offset = valueLogType, node.vptr.fid, node.vptr.offset
+	}
+	buf := make([]byte, readCacheKeySize)
+	buf[0] = byte(dataType)
+	binary.LittleEndian.PutUint32(buf[1:5], fid)
+	binary.LittleEndian.PutUint64(buf[5:], uint64(offset))
+	return buf
+}
+
+// getCachedVal gets the value of the index node from read cache.
+// The cached value is copied, so that the caller is free to modify it.
+func (db *KhighDB) getCachedVal(dataType DataType, node *indexNode) ([]byte, bool) {
+	if db.readCache == nil {
+		return nil, false
+	}
+	val, ok := db.readCache.Get(readCacheKey(dataType, node))
+	if !ok {
+		return nil, false
+	}
+	buf := make([]byte, len(val))
+	copy(buf, val)
+	return buf, true
+}
+
+// setCachedVal puts the value of the index node into read cache.
+func (db *KhighDB) setCachedVal(dataType DataType, node *indexNode, val []byte) {
+	if db.readCache == nil {
+		return
+	}
+	buf := make([]byte, len(val))
+	copy(buf, val)
+	db.readCache.Set(readCacheKey(dataType, node), buf)
+}
+
+// evictCachedVal removes the value of the index node from read cache when the node is
+// updated, deleted or relocated by gc.
+func (db *KhighDB) evictCachedVal(dataType DataType, node *indexNode) {
+	if db.readCache == nil || node == nil {
+		return
+	}
+	db.readCache.Delete(readCacheKey(dataType, node))
+}
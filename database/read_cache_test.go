@@ -0,0 +1,136 @@
+package khighdb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Khighness/khighdb/cache"
+)
+
+// @Author KHighness
+// @Update 2023-01-15
+
+func TestKhighDB_ReadCache(t *testing.T) {
+	t.Run("lru", func(t *testing.T) {
+		testKhighDBReadCache(t, cache.LRU)
+	})
+	t.Run("w-tinylfu", func(t *testing.T) {
+		testKhighDBReadCache(t, cache.WTinyLFU)
+	})
+}
+
+func testKhighDBReadCache(t *testing.T, policy cache.Policy) {
+	path := filepath.Join("/tmp", "KhighDB-cache")
+	opts := DefaultOptions(path)
+	opts.ReadCacheSize = 1 << 20
+	opts.ReadCachePolicy = policy
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := getKey(1)
+	v1, v2 := getValue16B(), getValue16B()
+	assert.Nil(t, db.Set(key, v1))
+	for i := 0; i < 2; i++ {
+		val, err := db.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, v1, val)
+	}
+	stats := db.ReadCacheStats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Items)
+
+	// The cached value is modified by the caller.
+	val, _ := db.Get(key)
+	val[0] = '#'
+	val, _ = db.Get(key)
+	assert.Equal(t, v1, val)
+
+	// Update.
+	assert.Nil(t, db.Set(key, v2))
+	val, err = db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, v2, val)
+	// Delete.
+	assert.Nil(t, db.Delete(key))
+	val, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, val)
+
+	hashKey, listKey := getKey(2), getKey(3)
+	assert.Nil(t, db.HSet(hashKey, []byte("field"), v1))
+	assert.Nil(t, db.RPush(listKey, v2))
+	hits := db.ReadCacheStats().Hits
+	for i := 0; i < 2; i++ {
+		val, err = db.HGet(hashKey, []byte("field"))
+		assert.Nil(t, err)
+		assert.Equal(t, v1, val)
+		val, err = db.LIndex(listKey, 0)
+		assert.Nil(t, err)
+		assert.Equal(t, v2, val)
+	}
+	assert.True(t, db.ReadCacheStats().Hits >= hits+2)
+}
+
+func TestKhighDB_ReadCache_GC(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-cache")
+	opts := DefaultOptions(path)
+	opts.ReadCacheSize = 1 << 20
+	opts.ValueLogThreshold = 1 << 10
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	var values = make(map[int][]byte)
+	for i := 0; i < 64; i++ {
+		values[i%8] = getValue4K()
+		assert.Nil(t, db.Set(getKey(i%8), values[i%8]))
+		_, err = db.Get(getKey(i % 8))
+		assert.Nil(t, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, db.RunValueLogGC(-1, 0.5))
+
+	for i := 0; i < 8; i++ {
+		val, err := db.Get(getKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, values[i], val)
+	}
+	assert.Equal(t, 8, db.ReadCacheStats().Items)
+}
+
+func BenchmarkKhighDB_Get_ReadCache(b *testing.B) {
+	for _, size := range []int64{0, 64 << 20} {
+		path := filepath.Join("/tmp", "KhighDB-cache")
+		opts := DefaultOptions(path)
+		opts.ReadCacheSize = size
+		db, err := Open(opts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < 10000; i++ {
+			if err = db.Set(getKey(i), getValue16B()); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		name := "disabled"
+		if size > 0 {
+			name = "enabled"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := db.Get(getKey(i % 10000)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		destroyDB(db)
+	}
+}
@@ -0,0 +1,349 @@
+package khighdb
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/Khighness/khighdb/data/art"
+	"github.com/Khighness/khighdb/util"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// defaultScanCount is the default number of elements examined by one scan call.
+const defaultScanCount = 10
+
+// ErrInvalidCursor represents the scan cursor is not returned by the scan API.
+var ErrInvalidCursor = errors.New("invalid scan cursor")
+
+// The keyspaces visited by ScanCursor in order.
+const (
+	scanStrs = iota
+	scanCollections
+	scanKeyspaceNum
+)
+
+// ScanOptions defines the options of the cursor based scan APIs.
+type ScanOptions struct {
+	// Match is a glob-style pattern, only the elements matching it are returned.
+	// All the elements are returned if it is empty.
+	Match string
+
+	// Count is the number of elements examined by one call, which is only a hint,
+	// since the elements which don't match are examined too.
+	// Default value is 10.
+	Count int
+
+	// Types makes ScanCursor only return the keys of the specified data types.
+	// The keys of all the data types are returned if it is empty.
+	Types []DataType
+}
+
+// scanner examines the elements for one scan call.
+type scanner struct {
+	match  []byte
+	prefix []byte
+	remain int
+}
+
+func newScanner(opts ScanOptions) *scanner {
+	if opts.Count <= 0 {
+		opts.Count = defaultScanCount
+	}
+	s := &scanner{remain: opts.Count}
+	if opts.Match != "" {
+		s.match = []byte(opts.Match)
+		s.prefix, _ = util.GlobPrefix(s.match)
+	}
+	return s
+}
+
+// matches checks if the element matches the pattern.
+func (s *scanner) matches(elem []byte) bool {
+	if s.match == nil {
+		return true
+	}
+	return util.GlobMatch(s.match, elem, false)
+}
+
+// scanTree examines the keys with prefix and greater than cursor in the tree in ascending
+// order, and calls fn with the keys which are not expired. It returns the last examined key
+// if there are more keys to examine, otherwise nil.
+func (s *scanner) scanTree(idxTree *art.AdaptiveRadixTree, prefix, cursor []byte, fn func(key []byte, node *indexNode)) []byte {
+	nano := time.Now().UnixNano()
+	return s.scanFrom(idxTree, prefix, cursor, func(key []byte, value interface{}) {
+		node, _ := value.(*indexNode)
+		if node == nil || (node.expiredAt != 0 && node.expiredAt < nano) {
+			return
+		}
+		fn(key, node)
+	})
+}
+
+// scanFrom is like scanTree, but calls fn with all the examined keys and their values.
+// The tree is seeked to the greater one of prefix and cursor, so the keys before are skipped
+// without being visited.
+func (s *scanner) scanFrom(idxTree *art.AdaptiveRadixTree, prefix, cursor []byte, fn func(key []byte, value interface{})) []byte {
+	from := prefix
+	if bytes.Compare(cursor, prefix) > 0 {
+		from = cursor
+	}
+
+	var last []byte
+	var more bool
+	idxTree.ForEachFrom(from, false, func(key []byte, value interface{}) bool {
+		// The keys with prefix are adjacent, so the rest keys don't have it either.
+		if !bytes.HasPrefix(key, prefix) {
+			return false
+		}
+		if cursor != nil && bytes.Equal(key, cursor) {
+			return true
+		}
+		if s.remain <= 0 {
+			more = true
+			return false
+		}
+		s.remain--
+		last = key
+		fn(key, value)
+		return true
+	})
+	if !more {
+		return nil
+	}
+	return last
+}
+
+// ScanCursor iterates over the keys of all the data types incrementally.
+// The scan starts with a nil cursor, and the returned cursor is passed to the next call
+// to continue the scan. A nil cursor is returned when the scan is completed.
+// The keys existing during the whole scan are returned exactly once, and the keys added
+// or removed during the scan may be returned or not.
+// The keys of String are scanned first, then the keys of the other data types.
+// The cursor is opaque, which is composed of the keyspace and the last examined key,
+// the last key is absent if the scan should start from the first key of the keyspace:
+//	+----------+----------+-------------------+
+//	| keyspace |   flag   |     last key      |
+//	+----------+----------+-------------------+
+func (db *KhighDB) ScanCursor(cursor []byte, opts ScanOptions) ([]byte, [][]byte, error) {
+	s := newScanner(opts)
+
+	var start int
+	var last []byte
+	if len(cursor) > 0 {
+		start = int(cursor[0])
+		if start >= scanKeyspaceNum || len(cursor) == 2 {
+			return nil, nil, ErrInvalidCursor
+		}
+		if len(cursor) > 1 {
+			last = cursor[2:]
+		}
+	}
+
+	var keys [][]byte
+	collect := func(key []byte) {
+		keys = append(keys, key)
+	}
+	for i := start; i < scanKeyspaceNum; i++ {
+		if !scanKeyspaceOf(i, opts.Types) {
+			last = nil
+			continue
+		}
+		if s.remain <= 0 {
+			return []byte{byte(i)}, keys, nil
+		}
+		var next []byte
+		if i == scanStrs {
+			next = db.scanStrKeys(s, last, collect)
+		} else {
+			next = db.scanCollectionKeys(s, opts.Types, last, collect)
+		}
+		if next != nil {
+			return append([]byte{byte(i), 1}, next...), keys, nil
+		}
+		last = nil
+	}
+	return nil, keys, nil
+}
+
+// scanKeyspaceOf checks if the keyspace holds the keys of the data types.
+func scanKeyspaceOf(keyspace int, dataTypes []DataType) bool {
+	if len(dataTypes) == 0 {
+		return true
+	}
+	for _, dataType := range dataTypes {
+		if (dataType == String) == (keyspace == scanStrs) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanStrKeys examines the keys of String.
+func (db *KhighDB) scanStrKeys(s *scanner, cursor []byte, fn func(key []byte)) []byte {
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+	return s.scanTree(db.strIndex.idxTree, s.prefix, cursor, func(key []byte, _ *indexNode) {
+		if s.matches(key) {
+			fn(key)
+		}
+	})
+}
+
+// scanCollectionKeys examines the keys of List, Hash, Set, ZSet, Stream and JSON, and the keys
+// of other data types than dataTypes or the hashes whose fields are all expired are skipped.
+func (db *KhighDB) scanCollectionKeys(s *scanner, dataTypes []DataType, cursor []byte, fn func(key []byte)) []byte {
+	db.keyTypes.mu.Lock()
+	defer db.keyTypes.mu.Unlock()
+	nano := time.Now().UnixNano()
+	return s.scanFrom(db.keyTypes.types, s.prefix, cursor, func(key []byte, value interface{}) {
+		dataType, _ := value.(DataType)
+		if len(dataTypes) > 0 && !containsDataType(dataTypes, dataType) {
+			return
+		}
+		if db.keyTypes.expired(key, nano) {
+			return
+		}
+		if s.matches(key) {
+			fn(key)
+		}
+	})
+}
+
+// HScanCursor iterates over the fields of the hash stored at key incrementally.
+// The cursor works like the one of ScanCursor, which is the last examined field.
+// The returned data likes ['field', 'value', 'field', 'value'...].
+func (db *KhighDB) HScanCursor(key []byte, cursor []byte, opts ScanOptions) ([]byte, [][]byte, error) {
+	s := newScanner(opts)
+
+	db.hashIndex.mu.RLock()
+	defer db.hashIndex.mu.RUnlock()
+	idxTree := db.hashIndex.trees[string(key)]
+	if idxTree == nil {
+		return nil, nil, nil
+	}
+
+	var values [][]byte
+	var valErr error
+	next := s.scanTree(idxTree, s.prefix, cursor, func(field []byte, _ *indexNode) {
+		if valErr != nil || !s.matches(field) {
+			return
+		}
+		val, err := db.getVal(idxTree, field, Hash)
+		if err != nil {
+			if !errors.Is(err, ErrKeyNotFound) {
+				valErr = err
+			}
+			return
+		}
+		values = append(values, field, val)
+	})
+	if valErr != nil {
+		return nil, nil, valErr
+	}
+	return next, values, nil
+}
+
+// SScanCursor iterates over the members of the set stored at key incrementally.
+// The cursor works like the one of ScanCursor.
+func (db *KhighDB) SScanCursor(key []byte, cursor []byte, opts ScanOptions) ([]byte, [][]byte, error) {
+	s := newScanner(opts)
+
+	db.setIndex.mu.RLock()
+	defer db.setIndex.mu.RUnlock()
+	idxTree := db.setIndex.trees[string(key)]
+	if idxTree == nil {
+		return nil, nil, nil
+	}
+
+	var members [][]byte
+	var valErr error
+	// The members are ordered by their index keys in the index tree.
+	next := s.scanTree(idxTree, nil, cursor, func(memberKey []byte, _ *indexNode) {
+		if valErr != nil {
+			return
+		}
+		member, err := db.memberOf(idxTree, memberKey, Set)
+		if err != nil {
+			if !errors.Is(err, ErrKeyNotFound) {
+				valErr = err
+			}
+			return
+		}
+		if s.matches(member) {
+			members = append(members, member)
+		}
+	})
+	if valErr != nil {
+		return nil, nil, valErr
+	}
+	return next, members, nil
+}
+
+// ZScanCursor iterates over the members of the sorted set stored at key incrementally.
+// The cursor works like the one of ScanCursor.
+// The returned data likes ['member', 'score', 'member', 'score'...].
+func (db *KhighDB) ZScanCursor(key []byte, cursor []byte, opts ScanOptions) ([]byte, [][]byte, error) {
+	s := newScanner(opts)
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+	idxTree := db.zsetIndex.trees[string(key)]
+	if idxTree == nil {
+		return nil, nil, nil
+	}
+
+	var values [][]byte
+	var valErr error
+	// The members are ordered by their index keys in the index tree.
+	next := s.scanTree(idxTree, nil, cursor, func(memberKey []byte, _ *indexNode) {
+		if valErr != nil {
+			return
+		}
+		member, err := db.memberOf(idxTree, memberKey, ZSet)
+		if err != nil {
+			if !errors.Is(err, ErrKeyNotFound) {
+				valErr = err
+			}
+			return
+		}
+		if !s.matches(member) {
+			return
+		}
+		if ok, score := db.zsetIndex.indexes.ZScore(string(key), string(member)); ok {
+			values = append(values, member, []byte(util.Float64ToStr(score)))
+		}
+	})
+	if valErr != nil {
+		return nil, nil, valErr
+	}
+	return next, values, nil
+}
+
+// globScanPrefix returns the prefix used to scan the elements which have the prefix and
+// match the pattern, the literal prefix of pattern is used if it is longer. And ok is false
+// if no element can have both prefixes.
+func globScanPrefix(prefix []byte, pattern string) ([]byte, bool) {
+	if pattern == "" {
+		return prefix, true
+	}
+	literal, _ := util.GlobPrefix([]byte(pattern))
+	if bytes.HasPrefix(literal, prefix) {
+		return literal, true
+	}
+	if bytes.HasPrefix(prefix, literal) {
+		return prefix, true
+	}
+	return nil, false
+}
+
+func containsDataType(dataTypes []DataType, dataType DataType) bool {
+	for _, dt := range dataTypes {
+		if dt == dataType {
+			return true
+		}
+	}
+	return false
+}
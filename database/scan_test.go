@@ -0,0 +1,210 @@
+package khighdb
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+func TestKhighDB_ScanCursor(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBScanCursor(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBScanCursor(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBScanCursor(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_HScanCursor(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("hash")
+	for i := 0; i < 25; i++ {
+		assert.Nil(t, db.HSet(key, []byte(fmt.Sprintf("f-%02d", i)), []byte(fmt.Sprintf("v-%02d", i))))
+	}
+
+	var cursor []byte
+	var fields []string
+	for {
+		next, values, err := db.HScanCursor(key, cursor, ScanOptions{Match: "f-1*", Count: 4})
+		assert.Nil(t, err)
+		for i := 0; i < len(values); i += 2 {
+			fields = append(fields, string(values[i]))
+			assert.Equal(t, "v"+string(values[i][1:]), string(values[i+1]))
+		}
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, 10, len(fields))
+	assert.Equal(t, "f-10", fields[0])
+
+	next, values, err := db.HScanCursor([]byte("not-exist"), nil, ScanOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, next)
+	assert.Nil(t, values)
+}
+
+func TestKhighDB_SScanCursor(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("set")
+	var expected []string
+	for i := 0; i < 30; i++ {
+		member := fmt.Sprintf("m-%02d", i)
+		assert.Nil(t, db.SAdd(key, []byte(member)))
+		expected = append(expected, member)
+	}
+
+	var cursor []byte
+	var members []string
+	for {
+		next, values, err := db.SScanCursor(key, cursor, ScanOptions{Count: 7})
+		assert.Nil(t, err)
+		for _, v := range values {
+			members = append(members, string(v))
+		}
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	sort.Strings(members)
+	assert.Equal(t, expected, members)
+}
+
+func TestKhighDB_ZScanCursor(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("zset")
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, db.ZAdd(key, float64(i), []byte(fmt.Sprintf("m-%02d", i))))
+	}
+
+	var cursor []byte
+	scores := make(map[string]string)
+	for {
+		next, values, err := db.ZScanCursor(key, cursor, ScanOptions{Match: "m-0?", Count: 3})
+		assert.Nil(t, err)
+		for i := 0; i < len(values); i += 2 {
+			scores[string(values[i])] = string(values[i+1])
+		}
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, 10, len(scores))
+	assert.Equal(t, "7", scores["m-07"])
+}
+
+func testKhighDBScanCursor(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer destroyDB(db)
+
+	var expected []string
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("str-%02d", i)
+		assert.Nil(t, db.Set([]byte(key), []byte("v")))
+		expected = append(expected, key)
+	}
+	for i := 0; i < 5; i++ {
+		keys := []string{fmt.Sprintf("list-%d", i), fmt.Sprintf("hash-%d", i),
+			fmt.Sprintf("set-%d", i), fmt.Sprintf("zset-%d", i)}
+		assert.Nil(t, db.LPush([]byte(keys[0]), []byte("v")))
+		assert.Nil(t, db.HSet([]byte(keys[1]), []byte("f"), []byte("v")))
+		assert.Nil(t, db.SAdd([]byte(keys[2]), []byte("m")))
+		assert.Nil(t, db.ZAdd([]byte(keys[3]), 1, []byte("m")))
+		expected = append(expected, keys...)
+	}
+	sort.Strings(expected)
+
+	scanAll := func(opts ScanOptions) []string {
+		var cursor []byte
+		var result []string
+		for {
+			next, keys, err := db.ScanCursor(cursor, opts)
+			assert.Nil(t, err)
+			if opts.Count > 0 {
+				assert.LessOrEqual(t, len(keys), opts.Count)
+			}
+			for _, key := range keys {
+				result = append(result, string(key))
+			}
+			if next == nil {
+				break
+			}
+			cursor = next
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	t.Run("all", func(t *testing.T) {
+		assert.Equal(t, expected, scanAll(ScanOptions{Count: 7}))
+	})
+
+	t.Run("match", func(t *testing.T) {
+		result := scanAll(ScanOptions{Match: "*-1*", Count: 5})
+		assert.Equal(t, 14, len(result))
+	})
+
+	t.Run("type", func(t *testing.T) {
+		result := scanAll(ScanOptions{Types: []DataType{Set, ZSet}})
+		assert.Equal(t, []string{"set-0", "set-1", "set-2", "set-3", "set-4",
+			"zset-0", "zset-1", "zset-2", "zset-3", "zset-4"}, result)
+	})
+
+	t.Run("invalid-cursor", func(t *testing.T) {
+		_, _, err := db.ScanCursor([]byte{100}, ScanOptions{})
+		assert.Equal(t, ErrInvalidCursor, err)
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		result := scanAll(ScanOptions{Match: "str-4?", Count: 3})
+		assert.Equal(t, []string{"str-40", "str-41", "str-42", "str-43", "str-44",
+			"str-45", "str-46", "str-47", "str-48", "str-49"}, result)
+	})
+
+	t.Run("invalid-pattern", func(t *testing.T) {
+		result := scanAll(ScanOptions{Match: "["})
+		assert.Empty(t, result)
+	})
+
+	t.Run("deleted-cursor", func(t *testing.T) {
+		// The scan continues after the last examined key, even if it is deleted.
+		opts := ScanOptions{Match: "str-*", Count: 5}
+		cursor, keys, err := db.ScanCursor(nil, opts)
+		assert.Nil(t, err)
+		assert.Equal(t, "str-04", string(keys[len(keys)-1]))
+		assert.Nil(t, db.Delete(keys[len(keys)-1]))
+		defer func() {
+			assert.Nil(t, db.Set([]byte("str-04"), []byte("v")))
+		}()
+
+		var result []string
+		for cursor != nil {
+			cursor, keys, err = db.ScanCursor(cursor, opts)
+			assert.Nil(t, err)
+			for _, key := range keys {
+				result = append(result, string(key))
+			}
+		}
+		assert.Equal(t, 45, len(result))
+		assert.Equal(t, "str-05", result[0])
+	})
+}
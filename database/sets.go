@@ -1,15 +1,15 @@
 package khighdb
 
 import (
-	"github.com/Khighness/khighdb/util"
-	"go.uber.org/zap"
+	"bytes"
+	"math/rand"
 
 	"github.com/Khighness/khighdb/data/art"
 	"github.com/Khighness/khighdb/storage"
 )
 
 // @Author KHighness
-// @Update 2023-01-10
+// @Update 2023-01-26
 
 // SAdd adds the specified members to the members to the set stored at key.
 // Specified members which are already a member of this set are ignored.
@@ -19,28 +19,18 @@ func (db *KhighDB) SAdd(key []byte, members ...[]byte) error {
 	defer db.setIndex.mu.Unlock()
 
 	if db.setIndex.trees[string(key)] == nil {
+		if err := db.claimKey(key, Set); err != nil {
+			return err
+		}
 		db.setIndex.trees[string(key)] = art.NewART()
 	}
+	defer db.releaseKeyIfEmpty(key, Set)
 	idxTree := db.setIndex.trees[string(key)]
 	for _, mem := range members {
 		if len(mem) == 0 {
 			continue
 		}
-		if err := db.setIndex.murhash.Write(mem); err != nil {
-			return err
-		}
-		sum := db.setIndex.murhash.EncodeSum128()
-		db.setIndex.murhash.Reset()
-
-		ent := &storage.LogEntry{Key: key, Value: mem}
-		pos, err := db.writeLogEntry(ent, Set)
-		if err != nil {
-			return err
-		}
-		entry := &storage.LogEntry{Key: sum, Value: mem}
-		_, size := storage.EncodeEntry(entry)
-		pos.entrySize = size
-		if err := db.updateIndexTree(idxTree, entry, pos, true, Set); err != nil {
+		if err := db.sAddInternal(idxTree, key, mem); err != nil {
 			return err
 		}
 	}
@@ -51,6 +41,7 @@ func (db *KhighDB) SAdd(key []byte, members ...[]byte) error {
 func (db *KhighDB) SPop(key []byte, count uint) ([][]byte, error) {
 	db.setIndex.mu.Lock()
 	defer db.setIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, Set)
 	if db.setIndex.trees[string(key)] == nil {
 		return nil, nil
 	}
@@ -64,14 +55,14 @@ func (db *KhighDB) SPop(key []byte, count uint) ([][]byte, error) {
 		if node == nil {
 			continue
 		}
-		val, err := db.getVal(idxTree, node.Key(), Set)
+		val, err := db.memberOf(idxTree, node.Key(), Set)
 		if err != nil {
 			return nil, err
 		}
 		values = append(values, val)
 	}
 	for _, val := range values {
-		if err := db.sRemInternal(key, val); err != nil {
+		if _, err := db.sRemInternal(key, val); err != nil {
 			return nil, err
 		}
 	}
@@ -79,37 +70,119 @@ func (db *KhighDB) SPop(key []byte, count uint) ([][]byte, error) {
 }
 
 // SRem removes the specified members from the set stored at key.
-func (db *KhighDB) SRem(key []byte, member ...[]byte) error {
+// Specified members that are not a member of this set are ignored.
+// It returns the number of members that were removed from the set.
+func (db *KhighDB) SRem(key []byte, member ...[]byte) (int, error) {
 	db.setIndex.mu.Lock()
 	defer db.setIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, Set)
 
 	if db.setIndex.trees[string(key)] == nil {
-		return nil
+		return 0, nil
 	}
+	var count int
 	for _, mem := range member {
-		if err := db.sRemInternal(key, mem); err != nil {
-			return err
+		ok, err := db.sRemInternal(key, mem)
+		if err != nil {
+			return count, err
+		}
+		if ok {
+			count++
 		}
 	}
-	return nil
+	return count, nil
+}
+
+// SMove atomically moves member from the set stored at srcKey to the set stored at dstKey.
+// It returns false if the member is not a member of the set stored at srcKey.
+// The removal and the addition are written as one entry, so either both or neither of them
+// are persisted.
+func (db *KhighDB) SMove(srcKey, dstKey, member []byte) (bool, error) {
+	db.setIndex.mu.Lock()
+	defer db.setIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(srcKey, Set)
+
+	srcTree := db.setIndex.trees[string(srcKey)]
+	if srcTree == nil {
+		return false, nil
+	}
+	srcMemberKey, err := db.findMember(srcTree, member, Set)
+	if err != nil || srcMemberKey == nil {
+		return false, err
+	}
+	if bytes.Equal(srcKey, dstKey) {
+		return true, nil
+	}
+	if db.setIndex.trees[string(dstKey)] == nil {
+		if err := db.claimKey(dstKey, Set); err != nil {
+			return false, err
+		}
+		db.setIndex.trees[string(dstKey)] = art.NewART()
+	}
+	dstTree := db.setIndex.trees[string(dstKey)]
+	dstMemberKey, err := db.memberKey(dstTree, member, Set)
+	if err != nil {
+		return false, err
+	}
+
+	ent := &storage.LogEntry{Key: db.encodeKey(srcKey, dstKey), Value: member, Type: storage.TypeSetMove}
+	pos, err := db.writeLogEntry(ent, Set)
+	if err != nil {
+		return false, err
+	}
+	oldVal, updated := srcTree.Delete(srcMemberKey)
+	db.sendDiscard(oldVal, updated, Set)
+	entry := &storage.LogEntry{Key: dstMemberKey, Value: member}
+	if err = db.updateIndexTree(dstTree, entry, pos, true, Set); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // SIsMember checks if the given member is a member of the set stored at key.
 func (db *KhighDB) SIsMember(key, member []byte) bool {
 	db.setIndex.mu.RLock()
 	defer db.setIndex.mu.RUnlock()
+	return db.sIsMember(key, member)
+}
 
-	if db.setIndex.trees[string(key)] == nil {
-		return false
+// SMIsMember checks if each of the given members is a member of the set stored at key.
+func (db *KhighDB) SMIsMember(key []byte, members ...[]byte) []bool {
+	db.setIndex.mu.RLock()
+	defer db.setIndex.mu.RUnlock()
+
+	res := make([]bool, len(members))
+	for i, member := range members {
+		res[i] = db.sIsMember(key, member)
 	}
-	idxTree := db.setIndex.trees[string(key)]
-	if err := db.setIndex.murhash.Write(member); err != nil {
-		return false
+	return res
+}
+
+// SRandMember returns random members of the set stored at key.
+// If count is positive, it returns at most count distinct members.
+// If count is negative, it returns -count members which may be repeated.
+func (db *KhighDB) SRandMember(key []byte, count int) ([][]byte, error) {
+	db.setIndex.mu.RLock()
+	defer db.setIndex.mu.RUnlock()
+
+	members, err := db.sMembers(key)
+	if err != nil || count == 0 || len(members) == 0 {
+		return nil, err
+	}
+	if count < 0 {
+		res := make([][]byte, -count)
+		for i := range res {
+			res[i] = members[rand.Intn(len(members))]
+		}
+		return res, nil
 	}
-	sum := db.setIndex.murhash.EncodeSum128()
-	db.setIndex.murhash.Reset()
-	node := idxTree.Get(sum)
-	return node != nil
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	if count < len(members) {
+		members = members[:count]
+	}
+	return members, nil
 }
 
 // SMembers returns all the members of the set value stored at key.
@@ -119,6 +192,16 @@ func (db *KhighDB) SMembers(key []byte) ([][]byte, error) {
 	return db.sMembers(key)
 }
 
+// SClear removes the set stored at key with all its members.
+// Only one entry is written no matter how many members the set holds.
+func (db *KhighDB) SClear(key []byte) error {
+	db.setIndex.mu.Lock()
+	defer db.setIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, Set)
+
+	return db.clearKeyInternal(key, Set)
+}
+
 // SCard returns the set cardinality (number of elements) stored at key.
 func (db *KhighDB) SCard(key []byte) int {
 	db.setIndex.mu.RLock()
@@ -146,17 +229,14 @@ func (db *KhighDB) SDiff(keys ...[]byte) ([][]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	set := make(map[uint64]struct{})
+	set := make(map[string]struct{})
 	for _, key := range keys[1:] {
 		members, err := db.sMembers(key)
 		if err != nil {
 			return nil, err
 		}
 		for _, member := range members {
-			h := util.MemHash(member)
-			if _, ok := set[h]; !ok {
-				set[h] = struct{}{}
-			}
+			set[string(member)] = struct{}{}
 		}
 	}
 	if len(set) == 0 {
@@ -164,8 +244,7 @@ func (db *KhighDB) SDiff(keys ...[]byte) ([][]byte, error) {
 	}
 	res := make([][]byte, 0)
 	for _, member := range firstSet {
-		h := util.MemHash(member)
-		if _, ok := set[h]; !ok {
+		if _, ok := set[string(member)]; !ok {
 			res = append(res, member)
 		}
 	}
@@ -201,7 +280,7 @@ func (db *KhighDB) SUnion(keys ...[]byte) ([][]byte, error) {
 		return db.sMembers(keys[0])
 	}
 
-	set := make(map[uint64]struct{})
+	set := make(map[string]struct{})
 	unionSet := make([][]byte, 0)
 	for _, key := range keys {
 		members, err := db.sMembers(key)
@@ -209,9 +288,8 @@ func (db *KhighDB) SUnion(keys ...[]byte) ([][]byte, error) {
 			return nil, err
 		}
 		for _, member := range members {
-			h := util.MemHash(member)
-			if _, ok := set[h]; !ok {
-				set[h] = struct{}{}
+			if _, ok := set[string(member)]; !ok {
+				set[string(member)] = struct{}{}
 				unionSet = append(unionSet, member)
 			}
 		}
@@ -248,7 +326,7 @@ func (db *KhighDB) SInter(keys ...[]byte) ([][]byte, error) {
 		return db.sMembers(keys[0])
 	}
 	num := len(keys)
-	set := make(map[uint64]int)
+	set := make(map[string]int)
 	interSet := make([][]byte, 0)
 	for _, key := range keys {
 		members, err := db.sMembers(key)
@@ -256,9 +334,8 @@ func (db *KhighDB) SInter(keys ...[]byte) ([][]byte, error) {
 			return nil, err
 		}
 		for _, val := range members {
-			h := util.MemHash(val)
-			set[h]++
-			if set[h] == num {
+			set[string(val)]++
+			if set[string(val)] == num {
 				interSet = append(interSet, val)
 			}
 		}
@@ -266,6 +343,50 @@ func (db *KhighDB) SInter(keys ...[]byte) ([][]byte, error) {
 	return interSet, nil
 }
 
+// SInterCard returns the cardinality of the set resulting from the inter of all the given sets.
+// The counting stops once the cardinality reaches limit, and a non-positive limit means no limit.
+func (db *KhighDB) SInterCard(limit int, keys ...[]byte) (int, error) {
+	db.setIndex.mu.RLock()
+	defer db.setIndex.mu.RUnlock()
+
+	if len(keys) == 0 {
+		return 0, ErrInvalidNumberOfArgs
+	}
+	// Iterate the smallest set.
+	smallest := keys[0]
+	for _, key := range keys {
+		idxTree := db.setIndex.trees[string(key)]
+		if idxTree == nil {
+			return 0, nil
+		}
+		if idxTree.Size() < db.setIndex.trees[string(smallest)].Size() {
+			smallest = key
+		}
+	}
+	members, err := db.sMembers(smallest)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, member := range members {
+		inter := true
+		for _, key := range keys {
+			if !db.sIsMember(key, member) {
+				inter = false
+				break
+			}
+		}
+		if inter {
+			count++
+			if limit > 0 && count >= limit {
+				break
+			}
+		}
+	}
+	return count, nil
+}
+
 // SInterStore is equal to SInter, the result is stored in
 // first param instead of being returned.
 // It returns the cardinality of the result normally.
@@ -282,34 +403,50 @@ func (db *KhighDB) SInterStore(keys ...[]byte) (int, error) {
 	return db.SCard(destination), nil
 }
 
-// sRemInternal removes a member from the set stored at key.
-func (db *KhighDB) sRemInternal(key []byte, member []byte) error {
+// sRemInternal removes a member from the set stored at key, it returns false if the member
+// is not a member of the set.
+func (db *KhighDB) sRemInternal(key []byte, member []byte) (bool, error) {
 	idxTree := db.setIndex.trees[string(key)]
-	if err := db.setIndex.murhash.Write(member); err != nil {
-		return err
+	if idxTree == nil {
+		return false, nil
 	}
-	sum := db.setIndex.murhash.EncodeSum128()
-	db.setIndex.murhash.Reset()
+	memberKey, err := db.findMember(idxTree, member, Set)
+	if err != nil || memberKey == nil {
+		return false, err
+	}
+	val, updated := idxTree.Delete(memberKey)
+	entry := &storage.LogEntry{Key: key, Value: member, Type: storage.TypeDelete}
+	if _, err = db.writeLogEntry(entry, Set); err != nil {
+		return false, err
+	}
+
+	db.sendDiscard(val, updated, Set)
+	return true, nil
+}
 
-	val, updated := idxTree.Delete(sum)
-	if !updated {
-		return nil
+// sIsMember checks if the given member is a member of the set stored at key.
+func (db *KhighDB) sIsMember(key, member []byte) bool {
+	idxTree := db.setIndex.trees[string(key)]
+	if idxTree == nil {
+		return false
 	}
-	entry := &storage.LogEntry{Key: key, Value: sum, Type: storage.TypeDelete}
-	pos, err := db.writeLogEntry(entry, Set)
+	memberKey, err := db.findMember(idxTree, member, Set)
+	return err == nil && memberKey != nil
+}
+
+// sAddInternal adds a member to the set stored at key.
+func (db *KhighDB) sAddInternal(idxTree *art.AdaptiveRadixTree, key, member []byte) error {
+	memberKey, err := db.memberKey(idxTree, member, Set)
 	if err != nil {
 		return err
 	}
-
-	db.sendDiscard(val, updated, Set)
-	_, size := storage.EncodeEntry(entry)
-	node := &indexNode{fid: pos.fid, entrySize: size}
-	select {
-	case db.discards[Set].nodeChan <- node:
-	default:
-		zap.L().Warn("Failed to send node to discard channel")
+	ent := &storage.LogEntry{Key: key, Value: member}
+	pos, err := db.writeLogEntry(ent, Set)
+	if err != nil {
+		return err
 	}
-	return nil
+	entry := &storage.LogEntry{Key: memberKey, Value: member}
+	return db.updateIndexTree(idxTree, entry, pos, true, Set)
 }
 
 // sMembers returns all members of the set stored at key.
@@ -326,7 +463,7 @@ func (db *KhighDB) sMembers(key []byte) ([][]byte, error) {
 		if node == nil {
 			continue
 		}
-		val, err := db.getVal(idxTree, node.Key(), Set)
+		val, err := db.memberOf(idxTree, node.Key(), Set)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,324 @@
+package khighdb
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Khighness/khighdb/util"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+func TestKhighDB_SRem(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBSRem(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBSRem(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBSRem(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_SMove(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBSMove(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBSMove(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBSMove(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_SetMemberCollision(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBSetMemberCollision(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBSetMemberCollision(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBSetMemberCollision(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_SMoveReopen(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-smove")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() { destroyDB(db) }()
+
+	src, dst := []byte("src"), []byte("dst")
+	members := make([][]byte, 64)
+	for i := range members {
+		members[i] = getValue4K()
+		assert.Nil(t, db.SAdd(src, members[i]))
+	}
+	for _, member := range members {
+		ok, err := db.SMove(src, dst, member)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	for i := 0; i < 32; i++ {
+		n, err := db.SRem(dst, members[i])
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+	}
+
+	// The moved members are garbage in the source set, so the archived set log files are rewritten.
+	time.Sleep(100 * time.Millisecond)
+	archived := len(db.archivedLogFiles[Set])
+	assert.Nil(t, db.RunLogFileGC(Set, -1, 0.5))
+	assert.True(t, len(db.archivedLogFiles[Set]) < archived)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 0, db.SCard(src))
+	assert.Equal(t, 32, db.SCard(dst))
+	for i, member := range members {
+		assert.False(t, db.SIsMember(src, member))
+		assert.Equal(t, i >= 32, db.SIsMember(dst, member))
+	}
+	assert.Equal(t, 1, db.DBSize())
+}
+
+func TestKhighDB_SMoveGC(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-smove-gc")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() { destroyDB(db) }()
+
+	// fill writes garbage until the active set log file is fid.
+	fill := func(fid uint32) {
+		for db.getActiveLogFile(Set).Fid < fid {
+			member := getValue4K()
+			assert.Nil(t, db.SAdd([]byte("garbage"), member))
+			_, err := db.SRem([]byte("garbage"), member)
+			assert.Nil(t, err)
+		}
+	}
+
+	// The member is added in log file 0, and moved in log file 1.
+	src, dst, member := []byte("src"), []byte("dst"), []byte("member")
+	assert.Nil(t, db.SAdd(src, member))
+	fill(1)
+	ok, err := db.SMove(src, dst, member)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	fill(2)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, db.RunLogFileGC(Set, 1, 0.3))
+	assert.Nil(t, db.getArchivedLogFile(Set, 1))
+
+	check := func(db *KhighDB) {
+		assert.False(t, db.SIsMember(src, member))
+		assert.True(t, db.SIsMember(dst, member))
+		_, err := db.Type(src)
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	check(db)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check(db)
+}
+
+func TestKhighDB_SRandMember(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("set")
+	members, err := db.SRandMember(key, 1)
+	assert.Nil(t, err)
+	assert.Empty(t, members)
+	assert.Nil(t, db.SAdd(key, []byte("a"), []byte("b"), []byte("c")))
+
+	members, err = db.SRandMember(key, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(members))
+	assert.NotEqual(t, members[0], members[1])
+	members, err = db.SRandMember(key, 10)
+	assert.Nil(t, err)
+	sort.Slice(members, func(i, j int) bool { return string(members[i]) < string(members[j]) })
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c")}, members)
+
+	// A negative count allows the same member multiple times.
+	members, err = db.SRandMember(key, -10)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(members))
+	for _, member := range members {
+		assert.True(t, db.SIsMember(key, member))
+	}
+	members, err = db.SRandMember(key, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, members)
+	assert.Equal(t, 3, db.SCard(key))
+}
+
+func TestKhighDB_SMIsMember(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("set")
+	assert.Equal(t, []bool{false}, db.SMIsMember(key, []byte("a")))
+	assert.Nil(t, db.SAdd(key, []byte("a"), []byte("b")))
+	assert.Equal(t, []bool{true, false, true},
+		db.SMIsMember(key, []byte("a"), []byte("c"), []byte("b")))
+}
+
+func TestKhighDB_SInterCard(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	k1, k2, k3 := []byte("s1"), []byte("s2"), []byte("s3")
+	assert.Nil(t, db.SAdd(k1, []byte("a"), []byte("b"), []byte("c"), []byte("d")))
+	assert.Nil(t, db.SAdd(k2, []byte("b"), []byte("c"), []byte("d"), []byte("e")))
+	assert.Nil(t, db.SAdd(k3, []byte("c"), []byte("d")))
+
+	n, err := db.SInterCard(0, k1, k2)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	n, err = db.SInterCard(0, k1, k2, k3)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = db.SInterCard(1, k1, k2, k3)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = db.SInterCard(0, k1, []byte("missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	_, err = db.SInterCard(0)
+	assert.Equal(t, ErrInvalidNumberOfArgs, err)
+}
+
+func testKhighDBSRem(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer destroyDB(db)
+
+	key := []byte("set")
+	n, err := db.SRem(key, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	assert.Nil(t, db.SAdd(key, []byte("a"), []byte("b"), []byte("c")))
+	n, err = db.SRem(key, []byte("a"), []byte("x"), []byte("b"), []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 1, db.SCard(key))
+	n, err = db.SRem(key, []byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 0, db.Exists(key))
+}
+
+func testKhighDBSMove(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer destroyDB(db)
+
+	src, dst := []byte("src"), []byte("dst")
+	assert.Nil(t, db.SAdd(src, []byte("a"), []byte("b")))
+	assert.Nil(t, db.SAdd(dst, []byte("c")))
+
+	ok, err := db.SMove(src, dst, []byte("a"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.False(t, db.SIsMember(src, []byte("a")))
+	assert.True(t, db.SIsMember(dst, []byte("a")))
+	assert.Equal(t, 2, db.SCard(dst))
+
+	// The member is not in the source set.
+	ok, err = db.SMove(src, dst, []byte("a"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.SMove([]byte("missing"), dst, []byte("a"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// The member already exists in the destination set.
+	assert.Nil(t, db.SAdd(src, []byte("c")))
+	ok, err = db.SMove(src, dst, []byte("c"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.False(t, db.SIsMember(src, []byte("c")))
+	assert.Equal(t, 2, db.SCard(dst))
+
+	ok, err = db.SMove(src, src, []byte("b"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, db.SCard(src))
+
+	// The source set is deleted after its last member is moved, and the destination is created.
+	ok, err = db.SMove(src, []byte("new"), []byte("b"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 0, db.Exists(src))
+	dataType, err := db.Type([]byte("new"))
+	assert.Nil(t, err)
+	assert.Equal(t, Set, dataType)
+
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	_, err = db.SMove(dst, []byte("str"), []byte("a"))
+	assert.Equal(t, ErrWrongType, err)
+	assert.True(t, db.SIsMember(dst, []byte("a")))
+}
+
+func testKhighDBSetMemberCollision(t *testing.T, ioType IOType, mode DataIndexMode) {
+	// All the long members collide on the same murmur sum.
+	memberSum = func([]byte) []byte { return []byte{0x2a} }
+	defer func() { memberSum = util.Sum128 }()
+
+	db := newKhighDB(ioType, mode)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("set")
+	m1, m2, m3, m4 := []byte("colliding-member-1"), []byte("colliding-member-2"),
+		[]byte("colliding-member-3"), []byte("colliding-member-4")
+	short := []byte("short")
+	assert.Nil(t, db.SAdd(key, m1, m2, m3, short, m2))
+	assert.Equal(t, 4, db.SCard(key))
+	assert.Equal(t, []bool{true, true, true, true, false}, db.SMIsMember(key, m1, m2, m3, short, m4))
+
+	n, err := db.SRem(key, m2, m4)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []bool{true, false, true}, db.SMIsMember(key, m1, m2, m3))
+	// The member takes the free key in the chain.
+	assert.Nil(t, db.SAdd(key, m4))
+	ok, err := db.SMove(key, []byte("dst"), m3)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	assert.Nil(t, db.Close())
+	db = newKhighDB(ioType, mode)
+
+	members, err := db.SMembers(key)
+	assert.Nil(t, err)
+	sort.Slice(members, func(i, j int) bool { return string(members[i]) < string(members[j]) })
+	assert.Equal(t, [][]byte{m1, m4, short}, members)
+	assert.Equal(t, []bool{true, false, false, true}, db.SMIsMember(key, m1, m2, m3, m4))
+	members, err = db.SMembers([]byte("dst"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{m3}, members)
+}
@@ -0,0 +1,88 @@
+package khighdb
+
+import (
+	"github.com/Khighness/khighdb/data/art"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// IndexMemStats describes the memory held by the indexes of a data type.
+type IndexMemStats struct {
+	// Mode is the index mode of the data type.
+	Mode DataIndexMode
+	// Keys is the number of index nodes.
+	Keys int
+	// KeySize is the total size of keys in index nodes.
+	KeySize int64
+	// ValueSize is the total size of values kept in index nodes, it is always 0 in KeyOnlyMemMode.
+	ValueSize int64
+}
+
+// IndexMemStats returns the memory stats of indexes for every data type.
+// All the index trees are traversed, so it is not supposed to be called frequently.
+func (db *KhighDB) IndexMemStats() map[DataType]*IndexMemStats {
+	stats := make(map[DataType]*IndexMemStats)
+	for dataType := String; dataType < logFileTypeNum; dataType++ {
+		stats[dataType] = &IndexMemStats{Mode: db.options.indexMode(dataType)}
+	}
+
+	db.strIndex.mu.RLock()
+	stats[String].collect(db.strIndex.idxTree)
+	db.strIndex.mu.RUnlock()
+
+	db.listIndex.mu.RLock()
+	for _, idxTree := range db.listIndex.trees {
+		stats[List].collect(idxTree)
+	}
+	db.listIndex.mu.RUnlock()
+
+	db.hashIndex.mu.RLock()
+	for _, idxTree := range db.hashIndex.trees {
+		stats[Hash].collect(idxTree)
+	}
+	db.hashIndex.mu.RUnlock()
+
+	db.setIndex.mu.RLock()
+	for _, idxTree := range db.setIndex.trees {
+		stats[Set].collect(idxTree)
+	}
+	db.setIndex.mu.RUnlock()
+
+	db.zsetIndex.mu.RLock()
+	for _, idxTree := range db.zsetIndex.trees {
+		stats[ZSet].collect(idxTree)
+	}
+	db.zsetIndex.mu.RUnlock()
+
+	db.streamIndex.mu.RLock()
+	for _, idxTree := range db.streamIndex.trees {
+		stats[Stream].collect(idxTree)
+	}
+	db.streamIndex.mu.RUnlock()
+
+	db.jsonIndex.mu.RLock()
+	for _, idxTree := range db.jsonIndex.trees {
+		stats[JSON].collect(idxTree)
+	}
+	db.jsonIndex.mu.RUnlock()
+	return stats
+}
+
+// collect accumulates the stats of all index nodes in the index tree.
+func (s *IndexMemStats) collect(idxTree *art.AdaptiveRadixTree) {
+	iterator := idxTree.Iterator()
+	for iterator.HasNext() {
+		node, err := iterator.Next()
+		if err != nil || node == nil {
+			continue
+		}
+		idxNode, _ := node.Value().(*indexNode)
+		if idxNode == nil {
+			continue
+		}
+		s.Keys++
+		s.KeySize += int64(len(node.Key()))
+		s.ValueSize += int64(len(idxNode.value))
+	}
+}
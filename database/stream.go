@@ -0,0 +1,1010 @@
+package khighdb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Khighness/khighdb/data/art"
+	"github.com/Khighness/khighdb/data/stream"
+	"github.com/Khighness/khighdb/storage"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// A stream is stored as records in its index tree, each record is written with the key
+// encoded by encodeKey(key, subkey) and the subkey is prefixed by the record type:
+//	+-------------+----------------------------------+---------------------------+
+//	| record type |              subkey              |           value           |
+//	+-------------+----------------------------------+---------------------------+
+//	|    entry    |            'e' + ID              |   encoded field-values    |
+//	|    meta     |               'm'                |          last ID          |
+//	|    group    |          'g' + group             |     last delivered ID     |
+//	|  consumer   | 'c' + encodeKey(group, consumer) |           empty           |
+//	|   pending   |    'p' + encodeKey(group, ID)    |   encoded pending entry   |
+//	+-------------+----------------------------------+---------------------------+
+// Every record holds the whole state of its subkey, so the records are replayed and rewritten
+// by gc independently. The meta record keeps the last ID after the last entry is deleted.
+
+const (
+	streamEntryPrefix    byte = 'e'
+	streamMetaPrefix     byte = 'm'
+	streamGroupPrefix    byte = 'g'
+	streamConsumerPrefix byte = 'c'
+	streamPendingPrefix  byte = 'p'
+)
+
+// XTrimStrategy defines the strategy of trimming stream.
+type XTrimStrategy int8
+
+const (
+	// XTrimMaxLen evicts the oldest entries until the stream has at most MaxLen entries.
+	XTrimMaxLen XTrimStrategy = iota
+	// XTrimMinID evicts the entries whose IDs are lower than MinID.
+	XTrimMinID
+)
+
+// XTrimOptions defines the options of XTrim.
+type XTrimOptions struct {
+	Strategy XTrimStrategy
+	MaxLen   int
+	MinID    []byte
+}
+
+// XAddOptions defines the options of XAdd.
+type XAddOptions struct {
+	// ID is the ID of the new entry, it is generated automatically if it is empty or "*".
+	// Only the sequence number is generated if it likes "<ms>-*".
+	ID []byte
+	// NoMkStream makes XAdd not create the stream if it does not exist.
+	NoMkStream bool
+	// Trim trims the stream after the entry is added if it is not nil.
+	Trim *XTrimOptions
+}
+
+// XReadOptions defines the options of XRead and XReadGroup.
+type XReadOptions struct {
+	// Count is the max number of entries returned for each stream, no limit if it is not positive.
+	Count int
+	// Block makes the read block until any entry is available, the timeout elapses or ctx is done.
+	Block bool
+	// Timeout is the timeout of blocking, a zero timeout blocks indefinitely.
+	Timeout time.Duration
+	// NoAck makes XReadGroup not add the delivered entries to the pending entries list.
+	NoAck bool
+}
+
+// XClaimOptions defines the options of XClaim.
+type XClaimOptions struct {
+	// Idle sets the idle time of the claimed entries.
+	Idle time.Duration
+	// Time sets the delivery time in unix milliseconds of the claimed entries, it overrides Idle.
+	Time int64
+	// RetryCount sets the delivery count of the claimed entries if it is not nil.
+	RetryCount *int64
+	// Force creates the pending entries of the IDs not in the pending entries list, as long as
+	// the entries exist in the stream.
+	Force bool
+	// JustID makes XClaim return only the IDs, and the delivery count is not incremented.
+	JustID bool
+}
+
+// XPendingOptions defines the options of the extended form of XPending.
+type XPendingOptions struct {
+	Start, End []byte
+	Count      int
+	// Consumer makes only the pending entries of the consumer returned if it is not empty.
+	Consumer []byte
+	// MinIdle makes only the entries idle for at least MinIdle returned.
+	MinIdle time.Duration
+}
+
+// StreamEntry is an entry of stream.
+type StreamEntry struct {
+	ID stream.ID
+	// Fields likes ['field', 'value', 'field', 'value'...].
+	// It is nil if the entry is deleted but still in the pending entries list.
+	Fields [][]byte
+}
+
+// StreamEntries is the entries read from a stream.
+type StreamEntries struct {
+	Key     []byte
+	Entries []StreamEntry
+}
+
+// XPendingSummary is the summary of the pending entries list of consumer group.
+type XPendingSummary struct {
+	Count           int
+	Lowest, Highest stream.ID
+	// Consumers is the number of pending entries of each consumer.
+	Consumers map[string]int
+}
+
+// XPendingEntry is a pending entry returned by XPendingExt.
+type XPendingEntry struct {
+	ID            stream.ID
+	Consumer      []byte
+	Idle          time.Duration
+	DeliveryCount int64
+}
+
+// XAdd appends the entry with the field-value pairs to the stream stored at key, and returns
+// its ID. The fields likes ['field', 'value', 'field', 'value'...].
+// If the key does not exist, a new stream is created unless NoMkStream is set, in which case
+// ErrKeyNotFound is returned.
+func (db *KhighDB) XAdd(key []byte, opts XAddOptions, fields ...[]byte) (stream.ID, error) {
+	if len(fields) == 0 || len(fields)&1 == 1 {
+		return stream.ID{}, ErrInvalidNumberOfArgs
+	}
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+	defer db.streamIndex.blocking.serve()
+
+	s := db.streamIndex.streams[string(key)]
+	if s == nil && opts.NoMkStream {
+		return stream.ID{}, ErrKeyNotFound
+	}
+	var lastID stream.ID
+	if s != nil {
+		lastID = s.LastID
+	}
+	id, err := nextStreamID(lastID, opts.ID)
+	if err != nil {
+		return stream.ID{}, err
+	}
+	if opts.Trim != nil && opts.Trim.Strategy == XTrimMinID {
+		if _, err = parseStreamID(opts.Trim.MinID, 0); err != nil {
+			return stream.ID{}, err
+		}
+	}
+
+	if s == nil {
+		if s, err = db.xCreateInternal(key); err != nil {
+			return stream.ID{}, err
+		}
+	}
+	idxTree := db.streamIndex.trees[string(key)]
+	if err = db.xPutInternal(idxTree, key, streamEntryKey(id), stream.EncodeFields(fields)); err != nil {
+		return stream.ID{}, err
+	}
+	s.Insert(id)
+	if opts.Trim != nil {
+		if _, err = db.xTrimInternal(key, *opts.Trim); err != nil {
+			return id, err
+		}
+	}
+	db.streamIndex.blocking.signal(key)
+	return id, nil
+}
+
+// XLen returns the number of entries in the stream stored at key.
+func (db *KhighDB) XLen(key []byte) int {
+	db.streamIndex.mu.RLock()
+	defer db.streamIndex.mu.RUnlock()
+
+	if s := db.streamIndex.streams[string(key)]; s != nil {
+		return s.Len()
+	}
+	return 0
+}
+
+// XRange returns the entries of the stream stored at key with IDs between start and end.
+// "-" and "+" are the smallest and largest IDs, the ID prefixed by "(" is exclusive.
+// At most count entries are returned if count is positive.
+func (db *KhighDB) XRange(key, start, end []byte, count int) ([]StreamEntry, error) {
+	return db.xRange(key, start, end, count, false)
+}
+
+// XRevRange is like XRange, but the entries are returned in reverse order, from end to start.
+func (db *KhighDB) XRevRange(key, end, start []byte, count int) ([]StreamEntry, error) {
+	return db.xRange(key, start, end, count, true)
+}
+
+// XDel removes the entries from the stream stored at key, and returns the number of entries
+// removed. The removed entries are still in the pending entries lists of consumer groups.
+func (db *KhighDB) XDel(key []byte, ids ...[]byte) (int, error) {
+	parsed, err := parseStreamIDs(ids)
+	if err != nil {
+		return 0, err
+	}
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	s := db.streamIndex.streams[string(key)]
+	if s == nil {
+		return 0, nil
+	}
+	var removed []stream.ID
+	for _, id := range parsed {
+		if s.Remove(id) {
+			removed = append(removed, id)
+		}
+	}
+	return len(removed), db.xDelEntriesInternal(key, removed)
+}
+
+// XTrim trims the stream stored at key by the strategy, and returns the number of entries removed.
+func (db *KhighDB) XTrim(key []byte, opts XTrimOptions) (int, error) {
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	if db.streamIndex.streams[string(key)] == nil {
+		if opts.Strategy == XTrimMinID {
+			if _, err := parseStreamID(opts.MinID, 0); err != nil {
+				return 0, err
+			}
+		}
+		return 0, nil
+	}
+	return db.xTrimInternal(key, opts)
+}
+
+// XRead returns the entries with IDs greater than the given ones from the streams stored at keys,
+// only the streams having such entries are returned. The ID "$" is the last ID of the stream.
+// If Block is set and no entry is available, it blocks until an entry is added to any of the
+// streams, the timeout elapses or ctx is done, and then only one stream is returned.
+// It returns nil if no entry is available or the timeout elapses.
+func (db *KhighDB) XRead(ctx context.Context, opts XReadOptions, keys, ids [][]byte) ([]StreamEntries, error) {
+	if len(keys) == 0 || len(keys) != len(ids) {
+		return nil, ErrInvalidNumberOfArgs
+	}
+	starts := make([]stream.ID, len(keys))
+	db.streamIndex.mu.RLock()
+	for i, id := range ids {
+		if string(id) == "$" {
+			if s := db.streamIndex.streams[string(keys[i])]; s != nil {
+				starts[i] = s.LastID
+			}
+			continue
+		}
+		start, err := parseStreamID(id, 0)
+		if err != nil {
+			db.streamIndex.mu.RUnlock()
+			return nil, err
+		}
+		starts[i] = start
+	}
+
+	var result []StreamEntries
+	for i, key := range keys {
+		entries, err := db.xReadInternal(key, starts[i], opts.Count)
+		if err != nil {
+			db.streamIndex.mu.RUnlock()
+			return nil, err
+		}
+		if len(entries) > 0 {
+			result = append(result, StreamEntries{Key: key, Entries: entries})
+		}
+	}
+	db.streamIndex.mu.RUnlock()
+	if len(result) > 0 || !opts.Block {
+		return result, nil
+	}
+
+	// The result is set by the client itself, or by the one serving it before it is woken.
+	_, _, err := db.blockingPop(ctx, opts.Timeout, Stream, keys, func(key []byte) ([]byte, error) {
+		for i := range keys {
+			if string(keys[i]) != string(key) {
+				continue
+			}
+			entries, err := db.xReadInternal(key, starts[i], opts.Count)
+			if err != nil || len(entries) == 0 {
+				return nil, err
+			}
+			result = []StreamEntries{{Key: key, Entries: entries}}
+			return key, nil
+		}
+		return nil, nil
+	})
+	return result, err
+}
+
+// XReadGroup reads the entries from the streams stored at keys as consumer of the consumer group,
+// the consumer is created if it does not exist. The ID ">" reads the entries never delivered to
+// the group, which are added to the pending entries list unless NoAck is set. Other IDs read the
+// pending entries of the consumer with IDs greater than them.
+// If Block is set and no entry is available for the ID ">", it blocks like XRead.
+// ErrStreamNoGroup is returned if any stream or the consumer group does not exist.
+func (db *KhighDB) XReadGroup(ctx context.Context, group, consumer []byte, opts XReadOptions,
+	keys, ids [][]byte) ([]StreamEntries, error) {
+	if len(keys) == 0 || len(keys) != len(ids) {
+		return nil, ErrInvalidNumberOfArgs
+	}
+	starts := make([]*stream.ID, len(keys))
+	history := false
+	for i, id := range ids {
+		if string(id) == ">" {
+			continue
+		}
+		start, err := parseStreamID(id, 0)
+		if err != nil {
+			return nil, err
+		}
+		starts[i], history = &start, true
+	}
+
+	db.streamIndex.mu.Lock()
+	for _, key := range keys {
+		if db.streamGroup(key, group) == nil {
+			db.streamIndex.mu.Unlock()
+			return nil, ErrStreamNoGroup
+		}
+	}
+	var result []StreamEntries
+	for i, key := range keys {
+		entries, err := db.xReadGroupInternal(key, group, consumer, starts[i], opts)
+		if err != nil {
+			db.streamIndex.mu.Unlock()
+			return nil, err
+		}
+		// The stream is returned even if it has no pending entry to read, like Redis.
+		if len(entries) > 0 || starts[i] != nil {
+			result = append(result, StreamEntries{Key: key, Entries: entries})
+		}
+	}
+	db.streamIndex.mu.Unlock()
+	if len(result) > 0 || history || !opts.Block {
+		return result, nil
+	}
+
+	_, _, err := db.blockingPop(ctx, opts.Timeout, Stream, keys, func(key []byte) ([]byte, error) {
+		entries, err := db.xReadGroupInternal(key, group, consumer, nil, opts)
+		if err != nil || len(entries) == 0 {
+			return nil, err
+		}
+		result = []StreamEntries{{Key: key, Entries: entries}}
+		return key, nil
+	})
+	return result, err
+}
+
+// XGroupCreate creates the consumer group of the stream stored at key, which delivers the entries
+// with IDs greater than id. The ID "$" is the last ID of the stream.
+// If the key does not exist, an empty stream is created if mkStream is true, otherwise
+// ErrKeyNotFound is returned. ErrStreamGroupExists is returned if the group already exists.
+func (db *KhighDB) XGroupCreate(key, group, id []byte, mkStream bool) error {
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	s := db.streamIndex.streams[string(key)]
+	var lastID stream.ID
+	if string(id) == "$" {
+		if s != nil {
+			lastID = s.LastID
+		}
+	} else {
+		var err error
+		if lastID, err = parseStreamID(id, 0); err != nil {
+			return err
+		}
+	}
+	if s == nil {
+		if !mkStream {
+			return ErrKeyNotFound
+		}
+		var err error
+		if s, err = db.xCreateInternal(key); err != nil {
+			return err
+		}
+	}
+	if s.Groups[string(group)] != nil {
+		return ErrStreamGroupExists
+	}
+
+	idxTree := db.streamIndex.trees[string(key)]
+	if err := db.xPutInternal(idxTree, key, streamGroupKey(group), lastID.Bytes()); err != nil {
+		return err
+	}
+	s.Groups[string(group)] = stream.NewGroup(lastID)
+	return nil
+}
+
+// XGroupSetID sets the last delivered ID of the consumer group. The ID "$" is the last ID of the stream.
+func (db *KhighDB) XGroupSetID(key, group, id []byte) error {
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	g := db.streamGroup(key, group)
+	if g == nil {
+		return ErrStreamNoGroup
+	}
+	lastID := db.streamIndex.streams[string(key)].LastID
+	if string(id) != "$" {
+		var err error
+		if lastID, err = parseStreamID(id, 0); err != nil {
+			return err
+		}
+	}
+	idxTree := db.streamIndex.trees[string(key)]
+	if err := db.xPutInternal(idxTree, key, streamGroupKey(group), lastID.Bytes()); err != nil {
+		return err
+	}
+	g.LastID = lastID
+	return nil
+}
+
+// XGroupDestroy removes the consumer group with its consumers and pending entries list.
+// It returns false if the group does not exist.
+func (db *KhighDB) XGroupDestroy(key, group []byte) (bool, error) {
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	g := db.streamGroup(key, group)
+	if g == nil {
+		return false, nil
+	}
+	idxTree := db.streamIndex.trees[string(key)]
+	for id := range g.Pending {
+		if err := db.xDelInternal(idxTree, key, db.streamPendingKey(group, id)); err != nil {
+			return false, err
+		}
+	}
+	for consumer := range g.Consumers {
+		if err := db.xDelInternal(idxTree, key, db.streamConsumerKey(group, []byte(consumer))); err != nil {
+			return false, err
+		}
+	}
+	if err := db.xDelInternal(idxTree, key, streamGroupKey(group)); err != nil {
+		return false, err
+	}
+	delete(db.streamIndex.streams[string(key)].Groups, string(group))
+	return true, nil
+}
+
+// XGroupCreateConsumer creates the consumer in the consumer group, it returns false if the
+// consumer already exists.
+func (db *KhighDB) XGroupCreateConsumer(key, group, consumer []byte) (bool, error) {
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	g := db.streamGroup(key, group)
+	if g == nil {
+		return false, ErrStreamNoGroup
+	}
+	if g.Consumers[string(consumer)] != nil {
+		return false, nil
+	}
+	_, err := db.xConsumerInternal(key, group, consumer)
+	return err == nil, err
+}
+
+// XGroupDelConsumer removes the consumer from the consumer group, and returns the number of
+// pending entries it had, which are removed too.
+func (db *KhighDB) XGroupDelConsumer(key, group, consumer []byte) (int, error) {
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	g := db.streamGroup(key, group)
+	if g == nil {
+		return 0, ErrStreamNoGroup
+	}
+	if g.Consumers[string(consumer)] == nil {
+		return 0, nil
+	}
+	idxTree := db.streamIndex.trees[string(key)]
+	var count int
+	for id, pe := range g.Pending {
+		if pe.Consumer != string(consumer) {
+			continue
+		}
+		if err := db.xDelInternal(idxTree, key, db.streamPendingKey(group, id)); err != nil {
+			return count, err
+		}
+		delete(g.Pending, id)
+		count++
+	}
+	if err := db.xDelInternal(idxTree, key, db.streamConsumerKey(group, consumer)); err != nil {
+		return count, err
+	}
+	delete(g.Consumers, string(consumer))
+	return count, nil
+}
+
+// XAck removes the entries from the pending entries list of the consumer group, and returns
+// the number of entries acknowledged.
+func (db *KhighDB) XAck(key, group []byte, ids ...[]byte) (int, error) {
+	parsed, err := parseStreamIDs(ids)
+	if err != nil {
+		return 0, err
+	}
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	g := db.streamGroup(key, group)
+	if g == nil {
+		return 0, nil
+	}
+	idxTree := db.streamIndex.trees[string(key)]
+	var count int
+	for _, id := range parsed {
+		if g.Pending[id] == nil {
+			continue
+		}
+		if err = db.xDelInternal(idxTree, key, db.streamPendingKey(group, id)); err != nil {
+			return count, err
+		}
+		delete(g.Pending, id)
+		count++
+	}
+	return count, nil
+}
+
+// XPending returns the summary of the pending entries list of the consumer group.
+func (db *KhighDB) XPending(key, group []byte) (*XPendingSummary, error) {
+	db.streamIndex.mu.RLock()
+	defer db.streamIndex.mu.RUnlock()
+
+	g := db.streamGroup(key, group)
+	if g == nil {
+		return nil, ErrStreamNoGroup
+	}
+	summary := &XPendingSummary{Count: len(g.Pending), Consumers: g.PendingCount()}
+	ids := g.PendingIDs(stream.MinID, stream.MaxID, 0, "")
+	if len(ids) > 0 {
+		summary.Lowest, summary.Highest = ids[0], ids[len(ids)-1]
+	}
+	return summary, nil
+}
+
+// XPendingExt returns the pending entries of the consumer group with IDs between Start and End
+// in ascending order, see XRange for the format of IDs. At most Count entries are returned if
+// Count is positive.
+func (db *KhighDB) XPendingExt(key, group []byte, opts XPendingOptions) ([]XPendingEntry, error) {
+	start, err := stream.ParseRangeID(string(opts.Start), false)
+	if err != nil {
+		return nil, ErrInvalidStreamID
+	}
+	end, err := stream.ParseRangeID(string(opts.End), true)
+	if err != nil {
+		return nil, ErrInvalidStreamID
+	}
+	db.streamIndex.mu.RLock()
+	defer db.streamIndex.mu.RUnlock()
+
+	g := db.streamGroup(key, group)
+	if g == nil {
+		return nil, ErrStreamNoGroup
+	}
+	now := nowMilli()
+	var entries []XPendingEntry
+	for _, id := range g.PendingIDs(start, end, 0, string(opts.Consumer)) {
+		pe := g.Pending[id]
+		idle := time.Duration(now-pe.DeliveryTime) * time.Millisecond
+		if idle < opts.MinIdle {
+			continue
+		}
+		entries = append(entries, XPendingEntry{
+			ID:            id,
+			Consumer:      []byte(pe.Consumer),
+			Idle:          idle,
+			DeliveryCount: pe.DeliveryCount,
+		})
+		if opts.Count > 0 && len(entries) == opts.Count {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// XClaim changes the ownership of the pending entries idle for at least minIdle to the consumer,
+// and returns the claimed entries. The pending entries of the entries deleted from the stream
+// are removed instead of being claimed.
+func (db *KhighDB) XClaim(key, group, consumer []byte, minIdle time.Duration, ids [][]byte,
+	opts XClaimOptions) ([]StreamEntry, error) {
+	parsed, err := parseStreamIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	g := db.streamGroup(key, group)
+	if g == nil {
+		return nil, ErrStreamNoGroup
+	}
+	s, idxTree := db.streamIndex.streams[string(key)], db.streamIndex.trees[string(key)]
+	now := nowMilli()
+	deliveryTime := now - opts.Idle.Milliseconds()
+	if opts.Time != 0 {
+		deliveryTime = opts.Time
+	}
+	if _, err = db.xConsumerInternal(key, group, consumer); err != nil {
+		return nil, err
+	}
+
+	var claimed []stream.ID
+	for _, id := range parsed {
+		pe := g.Pending[id]
+		exists := s.Contains(id)
+		if pe == nil {
+			if !opts.Force || !exists {
+				continue
+			}
+			pe = &stream.PendingEntry{DeliveryTime: now, DeliveryCount: 1}
+		} else if !exists {
+			if err = db.xDelInternal(idxTree, key, db.streamPendingKey(group, id)); err != nil {
+				return nil, err
+			}
+			delete(g.Pending, id)
+			continue
+		} else {
+			if time.Duration(now-pe.DeliveryTime)*time.Millisecond < minIdle {
+				continue
+			}
+			if !opts.JustID {
+				pe.DeliveryCount++
+			}
+		}
+		pe.Consumer, pe.DeliveryTime = string(consumer), deliveryTime
+		if opts.RetryCount != nil {
+			pe.DeliveryCount = *opts.RetryCount
+		}
+		if err = db.xPutInternal(idxTree, key, db.streamPendingKey(group, id), pe.Encode()); err != nil {
+			return nil, err
+		}
+		g.Pending[id] = pe
+		claimed = append(claimed, id)
+	}
+
+	if opts.JustID {
+		entries := make([]StreamEntry, len(claimed))
+		for i, id := range claimed {
+			entries[i].ID = id
+		}
+		return entries, nil
+	}
+	return db.xEntries(idxTree, claimed)
+}
+
+// xRange returns the entries between start and end, in reverse order if reverse is true.
+func (db *KhighDB) xRange(key, start, end []byte, count int, reverse bool) ([]StreamEntry, error) {
+	startID, err := stream.ParseRangeID(string(start), false)
+	if err != nil {
+		return nil, ErrInvalidStreamID
+	}
+	endID, err := stream.ParseRangeID(string(end), true)
+	if err != nil {
+		return nil, ErrInvalidStreamID
+	}
+	db.streamIndex.mu.RLock()
+	defer db.streamIndex.mu.RUnlock()
+
+	s := db.streamIndex.streams[string(key)]
+	if s == nil {
+		return nil, nil
+	}
+	return db.xEntries(db.streamIndex.trees[string(key)], s.Range(startID, endID, count, reverse))
+}
+
+// xReadInternal returns the entries with IDs greater than start.
+func (db *KhighDB) xReadInternal(key []byte, start stream.ID, count int) ([]StreamEntry, error) {
+	s := db.streamIndex.streams[string(key)]
+	if s == nil {
+		return nil, nil
+	}
+	return db.xEntries(db.streamIndex.trees[string(key)], s.After(start, count))
+}
+
+// xReadGroupInternal reads the entries as consumer of the consumer group. The entries never
+// delivered are read if start is nil, otherwise the pending entries of the consumer with IDs
+// greater than start are read.
+func (db *KhighDB) xReadGroupInternal(key, group, consumer []byte, start *stream.ID,
+	opts XReadOptions) ([]StreamEntry, error) {
+	g := db.streamGroup(key, group)
+	if g == nil {
+		return nil, ErrStreamNoGroup
+	}
+	idxTree := db.streamIndex.trees[string(key)]
+	if _, err := db.xConsumerInternal(key, group, consumer); err != nil {
+		return nil, err
+	}
+
+	if start != nil {
+		next, ok := start.Next()
+		if !ok {
+			return nil, nil
+		}
+		return db.xEntries(idxTree, g.PendingIDs(next, stream.MaxID, opts.Count, string(consumer)))
+	}
+
+	ids := db.streamIndex.streams[string(key)].After(g.LastID, opts.Count)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	lastID := ids[len(ids)-1]
+	if err := db.xPutInternal(idxTree, key, streamGroupKey(group), lastID.Bytes()); err != nil {
+		return nil, err
+	}
+	g.LastID = lastID
+	if !opts.NoAck {
+		now := nowMilli()
+		for _, id := range ids {
+			pe := &stream.PendingEntry{Consumer: string(consumer), DeliveryTime: now, DeliveryCount: 1}
+			if err := db.xPutInternal(idxTree, key, db.streamPendingKey(group, id), pe.Encode()); err != nil {
+				return nil, err
+			}
+			g.Pending[id] = pe
+		}
+	}
+	return db.xEntries(idxTree, ids)
+}
+
+// xTrimInternal trims the existing stream by the strategy, and returns the number of entries removed.
+func (db *KhighDB) xTrimInternal(key []byte, opts XTrimOptions) (int, error) {
+	s := db.streamIndex.streams[string(key)]
+	var removed []stream.ID
+	switch opts.Strategy {
+	case XTrimMaxLen:
+		removed = s.TrimMaxLen(opts.MaxLen)
+	case XTrimMinID:
+		minID, err := parseStreamID(opts.MinID, 0)
+		if err != nil {
+			return 0, err
+		}
+		removed = s.TrimMinID(minID)
+	}
+	return len(removed), db.xDelEntriesInternal(key, removed)
+}
+
+// xCreateInternal creates an empty stream with its meta record.
+func (db *KhighDB) xCreateInternal(key []byte) (*stream.Stream, error) {
+	if err := db.claimKey(key, Stream); err != nil {
+		return nil, err
+	}
+	idxTree := art.NewART()
+	if err := db.xPutInternal(idxTree, key, []byte{streamMetaPrefix}, stream.MinID.Bytes()); err != nil {
+		return nil, err
+	}
+	s := stream.New()
+	db.streamIndex.trees[string(key)] = idxTree
+	db.streamIndex.streams[string(key)] = s
+	return s, nil
+}
+
+// xConsumerInternal returns the consumer of the existing consumer group, which is created if it
+// does not exist. The seen time of the consumer is updated.
+func (db *KhighDB) xConsumerInternal(key, group, consumer []byte) (*stream.Consumer, error) {
+	g := db.streamGroup(key, group)
+	c := g.Consumers[string(consumer)]
+	if c == nil {
+		idxTree := db.streamIndex.trees[string(key)]
+		if err := db.xPutInternal(idxTree, key, db.streamConsumerKey(group, consumer), nil); err != nil {
+			return nil, err
+		}
+		c = &stream.Consumer{}
+		g.Consumers[string(consumer)] = c
+	}
+	c.SeenTime = nowMilli()
+	return c, nil
+}
+
+// xDelEntriesInternal writes the delete records of the entries removed from the stream. The meta
+// record is updated if the last entry is removed, so that the last ID is kept after gc.
+func (db *KhighDB) xDelEntriesInternal(key []byte, ids []stream.ID) error {
+	s, idxTree := db.streamIndex.streams[string(key)], db.streamIndex.trees[string(key)]
+	for _, id := range ids {
+		if err := db.xDelInternal(idxTree, key, streamEntryKey(id)); err != nil {
+			return err
+		}
+		if id == s.LastID {
+			if err := db.xPutInternal(idxTree, key, []byte{streamMetaPrefix}, id.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// xPutInternal writes the record of the stream stored at key.
+func (db *KhighDB) xPutInternal(idxTree *art.AdaptiveRadixTree, key, subkey, value []byte) error {
+	ent := &storage.LogEntry{Key: db.encodeKey(key, subkey), Value: value}
+	pos, err := db.writeLogEntry(ent, Stream)
+	if err != nil {
+		return err
+	}
+
+	entry := &storage.LogEntry{Key: subkey, Value: value}
+	return db.updateIndexTree(idxTree, entry, pos, true, Stream)
+}
+
+// xDelInternal removes the record of the stream stored at key.
+func (db *KhighDB) xDelInternal(idxTree *art.AdaptiveRadixTree, key, subkey []byte) error {
+	ent := &storage.LogEntry{Key: db.encodeKey(key, subkey), Type: storage.TypeDelete}
+	if _, err := db.writeLogEntry(ent, Stream); err != nil {
+		return err
+	}
+
+	val, updated := idxTree.Delete(subkey)
+	db.sendDiscard(val, updated, Stream)
+	return nil
+}
+
+// xEntries returns the entries of the IDs, the fields of the deleted entries are nil.
+func (db *KhighDB) xEntries(idxTree *art.AdaptiveRadixTree, ids []stream.ID) ([]StreamEntry, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	entries := make([]StreamEntry, len(ids))
+	for i, id := range ids {
+		entries[i].ID = id
+		val, err := db.getVal(idxTree, streamEntryKey(id), Stream)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entries[i].Fields, err = stream.DecodeFields(val); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// streamGroup returns the consumer group of the stream stored at key, nil is returned if the
+// stream or the group does not exist.
+func (db *KhighDB) streamGroup(key, group []byte) *stream.Group {
+	s := db.streamIndex.streams[string(key)]
+	if s == nil {
+		return nil
+	}
+	return s.Groups[string(group)]
+}
+
+// loadStreamRecord applies the record of the stream when loading index.
+func (db *KhighDB) loadStreamRecord(s *stream.Stream, subkey, value []byte) error {
+	if len(subkey) == 0 {
+		return stream.ErrInvalidEncoding
+	}
+	switch subkey[0] {
+	case streamEntryPrefix:
+		id, err := stream.DecodeID(subkey[1:])
+		if err != nil {
+			return err
+		}
+		s.Insert(id)
+	case streamMetaPrefix:
+		lastID, err := stream.DecodeID(value)
+		if err != nil {
+			return err
+		}
+		if s.LastID.Less(lastID) {
+			s.LastID = lastID
+		}
+	case streamGroupPrefix:
+		lastID, err := stream.DecodeID(value)
+		if err != nil {
+			return err
+		}
+		loadStreamGroup(s, subkey[1:]).LastID = lastID
+	case streamConsumerPrefix:
+		group, consumer := db.decodeKey(subkey[1:])
+		loadStreamGroup(s, group).Consumers[string(consumer)] = &stream.Consumer{SeenTime: nowMilli()}
+	case streamPendingPrefix:
+		group, idBuf := db.decodeKey(subkey[1:])
+		id, err := stream.DecodeID(idBuf)
+		if err != nil {
+			return err
+		}
+		pe, err := stream.DecodePendingEntry(value)
+		if err != nil {
+			return err
+		}
+		loadStreamGroup(s, group).Pending[id] = pe
+	}
+	return nil
+}
+
+// unloadStreamRecord reverts the record of the stream deleted when loading index.
+func (db *KhighDB) unloadStreamRecord(s *stream.Stream, subkey []byte) {
+	if len(subkey) == 0 {
+		return
+	}
+	switch subkey[0] {
+	case streamEntryPrefix:
+		if id, err := stream.DecodeID(subkey[1:]); err == nil {
+			s.Remove(id)
+		}
+	case streamGroupPrefix:
+		delete(s.Groups, string(subkey[1:]))
+	case streamConsumerPrefix:
+		group, consumer := db.decodeKey(subkey[1:])
+		if g := s.Groups[string(group)]; g != nil {
+			delete(g.Consumers, string(consumer))
+		}
+	case streamPendingPrefix:
+		group, idBuf := db.decodeKey(subkey[1:])
+		id, err := stream.DecodeID(idBuf)
+		if g := s.Groups[string(group)]; g != nil && err == nil {
+			delete(g.Pending, id)
+		}
+	}
+}
+
+// loadStreamGroup returns the consumer group when loading index, the records of a group may be
+// loaded before the group record after gc, so the group is created if it does not exist.
+func loadStreamGroup(s *stream.Stream, group []byte) *stream.Group {
+	g := s.Groups[string(group)]
+	if g == nil {
+		g = stream.NewGroup(stream.MinID)
+		s.Groups[string(group)] = g
+	}
+	return g
+}
+
+func (db *KhighDB) streamConsumerKey(group, consumer []byte) []byte {
+	return append([]byte{streamConsumerPrefix}, db.encodeKey(group, consumer)...)
+}
+
+func (db *KhighDB) streamPendingKey(group []byte, id stream.ID) []byte {
+	return append([]byte{streamPendingPrefix}, db.encodeKey(group, id.Bytes())...)
+}
+
+func streamEntryKey(id stream.ID) []byte {
+	return append([]byte{streamEntryPrefix}, id.Bytes()...)
+}
+
+func streamGroupKey(group []byte) []byte {
+	return append([]byte{streamGroupPrefix}, group...)
+}
+
+// nextStreamID returns the ID of the new entry added after lastID, see XAddOptions for the
+// format of id.
+func nextStreamID(lastID stream.ID, id []byte) (stream.ID, error) {
+	var next stream.ID
+	var err error
+	switch {
+	case len(id) == 0 || string(id) == "*":
+		next, err = stream.NextID(lastID, uint64(nowMilli()), nil)
+	case len(id) > 2 && string(id[len(id)-2:]) == "-*":
+		var ms stream.ID
+		if ms, err = parseStreamID(id[:len(id)-2], 0); err != nil {
+			return stream.ID{}, err
+		}
+		next, err = stream.NextID(lastID, 0, &ms.Ms)
+	default:
+		if next, err = parseStreamID(id, 0); err != nil {
+			return stream.ID{}, err
+		}
+		if next == stream.MinID {
+			return stream.ID{}, ErrStreamIDZero
+		}
+		if !lastID.Less(next) {
+			return stream.ID{}, ErrStreamIDTooSmall
+		}
+	}
+	switch err {
+	case stream.ErrIDTooSmall:
+		return stream.ID{}, ErrStreamIDTooSmall
+	case stream.ErrIDExhausted:
+		return stream.ID{}, ErrStreamIDExhausted
+	}
+	return next, err
+}
+
+// parseStreamID parses the ID like "<ms>-<seq>", the sequence number is missingSeq if it is omitted.
+func parseStreamID(id []byte, missingSeq uint64) (stream.ID, error) {
+	parsed, err := stream.ParseID(string(id), missingSeq)
+	if err != nil {
+		return stream.ID{}, ErrInvalidStreamID
+	}
+	return parsed, nil
+}
+
+func parseStreamIDs(ids [][]byte) ([]stream.ID, error) {
+	parsed := make([]stream.ID, len(ids))
+	for i, id := range ids {
+		var err error
+		if parsed[i], err = parseStreamID(id, 0); err != nil {
+			return nil, err
+		}
+	}
+	return parsed, nil
+}
+
+// nowMilli returns the current unix time in milliseconds.
+func nowMilli() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,599 @@
+package khighdb
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Khighness/khighdb/data/stream"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+func TestKhighDB_XAdd(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBXAdd(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBXAdd(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBXAdd(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_XRange(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("stream")
+	for i := 1; i <= 5; i++ {
+		_, err := db.XAdd(key, XAddOptions{ID: []byte(fmt.Sprintf("%d-1", i))}, []byte("i"), []byte(fmt.Sprint(i)))
+		assert.Nil(t, err)
+	}
+
+	tests := []struct {
+		name       string
+		start, end string
+		count      int
+		reverse    bool
+		ids        []string
+	}{
+		{"all", "-", "+", 0, false, []string{"1-1", "2-1", "3-1", "4-1", "5-1"}},
+		{"count", "-", "+", 2, false, []string{"1-1", "2-1"}},
+		{"ms-only", "2", "4", 0, false, []string{"2-1", "3-1", "4-1"}},
+		{"exclusive", "(2-1", "(4-1", 0, false, []string{"3-1"}},
+		{"reverse", "2", "+", 2, true, []string{"5-1", "4-1"}},
+		{"empty", "6", "+", 0, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entries []StreamEntry
+			var err error
+			if tt.reverse {
+				entries, err = db.XRevRange(key, []byte(tt.end), []byte(tt.start), tt.count)
+			} else {
+				entries, err = db.XRange(key, []byte(tt.start), []byte(tt.end), tt.count)
+			}
+			assert.Nil(t, err)
+			var ids []string
+			for _, entry := range entries {
+				ids = append(ids, entry.ID.String())
+				assert.Equal(t, []byte(fmt.Sprint(entry.ID.Ms)), entry.Fields[1])
+			}
+			assert.Equal(t, tt.ids, ids)
+		})
+	}
+
+	_, err := db.XRange(key, []byte("a"), []byte("+"), 0)
+	assert.Equal(t, ErrInvalidStreamID, err)
+	entries, err := db.XRange([]byte("missing"), []byte("-"), []byte("+"), 0)
+	assert.Nil(t, err)
+	assert.Nil(t, entries)
+}
+
+func TestKhighDB_XTrim(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("stream")
+	for i := 1; i <= 10; i++ {
+		_, err := db.XAdd(key, XAddOptions{ID: []byte(fmt.Sprint(i))}, []byte("f"), []byte("v"))
+		assert.Nil(t, err)
+	}
+
+	n, err := db.XTrim(key, XTrimOptions{Strategy: XTrimMaxLen, MaxLen: 8})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = db.XTrim(key, XTrimOptions{Strategy: XTrimMinID, MinID: []byte("5")})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	_, err = db.XTrim(key, XTrimOptions{Strategy: XTrimMinID, MinID: []byte("x")})
+	assert.Equal(t, ErrInvalidStreamID, err)
+	assert.Equal(t, 6, db.XLen(key))
+
+	// Trimmed when adding.
+	_, err = db.XAdd(key, XAddOptions{Trim: &XTrimOptions{Strategy: XTrimMaxLen, MaxLen: 3}}, []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, db.XLen(key))
+	entries, err := db.XRange(key, []byte("-"), []byte("+"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "9-0", entries[0].ID.String())
+
+	n, err = db.XDel(key, []byte("9"), []byte("9"), []byte("100"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	_, err = db.XDel(key, []byte("bad"))
+	assert.Equal(t, ErrInvalidStreamID, err)
+
+	// The empty stream still exists.
+	n, err = db.XTrim(key, XTrimOptions{Strategy: XTrimMaxLen})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 0, db.XLen(key))
+	assert.Equal(t, 1, db.Exists(key))
+}
+
+func TestKhighDB_XRead(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer func() { destroyDB(db) }()
+
+	s1, s2 := []byte("s1"), []byte("s2")
+	_, err := db.XAdd(s1, XAddOptions{ID: []byte("1-1")}, []byte("a"), []byte("1"))
+	assert.Nil(t, err)
+	_, err = db.XAdd(s1, XAddOptions{ID: []byte("2-1")}, []byte("b"), []byte("2"))
+	assert.Nil(t, err)
+
+	result, err := db.XRead(context.Background(), XReadOptions{Count: 1}, [][]byte{s1, s2}, [][]byte{[]byte("0"), []byte("0")})
+	assert.Nil(t, err)
+	assert.Equal(t, []StreamEntries{{Key: s1, Entries: []StreamEntry{
+		{ID: stream.ID{Ms: 1, Seq: 1}, Fields: [][]byte{[]byte("a"), []byte("1")}},
+	}}}, result)
+	result, err = db.XRead(context.Background(), XReadOptions{}, [][]byte{s1}, [][]byte{[]byte("$")})
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+	_, err = db.XRead(context.Background(), XReadOptions{}, [][]byte{s1}, [][]byte{[]byte("x")})
+	assert.Equal(t, ErrInvalidStreamID, err)
+	_, err = db.XRead(context.Background(), XReadOptions{}, [][]byte{s1}, nil)
+	assert.Equal(t, ErrInvalidNumberOfArgs, err)
+
+	// Timeout.
+	result, err = db.XRead(context.Background(), XReadOptions{Block: true, Timeout: 20 * time.Millisecond},
+		[][]byte{s1, s2}, [][]byte{[]byte("$"), []byte("$")})
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+
+	// All the blocked clients are woken by a new entry, even if the stream did not exist.
+	results := make(chan []StreamEntries, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			result, err := db.XRead(context.Background(), XReadOptions{Block: true},
+				[][]byte{s1, s2}, [][]byte{[]byte("$"), []byte("$")})
+			assert.Nil(t, err)
+			results <- result
+		}()
+		waitStreamBlocked(db, "s2", i+1)
+	}
+	id, err := db.XAdd(s2, XAddOptions{}, []byte("c"), []byte("3"))
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, []StreamEntries{{Key: s2, Entries: []StreamEntry{
+			{ID: id, Fields: [][]byte{[]byte("c"), []byte("3")}},
+		}}}, <-results)
+	}
+	assert.Empty(t, db.streamIndex.blocking.clients)
+
+	// The blocked client is woken when db is closed.
+	go func() {
+		_, err := db.XRead(context.Background(), XReadOptions{Block: true}, [][]byte{s1}, [][]byte{[]byte("$")})
+		assert.Equal(t, ErrDBClosed, err)
+		results <- nil
+	}()
+	waitStreamBlocked(db, "s1", 1)
+	assert.Nil(t, db.Close())
+	assert.Nil(t, <-results)
+	db, err = Open(db.options)
+	assert.Nil(t, err)
+}
+
+func TestKhighDB_XReadGroup(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBXReadGroup(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBXReadGroup(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBXReadGroup(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_XReadGroupBlocking(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key, group := []byte("stream"), []byte("group")
+	assert.Nil(t, db.XGroupCreate(key, group, []byte("$"), true))
+
+	// Only one of the consumers gets the new entry.
+	results := make(chan []StreamEntries, 2)
+	for i := 0; i < 2; i++ {
+		go func(i int) {
+			result, err := db.XReadGroup(context.Background(), group, []byte(fmt.Sprint("consumer-", i)),
+				XReadOptions{Block: true, Timeout: 200 * time.Millisecond}, [][]byte{key}, [][]byte{[]byte(">")})
+			assert.Nil(t, err)
+			results <- result
+		}(i)
+		waitStreamBlocked(db, "stream", i+1)
+	}
+	id, err := db.XAdd(key, XAddOptions{}, []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	var got int
+	for i := 0; i < 2; i++ {
+		if result := <-results; result != nil {
+			got++
+			assert.Equal(t, id, result[0].Entries[0].ID)
+		}
+	}
+	assert.Equal(t, 1, got)
+
+	// The blocked consumer gets an error if the group is destroyed.
+	go func() {
+		_, err := db.XReadGroup(context.Background(), group, []byte("consumer"), XReadOptions{Block: true},
+			[][]byte{key}, [][]byte{[]byte(">")})
+		assert.Equal(t, ErrStreamNoGroup, err)
+		results <- nil
+	}()
+	waitStreamBlocked(db, "stream", 1)
+	destroyed, err := db.XGroupDestroy(key, group)
+	assert.Nil(t, err)
+	assert.True(t, destroyed)
+	_, err = db.XAdd(key, XAddOptions{}, []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	assert.Nil(t, <-results)
+}
+
+func TestKhighDB_XClaim(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key, group := []byte("stream"), []byte("group")
+	alice, bob := []byte("alice"), []byte("bob")
+	for i := 1; i <= 3; i++ {
+		_, err := db.XAdd(key, XAddOptions{ID: []byte(fmt.Sprint(i))}, []byte("f"), []byte(fmt.Sprint(i)))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.XGroupCreate(key, group, []byte("0"), false))
+	_, err := db.XReadGroup(context.Background(), group, alice, XReadOptions{Count: 2}, [][]byte{key}, [][]byte{[]byte(">")})
+	assert.Nil(t, err)
+
+	// The entries are not idle enough.
+	entries, err := db.XClaim(key, group, bob, time.Hour, [][]byte{[]byte("1"), []byte("2")}, XClaimOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+
+	entries, err = db.XClaim(key, group, bob, 0, [][]byte{[]byte("1"), []byte("3")}, XClaimOptions{Idle: time.Hour})
+	assert.Nil(t, err)
+	assert.Equal(t, []StreamEntry{{ID: stream.ID{Ms: 1}, Fields: [][]byte{[]byte("f"), []byte("1")}}}, entries)
+	pending, err := db.XPendingExt(key, group, XPendingOptions{Start: []byte("-"), End: []byte("+"), MinIdle: time.Minute})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pending))
+	assert.Equal(t, []byte("bob"), pending[0].Consumer)
+	assert.Equal(t, int64(2), pending[0].DeliveryCount)
+
+	// FORCE creates the pending entry, JUSTID does not increment the delivery count.
+	retry := int64(5)
+	entries, err = db.XClaim(key, group, bob, 0, [][]byte{[]byte("2"), []byte("3")},
+		XClaimOptions{Force: true, JustID: true, RetryCount: &retry})
+	assert.Nil(t, err)
+	assert.Equal(t, []StreamEntry{{ID: stream.ID{Ms: 2}}, {ID: stream.ID{Ms: 3}}}, entries)
+	pending, err = db.XPendingExt(key, group, XPendingOptions{Start: []byte("2"), End: []byte("+"), Count: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bob"), pending[0].Consumer)
+	assert.Equal(t, int64(5), pending[0].DeliveryCount)
+
+	// The pending entry of the deleted entry is removed.
+	_, err = db.XDel(key, []byte("2"))
+	assert.Nil(t, err)
+	entries, err = db.XClaim(key, group, alice, 0, [][]byte{[]byte("2")}, XClaimOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+	summary, err := db.XPending(key, group)
+	assert.Nil(t, err)
+	assert.Equal(t, &XPendingSummary{
+		Count:     2,
+		Lowest:    stream.ID{Ms: 1},
+		Highest:   stream.ID{Ms: 3},
+		Consumers: map[string]int{"bob": 2},
+	}, summary)
+
+	_, err = db.XClaim(key, []byte("missing"), bob, 0, [][]byte{[]byte("1")}, XClaimOptions{})
+	assert.Equal(t, ErrStreamNoGroup, err)
+}
+
+func TestKhighDB_StreamKeyspace(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer func() { destroyDB(db) }()
+
+	key, newKey, group := []byte("stream"), []byte("new-stream"), []byte("group")
+	id, err := db.XAdd(key, XAddOptions{}, []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.XGroupCreate(key, group, []byte("0"), false))
+	_, err = db.XReadGroup(context.Background(), group, []byte("consumer"), XReadOptions{}, [][]byte{key}, [][]byte{[]byte(">")})
+	assert.Nil(t, err)
+
+	dataType, err := db.Type(key)
+	assert.Nil(t, err)
+	assert.Equal(t, Stream, dataType)
+	assert.Equal(t, ErrWrongType, db.HSet(key, []byte("f"), []byte("v")))
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	_, err = db.XAdd([]byte("str"), XAddOptions{}, []byte("f"), []byte("v"))
+	assert.Equal(t, ErrWrongType, err)
+
+	// The groups are renamed with the stream.
+	assert.Nil(t, db.Rename(key, newKey))
+	assert.Equal(t, 0, db.Exists(key))
+	assert.Equal(t, 0, db.XLen(key))
+	entries, err := db.XRange(newKey, []byte("-"), []byte("+"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []StreamEntry{{ID: id, Fields: [][]byte{[]byte("f"), []byte("v")}}}, entries)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(db.options)
+	assert.Nil(t, err)
+	summary, err := db.XPending(newKey, group)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, summary.Count)
+	_, err = db.XPending(key, group)
+	assert.Equal(t, ErrStreamNoGroup, err)
+
+	n, err := db.Del(newKey)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Nil(t, db.Close())
+	db, err = Open(db.options)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, db.Exists(newKey))
+	_, err = db.XPending(newKey, group)
+	assert.Equal(t, ErrStreamNoGroup, err)
+	// A new stream starts from 0-0.
+	id, err = db.XAdd(newKey, XAddOptions{ID: []byte("1-1")}, []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	assert.Equal(t, stream.ID{Ms: 1, Seq: 1}, id)
+}
+
+func TestKhighDB_StreamGC(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-stream")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() { destroyDB(db) }()
+
+	// The group, consumer and pending records are archived with the garbage.
+	key, group := []byte("stream"), []byte("group")
+	assert.Nil(t, db.XGroupCreate(key, group, []byte("$"), true))
+	for i := 1; i <= 4; i++ {
+		_, err = db.XAdd(key, XAddOptions{ID: []byte(fmt.Sprint(i))}, []byte("f"), []byte(fmt.Sprint(i)))
+		assert.Nil(t, err)
+	}
+	_, err = db.XReadGroup(context.Background(), group, []byte("consumer"), XReadOptions{Count: 2},
+		[][]byte{key}, [][]byte{[]byte(">")})
+	assert.Nil(t, err)
+	// The entry of the last ID is deleted.
+	_, err = db.XDel(key, []byte("4"))
+	assert.Nil(t, err)
+
+	garbage := []byte("garbage")
+	for i := 0; i < 64; i++ {
+		_, err = db.XAdd(garbage, XAddOptions{}, []byte("f"), getValue4K())
+		assert.Nil(t, err)
+	}
+	n, err := db.Del(garbage)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	time.Sleep(100 * time.Millisecond)
+	archived := len(db.archivedLogFiles[Stream])
+	assert.Nil(t, db.RunLogFileGC(Stream, -1, 0.5))
+	assert.True(t, len(db.archivedLogFiles[Stream]) < archived)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 3, db.XLen(key))
+	assert.Equal(t, 0, db.Exists(garbage))
+	summary, err := db.XPending(key, group)
+	assert.Nil(t, err)
+	assert.Equal(t, &XPendingSummary{
+		Count:     2,
+		Lowest:    stream.ID{Ms: 1},
+		Highest:   stream.ID{Ms: 2},
+		Consumers: map[string]int{"consumer": 2},
+	}, summary)
+	result, err := db.XReadGroup(context.Background(), group, []byte("consumer"), XReadOptions{},
+		[][]byte{key}, [][]byte{[]byte(">")})
+	assert.Nil(t, err)
+	assert.Equal(t, stream.ID{Ms: 3}, result[0].Entries[0].ID)
+	_, err = db.XAdd(key, XAddOptions{ID: []byte("4")}, []byte("f"), []byte("v"))
+	assert.Equal(t, ErrStreamIDTooSmall, err)
+}
+
+func testKhighDBXAdd(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("stream")
+	_, err := db.XAdd(key, XAddOptions{}, []byte("f"))
+	assert.Equal(t, ErrInvalidNumberOfArgs, err)
+	_, err = db.XAdd(key, XAddOptions{NoMkStream: true}, []byte("f"), []byte("v"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.XAdd(key, XAddOptions{ID: []byte("0-0")}, []byte("f"), []byte("v"))
+	assert.Equal(t, ErrStreamIDZero, err)
+	_, err = db.XAdd(key, XAddOptions{ID: []byte("abc")}, []byte("f"), []byte("v"))
+	assert.Equal(t, ErrInvalidStreamID, err)
+	assert.Equal(t, 0, db.Exists(key))
+
+	before := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	id1, err := db.XAdd(key, XAddOptions{ID: []byte("*")}, []byte("name"), []byte("KHighness"), []byte("age"), []byte("18"))
+	assert.Nil(t, err)
+	assert.True(t, id1.Ms >= before)
+	id2, err := db.XAdd(key, XAddOptions{ID: []byte(fmt.Sprintf("%d-*", id1.Ms))}, []byte("name"), []byte("Khighness"))
+	assert.Nil(t, err)
+	assert.Equal(t, stream.ID{Ms: id1.Ms, Seq: id1.Seq + 1}, id2)
+	_, err = db.XAdd(key, XAddOptions{ID: []byte(id1.String())}, []byte("f"), []byte("v"))
+	assert.Equal(t, ErrStreamIDTooSmall, err)
+	_, err = db.XAdd(key, XAddOptions{ID: []byte(fmt.Sprintf("%d-*", id1.Ms-1))}, []byte("f"), []byte("v"))
+	assert.Equal(t, ErrStreamIDTooSmall, err)
+	id3, err := db.XAdd(key, XAddOptions{ID: []byte(fmt.Sprint(id1.Ms + 1000))}, []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	assert.Equal(t, stream.ID{Ms: id1.Ms + 1000}, id3)
+	assert.Equal(t, 3, db.XLen(key))
+
+	// The last ID is kept after the last entry is deleted.
+	n, err := db.XDel(key, []byte(id3.String()))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(db.options)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2, db.XLen(key))
+	entries, err := db.XRange(key, []byte("-"), []byte("+"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []StreamEntry{
+		{ID: id1, Fields: [][]byte{[]byte("name"), []byte("KHighness"), []byte("age"), []byte("18")}},
+		{ID: id2, Fields: [][]byte{[]byte("name"), []byte("Khighness")}},
+	}, entries)
+	_, err = db.XAdd(key, XAddOptions{ID: []byte(id3.String())}, []byte("f"), []byte("v"))
+	assert.Equal(t, ErrStreamIDTooSmall, err)
+	id4, err := db.XAdd(key, XAddOptions{}, []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	assert.True(t, id3.Less(id4))
+}
+
+func testKhighDBXReadGroup(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer func() { destroyDB(db) }()
+
+	key, group := []byte("stream"), []byte("group")
+	alice, bob := []byte("alice"), []byte("bob")
+	assert.Equal(t, ErrKeyNotFound, db.XGroupCreate(key, group, []byte("$"), false))
+	assert.Nil(t, db.XGroupCreate(key, group, []byte("$"), true))
+	assert.Equal(t, ErrStreamGroupExists, db.XGroupCreate(key, group, []byte("0"), false))
+	assert.Equal(t, 1, db.Exists(key))
+	for i := 1; i <= 5; i++ {
+		_, err := db.XAdd(key, XAddOptions{ID: []byte(fmt.Sprint(i))}, []byte("f"), []byte(fmt.Sprint(i)))
+		assert.Nil(t, err)
+	}
+
+	_, err := db.XReadGroup(context.Background(), []byte("missing"), alice, XReadOptions{}, [][]byte{key}, [][]byte{[]byte(">")})
+	assert.Equal(t, ErrStreamNoGroup, err)
+	result, err := db.XReadGroup(context.Background(), group, alice, XReadOptions{Count: 2}, [][]byte{key}, [][]byte{[]byte(">")})
+	assert.Nil(t, err)
+	assert.Equal(t, []StreamEntries{{Key: key, Entries: []StreamEntry{
+		{ID: stream.ID{Ms: 1}, Fields: [][]byte{[]byte("f"), []byte("1")}},
+		{ID: stream.ID{Ms: 2}, Fields: [][]byte{[]byte("f"), []byte("2")}},
+	}}}, result)
+	result, err = db.XReadGroup(context.Background(), group, bob, XReadOptions{Count: 1}, [][]byte{key}, [][]byte{[]byte(">")})
+	assert.Nil(t, err)
+	assert.Equal(t, stream.ID{Ms: 3}, result[0].Entries[0].ID)
+	// NOACK entries are not pending.
+	result, err = db.XReadGroup(context.Background(), group, bob, XReadOptions{Count: 1, NoAck: true}, [][]byte{key}, [][]byte{[]byte(">")})
+	assert.Nil(t, err)
+	assert.Equal(t, stream.ID{Ms: 4}, result[0].Entries[0].ID)
+	created, err := db.XGroupCreateConsumer(key, group, []byte("carol"))
+	assert.Nil(t, err)
+	assert.True(t, created)
+	created, err = db.XGroupCreateConsumer(key, group, alice)
+	assert.Nil(t, err)
+	assert.False(t, created)
+
+	n, err := db.XAck(key, group, []byte("1"), []byte("4"), []byte("100"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	// The pending entries list is persisted.
+	assert.Nil(t, db.Close())
+	db, err = Open(db.options)
+	assert.Nil(t, err)
+
+	summary, err := db.XPending(key, group)
+	assert.Nil(t, err)
+	assert.Equal(t, &XPendingSummary{
+		Count:     2,
+		Lowest:    stream.ID{Ms: 2},
+		Highest:   stream.ID{Ms: 3},
+		Consumers: map[string]int{"alice": 1, "bob": 1},
+	}, summary)
+	pending, err := db.XPendingExt(key, group, XPendingOptions{Start: []byte("-"), End: []byte("+"), Consumer: bob})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pending))
+	assert.Equal(t, stream.ID{Ms: 3}, pending[0].ID)
+	assert.Equal(t, int64(1), pending[0].DeliveryCount)
+	assert.Equal(t, []string{"alice", "bob", "carol"}, streamConsumers(db, key, group))
+
+	// The history of the consumer is read, including the deleted entries.
+	_, err = db.XDel(key, []byte("2"))
+	assert.Nil(t, err)
+	result, err = db.XReadGroup(context.Background(), group, alice, XReadOptions{}, [][]byte{key}, [][]byte{[]byte("0")})
+	assert.Nil(t, err)
+	assert.Equal(t, []StreamEntries{{Key: key, Entries: []StreamEntry{{ID: stream.ID{Ms: 2}}}}}, result)
+	result, err = db.XReadGroup(context.Background(), group, alice, XReadOptions{}, [][]byte{key}, [][]byte{[]byte("2")})
+	assert.Nil(t, err)
+	assert.Equal(t, []StreamEntries{{Key: key}}, result)
+
+	// The group continues after the last delivered ID.
+	result, err = db.XReadGroup(context.Background(), group, alice, XReadOptions{}, [][]byte{key}, [][]byte{[]byte(">")})
+	assert.Nil(t, err)
+	assert.Equal(t, stream.ID{Ms: 5}, result[0].Entries[0].ID)
+	result, err = db.XReadGroup(context.Background(), group, alice, XReadOptions{}, [][]byte{key}, [][]byte{[]byte(">")})
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+	assert.Nil(t, db.XGroupSetID(key, group, []byte("3")))
+	result, err = db.XReadGroup(context.Background(), group, bob, XReadOptions{}, [][]byte{key}, [][]byte{[]byte(">")})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(result[0].Entries))
+
+	n, err = db.XGroupDelConsumer(key, group, alice)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, ErrStreamNoGroup, db.XGroupSetID(key, []byte("missing"), []byte("$")))
+
+	assert.Nil(t, db.Close())
+	db, err = Open(db.options)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"bob", "carol"}, streamConsumers(db, key, group))
+	summary, err = db.XPending(key, group)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"bob": 3}, summary.Consumers)
+
+	destroyed, err := db.XGroupDestroy(key, group)
+	assert.Nil(t, err)
+	assert.True(t, destroyed)
+	destroyed, err = db.XGroupDestroy(key, group)
+	assert.Nil(t, err)
+	assert.False(t, destroyed)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(db.options)
+	assert.Nil(t, err)
+	_, err = db.XPending(key, group)
+	assert.Equal(t, ErrStreamNoGroup, err)
+	assert.Equal(t, 4, db.XLen(key))
+}
+
+// streamConsumers returns the names of consumers in the consumer group in order.
+func streamConsumers(db *KhighDB, key, group []byte) []string {
+	db.streamIndex.mu.RLock()
+	defer db.streamIndex.mu.RUnlock()
+	var consumers []string
+	for consumer := range db.streamGroup(key, group).Consumers {
+		consumers = append(consumers, consumer)
+	}
+	sort.Strings(consumers)
+	return consumers
+}
+
+// waitStreamBlocked waits until n clients are blocked on the stream key.
+func waitStreamBlocked(db *KhighDB, key string, n int) {
+	for {
+		db.streamIndex.mu.RLock()
+		queue := db.streamIndex.blocking.clients[key]
+		blocked := queue != nil && queue.Len() == n
+		db.streamIndex.mu.RUnlock()
+		if blocked {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
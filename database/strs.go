@@ -4,35 +4,195 @@ import (
 	"bytes"
 	"errors"
 	"math"
-	"regexp"
 	"strconv"
 	"time"
 
-	"go.uber.org/zap"
-
 	"github.com/Khighness/khighdb/storage"
 	"github.com/Khighness/khighdb/util"
 )
 
 // @Author KHighness
-// @Update 2023-01-01
+// @Update 2023-01-26
+
+const (
+	// maxBitOffset is the max bit offset of bitmap, which makes the bitmap at most 512MB like Redis.
+	maxBitOffset = 1<<32 - 1
+	// maxStrSize is the max size of string value grown by SetRange, which is 512MB like Redis.
+	maxStrSize = 512 << 20
+	// maxLCSTableSize is the max number of cells of the table computing LCS, which limits the
+	// transient memory to 512MB.
+	maxLCSTableSize = 128 << 20
+)
+
+// SetOptions defines the options of SetWithOptions, like the options of SET of Redis.
+type SetOptions struct {
+	// NX only sets the key if it does not exist, and XX only sets the key if it already exists.
+	NX, XX bool
+
+	// Get makes SetWithOptions return the old value of the key.
+	Get bool
+
+	// TTL is the time to live of the key, and ExpireAt is the time when the key expires.
+	// At most one of them can be set, and the key never expires if neither is set.
+	TTL      time.Duration
+	ExpireAt time.Time
+
+	// KeepTTL retains the time to live of the key, TTL and ExpireAt must not be set.
+	KeepTTL bool
+}
+
+// GetEXOptions defines how GetEX updates the expiration time of the key. The expiration time is
+// not changed if no option is set.
+type GetEXOptions struct {
+	// TTL is the time to live of the key, and ExpireAt is the time when the key expires.
+	TTL      time.Duration
+	ExpireAt time.Time
+
+	// Persist removes the expiration time of the key.
+	Persist bool
+}
+
+// LCSMatch is a range of the longest common subsequence, which is contiguous in both strings.
+// The ranges are the inclusive byte offsets in the strings.
+type LCSMatch struct {
+	Start1, End1 int
+	Start2, End2 int
+}
+
+// Len returns the length of the match.
+func (m LCSMatch) Len() int {
+	return m.End1 - m.Start1 + 1
+}
+
+// BitOperation defines the bitwise operation of BitOp.
+type BitOperation int8
+
+const (
+	BitAnd BitOperation = iota
+	BitOr
+	BitXor
+	BitNot
+)
+
+// BitRange defines a range of bitmap for BitCount and BitPos. Start and End are inclusive, and
+// can be negative to indicate the offsets from the end of the string value, like GetRange.
+type BitRange struct {
+	Start, End int
+
+	// InBits makes Start and End be bit offsets instead of byte offsets.
+	InBits bool
+
+	// OpenEnd makes the range end with the string value, and End is ignored.
+	OpenEnd bool
+}
+
+// BitFieldOpType defines the type of operation of BitField.
+type BitFieldOpType int8
+
+const (
+	// BitFieldGet gets the integer.
+	BitFieldGet BitFieldOpType = iota
+	// BitFieldSet sets the integer and returns its old value.
+	BitFieldSet
+	// BitFieldIncrBy increments the integer and returns its new value.
+	BitFieldIncrBy
+)
+
+// BitFieldOverflow defines how BitFieldSet and BitFieldIncrBy handle the overflow.
+type BitFieldOverflow int8
+
+const (
+	// BitFieldWrap wraps around the integer, like the overflow of integers in Go.
+	BitFieldWrap BitFieldOverflow = iota
+	// BitFieldSat saturates the integer to the min or max value.
+	BitFieldSat
+	// BitFieldFail fails the operation, nothing is written.
+	BitFieldFail
+)
+
+// BitFieldOp is an operation of BitField on an integer stored in the bitmap.
+type BitFieldOp struct {
+	Type BitFieldOpType
+
+	// Signed and Bits define the integer type, Bits must be between 1 and 64 for signed integers,
+	// and between 1 and 63 for unsigned integers.
+	Signed bool
+	Bits   int
+
+	// Offset is the bit offset of the integer, whose most significant bit comes first.
+	Offset uint64
+
+	// Value is the value of BitFieldSet, or the increment of BitFieldIncrBy.
+	Value int64
+
+	// Overflow is the overflow behaviour of BitFieldSet and BitFieldIncrBy.
+	// Default value is BitFieldWrap.
+	Overflow BitFieldOverflow
+}
 
 // Set sets key to hold the string value.
-// If key already holds a value, it will be overwritten.
+// If key already holds a value, it will be overwritten, whatever its data type.
 // Any previous time to live associated with the key is
 // discarded o successful set operation.
 // Note the parameter can be nil and value can not be nil.
 func (db *KhighDB) Set(key, value []byte) error {
+	_, _, err := db.SetWithOptions(key, value, SetOptions{})
+	return err
+}
+
+// SetWithOptions sets key to hold the string value with the options, see SetOptions.
+// It returns the old value if opts.Get is true, which is nil if the key does not exist, and
+// whether the value is set, which is false if the condition of NX or XX is not satisfied.
+// The key is deleted if it is set to expire at a time in the past.
+// The key of other data types is overwritten, its old value returned is nil.
+func (db *KhighDB) SetWithOptions(key, value []byte, opts SetOptions) ([]byte, bool, error) {
+	if (opts.NX && opts.XX) || (opts.KeepTTL && (opts.TTL != 0 || !opts.ExpireAt.IsZero())) {
+		return nil, false, ErrConflictingOptions
+	}
+	expiredAt, err := expireTime(opts.TTL, opts.ExpireAt)
+	if err != nil {
+		return nil, false, err
+	}
+	var removed bool
+	if dataType, err := db.Type(key); err == nil && dataType != String {
+		if opts.NX {
+			return nil, false, nil
+		}
+		if removed, err = db.delKey(key, dataType); err != nil {
+			return nil, false, err
+		}
+	}
+
 	db.strIndex.mu.Lock()
 	defer db.strIndex.mu.Unlock()
 
-	entry := &storage.LogEntry{Key: key, Value: value}
-	pos, err := db.writeLogEntry(entry, String)
-	if err != nil {
-		return err
+	if err = db.claimKey(key, String); err != nil {
+		return nil, false, err
+	}
+	node, err := db.getLiveIndexNode(db.strIndex.idxTree, key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return nil, false, err
+	}
+	var oldVal []byte
+	if node != nil && opts.Get {
+		if oldVal, err = db.getVal(db.strIndex.idxTree, key, String); err != nil {
+			return nil, false, err
+		}
+	}
+	if (opts.NX && node != nil) || (opts.XX && node == nil && !removed) {
+		return oldVal, false, nil
 	}
 
-	return db.updateIndexTree(db.strIndex.idxTree, entry, pos, true, String)
+	if node != nil && opts.KeepTTL {
+		expiredAt = node.expiredAt
+	}
+	if expiredAt != 0 && expiredAt <= time.Now().UnixNano() {
+		if node != nil {
+			err = db.delInternal(key)
+		}
+		return oldVal, true, err
+	}
+	return oldVal, true, db.setInternal(key, value, expiredAt)
 }
 
 // Get gets the value of the key.
@@ -55,14 +215,12 @@ func (db *KhighDB) MSet(args ...[]byte) error {
 	defer db.strIndex.mu.Unlock()
 
 	for i := 0; i < len(args); i += 2 {
-		key, value := args[0], args[1]
-		entry := &storage.LogEntry{Key: key, Value: value}
-		pos, err := db.writeLogEntry(entry, String)
-		if err != nil {
+		if err := db.claimKey(args[i], String); err != nil {
 			return err
 		}
-		err = db.updateIndexTree(db.strIndex.idxTree, entry, pos, true, String)
-		if err != nil {
+	}
+	for i := 0; i < len(args); i += 2 {
+		if err := db.setInternal(args[i], args[i+1], 0); err != nil {
 			return err
 		}
 	}
@@ -138,43 +296,62 @@ func (db *KhighDB) GetDel(key []byte) ([]byte, error) {
 	}
 
 	entry := &storage.LogEntry{Key: key, Type: storage.TypeDelete}
-	pos, err := db.writeLogEntry(entry, String)
-	if err != nil {
+	if _, err = db.writeLogEntry(entry, String); err != nil {
 		return nil, err
 	}
 
 	oldVal, updated := db.strIndex.idxTree.Delete(key)
 	db.sendDiscard(oldVal, updated, String)
-	_, size := storage.EncodeEntry(entry)
-	node := &indexNode{fid: pos.fid, entrySize: size}
-	select {
-	case db.discards[String].nodeChan <- node:
-	default:
-		zap.L().Warn("Failed to send node to discard channel")
-	}
 	return val, nil
 }
 
-// Delete deletes key-value pair corresponding to the given key.
-func (db *KhighDB) Delete(key []byte) error {
+// GetSet sets key to hold the string value and returns its old value, which is nil if the key
+// does not exist or holds other data types. Any previous time to live associated with the key is discarded.
+func (db *KhighDB) GetSet(key, value []byte) ([]byte, error) {
+	oldVal, _, err := db.SetWithOptions(key, value, SetOptions{Get: true})
+	return oldVal, err
+}
+
+// GetEX gets the value of the key and updates its expiration time by the options.
+// If the key does not exist, ErrKeyNotFound is returned.
+// The key is deleted if it is set to expire at a time in the past.
+func (db *KhighDB) GetEX(key []byte, opts GetEXOptions) ([]byte, error) {
+	if opts.Persist && (opts.TTL != 0 || !opts.ExpireAt.IsZero()) {
+		return nil, ErrConflictingOptions
+	}
+	expiredAt, err := expireTime(opts.TTL, opts.ExpireAt)
+	if err != nil {
+		return nil, err
+	}
+
 	db.strIndex.mu.Lock()
 	defer db.strIndex.mu.Unlock()
 
-	entry := &storage.LogEntry{Key: key, Type: storage.TypeDelete}
-	pos, err := db.writeLogEntry(entry, String)
+	node, err := db.getLiveIndexNode(db.strIndex.idxTree, key)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	val, updated := db.strIndex.idxTree.Delete(key)
-	db.sendDiscard(val, updated, String)
-	_, size := storage.EncodeEntry(entry)
-	node := &indexNode{fid: pos.fid, entrySize: size}
-	select {
-	case db.discards[String].nodeChan <- node:
-	default:
-		zap.L().Warn("Failed to send node to discard channel")
+	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	switch {
+	case expiredAt != 0 && expiredAt <= time.Now().UnixNano():
+		err = db.delInternal(key)
+	case expiredAt != 0 || (opts.Persist && node.expiredAt != 0):
+		err = db.setInternal(key, val, expiredAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// Delete deletes key-value pair corresponding to the given key.
+func (db *KhighDB) Delete(key []byte) error {
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+	return db.delInternal(key)
 }
 
 // SetEX sets key to hold the string value with expiration time.
@@ -183,14 +360,11 @@ func (db *KhighDB) SetEX(key, value []byte, duration time.Duration) error {
 	db.strIndex.mu.Lock()
 	defer db.strIndex.mu.Unlock()
 
-	expiredAt := time.Now().Add(duration).UnixNano()
-	entry := &storage.LogEntry{Key: key, Value: value, ExpiredAt: expiredAt}
-	pos, err := db.writeLogEntry(entry, String)
-	if err != nil {
+	if err := db.claimKey(key, String); err != nil {
 		return err
 	}
-
-	return db.updateIndexTree(db.strIndex.idxTree, entry, pos, true, String)
+	expiredAt := time.Now().Add(duration).UnixNano()
+	return db.setInternal(key, value, expiredAt)
 }
 
 // SetNX sets key to hold the string value if the key is not exist.
@@ -206,14 +380,10 @@ func (db *KhighDB) SetNX(key, value []byte) error {
 	if val != nil {
 		return nil
 	}
-
-	entry := &storage.LogEntry{Key: key, Value: value}
-	pos, err := db.writeLogEntry(entry, String)
-	if err != nil {
+	if err = db.claimKey(key, String); err != nil {
 		return err
 	}
-
-	return db.updateIndexTree(db.strIndex.idxTree, entry, pos, true, String)
+	return db.setInternal(key, value, 0)
 }
 
 // MSetNX executes SetNX in batches.
@@ -236,6 +406,9 @@ func (db *KhighDB) MSetNX(args ...[]byte) error {
 		if val != nil {
 			return nil
 		}
+		if err = db.claimKey(key, String); err != nil {
+			return err
+		}
 	}
 
 	// Filter the duplicate keys.
@@ -273,6 +446,8 @@ func (db *KhighDB) Append(key, value []byte) error {
 
 	if oldVal != nil {
 		value = append(oldVal, value...)
+	} else if err = db.claimKey(key, String); err != nil {
+		return err
 	}
 	entry := &storage.LogEntry{Key: key, Value: value}
 	pos, err := db.writeLogEntry(entry, String)
@@ -282,6 +457,37 @@ func (db *KhighDB) Append(key, value []byte) error {
 	return db.updateIndexTree(db.strIndex.idxTree, entry, pos, true, String)
 }
 
+// SetRange overwrites part of the string value stored at key from the byte offset, and returns
+// the length of the string value after it. The string value is padded with zero bytes if the
+// offset is beyond its end, and is created if the key does not exist and value is not empty.
+// Like SetBit, only the overwritten bytes are written into log file, and the time to live of
+// the key is retained.
+func (db *KhighDB) SetRange(key []byte, offset int, value []byte) (int, error) {
+	if offset < 0 {
+		return 0, ErrIndexOutOfRange
+	}
+	if offset+len(value) > maxStrSize {
+		return 0, ErrStrTooLarge
+	}
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	size, err := db.strLenInternal(key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return 0, err
+	}
+	if len(value) == 0 {
+		return size, nil
+	}
+	if err = db.patchStrInternal(key, offset, value); err != nil {
+		return 0, err
+	}
+	if end := offset + len(value); end > size {
+		size = end
+	}
+	return size, nil
+}
+
 // Incr increments the value stored at key.
 // If the key does not exist, the value will be set to 0 before performing this operation.
 // It returns ErrInvalidValueType if the value type is not integer type.
@@ -322,6 +528,47 @@ func (db *KhighDB) DecrBy(key []byte, delta int64) (int64, error) {
 	return db.deltaBy(key, -delta)
 }
 
+// IncrByFloat increases the value stored at key by the float delta, and returns the new value.
+// If the key does not exist, the value will be set to 0 before performing this operation.
+// It returns ErrInvalidFloatValue if the value is not a float, and ErrFloatOverflow if the
+// new value is NaN or Infinity. The time to live of the key is retained.
+func (db *KhighDB) IncrByFloat(key []byte, delta float64) (float64, error) {
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	var number float64
+	var expiredAt int64
+	node, err := db.getLiveIndexNode(db.strIndex.idxTree, key)
+	switch {
+	case errors.Is(err, ErrKeyNotFound):
+		if err = db.claimKey(key, String); err != nil {
+			return 0, err
+		}
+	case err != nil:
+		return 0, err
+	default:
+		val, err := db.getVal(db.strIndex.idxTree, key, String)
+		if err != nil {
+			return 0, err
+		}
+		number, err = strconv.ParseFloat(string(val), 64)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			return 0, ErrInvalidFloatValue
+		}
+		expiredAt = node.expiredAt
+	}
+
+	number += delta
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, ErrFloatOverflow
+	}
+	val := []byte(strconv.FormatFloat(number, 'f', -1, 64))
+	if err = db.setInternal(key, val, expiredAt); err != nil {
+		return 0, err
+	}
+	return number, nil
+}
+
 // deltaBy updates the integer value corresponding to key.
 // This function should be invoked with write lock.
 // It returns the updated value. It returns 0 if any error occurs.
@@ -331,6 +578,9 @@ func (db *KhighDB) deltaBy(key []byte, delta int64) (int64, error) {
 		return 0, err
 	}
 	if bytes.Equal(val, nil) {
+		if err = db.claimKey(key, String); err != nil {
+			return 0, err
+		}
 		val = []byte("0")
 	}
 	valInt64, err := strconv.ParseInt(string(val), 10, 64)
@@ -363,11 +613,26 @@ func (db *KhighDB) StrLen(key []byte) int {
 	db.strIndex.mu.RLock()
 	defer db.strIndex.mu.RUnlock()
 
-	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	size, err := db.strLenInternal(key)
 	if err != nil {
 		return 0
 	}
-	return len(val)
+	return size
+}
+
+// LCS returns the longest common subsequence of the string values stored at key1 and key2,
+// the non existing keys are regarded as empty strings.
+func (db *KhighDB) LCS(key1, key2 []byte) ([]byte, error) {
+	lcs, _, err := db.lcs(key1, key2, 0)
+	return lcs, err
+}
+
+// LCSIdx returns the matches of the longest common subsequence of the string values stored at
+// key1 and key2, and the length of the subsequence. Like Redis, the matches are ordered from the
+// end of the strings to the start, and the matches shorter than minMatchLen are skipped.
+func (db *KhighDB) LCSIdx(key1, key2 []byte, minMatchLen int) ([]LCSMatch, int, error) {
+	lcs, matches, err := db.lcs(key1, key2, minMatchLen)
+	return matches, len(lcs), err
 }
 
 // Count returns the total number of keys of String.
@@ -382,21 +647,18 @@ func (db *KhighDB) Count() int {
 }
 
 // Scan iterates over all keys of type String and finds its value.
-// Parameter prefix will matches key's prefix, and pattern is a regular expression that
-// also matches the key. Parameter count limits the number of keys, a empty slice will
-// will be returned is count is not a positive number.
+// Parameter prefix will matches key's prefix, and pattern is a glob-style pattern that
+// also matches the key, see util.GlobMatch. Parameter count limits the number of keys,
+// a empty slice will will be returned is count is not a positive number.
 // The returned values will be a mixed data of keys and values, like [key, value, key, value ...].
 func (db *KhighDB) Scan(prefix []byte, pattern string, count int) ([][]byte, error) {
 	if count <= 0 {
 		return nil, nil
 	}
 
-	var reg *regexp.Regexp
-	var err error
-	if pattern != "" {
-		if reg, err = regexp.Compile(pattern); err != nil {
-			return nil, err
-		}
+	prefix, ok := globScanPrefix(prefix, pattern)
+	if !ok {
+		return nil, nil
 	}
 
 	db.strIndex.mu.RLock()
@@ -411,7 +673,7 @@ func (db *KhighDB) Scan(prefix []byte, pattern string, count int) ([][]byte, err
 
 	var result [][]byte
 	for _, key := range keys {
-		if reg != nil && !reg.Match(key) {
+		if pattern != "" && !util.GlobMatch([]byte(pattern), key, false) {
 			continue
 		}
 		val, err := db.getVal(db.strIndex.idxTree, key, String)
@@ -425,6 +687,436 @@ func (db *KhighDB) Scan(prefix []byte, pattern string, count int) ([][]byte, err
 	return result, nil
 }
 
+// SetBit sets or clears the bit at offset of the string value stored at key, and returns the
+// original bit. The string value is grown with zero bytes if the offset is beyond its end, and
+// is created if the key does not exist. Only the byte holding the bit is written into log file.
+func (db *KhighDB) SetBit(key []byte, offset uint64, on bool) (bool, error) {
+	if offset > maxBitOffset {
+		return false, ErrBitOffsetOutOfRange
+	}
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	at := int(offset >> 3)
+	buf, err := db.getStrRange(key, at, at+1)
+	exists := err == nil
+	if errors.Is(err, ErrKeyNotFound) {
+		buf, err = make([]byte, 1), nil
+	}
+	if err != nil {
+		return false, err
+	}
+	old := util.GetBit(buf, offset&7)
+	if exists && old == on {
+		// The string value is still padded to hold the bit even if the bit is unchanged.
+		size, err := db.strLenInternal(key)
+		if err != nil {
+			return false, err
+		}
+		if at < size {
+			return old, nil
+		}
+	}
+	util.SetBit(buf, offset&7, on)
+	return old, db.patchStrInternal(key, at, buf)
+}
+
+// GetBit returns the bit at offset of the string value stored at key. The bits beyond the end
+// of the string value are 0, and so are the bits of non existing keys.
+func (db *KhighDB) GetBit(key []byte, offset uint64) (bool, error) {
+	if offset > maxBitOffset {
+		return false, ErrBitOffsetOutOfRange
+	}
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+
+	at := int(offset >> 3)
+	buf, err := db.getStrRange(key, at, at+1)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return util.GetBit(buf, offset&7), nil
+}
+
+// BitCount returns the number of set bits of the string value stored at key in the range,
+// the whole string value is counted if r is nil.
+func (db *KhighDB) BitCount(key []byte, r *BitRange) (int, error) {
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+
+	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	start, end, ok := r.bitOffsets(len(val))
+	if !ok {
+		return 0, nil
+	}
+	return util.BitCount(val, start, end), nil
+}
+
+// BitPos returns the offset of the first bit equal to bit of the string value stored at key in
+// the range, the whole string value is searched if r is nil. It returns -1 if no such bit is found.
+// The string value is regarded as padded with zero bytes if the range has an open end, then the
+// offset right after the string value is returned if a clear bit is wanted but all bits are set.
+func (db *KhighDB) BitPos(key []byte, bit bool, r *BitRange) (int, error) {
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+
+	val, err := db.getVal(db.strIndex.idxTree, key, String)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			if bit {
+				return -1, nil
+			}
+			return 0, nil
+		}
+		return 0, err
+	}
+	start, end, ok := r.bitOffsets(len(val))
+	if !ok {
+		return -1, nil
+	}
+	pos := util.BitPos(val, bit, start, end)
+	if pos < 0 && !bit && (r == nil || r.OpenEnd) {
+		pos = int64(len(val)) * 8
+	}
+	return int(pos), nil
+}
+
+// BitOp performs the bitwise operation between the string values stored at keys, and stores the
+// result in destKey. The shorter string values are regarded as padded with zero bytes, so are the
+// non existing keys. BitNot takes only one key. It returns the length of the result, and destKey
+// is deleted if the result is empty.
+func (db *KhighDB) BitOp(op BitOperation, destKey []byte, keys ...[]byte) (int, error) {
+	if len(keys) == 0 || (op == BitNot && len(keys) != 1) {
+		return 0, ErrInvalidNumberOfArgs
+	}
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	values := make([][]byte, len(keys))
+	var size int
+	for i, key := range keys {
+		val, err := db.getVal(db.strIndex.idxTree, key, String)
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return 0, err
+		}
+		values[i] = val
+		if len(val) > size {
+			size = len(val)
+		}
+	}
+	if size == 0 {
+		if db.strKeyExists(destKey) {
+			return 0, db.delInternal(destKey)
+		}
+		return 0, nil
+	}
+
+	res := make([]byte, size)
+	copy(res, values[0])
+	if op == BitNot {
+		for i := range res {
+			res[i] = ^res[i]
+		}
+	}
+	for _, val := range values[1:] {
+		for i := range res {
+			var b byte
+			if i < len(val) {
+				b = val[i]
+			}
+			switch op {
+			case BitAnd:
+				res[i] &= b
+			case BitOr:
+				res[i] |= b
+			case BitXor:
+				res[i] ^= b
+			}
+		}
+	}
+	if err := db.claimKey(destKey, String); err != nil {
+		return 0, err
+	}
+	return size, db.setInternal(destKey, res, 0)
+}
+
+// BitField runs the operations on the integers stored in the string value at key in order, and
+// returns the result of each operation. The result is nil if the operation fails by overflow.
+// Like SetBit, the string value is grown or created if needed, and only the bytes holding the
+// integer are written into log file.
+func (db *KhighDB) BitField(key []byte, ops ...BitFieldOp) ([]*int64, error) {
+	readOnly := true
+	for _, op := range ops {
+		if op.Bits < 1 || op.Bits > 64 || (!op.Signed && op.Bits > 63) {
+			return nil, ErrInvalidBitFieldType
+		}
+		if op.Offset+uint64(op.Bits)-1 > maxBitOffset {
+			return nil, ErrBitOffsetOutOfRange
+		}
+		if op.Type != BitFieldGet {
+			readOnly = false
+		}
+	}
+	if readOnly {
+		db.strIndex.mu.RLock()
+		defer db.strIndex.mu.RUnlock()
+	} else {
+		db.strIndex.mu.Lock()
+		defer db.strIndex.mu.Unlock()
+	}
+
+	results := make([]*int64, 0, len(ops))
+	for i := range ops {
+		op := &ops[i]
+		from, to := int(op.Offset>>3), int((op.Offset+uint64(op.Bits)-1)>>3)+1
+		buf, err := db.getStrRange(key, from, to)
+		if errors.Is(err, ErrKeyNotFound) {
+			buf, err = make([]byte, to-from), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		old := op.get(buf)
+		var value, result int64
+		var ok bool
+		switch op.Type {
+		case BitFieldGet:
+			results = append(results, &old)
+			continue
+		case BitFieldSet:
+			value, ok = op.fit(op.Value, 0)
+			result = old
+		case BitFieldIncrBy:
+			value, ok = op.incr(old)
+			result = value
+		}
+		if !ok {
+			results = append(results, nil)
+			continue
+		}
+		util.SetBits(buf, op.Offset&7, uint(op.Bits), uint64(value))
+		if err = db.patchStrInternal(key, from, buf); err != nil {
+			return nil, err
+		}
+		results = append(results, &result)
+	}
+	return results, nil
+}
+
+// bitOffsets returns the bit offsets of the range in the string value of size bytes,
+// false is returned if the range is empty.
+func (r *BitRange) bitOffsets(size int) (uint64, uint64, bool) {
+	if r == nil {
+		r = &BitRange{OpenEnd: true}
+	}
+	total := size
+	if r.InBits {
+		total *= 8
+	}
+	start, end := r.Start, r.End
+	if r.OpenEnd {
+		end = -1
+	}
+	if start < 0 {
+		start += total
+	}
+	if end < 0 {
+		end += total
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= total {
+		end = total - 1
+	}
+	if total == 0 || end < 0 || start > end {
+		return 0, 0, false
+	}
+	if r.InBits {
+		return uint64(start), uint64(end), true
+	}
+	return uint64(start) * 8, uint64(end)*8 + 7, true
+}
+
+// limits returns the min and max value of the integer type.
+func (op *BitFieldOp) limits() (int64, int64) {
+	if op.Signed {
+		min := int64(-1) << uint(op.Bits-1)
+		return min, ^min
+	}
+	return 0, int64(1)<<uint(op.Bits) - 1
+}
+
+// get returns the integer in buf, which holds the bytes from the byte offset of the integer.
+func (op *BitFieldOp) get(buf []byte) int64 {
+	return op.wrap(util.GetBits(buf, op.Offset&7, uint(op.Bits)))
+}
+
+// wrap returns the integer formed by the lowest bits of value.
+func (op *BitFieldOp) wrap(value uint64) int64 {
+	shift := uint(64 - op.Bits)
+	if op.Signed {
+		return int64(value<<shift) >> shift
+	}
+	return int64(value << shift >> shift)
+}
+
+// fit fits the value into the integer type by the overflow behaviour, overflow is positive or
+// negative if the value is known to overflow above or below. It returns false if it fails.
+func (op *BitFieldOp) fit(value int64, overflow int) (int64, bool) {
+	min, max := op.limits()
+	if overflow == 0 {
+		if value > max {
+			overflow = 1
+		} else if value < min {
+			overflow = -1
+		}
+	}
+	if overflow == 0 {
+		return value, true
+	}
+	switch op.Overflow {
+	case BitFieldSat:
+		if overflow > 0 {
+			return max, true
+		}
+		return min, true
+	case BitFieldFail:
+		return 0, false
+	}
+	return op.wrap(uint64(value)), true
+}
+
+// incr increments the integer by the value of operation, and fits the result into the integer type.
+func (op *BitFieldOp) incr(old int64) (int64, bool) {
+	// The sum wraps around like int64, then overflowing int64 is checked.
+	sum := old + op.Value
+	var overflow int
+	if op.Value > 0 && sum < old {
+		overflow = 1
+	} else if op.Value < 0 && sum > old {
+		overflow = -1
+	}
+	return op.fit(sum, overflow)
+}
+
+// lcs computes the longest common subsequence of the string values stored at key1 and key2 by
+// dynamic programming, and returns the subsequence with its matches.
+func (db *KhighDB) lcs(key1, key2 []byte, minMatchLen int) ([]byte, []LCSMatch, error) {
+	db.strIndex.mu.RLock()
+	a, err := db.getVal(db.strIndex.idxTree, key1, String)
+	var b []byte
+	if err == nil || errors.Is(err, ErrKeyNotFound) {
+		b, err = db.getVal(db.strIndex.idxTree, key2, String)
+	}
+	db.strIndex.mu.RUnlock()
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return nil, nil, err
+	}
+	if uint64(len(a)+1)*uint64(len(b)+1) > maxLCSTableSize {
+		return nil, nil, ErrLCSTooLarge
+	}
+
+	// table[i*n+j] is the length of the longest common subsequence of a[:i] and b[:j].
+	n := len(b) + 1
+	table := make([]uint32, (len(a)+1)*n)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			switch {
+			case a[i-1] == b[j-1]:
+				table[i*n+j] = table[(i-1)*n+j-1] + 1
+			case table[(i-1)*n+j] > table[i*n+j-1]:
+				table[i*n+j] = table[(i-1)*n+j]
+			default:
+				table[i*n+j] = table[i*n+j-1]
+			}
+		}
+	}
+
+	// Walk back from the end of the strings, the contiguous bytes in both strings make a match.
+	k := int(table[len(table)-1])
+	lcs := make([]byte, k)
+	var matches []LCSMatch
+	var match *LCSMatch
+	emitMatch := func() {
+		if match != nil && match.Len() >= minMatchLen {
+			matches = append(matches, *match)
+		}
+		match = nil
+	}
+	for i, j := len(a), len(b); i > 0 && j > 0; {
+		if a[i-1] == b[j-1] {
+			i, j, k = i-1, j-1, k-1
+			lcs[k] = a[i]
+			if match == nil {
+				match = &LCSMatch{Start1: i, End1: i, Start2: j, End2: j}
+			} else {
+				match.Start1, match.Start2 = i, j
+			}
+			continue
+		}
+		emitMatch()
+		if table[(i-1)*n+j] > table[i*n+j-1] {
+			i--
+		} else {
+			j--
+		}
+	}
+	emitMatch()
+	return lcs, matches, nil
+}
+
+// expireTime returns the expiration time in nanoseconds by the time to live or the time when the
+// key expires, 0 is returned if neither is set.
+func expireTime(ttl time.Duration, expireAt time.Time) (int64, error) {
+	switch {
+	case ttl != 0 && !expireAt.IsZero():
+		return 0, ErrConflictingOptions
+	case ttl < 0:
+		return 0, ErrInvalidExpireTime
+	case ttl > 0:
+		return time.Now().Add(ttl).UnixNano(), nil
+	case !expireAt.IsZero():
+		if expireAt.UnixNano() <= 0 {
+			return 0, ErrInvalidExpireTime
+		}
+		return expireAt.UnixNano(), nil
+	}
+	return 0, nil
+}
+
+// setInternal sets key to hold the string value with expiration time, the key never
+// expires if expiredAt is 0.
+func (db *KhighDB) setInternal(key, value []byte, expiredAt int64) error {
+	entry := &storage.LogEntry{Key: key, Value: value, ExpiredAt: expiredAt}
+	pos, err := db.writeLogEntry(entry, String)
+	if err != nil {
+		return err
+	}
+	return db.updateIndexTree(db.strIndex.idxTree, entry, pos, true, String)
+}
+
+// delInternal deletes the key of String.
+func (db *KhighDB) delInternal(key []byte) error {
+	entry := &storage.LogEntry{Key: key, Type: storage.TypeDelete}
+	if _, err := db.writeLogEntry(entry, String); err != nil {
+		return err
+	}
+	val, updated := db.strIndex.idxTree.Delete(key)
+	db.sendDiscard(val, updated, String)
+	return nil
+}
+
 // Expire sets the expiration time for the given key.
 // Note that the smallest granularity supported is time.Millisecond.
 func (db *KhighDB) Expire(key []byte, duration time.Duration) error {
@@ -15,7 +15,7 @@ import (
 )
 
 // @Author KHighness
-// @Update 2023-01-03
+// @Update 2023-01-26
 
 func TestKhighDB_Set(t *testing.T) {
 	t.Run("default", func(t *testing.T) {
@@ -1131,15 +1131,15 @@ func testKhighDBScan(t *testing.T, ioType IOType, mode DataIndexMode) {
 		_ = db.Set([]byte(fmt.Sprintf("k-%d", i)), []byte(fmt.Sprintf("v-%d", i)))
 	}
 
-	result, err := db.Scan([]byte("k-"), "[k]{1}[-]{1}[\\d]+", 5)
+	result, err := db.Scan([]byte("k-"), "k-[0-9]*", 5)
 	assert.Nil(t, err)
 	assert.Equal(t, 10, len(result))
 
-	result, err = db.Scan([]byte("k-"), "[k]{1}[+]{1}[\\d]+", 5)
+	result, err = db.Scan([]byte("k-"), "k+[0-9]*", 5)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(result))
 
-	result, err = db.Scan([]byte("k"), "[k]{1}", 10)
+	result, err = db.Scan([]byte("k"), "k*", 10)
 	assert.Nil(t, err)
 	assert.Equal(t, 20, len(result))
 
@@ -1150,6 +1150,11 @@ func testKhighDBScan(t *testing.T, ioType IOType, mode DataIndexMode) {
 	result, err = db.Scan([]byte("kk"), "", 0)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(result))
+
+	// The literal prefix of pattern narrows the keys to be scanned.
+	result, err = db.Scan(nil, "k-1*", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("k-1"), []byte("v-1"), []byte("k-10"), []byte("v-10")}, result)
 }
 
 func testKhighDBExpire(t *testing.T, ioType IOType, mode DataIndexMode) {
@@ -1254,3 +1259,644 @@ func testKhighDBGetStrKeys(t *testing.T, ioType IOType, mode DataIndexMode) {
 	assert.Nil(t, err)
 	assert.Equal(t, 50, len(keys))
 }
+
+func TestKhighDB_SetBit(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBSetBit(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBSetBit(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBSetBit(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_BitCount(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("bitmap")
+	n, err := db.BitCount(key, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	// "foobar" like the example of Redis.
+	assert.Nil(t, db.Set(key, []byte("foobar")))
+	tests := []struct {
+		name string
+		r    *BitRange
+		want int
+	}{
+		{"all", nil, 26},
+		{"first-byte", &BitRange{Start: 0, End: 0}, 4},
+		{"second-byte", &BitRange{Start: 1, End: 1}, 6},
+		{"negative", &BitRange{Start: -2, End: -1}, 7},
+		{"out-of-range", &BitRange{Start: 5, End: 100}, 4},
+		{"empty", &BitRange{Start: 3, End: 2}, 0},
+		{"bits", &BitRange{Start: 5, End: 30, InBits: true}, 17},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.BitCount(key, tt.r)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestKhighDB_BitPos(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("bitmap")
+	pos, err := db.BitPos(key, true, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, pos)
+	pos, err = db.BitPos(key, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, pos)
+
+	assert.Nil(t, db.Set(key, []byte{0xff, 0xf0, 0x00}))
+	tests := []struct {
+		name string
+		bit  bool
+		r    *BitRange
+		want int
+	}{
+		{"first-clear", false, nil, 12},
+		{"first-set", true, nil, 0},
+		{"set-from-byte", true, &BitRange{Start: 2, OpenEnd: true}, -1},
+		{"clear-in-bits", false, &BitRange{Start: 13, End: 20, InBits: true}, 13},
+		{"set-negative", true, &BitRange{Start: -2, End: -1}, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.BitPos(key, tt.bit, tt.r)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// The string value is regarded as padded with zero bytes only if the end is open.
+	assert.Nil(t, db.Set(key, []byte{0xff, 0xff}))
+	pos, err = db.BitPos(key, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 16, pos)
+	pos, err = db.BitPos(key, false, &BitRange{Start: 0, End: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, -1, pos)
+}
+
+func TestKhighDB_BitOp(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	k1, k2, dest := []byte("k1"), []byte("k2"), []byte("dest")
+	assert.Nil(t, db.Set(k1, []byte{0xf0, 0x0f}))
+	assert.Nil(t, db.Set(k2, []byte{0xff}))
+
+	tests := []struct {
+		name string
+		op   BitOperation
+		keys [][]byte
+		want []byte
+	}{
+		{"and", BitAnd, [][]byte{k1, k2}, []byte{0xf0, 0x00}},
+		{"or", BitOr, [][]byte{k1, k2}, []byte{0xff, 0x0f}},
+		{"xor", BitXor, [][]byte{k1, k2}, []byte{0x0f, 0x0f}},
+		{"not", BitNot, [][]byte{k1}, []byte{0x0f, 0xf0}},
+		{"missing", BitOr, [][]byte{k2, []byte("missing")}, []byte{0xff}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := db.BitOp(tt.op, dest, tt.keys...)
+			assert.Nil(t, err)
+			assert.Equal(t, len(tt.want), n)
+			val, err := db.Get(dest)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, val)
+		})
+	}
+
+	_, err := db.BitOp(BitNot, dest, k1, k2)
+	assert.Equal(t, ErrInvalidNumberOfArgs, err)
+
+	// The empty result deletes the destination key.
+	n, err := db.BitOp(BitAnd, dest, []byte("missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	_, err = db.Get(dest)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.Nil(t, db.SAdd([]byte("set"), []byte("m")))
+	_, err = db.BitOp(BitOr, []byte("set"), k1)
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestKhighDB_BitField(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("bitfield")
+	results, err := db.BitField(key,
+		BitFieldOp{Type: BitFieldSet, Bits: 8, Offset: 0, Value: 255},
+		BitFieldOp{Type: BitFieldGet, Signed: true, Bits: 8, Offset: 0},
+		BitFieldOp{Type: BitFieldIncrBy, Bits: 8, Offset: 0, Value: 1},
+		BitFieldOp{Type: BitFieldIncrBy, Bits: 8, Offset: 0, Value: -1, Overflow: BitFieldSat},
+		BitFieldOp{Type: BitFieldIncrBy, Bits: 8, Offset: 0, Value: -1, Overflow: BitFieldFail},
+		BitFieldOp{Type: BitFieldSet, Signed: true, Bits: 4, Offset: 12, Value: 100, Overflow: BitFieldSat},
+		BitFieldOp{Type: BitFieldIncrBy, Signed: true, Bits: 4, Offset: 12, Value: 1},
+		BitFieldOp{Type: BitFieldIncrBy, Signed: true, Bits: 64, Offset: 16, Value: math.MaxInt64},
+		BitFieldOp{Type: BitFieldIncrBy, Signed: true, Bits: 64, Offset: 16, Value: 1, Overflow: BitFieldFail},
+		BitFieldOp{Type: BitFieldIncrBy, Signed: true, Bits: 64, Offset: 16, Value: 1, Overflow: BitFieldSat},
+	)
+	assert.Nil(t, err)
+	want := []interface{}{int64(0), int64(-1), int64(0), int64(0), nil,
+		int64(0), int64(-8), int64(math.MaxInt64), nil, int64(math.MaxInt64)}
+	assert.Equal(t, len(want), len(results))
+	for i, result := range results {
+		if want[i] == nil {
+			assert.Nil(t, result, i)
+		} else if assert.NotNil(t, result, i) {
+			assert.Equal(t, want[i], *result, i)
+		}
+	}
+
+	val, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x00, 0x08, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, val)
+
+	_, err = db.BitField(key, BitFieldOp{Type: BitFieldGet, Bits: 64})
+	assert.Equal(t, ErrInvalidBitFieldType, err)
+	_, err = db.BitField(key, BitFieldOp{Type: BitFieldGet, Bits: 8, Offset: maxBitOffset})
+	assert.Equal(t, ErrBitOffsetOutOfRange, err)
+}
+
+func TestKhighDB_SetBitGC(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-setbit")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() { destroyDB(db) }()
+
+	// The bitmap and its patches are archived with the garbage.
+	key := []byte("bitmap")
+	assert.Nil(t, db.Set(key, make([]byte, 1024)))
+	for i := 0; i < 64; i++ {
+		_, err = db.SetBit(key, uint64(i*17), true)
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 64; i++ {
+		assert.Nil(t, db.Set(getKey(i), getValue4K()))
+	}
+	for i := 0; i < 64; i++ {
+		assert.Nil(t, db.Delete(getKey(i)))
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	archived := len(db.archivedLogFiles[String])
+	assert.Nil(t, db.RunLogFileGC(String, -1, 0.5))
+	assert.True(t, len(db.archivedLogFiles[String]) < archived)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+
+	n, err := db.BitCount(key, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 64, n)
+	for i := 0; i < 64; i++ {
+		bit, err := db.GetBit(key, uint64(i*17))
+		assert.Nil(t, err)
+		assert.True(t, bit)
+	}
+	assert.Equal(t, 1024, db.StrLen(key))
+}
+
+func testKhighDBSetBit(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("bitmap")
+	bit, err := db.GetBit(key, 100)
+	assert.Nil(t, err)
+	assert.False(t, bit)
+
+	// The string value is created and grown by the bits.
+	old, err := db.SetBit(key, 7, true)
+	assert.Nil(t, err)
+	assert.False(t, old)
+	old, err = db.SetBit(key, 7, true)
+	assert.Nil(t, err)
+	assert.True(t, old)
+	_, err = db.SetBit(key, 23, true)
+	assert.Nil(t, err)
+	val, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x01, 0x00, 0x01}, val)
+	// The string value is padded with zero bytes even if the bit is 0 already.
+	old, err = db.SetBit(key, 39, false)
+	assert.Nil(t, err)
+	assert.False(t, old)
+	val, err = db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x01, 0x00, 0x01, 0x00, 0x00}, val)
+	old, err = db.SetBit([]byte("bitmap-zero"), 15, false)
+	assert.Nil(t, err)
+	assert.False(t, old)
+	val, err = db.Get([]byte("bitmap-zero"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x00, 0x00}, val)
+
+	_, err = db.SetBit(key, maxBitOffset+1, true)
+	assert.Equal(t, ErrBitOffsetOutOfRange, err)
+
+	// The patches are compacted when they are larger than the value.
+	for i := uint64(0); i < 24; i++ {
+		_, err = db.SetBit(key, i, i%3 == 0)
+		assert.Nil(t, err)
+	}
+	node, err := db.getIndexNode(db.strIndex.idxTree, key)
+	assert.Nil(t, err)
+	assert.False(t, len(node.patches) > 1 && node.strPatchesFull())
+
+	// The bits are kept with expiration time after reopening.
+	assert.Nil(t, db.Expire(key, time.Hour))
+	_, err = db.SetBit(key, 100, true)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+	db = newKhighDB(ioType, mode)
+	for i := uint64(0); i < 24; i++ {
+		bit, err = db.GetBit(key, i)
+		assert.Nil(t, err)
+		assert.Equal(t, i%3 == 0, bit)
+	}
+	bit, err = db.GetBit(key, 100)
+	assert.Nil(t, err)
+	assert.True(t, bit)
+	assert.Equal(t, 13, db.StrLen(key))
+	ttl, err := db.TTL(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+
+	assert.Nil(t, db.SAdd([]byte("set"), []byte("m")))
+	_, err = db.SetBit([]byte("set"), 0, true)
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestKhighDB_SetWithOptions(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBSetWithOptions(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBSetWithOptions(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBSetWithOptions(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_GetSet(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("key")
+	old, err := db.GetSet(key, []byte("v1"))
+	assert.Nil(t, err)
+	assert.Nil(t, old)
+
+	// The time to live is discarded.
+	assert.Nil(t, db.SetEX(key, []byte("v2"), time.Hour))
+	old, err = db.GetSet(key, []byte("v3"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), old)
+	ttl, err := db.TTL(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), ttl)
+
+	// The key of other data types is overwritten.
+	assert.Nil(t, db.SAdd([]byte("set"), []byte("m")))
+	old, err = db.GetSet([]byte("set"), []byte("v"))
+	assert.Nil(t, err)
+	assert.Nil(t, old)
+	assert.Equal(t, 0, db.SCard([]byte("set")))
+	val, err := db.Get([]byte("set"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), val)
+}
+
+func TestKhighDB_SetOtherType(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-set-other-type")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() { destroyDB(db) }()
+
+	hash, list, zset := []byte("hash"), []byte("list"), []byte("zset")
+	assert.Nil(t, db.HSet(hash, []byte("f1"), []byte("v1"), []byte("f2"), []byte("v2")))
+	assert.Nil(t, db.RPush(list, []byte("a"), []byte("b")))
+	assert.Nil(t, db.ZAdd(zset, 1, []byte("m")))
+
+	// NX is not satisfied by the key of other data types, XX is.
+	_, ok, err := db.SetWithOptions(zset, []byte("v"), SetOptions{NX: true})
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 1, db.ZCard(zset))
+	_, ok, err = db.SetWithOptions(zset, []byte("zset"), SetOptions{XX: true})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, db.Set(hash, []byte("hash")))
+	assert.Nil(t, db.Set(list, []byte("list")))
+
+	check := func() {
+		for _, key := range [][]byte{hash, list, zset} {
+			dataType, err := db.Type(key)
+			assert.Nil(t, err)
+			assert.Equal(t, String, dataType)
+			val, err := db.Get(key)
+			assert.Nil(t, err)
+			assert.Equal(t, key, val)
+		}
+		assert.Equal(t, 0, db.HLen(hash))
+		assert.Equal(t, 0, db.LLen(list))
+		assert.Equal(t, 0, db.ZCard(zset))
+		assert.Equal(t, 3, db.DBSize())
+	}
+	check()
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check()
+}
+
+func TestKhighDB_GetEX(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBGetEX(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBGetEX(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBGetEX(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_IncrByFloat(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("float")
+	val, err := db.IncrByFloat(key, 10.5)
+	assert.Nil(t, err)
+	assert.Equal(t, 10.5, val)
+	val, err = db.IncrByFloat(key, 0.1)
+	assert.Nil(t, err)
+	assert.Equal(t, 10.6, val)
+	got, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("10.6"), got)
+
+	// The integers and the exponential notation are floats too.
+	assert.Nil(t, db.Set(key, []byte("5.0e3")))
+	val, err = db.IncrByFloat(key, 2.0e2)
+	assert.Nil(t, err)
+	assert.Equal(t, 5200.0, val)
+	got, err = db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("5200"), got)
+
+	_, err = db.IncrByFloat(key, math.Inf(1))
+	assert.Equal(t, ErrFloatOverflow, err)
+	assert.Nil(t, db.Set(key, []byte("abc")))
+	_, err = db.IncrByFloat(key, 1)
+	assert.Equal(t, ErrInvalidFloatValue, err)
+
+	// The time to live is retained after reopening.
+	assert.Nil(t, db.SetEX(key, []byte("1"), time.Hour))
+	_, err = db.IncrByFloat(key, -1.5)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+	db = newKhighDB(FileIO, KeyOnlyMemMode)
+	got, err = db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("-0.5"), got)
+	ttl, err := db.TTL(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+}
+
+func TestKhighDB_SetRange(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBSetRange(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBSetRange(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBSetRange(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_LCS(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	// The example of Redis.
+	k1, k2 := []byte("key1"), []byte("key2")
+	assert.Nil(t, db.Set(k1, []byte("ohmytext")))
+	assert.Nil(t, db.Set(k2, []byte("mynewtext")))
+	lcs, err := db.LCS(k1, k2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("mytext"), lcs)
+
+	matches, n, err := db.LCSIdx(k1, k2, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+	assert.Equal(t, []LCSMatch{
+		{Start1: 4, End1: 7, Start2: 5, End2: 8},
+		{Start1: 2, End1: 3, Start2: 0, End2: 1},
+	}, matches)
+	assert.Equal(t, 4, matches[0].Len())
+
+	matches, n, err = db.LCSIdx(k1, k2, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+	assert.Equal(t, []LCSMatch{{Start1: 4, End1: 7, Start2: 5, End2: 8}}, matches)
+
+	// The non existing keys are empty strings.
+	lcs, err = db.LCS(k1, []byte("missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(lcs))
+	matches, n, err = db.LCSIdx([]byte("missing"), k2, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Nil(t, matches)
+}
+
+func testKhighDBSetWithOptions(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("key")
+	old, ok, err := db.SetWithOptions(key, []byte("v1"), SetOptions{XX: true, Get: true})
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, old)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	old, ok, err = db.SetWithOptions(key, []byte("v1"), SetOptions{NX: true, Get: true, TTL: time.Hour})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, old)
+
+	old, ok, err = db.SetWithOptions(key, []byte("v2"), SetOptions{NX: true, Get: true})
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, []byte("v1"), old)
+
+	// KEEPTTL retains the time to live, which is discarded otherwise.
+	old, ok, err = db.SetWithOptions(key, []byte("v2"), SetOptions{XX: true, KeepTTL: true})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, old)
+	ttl, err := db.TTL(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+	_, _, err = db.SetWithOptions(key, []byte("v3"), SetOptions{})
+	assert.Nil(t, err)
+	ttl, err = db.TTL(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), ttl)
+
+	// The expiration time is kept after reopening.
+	expireAt := time.Now().Add(time.Hour)
+	_, _, err = db.SetWithOptions(key, []byte("v4"), SetOptions{ExpireAt: expireAt})
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+	db = newKhighDB(ioType, mode)
+	val, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v4"), val)
+	node, err := db.getIndexNode(db.strIndex.idxTree, key)
+	assert.Nil(t, err)
+	assert.Equal(t, expireAt.UnixNano(), node.expiredAt)
+
+	// The key is deleted if it expires at a time in the past.
+	old, ok, err = db.SetWithOptions(key, []byte("v5"), SetOptions{Get: true, ExpireAt: time.Now().Add(-time.Second)})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("v4"), old)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	_, _, err = db.SetWithOptions(key, []byte("v"), SetOptions{NX: true, XX: true})
+	assert.Equal(t, ErrConflictingOptions, err)
+	_, _, err = db.SetWithOptions(key, []byte("v"), SetOptions{KeepTTL: true, TTL: time.Second})
+	assert.Equal(t, ErrConflictingOptions, err)
+	_, _, err = db.SetWithOptions(key, []byte("v"), SetOptions{TTL: -time.Second})
+	assert.Equal(t, ErrInvalidExpireTime, err)
+	_, _, err = db.SetWithOptions(key, []byte("v"), SetOptions{ExpireAt: time.Unix(0, 0)})
+	assert.Equal(t, ErrInvalidExpireTime, err)
+}
+
+func testKhighDBGetEX(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("key")
+	_, err := db.GetEX(key, GetEXOptions{})
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.Nil(t, db.Set(key, []byte("val")))
+	val, err := db.GetEX(key, GetEXOptions{TTL: time.Hour})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("val"), val)
+	ttl, err := db.TTL(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+
+	// The expiration time is not changed without options.
+	_, err = db.GetEX(key, GetEXOptions{})
+	assert.Nil(t, err)
+	ttl, err = db.TTL(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+
+	// The patches are kept by the rewritten value.
+	_, err = db.SetBit(key, 7, true)
+	assert.Nil(t, err)
+	val, err = db.GetEX(key, GetEXOptions{Persist: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("wal"), val)
+	assert.Nil(t, db.Close())
+	db = newKhighDB(ioType, mode)
+	val, err = db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("wal"), val)
+	ttl, err = db.TTL(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), ttl)
+
+	val, err = db.GetEX(key, GetEXOptions{ExpireAt: time.Now().Add(-time.Second)})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("wal"), val)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	_, err = db.GetEX(key, GetEXOptions{Persist: true, TTL: time.Second})
+	assert.Equal(t, ErrConflictingOptions, err)
+}
+
+func testKhighDBSetRange(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer func() { destroyDB(db) }()
+
+	// The empty value does not create the key.
+	key := []byte("key")
+	n, err := db.SetRange(key, 5, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	n, err = db.SetRange(key, 2, []byte("ab"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	val, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("\x00\x00ab"), val)
+
+	assert.Nil(t, db.SetEX(key, []byte("Hello World"), time.Hour))
+	n, err = db.SetRange(key, 6, []byte("Redis"))
+	assert.Nil(t, err)
+	assert.Equal(t, 11, n)
+	n, err = db.SetRange(key, 13, []byte("!"))
+	assert.Nil(t, err)
+	assert.Equal(t, 14, n)
+	assert.Equal(t, 14, db.StrLen(key))
+	n, err = db.SetRange(key, 20, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 14, n)
+
+	// The bytes and the time to live are kept after reopening.
+	assert.Nil(t, db.Close())
+	db = newKhighDB(ioType, mode)
+	val, err = db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("Hello Redis\x00\x00!"), val)
+	ttl, err := db.TTL(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+
+	_, err = db.SetRange(key, -1, []byte("a"))
+	assert.Equal(t, ErrIndexOutOfRange, err)
+	_, err = db.SetRange(key, maxStrSize, []byte("a"))
+	assert.Equal(t, ErrStrTooLarge, err)
+	assert.Nil(t, db.SAdd([]byte("set"), []byte("m")))
+	_, err = db.SetRange([]byte("set"), 0, []byte("a"))
+	assert.Equal(t, ErrWrongType, err)
+}
@@ -0,0 +1,428 @@
+package khighdb
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/Khighness/khighdb/flock"
+	"github.com/Khighness/khighdb/storage"
+	"github.com/Khighness/khighdb/util"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// ErrUpgradeDstNotEmpty represents the destination directory of upgrade is not empty.
+var ErrUpgradeDstNotEmpty = errors.New("upgrade destination directory is not empty")
+
+const (
+	upgradeTmpSuffix    = ".upgrading"
+	upgradeBackupSuffix = ".bak"
+)
+
+// UpgradeOptions defines the options for upgrading the on-disk format of a db directory.
+type UpgradeOptions struct {
+	// SrcPath is the path of db directory to be upgraded.
+	SrcPath string
+
+	// DstPath is the path of directory to write the upgraded db into, which must be empty
+	// or not exist. If it is empty, the db directory will be upgraded in place.
+	DstPath string
+
+	// LogFileSizeThreshold is the threshold size of each upgraded log file.
+	// Note that this value should be the same as Options.LogFileSizeThreshold.
+	LogFileSizeThreshold int64
+
+	// KeepBackup is whether to keep the original directory as SrcPath + ".bak"
+	// after the directory is upgraded in place.
+	KeepBackup bool
+}
+
+// Upgrade migrates the db directory to storage.CurrentFormatVersion.
+// All the log entries are read in their original format and rewritten in order,
+// so the upgraded directory can be opened directly. Value log files are copied as
+// they are, because the value pointers refer to their fids and offsets, and every
+// log file is readable in the format version of its own header, so a new value log file
+// is created to hold the values written after upgrade. Discard files are rebuilt
+// from scratch, which means the discarded size collected before is reset.
+// The db directory must not be opened by any process during upgrade.
+func Upgrade(opts UpgradeOptions) error {
+	lockGuard, err := flock.AcquireFileLock(filepath.Join(opts.SrcPath, lockFileName), false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if lockGuard != nil {
+			_ = lockGuard.Release()
+		}
+	}()
+
+	version, err := storage.ReadManifest(opts.SrcPath)
+	if err == storage.ErrManifestNotFound {
+		version = storage.FormatV1
+	} else if err != nil {
+		return err
+	}
+	if version > storage.CurrentFormatVersion {
+		return storage.ErrUnsupportedFormatVersion
+	}
+	if version == storage.CurrentFormatVersion {
+		zap.S().Infof("Directory [%s] is already in format version %d", opts.SrcPath, version)
+		if opts.DstPath != "" {
+			return util.CopyDir(opts.SrcPath, opts.DstPath)
+		}
+		return nil
+	}
+
+	inPlace := opts.DstPath == ""
+	dstPath := opts.DstPath
+	if inPlace {
+		dstPath = filepath.Clean(opts.SrcPath) + upgradeTmpSuffix
+		if err = os.RemoveAll(dstPath); err != nil {
+			return err
+		}
+	} else if err = checkUpgradeDst(dstPath); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dstPath, os.ModePerm); err != nil {
+		return err
+	}
+
+	zap.S().Infof("Upgrade [%s] from format version %d to %d", opts.SrcPath, version, storage.CurrentFormatVersion)
+	if err = upgradeLogFiles(opts.SrcPath, dstPath, opts.LogFileSizeThreshold, version); err != nil {
+		return err
+	}
+	if err = storage.WriteManifest(dstPath, storage.CurrentFormatVersion); err != nil {
+		return err
+	}
+	if !inPlace {
+		return nil
+	}
+
+	// Swap the upgraded directory with the original one, the lock is held until the upgraded
+	// directory is in place, so that the db can not be opened in the meantime.
+	backupPath := filepath.Clean(opts.SrcPath) + upgradeBackupSuffix
+	if err = os.RemoveAll(backupPath); err != nil {
+		return err
+	}
+	if err = os.Rename(opts.SrcPath, backupPath); err != nil {
+		return err
+	}
+	if err = os.Rename(dstPath, opts.SrcPath); err != nil {
+		return err
+	}
+	if err = lockGuard.Release(); err != nil {
+		return err
+	}
+	lockGuard = nil
+	if !opts.KeepBackup {
+		return os.RemoveAll(backupPath)
+	}
+	return nil
+}
+
+// checkUpgradeDst checks if the destination directory is empty.
+func checkUpgradeDst(path string) error {
+	fileInfos, err := ioutil.ReadDir(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(fileInfos) > 0 {
+		return ErrUpgradeDstNotEmpty
+	}
+	return nil
+}
+
+// upgradeLogFiles rewrites all the log files in srcPath into dstPath with current format version.
+func upgradeLogFiles(srcPath, dstPath string, threshold int64, version storage.FormatVersion) error {
+	fileInfos, err := ioutil.ReadDir(srcPath)
+	if err != nil {
+		return err
+	}
+	discardPath := filepath.Join(dstPath, discardFilePath)
+	if err = os.MkdirAll(discardPath, os.ModePerm); err != nil {
+		return err
+	}
+
+	fidMap := make(map[storage.FileType][]uint32)
+	var vlogFids []uint32
+	for _, file := range fileInfos {
+		if !strings.HasPrefix(file.Name(), storage.FilePrefix) {
+			continue
+		}
+		fileType, fid, err := storage.ParseLogFileName(file.Name())
+		if err != nil {
+			return err
+		}
+		if fileType == storage.VLog {
+			err = util.CopyFile(filepath.Join(srcPath, file.Name()), filepath.Join(dstPath, file.Name()))
+			if err != nil {
+				return err
+			}
+			vlogFids = append(vlogFids, fid)
+			continue
+		}
+		fidMap[fileType] = append(fidMap[fileType], fid)
+	}
+	if len(vlogFids) > 0 {
+		dis, err := newDiscard(discardPath, storage.FileNamesMap[storage.VLog]+discardFileName, 0)
+		if err != nil {
+			return err
+		}
+		for _, fid := range vlogFids {
+			dis.setTotal(fid, uint32(threshold))
+		}
+		// The value log files are read in the format version of their headers, so a new value
+		// log file is created as the active one, the older ones are never written again.
+		if version < storage.FormatV5 {
+			sort.Slice(vlogFids, func(i, j int) bool {
+				return vlogFids[i] < vlogFids[j]
+			})
+			fid := vlogFids[len(vlogFids)-1] + 1
+			vlogFile, err := storage.OpenLogFile(dstPath, fid, threshold, storage.VLog, storage.FileIO)
+			if err != nil {
+				return err
+			}
+			if err = vlogFile.Close(); err != nil {
+				return err
+			}
+			dis.setTotal(fid, uint32(threshold))
+		}
+		if err = dis.sync(); err != nil {
+			return err
+		}
+		dis.closeChan()
+	}
+
+	for fileType, fids := range fidMap {
+		sort.Slice(fids, func(i, j int) bool {
+			return fids[i] < fids[j]
+		})
+
+		dis, err := newDiscard(discardPath, storage.FileNamesMap[fileType]+discardFileName, 0)
+		if err != nil {
+			return err
+		}
+		var dstFile *storage.LogFile
+		rotate := func() error {
+			var fid uint32 = storage.InitialLogField
+			if dstFile != nil {
+				fid = dstFile.Fid + 1
+				if err := dstFile.Sync(); err != nil {
+					return err
+				}
+				if err := dstFile.Close(); err != nil {
+					return err
+				}
+			}
+			logFile, err := storage.OpenLogFile(dstPath, fid, threshold, fileType, storage.FileIO)
+			if err != nil {
+				return err
+			}
+			dis.setTotal(fid, uint32(threshold))
+			dstFile = logFile
+			return nil
+		}
+		if err = rotate(); err != nil {
+			return err
+		}
+		// positions maps the positions of entries in source log files to the upgraded ones.
+		var positions upgradedPositions
+		var setMembers *setMemberTracker
+		if fileType == storage.Sets && version < storage.FormatV4 {
+			setMembers = newSetMemberTracker()
+		}
+
+		for _, fid := range fids {
+			// The source log file is opened read-only, nothing is written into it.
+			srcFile, err := storage.OpenLogFileReadOnly(srcPath, fid, fileType)
+			if err != nil {
+				return err
+			}
+			var offset = srcFile.HeaderSize()
+			for {
+				ent, size, err := srcFile.ReadLogEntry(offset)
+				if err != nil {
+					if err == io.EOF || err == storage.ErrEndOfEntry {
+						break
+					}
+					_ = srcFile.Close()
+					return err
+				}
+				srcOffset := offset
+				offset += size
+				if setMembers != nil {
+					if ent = setMembers.convert(ent); ent == nil {
+						continue
+					}
+				}
+				if fileType == storage.List && version < storage.FormatV5 {
+					if err = upgradeListEntry(ent, version); err != nil {
+						_ = srcFile.Close()
+						return err
+					}
+				}
+				// The key delete entry moved by log file gc carries its original position,
+				// which must be converted to the upgraded one.
+				if ent.Type == storage.TypeKeyDelete && len(ent.Value) > 0 {
+					ent.Value = positions.convert(ent.Value)
+				}
+
+				buf, _ := storage.EncodeEntry(ent)
+				if dstFile.WriteAt+int64(len(buf)) > threshold {
+					if err = rotate(); err != nil {
+						_ = srcFile.Close()
+						return err
+					}
+				}
+				positions = append(positions, upgradedPosition{
+					srcFid: fid, srcOffset: srcOffset, fid: dstFile.Fid, offset: dstFile.WriteAt,
+				})
+				if err = dstFile.Write(buf); err != nil {
+					_ = srcFile.Close()
+					return err
+				}
+			}
+			if err = srcFile.Close(); err != nil {
+				return err
+			}
+		}
+
+		if err = dstFile.Sync(); err != nil {
+			return err
+		}
+		if err = dstFile.Close(); err != nil {
+			return err
+		}
+		if err = dis.sync(); err != nil {
+			return err
+		}
+		dis.closeChan()
+	}
+	return nil
+}
+
+// upgradeListEntry converts the keys of list elements written before storage.FormatV5, which
+// have no fraction. The entries in a batch entry are converted too.
+func upgradeListEntry(ent *storage.LogEntry, version storage.FormatVersion) error {
+	switch ent.Type {
+	case storage.TypeListMeta, storage.TypeKeyDelete:
+	case storage.TypeBatch:
+		ents, _, err := storage.DecodeBatch(ent.Value, version)
+		if err != nil {
+			return err
+		}
+		for _, e := range ents {
+			if err = upgradeListEntry(e, version); err != nil {
+				return err
+			}
+		}
+		ent.Value, _ = storage.EncodeBatch(ents)
+	default:
+		ent.Key = upgradeListKey(ent.Key)
+	}
+	return nil
+}
+
+// upgradeListKey converts the key of list element written before storage.FormatV5 to the key
+// without fraction, see encodeListKey.
+func upgradeListKey(key []byte) []byte {
+	buf := make([]byte, len(key)+1)
+	copy(buf[:4], key[:4])
+	copy(buf[5:], key[4:])
+	return buf
+}
+
+// upgradeValueLogKey converts the key of value log entry written before storage.FormatV5, only
+// the key of list element is changed.
+func upgradeValueLogKey(key []byte) []byte {
+	dataType, logKey := decodeValueLogKey(key)
+	if dataType != List {
+		return key
+	}
+	return encodeValueLogKey(List, upgradeListKey(logKey))
+}
+
+// upgradedPosition records the position of an entry in source log files and the upgraded one.
+type upgradedPosition struct {
+	srcFid    uint32
+	srcOffset int64
+	fid       uint32
+	offset    int64
+}
+
+// upgradedPositions holds the upgraded positions of entries in the order of the source ones.
+type upgradedPositions []upgradedPosition
+
+// convert converts the encoded position in source log files to the upgraded one. The entries
+// before the position are all deleted, so it is converted to the upgraded position of the first
+// entry at or after it, and the position after all entries if there is none.
+func (ps upgradedPositions) convert(pos []byte) []byte {
+	if len(ps) == 0 {
+		return encodeLogPos(storage.InitialLogField, 0)
+	}
+	fid, offset := decodeLogPos(pos)
+	i := sort.Search(len(ps), func(i int) bool {
+		return ps[i].srcFid > fid || (ps[i].srcFid == fid && ps[i].srcOffset >= offset)
+	})
+	if i == len(ps) {
+		last := ps[len(ps)-1]
+		return encodeLogPos(last.fid, last.offset+1)
+	}
+	return encodeLogPos(ps[i].fid, ps[i].offset)
+}
+
+// setMemberTracker tracks the members of all the sets while upgrading, to convert the delete
+// entries of set written before storage.FormatV4, whose values are the murmur sums of members,
+// to carry the members.
+type setMemberTracker struct {
+	// members maps the key of set to the members indexed by their murmur sums.
+	members map[string]map[string][]byte
+}
+
+func newSetMemberTracker() *setMemberTracker {
+	return &setMemberTracker{members: make(map[string]map[string][]byte)}
+}
+
+// convert converts the entry of set in order, nil is returned if the entry deletes nothing.
+func (t *setMemberTracker) convert(ent *storage.LogEntry) *storage.LogEntry {
+	switch ent.Type {
+	case storage.TypeKeyDelete:
+		delete(t.members, string(ent.Key))
+	case storage.TypeDelete:
+		sums := t.members[string(ent.Key)]
+		member, ok := sums[string(ent.Value)]
+		if !ok {
+			return nil
+		}
+		delete(sums, string(ent.Value))
+		ent.Value = member
+	case storage.TypeSetMove:
+		srcKey, dstKey := new(KhighDB).decodeKey(ent.Key)
+		sum := util.Sum128(ent.Value)
+		delete(t.members[string(srcKey)], string(sum))
+		t.add(dstKey, sum, ent.Value)
+	default:
+		t.add(ent.Key, util.Sum128(ent.Value), ent.Value)
+	}
+	return ent
+}
+
+func (t *setMemberTracker) add(key, sum, member []byte) {
+	sums := t.members[string(key)]
+	if sums == nil {
+		sums = make(map[string][]byte)
+		t.members[string(key)] = sums
+	}
+	sums[string(sum)] = member
+}
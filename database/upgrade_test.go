@@ -0,0 +1,306 @@
+package khighdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Khighness/khighdb/storage"
+	"github.com/Khighness/khighdb/util"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+func TestOpen_FormatVersion(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-format")
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+
+	t.Run("new-directory", func(t *testing.T) {
+		db, err := Open(DefaultOptions(path))
+		assert.Nil(t, err)
+		assert.Nil(t, db.Close())
+		version, err := storage.ReadManifest(path)
+		assert.Nil(t, err)
+		assert.Equal(t, storage.CurrentFormatVersion, version)
+	})
+
+	t.Run("newer-version", func(t *testing.T) {
+		assert.Nil(t, storage.WriteManifest(path, storage.CurrentFormatVersion+1))
+		_, err := Open(DefaultOptions(path))
+		assert.Equal(t, storage.ErrUnsupportedFormatVersion, err)
+	})
+}
+
+func TestUpgrade(t *testing.T) {
+	t.Run("in-place", func(t *testing.T) {
+		testUpgrade(t, false)
+	})
+
+	t.Run("into-new-path", func(t *testing.T) {
+		testUpgrade(t, true)
+	})
+}
+
+func testUpgrade(t *testing.T, newPath bool) {
+	srcPath := filepath.Join("/tmp", "KhighDB-legacy")
+	dstPath := filepath.Join("/tmp", "KhighDB-upgraded")
+	defer func() {
+		_ = os.RemoveAll(srcPath)
+		_ = os.RemoveAll(dstPath)
+	}()
+	writeLegacyLogFile(t, srcPath, storage.Strs, []*storage.LogEntry{
+		{Key: []byte("k1"), Value: []byte("v1")},
+		{Key: []byte("k2"), Value: []byte("v2")},
+		{Key: []byte("k1"), Value: []byte("v1-new")},
+		{Key: []byte("k2"), Type: storage.TypeDelete},
+	})
+	writeLegacyLogFile(t, srcPath, storage.Hash, []*storage.LogEntry{
+		{Key: (&KhighDB{}).encodeKey([]byte("h"), []byte("f")), Value: []byte("hv")},
+	})
+	// The delete entries of set carry the murmur sums of members before FormatV4.
+	writeLegacyLogFile(t, srcPath, storage.Sets, []*storage.LogEntry{
+		{Key: []byte("s"), Value: []byte("m1")},
+		{Key: []byte("s"), Value: []byte("m2")},
+		{Key: []byte("s"), Value: util.Sum128([]byte("m1")), Type: storage.TypeDelete},
+	})
+
+	// The keys of list elements have no fraction before FormatV5.
+	writeLegacyLogFile(t, srcPath, storage.List, []*storage.LogEntry{
+		{Key: legacyListKey([]byte("l"), initialListSeq+1), Value: []byte("a")},
+		{Key: []byte("l"), Value: (&KhighDB{}).listMetaEntry([]byte("l"), initialListSeq, initialListSeq+2).Value,
+			Type: storage.TypeListMeta},
+		{Key: legacyListKey([]byte("l"), initialListSeq+2), Value: []byte("b")},
+		{Key: []byte("l"), Value: (&KhighDB{}).listMetaEntry([]byte("l"), initialListSeq, initialListSeq+3).Value,
+			Type: storage.TypeListMeta},
+	})
+
+	// The empty log file has no file header to detect its format version.
+	writeLegacyLogFile(t, srcPath, storage.ZSet, nil)
+
+	options := DefaultOptions(srcPath)
+	_, err := Open(options)
+	assert.Equal(t, ErrFormatUpgradeRequired, err)
+
+	// srcFiles returns the contents of the log files in srcPath.
+	srcFiles := func() map[string][]byte {
+		files := make(map[string][]byte)
+		for _, fileType := range []storage.FileType{storage.Strs, storage.List, storage.Hash, storage.Sets, storage.ZSet} {
+			fileName := storage.FileNamesMap[fileType] + fmt.Sprintf("%09.d", 0)
+			buf, err := ioutil.ReadFile(filepath.Join(srcPath, fileName))
+			assert.Nil(t, err)
+			files[fileName] = buf
+		}
+		return files
+	}
+	before := srcFiles()
+
+	upgradeOpts := UpgradeOptions{SrcPath: srcPath, LogFileSizeThreshold: options.LogFileSizeThreshold}
+	if newPath {
+		upgradeOpts.DstPath = dstPath
+		options.DBPath = dstPath
+	}
+	assert.Nil(t, Upgrade(upgradeOpts))
+	if newPath {
+		// The source log files are only read.
+		assert.Equal(t, before, srcFiles())
+	}
+
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	v1, err := db.Get([]byte("k1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1-new"), v1)
+	_, err = db.Get([]byte("k2"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	hv, err := db.HGet([]byte("h"), []byte("f"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hv"), hv)
+	assert.Equal(t, []bool{false, true}, db.SMIsMember([]byte("s"), []byte("m1"), []byte("m2")))
+	values, err := db.LRange([]byte("l"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, values)
+
+	// New writes go to the upgraded log files.
+	assert.Nil(t, db.Set([]byte("k3"), []byte("v3")))
+	v3, err := db.Get([]byte("k3"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v3"), v3)
+}
+
+func TestUpgrade_ValueLog(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-upgrade-vlog")
+	opts := DefaultOptions(path)
+	opts.ValueLogThreshold = 1 << 10
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	var values = make(map[int][]byte)
+	for i := 0; i < 64; i++ {
+		values[i%8] = getValue4K()
+		assert.Nil(t, db.Set(getKey(i%8), values[i%8]))
+	}
+	assert.Nil(t, db.HSet([]byte("h"), []byte("f"), values[0]))
+	// Wait for the discard channel to be consumed.
+	time.Sleep(100 * time.Millisecond)
+
+	// The value log file 0 is deleted, so the fids of value log files start from 1.
+	assert.Nil(t, db.RunValueLogGC(0, 0.5))
+	vlogFile := filepath.Join(path, storage.FileNamesMap[storage.VLog]+fmt.Sprintf("%09.d", 0))
+	_, err = os.Stat(vlogFile)
+	assert.True(t, os.IsNotExist(err))
+	assert.Nil(t, db.Close())
+
+	assert.Nil(t, storage.WriteManifest(path, storage.FormatV3))
+	assert.Nil(t, Upgrade(UpgradeOptions{SrcPath: path, LogFileSizeThreshold: opts.LogFileSizeThreshold}))
+	version, err := storage.ReadManifest(path)
+	assert.Nil(t, err)
+	assert.Equal(t, storage.CurrentFormatVersion, version)
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+	for i := 0; i < 8; i++ {
+		val, err := db.Get(getKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, values[i], val)
+	}
+	val, err := db.HGet([]byte("h"), []byte("f"))
+	assert.Nil(t, err)
+	assert.Equal(t, values[0], val)
+}
+
+func TestUpgrade_KeyDeleteMoved(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-upgrade-key-delete")
+	opts := DefaultOptions(path)
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	// fill writes garbage until the active log file of hash is fid.
+	fill := func(fid uint32) {
+		for db.getActiveLogFile(Hash).Fid < fid {
+			assert.Nil(t, db.HSet([]byte("garbage"), []byte("garbage"), getValue4K()))
+		}
+	}
+	assert.Nil(t, db.HSet([]byte("h"), []byte("a"), []byte("1")))
+	fill(1)
+	// The key delete entry is written at a larger offset than the field written in log file 2.
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, db.HSet([]byte("garbage"), []byte("garbage"), getValue4K()))
+	}
+	assert.Nil(t, db.HClear([]byte("h")))
+	fill(2)
+	assert.Nil(t, db.HSet([]byte("h"), []byte("c"), []byte("3")))
+	fill(3)
+
+	// The key delete entry is moved from log file 1, which is deleted, so the log files
+	// are renumbered during upgrade.
+	assert.Nil(t, db.RunLogFileGC(Hash, 1, 0))
+	assert.Nil(t, db.getArchivedLogFile(Hash, 1))
+	assert.Nil(t, db.Close())
+
+	assert.Nil(t, storage.WriteManifest(path, storage.FormatV3))
+	assert.Nil(t, Upgrade(UpgradeOptions{SrcPath: path, LogFileSizeThreshold: opts.LogFileSizeThreshold}))
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+	assert.Equal(t, 1, db.HLen([]byte("h")))
+	val, err := db.HGet([]byte("h"), []byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("3"), val)
+}
+
+func TestUpgrade_ListValueLog(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-upgrade-list-vlog")
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	// The value log entry of list element carries the key without fraction before FormatV5.
+	key, large := []byte("l"), getValue4K()
+	elemKey := legacyListKey(key, initialListSeq+1)
+	vent := &storage.LogEntry{Key: encodeValueLogKey(List, elemKey), Value: large}
+	_, ventSize := storage.EncodeEntryVersion(vent, storage.FormatV1)
+	writeLegacyLogFile(t, path, storage.VLog, []*storage.LogEntry{vent})
+	ptr := &valuePtr{fid: 0, offset: 0, entrySize: ventSize}
+	writeLegacyLogFile(t, path, storage.List, []*storage.LogEntry{
+		{Key: elemKey, Value: encodeValuePtr(ptr), Type: storage.TypeValuePtr},
+		{Key: key, Value: (&KhighDB{}).listMetaEntry(key, initialListSeq, initialListSeq+2).Value,
+			Type: storage.TypeListMeta},
+	})
+
+	opts := DefaultOptions(path)
+	opts.ValueLogThreshold = 1 << 10
+	assert.Nil(t, Upgrade(UpgradeOptions{SrcPath: path, LogFileSizeThreshold: opts.LogFileSizeThreshold}))
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+	check := func(db *KhighDB) {
+		values, err := db.LRange(key, 0, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, [][]byte{large}, values)
+	}
+	check(db)
+
+	// The value log file 0 is not written after upgrade, and the value is rewritten by gc.
+	assert.Nil(t, db.RPush(key, large))
+	assert.Equal(t, uint32(1), db.getActiveLogFile(valueLogType).Fid)
+	assert.Nil(t, db.RunValueLogGC(0, 0))
+	assert.Nil(t, db.getArchivedLogFile(valueLogType, 0))
+	values, err := db.LRange(key, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{large}, values)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	values, err = db.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{large, large}, values)
+}
+
+// legacyListKey encodes the key of list element before FormatV5.
+func legacyListKey(key []byte, seq uint32) []byte {
+	buf := make([]byte, len(key)+4)
+	binary.LittleEndian.PutUint32(buf[:4], seq)
+	copy(buf[4:], key)
+	return buf
+}
+
+// writeLegacyLogFile writes entries into a log file without file header, as FormatV1 does.
+func writeLegacyLogFile(t *testing.T, path string, fileType storage.FileType, entries []*storage.LogEntry) {
+	assert.Nil(t, os.MkdirAll(path, os.ModePerm))
+	fileName := filepath.Join(path, storage.FileNamesMap[fileType]+fmt.Sprintf("%09.d", 0))
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, 0644)
+	assert.Nil(t, err)
+	defer func() {
+		assert.Nil(t, file.Close())
+	}()
+	assert.Nil(t, file.Truncate(1<<20))
+
+	var offset int64
+	for _, ent := range entries {
+		buf, size := storage.EncodeEntryVersion(ent, storage.FormatV1)
+		_, err = file.WriteAt(buf, offset)
+		assert.Nil(t, err)
+		offset += int64(size)
+	}
+}
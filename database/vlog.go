@@ -0,0 +1,217 @@
+package khighdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync/atomic"
+
+	"github.com/Khighness/khighdb/data/art"
+	"github.com/Khighness/khighdb/storage"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// valueLogType is the pseudo data type of value log files.
+// The value log shares the log file management with data types, but it holds
+// no index, all the values in it are referenced by the value pointers in indexes.
+const valueLogType = DataType(storage.VLog)
+
+// ErrInvalidValuePtr represents the value pointer can not be decoded.
+var ErrInvalidValuePtr = errors.New("invalid value pointer")
+
+// valuePtr points to a value stored in value log.
+//	The encoded value pointer looks like:
+//	+-----------+-----------+-----------+
+//	|    fid    |   offset  | entrySize |
+//	+-----------+-----------+-----------+
+//	|  uvarint  |  uvarint  |  uvarint  |
+//	+-----------+-----------+-----------+
+type valuePtr struct {
+	fid       uint32
+	offset    int64
+	entrySize int
+}
+
+// encodeValuePtr encodes the value pointer into a byte slice.
+func encodeValuePtr(ptr *valuePtr) []byte {
+	buf := make([]byte, binary.MaxVarintLen32*2+binary.MaxVarintLen64)
+	var index int
+	index += binary.PutUvarint(buf[index:], uint64(ptr.fid))
+	index += binary.PutUvarint(buf[index:], uint64(ptr.offset))
+	index += binary.PutUvarint(buf[index:], uint64(ptr.entrySize))
+	return buf[:index]
+}
+
+// decodeValuePtr decodes the byte slice into a value pointer.
+func decodeValuePtr(buf []byte) (*valuePtr, error) {
+	var index int
+	fid, n := binary.Uvarint(buf[index:])
+	if n <= 0 {
+		return nil, ErrInvalidValuePtr
+	}
+	index += n
+	offset, n := binary.Uvarint(buf[index:])
+	if n <= 0 {
+		return nil, ErrInvalidValuePtr
+	}
+	index += n
+	entrySize, n := binary.Uvarint(buf[index:])
+	if n <= 0 {
+		return nil, ErrInvalidValuePtr
+	}
+	return &valuePtr{fid: uint32(fid), offset: int64(offset), entrySize: int(entrySize)}, nil
+}
+
+// encodeValueLogKey encodes the data type and the key of log entry into the key of value log entry.
+// So that the index of the value can be found during value log gc.
+func encodeValueLogKey(dataType DataType, key []byte) []byte {
+	buf := make([]byte, len(key)+1)
+	buf[0] = byte(dataType)
+	copy(buf[1:], key)
+	return buf
+}
+
+// decodeValueLogKey decodes the key of value log entry into the data type and the key of log entry.
+func decodeValueLogKey(buf []byte) (DataType, []byte) {
+	return DataType(buf[0]), buf[1:]
+}
+
+// separateValue checks if the value of entry should be separated into value log.
+// Only the values of String, List and Hash can be separated.
+func (db *KhighDB) separateValue(ent *storage.LogEntry, dataType DataType) bool {
+	threshold := db.options.ValueLogThreshold
+	if threshold <= 0 || ent.Type != 0 || len(ent.Value) < threshold {
+		return false
+	}
+	return dataType == String || dataType == List || dataType == Hash
+}
+
+// writeValueLog writes the value of entry into value log, and returns the log entry
+// holding the value pointer, which should be written into the log file of data type.
+func (db *KhighDB) writeValueLog(ent *storage.LogEntry, dataType DataType) (*storage.LogEntry, *valuePtr, error) {
+	vent := &storage.LogEntry{
+		Key:       encodeValueLogKey(dataType, ent.Key),
+		Value:     ent.Value,
+		ExpiredAt: ent.ExpiredAt,
+	}
+	pos, err := db.writeLogEntry(vent, valueLogType)
+	if err != nil {
+		return nil, nil, err
+	}
+	ptr := &valuePtr{fid: pos.fid, offset: pos.offset, entrySize: pos.entrySize}
+	ptrEnt := &storage.LogEntry{
+		Key:       ent.Key,
+		Value:     encodeValuePtr(ptr),
+		ExpiredAt: ent.ExpiredAt,
+		Type:      storage.TypeValuePtr,
+	}
+	return ptrEnt, ptr, nil
+}
+
+// readValueLog reads the value the value pointer points to.
+func (db *KhighDB) readValueLog(ptr *valuePtr) ([]byte, error) {
+	ent, err := db.readLogEntry(valueLogType, ptr.fid, ptr.offset)
+	if err != nil {
+		return nil, err
+	}
+	return ent.Value, nil
+}
+
+// readLogEntry reads the log entry at offset of the log file corresponding to the data type and fid.
+func (db *KhighDB) readLogEntry(dataType DataType, fid uint32, offset int64) (*storage.LogEntry, error) {
+	logFile := db.getActiveLogFile(dataType)
+	if logFile == nil {
+		return nil, ErrLogFileNotFound
+	}
+	if logFile.Fid != fid {
+		logFile = db.getArchivedLogFile(dataType, fid)
+	}
+	if logFile == nil {
+		return nil, ErrLogFileNotFound
+	}
+	ent, _, err := logFile.ReadLogEntry(offset)
+	return ent, err
+}
+
+// loadValueLog sets the write offset of the active value log file.
+func (db *KhighDB) loadValueLog() error {
+	logFile := db.activeLogFiles[valueLogType]
+	if logFile == nil {
+		return nil
+	}
+	var offset = logFile.HeaderSize()
+	for {
+		_, entrySize, err := logFile.ReadLogEntry(offset)
+		if err != nil {
+			if err == io.EOF || err == storage.ErrEndOfEntry {
+				break
+			}
+			return err
+		}
+		offset += entrySize
+	}
+	atomic.StoreInt64(&logFile.WriteAt, offset)
+	return nil
+}
+
+// maybeRewriteValue rewrites the value in the archived value log file if it is still referenced
+// by the index. Both the value and the value pointer are rewritten, and the index node is updated.
+func (db *KhighDB) maybeRewriteValue(fid uint32, offset int64, vent *storage.LogEntry) error {
+	dataType, key := decodeValueLogKey(vent.Key)
+
+	var idxTree *art.AdaptiveRadixTree
+	var treeKey = key
+	switch dataType {
+	case String:
+		db.strIndex.mu.Lock()
+		defer db.strIndex.mu.Unlock()
+		idxTree = db.strIndex.idxTree
+	case List:
+		db.listIndex.mu.Lock()
+		defer db.listIndex.mu.Unlock()
+		listKey, _, _ := db.decodeListKey(key)
+		idxTree = db.listIndex.trees[string(listKey)]
+	case Hash:
+		db.hashIndex.mu.Lock()
+		defer db.hashIndex.mu.Unlock()
+		var hashKey []byte
+		hashKey, treeKey = db.decodeKey(key)
+		idxTree = db.hashIndex.trees[string(hashKey)]
+	}
+	if idxTree == nil {
+		return nil
+	}
+	node, _ := idxTree.Get(treeKey).(*indexNode)
+	if node == nil || node.vptr == nil || node.vptr.fid != fid || node.vptr.offset != offset {
+		return nil
+	}
+	// The patches must follow the value, so the patched value is rewritten as a whole.
+	if len(node.patches) > 0 {
+		return db.compactStrInternal(key, node)
+	}
+
+	ent := &storage.LogEntry{Key: key, Value: vent.Value, ExpiredAt: vent.ExpiredAt}
+	ptrEnt, ptr, err := db.writeValueLog(ent, dataType)
+	if err != nil {
+		return err
+	}
+	pos, err := db.writeLogEntry(ptrEnt, dataType)
+	if err != nil {
+		return err
+	}
+	newNode := &indexNode{
+		fid:       pos.fid,
+		offset:    pos.offset,
+		entrySize: pos.entrySize,
+		expiredAt: node.expiredAt,
+		value:     node.value,
+		vptr:      ptr,
+	}
+	idxTree.Put(treeKey, newNode)
+	db.evictCachedVal(dataType, node)
+	// The old value pointer entry is useless now.
+	db.sendDiscard(&indexNode{fid: node.fid, entrySize: node.entrySize}, true, dataType)
+	return nil
+}
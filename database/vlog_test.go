@@ -0,0 +1,126 @@
+package khighdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Khighness/khighdb/storage"
+)
+
+// @Author KHighness
+// @Update 2023-01-13
+
+func TestKhighDB_encodeValuePtr_decodeValuePtr(t *testing.T) {
+	ptr := &valuePtr{fid: 3, offset: 1 << 30, entrySize: 4 << 10}
+	got, err := decodeValuePtr(encodeValuePtr(ptr))
+	assert.Nil(t, err)
+	assert.Equal(t, ptr, got)
+
+	_, err = decodeValuePtr(nil)
+	assert.Equal(t, ErrInvalidValuePtr, err)
+}
+
+func TestKhighDB_ValueLog(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBValueLog(t, FileIO, KeyOnlyMemMode)
+	})
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBValueLog(t, MMap, KeyOnlyMemMode)
+	})
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBValueLog(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func testKhighDBValueLog(t *testing.T, ioType IOType, mode DataIndexMode) {
+	path := filepath.Join("/tmp", "KhighDB-vlog")
+	opts := DefaultOptions(path)
+	opts.IoType = ioType
+	opts.IndexMode = mode
+	opts.ValueLogThreshold = 1 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	smallVal, largeVal := getValue16B(), getValue4K()
+	assert.Nil(t, db.Set(getKey(1), smallVal))
+	assert.Nil(t, db.Set(getKey(2), largeVal))
+	assert.Nil(t, db.HSet(getKey(3), []byte("small"), smallVal, []byte("large"), largeVal))
+	assert.Nil(t, db.RPush(getKey(4), smallVal, largeVal))
+
+	check := func(db *KhighDB) {
+		val, err := db.Get(getKey(1))
+		assert.Nil(t, err)
+		assert.Equal(t, smallVal, val)
+		val, err = db.Get(getKey(2))
+		assert.Nil(t, err)
+		assert.Equal(t, largeVal, val)
+
+		val, err = db.HGet(getKey(3), []byte("small"))
+		assert.Nil(t, err)
+		assert.Equal(t, smallVal, val)
+		val, err = db.HGet(getKey(3), []byte("large"))
+		assert.Nil(t, err)
+		assert.Equal(t, largeVal, val)
+
+		val, err = db.LIndex(getKey(4), 1)
+		assert.Nil(t, err)
+		assert.Equal(t, largeVal, val)
+	}
+	check(db)
+
+	// Only the large values are written into value log.
+	vlog := db.getActiveLogFile(valueLogType)
+	assert.NotNil(t, vlog)
+	assert.True(t, vlog.WriteAt > vlog.HeaderSize()+int64(3*len(largeVal)))
+	assert.True(t, vlog.WriteAt < vlog.HeaderSize()+int64(4*len(largeVal)))
+	strs := db.getActiveLogFile(String)
+	assert.True(t, strs.WriteAt < int64(len(largeVal)))
+
+	// Reopen and the values can be read from the value log.
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	check(db)
+	assert.Equal(t, vlog.WriteAt, db.getActiveLogFile(valueLogType).WriteAt)
+}
+
+func TestKhighDB_RunValueLogGC(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-vlog")
+	opts := DefaultOptions(path)
+	opts.ValueLogThreshold = 1 << 10
+	opts.LogFileSizeThreshold = 64 << 10
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	var values = make(map[int][]byte)
+	for i := 0; i < 64; i++ {
+		values[i%8] = getValue4K()
+		assert.Nil(t, db.Set(getKey(i%8), values[i%8]))
+	}
+	// Wait for the discard channel to be consumed.
+	time.Sleep(100 * time.Millisecond)
+
+	vlogFile := filepath.Join(path, storage.FileNamesMap[storage.VLog]+fmt.Sprintf("%09.d", 0))
+	_, err = os.Stat(vlogFile)
+	assert.Nil(t, err)
+
+	err = db.RunValueLogGC(0, 0.5)
+	assert.Nil(t, err)
+	_, err = os.Stat(vlogFile)
+	assert.True(t, os.IsNotExist(err))
+
+	for i := 0; i < 8; i++ {
+		val, err := db.Get(getKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, values[i], val)
+	}
+}
@@ -0,0 +1,505 @@
+package khighdb
+
+import (
+	"github.com/Khighness/khighdb/data/art"
+	"github.com/Khighness/khighdb/data/zset"
+	"github.com/Khighness/khighdb/storage"
+	"github.com/Khighness/khighdb/util"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// ZSetOpOptions defines the options of ZUnion and ZInter.
+type ZSetOpOptions struct {
+	// Weights are the multiplication factors of the scores in each sorted set,
+	// which must be as many as the keys. All the weights are 1 if it is nil.
+	Weights []float64
+
+	// Aggregate specifies how the scores of the same member are aggregated.
+	// Default value is zset.AggregateSum.
+	Aggregate zset.Aggregate
+}
+
+// zsetOp is the operation on multiple sorted sets.
+type zsetOp int8
+
+const (
+	zsetUnion zsetOp = iota
+	zsetInter
+	zsetDiff
+)
+
+// ZMember is a member of sorted set with its score.
+type ZMember struct {
+	Member []byte
+	Score  float64
+}
+
+// ZRangeOptions defines the options of ZRangeByScore and ZRangeByLex.
+type ZRangeOptions struct {
+	// Reverse makes the elements ordered from high to low, and the range is still given by min and max.
+	Reverse bool
+
+	// Offset is the number of elements skipped from the start of the range.
+	Offset int
+
+	// Count is the max number of returned elements, no limit if it is not positive.
+	Count int
+}
+
+// ZAdd adds the specified member with the specified score to the sorted set stored at key.
+// If the member is already a member of the sorted set, the score is updated.
+func (db *KhighDB) ZAdd(key []byte, score float64, member []byte) error {
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+	defer db.zsetIndex.blocking.serve()
+	return db.zAddInternal(key, score, member)
+}
+
+// ZScore returns the score of member in the sorted set stored at key.
+func (db *KhighDB) ZScore(key, member []byte) (ok bool, score float64) {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+	return db.zsetIndex.indexes.ZScore(string(key), string(member))
+}
+
+// ZRem removes the specified members from the sorted set stored at key, non existing members
+// are ignored. It returns the number of members removed.
+func (db *KhighDB) ZRem(key []byte, members ...[]byte) (int, error) {
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, ZSet)
+
+	var count int
+	for _, member := range members {
+		ok, err := db.zRemInternal(key, member)
+		if err != nil {
+			return count, err
+		}
+		if ok {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ZClear removes the sorted set stored at key with all its members.
+// Only one entry is written no matter how many members the sorted set holds.
+func (db *KhighDB) ZClear(key []byte) error {
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, ZSet)
+
+	return db.clearKeyInternal(key, ZSet)
+}
+
+// ZCard returns the sorted set cardinality (number of members) of the sorted set stored at key.
+func (db *KhighDB) ZCard(key []byte) int {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+	return db.zsetIndex.indexes.ZCard(string(key))
+}
+
+// ZIncrBy increments the score of member in the sorted set stored at key by increment.
+// If member does not exist in the sorted set, it is added with increment as its score.
+func (db *KhighDB) ZIncrBy(key []byte, increment float64, member []byte) (float64, error) {
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+	defer db.zsetIndex.blocking.serve()
+
+	if ok, score := db.zsetIndex.indexes.ZScore(string(key), string(member)); ok {
+		increment += score
+	}
+	if err := db.zAddInternal(key, increment, member); err != nil {
+		return 0, err
+	}
+	return increment, nil
+}
+
+// ZRange returns the specified range of members in the sorted set stored at key,
+// ordered from the lowest to the highest score.
+func (db *KhighDB) ZRange(key []byte, start, stop int) ([][]byte, error) {
+	return db.zRangeInternal(key, start, stop, false)
+}
+
+// ZRevRange returns the specified range of members in the sorted set stored at key,
+// ordered from the highest to the lowest score.
+func (db *KhighDB) ZRevRange(key []byte, start, stop int) ([][]byte, error) {
+	return db.zRangeInternal(key, start, stop, true)
+}
+
+// ZRank returns the rank of member in the sorted set stored at key, with the scores
+// ordered from low to high. The rank is 0-based, ok is false if the member does not exist.
+func (db *KhighDB) ZRank(key, member []byte) (ok bool, rank int) {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+	r := db.zsetIndex.indexes.ZRank(string(key), string(member))
+	return r >= 0, int(r)
+}
+
+// ZRevRank returns the rank of member in the sorted set stored at key, with the scores
+// ordered from high to low. The rank is 0-based, ok is false if the member does not exist.
+func (db *KhighDB) ZRevRank(key, member []byte) (ok bool, rank int) {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+	r := db.zsetIndex.indexes.ZRevRank(string(key), string(member))
+	return r >= 0, int(r)
+}
+
+// ZPopMin removes and returns up to count members with the lowest scores in the sorted set
+// stored at key, ordered from the lowest to the highest score.
+func (db *KhighDB) ZPopMin(key []byte, count int) ([]ZMember, error) {
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, ZSet)
+	return db.zPopInternal(key, count, false)
+}
+
+// ZPopMax removes and returns up to count members with the highest scores in the sorted set
+// stored at key, ordered from the highest to the lowest score.
+func (db *KhighDB) ZPopMax(key []byte, count int) ([]ZMember, error) {
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, ZSet)
+	return db.zPopInternal(key, count, true)
+}
+
+// ZRangeByScore returns all the elements in the sorted set stored at key with a score between
+// min and max. The bounds are inclusive unless prefixed by '(', and '-inf' and '+inf' are allowed.
+func (db *KhighDB) ZRangeByScore(key, min, max []byte, opts ZRangeOptions) ([]ZMember, error) {
+	r, err := zset.ParseScoreRange(string(min), string(max))
+	if err != nil {
+		return nil, err
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+	values := db.zsetIndex.indexes.ZRangeByScore(string(key), r, opts.Offset, opts.limit(), opts.Reverse)
+	return toZMembers(values), nil
+}
+
+// ZRangeByLex returns all the members in the sorted set stored at key between min and max in
+// lexicographical order, which makes sense only when all the members have the same score.
+// The bounds are prefixed by '(' or '[' for exclusive or inclusive, and '-' and '+' are allowed.
+func (db *KhighDB) ZRangeByLex(key, min, max []byte, opts ZRangeOptions) ([][]byte, error) {
+	r, err := zset.ParseLexRange(string(min), string(max))
+	if err != nil {
+		return nil, err
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+	values := db.zsetIndex.indexes.ZRangeByLex(string(key), r, opts.Offset, opts.limit(), opts.Reverse)
+	members := make([][]byte, 0, len(values))
+	for _, value := range values {
+		members = append(members, []byte(value.(string)))
+	}
+	return members, nil
+}
+
+// ZCount returns the number of elements in the sorted set stored at key with a score between
+// min and max, the bounds are parsed like ZRangeByScore.
+func (db *KhighDB) ZCount(key, min, max []byte) (int, error) {
+	r, err := zset.ParseScoreRange(string(min), string(max))
+	if err != nil {
+		return 0, err
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+	return db.zsetIndex.indexes.ZCount(string(key), r), nil
+}
+
+// ZLexCount returns the number of members in the sorted set stored at key between min and max,
+// the bounds are parsed like ZRangeByLex.
+func (db *KhighDB) ZLexCount(key, min, max []byte) (int, error) {
+	r, err := zset.ParseLexRange(string(min), string(max))
+	if err != nil {
+		return 0, err
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+	return db.zsetIndex.indexes.ZLexCount(string(key), r), nil
+}
+
+// ZRemRangeByScore removes all the elements in the sorted set stored at key with a score between
+// min and max, the bounds are parsed like ZRangeByScore. It returns the number of elements removed.
+func (db *KhighDB) ZRemRangeByScore(key, min, max []byte) (int, error) {
+	r, err := zset.ParseScoreRange(string(min), string(max))
+	if err != nil {
+		return 0, err
+	}
+
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, ZSet)
+	return db.zRemMembers(key, db.zsetIndex.indexes.ZRemRangeByScore(string(key), r))
+}
+
+// ZRemRangeByLex removes all the members in the sorted set stored at key between min and max,
+// the bounds are parsed like ZRangeByLex. It returns the number of members removed.
+func (db *KhighDB) ZRemRangeByLex(key, min, max []byte) (int, error) {
+	r, err := zset.ParseLexRange(string(min), string(max))
+	if err != nil {
+		return 0, err
+	}
+
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, ZSet)
+	return db.zRemMembers(key, db.zsetIndex.indexes.ZRemRangeByLex(string(key), r))
+}
+
+// ZRemRangeByRank removes all the elements in the sorted set stored at key with a rank between
+// start and stop, the ranks are 0-based and can be negative like ZRange.
+// It returns the number of elements removed.
+func (db *KhighDB) ZRemRangeByRank(key []byte, start, stop int) (int, error) {
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(key, ZSet)
+	return db.zRemMembers(key, db.zsetIndex.indexes.ZRemRangeByRank(string(key), start, stop))
+}
+
+// ZUnion returns the union of the sorted sets stored at keys, non existing keys are considered
+// to be empty sorted sets. The elements are ordered from the lowest to the highest score.
+func (db *KhighDB) ZUnion(opts ZSetOpOptions, keys ...[]byte) ([]ZMember, error) {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+	return db.zSetOpInternal(zsetUnion, opts, keys)
+}
+
+// ZUnionStore is equal to ZUnion, but the result is stored in destination, which is overwritten
+// if it already exists. It returns the cardinality of the result.
+func (db *KhighDB) ZUnionStore(destination []byte, opts ZSetOpOptions, keys ...[]byte) (int, error) {
+	return db.zStore(destination, zsetUnion, opts, keys)
+}
+
+// ZInter returns the inter of the sorted sets stored at keys.
+// The elements are ordered from the lowest to the highest score.
+func (db *KhighDB) ZInter(opts ZSetOpOptions, keys ...[]byte) ([]ZMember, error) {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+	return db.zSetOpInternal(zsetInter, opts, keys)
+}
+
+// ZInterStore is equal to ZInter, but the result is stored in destination, which is overwritten
+// if it already exists. It returns the cardinality of the result.
+func (db *KhighDB) ZInterStore(destination []byte, opts ZSetOpOptions, keys ...[]byte) (int, error) {
+	return db.zStore(destination, zsetInter, opts, keys)
+}
+
+// ZDiff returns the members of the first sorted set which are not in the other sorted sets,
+// with their scores in the first sorted set.
+// The elements are ordered from the lowest to the highest score.
+func (db *KhighDB) ZDiff(keys ...[]byte) ([]ZMember, error) {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+	return db.zSetOpInternal(zsetDiff, ZSetOpOptions{}, keys)
+}
+
+// ZDiffStore is equal to ZDiff, but the result is stored in destination, which is overwritten
+// if it already exists. It returns the cardinality of the result.
+func (db *KhighDB) ZDiffStore(destination []byte, keys ...[]byte) (int, error) {
+	return db.zStore(destination, zsetDiff, ZSetOpOptions{}, keys)
+}
+
+// limit returns the max number of elements for the sorted set, -1 means no limit.
+func (opts ZRangeOptions) limit() int {
+	if opts.Count <= 0 {
+		return -1
+	}
+	return opts.Count
+}
+
+// zAddInternal adds the member with score to the sorted set stored at key.
+func (db *KhighDB) zAddInternal(key []byte, score float64, member []byte) error {
+	if ok, oldScore := db.zsetIndex.indexes.ZScore(string(key), string(member)); ok && oldScore == score {
+		return nil
+	}
+	if db.zsetIndex.trees[string(key)] == nil {
+		if err := db.claimKey(key, ZSet); err != nil {
+			return err
+		}
+		db.zsetIndex.trees[string(key)] = art.NewART()
+	}
+	idxTree := db.zsetIndex.trees[string(key)]
+	memberKey, err := db.memberKey(idxTree, member, ZSet)
+	if err != nil {
+		return err
+	}
+
+	scoreBuf := []byte(util.Float64ToStr(score))
+	zsetKey := db.encodeKey(key, scoreBuf)
+	ent := &storage.LogEntry{Key: zsetKey, Value: member}
+	pos, err := db.writeLogEntry(ent, ZSet)
+	if err != nil {
+		return err
+	}
+	entry := &storage.LogEntry{Key: memberKey, Value: member}
+	if err = db.updateIndexTree(idxTree, entry, pos, true, ZSet); err != nil {
+		return err
+	}
+	db.zsetIndex.indexes.ZAdd(string(key), score, string(member))
+	db.zsetIndex.blocking.signal(key)
+	return nil
+}
+
+// zRemInternal removes the member from the sorted set stored at key.
+func (db *KhighDB) zRemInternal(key, member []byte) (bool, error) {
+	idxTree := db.zsetIndex.trees[string(key)]
+	if idxTree == nil {
+		return false, nil
+	}
+	memberKey, err := db.findMember(idxTree, member, ZSet)
+	if err != nil || memberKey == nil {
+		return false, err
+	}
+	val, updated := idxTree.Delete(memberKey)
+	db.zsetIndex.indexes.ZRem(string(key), string(member))
+	if idxTree.Size() == 0 {
+		delete(db.zsetIndex.trees, string(key))
+		db.zsetIndex.indexes.ZClear(string(key))
+	}
+
+	entry := &storage.LogEntry{Key: key, Value: member, Type: storage.TypeDelete}
+	if _, err := db.writeLogEntry(entry, ZSet); err != nil {
+		return false, err
+	}
+	db.sendDiscard(val, updated, ZSet)
+	return true, nil
+}
+
+// zPopInternal removes and returns up to count members with the lowest scores, or the highest
+// scores if max is true, in the sorted set stored at key.
+func (db *KhighDB) zPopInternal(key []byte, count int, max bool) ([]ZMember, error) {
+	var members []ZMember
+	for ; count > 0; count-- {
+		card := db.zsetIndex.indexes.ZCard(string(key))
+		if card == 0 {
+			break
+		}
+		rank := 0
+		if max {
+			rank = card - 1
+		}
+		values := db.zsetIndex.indexes.ZGetByRank(string(key), rank)
+		member := ZMember{Member: []byte(values[0].(string)), Score: values[1].(float64)}
+		if _, err := db.zRemInternal(key, member.Member); err != nil {
+			return members, err
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// zRemMembers removes the members which have been removed from the sorted set index,
+// and returns the number of members removed.
+func (db *KhighDB) zRemMembers(key []byte, members []string) (int, error) {
+	idxTree := db.zsetIndex.trees[string(key)]
+	if idxTree == nil {
+		return 0, nil
+	}
+
+	var count int
+	for _, member := range members {
+		memberKey, err := db.findMember(idxTree, []byte(member), ZSet)
+		if err != nil {
+			return count, err
+		}
+		if memberKey == nil {
+			continue
+		}
+		val, updated := idxTree.Delete(memberKey)
+		entry := &storage.LogEntry{Key: key, Value: []byte(member), Type: storage.TypeDelete}
+		if _, err := db.writeLogEntry(entry, ZSet); err != nil {
+			return count, err
+		}
+		db.sendDiscard(val, updated, ZSet)
+		count++
+	}
+	if idxTree.Size() == 0 {
+		delete(db.zsetIndex.trees, string(key))
+		db.zsetIndex.indexes.ZClear(string(key))
+	}
+	return count, nil
+}
+
+// zStore stores the result of the operation on the sorted sets stored at keys in destination.
+// The sorted sets are read and destination is written with the same lock held.
+func (db *KhighDB) zStore(destination []byte, op zsetOp, opts ZSetOpOptions, keys [][]byte) (int, error) {
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+	defer db.releaseKeyIfEmpty(destination, ZSet)
+	defer db.zsetIndex.blocking.serve()
+
+	members, err := db.zSetOpInternal(op, opts, keys)
+	if err != nil {
+		return 0, err
+	}
+	if err = db.claimKey(destination, ZSet); err != nil {
+		return 0, err
+	}
+	if err = db.clearKeyInternal(destination, ZSet); err != nil {
+		return 0, err
+	}
+	for _, member := range members {
+		if err = db.zAddInternal(destination, member.Score, member.Member); err != nil {
+			return 0, err
+		}
+	}
+	return len(members), nil
+}
+
+// zSetOpInternal runs the operation on the sorted sets stored at keys.
+func (db *KhighDB) zSetOpInternal(op zsetOp, opts ZSetOpOptions, keys [][]byte) ([]ZMember, error) {
+	if len(keys) == 0 || (opts.Weights != nil && len(opts.Weights) != len(keys)) {
+		return nil, ErrInvalidNumberOfArgs
+	}
+	zsetKeys := make([]string, len(keys))
+	for i, key := range keys {
+		zsetKeys[i] = string(key)
+	}
+
+	var values []interface{}
+	switch op {
+	case zsetUnion:
+		values = db.zsetIndex.indexes.ZUnion(zsetKeys, opts.Weights, opts.Aggregate)
+	case zsetInter:
+		values = db.zsetIndex.indexes.ZInter(zsetKeys, opts.Weights, opts.Aggregate)
+	case zsetDiff:
+		values = db.zsetIndex.indexes.ZDiff(zsetKeys)
+	}
+	return toZMembers(values), nil
+}
+
+// zRangeInternal returns the members of the sorted set stored at key in the range of rank.
+func (db *KhighDB) zRangeInternal(key []byte, start, stop int, reverse bool) ([][]byte, error) {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	var values []interface{}
+	if reverse {
+		values = db.zsetIndex.indexes.ZRevRange(string(key), start, stop)
+	} else {
+		values = db.zsetIndex.indexes.ZRange(string(key), int64(start), int64(stop))
+	}
+	members := make([][]byte, 0, len(values))
+	for _, value := range values {
+		members = append(members, []byte(value.(string)))
+	}
+	return members, nil
+}
+
+// toZMembers converts the data likes ['member', 'score', 'member', 'score'...] to members.
+func toZMembers(values []interface{}) []ZMember {
+	members := make([]ZMember, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		members = append(members, ZMember{
+			Member: []byte(values[i].(string)),
+			Score:  values[i+1].(float64),
+		})
+	}
+	return members
+}
@@ -0,0 +1,423 @@
+package khighdb
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Khighness/khighdb/data/zset"
+	"github.com/Khighness/khighdb/util"
+)
+
+// @Author KHighness
+// @Update 2023-01-24
+
+func TestKhighDB_ZAdd(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBZAdd(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBZAdd(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBZAdd(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_ZRem(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBZRem(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBZRem(t, MMap, KeyOnlyMemMode)
+	})
+}
+
+func TestKhighDB_ZRangeByScore(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBZRangeByScore(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBZRangeByScore(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBZRangeByScore(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_ZRangeByLex(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	key := []byte("zs")
+	for _, member := range []string{"a", "b", "c", "d"} {
+		assert.Nil(t, db.ZAdd(key, 0, []byte(member)))
+	}
+	members, err := db.ZRangeByLex(key, []byte("(a"), []byte("+"), ZRangeOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("b"), []byte("c"), []byte("d")}, members)
+	members, err = db.ZRangeByLex(key, []byte("-"), []byte("[c"), ZRangeOptions{Reverse: true, Offset: 1, Count: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("b")}, members)
+	n, err := db.ZLexCount(key, []byte("[b"), []byte("[c"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	_, err = db.ZLexCount(key, []byte("b"), []byte("[c"))
+	assert.Equal(t, zset.ErrInvalidLexRange, err)
+}
+
+func TestKhighDB_ZRemRange(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBZRemRange(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBZRemRange(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBZRemRange(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_ZUnionStore(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBZUnionStore(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBZUnionStore(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBZUnionStore(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_ZInter(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	k1, k2 := []byte("z1"), []byte("z2")
+	assert.Nil(t, db.ZAdd(k1, 1, []byte("a")))
+	assert.Nil(t, db.ZAdd(k1, 2, []byte("b")))
+	assert.Nil(t, db.ZAdd(k2, 3, []byte("b")))
+
+	members, err := db.ZInter(ZSetOpOptions{Weights: []float64{1, 2}}, k1, k2)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: []byte("b"), Score: 8}}, members)
+	_, err = db.ZInter(ZSetOpOptions{Weights: []float64{1}}, k1, k2)
+	assert.Equal(t, ErrInvalidNumberOfArgs, err)
+	_, err = db.ZInter(ZSetOpOptions{})
+	assert.Equal(t, ErrInvalidNumberOfArgs, err)
+
+	// The destination is overwritten, even if it is one of the sources.
+	n, err := db.ZInterStore(k1, ZSetOpOptions{Aggregate: zset.AggregateMax}, k1, k2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, db.ZCard(k1))
+	_, score := db.ZScore(k1, []byte("b"))
+	assert.Equal(t, float64(3), score)
+
+	// An empty result deletes the destination.
+	n, err = db.ZInterStore(k1, ZSetOpOptions{}, k1, []byte("missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 0, db.Exists(k1))
+}
+
+func TestKhighDB_ZDiff(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	k1, k2 := []byte("z1"), []byte("z2")
+	assert.Nil(t, db.ZAdd(k1, 2, []byte("a")))
+	assert.Nil(t, db.ZAdd(k1, 1, []byte("b")))
+	assert.Nil(t, db.ZAdd(k1, 3, []byte("c")))
+	assert.Nil(t, db.ZAdd(k2, 0, []byte("a")))
+
+	members, err := db.ZDiff(k1, k2)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: []byte("b"), Score: 1}, {Member: []byte("c"), Score: 3}}, members)
+	n, err := db.ZDiffStore([]byte("dst"), k1, k2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, db.ZCard([]byte("dst")))
+
+	assert.Nil(t, db.Set([]byte("str"), []byte("v")))
+	_, err = db.ZDiffStore([]byte("str"), k1, k2)
+	assert.Equal(t, ErrWrongType, err)
+}
+
+func TestKhighDB_ZPopMin(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testKhighDBZPopMin(t, FileIO, KeyOnlyMemMode)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testKhighDBZPopMin(t, MMap, KeyOnlyMemMode)
+	})
+
+	t.Run("key-val-mem-mode", func(t *testing.T) {
+		testKhighDBZPopMin(t, FileIO, KeyValueMemMode)
+	})
+}
+
+func TestKhighDB_ZIncrBy(t *testing.T) {
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer destroyDB(db)
+
+	score, err := db.ZIncrBy([]byte("zs"), 1.5, []byte("m"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, score)
+	score, err = db.ZIncrBy([]byte("zs"), -3, []byte("m"))
+	assert.Nil(t, err)
+	assert.Equal(t, -1.5, score)
+}
+
+func TestKhighDB_ZSetReopen(t *testing.T) {
+	path := filepath.Join("/tmp", "KhighDB-zset")
+	opts := DefaultOptions(path)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("zs")
+	assert.Nil(t, db.ZAdd(key, 1, []byte("a")))
+	assert.Nil(t, db.ZAdd(key, 2, []byte("b")))
+	assert.Nil(t, db.ZAdd(key, 3, []byte("c")))
+	assert.Nil(t, db.ZAdd(key, 4, []byte("a")))
+	_, err = db.ZRem(key, []byte("b"))
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+
+	members, err := db.ZRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("c"), []byte("a")}, members)
+	ok, score := db.ZScore(key, []byte("a"))
+	assert.True(t, ok)
+	assert.Equal(t, float64(4), score)
+	assert.Equal(t, 2, db.ZCard(key))
+}
+
+func TestKhighDB_ZSetMemberCollision(t *testing.T) {
+	// All the long members collide on the same murmur sum.
+	memberSum = func([]byte) []byte { return []byte{0x2a} }
+	defer func() { memberSum = util.Sum128 }()
+
+	db := newKhighDB(FileIO, KeyOnlyMemMode)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("zs")
+	m1, m2, m3 := []byte("colliding-member-1"), []byte("colliding-member-2"), []byte("colliding-member-3")
+	assert.Nil(t, db.ZAdd(key, 1, m1))
+	assert.Nil(t, db.ZAdd(key, 2, m2))
+	assert.Nil(t, db.ZAdd(key, 3, m3))
+	assert.Nil(t, db.ZAdd(key, 4, m1))
+	n, err := db.ZRem(key, m2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 2, db.zsetIndex.trees[string(key)].Size())
+
+	assert.Nil(t, db.Close())
+	db = newKhighDB(FileIO, KeyOnlyMemMode)
+
+	members, err := db.ZRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{m3, m1}, members)
+	assert.Equal(t, 2, db.zsetIndex.trees[string(key)].Size())
+	n, err = db.ZRem(key, m1, m3)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 0, db.Exists(key))
+}
+
+func testKhighDBZAdd(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer destroyDB(db)
+
+	key := []byte("zs")
+	assert.Nil(t, db.ZAdd(key, 30, []byte("c")))
+	assert.Nil(t, db.ZAdd(key, 10, []byte("a")))
+	assert.Nil(t, db.ZAdd(key, 20, []byte("b")))
+	assert.Nil(t, db.ZAdd(key, 20, []byte("b")))
+	assert.Equal(t, 3, db.ZCard(key))
+
+	ok, score := db.ZScore(key, []byte("b"))
+	assert.True(t, ok)
+	assert.Equal(t, float64(20), score)
+	ok, _ = db.ZScore(key, []byte("not-exist"))
+	assert.False(t, ok)
+
+	members, err := db.ZRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c")}, members)
+	members, err = db.ZRevRange(key, 0, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("c"), []byte("b")}, members)
+
+	ok, rank := db.ZRank(key, []byte("c"))
+	assert.True(t, ok)
+	assert.Equal(t, 2, rank)
+	ok, rank = db.ZRevRank(key, []byte("c"))
+	assert.True(t, ok)
+	assert.Equal(t, 0, rank)
+	ok, _ = db.ZRank(key, []byte("not-exist"))
+	assert.False(t, ok)
+}
+
+func testKhighDBZRem(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer destroyDB(db)
+
+	key := []byte("zs")
+	assert.Nil(t, db.ZAdd(key, 1, []byte("a")))
+	assert.Nil(t, db.ZAdd(key, 2, []byte("b")))
+
+	n, err := db.ZRem(key, []byte("a"), []byte("not-exist"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, db.ZCard(key))
+
+	n, err = db.ZRem(key, []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 0, db.ZCard(key))
+	members, err := db.ZRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Empty(t, members)
+}
+
+func testKhighDBZRangeByScore(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer destroyDB(db)
+
+	key := []byte("zs")
+	for i := 1; i <= 5; i++ {
+		assert.Nil(t, db.ZAdd(key, float64(i), []byte{'a' + byte(i-1)}))
+	}
+	members, err := db.ZRangeByScore(key, []byte("(1"), []byte("3"), ZRangeOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: []byte("b"), Score: 2}, {Member: []byte("c"), Score: 3}}, members)
+	members, err = db.ZRangeByScore(key, []byte("-inf"), []byte("+inf"), ZRangeOptions{Reverse: true, Offset: 1, Count: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: []byte("d"), Score: 4}, {Member: []byte("c"), Score: 3}}, members)
+	members, err = db.ZRangeByScore([]byte("missing"), []byte("-inf"), []byte("+inf"), ZRangeOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, members)
+
+	n, err := db.ZCount(key, []byte("2"), []byte("(4"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	_, err = db.ZCount(key, []byte("x"), []byte("4"))
+	assert.Equal(t, zset.ErrInvalidScoreRange, err)
+}
+
+func testKhighDBZRemRange(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("zs")
+	for i := 1; i <= 6; i++ {
+		assert.Nil(t, db.ZAdd(key, float64(i), []byte{'a' + byte(i-1)}))
+	}
+	n, err := db.ZRemRangeByScore(key, []byte("(1"), []byte("2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = db.ZRemRangeByRank(key, -2, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = db.ZRemRangeByLex(key, []byte("[c"), []byte("[c"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.Nil(t, db.Close())
+	db = newKhighDB(ioType, mode)
+
+	members, err := db.ZRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("d")}, members)
+	ok, score := db.ZScore(key, []byte("d"))
+	assert.True(t, ok)
+	assert.Equal(t, float64(4), score)
+
+	// The sorted set is deleted after all its members are removed.
+	n, err = db.ZRemRangeByRank(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 0, db.Exists(key))
+	assert.Nil(t, db.Set(key, []byte("v")))
+}
+
+func testKhighDBZUnionStore(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer func() { destroyDB(db) }()
+
+	k1, k2, dst := []byte("z1"), []byte("z2"), []byte("dst")
+	assert.Nil(t, db.ZAdd(k1, 1, []byte("a")))
+	assert.Nil(t, db.ZAdd(k1, 2, []byte("b")))
+	assert.Nil(t, db.ZAdd(k2, 3, []byte("b")))
+	assert.Nil(t, db.ZAdd(k2, 4, []byte("c")))
+	assert.Nil(t, db.ZAdd(dst, 9, []byte("old")))
+
+	members, err := db.ZUnion(ZSetOpOptions{}, k1, k2)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: []byte("a"), Score: 1}, {Member: []byte("c"), Score: 4},
+		{Member: []byte("b"), Score: 5}}, members)
+	n, err := db.ZUnionStore(dst, ZSetOpOptions{Weights: []float64{1, 0.5}, Aggregate: zset.AggregateMin}, k1, k2)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	assert.Nil(t, db.Close())
+	db = newKhighDB(ioType, mode)
+
+	members2, err := db.ZRange(dst, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c")}, members2)
+	ok, score := db.ZScore(dst, []byte("b"))
+	assert.True(t, ok)
+	assert.Equal(t, 1.5, score)
+	ok, _ = db.ZScore(dst, []byte("old"))
+	assert.False(t, ok)
+}
+
+func testKhighDBZPopMin(t *testing.T, ioType IOType, mode DataIndexMode) {
+	db := newKhighDB(ioType, mode)
+	defer func() { destroyDB(db) }()
+
+	key := []byte("jobs")
+	members, err := db.ZPopMin(key, 1)
+	assert.Nil(t, err)
+	assert.Empty(t, members)
+	for i := 1; i <= 5; i++ {
+		assert.Nil(t, db.ZAdd(key, float64(i), []byte{'a' + byte(i-1)}))
+	}
+
+	members, err = db.ZPopMin(key, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: []byte("a"), Score: 1}, {Member: []byte("b"), Score: 2}}, members)
+	members, err = db.ZPopMax(key, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: []byte("e"), Score: 5}}, members)
+
+	// The popped members never reappear after restart.
+	assert.Nil(t, db.Close())
+	db = newKhighDB(ioType, mode)
+	assert.Equal(t, 2, db.ZCard(key))
+	ok, _ := db.ZScore(key, []byte("a"))
+	assert.False(t, ok)
+
+	members, err = db.ZPopMax(key, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: []byte("d"), Score: 4}, {Member: []byte("c"), Score: 3}}, members)
+	assert.Equal(t, 0, db.Exists(key))
+}
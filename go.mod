@@ -4,7 +4,6 @@ go 1.16
 
 require (
 	github.com/natefinch/lumberjack v2.0.0+incompatible
-	github.com/plar/go-adaptive-radix-tree v1.0.5
 	github.com/spaolacci/murmur3 v1.1.0
 	github.com/stretchr/testify v1.8.1
 	github.com/tidwall/redcon v1.6.0
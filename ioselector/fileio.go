@@ -3,7 +3,7 @@ package ioselector
 import "os"
 
 // @Author KHighness
-// @Update 2022-12-25
+// @Update 2023-01-26
 
 // FileIOSelector represents using standard file I/O.
 type FileIOSelector struct {
@@ -24,6 +24,18 @@ func NewFileIOSelector(fileName string, fileSize int64) (IOSelector, error) {
 	}, nil
 }
 
+// NewReadOnlyFileIOSelector creates a file io selector which opens an existing file read-only,
+// the file is neither created nor truncated, and writing to it always fails.
+func NewReadOnlyFileIOSelector(fileName string) (IOSelector, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &FileIOSelector{
+		fd: file,
+	}, nil
+}
+
 // Write is a wrapper of os.File.WriteAt.
 func (fio *FileIOSelector) Write(b []byte, offset int64) (int, error) {
 	return fio.fd.WriteAt(b, offset)
@@ -10,7 +10,7 @@ import (
 )
 
 // @Author KHighness
-// @Update 2022-12-25
+// @Update 2023-01-26
 
 func TestNewFileIOSelector(t *testing.T) {
 	testNewIOSelector(t, 0)
@@ -230,6 +230,9 @@ func testIOSelectorRead(t *testing.T, ioType uint8) {
 		{
 			"EOF-2", fields{selector: selector}, args{b: make([]byte, 100), offset: 1024}, 0, true,
 		},
+		{
+			"EOF-short", fields{selector: selector}, args{b: make([]byte, 10), offset: 95}, 5, true,
+		},
 	}
 	for i, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -8,7 +8,7 @@ import (
 )
 
 // @Author KHighness
-// @Update 2022-12-25
+// @Update 2023-01-26
 
 // MMapSelector represents using memory-mapped file I/O.
 type MMapSelector struct {
@@ -51,14 +51,17 @@ func (ms MMapSelector) Write(b []byte, offset int64) (int, error) {
 }
 
 // Read copys data from mapped region(buf) into slice b at offset.
+// Like os.File.ReadAt, it returns io.EOF with the number of bytes read if the region
+// is shorter than b.
 func (ms MMapSelector) Read(b []byte, offset int64) (int, error) {
 	if offset < 0 || offset >= ms.bufLen {
 		return 0, io.EOF
 	}
-	if offset+int64(len(b)) >= ms.bufLen {
-		return 0, io.EOF
+	n := copy(b, ms.buf[offset:])
+	if n < len(b) {
+		return n, io.EOF
 	}
-	return copy(b, ms.buf[offset:]), nil
+	return n, nil
 }
 
 // Sync synchronizes the mapped buffer to the file's contents on disk.
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// @Author KHighness
+// @Update 2023-01-26
+
+// ErrUnsupportedFormatVersion represents the on-disk format version is unknown to this build.
+var ErrUnsupportedFormatVersion = errors.New("storage: unsupported format version")
+
+// FormatVersion defines the version of the on-disk format.
+type FormatVersion uint32
+
+const (
+	// FormatV1 is the original layout, files carry no header and entries start at offset 0.
+	FormatV1 FormatVersion = iota + 1
+
+	// FormatV2 adds a file header to every log file and discard file.
+	FormatV2
+
+	// FormatV3 encodes the sizes in entry header as uvarints and omits zero expiredAt.
+	FormatV3
+
+	// FormatV4 writes the member instead of its murmur sum into the delete entry of set.
+	FormatV4
+
+	// FormatV5 adds the fraction of the element inserted into the middle of list to its key.
+	FormatV5
+
+	// CurrentFormatVersion is the format version written by this build.
+	CurrentFormatVersion = FormatV5
+)
+
+const (
+	// FileMagic is the magic number at the beginning of every versioned file, "KHDB".
+	FileMagic uint32 = 0x4b484442
+
+	// FileHeaderSize is the size of file header.
+	//	The structure of file header is as follows:
+	//	+-----------+-----------+
+	//	|   magic   |  version  |
+	//	+-----------+-----------+
+	//	|   uint32  |   uint32  |
+	//	+-----------+-----------+
+	FileHeaderSize = 8
+)
+
+// Supported returns whether the format version can be read by this build.
+func (v FormatVersion) Supported() bool {
+	return v >= FormatV1 && v <= CurrentFormatVersion
+}
+
+// HeaderSize returns the size of file header in this format version.
+func (v FormatVersion) HeaderSize() int64 {
+	if v < FormatV2 {
+		return 0
+	}
+	return FileHeaderSize
+}
+
+// EncodeFileHeader encodes the file header of the specified format version.
+func EncodeFileHeader(version FormatVersion) []byte {
+	buf := make([]byte, FileHeaderSize)
+	binary.LittleEndian.PutUint32(buf[:4], FileMagic)
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(version))
+	return buf
+}
+
+// DecodeFileHeader decodes the file header, ok is false if the buf does not start with FileMagic.
+func DecodeFileHeader(buf []byte) (version FormatVersion, ok bool) {
+	if len(buf) < FileHeaderSize || binary.LittleEndian.Uint32(buf[:4]) != FileMagic {
+		return 0, false
+	}
+	return FormatVersion(binary.LittleEndian.Uint32(buf[4:8])), true
+}
+
+// isZero checks if all bytes of buf are zero.
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -6,17 +6,22 @@ import (
 )
 
 // @Author KHighness
-// @Update 2022-12-25
+// @Update 2023-01-26
 
 // MaxMetaSize defines the max size of entry header.
 //	The structure of entry header is as follows:
 //	+-----------+-----------+-----------+-----------+-----------+
 //	|   crc32   |    type   |  keySize  | valueSize | expiredAt |
 //	+-----------+-----------+-----------+-----------+-----------+
-//	|   uint32  |    byte   |   uint32  |   uint32  |   int64   |
+//	|   uint32  |    byte   |  uvarint  |  uvarint  |  varint   |
 //	+-----------+-----------+-----------+-----------+-----------+
-//	So, MaxMetaSize = 4 + 1 + 4 + 4 + 8 = 21.
-const MaxMetaSize = 21
+//	The sizes are at most 5 bytes as they never exceed uint32, and
+//	expiredAt is at most 10 bytes, so MaxMetaSize = 4 + 1 + 5 + 5 + 10 = 25.
+const MaxMetaSize = 25
+
+// entryExpiredFlag is set in the type byte of FormatV3 entry header
+// if the entry has expiredAt, otherwise expiredAt is omitted.
+const entryExpiredFlag = 0x80
 
 // EntryType defines the type of log entry.
 type EntryType byte
@@ -26,6 +31,21 @@ const (
 	TypeDelete EntryType = iota + 1
 	// TypeListMeta represents entry is list meta.
 	TypeListMeta
+	// TypeValuePtr represents entry value is a pointer to the value stored in value log.
+	TypeValuePtr
+	// TypeKeyDelete represents entry deletes all the elements of a collection key, the
+	// entries of the key written before it are invalid. If it is moved by log file gc, its
+	// value is its original position, and only the entries written before the position are invalid.
+	TypeKeyDelete
+	// TypeSetMove represents entry moves a member from a set to another set, its key is
+	// encoded by the source key and the destination key, and its value is the member.
+	TypeSetMove
+	// TypeStrPatch represents entry patches the string value of its key, its value is encoded
+	// by the byte offset in the string value and the bytes written at the offset.
+	TypeStrPatch
+	// TypeBatch represents entry is a batch of entries which are written atomically, its value
+	// is encoded by the entries, and each of them can be read at its own offset in log file.
+	TypeBatch
 )
 
 // LogEntry is the data which will be appended in log file.
@@ -45,14 +65,26 @@ type entryMeta struct {
 	expiredAt int64 // time.Unix
 }
 
-// EncodeEntry will encode entry into a byte slice.
+// EncodeEntry will encode entry into a byte slice in CurrentFormatVersion.
 //	The encoded entry looks like:
-//	+-----------+-----------+-----------+-----------+-----------+-----------+-----------+
-//	|   crc32   |    type   |  KeySize  | ValueSize | expiredAt |    key    |   value   |
-//	+-----------+-----------+-----------+-----------+-----------+-----------+-----------+
-//	|<------------------------META INFO------------------------>|
-//              |<---------------------------CRC CHECK SUM---------------------------->|
+//	+-----------+-----------+-----------+-----------+-------------+-----------+-----------+
+//	|   crc32   |    type   |  keySize  | valueSize | [expiredAt] |    key    |   value   |
+//	+-----------+-----------+-----------+-----------+-------------+-----------+-----------+
+//	|   uint32  |    byte   |  uvarint  |  uvarint  |   varint    |   bytes   |   bytes   |
+//	+-----------+-----------+-----------+-----------+-------------+-----------+-----------+
+//	|<-------------------------META INFO-------------------------->|
+//	            |<-----------------------------CRC CHECK SUM----------------------------->|
+//	The type byte is ORed with entryExpiredFlag (0x80) if the entry has expiredAt,
+//	otherwise expiredAt is omitted.
 func EncodeEntry(e *LogEntry) ([]byte, int) {
+	return EncodeEntryVersion(e, CurrentFormatVersion)
+}
+
+// EncodeEntryVersion will encode entry into a byte slice in the specified format version.
+//	Before FormatV3, keySize, valueSize and expiredAt are all zigzag varints.
+//	Since FormatV3, keySize and valueSize are uvarints, and expiredAt is a zigzag
+//	varint which is only present when entryExpiredFlag is set in the type byte.
+func EncodeEntryVersion(e *LogEntry, version FormatVersion) ([]byte, int) {
 	if e == nil {
 		return nil, 0
 	}
@@ -61,9 +93,18 @@ func EncodeEntry(e *LogEntry) ([]byte, int) {
 	meta[4] = byte(e.Type)
 
 	var index = 5
-	index += binary.PutVarint(meta[index:], int64(len(e.Key)))
-	index += binary.PutVarint(meta[index:], int64(len(e.Value)))
-	index += binary.PutVarint(meta[index:], e.ExpiredAt)
+	if version < FormatV3 {
+		index += binary.PutVarint(meta[index:], int64(len(e.Key)))
+		index += binary.PutVarint(meta[index:], int64(len(e.Value)))
+		index += binary.PutVarint(meta[index:], e.ExpiredAt)
+	} else {
+		index += binary.PutUvarint(meta[index:], uint64(len(e.Key)))
+		index += binary.PutUvarint(meta[index:], uint64(len(e.Value)))
+		if e.ExpiredAt != 0 {
+			meta[4] |= entryExpiredFlag
+			index += binary.PutVarint(meta[index:], e.ExpiredAt)
+		}
+	}
 
 	var size = index + len(e.Key) + len(e.Value)
 	buf := make([]byte, size)
@@ -76,6 +117,61 @@ func EncodeEntry(e *LogEntry) ([]byte, int) {
 	return buf, size
 }
 
+// EncodeBatch will encode the entries into the value of a batch entry in CurrentFormatVersion.
+// It returns the offsets of the entries in the value, the i-th entry is encoded in the range
+// [offsets[i], offsets[i+1]).
+func EncodeBatch(ents []*LogEntry) ([]byte, []int64) {
+	var buf []byte
+	offsets := make([]int64, 0, len(ents)+1)
+	for _, e := range ents {
+		offsets = append(offsets, int64(len(buf)))
+		entBuf, _ := EncodeEntry(e)
+		buf = append(buf, entBuf...)
+	}
+	offsets = append(offsets, int64(len(buf)))
+	return buf, offsets
+}
+
+// DecodeBatch will decode the value of a batch entry in the specified format version into the
+// entries, and returns the offsets of the entries in the value like EncodeBatch.
+func DecodeBatch(buf []byte, version FormatVersion) ([]*LogEntry, []int64, error) {
+	var ents []*LogEntry
+	var offset int64
+	offsets := []int64{0}
+	for offset < int64(len(buf)) {
+		meta, size := decodeMetaVersion(buf[offset:], version)
+		if meta == nil {
+			return nil, nil, ErrInvalidCrc
+		}
+		keySize, valSize := int64(meta.keySize), int64(meta.valSize)
+		entrySize := size + keySize + valSize
+		if offset+entrySize > int64(len(buf)) {
+			return nil, nil, ErrInvalidCrc
+		}
+		e := &LogEntry{
+			Key:       buf[offset+size : offset+size+keySize],
+			Value:     buf[offset+size+keySize : offset+entrySize],
+			ExpiredAt: meta.expiredAt,
+			Type:      meta.typ,
+		}
+		if crc := getEntryCrc(e, buf[offset+crc32.Size:offset+size]); crc != meta.crc32 {
+			return nil, nil, ErrInvalidCrc
+		}
+		ents = append(ents, e)
+		offset += entrySize
+		offsets = append(offsets, offset)
+	}
+	return ents, offsets, nil
+}
+
+// decodeMetaVersion decodes the entry header in the specified format version.
+func decodeMetaVersion(buf []byte, version FormatVersion) (*entryMeta, int64) {
+	if version < FormatV3 {
+		return decodeMeta(buf)
+	}
+	return decodeMetaV3(buf)
+}
+
 func decodeMeta(buf []byte) (*entryMeta, int64) {
 	if len(buf) <= 4 {
 		return nil, 0
@@ -99,6 +195,32 @@ func decodeMeta(buf []byte) (*entryMeta, int64) {
 	return meta, int64(index + n)
 }
 
+func decodeMetaV3(buf []byte) (*entryMeta, int64) {
+	if len(buf) <= 4 {
+		return nil, 0
+	}
+	meta := &entryMeta{
+		crc32: binary.LittleEndian.Uint32(buf[:4]),
+		typ:   EntryType(buf[4] &^ entryExpiredFlag),
+	}
+
+	var index = 5
+	keySize, n := binary.Uvarint(buf[index:])
+	meta.keySize = uint32(keySize)
+	index += n
+
+	valSize, n := binary.Uvarint(buf[index:])
+	meta.valSize = uint32(valSize)
+	index += n
+
+	if buf[4]&entryExpiredFlag != 0 {
+		expiredAt, n := binary.Varint(buf[index:])
+		meta.expiredAt = expiredAt
+		index += n
+	}
+	return meta, int64(index)
+}
+
 func getEntryCrc(e *LogEntry, m []byte) uint32 {
 	if e == nil {
 		return 0
@@ -1,12 +1,14 @@
 package storage
 
 import (
+	"encoding/binary"
+	"fmt"
 	"reflect"
 	"testing"
 )
 
 // @Author KHighness
-// @Update 2022-12-25
+// @Update 2023-01-26
 
 func TestEncodeEntry(t *testing.T) {
 	type args struct {
@@ -37,7 +39,7 @@ func TestEncodeEntry(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			buf, n := EncodeEntry(tt.args.e)
+			buf, n := EncodeEntryVersion(tt.args.e, FormatV2)
 			if !reflect.DeepEqual(buf, tt.want) {
 				t.Errorf("EncodeEntry() buf: actual = %v, expected = %v", buf, tt.want)
 			}
@@ -112,3 +114,142 @@ func Test_getEntryCrc(t *testing.T) {
 		})
 	}
 }
+
+func TestEncodeEntryVersion_V3(t *testing.T) {
+	tests := []struct {
+		name string
+		e    *LogEntry
+		len  int
+	}{
+		{"no-fields", &LogEntry{}, 7},
+		{"no-expiredAt", &LogEntry{Key: []byte("key"), Value: []byte("value")}, 15},
+		{"with-expiredAt", &LogEntry{Key: []byte("key"), Value: []byte("value"), ExpiredAt: 834758743589437598}, 24},
+		{"type-delete", &LogEntry{Key: []byte("key"), Type: TypeDelete}, 10},
+		{"type-list-meta", &LogEntry{Key: []byte("key"), Value: make([]byte, 8), Type: TypeListMeta, ExpiredAt: -1}, 19},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, n := EncodeEntryVersion(tt.e, FormatV3)
+			if n != tt.len || len(buf) != tt.len {
+				t.Errorf("EncodeEntryVersion() len: actual = %v, expected = %v", n, tt.len)
+			}
+			meta, size := decodeMetaV3(buf)
+			want := &entryMeta{
+				crc32:     binary.LittleEndian.Uint32(buf[:4]),
+				typ:       tt.e.Type,
+				keySize:   uint32(len(tt.e.Key)),
+				valSize:   uint32(len(tt.e.Value)),
+				expiredAt: tt.e.ExpiredAt,
+			}
+			if !reflect.DeepEqual(meta, want) {
+				t.Errorf("decodeMetaV3() meta: got = %v, want %v", meta, want)
+			}
+			if int(size) != n-len(tt.e.Key)-len(tt.e.Value) {
+				t.Errorf("decodeMetaV3() size: got = %v", size)
+			}
+			if crc := getEntryCrc(tt.e, buf[4:size]); crc != meta.crc32 {
+				t.Errorf("getEntryCrc() = %v, want %v", crc, meta.crc32)
+			}
+		})
+	}
+}
+
+func TestEncodeBatch(t *testing.T) {
+	ents := []*LogEntry{
+		{Key: []byte("key-1"), Value: []byte("value-1")},
+		{Key: []byte("key-2"), Value: []byte("value-2"), ExpiredAt: 834758743589437598},
+		{Key: []byte("key"), Value: make([]byte, 8), Type: TypeListMeta},
+	}
+	buf, offsets := EncodeBatch(ents)
+	if len(offsets) != len(ents)+1 || offsets[len(ents)] != int64(len(buf)) {
+		t.Fatalf("EncodeBatch() offsets: got = %v, len(buf) = %v", offsets, len(buf))
+	}
+	for i, e := range ents {
+		entBuf, _ := EncodeEntry(e)
+		if !reflect.DeepEqual(buf[offsets[i]:offsets[i+1]], entBuf) {
+			t.Errorf("EncodeBatch() entry %d: got = %v, want %v", i, buf[offsets[i]:offsets[i+1]], entBuf)
+		}
+	}
+
+	decoded, decodedOffsets, err := DecodeBatch(buf, CurrentFormatVersion)
+	if err != nil {
+		t.Fatalf("DecodeBatch() err: %v", err)
+	}
+	if !reflect.DeepEqual(decodedOffsets, offsets) {
+		t.Errorf("DecodeBatch() offsets: got = %v, want %v", decodedOffsets, offsets)
+	}
+	if !reflect.DeepEqual(decoded, ents) {
+		t.Errorf("DecodeBatch() entries: got = %v, want %v", decoded, ents)
+	}
+
+	buf[len(buf)-1]++
+	if _, _, err = DecodeBatch(buf, CurrentFormatVersion); err != ErrInvalidCrc {
+		t.Errorf("DecodeBatch() err: got = %v, want %v", err, ErrInvalidCrc)
+	}
+}
+
+// benchEntries are typical small entries written by set and list operations.
+var benchEntries = map[string]*LogEntry{
+	"set-member":      {Key: []byte("set:online"), Value: []byte("u42")},
+	"set-member-ttl":  {Key: []byte("set:online"), Value: []byte("u42"), ExpiredAt: 1673539200000000000},
+	"set-delete":      {Key: []byte("set:online"), Value: make([]byte, 18), Type: TypeDelete},
+	"list-meta":       {Key: []byte("queue:jobs"), Value: make([]byte, 8), Type: TypeListMeta},
+	"list-element-1K": {Key: make([]byte, 14), Value: make([]byte, 1<<10)},
+}
+
+func BenchmarkEncodeEntryVersion(b *testing.B) {
+	for _, version := range []FormatVersion{FormatV2, FormatV3} {
+		for name, e := range benchEntries {
+			b.Run(fmt.Sprintf("v%d/%s", version, name), func(b *testing.B) {
+				var size int
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					_, size = EncodeEntryVersion(e, version)
+				}
+				b.ReportMetric(float64(size), "bytes/entry")
+				b.SetBytes(int64(size))
+			})
+		}
+	}
+}
+
+func BenchmarkLogFile_ReadLogEntry(b *testing.B) {
+	for _, version := range []FormatVersion{FormatV2, FormatV3} {
+		for _, name := range []string{"set-member", "list-meta"} {
+			e := benchEntries[name]
+			b.Run(fmt.Sprintf("v%d/%s", version, name), func(b *testing.B) {
+				lf, err := OpenLogFile("/tmp", 9, 64<<20, Sets, FileIO)
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer func() {
+					_ = lf.Delete()
+				}()
+				// Stamp the new log file with the header of the benchmarked version.
+				if _, err = lf.IoSelector.Write(EncodeFileHeader(version), 0); err != nil {
+					b.Fatal(err)
+				}
+				lf.Version = version
+
+				buf, size := EncodeEntryVersion(e, version)
+				var offsets []int64
+				for lf.WriteAt+int64(size) < 64<<20 && len(offsets) < 1<<16 {
+					offsets = append(offsets, lf.WriteAt)
+					if err = lf.Write(buf); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				b.ReportAllocs()
+				b.SetBytes(int64(size))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, _, err = lf.ReadLogEntry(offsets[i%len(offsets)]); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
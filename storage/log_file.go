@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"hash/crc32"
+	"io"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 
@@ -12,7 +15,7 @@ import (
 )
 
 // @Author KHighness
-// @Update 2022-12-25
+// @Update 2023-01-26
 
 var (
 	// ErrInvalidCrc represents invalid crc.
@@ -44,23 +47,35 @@ const (
 	Hash
 	Sets
 	ZSet
+	Stream
+	JSON
 )
 
+// VLog represents the value log file, which stores the large values separated
+// from log files of data types, so it is not bound to any data type.
+const VLog FileType = -1
+
 var (
 	FileNamesMap = map[FileType]string{
-		Strs: "log.strs.",
-		List: "log.list.",
-		Hash: "log.hash.",
-		Sets: "log.sets.",
-		ZSet: "log.zset.",
+		Strs:   "log.strs.",
+		List:   "log.list.",
+		Hash:   "log.hash.",
+		Sets:   "log.sets.",
+		ZSet:   "log.zset.",
+		Stream: "log.stream.",
+		JSON:   "log.json.",
+		VLog:   "log.vlog.",
 	}
 
 	FileTypesMap = map[string]FileType{
-		"strs": Strs,
-		"list": List,
-		"hash": Hash,
-		"sets": Sets,
-		"zset": ZSet,
+		"strs":   Strs,
+		"list":   List,
+		"hash":   Hash,
+		"sets":   Sets,
+		"zset":   ZSet,
+		"stream": Stream,
+		"json":   JSON,
+		"vlog":   VLog,
 	}
 )
 
@@ -77,10 +92,14 @@ type LogFile struct {
 	sync.RWMutex
 	Fid        uint32
 	WriteAt    int64
+	Version    FormatVersion
 	IoSelector ioselector.IOSelector
 }
 
 // OpenLogFile opens an existing log file or creates a new log file.
+// A new log file is stamped with the header of CurrentFormatVersion, while the
+// format version of an existing log file is detected from its header, a log file
+// without header is considered as FormatV1.
 func OpenLogFile(path string, fid uint32, fsize int64, ftype FileType, ioType IOType) (logFile *LogFile, err error) {
 	logFile = &LogFile{Fid: fid}
 	fileName, err := logFile.generateLogFileName(path, fid, ftype)
@@ -103,17 +122,58 @@ func OpenLogFile(path string, fid uint32, fsize int64, ftype FileType, ioType IO
 	}
 
 	logFile.IoSelector = ioSelector
+	if err = logFile.initHeader(); err != nil {
+		_ = ioSelector.Close()
+		return nil, err
+	}
 	return
 }
 
+// OpenLogFileReadOnly opens an existing log file read-only, its format version is detected
+// from its header like OpenLogFile, but nothing is written into it.
+func OpenLogFileReadOnly(path string, fid uint32, ftype FileType) (logFile *LogFile, err error) {
+	logFile = &LogFile{Fid: fid}
+	fileName, err := logFile.generateLogFileName(path, fid, ftype)
+	if err != nil {
+		return nil, err
+	}
+	if logFile.IoSelector, err = ioselector.NewReadOnlyFileIOSelector(fileName); err != nil {
+		return nil, err
+	}
+
+	buf, err := logFile.readBytes(0, FileHeaderSize)
+	if err == io.EOF {
+		// The log file is too small to hold a file header.
+		logFile.Version = FormatV1
+		return logFile, nil
+	}
+	if err == nil {
+		err = logFile.detectVersion(buf)
+	}
+	if err != nil {
+		_ = logFile.IoSelector.Close()
+		return nil, err
+	}
+	return logFile, nil
+}
+
+// HeaderSize returns the size of file header, the first entry is located right behind it.
+func (lf *LogFile) HeaderSize() int64 {
+	return lf.Version.HeaderSize()
+}
+
 // ReadLogEntry reads a LogEntry from log file at offset.
 func (lf *LogFile) ReadLogEntry(offset int64) (*LogEntry, int64, error) {
-	// Read entry meta.
-	metaBuf, err := lf.readBytes(offset, MaxMetaSize)
-	if err != nil {
+	// Read entry meta, the entry at the tail of log file may be shorter than MaxMetaSize.
+	metaBuf := make([]byte, MaxMetaSize)
+	n, err := lf.IoSelector.Read(metaBuf, offset)
+	if err != nil && (err != io.EOF || n == 0) {
 		return nil, 0, err
 	}
-	meta, size := decodeMeta(metaBuf)
+	meta, size := decodeMetaVersion(metaBuf[:n], lf.Version)
+	if meta == nil || size > int64(n) {
+		return nil, 0, io.EOF
+	}
 	if meta.crc32 == 0 && meta.keySize == 0 && meta.valSize == 0 {
 		return nil, 0, ErrEndOfEntry
 	}
@@ -195,6 +255,61 @@ func (lf *LogFile) readBytes(offset, n int64) (buf []byte, err error) {
 	return
 }
 
+// initHeader writes the file header for a new log file, or detects the
+// format version from the file header of an existing log file.
+func (lf *LogFile) initHeader() error {
+	buf, err := lf.readBytes(0, FileHeaderSize)
+	if err != nil {
+		return err
+	}
+	if isZero(buf) {
+		if _, err = lf.IoSelector.Write(EncodeFileHeader(CurrentFormatVersion), 0); err != nil {
+			return err
+		}
+		lf.Version = CurrentFormatVersion
+		lf.WriteAt = FileHeaderSize
+		return nil
+	}
+
+	return lf.detectVersion(buf)
+}
+
+// detectVersion detects the format version from the file header of an existing log file,
+// a log file without header is considered as FormatV1.
+func (lf *LogFile) detectVersion(buf []byte) error {
+	version, ok := DecodeFileHeader(buf)
+	if !ok {
+		version = FormatV1
+	}
+	if !version.Supported() {
+		return ErrUnsupportedFormatVersion
+	}
+	lf.Version = version
+	lf.WriteAt = version.HeaderSize()
+	return nil
+}
+
+// ParseLogFileName parses the file type and fid from the name of log file.
+// Note that the fid in file name is padded with spaces, and it is blank if fid is 0.
+func ParseLogFileName(name string) (FileType, uint32, error) {
+	splitNames := strings.Split(name, ".")
+	if len(splitNames) != 3 || splitNames[0]+"." != FilePrefix {
+		return 0, 0, ErrUnsupportedLogFileType
+	}
+	fileType, ok := FileTypesMap[splitNames[1]]
+	if !ok {
+		return 0, 0, ErrUnsupportedLogFileType
+	}
+	var fid int
+	if fidStr := strings.TrimSpace(splitNames[2]); fidStr != "" {
+		var err error
+		if fid, err = strconv.Atoi(fidStr); err != nil {
+			return 0, 0, err
+		}
+	}
+	return fileType, uint32(fid), nil
+}
+
 // generateLogFileName generates log file name according to the file type.
 func (lf *LogFile) generateLogFileName(path string, fid uint32, ftype FileType) (name string, err error) {
 	if _, ok := FileNamesMap[ftype]; !ok {
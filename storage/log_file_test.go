@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"os"
 	"reflect"
 	"sync/atomic"
 	"testing"
@@ -10,7 +11,7 @@ import (
 )
 
 // @Author KHighness
-// @Update 2022-12-25
+// @Update 2023-01-26
 
 func TestOpenLogFile(t *testing.T) {
 	t.Run("fileio", func(t *testing.T) {
@@ -296,6 +297,44 @@ func testLogFileReadLogEntry(t *testing.T, ioType IOType) {
 	}
 }
 
+func TestLogFile_ReadLogEntryAtTail(t *testing.T) {
+	t.Run("fileio", func(t *testing.T) {
+		testLogFileReadLogEntryAtTail(t, FileIO)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testLogFileReadLogEntryAtTail(t, MMap)
+	})
+}
+
+func testLogFileReadLogEntryAtTail(t *testing.T, ioType IOType) {
+	const fileSize = 4096
+	lf, err := OpenLogFile("/tmp", 1, fileSize, Strs, ioType)
+	assert.Nil(t, err)
+	defer func() {
+		if lf != nil {
+			_ = lf.Delete()
+		}
+	}()
+
+	// The entry starts within the last MaxMetaSize bytes, and ends at the end of log file.
+	e := &LogEntry{Key: []byte("key"), Value: []byte{1, 2, 3, 4, 5, 6, 7, 8}, Type: TypeListMeta}
+	buf, size := EncodeEntry(e)
+	assert.True(t, size < MaxMetaSize)
+	offset := int64(fileSize - size)
+	_, err = lf.IoSelector.Write(buf, offset)
+	assert.Nil(t, err)
+
+	ent, entrySize, err := lf.ReadLogEntry(offset)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(size), entrySize)
+	assert.Equal(t, e, ent)
+
+	// Nothing can be read beyond the end of log file.
+	_, _, err = lf.ReadLogEntry(fileSize)
+	assert.NotNil(t, err)
+}
+
 func TestLogFile_Sync(t *testing.T) {
 	sync := func(ioType IOType) {
 		file, err := OpenLogFile("/tmp", 0, 100, Hash, ioType)
@@ -354,3 +393,79 @@ func TestLogFile_Delete(t *testing.T) {
 		deleteLf(MMap)
 	})
 }
+
+func TestOpenLogFile_Header(t *testing.T) {
+	t.Run("fileio", func(t *testing.T) {
+		testOpenLogFileHeader(t, FileIO)
+	})
+
+	t.Run("mmap", func(t *testing.T) {
+		testOpenLogFileHeader(t, MMap)
+	})
+}
+
+func testOpenLogFileHeader(t *testing.T, ioType IOType) {
+	lf, err := OpenLogFile("/tmp", 3, 1<<20, Hash, ioType)
+	assert.Nil(t, err)
+	assert.Equal(t, CurrentFormatVersion, lf.Version)
+	assert.Equal(t, int64(FileHeaderSize), lf.HeaderSize())
+	assert.Equal(t, int64(FileHeaderSize), atomic.LoadInt64(&lf.WriteAt))
+
+	buf, _ := EncodeEntry(&LogEntry{Key: []byte("k"), Value: []byte("v")})
+	assert.Nil(t, lf.Write(buf))
+	assert.Nil(t, lf.Close())
+
+	lf, err = OpenLogFile("/tmp", 3, 1<<20, Hash, ioType)
+	assert.Nil(t, err)
+	defer func() {
+		_ = lf.Delete()
+	}()
+	assert.Equal(t, CurrentFormatVersion, lf.Version)
+	ent, _, err := lf.ReadLogEntry(lf.HeaderSize())
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), ent.Value)
+}
+
+func TestOpenLogFile_Legacy(t *testing.T) {
+	lf, err := OpenLogFile("/tmp", 4, 1<<20, Hash, FileIO)
+	assert.Nil(t, err)
+	fileName, _ := lf.generateLogFileName("/tmp", 4, Hash)
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	// Overwrite the header with an entry to simulate a FormatV1 log file.
+	buf, _ := EncodeEntryVersion(&LogEntry{Key: []byte("k"), Value: []byte("v")}, FormatV1)
+	_, err = lf.IoSelector.Write(buf, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, lf.Close())
+
+	lf, err = OpenLogFile("/tmp", 4, 1<<20, Hash, FileIO)
+	assert.Nil(t, err)
+	assert.Equal(t, FormatV1, lf.Version)
+	assert.Equal(t, int64(0), lf.HeaderSize())
+	ent, _, err := lf.ReadLogEntry(lf.HeaderSize())
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("k"), ent.Key)
+
+	_, err = lf.IoSelector.Write(EncodeFileHeader(CurrentFormatVersion+1), 0)
+	assert.Nil(t, err)
+	assert.Nil(t, lf.Close())
+	_, err = OpenLogFile("/tmp", 4, 1<<20, Hash, FileIO)
+	assert.Equal(t, ErrUnsupportedFormatVersion, err)
+}
+
+func TestParseLogFileName(t *testing.T) {
+	for _, fid := range []uint32{0, 1, 12, 999} {
+		lf := &LogFile{}
+		name, err := lf.generateLogFileName("", fid, ZSet)
+		assert.Nil(t, err)
+		fileType, gotFid, err := ParseLogFileName(name)
+		assert.Nil(t, err)
+		assert.Equal(t, ZSet, fileType)
+		assert.Equal(t, fid, gotFid)
+	}
+
+	_, _, err := ParseLogFileName("log.unknown.1")
+	assert.Equal(t, ErrUnsupportedLogFileType, err)
+}
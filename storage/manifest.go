@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Khighness/khighdb/ioselector"
+)
+
+// @Author KHighness
+// @Update 2023-01-12
+
+var (
+	// ErrManifestNotFound represents the manifest file does not exist in the directory.
+	ErrManifestNotFound = errors.New("manifest: file not found")
+	// ErrInvalidManifest represents the manifest file is corrupted.
+	ErrInvalidManifest = errors.New("manifest: invalid content")
+)
+
+const (
+	// ManifestFileName is the name of the manifest file in db directory.
+	ManifestFileName = "MANIFEST"
+
+	// manifestSize is the size of manifest file.
+	//	The structure of manifest file:
+	//	+-----------+-----------+-----------+
+	//	|   magic   |  version  |   crc32   |
+	//	+-----------+-----------+-----------+
+	//	|   uint32  |   uint32  |   uint32  |
+	//	+-----------+-----------+-----------+
+	manifestSize = FileHeaderSize + 4
+)
+
+// ReadManifest reads the format version recorded in the manifest file of directory.
+// It returns ErrManifestNotFound if the directory has no manifest file.
+func ReadManifest(path string) (FormatVersion, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(path, ManifestFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, ErrManifestNotFound
+		}
+		return 0, err
+	}
+	if len(buf) != manifestSize {
+		return 0, ErrInvalidManifest
+	}
+	if crc32.ChecksumIEEE(buf[:FileHeaderSize]) != binary.LittleEndian.Uint32(buf[FileHeaderSize:]) {
+		return 0, ErrInvalidManifest
+	}
+	version, ok := DecodeFileHeader(buf)
+	if !ok {
+		return 0, ErrInvalidManifest
+	}
+	return version, nil
+}
+
+// WriteManifest records the format version in the manifest file of directory.
+// The content is written to a temporary file first and then renamed, so that
+// a crash never leaves a partial manifest behind.
+func WriteManifest(path string, version FormatVersion) error {
+	buf := make([]byte, manifestSize)
+	copy(buf, EncodeFileHeader(version))
+	binary.LittleEndian.PutUint32(buf[FileHeaderSize:], crc32.ChecksumIEEE(buf[:FileHeaderSize]))
+
+	fileName := filepath.Join(path, ManifestFileName)
+	tmpName := fileName + ".tmp"
+	file, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, ioselector.FilePerm)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(buf); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
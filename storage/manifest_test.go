@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-12
+
+func TestWriteManifest_ReadManifest(t *testing.T) {
+	path := filepath.Join("/tmp", "khighdb-manifest")
+	assert.Nil(t, os.MkdirAll(path, os.ModePerm))
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+
+	_, err := ReadManifest(path)
+	assert.Equal(t, ErrManifestNotFound, err)
+
+	assert.Nil(t, WriteManifest(path, CurrentFormatVersion))
+	version, err := ReadManifest(path)
+	assert.Nil(t, err)
+	assert.Equal(t, CurrentFormatVersion, version)
+
+	assert.Nil(t, WriteManifest(path, CurrentFormatVersion+1))
+	version, err = ReadManifest(path)
+	assert.Nil(t, err)
+	assert.False(t, version.Supported())
+
+	buf, err := ioutil.ReadFile(filepath.Join(path, ManifestFileName))
+	assert.Nil(t, err)
+	buf[4]++
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(path, ManifestFileName), buf, 0644))
+	_, err = ReadManifest(path)
+	assert.Equal(t, ErrInvalidManifest, err)
+}
+
+func TestDecodeFileHeader(t *testing.T) {
+	version, ok := DecodeFileHeader(EncodeFileHeader(FormatV2))
+	assert.True(t, ok)
+	assert.Equal(t, FormatV2, version)
+
+	_, ok = DecodeFileHeader([]byte{28, 223, 68, 33, 0, 0, 0, 0})
+	assert.False(t, ok)
+	_, ok = DecodeFileHeader(nil)
+	assert.False(t, ok)
+}
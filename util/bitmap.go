@@ -0,0 +1,110 @@
+package util
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// @Author KHighness
+// @Update 2023-01-25
+
+// The bits of bitmap are numbered from the most significant bit of the first byte,
+// which is the same as Redis. The bits beyond the bitmap are regarded as 0.
+
+// GetBit returns the bit at offset of the bitmap.
+func GetBit(bitmap []byte, offset uint64) bool {
+	i := offset >> 3
+	if i >= uint64(len(bitmap)) {
+		return false
+	}
+	return bitmap[i]&(0x80>>(offset&7)) != 0
+}
+
+// SetBit sets or clears the bit at offset of the bitmap, which must be long enough.
+func SetBit(bitmap []byte, offset uint64, on bool) {
+	mask := byte(0x80 >> (offset & 7))
+	if on {
+		bitmap[offset>>3] |= mask
+	} else {
+		bitmap[offset>>3] &^= mask
+	}
+}
+
+// BitCount returns the number of set bits of the bitmap between the bit offsets start and end,
+// both are inclusive.
+func BitCount(bitmap []byte, start, end uint64) int {
+	if max := uint64(len(bitmap))*8 - 1; len(bitmap) == 0 || start > max {
+		return 0
+	} else if end > max {
+		end = max
+	}
+	if start > end {
+		return 0
+	}
+
+	first, last := start>>3, end>>3
+	headMask, tailMask := byte(0xff>>(start&7)), byte(0xff<<(7-end&7))
+	if first == last {
+		return bits.OnesCount8(bitmap[first] & headMask & tailMask)
+	}
+	count := bits.OnesCount8(bitmap[first]&headMask) + bits.OnesCount8(bitmap[last]&tailMask)
+	middle := bitmap[first+1 : last]
+	for len(middle) >= 8 {
+		count += bits.OnesCount64(binary.BigEndian.Uint64(middle))
+		middle = middle[8:]
+	}
+	for _, b := range middle {
+		count += bits.OnesCount8(b)
+	}
+	return count
+}
+
+// BitPos returns the offset of the first bit equal to bit in the bitmap between the bit offsets
+// start and end, both are inclusive. It returns -1 if no such bit is found in the bitmap.
+func BitPos(bitmap []byte, bit bool, start, end uint64) int64 {
+	if max := uint64(len(bitmap))*8 - 1; len(bitmap) == 0 || start > max {
+		return -1
+	} else if end > max {
+		end = max
+	}
+
+	// The bytes without the bit are skipped.
+	var skip byte
+	if bit {
+		skip = 0x00
+	} else {
+		skip = 0xff
+	}
+	for offset := start; offset <= end; {
+		if offset&7 == 0 && offset+7 <= end && bitmap[offset>>3] == skip {
+			offset += 8
+			continue
+		}
+		if GetBit(bitmap, offset) == bit {
+			return int64(offset)
+		}
+		offset++
+	}
+	return -1
+}
+
+// GetBits returns the unsigned integer formed by the width bits at offset of the bitmap,
+// the first bit is the most significant. The width must not be greater than 64.
+func GetBits(bitmap []byte, offset uint64, width uint) uint64 {
+	var value uint64
+	for i := uint64(0); i < uint64(width); i++ {
+		value <<= 1
+		if GetBit(bitmap, offset+i) {
+			value |= 1
+		}
+	}
+	return value
+}
+
+// SetBits sets the width bits at offset of the bitmap to the lowest width bits of value,
+// the bitmap must be long enough. The width must not be greater than 64.
+func SetBits(bitmap []byte, offset uint64, width uint, value uint64) {
+	for i := uint64(0); i < uint64(width); i++ {
+		SetBit(bitmap, offset+i, value&(1<<(uint64(width)-1-i)) != 0)
+	}
+}
@@ -0,0 +1,71 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-25
+
+func TestSetBit(t *testing.T) {
+	bitmap := make([]byte, 2)
+	SetBit(bitmap, 0, true)
+	SetBit(bitmap, 9, true)
+	SetBit(bitmap, 15, true)
+	assert.Equal(t, []byte{0x80, 0x41}, bitmap)
+	SetBit(bitmap, 9, false)
+	assert.Equal(t, []byte{0x80, 0x01}, bitmap)
+
+	assert.True(t, GetBit(bitmap, 0))
+	assert.False(t, GetBit(bitmap, 1))
+	assert.True(t, GetBit(bitmap, 15))
+	assert.False(t, GetBit(bitmap, 100))
+}
+
+func TestBitCount(t *testing.T) {
+	bitmap := []byte("foobar")
+	testCases := []struct {
+		name       string
+		start, end uint64
+		expCount   int
+	}{
+		{"all", 0, 47, 26},
+		{"first byte", 0, 7, 4},
+		{"in one byte", 1, 3, 2},
+		{"across bytes", 5, 30, 17},
+		{"beyond end", 40, 100, 4},
+		{"out of range", 48, 100, 0},
+		{"empty", 10, 9, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expCount, BitCount(bitmap, tc.start, tc.end))
+		})
+	}
+	assert.Equal(t, 0, BitCount(nil, 0, 0))
+}
+
+func TestBitPos(t *testing.T) {
+	bitmap := []byte{0x00, 0x00, 0x01, 0xff}
+	assert.Equal(t, int64(23), BitPos(bitmap, true, 0, 31))
+	assert.Equal(t, int64(0), BitPos(bitmap, false, 0, 31))
+	assert.Equal(t, int64(-1), BitPos(bitmap, true, 0, 22))
+	assert.Equal(t, int64(-1), BitPos(bitmap, false, 23, 100))
+	assert.Equal(t, int64(-1), BitPos(nil, true, 0, 0))
+}
+
+func TestSetBits(t *testing.T) {
+	bitmap := make([]byte, 3)
+	SetBits(bitmap, 4, 12, 0xabc)
+	assert.Equal(t, []byte{0x0a, 0xbc, 0x00}, bitmap)
+	assert.Equal(t, uint64(0xabc), GetBits(bitmap, 4, 12))
+	assert.Equal(t, uint64(0xb), GetBits(bitmap, 8, 4))
+	assert.Equal(t, uint64(0), GetBits(bitmap, 20, 8))
+
+	bitmap = make([]byte, 9)
+	SetBits(bitmap, 4, 64, 1<<63|1)
+	assert.Equal(t, uint64(1<<63|1), GetBits(bitmap, 4, 64))
+	assert.Equal(t, []byte{0x08, 0, 0, 0, 0, 0, 0, 0, 0x10}, bitmap)
+}
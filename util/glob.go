@@ -0,0 +1,150 @@
+package util
+
+// @Author KHighness
+// @Update 2023-01-18
+
+// maxGlobNesting is the max nesting of '*' in a pattern, which protects against abusive patterns.
+const maxGlobNesting = 1000
+
+// GlobMatch checks if str matches the glob-style pattern, which follows the behavior of
+// stringmatchlen in Redis, so an invalid pattern never matches instead of returning error.
+//	+-----------+-----------------------------------------------------+
+//	|  pattern  |                    description                      |
+//	+-----------+-----------------------------------------------------+
+//	|     *     |  matches any sequence of bytes, including empty one |
+//	|     ?     |  matches any single byte                            |
+//	|   [abc]   |  matches one byte in the brackets                   |
+//	|   [^abc]  |  matches one byte not in the brackets               |
+//	|   [a-z]   |  matches one byte in the range                      |
+//	|     \x    |  matches byte x literally                           |
+//	+-----------+-----------------------------------------------------+
+func GlobMatch(pattern, str []byte, nocase bool) bool {
+	var skipLongerMatches bool
+	return globMatch(pattern, str, nocase, &skipLongerMatches, 0)
+}
+
+func globMatch(pattern, str []byte, nocase bool, skipLongerMatches *bool, nesting int) bool {
+	if nesting > maxGlobNesting {
+		return false
+	}
+
+	for len(pattern) > 0 && len(str) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for len(str) > 0 {
+				if globMatch(pattern[1:], str, nocase, skipLongerMatches, nesting+1) {
+					return true
+				}
+				if *skipLongerMatches {
+					return false
+				}
+				str = str[1:]
+			}
+			// The rest of pattern doesn't match from anywhere in the rest of str, so the
+			// earlier '*' can't match either by consuming more bytes.
+			*skipLongerMatches = true
+			return false
+		case '?':
+			str = str[1:]
+		case '[':
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			var match bool
+			for {
+				if len(pattern) == 0 {
+					// The brackets are not closed, keep the last byte to be skipped below.
+					pattern = []byte{']'}
+					break
+				} else if pattern[0] == '\\' && len(pattern) >= 2 {
+					pattern = pattern[1:]
+					if pattern[0] == str[0] {
+						match = true
+					}
+				} else if pattern[0] == ']' {
+					break
+				} else if len(pattern) >= 3 && pattern[1] == '-' {
+					start, end, c := pattern[0], pattern[2], str[0]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, c = toLower(start), toLower(end), toLower(c)
+					}
+					pattern = pattern[2:]
+					if c >= start && c <= end {
+						match = true
+					}
+				} else if equalByte(pattern[0], str[0], nocase) {
+					match = true
+				}
+				pattern = pattern[1:]
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			str = str[1:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if !equalByte(pattern[0], str[0], nocase) {
+				return false
+			}
+			str = str[1:]
+		}
+		pattern = pattern[1:]
+		if len(str) == 0 {
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			break
+		}
+	}
+	return len(pattern) == 0 && len(str) == 0
+}
+
+// GlobPrefix returns the literal prefix of the glob-style pattern, all the strings matching
+// the pattern have the prefix, so it can be used to narrow the range to be matched.
+// The whole pattern is returned with exact true if it has no wildcards.
+func GlobPrefix(pattern []byte) (prefix []byte, exact bool) {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?', '[':
+			return prefix, false
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+		}
+		prefix = append(prefix, pattern[i])
+	}
+	return prefix, true
+}
+
+func equalByte(a, b byte, nocase bool) bool {
+	if nocase {
+		return toLower(a) == toLower(b)
+	}
+	return a == b
+}
+
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// @Author KHighness
+// @Update 2023-01-18
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		str     string
+		nocase  bool
+		want    bool
+	}{
+		{"empty", "", "", false, true},
+		{"literal", "hello", "hello", false, true},
+		{"literal-mismatch", "hello", "hell", false, false},
+		{"star", "*", "anything", false, true},
+		{"star-empty-string", "*", "", false, false},
+		{"star-middle", "h*o", "hello", false, true},
+		{"star-suffix", "user:*", "user:1000", false, true},
+		{"multi-star", "a**b*c", "axxbyyc", false, true},
+		{"star-mismatch", "a*b", "acd", false, false},
+		{"question", "h?llo", "hallo", false, true},
+		{"question-mismatch", "h?llo", "hllo", false, false},
+		{"class", "h[ae]llo", "hello", false, true},
+		{"class-mismatch", "h[ae]llo", "hillo", false, false},
+		{"class-not", "h[^e]llo", "hallo", false, true},
+		{"class-not-mismatch", "h[^e]llo", "hello", false, false},
+		{"class-range", "h[a-b]llo", "hbllo", false, true},
+		{"class-reverse-range", "h[b-a]llo", "hallo", false, true},
+		{"class-escape", "h[\\]]llo", "h]llo", false, true},
+		{"class-unclosed", "h[a", "ha", false, true},
+		{"class-unclosed-mismatch", "[", "x", false, false},
+		{"escape", "h\\*llo", "h*llo", false, true},
+		{"escape-mismatch", "h\\*llo", "hello", false, false},
+		{"trailing-backslash", "h\\", "h\\", false, true},
+		{"nocase", "HeLLo", "hello", true, true},
+		{"nocase-range", "[A-C]at", "bat", true, true},
+		{"case-sensitive", "HeLLo", "hello", false, false},
+		{"trailing-stars", "hello**", "hello", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, GlobMatch([]byte(tt.pattern), []byte(tt.str), tt.nocase))
+		})
+	}
+}
+
+func TestGlobMatch_Abusive(t *testing.T) {
+	pattern := []byte(strings.Repeat("a*", 50) + "b")
+	str := []byte(strings.Repeat("a", 100))
+	assert.False(t, GlobMatch(pattern, str, false))
+}
+
+func TestGlobPrefix(t *testing.T) {
+	tests := []struct {
+		pattern string
+		prefix  string
+		exact   bool
+	}{
+		{"", "", true},
+		{"user:1000", "user:1000", true},
+		{"user:*", "user:", false},
+		{"user:?0", "user:", false},
+		{"user:[0-9]*", "user:", false},
+		{"a\\*b*", "a*b", false},
+		{"*", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			prefix, exact := GlobPrefix([]byte(tt.pattern))
+			assert.Equal(t, tt.prefix, string(prefix))
+			assert.Equal(t, tt.exact, exact)
+		})
+	}
+}
@@ -40,3 +40,14 @@ func (m *Murmur128) EncodeSum128() []byte {
 func (m *Murmur128) Reset() {
 	m.mur.Reset()
 }
+
+// Sum128 returns the encoded 128-bit murmur sum of b, which is equal to the sum encoded by
+// Murmur128 but is safe for concurrent use.
+func Sum128(b []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64*2)
+	s1, s2 := murmur3.Sum128(b)
+	var index int
+	index += binary.PutUvarint(buf[index:], s1)
+	index += binary.PutUvarint(buf[index:], s2)
+	return buf[:index]
+}
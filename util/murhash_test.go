@@ -30,3 +30,9 @@ func TestMurmur128_Reset(t *testing.T) {
 	sum2 := mur.EncodeSum128()
 	assert.Equal(t, sum1, sum2)
 }
+
+func TestSum128(t *testing.T) {
+	mur := NewMurmur128()
+	_ = mur.Write([]byte("KHighness"))
+	assert.Equal(t, mur.EncodeSum128(), Sum128([]byte("KHighness")))
+}